@@ -67,6 +67,11 @@ std::vector<uint32_t> memorySizes {
       128 * 1024 * 1024U,       // 128MB
 };
 
+#if TARGET_OS == GAPID_OS_ANDROID
+// The size of the resource cache kept on the device across the replays.
+const size_t persistentCacheSize = 512 * 1024 * 1024U;  // 512MB
+#endif
+
 #if TARGET_OS == GAPID_OS_LINUX || TARGET_OS == GAPID_OS_OSX
 std::string getTempOnDiskCachePath() {
   const char* tmpDir = std::getenv("TMPDIR");
@@ -94,28 +99,36 @@ std::string getTempOnDiskCachePath() {
 
 // Setup creates and starts a replay server at the given URI port. Returns the
 // created and started server.
+// The resources missing from the cache are looked up in the persistentCache,
+// if any, before being fetched from the client.
 // Note the given memory manager and the crash handler, they may be used for
 // multiple connections, so a mutex lock is passed in to make the accesses to
 // to them exclusive to one connected client. All other replay requests from
 // other clients will be blocked, until the current replay finishes.
 std::unique_ptr<Server> Setup(const char* uri, const char* authToken,
-                              ResourceCache* cache, int idleTimeoutSec,
+                              ResourceCache* cache,
+                              ResourceCache* persistentCache,
+                              int idleTimeoutSec,
                               core::CrashHandler* crashHandler,
                               MemoryManager* memMgr, std::mutex* lock) {
   // Return a replay server with the following replay ID handler. The first
   // package for a replay must be the ID of the replay.
   return Server::createAndStart(
       uri, authToken, idleTimeoutSec,
-      [cache, memMgr, crashHandler, lock](GrpcReplayService* replayConn,
-                                          const std::string& replayId) {
+      [cache, persistentCache, memMgr, crashHandler, lock](
+          GrpcReplayService* replayConn, const std::string& replayId) {
         std::lock_guard<std::mutex> mem_mgr_crash_hdl_lock_guard(*lock);
 
-        std::unique_ptr<ResourceLoader> resLoader;
-        if (cache == nullptr) {
-          resLoader = PassThroughResourceLoader::create(replayConn);
-        } else {
-          resLoader = CachedResourceLoader::create(
-              cache, PassThroughResourceLoader::create(replayConn));
+        std::unique_ptr<ResourceLoader> resLoader =
+            PassThroughResourceLoader::create(replayConn);
+        if (persistentCache != nullptr) {
+          resLoader = CachedResourceLoader::create(persistentCache,
+                                                   std::move(resLoader));
+        }
+        // The loader used for fetching the resources missing from the cache.
+        ResourceLoader* fetcher = resLoader.get();
+        if (cache != nullptr) {
+          resLoader = CachedResourceLoader::create(cache, std::move(resLoader));
         }
 
         std::unique_ptr<CrashUploader> crash_uploader =
@@ -130,7 +143,7 @@ std::unique_ptr<Server> Setup(const char* uri, const char* authToken,
           return;
         }
         if (cache != nullptr) {
-          context->prefetch(cache);
+          context->prefetch(cache, fetcher);
         }
 
         GAPID_INFO("Replay started");
@@ -168,11 +181,74 @@ void android_process(struct android_app* app, int32_t cmd) {
   }
 }
 
+// Processes the events of the app until the window is created or the app is
+// destroyed. Returns true if the window is created.
+bool android_wait_for_window(struct android_app* app) {
+  app->onAppCmd = android_process;
+  while (gapir::android_window == nullptr && !app->destroyRequested) {
+    int events;
+    struct android_poll_source* source;
+    if (ALooper_pollAll(-1, nullptr, &events, (void**)&source) >= 0 &&
+        source != nullptr) {
+      source->process(app, source);
+    }
+  }
+  return gapir::android_window != nullptr;
+}
+
+// Replays the archive exported by gapit export_replay --bundle, which the
+// launcher of the bundle pushes to the given directory. The postbacks of the
+// replay are written to its postbacks directory, and the payload is removed
+// once replayed, so that the next launches start the replay server.
+void android_replay_archive(struct android_app* app, const std::string& archive,
+                            MemoryManager* memoryManager,
+                            CrashHandler* crashHandler) {
+  std::string payloadPath = archive + "/payload.bin";
+  std::string postbackDir = archive + "/postbacks";
+  mkdir(postbackDir.c_str(), S_IRWXU);
+  if (android_wait_for_window(app)) {
+    gapir::ArchiveReplayService replayArchive(payloadPath, postbackDir);
+    // All the resource data must be in the archive file, no fallback
+    // resource loader to fetch uncached resources data.
+    auto onDiskCache = OnDiskResourceCache::create(archive, false);
+    std::unique_ptr<ResourceLoader> resLoader =
+        CachedResourceLoader::create(onDiskCache.get(), nullptr);
+    std::unique_ptr<Context> context = Context::create(
+        &replayArchive, *crashHandler, resLoader.get(), memoryManager);
+
+    GAPID_INFO("Replay started");
+    bool ok = context != nullptr && context->interpret();
+    GAPID_INFO("Replay %s", ok ? "finished successfully" : "failed");
+  }
+  unlink(payloadPath.c_str());
+
+  ANativeActivity_finish(app->activity);
+  while (!app->destroyRequested) {
+    int events;
+    struct android_poll_source* source;
+    if (ALooper_pollAll(-1, nullptr, &events, (void**)&source) >= 0 &&
+        source != nullptr) {
+      source->process(app, source);
+    }
+  }
+}
+
 // Main function for android
 void android_main(struct android_app* app) {
   MemoryManager memoryManager(memorySizes);
   CrashHandler crashHandler;
 
+  if (app->activity->externalDataPath != nullptr) {
+    std::string archive =
+        std::string(app->activity->externalDataPath) + "/replay";
+    if (access((archive + "/payload.bin").c_str(), F_OK) == 0) {
+      __android_log_print(ANDROID_LOG_DEBUG, "GAPIR",
+                          "Replaying the archive in '%s'\n", archive.c_str());
+      android_replay_archive(app, archive, &memoryManager, &crashHandler);
+      return;
+    }
+  }
+
   // Get the path of the file system socket.
   const char* pipe = pipeName();
   std::string internal_data_path = std::string(app->activity->internalDataPath);
@@ -186,11 +262,13 @@ void android_main(struct android_app* app) {
                       uri.c_str(), core::supportedABIs());
 
   auto cache = InMemoryResourceCache::create(memoryManager.getTopAddress());
+  auto persistentCache = PersistentResourceCache::create(
+      internal_data_path + "/resource-cache", persistentCacheSize);
   int idleTimeoutSec = 0;  // No timeout
   std::mutex lock;
   std::unique_ptr<Server> server =
-      Setup(uri.c_str(), nullptr, cache.get(), idleTimeoutSec, &crashHandler,
-            &memoryManager, &lock);
+      Setup(uri.c_str(), nullptr, cache.get(), persistentCache.get(),
+            idleTimeoutSec, &crashHandler, &memoryManager, &lock);
   std::thread waiting_thread([&]() { server.get()->wait(); });
   if (chmod(socket_file_path.c_str(), S_IRUSR | S_IWUSR | S_IROTH | S_IWOTH)) {
     GAPID_ERROR("Chmod failed!");
@@ -232,6 +310,11 @@ struct Options {
     const char* path = "";
   };
 
+  struct PersistentCache {
+    const char* path = nullptr;
+    size_t sizeMB = 1024;
+  };
+
   int logLevel = LOG_LEVEL;
   const char* logPath = "logs/gapir.log";
 
@@ -252,6 +335,7 @@ struct Options {
   bool version = false;
 
   OnDiskCache onDiskCacheOptions;
+  PersistentCache persistentCacheOptions;
 
   static Options Parse(int argc, const char* argv[]) {
     Options opts;
@@ -286,6 +370,18 @@ struct Options {
         opts.onDiskCacheOptions.path = argv[++i];
       } else if (strcmp(argv[i], "--cleanup-on-disk-cache") == 0) {
         opts.onDiskCacheOptions.cleanUp = true;
+      } else if (strcmp(argv[i], "--persistent-cache-path") == 0) {
+        opts.SetMode(kReplayServer);
+        if (i + 1 >= argc) {
+          GAPID_FATAL("Usage: --persistent-cache-path <cache-directory>");
+        }
+        opts.persistentCacheOptions.path = argv[++i];
+      } else if (strcmp(argv[i], "--persistent-cache-size") == 0) {
+        opts.SetMode(kReplayServer);
+        if (i + 1 >= argc) {
+          GAPID_FATAL("Usage: --persistent-cache-size <size in MB>");
+        }
+        opts.persistentCacheOptions.sizeMB = atoi(argv[++i]);
       } else if (strcmp(argv[i], "--port") == 0) {
         opts.SetMode(kReplayServer);
         if (i + 1 >= argc) {
@@ -499,10 +595,23 @@ static int startServer(Options opts) {
 
   auto cache = createCache(opts.onDiskCacheOptions, &memoryManager);
 
+  std::unique_ptr<PersistentResourceCache> persistentCache;
+  if (opts.persistentCacheOptions.path != nullptr) {
+    persistentCache = PersistentResourceCache::create(
+        opts.persistentCacheOptions.path,
+        opts.persistentCacheOptions.sizeMB * 1024 * 1024);
+    if (persistentCache != nullptr) {
+      GAPID_INFO("Persistent cache of %zuMB at %s",
+                 opts.persistentCacheOptions.sizeMB,
+                 opts.persistentCacheOptions.path);
+    }
+  }
+
   std::mutex lock;
   std::unique_ptr<Server> server = Setup(
       uri.c_str(), (authToken.size() > 0) ? authToken.data() : nullptr,
-      cache.get(), opts.idleTimeoutSec, &crashHandler, &memoryManager, &lock);
+      cache.get(), persistentCache.get(), opts.idleTimeoutSec, &crashHandler,
+      &memoryManager, &lock);
   // The following message is parsed by launchers to detect the selected port.
   // DO NOT CHANGE!
   printf("Bound on port '%s'\n", portStr.c_str());
@@ -16,8 +16,10 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"sync"
@@ -38,7 +40,9 @@ import (
 	"github.com/google/gapid/core/text"
 	"github.com/google/gapid/gapir/client"
 	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/extensions"
 	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/resolve"
 	"github.com/google/gapid/gapis/server"
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
@@ -60,8 +64,15 @@ var (
 	addLocalDevice   = flag.Bool("add-local-device", true, "Server can trace and replay locally")
 	idleTimeout      = flag.Duration("idle-timeout", 0, "_Closes GAPIS if the server is not repeatedly pinged within this duration")
 	adbPath          = flag.String("adb", "", "Path to the adb executable; leave empty to search the environment")
+	adbForward       = flag.Bool("adb-forward", false, "_Connect to the Android replay devices on ports forwarded with adb forward rather than on adb server streams")
 	enableLocalFiles = flag.Bool("enable-local-files", false, "Allow clients to access local .gfxtrace files by path")
 	remoteSSHConfig  = flag.String("ssh-config", "", "_Path to an ssh config file for remote devices")
+	databaseDir      = flag.String("database", "~/.gapid/database", "_Directory of the database records kept across sessions, such as the dependency graphs of captures; empty to not keep them")
+	cacheLimit       = flag.Int("resolve-cache-limit", 0, "_Size in MB of the resolved values above which the least recently used are evicted, 0 for no limit")
+	heapLimit        = flag.Int("heap-limit", 0, "_Heap size in MB above which half of the resolved values are evicted, 0 to disable")
+	pluginsDir       = flag.String("plugins", "", "_Directory of the Go plugins registering extensions, such as analysis passes")
+	tlsCert          = flag.String("tls-cert", "", "PEM file of the certificate for TLS connections; connections are insecure if empty")
+	tlsKey           = flag.String("tls-key", "", "PEM file of the private key of the TLS certificate")
 )
 
 func main() {
@@ -96,6 +107,7 @@ func run(ctx context.Context) error {
 	if *adbPath != "" {
 		adb.ADB = file.Abs(*adbPath)
 	}
+	client.ForwardADBPorts = *adbForward
 
 	r := bind.NewRegistry()
 	ctx = bind.PutRegistry(ctx, r)
@@ -103,6 +115,21 @@ func run(ctx context.Context) error {
 	ctx = replay.PutManager(ctx, m)
 	ctx = trace.PutManager(ctx, trace.New(ctx))
 	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	if c := database.GetCache(ctx); c != nil {
+		c.SetCacheLimit(ctx, uint64(*cacheLimit)<<20)
+		if *heapLimit > 0 {
+			crash.Go(func() { database.MonitorMemoryPressure(ctx, c, uint64(*heapLimit)<<20, 5*time.Second) })
+		}
+	}
+	if p := database.GetPersistent(ctx); p != nil && *databaseDir != "" {
+		p.SetPersistentDirectory(file.Abs(*databaseDir).System())
+	}
+	ctx = resolve.PutAnnotationStore(ctx, resolve.NewAnnotationStore())
+	if *pluginsDir != "" {
+		if err := extensions.LoadPlugins(ctx, *pluginsDir); err != nil {
+			return err
+		}
+	}
 
 	grpclog.SetLogger(log.From(ctx))
 
@@ -131,6 +158,23 @@ func run(ctx context.Context) error {
 		crash.Go(func() { getRemoteSSHDevices(ctx, r, f, wg.Done) })
 	}
 
+	var tlsConfig *tls.Config
+	if *tlsCert != "" || *tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			return log.Err(ctx, err, "Could not load the TLS certificate")
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	if host, _, err := net.SplitHostPort(*rpc); err == nil && host != "localhost" && !net.ParseIP(host).IsLoopback() {
+		if *gapisAuthToken == "" {
+			log.W(ctx, "Listening on %v without an auth token, any client reaching it can connect", *rpc)
+		}
+		if tlsConfig == nil {
+			log.W(ctx, "Listening on %v without TLS, the connections are not encrypted", *rpc)
+		}
+	}
+
 	deviceScanDone, onDeviceScanDone := task.NewSignal()
 	crash.Go(func() {
 		wg.Wait()
@@ -152,6 +196,7 @@ func run(ctx context.Context) error {
 		DeviceScanDone:   deviceScanDone,
 		LogBroadcaster:   logBroadcaster,
 		IdleTimeout:      *idleTimeout,
+		TLS:              tlsConfig,
 	})
 }
 
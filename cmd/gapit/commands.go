@@ -83,6 +83,7 @@ func (verb *commandsVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	treePath.GroupByUserMarkers = verb.GroupByUserMarkers
 	treePath.IncludeNoContextGroups = verb.IncludeNoContextGroups
 	treePath.AllowIncompleteFrame = verb.AllowIncompleteFrame
+	treePath.InferFrameBoundaries = verb.InferFrameBoundaries
 
 	treePath.MaxChildren = int32(verb.MaxChildren)
 
@@ -16,7 +16,10 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
@@ -81,15 +84,31 @@ func getGapis(ctx context.Context, gapisFlags GapisFlags, gapirFlags GapirFlags)
 	args = append(args, "--idle-timeout", "1m")
 
 	var token auth.Token
-	if gapisFlags.Port == 0 {
+	if gapisFlags.Port == 0 && gapisFlags.Addr == "" {
 		token = auth.GenToken()
 	} else {
 		token = auth.Token(gapisFlags.Token)
 	}
+	var tlsConfig *tls.Config
+	if gapisFlags.TLS || gapisFlags.CA != "" {
+		tlsConfig = &tls.Config{}
+		if gapisFlags.CA != "" {
+			pem, err := ioutil.ReadFile(gapisFlags.CA)
+			if err != nil {
+				return nil, log.Errf(ctx, err, "Failed to read the certificate authorities at '%v'", gapisFlags.CA)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, log.Errf(ctx, nil, "No certificate found in '%v'", gapisFlags.CA)
+			}
+		}
+	}
 	client, err := client.Connect(ctx, client.Config{
 		Port:  gapisFlags.Port,
+		Addr:  gapisFlags.Addr,
 		Args:  args,
 		Token: token,
+		TLS:   tlsConfig,
 	})
 	if err != nil {
 		return nil, log.Err(ctx, err, "Failed to connect to the GAPIS server")
@@ -158,44 +177,52 @@ func getGapis(ctx context.Context, gapisFlags GapisFlags, gapirFlags GapirFlags)
 // getGapisAndLoadCapture connects to or creates a gapis server and loads a capture file or capture ID (depending on the CaptureFileFlags).
 // It returns the client rpc interface, the loaded path.Capture, and an error.
 func getGapisAndLoadCapture(ctx context.Context, gapisFlags GapisFlags, gapirFlags GapirFlags, capturePathOrID string, captureFileFlags CaptureFileFlags) (client.Client, *path.Capture, error) {
+	// Get gapis.
+	client, err := getGapis(ctx, gapisFlags, gapirFlags)
+	if err != nil {
+		return nil, nil, log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
 
-	var captureID id.ID
-	var capturePath string
-	var capture *path.Capture
-	var err error
+	capture, err := loadCapture(ctx, client, gapisFlags, capturePathOrID, captureFileFlags)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return client, capture, nil
+}
 
-	// Check capturePathOrID first.
+// loadCapture loads a capture file or capture ID (depending on the
+// CaptureFileFlags) in the gapis server of the client. The capture file is
+// imported if the server is remote, as it may not be able to read the file.
+func loadCapture(ctx context.Context, client client.Client, gapisFlags GapisFlags, capturePathOrID string, captureFileFlags CaptureFileFlags) (*path.Capture, error) {
 	if captureFileFlags.CaptureID {
-		captureID, err = id.Parse(capturePathOrID)
+		captureID, err := id.Parse(capturePathOrID)
 		if err != nil {
-			return nil, nil, log.Err(ctx, err, "Could not parse capture ID")
-		}
-	} else {
-		capturePath, err = filepath.Abs(capturePathOrID)
-		if err != nil {
-			return nil, nil, log.Err(ctx, err, "Could not find capture file")
+			return nil, log.Err(ctx, err, "Could not parse capture ID")
 		}
+		return &path.Capture{ID: path.NewID(captureID)}, nil
 	}
 
-	// Get gapis.
-	client, err := getGapis(ctx, gapisFlags, gapirFlags)
+	capturePath, err := filepath.Abs(capturePathOrID)
 	if err != nil {
-		return nil, nil, log.Err(ctx, err, "Failed to connect to the GAPIS server")
+		return nil, log.Err(ctx, err, "Could not find capture file")
 	}
-	// Note: call client.Close() if we don't return successfully.
-
-	// Get or load the capture.
-	if captureFileFlags.CaptureID {
-		capture = &path.Capture{ID: path.NewID(captureID)}
-	} else {
-		capture, err = client.LoadCapture(ctx, capturePath)
+	if gapisFlags.Addr != "" {
+		data, err := ioutil.ReadFile(capturePath)
+		if err != nil {
+			return nil, log.Err(ctx, err, "Failed to read the capture file")
+		}
+		capture, err := client.ImportCapture(ctx, filepath.Base(capturePath), data)
 		if err != nil {
-			client.Close()
-			return nil, nil, log.Err(ctx, err, "Failed to load the capture file")
+			return nil, log.Err(ctx, err, "Failed to import the capture file")
 		}
+		return capture, nil
 	}
-
-	return client, capture, nil
+	capture, err := client.LoadCapture(ctx, capturePath)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed to load the capture file")
+	}
+	return capture, nil
 }
 
 func getDevice(ctx context.Context, client client.Client, capture *path.Capture, flags GapirFlags) (*path.Device, error) {
@@ -203,6 +230,10 @@ func getDevice(ctx context.Context, client client.Client, capture *path.Capture,
 		return nil, nil
 	}
 	ctx = log.V{"device": flags.Device}.Bind(ctx)
+	match, err := deviceMatcher(flags.Match)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Invalid device match expression")
+	}
 	paths, err := client.GetDevicesForReplay(ctx, capture)
 	if err != nil {
 		return nil, log.Err(ctx, err, "Failed query list of devices for replay")
@@ -223,6 +254,9 @@ func getDevice(ctx context.Context, client client.Client, capture *path.Capture,
 			return nil, log.Err(ctx, err, "Couldn't resolve device")
 		}
 		d := o.(*device.Instance)
+		if !match(d) {
+			continue
+		}
 		switch flags.Device {
 		case "":
 			// empty flag
@@ -264,6 +298,10 @@ func getDevice(ctx context.Context, client client.Client, capture *path.Capture,
 		return selected, nil
 	}
 
+	if flags.Match != "" {
+		return nil, log.Errf(ctx, nil, "No compatible devices matching %q found", flags.Match)
+	}
+
 	log.W(ctx, "No compatible devices found. Attempting to use the first device anyway...")
 
 	paths, err = client.GetDevices(ctx)
@@ -457,6 +495,10 @@ func filterDevices(ctx context.Context, flags *DeviceFlags, gapis client.Client)
 	if flags.Device != "" && flags.Serial != "" {
 		return nil, fmt.Errorf("You may only specify one of -device or -serial")
 	}
+	match, err := deviceMatcher(flags.Match)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid -match expression: %v", err)
+	}
 
 	if flags.Device == "host" {
 		serverInfo, err := gapis.GetServerInfo(ctx)
@@ -479,6 +521,10 @@ func filterDevices(ctx context.Context, flags *DeviceFlags, gapis client.Client)
 		}
 		d := dd.(*device.Instance)
 
+		if !match(d) {
+			continue
+		}
+
 		if flags.Device != "" {
 			if d.Name != flags.Device {
 				continue
@@ -0,0 +1,181 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/client"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+
+	img "github.com/google/gapid/core/image"
+)
+
+type compareDevicesVerb struct{ CompareDevicesFlags }
+
+func init() {
+	verb := &compareDevicesVerb{}
+	verb.Threshold = 0.001
+
+	app.AddVerb(&app.Verb{
+		Name:      "compare_devices",
+		ShortHelp: "Replays a gfx trace on several devices and reports the frames rendered differently",
+		Action:    verb,
+	})
+}
+
+func (verb *compareDevicesVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	client, capture, err := getGapisAndLoadCapture(ctx, verb.Gapis, GapirFlags{}, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	devices, err := client.GetDevicesForReplay(ctx, capture)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to get the replay devices")
+	}
+	if verb.Match != "" {
+		match, err := deviceMatcher(verb.Match)
+		if err != nil {
+			return log.Err(ctx, err, "Invalid device match expression")
+		}
+		matching := []*path.Device{}
+		for _, p := range devices {
+			if d, err := getDeviceInstance(ctx, client, p); err == nil && match(d) {
+				matching = append(matching, p)
+			}
+		}
+		devices = matching
+	}
+	if len(devices) < 2 {
+		return fmt.Errorf("At least two replay devices are required, found %d", len(devices))
+	}
+
+	names := make([]string, len(devices))
+	for i, p := range devices {
+		d, err := getDeviceInstance(ctx, client, p)
+		if err != nil {
+			return err
+		}
+		names[i] = d.Name
+		if d.Serial != "" {
+			names[i] = fmt.Sprintf("%v (%v)", d.Name, d.Serial)
+		}
+	}
+
+	comparison, err := client.CompareReplays(ctx, &service.CompareReplaysRequest{
+		Capture:   capture,
+		Devices:   devices,
+		FrameStep: uint32(verb.Frames.Step),
+		Threshold: float32(verb.Threshold),
+	})
+	if err != nil {
+		return log.Err(ctx, err, "Failed to compare the replays")
+	}
+
+	fmt.Printf("Reference: %v\n", names[0])
+	w := tabwriter.NewWriter(os.Stdout, 4, 4, 1, ' ', 0)
+	fmt.Fprint(w, "Frame\tCommand\t")
+	for _, n := range names[1:] {
+		fmt.Fprintf(w, "%v\t", n)
+	}
+	fmt.Fprintln(w)
+	divergent := 0
+	for _, f := range comparison.Frames {
+		if !f.Divergent && !verb.All {
+			continue
+		}
+		if f.Divergent {
+			divergent++
+		}
+		fmt.Fprintf(w, "%v\t%v\t", f.Frame, dottedIndices(f.Command.Indices))
+		for _, r := range f.Results[1:] {
+			switch {
+			case r.Error != nil:
+				fmt.Fprintf(w, "error: %v\t", r.Error.Get())
+			case f.Results[0].Error != nil:
+				fmt.Fprintf(w, "reference error: %v\t", f.Results[0].Error.Get())
+			default:
+				fmt.Fprintf(w, "%.2f%%\t", r.Difference*100)
+			}
+		}
+		fmt.Fprintln(w)
+
+		if f.Divergent && verb.Out != "" {
+			if err := verb.writeFramebuffers(ctx, client, f); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d of %d compared frames diverge\n", divergent, len(comparison.Frames))
+	return nil
+}
+
+// writeFramebuffers writes the framebuffers of the devices at the end of the
+// frame as PNG files in the output directory.
+func (verb *compareDevicesVerb) writeFramebuffers(ctx context.Context, c client.Client, f *service.ReplayComparisonFrame) error {
+	if err := os.MkdirAll(verb.Out, 0755); err != nil {
+		return log.Errf(ctx, err, "Creating directory: %v", verb.Out)
+	}
+	for i, r := range f.Results {
+		ii := r.Framebuffer
+		if ii == nil || ii.Width == 0 || ii.Height == 0 {
+			continue
+		}
+		boxedData, err := c.Get(ctx, path.NewBlob(ii.Bytes.ID()).Path(), nil)
+		if err != nil {
+			return log.Errf(ctx, err, "Get frame image data failed")
+		}
+		w, h := int(ii.Width), int(ii.Height)
+		data, err := img.Convert(boxedData.([]byte), w, h, 1, ii.Format, img.RGBA_U8_NORM)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to convert frame to RGBA")
+		}
+		frame := flipImg(&image.NRGBA{Rect: image.Rect(0, 0, w, h), Stride: w * 4, Pix: data})
+		fn := filepath.Join(verb.Out, fmt.Sprintf("frame%04d_device%d.png", f.Frame, i))
+		if err := (&screenshotVerb{}).writeSingleFrame(frame, fn); err != nil {
+			return log.Errf(ctx, err, "Writing file: %v", fn)
+		}
+	}
+	return nil
+}
+
+// getDeviceInstance returns the description of the device.
+func getDeviceInstance(ctx context.Context, c client.Client, p *path.Device) (*device.Instance, error) {
+	boxedDevice, err := c.Get(ctx, p.Path(), nil)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed to get the device")
+	}
+	return boxedDevice.(*device.Instance), nil
+}
@@ -0,0 +1,255 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type createGraphVerb struct{ CreateGraphFlags }
+
+func init() {
+	verb := &createGraphVerb{}
+	verb.Format = "dot"
+	app.AddVerb(&app.Verb{
+		Name:      "create_graph",
+		ShortHelp: "Writes the dependency graph of the commands of a .gfxtrace file",
+		Action:    verb,
+	})
+}
+
+// graphNode is a command of the dependency graph.
+type graphNode struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Cluster string   `json:"cluster,omitempty"`
+	Deps    []string `json:"dependencies,omitempty"`
+	index   uint64
+}
+
+func (verb *createGraphVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+	switch verb.Format {
+	case "dot", "json", "chrome":
+	default:
+		app.Usage(ctx, "Unknown format: %v", verb.Format)
+		return nil
+	}
+
+	client, capture, err := getGapisAndLoadCapture(ctx, verb.Gapis, GapirFlags{}, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	cmds, err := verb.commands(ctx, client, capture)
+	if err != nil {
+		return err
+	}
+
+	nodes := make([]*graphNode, 0, len(cmds))
+	byID := map[string]*graphNode{}
+	renderPass, inRenderPass := 0, false
+	for _, p := range cmds {
+		cmd, err := getCommand(ctx, client, p)
+		if err != nil {
+			return err
+		}
+		n := &graphNode{ID: dottedIndices(p.Indices), Name: cmd.Name, index: p.Indices[0]}
+		if verb.ClusterRenderPasses {
+			// The commands recording a render pass are clustered together.
+			switch cmd.Name {
+			case "vkCmdBeginRenderPass", "vkCmdBeginRenderPass2KHR":
+				renderPass, inRenderPass = renderPass+1, true
+			}
+			if inRenderPass {
+				n.Cluster = fmt.Sprintf("render pass %d", renderPass)
+			}
+			switch cmd.Name {
+			case "vkCmdEndRenderPass", "vkCmdEndRenderPass2KHR":
+				inRenderPass = false
+			}
+		}
+		nodes = append(nodes, n)
+		byID[n.ID] = n
+	}
+
+	// Only the edges between the commands of the graph are kept.
+	for i, n := range nodes {
+		if task.Stopped(ctx) {
+			return task.StopReason(ctx)
+		}
+		deps, err := client.GetDependencies(ctx, cmds[i])
+		if err != nil {
+			return log.Errf(ctx, err, "Couldn't get the dependencies of: %v", n.ID)
+		}
+		for _, d := range deps {
+			if id := dottedIndices(d.Indices); byID[id] != nil {
+				n.Deps = append(n.Deps, id)
+			}
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if verb.Out != "" {
+		f, err := os.OpenFile(verb.Out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to open the graph output file")
+		}
+		defer f.Close()
+		out = f
+	}
+
+	switch verb.Format {
+	case "json":
+		e := json.NewEncoder(out)
+		e.SetIndent("", "  ")
+		return e.Encode(nodes)
+	case "chrome":
+		return writeGraphTrace(out, nodes)
+	default:
+		return writeGraphDot(out, nodes)
+	}
+}
+
+// commands returns the commands in the requested range, or only the commands
+// and subcommands using the requested handles if there are any.
+func (verb *createGraphVerb) commands(ctx context.Context, client service.Service, capture *path.Capture) ([]*path.Command, error) {
+	inRange := func(p *path.Command) bool {
+		return !verb.Commands.Valid ||
+			(p.Indices[0] >= verb.Commands.First && p.Indices[0] <= verb.Commands.Last)
+	}
+
+	if len(verb.Handles) > 0 {
+		seen := map[string]bool{}
+		out := []*path.Command{}
+		for _, h := range verb.Handles {
+			uses, err := client.GetResourceUses(ctx, capture, h)
+			if err != nil {
+				return nil, log.Errf(ctx, err, "Couldn't get the uses of handle: %v", h)
+			}
+			for _, u := range uses {
+				if id := dottedIndices(u.Command.Indices); inRange(u.Command) && !seen[id] {
+					seen[id] = true
+					out = append(out, capture.Command(u.Command.Indices[0], u.Command.Indices[1:]...))
+				}
+			}
+		}
+		return out, nil
+	}
+
+	boxedCommands, err := client.Get(ctx, capture.Commands().Path(), nil)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed to acquire the capture's commands")
+	}
+	out := []*path.Command{}
+	for _, p := range boxedCommands.(*service.Commands).List {
+		if inRange(p) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func writeGraphDot(out io.Writer, nodes []*graphNode) error {
+	fmt.Fprintln(out, "digraph dependencies {")
+	fmt.Fprintln(out, "  node [shape=box];")
+	clusters := []string{}
+	byCluster := map[string][]*graphNode{}
+	for _, n := range nodes {
+		if _, ok := byCluster[n.Cluster]; !ok {
+			clusters = append(clusters, n.Cluster)
+		}
+		byCluster[n.Cluster] = append(byCluster[n.Cluster], n)
+	}
+	for i, c := range clusters {
+		indent := "  "
+		if c != "" {
+			fmt.Fprintf(out, "  subgraph cluster_%d {\n    label=%q;\n", i, c)
+			indent = "    "
+		}
+		for _, n := range byCluster[c] {
+			fmt.Fprintf(out, "%s%q [label=%q];\n", indent, n.ID, n.ID+" "+n.Name)
+		}
+		if c != "" {
+			fmt.Fprintln(out, "  }")
+		}
+	}
+	for _, n := range nodes {
+		for _, d := range n.Deps {
+			fmt.Fprintf(out, "  %q -> %q;\n", d, n.ID)
+		}
+	}
+	_, err := fmt.Fprintln(out, "}")
+	return err
+}
+
+// writeGraphTrace writes the graph as a trace, with a slice per command
+// placed at its command index, and a flow per dependency.
+func writeGraphTrace(out io.Writer, nodes []*graphNode) error {
+	tids := map[string]int{"": 1}
+	events := []traceEvent{}
+	for _, n := range nodes {
+		if _, ok := tids[n.Cluster]; !ok {
+			tids[n.Cluster] = len(tids) + 1
+			events = append(events, traceEvent{
+				Name: "thread_name", Phase: "M", Pid: 1, Tid: tids[n.Cluster],
+				Args: map[string]string{"name": n.Cluster},
+			})
+		}
+	}
+	byID := map[string]*graphNode{}
+	for _, n := range nodes {
+		byID[n.ID] = n
+		events = append(events, traceEvent{
+			Name:  n.ID + " " + n.Name,
+			Phase: "X",
+			Pid:   1,
+			Tid:   tids[n.Cluster],
+			Ts:    float64(n.index),
+			Dur:   1,
+		})
+	}
+	flow := 0
+	for _, n := range nodes {
+		for _, d := range n.Deps {
+			flow++
+			from := byID[d]
+			events = append(events,
+				traceEvent{Name: "dependency", Phase: "s", Pid: 1, Tid: tids[from.Cluster], Ts: float64(from.index), ID: flow},
+				traceEvent{Name: "dependency", Phase: "f", Pid: 1, Tid: tids[n.Cluster], Ts: float64(n.index), ID: flow, BindPoint: "e"},
+			)
+		}
+	}
+	e := json.NewEncoder(out)
+	e.SetIndent("", "  ")
+	return e.Encode(struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}{events})
+}
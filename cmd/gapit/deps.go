@@ -0,0 +1,130 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type depsVerb struct{ DepsFlags }
+
+func init() {
+	verb := &depsVerb{}
+	app.AddVerb(&app.Verb{
+		Name:      "deps",
+		ShortHelp: "Prints the tree of commands a command of a .gfxtrace file transitively depends on",
+		Action:    verb,
+	})
+}
+
+func (verb *depsVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 2 {
+		app.Usage(ctx, "Exactly one gfx trace file and one command index expected, got %d", flags.NArg())
+		return nil
+	}
+
+	indices := CommandIndices{}
+	if err := indices.Set(flags.Arg(1)); err != nil || len(indices) != 1 {
+		app.Usage(ctx, "Expected a single command index such as 12 or 12.0.3, got %s", flags.Arg(1))
+		return nil
+	}
+
+	client, capture, err := getGapisAndLoadCapture(ctx, verb.Gapis, GapirFlags{}, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	next := client.GetDependencies
+	if verb.Reverse {
+		next = client.GetDependents
+	}
+
+	t := &depsTree{
+		client: client,
+		next:   next,
+		depth:  verb.Depth,
+		seen:   map[string]bool{},
+		out:    os.Stdout,
+	}
+	if err := t.print(ctx, capture.Command(indices[0][0], indices[0][1:]...), "", "", 0); err != nil {
+		return err
+	}
+
+	kind := "dependencies"
+	if verb.Reverse {
+		kind = "dependents"
+	}
+	fmt.Fprintf(t.out, "%d transitive %s\n", len(t.seen)-1, kind)
+	return nil
+}
+
+// depsTree prints the dependency closure of a command as a tree, expanding
+// each command only the first time it is reached.
+type depsTree struct {
+	client service.Service
+	next   func(context.Context, *path.Command) ([]*path.Command, error)
+	depth  int
+	seen   map[string]bool
+	out    io.Writer
+}
+
+func (t *depsTree) print(ctx context.Context, p *path.Command, prefix, childPrefix string, depth int) error {
+	if task.Stopped(ctx) {
+		return task.StopReason(ctx)
+	}
+
+	key := dottedIndices(p.Indices)
+	cmd, err := getCommand(ctx, t.client, p)
+	if err != nil {
+		return err
+	}
+	if t.seen[key] {
+		fmt.Fprintf(t.out, "%s%s %s (see above)\n", prefix, key, cmd.Name)
+		return nil
+	}
+	t.seen[key] = true
+	fmt.Fprintf(t.out, "%s%s %s\n", prefix, key, cmd.Name)
+
+	if t.depth > 0 && depth >= t.depth {
+		return nil
+	}
+
+	children, err := t.next(ctx, p)
+	if err != nil {
+		return log.Errf(ctx, err, "Couldn't get the dependencies of: %v", key)
+	}
+	for i, c := range children {
+		if i == len(children)-1 {
+			err = t.print(ctx, c, childPrefix+"└──", childPrefix+"    ", depth+1)
+		} else {
+			err = t.print(ctx, c, childPrefix+"├──", childPrefix+"│   ", depth+1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
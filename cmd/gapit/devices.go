@@ -19,9 +19,13 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
+	"strings"
 
 	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/data/id"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/os/device"
 )
@@ -32,12 +36,22 @@ func init() {
 	verb := &devicesVerb{}
 	app.AddVerb(&app.Verb{
 		Name:      "devices",
-		ShortHelp: "Lists the devices available",
+		ShortHelp: "Lists the devices available, and their compatibility with a .gfxtrace file if given",
 		Action:    verb,
 	})
 }
 
 func (verb *devicesVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() > 1 {
+		app.Usage(ctx, "At most one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+	match, err := deviceMatcher(verb.Match)
+	if err != nil {
+		app.Usage(ctx, "Invalid -match expression: %v", err)
+		return nil
+	}
+
 	client, err := getGapis(ctx, verb.Gapis, GapirFlags{})
 	if err != nil {
 		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
@@ -49,11 +63,28 @@ func (verb *devicesVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		return log.Err(ctx, err, "Failed to get device list")
 	}
 
+	// The devices able to replay the capture, if any.
+	var compatible map[id.ID]bool
+	if flags.NArg() == 1 {
+		c, err := loadCapture(ctx, client, verb.Gapis, flags.Arg(0), verb.CaptureFileFlags)
+		if err != nil {
+			return err
+		}
+		replayDevices, err := client.GetDevicesForReplay(ctx, c)
+		if err != nil {
+			return log.Err(ctx, err, "Failed query list of devices for replay")
+		}
+		compatible = map[id.ID]bool{}
+		for _, p := range replayDevices {
+			compatible[p.ID.ID()] = true
+		}
+	}
+
 	stdout := os.Stdout
 	for i, p := range devices {
-		fmt.Fprintf(stdout, "-- Device %v: %v --\n", i, p.ID.ID())
 		o, err := client.Get(ctx, p.Path(), nil)
 		if err != nil {
+			fmt.Fprintf(stdout, "-- Device %v: %v --\n", i, p.ID.ID())
 			fmt.Fprintf(stdout, "%v\n", log.Err(ctx, err, "Couldn't resolve device"))
 			continue
 		}
@@ -61,13 +92,99 @@ func (verb *devicesVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		if verb.OS != device.UnknownOS && verb.OS != d.GetConfiguration().GetOS().GetKind() {
 			continue
 		}
-		jsonBytes, err := json.MarshalIndent(d, "", "  ")
-		if err != nil {
-			fmt.Fprintf(stdout, "%v\n", log.Err(ctx, err, "Couldn't marshal device to JSON"))
+		if !match(d) {
 			continue
 		}
-		fmt.Fprintln(stdout, string(jsonBytes))
+		fmt.Fprintf(stdout, "-- Device %v: %v --\n", i, p.ID.ID())
+		if verb.JSON {
+			jsonBytes, err := json.MarshalIndent(d, "", "  ")
+			if err != nil {
+				fmt.Fprintf(stdout, "%v\n", log.Err(ctx, err, "Couldn't marshal device to JSON"))
+				continue
+			}
+			fmt.Fprintln(stdout, string(jsonBytes))
+			continue
+		}
+		printDevice(stdout, d, verb.Extensions)
+		if compatible != nil {
+			fmt.Fprintf(stdout, "Replay compatible: %v\n", compatible[p.ID.ID()])
+		}
 	}
 
 	return nil
 }
+
+// printDevice prints the summary of the device, with the Vulkan extensions
+// if requested.
+func printDevice(out io.Writer, d *device.Instance, extensions bool) {
+	c := d.GetConfiguration()
+	fmt.Fprintf(out, "Name: %v\n", d.GetName())
+	if d.GetSerial() != "" {
+		fmt.Fprintf(out, "Serial: %v\n", d.GetSerial())
+	}
+	o := c.GetOS()
+	fmt.Fprintf(out, "OS: %v %v.%v.%v %v\n", o.GetName(), o.GetMajorVersion(), o.GetMinorVersion(), o.GetPointVersion(), o.GetBuild())
+	if gpu := c.GetHardware().GetGPU(); gpu != nil {
+		fmt.Fprintf(out, "GPU: %v %v\n", gpu.GetVendor(), gpu.GetName())
+	}
+	abis := []string{}
+	for _, abi := range c.GetABIs() {
+		abis = append(abis, abi.GetName())
+	}
+	fmt.Fprintf(out, "ABIs: %v\n", strings.Join(abis, ", "))
+	if gl := c.GetDrivers().GetOpengl(); gl != nil {
+		fmt.Fprintf(out, "OpenGL: %v (%v)\n", gl.GetVersion(), gl.GetRenderer())
+	}
+	if vk := c.GetDrivers().GetVulkan(); vk != nil {
+		for _, pd := range vk.GetPhysicalDevices() {
+			fmt.Fprintf(out, "Vulkan: %v, API %v, driver %v (0x%x)\n", pd.GetDeviceName(),
+				vulkanVersion(pd.GetApiVersion()), vulkanVersion(pd.GetDriverVersion()), pd.GetDriverVersion())
+		}
+		if extensions {
+			for _, e := range vk.GetIcdAndImplicitLayerExtensions() {
+				fmt.Fprintf(out, "  %v\n", e)
+			}
+		} else if n := len(vk.GetIcdAndImplicitLayerExtensions()); n > 0 {
+			fmt.Fprintf(out, "Vulkan instance extensions: %v\n", n)
+		}
+	}
+}
+
+// vulkanVersion returns the version encoded as described in the Vulkan Spec,
+// as major.minor.patch.
+func vulkanVersion(v uint32) string {
+	return fmt.Sprintf("%d.%d.%d", v>>22, (v>>12)&0x3ff, v&0xfff)
+}
+
+// deviceMatcher returns the function matching the devices of which the name,
+// the serial, the hardware, the GPU or the Vulkan physical devices match the
+// regular expression, case insensitively. All the devices match an empty
+// expression.
+func deviceMatcher(expr string) (func(d *device.Instance) bool, error) {
+	if expr == "" {
+		return func(*device.Instance) bool { return true }, nil
+	}
+	re, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(d *device.Instance) bool {
+		c := d.GetConfiguration()
+		names := []string{
+			d.GetName(),
+			d.GetSerial(),
+			c.GetHardware().GetName(),
+			c.GetHardware().GetGPU().GetName(),
+			c.GetDrivers().GetOpengl().GetRenderer(),
+		}
+		for _, pd := range c.GetDrivers().GetVulkan().GetPhysicalDevices() {
+			names = append(names, pd.GetDeviceName())
+		}
+		for _, n := range names {
+			if n != "" && re.MatchString(n) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
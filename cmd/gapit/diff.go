@@ -0,0 +1,106 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type diffVerb struct{ DiffFlags }
+
+func init() {
+	verb := &diffVerb{}
+	app.AddVerb(&app.Verb{
+		Name:      "diff",
+		ShortHelp: "Compares the commands and resources of two gfx trace files",
+		Action:    verb,
+	})
+}
+
+func (verb *diffVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 2 {
+		app.Usage(ctx, "Exactly two gfx trace files expected, got %d", flags.NArg())
+		return nil
+	}
+
+	client, before, err := getGapisAndLoadCapture(ctx, verb.Gapis, GapirFlags{}, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	after, err := loadCapture(ctx, client, verb.Gapis, flags.Arg(1), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+
+	diff, err := client.GetCaptureDiff(ctx, before, after, nil)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to diff the captures")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 4, 4, 0, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "%v removed commands: %v\n", len(diff.Removed), diff.Removed)
+	fmt.Fprintf(w, "%v added commands: %v\n", len(diff.Added), diff.Added)
+	fmt.Fprintf(w, "%v changed commands\n", len(diff.Changed))
+	for _, c := range diff.Changed {
+		fmt.Fprintf(w, "\t%v -> %v: \t%v\n", c.Before, c.After, c.Name)
+		if len(c.Parameters) > 0 {
+			fmt.Fprintf(w, "\t\tParameters: \t%v\n", strings.Join(c.Parameters, ", "))
+		}
+		if len(c.LostDependencies) > 0 {
+			fmt.Fprintf(w, "\t\tLost dependencies: \t%v\n", c.LostDependencies)
+		}
+		if len(c.GainedDependencies) > 0 {
+			fmt.Fprintf(w, "\t\tGained dependencies: \t%v\n", c.GainedDependencies)
+		}
+	}
+	fmt.Fprintf(w, "%v differing resources\n", len(diff.Resources))
+	for _, r := range diff.Resources {
+		fmt.Fprintf(w, "\t%v: \t", r.Type)
+		writeDiffResource(w, r.Before, r.BeforeHash)
+		fmt.Fprint(w, " -> ")
+		writeDiffResource(w, r.After, r.AfterHash)
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// writeDiffResource writes the handle and the content hash of the resource
+// of one of the captures, or a placeholder if the capture has no matching
+// resource or if the contents of the resource could not be resolved.
+func writeDiffResource(w io.Writer, r *service.Resource, hash *path.ID) {
+	if r == nil {
+		fmt.Fprint(w, "<none>")
+		return
+	}
+	if hash == nil {
+		fmt.Fprintf(w, "%v (unknown)", r.Handle)
+		return
+	}
+	fmt.Fprintf(w, "%v (%v)", r.Handle, hash.ID())
+}
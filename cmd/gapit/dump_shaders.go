@@ -15,32 +15,106 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"flag"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/os/file"
 	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/client"
 	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
 )
 
+// The extension of the files of the dumped shader binaries. The sources are
+// written to files named after the shader handles.
+const shaderBinaryExt = ".spv"
+
 type dumpShadersVerb struct{ DumpShadersFlags }
 
 func init() {
 	verb := &dumpShadersVerb{
 		DumpShadersFlags{
-			At: -1,
+			At:              -1,
+			Out:             ".",
+			OutputTraceFile: "patched.gfxtrace",
 		},
 	}
 	app.AddVerb(&app.Verb{
 		Name:      "dump_resources",
-		ShortHelp: "Dump all shaders at a particular command from a .gfxtrace",
+		ShortHelp: "Dump all shaders at a particular command from a .gfxtrace, or patch them with edited ones",
 		Action:    verb,
 	})
 }
 
+// dumpedShader is a shader resource of a capture, the command its data is
+// read after, and the name of its files, which is stable for a given capture.
+type dumpedShader struct {
+	resource *service.Resource
+	after    *path.Command
+	name     string
+	data     *api.Shader
+}
+
+// shaderCommand returns the index of the command to read the shader resource
+// after: the given command, or the last command before the shader was
+// destroyed, or the command that created it.
+func shaderCommand(r *service.Resource, at uint64) uint64 {
+	if d := r.GetDeleted(); d != nil && len(d.Indices) > 0 && d.Indices[0] > 0 && d.Indices[0] <= at {
+		at = d.Indices[0] - 1
+	}
+	if c := r.GetCreated(); c != nil && len(c.Indices) > 0 && c.Indices[0] > at {
+		at = c.Indices[0]
+	}
+	return at
+}
+
+// loadShaders returns every shader of the capture, read after the given
+// command, or after the last command if at is -1.
+func loadShaders(ctx context.Context, client client.Client, capture *path.Capture, at int) ([]dumpedShader, error) {
+	boxedResources, err := client.Get(ctx, capture.Resources().Path(), nil)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Could not find the capture's resources")
+	}
+	resources := boxedResources.(*service.Resources)
+
+	if at == -1 {
+		boxedCapture, err := client.Get(ctx, capture.Path(), nil)
+		if err != nil {
+			return nil, log.Err(ctx, err, "Failed to load the capture")
+		}
+		at = int(boxedCapture.(*service.Capture).NumCommands) - 1
+	}
+
+	shaders := []dumpedShader{}
+	for _, r := range resources.FindAll(func(t api.ResourceType, r service.Resource) bool {
+		return t == api.ResourceType_ShaderResource
+	}) {
+		if !r.ID.IsValid() {
+			log.E(ctx, "Got resource with invalid ID!\n%+v", r)
+			continue
+		}
+		after := capture.Command(shaderCommand(r, uint64(at)))
+		data, err := client.Get(ctx, after.ResourceAfter(r.ID).Path(), nil)
+		if err != nil {
+			log.E(ctx, "Could not get data for shader: %v %v", r, err)
+			continue
+		}
+		shaders = append(shaders, dumpedShader{
+			resource: r,
+			after:    after,
+			name:     file.SanitizePath(r.GetHandle()),
+			data:     data.(*api.ResourceData).GetShader(),
+		})
+	}
+	return shaders, nil
+}
+
 func (verb *dumpShadersVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	if flags.NArg() != 1 {
 		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
@@ -53,46 +127,87 @@ func (verb *dumpShadersVerb) Run(ctx context.Context, flags flag.FlagSet) error
 	}
 	defer client.Close()
 
-	boxedResources, err := client.Get(ctx, capture.Resources().Path(), nil)
+	shaders, err := loadShaders(ctx, client, capture, verb.At)
 	if err != nil {
-		return log.Err(ctx, err, "Could not find the capture's resources")
+		return err
+	}
+	if verb.Patch != "" {
+		return verb.patch(ctx, client, shaders)
 	}
-	resources := boxedResources.(*service.Resources)
 
-	if verb.At == -1 {
-		boxedCapture, err := client.Get(ctx, capture.Path(), nil)
-		if err != nil {
-			return log.Err(ctx, err, "Failed to load the capture")
+	if err := os.MkdirAll(verb.Out, 0755); err != nil {
+		return log.Errf(ctx, err, "Could not create the directory %s", verb.Out)
+	}
+	for _, s := range shaders {
+		base := filepath.Join(verb.Out, s.name)
+		if err := ioutil.WriteFile(base, []byte(s.data.GetSource()), 0666); err != nil {
+			log.E(ctx, "Could not write shader %s %v", s.resource.GetHandle(), err)
+			continue
 		}
-		verb.At = int(boxedCapture.(*service.Capture).NumCommands) - 1
-	}
-
-	for _, types := range resources.GetTypes() {
-		if types.Type == api.ResourceType_ShaderResource {
-			for _, v := range types.GetResources() {
-				if !v.ID.IsValid() {
-					log.E(ctx, "Got resource with invalid ID!\n%+v", v)
-					continue
-				}
-				resourcePath := capture.Command(uint64(verb.At)).ResourceAfter(v.ID)
-				resourceData, err := client.Get(ctx, resourcePath.Path(), nil)
-				if err != nil {
-					log.E(ctx, "Could not get data for shader: %v %v", v, err)
-					continue
-				}
-
-				shaderSource := resourceData.(*api.ResourceData).GetShader().GetSource()
-				filename := file.SanitizePath(v.GetHandle())
-				f, err := os.Create(filename)
-				if err != nil {
-					log.E(ctx, "Could open file to write %s %v", v.GetHandle(), err)
-					continue
-				}
-				defer f.Close()
-				f.WriteString(shaderSource)
+		if len(s.data.GetBinary()) > 0 {
+			if err := ioutil.WriteFile(base+shaderBinaryExt, s.data.GetBinary(), 0666); err != nil {
+				log.E(ctx, "Could not write shader %s %v", s.resource.GetHandle(), err)
 			}
 		}
 	}
+	return nil
+}
+
+// patch writes a new capture with the shaders edited in the patch directory.
+func (verb *dumpShadersVerb) patch(ctx context.Context, client client.Client, shaders []dumpedShader) error {
+	// The edited shaders, grouped by the command they are set after.
+	ids := map[uint64][]*path.ID{}
+	patched := map[uint64][]*api.ResourceData{}
+	order := []uint64{}
+	for _, s := range shaders {
+		base := filepath.Join(verb.Patch, s.name)
+		var data *api.ResourceData
+		// An edited binary takes precedence over an edited source, as the
+		// source may be stale once the binary is rebuilt by other tools.
+		if binary, err := ioutil.ReadFile(base + shaderBinaryExt); err == nil && !bytes.Equal(binary, s.data.GetBinary()) {
+			data = api.NewResourceData(&api.Shader{
+				Type:   api.ShaderType_SpirvBinary,
+				Source: string(binary),
+			})
+		} else if source, err := ioutil.ReadFile(base); err == nil && string(source) != s.data.GetSource() {
+			data = api.NewResourceData(&api.Shader{
+				Type:   s.data.GetType(),
+				Source: string(source),
+			})
+		} else {
+			continue
+		}
+		at := s.after.Indices[0]
+		if _, ok := ids[at]; !ok {
+			order = append(order, at)
+		}
+		ids[at] = append(ids[at], s.resource.ID)
+		patched[at] = append(patched[at], data)
+	}
+	if len(order) == 0 {
+		log.I(ctx, "No edited shaders found in '%s'", verb.Patch)
+		return nil
+	}
 
+	// Each edit produces a new capture, which the next edits apply to.
+	capture := path.FindCapture(shaders[0].after)
+	for _, at := range order {
+		log.I(ctx, "Patching %d shaders after command %d", len(ids[at]), at)
+		resourcePath := capture.Command(at).ResourcesAfter(ids[at]).Path()
+		newResourcePath, err := client.Set(ctx, resourcePath, api.NewMultiResourceData(patched[at]), nil)
+		if err != nil {
+			return log.Errf(ctx, err, "Could not update resource data: %v", resourcePath)
+		}
+		capture = path.FindCapture(newResourcePath.Node())
+	}
+
+	newCaptureFilepath, err := filepath.Abs(verb.OutputTraceFile)
+	if err != nil {
+		return log.Errf(ctx, err, "Could not handle capture file path '%s'", verb.OutputTraceFile)
+	}
+	if err := client.SaveCapture(ctx, capture, newCaptureFilepath); err != nil {
+		return log.Errf(ctx, err, "Failed to write capture to: '%s'", newCaptureFilepath)
+	}
+	log.I(ctx, "Capture written to: '%s'", newCaptureFilepath)
 	return nil
 }
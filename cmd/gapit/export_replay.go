@@ -33,7 +33,7 @@ func init() {
 	}
 	app.AddVerb(&app.Verb{
 		Name:      "export_replay",
-		ShortHelp: "Export replay vm instruction and assets.",
+		ShortHelp: "Export replay vm instruction and assets, optionally bundled with gapir.",
 		Action:    verb,
 	})
 }
@@ -93,6 +93,7 @@ func (verb *exportReplayVerb) Run(ctx context.Context, flags flag.FlagSet) error
 
 	opts := &service.ExportReplayOptions{
 		GetFramebufferAttachmentRequests: fbreqs,
+		Bundle:                           verb.Bundle,
 	}
 
 	if err := client.ExportReplay(ctx, capturePath, device, verb.Out, opts); err != nil {
@@ -15,9 +15,13 @@
 package main
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/gapid/core/app/flags"
+	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/os/device"
 )
 
@@ -35,6 +39,16 @@ const (
 	SimpleList
 )
 
+const (
+	TextStats StatsFormat = iota
+	JsonStats
+)
+
+const (
+	CsvTimings TimingsFormat = iota
+	JsonTimings
+)
+
 type VideoType uint8
 
 var videoTypeNames = map[VideoType]string{
@@ -67,6 +81,111 @@ func (v PackagesOutput) String() string {
 	return packagesOutputNames[v]
 }
 
+type StatsFormat uint8
+
+var statsFormatNames = map[StatsFormat]string{
+	TextStats: "text",
+	JsonStats: "json",
+}
+
+func (v *StatsFormat) Choose(c interface{}) {
+	*v = c.(StatsFormat)
+}
+func (v StatsFormat) String() string {
+	return statsFormatNames[v]
+}
+
+type TimingsFormat uint8
+
+var timingsFormatNames = map[TimingsFormat]string{
+	CsvTimings:  "csv",
+	JsonTimings: "json",
+}
+
+func (v *TimingsFormat) Choose(c interface{}) {
+	*v = c.(TimingsFormat)
+}
+func (v TimingsFormat) String() string {
+	return timingsFormatNames[v]
+}
+
+// CommandRange is an inclusive range of command indices, given as N..M or N.
+type CommandRange struct {
+	First, Last uint64
+	Valid       bool
+}
+
+func (r *CommandRange) String() string {
+	if !r.Valid {
+		return ""
+	}
+	return fmt.Sprintf("%d..%d", r.First, r.Last)
+}
+
+func (r *CommandRange) Set(v string) error {
+	parts := strings.Split(v, "..")
+	if len(parts) > 2 {
+		return fmt.Errorf("Expected 'N..M' or 'N', could not parse %s", v)
+	}
+	first, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil {
+		return fmt.Errorf("Expected 'N..M' or 'N', could not parse %s", v)
+	}
+	last := first
+	if len(parts) == 2 {
+		if last, err = strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64); err != nil {
+			return fmt.Errorf("Expected 'N..M' or 'N', could not parse %s", v)
+		}
+	}
+	if last < first {
+		return fmt.Errorf("The range %s ends before it starts", v)
+	}
+	*r = CommandRange{First: first, Last: last, Valid: true}
+	return nil
+}
+
+// CommandIndices is a list of command or subcommand indices, given as comma
+// separated paths of dot separated indices, such as 12.0.1.3,15. A single
+// path can also be given as [12, 0, 1, 3]. Each use of the flag adds to the
+// list.
+type CommandIndices []flags.U64Slice
+
+func (c *CommandIndices) String() string {
+	paths := make([]string, len(*c))
+	for i, indices := range *c {
+		paths[i] = dottedIndices(indices)
+	}
+	return strings.Join(paths, ",")
+}
+
+// dottedIndices returns the indices joined by dots, such as 12.0.1.3.
+func dottedIndices(indices []uint64) string {
+	return strings.Trim(strings.Join(strings.Fields(fmt.Sprint(indices)), "."), "[]")
+}
+
+func (c *CommandIndices) Set(v string) error {
+	if strings.HasPrefix(v, "[") {
+		indices := flags.U64Slice{}
+		if err := indices.Set(v); err != nil {
+			return err
+		}
+		*c = append(*c, indices)
+		return nil
+	}
+	for _, p := range strings.Split(v, ",") {
+		indices := flags.U64Slice{}
+		for _, i := range strings.Split(strings.TrimSpace(p), ".") {
+			idx, err := strconv.ParseUint(i, 10, 64)
+			if err != nil {
+				return fmt.Errorf("Expected 'N.M,...' or '[N, M]', could not parse %s", v)
+			}
+			indices = append(indices, idx)
+		}
+		*c = append(*c, indices)
+	}
+	return nil
+}
+
 type (
 	CaptureFileFlags struct {
 		CaptureID bool `help:"if true then interpret the capture file argument as a capture ID that is already loaded in gapis"`
@@ -82,14 +201,20 @@ type (
 		Device string            `help:"Device to trace on. Either 'host' or the friendly name of the device"`
 		Serial string            `help:"Serial of the device to trace on."`
 		Os     string            `help:"Os of the device to trace on."`
+		Match  string            `help:"regular expression to match against the name, serial, GPU or Vulkan device name of the device"`
 		Env    flags.StringSlice `help:"List of environment variables to set, X=Y"`
 		Ssh    struct {
 			Config string `help:"The ssh config to use for finding remote devices"`
 		}
 	}
 	DevicesFlags struct {
-		Gapis GapisFlags
-		OS    device.OSKind `help:"Only display devices of the given OS kind"`
+		Gapis      GapisFlags
+		OS         device.OSKind `help:"Only display devices of the given OS kind"`
+		Match      string        `help:"only display the devices of which the name, serial, GPU or Vulkan device name match the regular expression"`
+		Extensions bool          `help:"display the Vulkan instance extensions of the devices"`
+		JSON       bool          `help:"display the full description of the devices as JSON"`
+
+		CaptureFileFlags
 	}
 	ProfileFlags struct {
 		Pprof string `help:"_produce a pprof file"`
@@ -98,8 +223,11 @@ type (
 	GapisFlags struct {
 		Profile ProfileFlags
 		Port    int    `help:"gapis tcp port to connect to, 0 means start new instance."`
+		Addr    string `help:"gapis host:port to connect to, possibly on another machine. Overrides the port."`
 		Args    string `help:"_The arguments to be passed to gapis"`
-		Token   string `help:"_The auth token to use when connecting to an existing server."`
+		Token   string `help:"The auth token to use when connecting to an existing server."`
+		TLS     bool   `help:"connect to the gapis server with TLS"`
+		CA      string `help:"PEM file of the certificate authorities verifying the gapis server, the system ones if empty. Implies tls."`
 	}
 	GapirFlags struct {
 		DeviceFlags
@@ -111,17 +239,37 @@ type (
 	ReportFlags struct {
 		Gapis            GapisFlags
 		Gapir            GapirFlags
-		Out              string `help:"output report path"`
-		DisplayToSurface bool   `help:"display the frames rendered in the replay back to the surface"`
+		Out              string         `help:"output report path"`
+		DisplayToSurface bool           `help:"display the frames rendered in the replay back to the surface"`
+		ExplainDCE       bool           `help:"explain why each command is kept by the dead code elimination"`
+		ExplainDCEAt     flags.U64Slice `help:"command/subcommand index requested from the explained dead code elimination. Empty for last"`
+		AnalyzeBarriers  bool           `help:"flag the pipeline barriers with broader stage masks than required"`
+		Lint             bool           `help:"flag the commands matching the API specific lint rules"`
+		Analyses         bool           `help:"add the items of the analysis passes registered by the extensions"`
 		CommandFilterFlags
 		CaptureFileFlags
 	}
+	ValidateFlags struct {
+		Gapis    GapisFlags
+		Gapir    GapirFlags
+		Severity log.Severity `help:"the lowest severity of the printed messages"`
+		Out      string       `help:"file to save the validation messages to"`
+		JSON     bool         `help:"print the validation messages as JSON"`
+		CaptureFileFlags
+	}
+	LintFlags struct {
+		Gapis    GapisFlags
+		Gapir    GapirFlags
+		Severity log.Severity `help:"the lowest severity of the findings failing the lint"`
+		CaptureFileFlags
+	}
 	ExportReplayFlags struct {
 		Gapis          GapisFlags
 		Gapir          GapirFlags
 		OriginalDevice bool   `help:"export replay for the original device"`
 		Out            string `help:"output directory for commands and assets"`
 		OutputFrames   bool   `help:"generate trace that output frames(disable diagnostics)"`
+		Bundle         bool   `help:"add gapir and a launcher script, to replay without gapis or the capture"`
 		CommandFilterFlags
 		CaptureFileFlags
 	}
@@ -134,10 +282,18 @@ type (
 			Width  int `help:"maximum video width"`
 			Height int `help:"maximum video height"`
 		}
-		Type     VideoType `help:"type of output to produce"`
-		Text     string    `help:"_summary prefix (use '║' for aligned columns, '¶' for new line)"`
-		Commands bool      `help:"Treat every command as its own frame"`
-		Frames   struct {
+		Codec     string    `help:"codec of the encoder, such as libx264 or libvpx-vp9 (default: the default of the container)"`
+		Container string    `help:"container format of the video, such as mp4, webm or mkv"`
+		Scale     float64   `help:"scale of the video resolution relative to the frames"`
+		Type      VideoType `help:"type of output to produce"`
+		Text      string    `help:"_summary prefix (use '║' for aligned columns, '¶' for new line)"`
+		Commands  bool      `help:"Treat every command as its own frame"`
+		Overlay   struct {
+			Frame   bool `help:"draw the frame number on the frames of regular videos"`
+			Command bool `help:"draw the command index on the frames of regular videos"`
+			GpuTime bool `help:"draw the GPU time of the frame on the frames of regular videos, measured by an extra replay"`
+		}
+		Frames struct {
 			Start   int `help:"frame to start capture from"`
 			Count   int `help:"number of frames after Start to capture: -1 for all frames"`
 			Minimum int `help:"_return error when less than this number of frames is found"`
@@ -147,9 +303,12 @@ type (
 		CaptureFileFlags
 	}
 	DumpShadersFlags struct {
-		Gapis GapisFlags
-		Gapir GapirFlags
-		At    int `help:"command index to dump the resources after"`
+		Gapis           GapisFlags
+		Gapir           GapirFlags
+		At              int    `help:"command index to dump the resources after, or before their destruction"`
+		Out             string `help:"directory to write the shaders to"`
+		Patch           string `help:"directory of edited shaders to substitute in a new trace, instead of dumping"`
+		OutputTraceFile string `help:"file name for the patched trace"`
 		CaptureFileFlags
 	}
 	DumpFBOFlags struct {
@@ -182,6 +341,7 @@ type (
 		GroupByUserMarkers     bool   `help:"Group commands by user markers"`
 		IncludeNoContextGroups bool   `help:"_Include no context groups"`
 		AllowIncompleteFrame   bool   `help:"_Make a group for incomplete frames"`
+		InferFrameBoundaries   bool   `help:"Infer the frame boundaries from the presentation dependencies"`
 		Observations           ObservationFlags
 		CommandFilterFlags
 	}
@@ -192,6 +352,9 @@ type (
 		ResourcePath         string `help:"file path for the new resource"`
 		At                   int    `help:"command index to replace the resource(s) at"`
 		UpdateResourceBinary string `help:"shaders only. binary to run for every shader; consumes resource data from standard input and writes to standard output"`
+		Object               uint64 `help:"handle of the buffer or linear image whose contents to replace with the -data file, at a submission or flush of its mapped memory"`
+		Data                 string `help:"file with the new contents of the -object"`
+		Offset               uint64 `help:"offset in bytes of the replaced contents of the -object"`
 		OutputTraceFile      string `help:"file name for the updated trace"`
 		SkipOutput           bool   `help:"skip writing the modified trace to a file"`
 		CaptureFileFlags
@@ -202,6 +365,8 @@ type (
 		At     flags.U64Slice    `help:"command/subcommand index to get the state after. Empty for last"`
 		Depth  int               `help:"How many nodes deep should the state tree be displayed. -1 for all"`
 		Filter flags.StringSlice `help:"Which path through the tree should we filter to, default All"`
+		JSON   bool              `help:"print the state as JSON"`
+		Out    string            `help:"output file to save the JSON state"`
 		CaptureFileFlags
 	}
 	StressTestFlags struct {
@@ -235,8 +400,11 @@ type (
 			Cache bool `help:"clear package data before running it"`
 		}
 		Start struct {
-			Defer bool `help:"defers the start of the trace until <enter> is pressed. Only valid for Vulkan."`
-			At    struct {
+			Defer  bool          `help:"defers the start of the trace until <enter> is pressed. Only valid for Vulkan."`
+			After  time.Duration `help:"defers the start of the trace by the given duration after the application is connected. Only valid for Vulkan."`
+			Marker string        `help:"defers the start of the trace until the frame after a debug marker or label containing the text is pushed. Only valid for Vulkan."`
+			Intent string        `help:"defers the start of the trace until an intent with the given action is broadcast on the Android device. Only valid for Vulkan."`
+			At     struct {
 				Frame int `help:"defers the start of the trace until given frame. Only valid for Vulkan. Not compatible with start-defer."`
 			}
 		}
@@ -277,13 +445,13 @@ type (
 	ScreenshotFlags struct {
 		Gapis      GapisFlags
 		Gapir      GapirFlags
-		At         []flags.U64Slice `help:"command/subcommand index for the screenshot (repeatable)"`
-		Frame      []int            `help:"frame index for the screenshot (repeatable). Empty for last"`
-		Draws      bool             `help:"create a screenshot of every draw call in the requested frame(s) (only honored if using -frame)"`
-		Out        string           `help:"output image file (default 'screenshot.png')"`
-		NoOpt      bool             `help:"disables optimization of the replay stream"`
-		Attachment string           `help:"the attachment to show (0-3 for color, d for depth, s for stencil)"`
-		Overdraw   bool             `help:"renders the overdraw instead of the color framebuffer"`
+		At         CommandIndices `help:"command/subcommand indices for the screenshots, as 12.0.1.3,15 (repeatable)"`
+		Frame      []int          `help:"frame index for the screenshot (repeatable). Empty for last"`
+		Draws      bool           `help:"create a screenshot of every draw call in the requested frame(s) (only honored if using -frame)"`
+		Out        string         `help:"output image file (default 'screenshot.png')"`
+		NoOpt      bool           `help:"disables optimization of the replay stream"`
+		Attachment string         `help:"the attachment to show (0-3 for color, d for depth, s for stencil)"`
+		Overdraw   bool           `help:"renders the overdraw instead of the color framebuffer"`
 		Max        struct {
 			Overdraw int `help:"the amount of overdraw to map to white in the output"`
 		}
@@ -292,7 +460,9 @@ type (
 		CaptureFileFlags
 	}
 	UnpackFlags struct {
-		Verbose bool `help:"if true, then output will not be truncated"`
+		Verbose bool   `help:"if true, then output will not be truncated"`
+		JSON    bool   `help:"if true, then print one JSON record per line"`
+		Out     string `help:"file to write the output to instead of stdout"`
 	}
 	StatsFlags struct {
 		Gapis  GapisFlags
@@ -300,11 +470,35 @@ type (
 			Start int `help:"frame to start stats from"`
 			Count int `help:"number of frames after Start to process: -1 for all frames"`
 		}
+		Breakdown bool        `help:"if true, then also print the breakdown of the whole capture"`
+		Format    StatsFormat `help:"output format"`
 		CaptureFileFlags
 	}
 	MemoryFlags struct {
+		Gapis    GapisFlags
+		At       flags.U64Slice `help:"command/subcommand index to get the memory after. Empty for last"`
+		Timeline bool           `help:"also print the allocations and frees of device memory up to the command"`
+		Largest  int            `help:"number of the largest allocations to print: -1 for all"`
+		Bindings bool           `help:"also print the bindings and aliased regions of every allocation"`
+		CaptureFileFlags
+	}
+	DiffFlags struct {
 		Gapis GapisFlags
-		At    flags.U64Slice `help:"command/subcommand index to get the memory after. Empty for last"`
+		CaptureFileFlags
+	}
+	CreateGraphFlags struct {
+		Gapis               GapisFlags
+		Format              string         `help:"output format: dot, json or chrome (a trace with the dependencies as flows)"`
+		Commands            CommandRange   `help:"range of commands N..M to include"`
+		Handles             flags.U64Slice `help:"only include the commands using these buffer or image handles"`
+		ClusterRenderPasses bool           `help:"cluster the commands recording a render pass together"`
+		Out                 string         `help:"file to write the graph to instead of stdout"`
+		CaptureFileFlags
+	}
+	DepsFlags struct {
+		Gapis   GapisFlags
+		Reverse bool `help:"print the commands depending on the command instead of its dependencies"`
+		Depth   int  `help:"maximum depth of the printed tree, 0 for unlimited"`
 		CaptureFileFlags
 	}
 	PipelineFlags struct {
@@ -319,19 +513,71 @@ type (
 	TrimFlags struct {
 		Gapis         GapisFlags
 		Gapir         GapirFlags
-		Commands      bool           `help:"Treat every command as its own frame"`
+		Range         CommandRange   `help:"range of commands N..M to keep, restoring the state before them, instead of frames"`
 		ExtraCommands flags.U64Slice `help:"Additional commands to include (along with their dependencies)"`
 		Frames        struct {
 			Start int `help:"first frame to include (default 0)"`
 			Count int `help:"number of frames to include: -1 for all frames (default -1)"`
 		}
-		Out string `help:"gfxtrace file to save the trimmed capture"`
+		Out       string `help:"gfxtrace file to save the trimmed capture"`
+		Footprint bool   `help:"keep only the requested frames, restoring the state before them"`
 		CommandFilterFlags
 		CaptureFileFlags
 	}
-	GetTimestampsFlags struct {
+	RunFlags struct {
+		Gapis     GapisFlags
+		Gapir     GapirFlags
+		Var       flags.StringSlice `help:"variable NAME=VALUE substituted as $NAME or ${NAME} in the script (repeatable)"`
+		KeepGoing bool              `help:"run the rest of the script after a command fails"`
+		CaptureFileFlags
+	}
+	ShellFlags struct {
 		Gapis GapisFlags
 		Gapir GapirFlags
-		Out   string `help:"output file to save the profiling result"`
+		CaptureFileFlags
+	}
+	SplitFlags struct {
+		Gapis  GapisFlags
+		Gapir  GapirFlags
+		Frames int    `help:"number of frames of each of the split captures"`
+		OutDir string `help:"directory to save the split captures in"`
+		CommandFilterFlags
+		CaptureFileFlags
+	}
+	GetTimestampsFlags struct {
+		Gapis        GapisFlags
+		Gapir        GapirFlags
+		Out          string `help:"output file to save the profiling result"`
+		Format       string `help:"output format: csv, or perfetto for a Perfetto trace"`
+		RenderPasses bool   `help:"also measure the render passes of the command buffers"`
+		Counters     bool   `help:"with the perfetto format, also measure the draws and sample their pipeline statistics counters"`
+	}
+	MeasureFlags struct {
+		Gapis  GapisFlags
+		Gapir  GapirFlags
+		Filter string `help:"only measure the draws of the render passes or user markers whose names contain the text"`
+		Out    string `help:"output file to save the measures"`
+		CSV    bool   `help:"write the measures as CSV rather than as a table"`
+
+		CaptureFileFlags
+	}
+	CompareDevicesFlags struct {
+		Gapis  GapisFlags
+		Match  string `help:"only replay on the devices of which the name, serial, GPU or Vulkan device name match the regular expression; all the compatible devices otherwise"`
+		Frames struct {
+			Step int `help:"compare every N-th frame; 0 or 1 compares every frame"`
+		}
+		Threshold float64 `help:"fraction of the pixels that may differ perceptibly before a frame is divergent"`
+		All       bool    `help:"report every compared frame, not only the divergent ones"`
+		Out       string  `help:"directory to write the framebuffers of the divergent frames to as PNG files"`
+		CaptureFileFlags
+	}
+	ReplayBenchmarkFlags struct {
+		Gapis      GapisFlags
+		Gapir      GapirFlags
+		Iterations int           `help:"number of times to replay the capture"`
+		Format     TimingsFormat `help:"output format"`
+		Out        string        `help:"output file to save the timings"`
+		CaptureFileFlags
 	}
 )
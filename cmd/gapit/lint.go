@@ -0,0 +1,106 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// lintFailedExit is the exit code of gapit lint when the capture has findings
+// at or above the failing severity.
+const lintFailedExit = app.ExitCode(3)
+
+type lintVerb struct{ LintFlags }
+
+func init() {
+	verb := &lintVerb{
+		LintFlags: LintFlags{
+			Gapir:    GapirFlags{DeviceFlags: DeviceFlags{Device: "none"}},
+			Severity: log.Warning,
+		},
+	}
+	app.AddVerb(&app.Verb{
+		Name:      "lint",
+		ShortHelp: "Checks a capture for API misuse, failing if there are findings at or above a severity",
+		Action:    verb,
+	})
+}
+
+func (verb *lintVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	client, capturePath, err := getGapisAndLoadCapture(ctx, verb.Gapis, verb.Gapir, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	stringTable, err := getStringTable(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	// No replay device by default, so that the findings only come from the
+	// analysis of the capture, and the command runs on headless machines.
+	device, err := getDevice(ctx, client, capturePath, verb.Gapir)
+	if err != nil {
+		return err
+	}
+
+	reportPath := &path.Report{
+		Capture:         capturePath,
+		Device:          device,
+		AnalyzeBarriers: true,
+		Lint:            true,
+		Analyses:        true,
+	}
+	boxedReport, err := client.Get(ctx, reportPath.Path(), nil)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to acquire the capture's report")
+	}
+	report := boxedReport.(*service.Report)
+
+	failing := 0
+	for _, e := range report.Items {
+		if log.Severity(e.Severity) < verb.Severity {
+			continue
+		}
+		failing++
+		where := ""
+		if e.Command != nil {
+			where = fmt.Sprintf("%v ", e.Command.Indices)
+		}
+		msg := report.Msg(e.Message).Text(stringTable)
+		fmt.Fprintf(os.Stdout, "[%s] %s%s\n", e.Severity.String(), where, msg)
+	}
+
+	if failing == 0 {
+		fmt.Fprintf(os.Stdout, "No findings at or above %v\n", verb.Severity)
+		return nil
+	}
+	fmt.Fprintf(os.Stdout, "%d findings at or above %v\n", failing, verb.Severity)
+	panic(lintFailedExit)
+}
@@ -0,0 +1,200 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/client"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type measureVerb struct{ MeasureFlags }
+
+func init() {
+	verb := &measureVerb{}
+	app.AddVerb(&app.Verb{
+		Name:      "measure",
+		ShortHelp: "Measure the GPU time and the pipeline statistics of each draw in a replay",
+		Action:    verb,
+	})
+}
+
+// drawMeasure is the measure of a draw.
+type drawMeasure struct {
+	draw  *path.Command
+	name  string
+	time  uint64
+	stats *service.DrawPipelineStatistics
+}
+
+func (verb *measureVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	client, capturePath, err := getGapisAndLoadCapture(ctx, verb.Gapis, verb.Gapir, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	device, err := getDevice(ctx, client, capturePath, verb.Gapir)
+	if err != nil {
+		return err
+	}
+	if device == nil {
+		app.Usage(ctx, "A replay device is required to measure the draws")
+		return nil
+	}
+
+	var ranges []*path.Commands
+	if verb.Filter != "" {
+		if ranges, err = verb.filterRanges(ctx, client, capturePath); err != nil {
+			return err
+		}
+		if len(ranges) == 0 {
+			return fmt.Errorf("No render pass or marker matches the filter %q", verb.Filter)
+		}
+	}
+
+	boxedRes, err := client.GetTimestamps(ctx, capturePath, device, &service.TimestampsOptions{Draws: true})
+	if err != nil {
+		return log.Err(ctx, err, "Failed to get the timestamps of the draws")
+	}
+
+	measures := []*drawMeasure{}
+	draws := []*path.Command{}
+	for _, t := range boxedRes.(*service.GetTimestampsResponse).GetTimestamps().GetTimestamps() {
+		if !t.Draw || !inRanges(t.Begin.Indices, ranges) {
+			continue
+		}
+		draw := capturePath.Command(t.Begin.Indices[0], t.Begin.Indices[1:]...)
+		cmd, err := getCommand(ctx, client, draw)
+		if err != nil {
+			return err
+		}
+		measures = append(measures, &drawMeasure{draw: draw, name: cmd.Name, time: t.TimeInNanoseconds})
+		draws = append(draws, draw)
+	}
+	if len(measures) == 0 {
+		fmt.Fprintln(os.Stdout, "No draws measured")
+		return nil
+	}
+
+	stats, err := client.GetPipelineStatistics(ctx,
+		&service.ReplaySettings{Device: device}, draws, &service.UsageHints{Background: true})
+	if err != nil {
+		log.W(ctx, "Couldn't get the pipeline statistics of the draws: %v", err)
+	} else {
+		for i, s := range stats.Draws {
+			measures[i].stats = s
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if verb.Out != "" {
+		f, err := os.OpenFile(verb.Out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to open the output file")
+		}
+		defer f.Close()
+		out = f
+	}
+
+	header := []string{"Draw", "Command", "Time(ns)", "Vertices", "Primitives", "VSInvocations", "FSInvocations"}
+	records := make([][]string, len(measures))
+	for i, m := range measures {
+		records[i] = []string{dottedIndices(m.draw.Indices), m.name, fmt.Sprint(m.time), "-", "-", "-", "-"}
+		if s := m.stats; s != nil {
+			records[i][3] = fmt.Sprint(s.InputAssemblyVertices)
+			records[i][4] = fmt.Sprint(s.InputAssemblyPrimitives)
+			records[i][5] = fmt.Sprint(s.VertexShaderInvocations)
+			records[i][6] = fmt.Sprint(s.FragmentShaderInvocations)
+		}
+	}
+
+	if verb.CSV {
+		w := csv.NewWriter(out)
+		w.Write(header)
+		w.WriteAll(records)
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(out, 4, 4, 1, ' ', 0)
+	for _, r := range append([][]string{header}, records...) {
+		for _, c := range r {
+			fmt.Fprintf(w, "%v\t", c)
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+// filterRanges returns the command ranges of the render passes and the user
+// markers of the command tree whose names contain the filter.
+func (verb *measureVerb) filterRanges(ctx context.Context, c client.Client, capture *path.Capture) ([]*path.Commands, error) {
+	treePath := capture.CommandTree(nil)
+	treePath.GroupByUserMarkers = true
+	boxedTree, err := c.Get(ctx, treePath.Path(), nil)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed to load the command tree")
+	}
+
+	ranges := []*path.Commands{}
+	err = c.Find(ctx, &service.FindRequest{
+		From: &service.FindRequest_CommandTreeNode{CommandTreeNode: boxedTree.(*service.CommandTree).Root},
+		Text: verb.Filter,
+	}, func(r *service.FindResponse) error {
+		boxedNode, err := c.Get(ctx, r.GetCommandTreeNode().Path(), nil)
+		if err != nil {
+			return err
+		}
+		if n := boxedNode.(*service.CommandTreeNode); n.Group != "" {
+			ranges = append(ranges, n.Commands)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed to search the command tree")
+	}
+	return ranges, nil
+}
+
+// inRanges returns true if there are no ranges, or if the command at the
+// indices is in one of the ranges.
+func inRanges(indices []uint64, ranges []*path.Commands) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	idx := api.SubCmdIdx(indices)
+	for _, r := range ranges {
+		if api.SubCmdIdx(r.From).LEQ(idx) && idx.LEQ(api.SubCmdIdx(r.To)) {
+			return true
+		}
+	}
+	return false
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/client"
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
 )
@@ -34,9 +35,10 @@ type memoryVerb MemoryFlags
 
 func init() {
 	verb := &memoryVerb{}
+	verb.Largest = 10
 	app.AddVerb(&app.Verb{
 		Name:      "memory",
-		ShortHelp: "Prints memory metrics about a capture file",
+		ShortHelp: "Prints the memory heaps, largest allocations and allocation timeline of a capture file",
 		Action:    verb,
 	})
 }
@@ -61,6 +63,87 @@ func (verb *memoryVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		verb.At = []uint64{uint64(boxedCapture.(*service.Capture).NumCommands) - 1}
 	}
 
+	heaps, err := client.GetMemoryHeaps(ctx, capture.Command(verb.At[0]))
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to load the memory heaps")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 4, 4, 0, ' ', 0)
+	if verb.Timeline {
+		printMemoryTimeline(w, heaps.Timeline)
+	}
+	printMemoryHeaps(w, heaps.Heaps)
+	printLargestAllocations(w, heaps.Heaps, verb.Largest)
+	w.Flush()
+
+	if !verb.Bindings {
+		return nil
+	}
+	return verb.printBindings(ctx, client, capture)
+}
+
+// printMemoryTimeline prints the allocations and frees of device memory, in
+// command order.
+func printMemoryTimeline(w *tabwriter.Writer, timeline []*service.MemoryEvent) {
+	fmt.Fprintf(w, "%v memory events\n", len(timeline))
+	for _, e := range timeline {
+		at := fmt.Sprint(e.Command)
+		if e.Initial {
+			at = "initial"
+		}
+		op := "allocate"
+		if e.Freed {
+			op = "free"
+		}
+		fmt.Fprintf(w, "\t%v: \t%v \tmemory %v \tdevice %v heap %v \t%v bytes\n",
+			at, op, e.Memory, e.Device, e.Heap, e.Size)
+	}
+}
+
+// printMemoryHeaps prints the current and peak usage of each memory heap.
+func printMemoryHeaps(w *tabwriter.Writer, heaps []*service.MemoryHeap) {
+	fmt.Fprintf(w, "%v memory heaps\n", len(heaps))
+	for _, heap := range heaps {
+		fmt.Fprintf(w, "Device %v heap %v:\n", heap.Device, heap.Index)
+		fmt.Fprintf(w, "\tSize: \t%v\n", heap.Size)
+		fmt.Fprintf(w, "\tAllocated: \t%v\n", heap.Allocated)
+		fmt.Fprintf(w, "\tPeak: \t%v (after command %v)\n", heap.Peak, heap.PeakCommand)
+		for _, typ := range heap.Types {
+			fmt.Fprintf(w, "\tMemory Type %v: \t%v in %v allocations\n",
+				typ.Index, typ.Allocated, len(typ.Allocations))
+		}
+	}
+}
+
+// printLargestAllocations prints the count largest live allocations of all
+// the heaps, with the buffers and images bound into them.
+func printLargestAllocations(w *tabwriter.Writer, heaps []*service.MemoryHeap, count int) {
+	allocs := []*api.MemoryAllocation{}
+	for _, heap := range heaps {
+		for _, typ := range heap.Types {
+			allocs = append(allocs, typ.Allocations...)
+		}
+	}
+	sort.SliceStable(allocs, func(i, j int) bool { return allocs[i].Size > allocs[j].Size })
+	if count >= 0 && len(allocs) > count {
+		allocs = allocs[:count]
+	}
+	fmt.Fprintf(w, "%v largest allocations\n", len(allocs))
+	for _, alloc := range allocs {
+		fmt.Fprintf(w, "Memory %v: \t%v bytes\n", alloc.Name, alloc.Size)
+		fmt.Fprintf(w, "\tDevice: \t%v\n", alloc.Device)
+		fmt.Fprintf(w, "\tMemory Type: \t%v\n", alloc.MemoryType)
+		fmt.Fprintf(w, "\t%v bindings:\n", len(alloc.Bindings))
+		for _, binding := range alloc.Bindings {
+			fmt.Fprintf(w, "\t%v: %v \t[%v, %v)\n", bindingType(binding), binding.Name,
+				binding.Offset, binding.Offset+binding.Size)
+		}
+	}
+}
+
+// printBindings prints the memory breakdown of the metrics, with the bindings
+// and the aliased regions of every allocation.
+func (verb *memoryVerb) printBindings(ctx context.Context, client client.Client, capture *path.Capture) error {
 	boxedVal, err := client.Get(ctx, (&path.Metrics{
 		Command:         capture.Command(verb.At[0], verb.At[1:]...),
 		MemoryBreakdown: true,
@@ -122,24 +205,7 @@ func (verb *memoryVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		sort.Slice(bindings, bindings.bindingLess)
 		fmt.Fprintf(w, "\t%v bindings:\n", len(bindings))
 		for _, binding := range bindings {
-			var typ string
-			switch binding.Type.(type) {
-			case *api.MemoryBinding_Buffer:
-				typ = "Buffer"
-			case *api.MemoryBinding_Image:
-				typ = "Image"
-			case *api.MemoryBinding_SparseImageBlock:
-				typ = "Sparse Image Block"
-			case *api.MemoryBinding_SparseImageMetadata:
-				typ = "Sparse Image Metadata"
-			case *api.MemoryBinding_SparseImageMipTail:
-				typ = "Sparse Image Mip Tail"
-			case *api.MemoryBinding_SparseOpaqueImageBlock:
-				typ = "Sparse Opaque Image Block"
-			case *api.MemoryBinding_SparseBufferBlock:
-				typ = "Sparse Buffer Block"
-			}
-			fmt.Fprintf(w, "\t%v: %v\n", typ, binding.Name)
+			fmt.Fprintf(w, "\t%v: %v\n", bindingType(binding), binding.Name)
 
 			fmt.Fprintf(w, "\t\tOffset: \t%v\n", binding.Offset)
 			fmt.Fprintf(w, "\t\tSize: \t%v\n", binding.Size)
@@ -192,6 +258,27 @@ func (verb *memoryVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	return nil
 }
 
+// bindingType returns the printable type of the resource of the binding.
+func bindingType(binding *api.MemoryBinding) string {
+	switch binding.Type.(type) {
+	case *api.MemoryBinding_Buffer:
+		return "Buffer"
+	case *api.MemoryBinding_Image:
+		return "Image"
+	case *api.MemoryBinding_SparseImageBlock:
+		return "Sparse Image Block"
+	case *api.MemoryBinding_SparseImageMetadata:
+		return "Sparse Image Metadata"
+	case *api.MemoryBinding_SparseImageMipTail:
+		return "Sparse Image Mip Tail"
+	case *api.MemoryBinding_SparseOpaqueImageBlock:
+		return "Sparse Opaque Image Block"
+	case *api.MemoryBinding_SparseBufferBlock:
+		return "Sparse Buffer Block"
+	}
+	return "Resource"
+}
+
 type bindingSlice []*api.MemoryBinding
 
 func (bindings bindingSlice) bindingLess(i, j int) bool {
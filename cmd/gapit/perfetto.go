@@ -0,0 +1,186 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// perfettoMsg is a message of the Perfetto trace protos, encoded field by
+// field as the protos are not part of the build. Only the fields written by
+// gapit are supported.
+type perfettoMsg struct{ buf proto.Buffer }
+
+// The fields of the Perfetto messages, from protos/perfetto/trace.
+const (
+	// Trace
+	perfettoTracePacket = 1
+	// TracePacket
+	perfettoPacketTimestamp       = 8
+	perfettoPacketSequenceID      = 10
+	perfettoPacketTrackEvent      = 11
+	perfettoPacketSequenceFlags   = 13
+	perfettoPacketTrackDescriptor = 60
+	// TrackDescriptor
+	perfettoTrackUUID       = 1
+	perfettoTrackName       = 2
+	perfettoTrackParentUUID = 5
+	perfettoTrackCounter    = 8
+	// TrackEvent
+	perfettoEventAnnotations  = 4
+	perfettoEventType         = 9
+	perfettoEventTrackUUID    = 11
+	perfettoEventName         = 23
+	perfettoEventCounterValue = 30
+	// DebugAnnotation
+	perfettoAnnotationString = 6
+	perfettoAnnotationName   = 10
+)
+
+// The values of the Perfetto enums.
+const (
+	// TracePacket.SequenceFlags
+	perfettoSeqIncrementalStateCleared = 1
+	// TrackEvent.Type
+	perfettoSliceBegin = 1
+	perfettoSliceEnd   = 2
+	perfettoCounter    = 4
+)
+
+func (m *perfettoMsg) key(field, wire uint64) {
+	m.buf.EncodeVarint(field<<3 | wire)
+}
+
+func (m *perfettoMsg) uint(field, v uint64) *perfettoMsg {
+	m.key(field, proto.WireVarint)
+	m.buf.EncodeVarint(v)
+	return m
+}
+
+func (m *perfettoMsg) int(field uint64, v int64) *perfettoMsg {
+	return m.uint(field, uint64(v))
+}
+
+func (m *perfettoMsg) str(field uint64, s string) *perfettoMsg {
+	m.key(field, proto.WireBytes)
+	m.buf.EncodeStringBytes(s)
+	return m
+}
+
+func (m *perfettoMsg) msg(field uint64, sub *perfettoMsg) *perfettoMsg {
+	m.key(field, proto.WireBytes)
+	m.buf.EncodeRawBytes(sub.buf.Bytes())
+	return m
+}
+
+// perfettoTrace writes the packets of a Perfetto trace, all in the same
+// sequence. The first error is kept, and the following packets are dropped.
+type perfettoTrace struct {
+	out     io.Writer
+	started bool
+	err     error
+}
+
+// packet writes the packet at the given time in nanoseconds.
+func (t *perfettoTrace) packet(ts uint64, p *perfettoMsg) {
+	if t.err != nil {
+		return
+	}
+	p.uint(perfettoPacketTimestamp, ts)
+	p.uint(perfettoPacketSequenceID, 1)
+	if !t.started {
+		p.uint(perfettoPacketSequenceFlags, perfettoSeqIncrementalStateCleared)
+		t.started = true
+	}
+	trace := &perfettoMsg{}
+	trace.msg(perfettoTracePacket, p)
+	_, t.err = t.out.Write(trace.buf.Bytes())
+}
+
+// track writes the descriptor of the track with the given uuid and name,
+// nested in the parent track if not 0.
+func (t *perfettoTrace) track(uuid, parent uint64, name string) {
+	d := (&perfettoMsg{}).uint(perfettoTrackUUID, uuid).str(perfettoTrackName, name)
+	if parent != 0 {
+		d.uint(perfettoTrackParentUUID, parent)
+	}
+	t.packet(0, (&perfettoMsg{}).msg(perfettoPacketTrackDescriptor, d))
+}
+
+// counterTrack writes the descriptor of the counter track with the given
+// uuid and name, nested in the parent track.
+func (t *perfettoTrace) counterTrack(uuid, parent uint64, name string) {
+	d := (&perfettoMsg{}).uint(perfettoTrackUUID, uuid).str(perfettoTrackName, name).
+		uint(perfettoTrackParentUUID, parent).
+		msg(perfettoTrackCounter, &perfettoMsg{})
+	t.packet(0, (&perfettoMsg{}).msg(perfettoPacketTrackDescriptor, d))
+}
+
+// perfettoEvent is a track event of the trace at the given time.
+type perfettoEvent struct {
+	ts uint64
+	// True if the event ends a slice or resets a counter to 0, so it is
+	// written before the other events at the same time.
+	ending bool
+	event  *perfettoMsg
+}
+
+// sortEvents sorts the events by time, with the ending events first at the
+// same time so consecutive slices and counters don't overlap.
+func sortEvents(events []perfettoEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if a.ts != b.ts {
+			return a.ts < b.ts
+		}
+		return a.ending && !b.ending
+	})
+}
+
+// sliceBegin returns the event beginning a slice of the track with the given
+// name and string annotations, as name and value pairs.
+func sliceBegin(ts, track uint64, name string, args ...string) perfettoEvent {
+	e := (&perfettoMsg{}).uint(perfettoEventType, perfettoSliceBegin).
+		uint(perfettoEventTrackUUID, track).
+		str(perfettoEventName, name)
+	for i := 0; i+1 < len(args); i += 2 {
+		a := (&perfettoMsg{}).str(perfettoAnnotationName, args[i]).str(perfettoAnnotationString, args[i+1])
+		e.msg(perfettoEventAnnotations, a)
+	}
+	return perfettoEvent{ts, false, e}
+}
+
+// sliceEnd returns the event ending the last slice of the track.
+func sliceEnd(ts, track uint64) perfettoEvent {
+	return perfettoEvent{ts, true, (&perfettoMsg{}).uint(perfettoEventType, perfettoSliceEnd).
+		uint(perfettoEventTrackUUID, track)}
+}
+
+// counter returns the event setting the value of the counter track.
+func counter(ts, track uint64, v int64) perfettoEvent {
+	return perfettoEvent{ts, v == 0, (&perfettoMsg{}).uint(perfettoEventType, perfettoCounter).
+		uint(perfettoEventTrackUUID, track).
+		int(perfettoEventCounterValue, v)}
+}
+
+// events writes the track events, which must be sorted by time.
+func (t *perfettoTrace) events(events []perfettoEvent) {
+	for _, e := range events {
+		t.packet(e.ts, (&perfettoMsg{}).msg(perfettoPacketTrackEvent, e.event))
+	}
+}
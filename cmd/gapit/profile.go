@@ -22,7 +22,6 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/log"
@@ -33,10 +32,10 @@ import (
 type profileVerb struct{ GetTimestampsFlags }
 
 func init() {
-	verb := &profileVerb{}
+	verb := &profileVerb{GetTimestampsFlags{Counters: true}}
 	app.AddVerb(&app.Verb{
 		Name:      "profile",
-		ShortHelp: "Profile a replay to get the time of executing the commands.",
+		ShortHelp: "Profile a replay to get the GPU time of executing the commands.",
 		Action:    verb,
 	})
 }
@@ -77,34 +76,173 @@ func (verb *profileVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		out = f
 	}
 
-	boxedRes, err := client.GetTimestamps(ctx, capturePath, device)
+	opts := &service.TimestampsOptions{
+		RenderPasses: verb.RenderPasses,
+		Draws:        verb.Format == "perfetto" && verb.Counters,
+	}
+	boxedRes, err := client.GetTimestamps(ctx, capturePath, device, opts)
 	if err != nil {
 		return log.Err(ctx, err, "Failed to get the timestamps")
 	}
 	res := boxedRes.(*service.GetTimestampsResponse)
+	ts := res.GetTimestamps().GetTimestamps()
+
+	switch verb.Format {
+	case "", "csv":
+		return writeProfileCSV(ctx, out, ts)
+	case "perfetto":
+		return writeProfileTrace(ctx, client, capturePath, device, out, ts)
+	default:
+		app.Usage(ctx, "Unknown format: %v", verb.Format)
+		return nil
+	}
+}
 
+func writeProfileCSV(ctx context.Context, out io.Writer, ts []*service.TimestampsItem) error {
 	reportWriter := csv.NewWriter(out)
 	defer reportWriter.Flush()
 
 	header := []string{"BeginCmd", "EndCmd", "Time(ns)"}
-	if err = reportWriter.Write(header); err != nil {
+	if err := reportWriter.Write(header); err != nil {
 		log.Err(ctx, err, "Failed to write header")
 	}
 
-	cmdToString := func(cmd *path.Command) string {
-		return strings.Trim(strings.Join(strings.Fields(fmt.Sprint(cmd.Indices)), "."), "[]")
+	for _, t := range ts {
+		begin := dottedIndices(t.Begin.Indices)
+		end := dottedIndices(t.End.Indices)
+		record := []string{begin, end, fmt.Sprint(t.TimeInNanoseconds)}
+		if err := reportWriter.Write(record); err != nil {
+			log.Err(ctx, err, "Failed to write record")
+		}
+	}
+
+	return nil
+}
+
+// The uuids of the tracks of the profile trace. The counter tracks follow.
+const (
+	traceGPU = iota + 1
+	traceCommandBuffers
+	traceRenderPasses
+	traceDraws
+	traceCounters
+)
+
+// traceCounterNames are the names of the counter tracks of the pipeline
+// statistics, in the order of pipelineStatisticsValues.
+var traceCounterNames = []string{
+	"Input assembly vertices",
+	"Input assembly primitives",
+	"Vertex shader invocations",
+	"Clipping invocations",
+	"Clipping primitives",
+	"Fragment shader invocations",
+}
+
+// pipelineStatisticsValues returns the values of the pipeline statistics, in
+// the order of traceCounterNames.
+func pipelineStatisticsValues(s *service.DrawPipelineStatistics) []uint64 {
+	return []uint64{
+		s.InputAssemblyVertices,
+		s.InputAssemblyPrimitives,
+		s.VertexShaderInvocations,
+		s.ClippingInvocations,
+		s.ClippingPrimitives,
+		s.FragmentShaderInvocations,
+	}
+}
+
+// writeProfileTrace writes the timestamps as a Perfetto trace with a track
+// for the command buffers, one for the render passes and one for the draws.
+// Each command buffer and render pass slice is named after the capture
+// command submitting the work, and each draw slice after the draw. The
+// pipeline statistics of the draws are written as counter tracks, holding the
+// statistics of each draw while it executes.
+func writeProfileTrace(ctx context.Context, client service.Service, capture *path.Capture, device *path.Device, out io.Writer, ts []*service.TimestampsItem) error {
+	origin := uint64(0)
+	for i, t := range ts {
+		if i == 0 || t.StartInNanoseconds < origin {
+			origin = t.StartInNanoseconds
+		}
+	}
+
+	names := map[string]string{}
+	name := func(indices []uint64) (string, error) {
+		key := dottedIndices(indices)
+		if name, ok := names[key]; ok {
+			return name, nil
+		}
+		cmd, err := getCommand(ctx, client, capture.Command(indices[0], indices[1:]...))
+		if err != nil {
+			return "", err
+		}
+		names[key] = fmt.Sprintf("%v %v", key, cmd.Name)
+		return names[key], nil
 	}
 
-	if ts := res.GetTimestamps(); ts != nil {
-		for _, t := range ts.Timestamps {
-			begin := cmdToString(t.Begin)
-			end := cmdToString(t.End)
-			record := []string{begin, end, fmt.Sprint(t.TimeInNanoseconds)}
-			if err := reportWriter.Write(record); err != nil {
-				log.Err(ctx, err, "Failed to write record")
+	events := []perfettoEvent{}
+	draws := []*path.Command{}
+	drawTimes := []*service.TimestampsItem{}
+	for _, t := range ts {
+		track, indices := uint64(traceCommandBuffers), t.Begin.Indices[:1]
+		switch {
+		case t.Draw:
+			track, indices = traceDraws, t.Begin.Indices
+			draws = append(draws, t.Begin)
+			drawTimes = append(drawTimes, t)
+		case t.RenderPass:
+			track = traceRenderPasses
+		}
+		n, err := name(indices)
+		if err != nil {
+			return err
+		}
+		start := t.StartInNanoseconds - origin
+		events = append(events,
+			sliceBegin(start, track, n,
+				"begin", dottedIndices(t.Begin.Indices),
+				"end", dottedIndices(t.End.Indices)),
+			sliceEnd(start+t.TimeInNanoseconds, track))
+	}
+
+	counters := false
+	if len(draws) > 0 {
+		stats, err := client.GetPipelineStatistics(ctx,
+			&service.ReplaySettings{Device: device}, draws, &service.UsageHints{Background: true})
+		if err != nil {
+			log.W(ctx, "Couldn't get the pipeline statistics of the draws: %v", err)
+		} else {
+			counters = true
+			for i, s := range stats.Draws {
+				t := drawTimes[i]
+				start := t.StartInNanoseconds - origin
+				for j, v := range pipelineStatisticsValues(s) {
+					track := uint64(traceCounters + j)
+					events = append(events,
+						counter(start, track, int64(v)),
+						counter(start+t.TimeInNanoseconds, track, 0))
+				}
 			}
 		}
 	}
 
+	sortEvents(events)
+
+	trace := &perfettoTrace{out: out}
+	trace.track(traceGPU, 0, "GPU")
+	trace.track(traceCommandBuffers, traceGPU, "Command buffers")
+	trace.track(traceRenderPasses, traceGPU, "Render passes")
+	if len(draws) > 0 {
+		trace.track(traceDraws, traceGPU, "Draws")
+	}
+	if counters {
+		for i, n := range traceCounterNames {
+			trace.counterTrack(uint64(traceCounters+i), traceGPU, n)
+		}
+	}
+	trace.events(events)
+	if trace.err != nil {
+		return log.Err(ctx, trace.err, "Failed to write the trace")
+	}
 	return nil
 }
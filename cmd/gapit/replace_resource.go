@@ -42,7 +42,7 @@ func init() {
 	}
 	app.AddVerb(&app.Verb{
 		Name:      "replace_resource",
-		ShortHelp: "Produce a new trace with the given resource replaced at the given command",
+		ShortHelp: "Produce a new trace with the given resource, buffer or image contents replaced at the given command",
 		Action:    verb,
 	})
 }
@@ -53,8 +53,19 @@ func (verb *replaceResourceVerb) Run(ctx context.Context, flags flag.FlagSet) er
 		return nil
 	}
 
-	if (verb.Handle == "") == (verb.UpdateResourceBinary == "") {
-		app.Usage(ctx, "only one of -handle or -updateresourcebinary arguments is required")
+	modes := 0
+	for _, set := range []bool{verb.Handle != "", verb.UpdateResourceBinary != "", verb.Object != 0} {
+		if set {
+			modes++
+		}
+	}
+	if modes != 1 {
+		app.Usage(ctx, "only one of -handle, -updateresourcebinary or -object arguments is required")
+		return nil
+	}
+
+	if verb.Object != 0 && verb.Data == "" {
+		app.Usage(ctx, "-data argument is required if -object is specified")
 		return nil
 	}
 
@@ -69,12 +80,6 @@ func (verb *replaceResourceVerb) Run(ctx context.Context, flags flag.FlagSet) er
 	}
 	defer client.Close()
 
-	boxedResources, err := client.Get(ctx, capture.Resources().Path(), nil)
-	if err != nil {
-		return log.Err(ctx, err, "Could not find the capture's resources")
-	}
-	resources := boxedResources.(*service.Resources)
-
 	if verb.At == -1 {
 		boxedCapture, err := client.Get(ctx, capture.Path(), nil)
 		if err != nil {
@@ -83,6 +88,25 @@ func (verb *replaceResourceVerb) Run(ctx context.Context, flags flag.FlagSet) er
 		verb.At = int(boxedCapture.(*service.Capture).NumCommands) - 1
 	}
 
+	if verb.Object != 0 {
+		data, err := ioutil.ReadFile(verb.Data)
+		if err != nil {
+			return log.Errf(ctx, err, "Could not read data file %s", verb.Data)
+		}
+		at := capture.Command(uint64(verb.At))
+		newCapture, err := client.ReplaceData(ctx, at, verb.Object, verb.Offset, data)
+		if err != nil {
+			return log.Errf(ctx, err, "Could not replace the contents of 0x%x at: %v", verb.Object, at)
+		}
+		return verb.write(ctx, client, newCapture)
+	}
+
+	boxedResources, err := client.Get(ctx, capture.Resources().Path(), nil)
+	if err != nil {
+		return log.Err(ctx, err, "Could not find the capture's resources")
+	}
+	resources := boxedResources.(*service.Resources)
+
 	var resourcePath *path.Any
 	var resourceData interface{}
 
@@ -141,7 +165,11 @@ func (verb *replaceResourceVerb) Run(ctx context.Context, flags flag.FlagSet) er
 	if err != nil {
 		return log.Errf(ctx, err, "Could not update resource data: %v", resourcePath)
 	}
-	newCapture := path.FindCapture(newResourcePath.Node())
+	return verb.write(ctx, client, path.FindCapture(newResourcePath.Node()))
+}
+
+// write saves the new capture to the output trace file, unless skipped.
+func (verb *replaceResourceVerb) write(ctx context.Context, client service.Service, newCapture *path.Capture) error {
 	log.I(ctx, "New capture id: %s", newCapture.ID)
 
 	if verb.SkipOutput {
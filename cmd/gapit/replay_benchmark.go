@@ -0,0 +1,202 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type replayBenchmarkVerb struct{ ReplayBenchmarkFlags }
+
+func init() {
+	verb := &replayBenchmarkVerb{}
+	verb.Iterations = 5
+	app.AddVerb(&app.Verb{
+		Name:      "replay_benchmark",
+		ShortHelp: "Replays a capture several times and reports the GPU and CPU times of the frames and render passes",
+		Action:    verb,
+	})
+}
+
+// frameTiming is the GPU time of the command buffers submitted in a frame, and
+// the CPU time spent by the replay device on the commands of the frame.
+type frameTiming struct {
+	Frame     int    `json:"frame"`
+	GpuTimeNs uint64 `json:"gpuTimeNs"`
+	CpuTimeNs uint64 `json:"cpuTimeNs"`
+}
+
+// renderPassTiming is the GPU time of a render pass, and the CPU time spent by
+// the replay device on the commands recording it.
+type renderPassTiming struct {
+	Frame     int    `json:"frame"`
+	Begin     string `json:"begin"`
+	End       string `json:"end"`
+	GpuTimeNs uint64 `json:"gpuTimeNs"`
+	CpuTimeNs uint64 `json:"cpuTimeNs"`
+}
+
+// replayTimings are the timings of one replay of the capture. The wall time is
+// the time of the whole request, including the replay measuring the CPU
+// times, as seen by the client.
+type replayTimings struct {
+	Iteration    int                `json:"iteration"`
+	WallTimeNs   int64              `json:"wallTimeNs"`
+	Frames       []frameTiming      `json:"frames"`
+	RenderPasses []renderPassTiming `json:"renderPasses"`
+}
+
+func (verb *replayBenchmarkVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+	if verb.Iterations <= 0 {
+		app.Usage(ctx, "The number of iterations must be positive, got %d", verb.Iterations)
+		return nil
+	}
+
+	client, capturePath, err := getGapisAndLoadCapture(ctx, verb.Gapis, verb.Gapir, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	device, err := getDevice(ctx, client, capturePath, verb.Gapir)
+	if err != nil {
+		return err
+	}
+	if device == nil {
+		return log.Errf(ctx, nil, "A replay device is required to benchmark the replay")
+	}
+
+	events, err := getEvents(ctx, client, &path.Events{
+		Capture:     capturePath,
+		LastInFrame: true,
+	})
+	if err != nil {
+		return err
+	}
+	frameEnds := make([]uint64, len(events))
+	for i, e := range events {
+		frameEnds[i] = e.Command.Indices[0]
+	}
+	// frameOf returns the index of the frame of the command.
+	frameOf := func(cmd *path.Command) int {
+		return sort.Search(len(frameEnds), func(i int) bool {
+			return frameEnds[i] >= cmd.Indices[0]
+		})
+	}
+
+	all := []replayTimings{}
+	for i := 0; i < verb.Iterations; i++ {
+		start := time.Now()
+		boxedRes, err := client.GetTimestamps(ctx, capturePath, device, &service.TimestampsOptions{
+			RenderPasses: true,
+			CpuTimes:     true,
+		})
+		if err != nil {
+			return log.Err(ctx, err, "Failed to replay the capture")
+		}
+		timings := replayTimings{
+			Iteration:    i,
+			WallTimeNs:   time.Since(start).Nanoseconds(),
+			Frames:       []frameTiming{},
+			RenderPasses: []renderPassTiming{},
+		}
+
+		res := boxedRes.(*service.GetTimestampsResponse).GetTimestamps()
+		frames := map[int]*frameTiming{}
+		frame := func(f int) *frameTiming {
+			if _, ok := frames[f]; !ok {
+				frames[f] = &frameTiming{Frame: f}
+			}
+			return frames[f]
+		}
+		for _, s := range res.GetTimestamps() {
+			f := frameOf(s.Begin)
+			if s.RenderPass {
+				timings.RenderPasses = append(timings.RenderPasses, renderPassTiming{
+					Frame:     f,
+					Begin:     dottedIndices(s.Begin.Indices),
+					End:       dottedIndices(s.End.Indices),
+					GpuTimeNs: s.TimeInNanoseconds,
+					CpuTimeNs: s.CpuTimeInNanoseconds,
+				})
+			} else {
+				frame(f).GpuTimeNs += s.TimeInNanoseconds
+			}
+		}
+		for _, t := range res.GetCpuTimes() {
+			frame(frameOf(&path.Command{Indices: []uint64{t.Command}})).CpuTimeNs += t.TimeInNanoseconds
+		}
+		for f := 0; f <= len(frameEnds); f++ {
+			if t, ok := frames[f]; ok {
+				timings.Frames = append(timings.Frames, *t)
+			}
+		}
+		sort.SliceStable(timings.RenderPasses, func(a, b int) bool {
+			return timings.RenderPasses[a].Frame < timings.RenderPasses[b].Frame
+		})
+		all = append(all, timings)
+	}
+
+	var out io.Writer = os.Stdout
+	if verb.Out != "" {
+		f, err := os.OpenFile(verb.Out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to open the output file")
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if verb.Format == JsonTimings {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(all)
+	}
+
+	w := csv.NewWriter(out)
+	defer w.Flush()
+	records := [][]string{{"Iteration", "Kind", "Frame", "BeginCmd", "EndCmd", "GpuTime(ns)", "CpuTime(ns)", "WallTime(ns)"}}
+	for _, t := range all {
+		it := fmt.Sprint(t.Iteration)
+		records = append(records, []string{it, "replay", "", "", "", "", "", fmt.Sprint(t.WallTimeNs)})
+		for _, f := range t.Frames {
+			records = append(records, []string{it, "frame", fmt.Sprint(f.Frame), "", "", fmt.Sprint(f.GpuTimeNs), fmt.Sprint(f.CpuTimeNs), ""})
+		}
+		for _, rp := range t.RenderPasses {
+			records = append(records, []string{it, "renderpass", fmt.Sprint(rp.Frame), rp.Begin, rp.End, fmt.Sprint(rp.GpuTimeNs), fmt.Sprint(rp.CpuTimeNs), ""})
+		}
+	}
+	if err := w.WriteAll(records); err != nil {
+		return log.Err(ctx, err, "Failed to write the timings")
+	}
+	return nil
+}
@@ -56,18 +56,9 @@ func (verb *reportVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	}
 	defer client.Close()
 
-	stringTables, err := client.GetAvailableStringTables(ctx)
+	stringTable, err := getStringTable(ctx, client)
 	if err != nil {
-		return log.Err(ctx, err, "Failed get list of string tables")
-	}
-
-	var stringTable *stringtable.StringTable
-	if len(stringTables) > 0 {
-		// TODO: Let the user pick the string table.
-		stringTable, err = client.GetStringTable(ctx, stringTables[0])
-		if err != nil {
-			return log.Err(ctx, err, "Failed get string table")
-		}
+		return err
 	}
 
 	device, err := getDevice(ctx, client, capturePath, verb.Gapir)
@@ -86,7 +77,15 @@ func (verb *reportVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	}
 	commands := boxedCommands.(*service.Commands).List
 
-	boxedReport, err := client.Get(ctx, capturePath.Report(device, filter, verb.DisplayToSurface).Path(), nil)
+	reportPath := capturePath.Report(device, filter, verb.DisplayToSurface)
+	reportPath.ExplainDeadCodeElimination = verb.ExplainDCE
+	if len(verb.ExplainDCEAt) > 0 {
+		reportPath.DeadCodeEliminationRequest = capturePath.Command(verb.ExplainDCEAt[0], verb.ExplainDCEAt[1:]...)
+	}
+	reportPath.AnalyzeBarriers = verb.AnalyzeBarriers
+	reportPath.Lint = verb.Lint
+	reportPath.Analyses = verb.Analyses
+	boxedReport, err := client.Get(ctx, reportPath.Path(), nil)
 	if err != nil {
 		return log.Err(ctx, err, "Failed to acquire the capture's report")
 	}
@@ -119,3 +118,21 @@ func (verb *reportVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 
 	return nil
 }
+
+// getStringTable returns the first string table available on the server, or
+// nil if there is none.
+func getStringTable(ctx context.Context, client service.Service) (*stringtable.StringTable, error) {
+	stringTables, err := client.GetAvailableStringTables(ctx)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed get list of string tables")
+	}
+	if len(stringTables) == 0 {
+		return nil, nil
+	}
+	// TODO: Let the user pick the string table.
+	stringTable, err := client.GetStringTable(ctx, stringTables[0])
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed get string table")
+	}
+	return stringTable, nil
+}
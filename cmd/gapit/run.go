@@ -0,0 +1,98 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/app/flags"
+	"github.com/google/gapid/core/log"
+)
+
+type runVerb struct{ RunFlags }
+
+func init() {
+	verb := &runVerb{
+		RunFlags{
+			Var: flags.StringSlice{},
+		},
+	}
+	app.AddVerb(&app.Verb{
+		Name:      "run",
+		ShortHelp: "Runs a script of gapit shell commands against a .gfxtrace file",
+		Action:    verb,
+	})
+}
+
+func (verb *runVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 2 {
+		app.Usage(ctx, "Exactly one script and one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	for _, v := range verb.Var {
+		if parts := strings.SplitN(v, "=", 2); len(parts) != 2 || parts[0] == "" {
+			app.Usage(ctx, "Expected a variable as NAME=VALUE, got %s", v)
+			return nil
+		}
+	}
+
+	script, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return log.Errf(ctx, err, "Could not open script file %v", flags.Arg(0))
+	}
+	defer script.Close()
+
+	s, err := newSession(ctx, verb.Gapis, verb.Gapir, flags.Arg(1), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer s.client.Close()
+
+	for _, v := range verb.Var {
+		parts := strings.SplitN(v, "=", 2)
+		s.vars[parts[0]] = parts[1]
+	}
+
+	failed := 0
+	in := bufio.NewScanner(script)
+	for line := 1; in.Scan(); line++ {
+		quit, err := s.execute(ctx, in.Text())
+		if err != nil {
+			err = fmt.Errorf("%v:%d: %v", flags.Arg(0), line, err)
+			if !verb.KeepGoing {
+				return err
+			}
+			fmt.Fprintf(s.out, "Error: %v\n", err)
+			failed++
+		}
+		if quit {
+			break
+		}
+	}
+	if err := in.Err(); err != nil {
+		return log.Errf(ctx, err, "Could not read script file %v", flags.Arg(0))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d commands of the script failed", failed)
+	}
+	return nil
+}
@@ -25,7 +25,6 @@ import (
 	"sync"
 
 	"github.com/google/gapid/core/app"
-	"github.com/google/gapid/core/app/flags"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/service"
@@ -39,7 +38,7 @@ type screenshotVerb struct{ ScreenshotFlags }
 func init() {
 	verb := &screenshotVerb{
 		ScreenshotFlags{
-			At:    []flags.U64Slice{},
+			At:    CommandIndices{},
 			Frame: []int{},
 			Out:   "screenshot.png",
 			NoOpt: false,
@@ -73,15 +72,29 @@ func (verb *screenshotVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	}
 
 	var commands []*path.Command
+	// The suffixes of the output files, the indices of the requested commands
+	// or the position of the command in the frames.
+	var names []string
 	if len(verb.At) > 0 {
 		for _, at := range verb.At {
-			commands = append(commands, capture.Command(at[0], at[1:]...))
+			if len(at) == 0 {
+				return log.Errf(ctx, nil, "Empty command index")
+			}
+			command := capture.Command(at[0], at[1:]...)
+			if _, err := client.Get(ctx, command.Path(), nil); err != nil {
+				return log.Errf(ctx, err, "Invalid command %v", at)
+			}
+			commands = append(commands, command)
+			names = append(names, dottedIndices(at))
 		}
 	} else {
 		commands, err = verb.frameCommands(ctx, capture, client)
 		if err != nil {
 			return err
 		}
+		for idx := range commands {
+			names = append(names, fmt.Sprint(idx))
+		}
 	}
 
 	// Submit requests in parallel, so that gapis will batch them.
@@ -95,7 +108,7 @@ func (verb *screenshotVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 
 			var err error
 			if frame, err := verb.getSingleFrame(ctx, command, device, client); err == nil {
-				err = verb.writeSingleFrame(flipImg(frame), formatOut(verb.Out, idx, multi))
+				err = verb.writeSingleFrame(flipImg(frame), formatOut(verb.Out, idx, names[idx], multi))
 			}
 			c <- err
 		}(idx, command)
@@ -112,15 +125,18 @@ func (verb *screenshotVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	return nil
 }
 
-func formatOut(out string, idx int, multi bool) string {
+// formatOut returns the output file of the idx'th screenshot, either out
+// formatted with idx, or out suffixed with name if there are several
+// screenshots.
+func formatOut(out string, idx int, name string, multi bool) string {
 	if strings.Contains(out, "%d") {
 		return fmt.Sprintf(out, idx)
 	} else if !multi {
 		return out
 	} else if p := strings.LastIndex(out, "."); p != -1 {
-		return fmt.Sprintf("%s_%d%s", out[:p], idx, out[p:])
+		return fmt.Sprintf("%s_%s%s", out[:p], name, out[p:])
 	}
-	return fmt.Sprintf("%s_%d", out, idx)
+	return fmt.Sprintf("%s_%s", out, name)
 
 }
 
@@ -0,0 +1,324 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/app/flags"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/client"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type shellVerb struct{ ShellFlags }
+
+func init() {
+	verb := &shellVerb{}
+	app.AddVerb(&app.Verb{
+		Name:      "shell",
+		ShortHelp: "Loads a .gfxtrace file and runs the commands typed at a prompt against it",
+		Action:    verb,
+	})
+}
+
+func (verb *shellVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	s, err := newSession(ctx, verb.Gapis, verb.Gapir, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer s.client.Close()
+
+	fmt.Fprintln(s.out, "Type 'help' for the list of commands.")
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Fprintf(s.out, "(gapit %v) ", dottedIndices(s.at.Indices))
+		if !in.Scan() {
+			fmt.Fprintln(s.out)
+			return in.Err()
+		}
+		quit, err := s.execute(ctx, in.Text())
+		if err != nil {
+			fmt.Fprintf(s.out, "Error: %v\n", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// session is a gapis session on a loaded capture, in which the commands of the
+// shell are run. The commands are relative to the current command of the
+// session, which is initially the last command of the capture.
+type session struct {
+	client  client.Client
+	capture *path.Capture
+	gapir   GapirFlags
+	at      *path.Command
+	out     io.Writer
+	// The variables substituted as $NAME or ${NAME} in the command lines.
+	vars map[string]string
+	// The replay device and the ends of the frames, resolved when first
+	// needed.
+	device *path.Device
+	frames []*service.Event
+}
+
+func newSession(ctx context.Context, gapis GapisFlags, gapir GapirFlags, capture string, captureFlags CaptureFileFlags) (*session, error) {
+	client, c, err := getGapisAndLoadCapture(ctx, gapis, gapir, capture, captureFlags)
+	if err != nil {
+		return nil, err
+	}
+	boxedCapture, err := client.Get(ctx, c.Path(), nil)
+	if err != nil {
+		client.Close()
+		return nil, log.Err(ctx, err, "Failed to load the capture")
+	}
+	return &session{
+		client:  client,
+		capture: c,
+		gapir:   gapir,
+		at:      c.Command(uint64(boxedCapture.(*service.Capture).NumCommands) - 1),
+		out:     os.Stdout,
+		vars:    map[string]string{},
+	}, nil
+}
+
+// sessionCommand is a command of the session.
+type sessionCommand struct {
+	name string
+	args string
+	help string
+	run  func(s *session, ctx context.Context, args []string) error
+}
+
+var sessionCommands []sessionCommand
+
+func init() {
+	sessionCommands = []sessionCommand{
+		{"help", "", "print this list of commands", (*session).help},
+		{"info", "", "print the capture and the current command", (*session).info},
+		{"goto", "frame N | N[.M...]", "make the last command of the frame, or the command, current", (*session).gotoCommand},
+		{"command", "", "print the current command", (*session).command},
+		{"screenshot", "FILE [ATTACHMENT]", "write the framebuffer attachment after the current command as a PNG", (*session).screenshot},
+		{"deps", "[reverse]", "print the dependencies, or the dependents, of the current command", (*session).deps},
+		{"state", "[NAME...]", "print the state after the current command, filtered to the path of node names", (*session).state},
+		{"set", "NAME [VALUE...]", "set the variable substituted as $NAME or ${NAME} in the next commands", (*session).set},
+		{"quit", "", "end the session", nil},
+	}
+}
+
+// execute substitutes the variables of the command line, then runs it in the
+// session. It returns true if the line ends the session.
+func (s *session) execute(ctx context.Context, line string) (bool, error) {
+	if strings.HasPrefix(strings.TrimSpace(line), "#") {
+		return false, nil
+	}
+	undefined := []string{}
+	line = os.Expand(line, func(name string) string {
+		v, ok := s.vars[name]
+		if !ok {
+			undefined = append(undefined, name)
+		}
+		return v
+	})
+	if len(undefined) > 0 {
+		return false, fmt.Errorf("Undefined variables: %v", strings.Join(undefined, ", "))
+	}
+
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return false, nil
+	}
+	for _, c := range sessionCommands {
+		if c.name != args[0] {
+			continue
+		}
+		if c.run == nil {
+			return true, nil
+		}
+		return false, c.run(s, ctx, args[1:])
+	}
+	if args[0] == "exit" {
+		return true, nil
+	}
+	return false, fmt.Errorf("Unknown command %q, type 'help' for the list of commands", args[0])
+}
+
+func (s *session) help(ctx context.Context, args []string) error {
+	for _, c := range sessionCommands {
+		fmt.Fprintf(s.out, "  %-30s %s\n", strings.TrimSpace(c.name+" "+c.args), c.help)
+	}
+	return nil
+}
+
+func (s *session) info(ctx context.Context, args []string) error {
+	boxedCapture, err := s.client.Get(ctx, s.capture.Path(), nil)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to load the capture")
+	}
+	c := boxedCapture.(*service.Capture)
+	fmt.Fprintf(s.out, "Capture: %v (%v)\n", c.Name, s.capture.ID.ID())
+	fmt.Fprintf(s.out, "Commands: %v\n", c.NumCommands)
+	if frames, err := s.getFrames(ctx); err == nil {
+		fmt.Fprintf(s.out, "Frames: %v\n", len(frames))
+	}
+	return s.command(ctx, nil)
+}
+
+func (s *session) gotoCommand(ctx context.Context, args []string) error {
+	switch {
+	case len(args) == 2 && args[0] == "frame":
+		frame, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("Invalid frame %q", args[1])
+		}
+		frames, err := s.getFrames(ctx)
+		if err != nil {
+			return err
+		}
+		if frame < 0 || frame >= len(frames) {
+			return fmt.Errorf("Frame %d is out of range, the capture has %d frames", frame, len(frames))
+		}
+		s.at = s.capture.Command(frames[frame].Command.Indices[0], frames[frame].Command.Indices[1:]...)
+	case len(args) == 1:
+		indices := CommandIndices{}
+		if err := indices.Set(args[0]); err != nil || len(indices) != 1 {
+			return fmt.Errorf("Invalid command index %q", args[0])
+		}
+		at := s.capture.Command(indices[0][0], indices[0][1:]...)
+		if _, err := s.client.Get(ctx, at.Path(), nil); err != nil {
+			return log.Errf(ctx, err, "Invalid command %v", args[0])
+		}
+		s.at = at
+	default:
+		return fmt.Errorf("Usage: goto frame N | goto N[.M...]")
+	}
+	return s.command(ctx, nil)
+}
+
+func (s *session) command(ctx context.Context, args []string) error {
+	return getAndPrintCommand(ctx, s.client, s.at, ObservationFlags{})
+}
+
+func (s *session) screenshot(ctx context.Context, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("Usage: screenshot FILE [ATTACHMENT]")
+	}
+	device, err := s.getDevice(ctx)
+	if err != nil {
+		return err
+	}
+	verb := &screenshotVerb{}
+	if len(args) == 2 {
+		verb.Attachment = args[1]
+	}
+	frame, err := verb.getSingleFrame(ctx, s.at, device, s.client)
+	if err != nil {
+		return err
+	}
+	if err := verb.writeSingleFrame(flipImg(frame), args[0]); err != nil {
+		return log.Errf(ctx, err, "Writing file: %v", args[0])
+	}
+	fmt.Fprintf(s.out, "Screenshot written to %v\n", args[0])
+	return nil
+}
+
+func (s *session) deps(ctx context.Context, args []string) error {
+	t := &depsTree{
+		client: s.client,
+		next:   s.client.GetDependencies,
+		seen:   map[string]bool{},
+		out:    s.out,
+	}
+	if len(args) == 1 && args[0] == "reverse" {
+		t.next = s.client.GetDependents
+	} else if len(args) != 0 {
+		return fmt.Errorf("Usage: deps [reverse]")
+	}
+	return t.print(ctx, s.at, "", "", 0)
+}
+
+func (s *session) state(ctx context.Context, args []string) error {
+	boxedTree, err := s.client.Get(ctx, s.at.StateAfter().Tree().Path(), nil)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to load the state tree")
+	}
+	tree := boxedTree.(*service.StateTree)
+
+	// Without a filter, only the first level of the state is printed.
+	depth := 1
+	if len(args) > 0 {
+		depth = len(args)
+	}
+	return traverseStateTree(ctx, s.client, tree.Root, depth, flags.StringSlice(args), func(n *service.StateTreeNode, prefix string) error {
+		if n.Preview != nil {
+			fmt.Fprintln(s.out, prefix, n.Name+":", n.Preview.Get())
+		} else {
+			fmt.Fprintln(s.out, prefix, n.Name+":")
+		}
+		return nil
+	}, "", true)
+}
+
+func (s *session) set(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("Usage: set NAME [VALUE...]")
+	}
+	s.vars[args[0]] = strings.Join(args[1:], " ")
+	return nil
+}
+
+func (s *session) getDevice(ctx context.Context) (*path.Device, error) {
+	if s.device == nil {
+		device, err := getDevice(ctx, s.client, s.capture, s.gapir)
+		if err != nil {
+			return nil, err
+		}
+		if device == nil {
+			return nil, fmt.Errorf("A replay device is required")
+		}
+		s.device = device
+	}
+	return s.device, nil
+}
+
+func (s *session) getFrames(ctx context.Context) ([]*service.Event, error) {
+	if s.frames == nil {
+		frames, err := getEvents(ctx, s.client, &path.Events{
+			Capture:     s.capture,
+			LastInFrame: true,
+		})
+		if err != nil {
+			return nil, log.Err(ctx, err, "Couldn't get frame events")
+		}
+		s.frames = frames
+	}
+	return s.frames, nil
+}
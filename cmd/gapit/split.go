@@ -0,0 +1,115 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type splitVerb struct{ SplitFlags }
+
+func init() {
+	verb := &splitVerb{}
+	verb.Frames = 1
+
+	app.AddVerb(&app.Verb{
+		Name:      "split",
+		ShortHelp: "Splits a gfx trace into captures of N frames each, restoring the state before them",
+		Action:    verb,
+	})
+}
+
+func (verb *splitVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+	if verb.Frames <= 0 {
+		app.Usage(ctx, "The number of frames per capture must be positive, got %d", verb.Frames)
+		return nil
+	}
+
+	client, capture, err := getGapisAndLoadCapture(ctx, verb.Gapis, verb.Gapir, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	filter, err := verb.CommandFilterFlags.commandFilter(ctx, client, capture)
+	if err != nil {
+		return log.Err(ctx, err, "Couldn't get filter")
+	}
+	eofEvents, err := getEvents(ctx, client, &path.Events{
+		Capture:     capture,
+		LastInFrame: true,
+		Filter:      filter,
+	})
+	if err != nil {
+		return log.Err(ctx, err, "Couldn't get frame events")
+	}
+	if len(eofEvents) == 0 {
+		return fmt.Errorf("The capture contains no frames")
+	}
+
+	if verb.OutDir != "" {
+		if err := os.MkdirAll(verb.OutDir, 0755); err != nil {
+			return log.Errf(ctx, err, "Creating directory: %v", verb.OutDir)
+		}
+	}
+	base := strings.TrimSuffix(filepath.Base(flags.Arg(0)), filepath.Ext(flags.Arg(0)))
+
+	for first := 0; first < len(eofEvents); first += verb.Frames {
+		last := first + verb.Frames - 1
+		if last >= len(eofEvents) {
+			last = len(eofEvents) - 1
+		}
+		from := capture.Command(0)
+		if first > 0 {
+			from = capture.Command(eofEvents[first-1].Command.Indices[0] + 1)
+		}
+		to := capture.Command(eofEvents[last].Command.Indices[0])
+
+		trimmed, err := client.TrimCapture(ctx, capture, from, to, nil)
+		if err != nil {
+			return log.Errf(ctx, err, "TrimCapture(%v, %v, %v)", capture, from, to)
+		}
+		data, err := client.ExportCapture(ctx, trimmed)
+		if err != nil {
+			return log.Errf(ctx, err, "ExportCapture(%v)", trimmed)
+		}
+
+		name := fmt.Sprintf("%s_frame%04d.gfxtrace", base, first)
+		if verb.Frames > 1 {
+			name = fmt.Sprintf("%s_frames%04d-%04d.gfxtrace", base, first, last)
+		}
+		output := filepath.Join(verb.OutDir, name)
+		if err := ioutil.WriteFile(output, data, 0666); err != nil {
+			return log.Errf(ctx, err, "Writing file: %v", output)
+		}
+		fmt.Printf("Frames %d..%d (commands %v..%v) written to %v\n",
+			first, last, from.Indices[0], to.Indices[0], output)
+	}
+	return nil
+}
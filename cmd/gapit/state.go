@@ -16,8 +16,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/google/gapid/core/app"
@@ -74,6 +76,28 @@ func (verb *stateVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 
 	tree := boxedTree.(*service.StateTree)
 
+	if verb.JSON {
+		var out io.Writer = os.Stdout
+		if verb.Out != "" {
+			f, err := os.OpenFile(verb.Out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+			if err != nil {
+				return log.Err(ctx, err, "Failed to open the output file")
+			}
+			defer f.Close()
+			out = f
+		}
+		_, v, _, err := stateTreeJSON(ctx, client, tree.Root, verb.Depth, verb.Filter)
+		if err != nil {
+			return err
+		}
+		e := json.NewEncoder(out)
+		e.SetIndent("", "  ")
+		if err := e.Encode(v); err != nil {
+			return log.Err(ctx, err, "Failed to write the state")
+		}
+		return nil
+	}
+
 	return traverseStateTree(ctx, client, tree.Root, verb.Depth, verb.Filter, func(n *service.StateTreeNode, prefix string) error {
 		name := n.Name + ":"
 		if n.Preview != nil {
@@ -93,6 +117,66 @@ func (verb *stateVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	}, "", true)
 }
 
+// stateTreeJSON returns the name of the state tree node and the node as a
+// value to encode as JSON: an object of the children by name, or the value of
+// the node if it has no children or is deeper than depth. The filter is
+// applied as in traverseStateTree, and false is returned if the node is
+// filtered out.
+func stateTreeJSON(
+	ctx context.Context,
+	c client.Client,
+	p *path.StateTreeNode,
+	depth int,
+	filter flags.StringSlice) (string, interface{}, bool, error) {
+
+	if task.Stopped(ctx) {
+		return "", nil, false, task.StopReason(ctx)
+	}
+
+	boxedNode, err := c.Get(ctx, p.Path(), nil)
+	if err != nil {
+		return "", nil, false, log.Errf(ctx, err, "Failed to load the node at: %v", p)
+	}
+
+	n := boxedNode.(*service.StateTreeNode)
+
+	nextFilter := filter
+	if len(filter) != 0 &&
+		(filter[0] != n.Name && filter[0] != "*") {
+		return "", nil, false, nil
+	}
+	if len(filter) != 0 {
+		nextFilter = filter[1:]
+	}
+
+	if n.NumChildren == 0 || depth == 0 {
+		if n.Preview == nil {
+			return n.Name, nil, true, nil
+		}
+		v := n.Preview.Get()
+		if n.Constants != nil {
+			constants, err := getConstantSet(ctx, c, n.Constants)
+			if err != nil {
+				return "", nil, false, log.Err(ctx, err, "Couldn't fetch constant set")
+			}
+			v = constants.Sprint(v)
+		}
+		return n.Name, v, true, nil
+	}
+
+	children := map[string]interface{}{}
+	for i := uint64(0); i < n.NumChildren; i++ {
+		name, v, ok, err := stateTreeJSON(ctx, c, p.Index(i), depth-1, nextFilter)
+		if err != nil {
+			return "", nil, false, err
+		}
+		if ok {
+			children[name] = v
+		}
+	}
+	return n.Name, children, true, nil
+}
+
 func traverseStateTree(
 	ctx context.Context,
 	c client.Client,
@@ -16,6 +16,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"math"
@@ -90,16 +91,35 @@ func (verb *infoVerb) getEventsInRange(ctx context.Context, client service.Servi
 	return events[begin:end], nil
 }
 
-func (verb *infoVerb) drawCallStats(ctx context.Context, client client.Client, c *path.Capture) (int, sint.HistogramStats, error) {
+// captureStats is the summary of a capture printed in JSON.
+type captureStats struct {
+	Commands                int                       `json:"commands"`
+	Frames                  int                       `json:"frames"`
+	Draws                   int                       `json:"draws"`
+	Dispatches              int                       `json:"dispatches"`
+	FramebufferObservations int                       `json:"framebufferObservations"`
+	CommandsPerFrame        []int                     `json:"commandsPerFrame"`
+	DrawsPerFrame           []uint64                  `json:"drawsPerFrame"`
+	DispatchesPerFrame      []uint64                  `json:"dispatchesPerFrame"`
+	Breakdown               *service.CaptureBreakdown `json:"breakdown,omitempty"`
+}
+
+// perFrameStats returns the draw calls and the compute dispatches of each of
+// the requested frames.
+func (verb *infoVerb) perFrameStats(ctx context.Context, client client.Client, c *path.Capture) ([]uint64, []uint64, error) {
 	boxedVal, err := client.Get(ctx, (&path.Stats{
 		Capture:  c,
 		DrawCall: true,
 	}).Path(), nil)
 	if err != nil {
-		return 0, sint.HistogramStats{}, err
+		return nil, nil, err
 	}
-	data := boxedVal.(*service.Stats).DrawCalls
+	stats := boxedVal.(*service.Stats)
+	return verb.framesInRange(stats.DrawCalls), verb.framesInRange(stats.DispatchCalls), nil
+}
 
+// framesInRange returns the values of the requested frames.
+func (verb *infoVerb) framesInRange(data []uint64) []uint64 {
 	if verb.Frames.Start < len(data) {
 		data = data[verb.Frames.Start:]
 	} else {
@@ -108,14 +128,18 @@ func (verb *infoVerb) drawCallStats(ctx context.Context, client client.Client, c
 	if verb.Frames.Count >= 0 && verb.Frames.Count < len(data) {
 		data = data[:verb.Frames.Count]
 	}
+	return data
+}
 
+// histogramStats returns the total and the statistics of the values per frame.
+func histogramStats(data []uint64) (int, sint.HistogramStats) {
 	hist := make(sint.Histogram, len(data))
-	totalDraws := 0
+	total := 0
 	for i, dat := range data {
-		totalDraws += int(dat)
+		total += int(dat)
 		hist[i] = int(dat)
 	}
-	return totalDraws, hist.Stats(), nil
+	return total, hist.Stats()
 }
 
 func (verb *infoVerb) Run(ctx context.Context, flags flag.FlagSet) error {
@@ -150,15 +174,44 @@ func (verb *infoVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		}
 	}
 	callStats := cmdsPerFrame.Stats()
-	totalDraws, drawStats, err := verb.drawCallStats(ctx, client, capture)
+	draws, dispatches, err := verb.perFrameStats(ctx, client, capture)
 	if err != nil {
 		return err
 	}
+	totalDraws, drawStats := histogramStats(draws)
+	totalDispatches, dispatchStats := histogramStats(dispatches)
+
+	var breakdown *service.CaptureBreakdown
+	if verb.Breakdown {
+		if breakdown, err = verb.getBreakdown(ctx, client, capture); err != nil {
+			return err
+		}
+	}
+
+	if verb.Format == JsonStats {
+		out, err := json.MarshalIndent(&captureStats{
+			Commands:                counts[service.EventKind_AllCommands],
+			Frames:                  counts[service.EventKind_FirstInFrame],
+			Draws:                   totalDraws,
+			Dispatches:              totalDispatches,
+			FramebufferObservations: counts[service.EventKind_FramebufferObservation],
+			CommandsPerFrame:        cmdsPerFrame,
+			DrawsPerFrame:           draws,
+			DispatchesPerFrame:      dispatches,
+			Breakdown:               breakdown,
+		}, "", "  ")
+		if err != nil {
+			return log.Err(ctx, err, "Failed to marshal the stats to JSON")
+		}
+		fmt.Println(string(out))
+		return nil
+	}
 
 	w := tabwriter.NewWriter(os.Stdout, 4, 4, 0, ' ', 0)
 	fmt.Fprintf(w, "Commands: \t%v\n", counts[service.EventKind_AllCommands])
 	fmt.Fprintf(w, "Frames: \t%v\n", counts[service.EventKind_FirstInFrame])
 	fmt.Fprintf(w, "Draws: \t%v\n", totalDraws)
+	fmt.Fprintf(w, "Dispatches: \t%v\n", totalDispatches)
 	fmt.Fprintf(w, "FBO: \t%v\n", counts[service.EventKind_FramebufferObservation])
 
 	fmt.Fprintf(w, "Avg commands per frame: \t%.2f\n", callStats.Average)
@@ -168,7 +221,47 @@ func (verb *infoVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	fmt.Fprintf(w, "Avg draw calls per frame: \t%.2f\n", drawStats.Average)
 	fmt.Fprintf(w, "Stddev draw calls per frame: \t%.2f\n", drawStats.Stddev)
 	fmt.Fprintf(w, "Median draw calls per frame: \t%v\n", drawStats.Median)
+
+	fmt.Fprintf(w, "Avg dispatches per frame: \t%.2f\n", dispatchStats.Average)
+	fmt.Fprintf(w, "Stddev dispatches per frame: \t%.2f\n", dispatchStats.Stddev)
+	fmt.Fprintf(w, "Median dispatches per frame: \t%v\n", dispatchStats.Median)
 	w.Flush()
 
+	if breakdown != nil {
+		return printBreakdown(breakdown)
+	}
 	return nil
 }
+
+func (verb *infoVerb) getBreakdown(ctx context.Context, client client.Client, c *path.Capture) (*service.CaptureBreakdown, error) {
+	boxedVal, err := client.Get(ctx, (&path.Stats{
+		Capture:   c,
+		Breakdown: true,
+	}).Path(), nil)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Couldn't get the capture breakdown")
+	}
+	return boxedVal.(*service.Stats).Breakdown, nil
+}
+
+func printBreakdown(breakdown *service.CaptureBreakdown) error {
+	w := tabwriter.NewWriter(os.Stdout, 4, 4, 0, ' ', 0)
+	fmt.Fprintf(w, "Observed memory: \t%v bytes\n", breakdown.ObservedMemory)
+	fmt.Fprintf(w, "Memory observations: \t%v\n", breakdown.Observations)
+	fmt.Fprintf(w, "Initial state memory: \t%v bytes\n", breakdown.InitialStateMemory)
+	fmt.Fprintf(w, "Allocated device memory: \t%v bytes\n", breakdown.AllocatedDeviceMemory)
+	fmt.Fprintf(w, "Shader modules: \t%v\n", breakdown.ShaderModules)
+	fmt.Fprintf(w, "Pipelines: \t%v\n", breakdown.Pipelines)
+	fmt.Fprintf(w, "Command buffers: \t%v\n", breakdown.CommandBuffers)
+	fmt.Fprintf(w, "Avg commands per command buffer: \t%.2f\n", breakdown.AverageCommandBufferSize)
+
+	fmt.Fprintf(w, "\nCommands per type:\n")
+	for _, c := range breakdown.Commands {
+		fmt.Fprintf(w, "  %v: \t%v\n", c.Name, c.Count)
+	}
+	fmt.Fprintf(w, "\nDraws per render pass:\n")
+	for _, rp := range breakdown.RenderPasses {
+		fmt.Fprintf(w, "  %v: \t%v\n", rp.Begin.Indices, rp.Draws)
+	}
+	return w.Flush()
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -28,6 +29,7 @@ import (
 	"github.com/google/gapid/core/app/crash"
 	"github.com/google/gapid/core/event/task"
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android/adb"
 	"github.com/google/gapid/core/os/device"
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
@@ -47,6 +49,17 @@ func init() {
 }
 
 func (verb *traceVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	triggers := 0
+	for _, set := range []bool{verb.Start.Defer, verb.Start.After > 0, verb.Start.Marker != "", verb.Start.Intent != "", verb.Start.At.Frame > 0} {
+		if set {
+			triggers++
+		}
+	}
+	if triggers > 1 {
+		app.Usage(ctx, "Only one of -start-defer, -start-after, -start-marker, -start-intent and -start-at-frame may be given")
+		return nil
+	}
+
 	client, err := getGapis(ctx, verb.Gapis, GapirFlags{})
 	if err != nil {
 		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
@@ -175,10 +188,11 @@ func (verb *traceVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		ObserveFrameFrequency: uint32(verb.Observe.Frames),
 		ObserveDrawFrequency:  uint32(verb.Observe.Draws),
 		StartFrame:            uint32(verb.Start.At.Frame),
+		StartMarker:           verb.Start.Marker,
 		FramesToCapture:       uint32(verb.Capture.Frames),
 		DisablePcs:            verb.Disable.PCS,
 		RecordErrorState:      verb.Record.Errors,
-		DeferStart:            verb.Start.Defer,
+		DeferStart:            verb.Start.Defer || verb.Start.After > 0 || verb.Start.Intent != "",
 		NoBuffer:              verb.No.Buffer,
 		HideUnknownExtensions: verb.Disable.Unknown.Extensions,
 		RecordTraceTimes:      verb.Record.TraceTimes,
@@ -209,6 +223,21 @@ func (verb *traceVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		return fmt.Errorf("Unknown API %s", verb.API)
 	}
 
+	var intentDevice adb.Device
+	if verb.Start.Intent != "" {
+		dd, err := client.Get(ctx, traceDevice.Path(), nil)
+		if err != nil {
+			return err
+		}
+		d := dd.(*device.Instance)
+		if d.GetConfiguration().GetOS().GetKind() != device.OSKind_Android {
+			return fmt.Errorf("-start-intent is only valid for Android devices")
+		}
+		if intentDevice, err = getADBDevice(ctx, "^"+regexp.QuoteMeta(d.Serial)+"$"); err != nil {
+			return err
+		}
+	}
+
 	handler, err := client.Trace(ctx)
 	if err != nil {
 		return err
@@ -245,9 +274,22 @@ func (verb *traceVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 				crash.Go(func() {
 					reader := bufio.NewReader(os.Stdin)
 					if options.DeferStart {
-						println("Press enter to start capturing...")
-						_, _ = reader.ReadString('\n')
+						switch {
+						case verb.Start.After > 0:
+							println(fmt.Sprintf("Capturing will start in %v...", verb.Start.After))
+							time.Sleep(verb.Start.After)
+						case verb.Start.Intent != "":
+							println(fmt.Sprintf("Capturing will start when %v is broadcast...", verb.Start.Intent))
+							if err := waitForBroadcast(ctx, intentDevice, verb.Start.Intent); err != nil {
+								log.E(ctx, "Couldn't wait for the broadcast: %v", err)
+							}
+						default:
+							println("Press enter to start capturing...")
+							_, _ = reader.ReadString('\n')
+						}
 						_, _ = handler.Event(service.TraceEvent_Begin)
+					} else if options.StartMarker != "" {
+						println(fmt.Sprintf("Capturing will start after the debug marker %v...", options.StartMarker))
 					}
 					println("Press enter to stop capturing...")
 					_, _ = reader.ReadString('\n')
@@ -263,3 +305,48 @@ func (verb *traceVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		return false, nil
 	})
 }
+
+// broadcastDispatchRe matches the dispatch time of a broadcast in the summary
+// of the history of the broadcasts.
+var broadcastDispatchRe = regexp.MustCompile(`disp=(\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\.\d+)`)
+
+// waitForBroadcast waits until an intent with the action is broadcast on the
+// device, polling the history of the broadcasts.
+func waitForBroadcast(ctx context.Context, d adb.Device, action string) error {
+	// The dispatch time of the most recent broadcast of the action. The
+	// summary of the history lists the broadcasts of each queue, each with
+	// its action on the line of its index, followed by its enqueue, dispatch
+	// and finish times. The indices are shifted by any other broadcast, but the
+	// times sort in the order of the broadcasts.
+	last := func() (string, error) {
+		out, err := d.Shell("dumpsys", "activity", "broadcasts", "history").Call(ctx)
+		if err != nil {
+			return "", err
+		}
+		latest, matching := "", false
+		for _, line := range strings.Split(out, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "#") {
+				matching = false
+				for _, f := range strings.Fields(line) {
+					if f == "act="+action {
+						matching = true
+					}
+				}
+				continue
+			}
+			if m := broadcastDispatchRe.FindStringSubmatch(line); matching && m != nil && m[1] > latest {
+				latest = m[1]
+			}
+		}
+		return latest, nil
+	}
+
+	initial, err := last()
+	if err != nil {
+		return err
+	}
+	return task.Retry(ctx, 0, time.Second, func(ctx context.Context) (bool, error) {
+		current, err := last()
+		return err == nil && current > initial, err
+	})
+}
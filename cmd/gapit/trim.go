@@ -33,7 +33,7 @@ func init() {
 
 	app.AddVerb(&app.Verb{
 		Name:      "trim",
-		ShortHelp: "(WIP) Trims a gfx trace to the dependencies of the requested frames",
+		ShortHelp: "(WIP) Trims a gfx trace to the dependencies of the requested frames or commands",
 		Action:    verb,
 	})
 }
@@ -50,19 +50,45 @@ func (verb *trimVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	}
 	defer client.Close()
 
+	if verb.Range.Valid {
+		if verb.Frames.Start != 0 || verb.Frames.Count != allTheWay {
+			app.Usage(ctx, "The range of commands cannot be combined with the frames")
+			return nil
+		}
+		from, to, requested := verb.getRangeRequest(capture)
+		trimmed, err := client.TrimCapture(ctx, capture, from, to, requested)
+		if err != nil {
+			return log.Errf(ctx, err, "TrimCapture(%v, %v, %v, %v)", capture, from, to, requested)
+		}
+		return verb.write(ctx, client, trimmed)
+	}
+
 	eofEvents, err := verb.eofEvents(ctx, capture, client)
 	if err != nil {
 		return err
 	}
 
-	dceRequest := verb.getDCERequest(eofEvents, capture)
-	if len(dceRequest) > 0 {
-		capture, err = client.DCECapture(ctx, capture, dceRequest)
+	if verb.Footprint {
+		from, to := verb.getTrimRange(eofEvents, capture)
+		requested := verb.getDCERequest(eofEvents, capture)
+		trimmed, err := client.TrimCapture(ctx, capture, from, to, requested)
+		if err != nil {
+			return log.Errf(ctx, err, "TrimCapture(%v, %v, %v, %v)", capture, from, to, requested)
+		}
+		return verb.write(ctx, client, trimmed)
+	} else if dceRequest := verb.getDCERequest(eofEvents, capture); len(dceRequest) > 0 {
+		trimmed, err := client.DCECapture(ctx, capture, dceRequest)
 		if err != nil {
 			return log.Errf(ctx, err, "DCECapture(%v, %v)", capture, dceRequest)
 		}
+		return verb.write(ctx, client, trimmed)
 	}
 
+	return verb.write(ctx, client, capture)
+}
+
+// write exports the capture to the output file.
+func (verb *trimVerb) write(ctx context.Context, client service.Service, capture *path.Capture) error {
 	data, err := client.ExportCapture(ctx, capture)
 	if err != nil {
 		return log.Errf(ctx, err, "ExportCapture(%v)", capture)
@@ -89,11 +115,6 @@ func (verb *trimVerb) eofEvents(ctx context.Context, capture *path.Capture, clie
 		Filter:      filter,
 	}
 
-	if verb.Commands {
-		requestEvents.LastInFrame = false
-		requestEvents.AllCommands = true
-	}
-
 	// Get the end-of-frame events.
 	eofEvents, err := getEvents(ctx, client, &requestEvents)
 	if err != nil {
@@ -114,7 +135,7 @@ func (verb *trimVerb) eofEvents(ctx context.Context, capture *path.Capture, clie
 func (verb *trimVerb) getDCERequest(eofEvents []*service.Event, p *path.Capture) []*path.Command {
 	frameCount := verb.Frames.Count
 	if frameCount < 0 {
-		frameCount = len(eofEvents) - verb.Frames.Start + 1
+		frameCount = len(eofEvents) - verb.Frames.Start
 	}
 	dceRequest := make([]*path.Command, 0, frameCount+len(verb.ExtraCommands))
 	for i := 0; i < frameCount; i++ {
@@ -136,3 +157,46 @@ func (verb *trimVerb) getDCERequest(eofEvents []*service.Event, p *path.Capture)
 	}
 	return dceRequest
 }
+
+// getTrimRange returns the first and the last commands of the requested frames,
+// extended to include the extra commands.
+func (verb *trimVerb) getTrimRange(eofEvents []*service.Event, p *path.Capture) (*path.Command, *path.Command) {
+	lastFrame := len(eofEvents) - 1
+	if verb.Frames.Count > 0 {
+		lastFrame = verb.Frames.Start + verb.Frames.Count - 1
+	}
+	from := &path.Command{Capture: p, Indices: []uint64{0}}
+	if verb.Frames.Start > 0 {
+		from.Indices[0] = eofEvents[verb.Frames.Start-1].Command.Indices[0] + 1
+	}
+	to := &path.Command{Capture: p, Indices: []uint64{eofEvents[lastFrame].Command.Indices[0]}}
+	for _, id := range verb.ExtraCommands {
+		if id < from.Indices[0] {
+			from.Indices[0] = id
+		}
+		if id > to.Indices[0] {
+			to.Indices[0] = id
+		}
+	}
+	return from, to
+}
+
+// getRangeRequest returns the first and the last commands of the requested
+// range, extended to include the extra commands, and the commands to keep
+// with their dependencies: the last command of the range and the extra
+// commands.
+func (verb *trimVerb) getRangeRequest(p *path.Capture) (*path.Command, *path.Command, []*path.Command) {
+	from := &path.Command{Capture: p, Indices: []uint64{verb.Range.First}}
+	to := &path.Command{Capture: p, Indices: []uint64{verb.Range.Last}}
+	requested := []*path.Command{{Capture: p, Indices: []uint64{verb.Range.Last}}}
+	for _, id := range verb.ExtraCommands {
+		if id < from.Indices[0] {
+			from.Indices[0] = id
+		}
+		if id > to.Indices[0] {
+			to.Indices[0] = id
+		}
+		requested = append(requested, &path.Command{Capture: p, Indices: []uint64{id}})
+	}
+	return from, to, requested
+}
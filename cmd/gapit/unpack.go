@@ -15,9 +15,12 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -34,7 +37,7 @@ func init() {
 	verb := &unpackVerb{}
 	app.AddVerb(&app.Verb{
 		Name:      "unpack",
-		ShortHelp: "Displays the raw protos in a protopack file",
+		ShortHelp: "Displays the raw protos in a protopack file as text or JSON records",
 		Action:    verb,
 	})
 }
@@ -57,47 +60,137 @@ func (verb *unpackVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	}
 	defer r.Close()
 
-	return pack.Read(ctx, r, unpacker{verb.Verbose, map[uint64]int{}}, true)
+	var out io.Writer = os.Stdout
+	if verb.Out != "" {
+		f, err := os.OpenFile(verb.Out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to open the output file")
+		}
+		defer f.Close()
+		w := bufio.NewWriter(f)
+		defer w.Flush()
+		out = w
+	}
+
+	u := unpacker{
+		Verbose: verb.Verbose,
+		JSON:    verb.JSON,
+		DepthOf: map[uint64]int{},
+		out:     out,
+	}
+	return pack.Read(ctx, r, u, true)
 }
 
 type unpacker struct {
 	Verbose bool
+	JSON    bool
 	DepthOf map[uint64]int
+	out     io.Writer
+}
+
+// unpackRecord is a line of the JSON output of unpack.
+type unpackRecord struct {
+	Kind     string      `json:"kind"`
+	ID       *uint64     `json:"id,omitempty"`
+	ParentID *uint64     `json:"parentID,omitempty"`
+	Type     string      `json:"type,omitempty"`
+	Fields   interface{} `json:"fields,omitempty"`
 }
 
 func (u unpacker) BeginGroup(ctx context.Context, msg proto.Message, id uint64) error {
 	depth := 0
 	u.DepthOf[id] = depth
-	log.I(ctx, "%sBeginGroup(msg: %v, id: %v)", indent(depth), u.msgString(msg), id)
-	return nil
+	if u.JSON {
+		return u.record("BeginGroup", msg, &id, nil)
+	}
+	return u.printf("%sBeginGroup(msg: %v, id: %v)", indent(depth), u.msgString(msg), id)
 }
 func (u unpacker) BeginChildGroup(ctx context.Context, msg proto.Message, id, parentID uint64) error {
 	depth := u.DepthOf[parentID] + 1
 	u.DepthOf[id] = depth
-	log.I(ctx, "%sBeginChildGroup(msg: %v, id: %v, parentID: %v)", indent(depth), u.msgString(msg), id, parentID)
-	return nil
+	if u.JSON {
+		return u.record("BeginChildGroup", msg, &id, &parentID)
+	}
+	return u.printf("%sBeginChildGroup(msg: %v, id: %v, parentID: %v)", indent(depth), u.msgString(msg), id, parentID)
 }
 func (u unpacker) EndGroup(ctx context.Context, id uint64) error {
 	depth := u.DepthOf[id]
 	delete(u.DepthOf, id)
-	log.I(ctx, "%sEndGroup(id: %v)", indent(depth), id)
-	return nil
+	if u.JSON {
+		return u.record("EndGroup", nil, &id, nil)
+	}
+	return u.printf("%sEndGroup(id: %v)", indent(depth), id)
 }
 func (u unpacker) Object(ctx context.Context, msg proto.Message) error {
 	depth := 0
-	log.I(ctx, "%sObject(msg: %v)", indent(depth), u.msgString(msg))
-	return nil
+	if u.JSON {
+		return u.record("Object", msg, nil, nil)
+	}
+	return u.printf("%sObject(msg: %v)", indent(depth), u.msgString(msg))
 }
 func (u unpacker) ChildObject(ctx context.Context, msg proto.Message, parentID uint64) error {
 	depth := u.DepthOf[parentID] + 1
-	log.I(ctx, "%sChildObject(msg: %v, parentID: %v)", indent(depth), u.msgString(msg), parentID)
-	return nil
+	if u.JSON {
+		return u.record("ChildObject", msg, nil, &parentID)
+	}
+	return u.printf("%sChildObject(msg: %v, parentID: %v)", indent(depth), u.msgString(msg), parentID)
 }
 
 func indent(depth int) string {
 	return strings.Repeat("  ", depth)
 }
 
+func (u unpacker) printf(format string, args ...interface{}) error {
+	_, err := fmt.Fprintf(u.out, format+"\n", args...)
+	return err
+}
+
+// record writes a single line JSON record for the pack event.
+func (u unpacker) record(kind string, msg proto.Message, id, parentID *uint64) error {
+	r := unpackRecord{Kind: kind, ID: id, ParentID: parentID}
+	switch msg := msg.(type) {
+	case nil:
+	case *pack.Dynamic:
+		r.Type = msg.Desc.GetName()
+		r.Fields = u.jsonValue(msg)
+	default:
+		r.Type = proto.MessageName(msg)
+		r.Fields = msg
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(u.out, "%s\n", data)
+	return err
+}
+
+// jsonValue returns the value of a field of a dynamic message in a form that
+// can be marshaled to JSON. Byte fields are truncated unless verbose.
+func (u unpacker) jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *pack.Dynamic:
+		fields := make(map[string]interface{}, len(v.Fields))
+		for n, f := range v.Fields {
+			fields[n] = u.jsonValue(f)
+		}
+		return fields
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = u.jsonValue(e)
+		}
+		return out
+	case []byte:
+		if len(v) > 32 && !u.Verbose {
+			return fmt.Sprintf("%x (truncated %v bytes)", v[:32], len(v))
+		}
+		return v
+	default:
+		return v
+	}
+}
+
 func (u *unpacker) msgString(msg proto.Message) string {
 	var str string
 	switch msg := msg.(type) {
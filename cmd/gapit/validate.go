@@ -0,0 +1,146 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// replayDriverMsg is the identifier of the report messages of the issues
+// reported by the replay driver and its validation layers.
+const replayDriverMsg = "ERR_REPLAY_DRIVER"
+
+type validateVerb struct{ ValidateFlags }
+
+func init() {
+	verb := &validateVerb{}
+	app.AddVerb(&app.Verb{
+		Name:      "validate",
+		ShortHelp: "Replays a capture with the Vulkan validation layers and prints their messages",
+		Action:    verb,
+	})
+}
+
+// validationMessage is a message of the validation layers in the JSON output.
+type validationMessage struct {
+	Command  string `json:"command"`
+	Name     string `json:"name"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (verb *validateVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	client, capturePath, err := getGapisAndLoadCapture(ctx, verb.Gapis, verb.Gapir, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	stringTable, err := getStringTable(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	device, err := getDevice(ctx, client, capturePath, verb.Gapir)
+	if err != nil {
+		return err
+	}
+	if device == nil {
+		return log.Err(ctx, nil, "A replay device is required to run the validation layers")
+	}
+
+	// The replay of the report enables the validation layers and the debug
+	// report callbacks, whose messages are mapped to the capture commands.
+	reportPath := &path.Report{Capture: capturePath, Device: device}
+	boxedReport, err := client.Get(ctx, reportPath.Path(), nil)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to acquire the capture's report")
+	}
+	report := boxedReport.(*service.Report)
+
+	msgs := []validationMessage{}
+	names := map[uint64]string{}
+	for _, e := range report.Items {
+		msg := report.Msg(e.Message)
+		if msg.Identifier != replayDriverMsg || log.Severity(e.Severity) < verb.Severity {
+			continue
+		}
+		m := validationMessage{
+			Severity: e.Severity.String(),
+			Message:  msg.Text(stringTable),
+		}
+		if e.Command != nil {
+			m.Command = dottedIndices(e.Command.Indices)
+			idx := e.Command.Indices[0]
+			if _, ok := names[idx]; !ok {
+				cmd, err := getCommand(ctx, client, capturePath.Command(idx))
+				if err != nil {
+					return err
+				}
+				names[idx] = cmd.Name
+			}
+			m.Name = names[idx]
+		}
+		msgs = append(msgs, m)
+	}
+
+	var out io.Writer = os.Stdout
+	if verb.Out != "" {
+		f, err := os.OpenFile(verb.Out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to open the output file")
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if verb.JSON {
+		e := json.NewEncoder(out)
+		e.SetIndent("", "  ")
+		if err := e.Encode(msgs); err != nil {
+			return log.Err(ctx, err, "Failed to write the validation messages")
+		}
+		return nil
+	}
+
+	for _, m := range msgs {
+		where := ""
+		if m.Command != "" {
+			where = fmt.Sprintf("%v %v: ", m.Command, m.Name)
+		}
+		fmt.Fprintf(out, "[%s] %s%s\n", m.Severity, where, m.Message)
+	}
+	if len(msgs) == 0 {
+		fmt.Fprintln(out, "No validation messages")
+	} else {
+		fmt.Fprintf(out, "%d validation messages\n", len(msgs))
+	}
+	return nil
+}
@@ -25,6 +25,7 @@ import (
 	"image/png"
 	"io"
 	"os"
+	"sort"
 	"strings"
 	"sync/atomic"
 
@@ -56,6 +57,10 @@ func init() {
 	verb.Max.Width = 1920
 	verb.Max.Height = 1280
 	verb.FPS = 5
+	verb.Container = "mp4"
+	verb.Scale = 1
+	verb.Overlay.Frame = true
+	verb.Overlay.Command = true
 	verb.Frames.Count = allTheWay
 	verb.Frames.Minimum = 1
 	verb.NoOpt = false
@@ -102,6 +107,13 @@ func (verb *videoVerb) regularVideoSource(
 		return nil, log.Errf(ctx, nil, "Captured only %v frames, requires %v frames at minimum", len(eofEvents), verb.Frames.Minimum)
 	}
 
+	var gpuTimes map[uint64]uint64
+	if verb.Overlay.GpuTime {
+		if gpuTimes, err = frameGpuTimes(ctx, capture, client, device, eofEvents); err != nil {
+			return nil, err
+		}
+	}
+
 	if verb.Frames.Start < len(eofEvents) {
 		eofEvents = eofEvents[verb.Frames.Start:]
 	}
@@ -175,14 +187,27 @@ func (verb *videoVerb) regularVideoSource(
 				draw.Draw(frame, rect, src, image.ZP, draw.Src)
 			}
 
-			sb := new(bytes.Buffer)
-			refw := reflow.New(sb)
-			fmt.Fprint(refw, verb.Text)
-			fmt.Fprintf(refw, "Frame: %d, cmd: %v", i, eofEvents[i].Command.Indices)
-			refw.Flush()
-			str := sb.String()
-			font.DrawString(str, frame, image.Pt(4, 4), color.Black)
-			font.DrawString(str, frame, image.Pt(2, 2), color.White)
+			overlay := []string{}
+			if verb.Overlay.Frame {
+				overlay = append(overlay, fmt.Sprintf("Frame: %d", i))
+			}
+			if verb.Overlay.Command {
+				overlay = append(overlay, fmt.Sprintf("cmd: %v", eofEvents[i].Command.Indices))
+			}
+			if verb.Overlay.GpuTime {
+				ns := gpuTimes[eofEvents[i].Command.Indices[0]]
+				overlay = append(overlay, fmt.Sprintf("GPU: %.3fms", float64(ns)/1e6))
+			}
+			if verb.Text != "" || len(overlay) > 0 {
+				sb := new(bytes.Buffer)
+				refw := reflow.New(sb)
+				fmt.Fprint(refw, verb.Text)
+				fmt.Fprint(refw, strings.Join(overlay, ", "))
+				refw.Flush()
+				str := sb.String()
+				font.DrawString(str, frame, image.Pt(4, 4), color.Black)
+				font.DrawString(str, frame, image.Pt(2, 2), color.White)
+			}
 
 			frames <- frame
 		}
@@ -191,6 +216,32 @@ func (verb *videoVerb) regularVideoSource(
 	}, nil
 }
 
+// frameGpuTimes replays the capture to measure the GPU time of the command
+// buffers submitted for each of the frames ending with the events. The
+// returned map is keyed by the index of the last command of the frames.
+func frameGpuTimes(ctx context.Context, capture *path.Capture, client service.Service, device *path.Device, eofEvents []*service.Event) (map[uint64]uint64, error) {
+	if device == nil {
+		return nil, log.Errf(ctx, nil, "A replay device is required to measure the GPU time")
+	}
+	boxedRes, err := client.GetTimestamps(ctx, capture, device, &service.TimestampsOptions{})
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed to get the timestamps")
+	}
+	ends := make([]uint64, len(eofEvents))
+	for i, e := range eofEvents {
+		ends[i] = e.Command.Indices[0]
+	}
+	out := map[uint64]uint64{}
+	for _, t := range boxedRes.(*service.GetTimestampsResponse).GetTimestamps().GetTimestamps() {
+		submit := t.Begin.Indices[0]
+		i := sort.Search(len(ends), func(i int) bool { return ends[i] >= submit })
+		if i < len(ends) {
+			out[ends[i]] += t.TimeInNanoseconds
+		}
+	}
+	return out, nil
+}
+
 func (verb *videoVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	if flags.NArg() != 1 {
 		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
@@ -298,8 +349,16 @@ func (verb *videoVerb) writeSingleFrame(frame image.Image, fn string) error {
 }
 
 func (verb *videoVerb) encodeVideo(ctx context.Context, filepath string, vidFun videoFrameWriter) error {
+	if verb.Scale <= 0 {
+		return fmt.Errorf("Invalid scale %v, it must be positive", verb.Scale)
+	}
 	// Start an encoder
-	frames, video, err := video.Encode(ctx, video.Settings{FPS: verb.FPS})
+	frames, video, err := video.Encode(ctx, video.Settings{
+		FPS:    verb.FPS,
+		Codec:  verb.Codec,
+		Format: verb.Container,
+		Scale:  verb.Scale,
+	})
 	if err != nil {
 		return err
 	}
@@ -311,7 +370,7 @@ func (verb *videoVerb) encodeVideo(ctx context.Context, filepath string, vidFun
 	if out == "" && filepath == "" {
 		return fmt.Errorf("need output file argument")
 	} else if out == "" {
-		out = file.Abs(filepath).ChangeExt(".mp4").System()
+		out = file.Abs(filepath).ChangeExt("." + verb.Container).System()
 	}
 	mpg, err := os.Create(out)
 	if err != nil {
@@ -20,6 +20,8 @@ import (
 
 	"github.com/google/gapid/core/app/auth"
 	"github.com/google/gapid/core/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
 )
 
 func TestWrite(t *testing.T) {
@@ -52,6 +54,32 @@ func TestGenToken(t *testing.T) {
 	assert.For("length").That(len(token)).Equals(8)
 }
 
+func TestInterceptors(t *testing.T) {
+	assert := assert.To(t)
+	for _, test := range []struct {
+		name     string
+		client   auth.Token
+		server   auth.Token
+		expected error
+	}{
+		{"no-auth", auth.NoAuth, auth.NoAuth, nil},
+		{"no-server-auth", auth.Token("abc"), auth.NoAuth, nil},
+		{"same-token", auth.Token("abc"), auth.Token("abc"), nil},
+		{"other-token", auth.Token("xyz"), auth.Token("abc"), auth.ErrInvalidToken},
+		{"no-client-auth", auth.NoAuth, auth.Token("abc"), auth.ErrInvalidToken},
+	} {
+		server := auth.ServerInterceptor(test.server)
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			_, err := server(ctx, req, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, nil
+			})
+			return err
+		}
+		err := auth.ClientInterceptor(test.client)(context.Background(), "method", nil, nil, nil, invoker)
+		assert.For(test.name).ThatError(err).Equals(test.expected)
+	}
+}
+
 type readCloser struct {
 	*bytes.Buffer
 	closed bool
@@ -0,0 +1,699 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/google/gapid/core/data/binary"
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/math/f16"
+	"github.com/google/gapid/core/math/sint"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/core/stream"
+)
+
+var (
+	BC6H_RGB_UFLOAT   = NewBC6H_RGB_UFLOAT("BC6H_RGB_UFLOAT")
+	BC6H_RGB_SFLOAT   = NewBC6H_RGB_SFLOAT("BC6H_RGB_SFLOAT")
+	BC7_RGBA_U8_NORM  = NewBC7_RGBA_U8_NORM("BC7_RGBA_U8_NORM")
+	BC7_SRGBA_U8_NORM = NewBC7_SRGBA_U8_NORM("BC7_SRGBA_U8_NORM")
+)
+
+func init() {
+	RegisterConverter(BC7_RGBA_U8_NORM, RGBA_U8_NORM, func(src []byte, w, h, d int) ([]byte, error) {
+		return decode4x4Blocks(src, w, h, d, decodeBC7)
+	})
+	RegisterConverter(BC7_SRGBA_U8_NORM, SRGBA_U8_NORM, func(src []byte, w, h, d int) ([]byte, error) {
+		return decode4x4Blocks(src, w, h, d, decodeBC7)
+	})
+	RegisterConverter(BC7_SRGBA_U8_NORM, RGBA_U8_NORM, func(src []byte, w, h, d int) ([]byte, error) {
+		rgba, err := Convert(src, w, h, d, BC7_SRGBA_U8_NORM, SRGBA_U8_NORM)
+		if err != nil {
+			return nil, err
+		}
+		return Convert(rgba, w, h, d, SRGBA_U8_NORM, RGBA_U8_NORM)
+	})
+
+	for _, f := range []*Format{BC6H_RGB_UFLOAT, BC6H_RGB_SFLOAT} {
+		f, signed := f, f.GetBc6HRgbSfloat() != nil
+		RegisterConverter(f, RGBA_F32, func(src []byte, w, h, d int) ([]byte, error) {
+			return decodeBC6H(src, w, h, d, signed)
+		})
+		// Thumbnails and the other 8 bit views clamp the HDR colors.
+		RegisterConverter(f, RGBA_U8_NORM, func(src []byte, w, h, d int) ([]byte, error) {
+			rgba, err := decodeBC6H(src, w, h, d, signed)
+			if err != nil {
+				return nil, err
+			}
+			return Convert(rgba, w, h, d, RGBA_F32, RGBA_U8_NORM)
+		})
+	}
+}
+
+// NewBC6H_RGB_UFLOAT returns a format representing the unsigned BC6H (BPTC
+// float) block texture compression format.
+func NewBC6H_RGB_UFLOAT(name string) *Format {
+	return &Format{Name: name, Format: &Format_Bc6HRgbUfloat{&FmtBC6H_RGB_UFLOAT{}}}
+}
+
+func (f *FmtBC6H_RGB_UFLOAT) key() interface{} {
+	return "BC6H_RGB_UFLOAT"
+}
+func (*FmtBC6H_RGB_UFLOAT) size(w, h, d int) int {
+	return d * (sint.Max(sint.AlignUp(w, 4), 4) * sint.Max(sint.AlignUp(h, 4), 4))
+}
+func (f *FmtBC6H_RGB_UFLOAT) check(data []byte, w, h, d int) error {
+	return checkSize(data, f, w, h, d)
+}
+func (*FmtBC6H_RGB_UFLOAT) channels() stream.Channels {
+	return stream.Channels{stream.Channel_Red, stream.Channel_Green, stream.Channel_Blue}
+}
+
+// NewBC6H_RGB_SFLOAT returns a format representing the signed BC6H (BPTC
+// float) block texture compression format.
+func NewBC6H_RGB_SFLOAT(name string) *Format {
+	return &Format{Name: name, Format: &Format_Bc6HRgbSfloat{&FmtBC6H_RGB_SFLOAT{}}}
+}
+
+func (f *FmtBC6H_RGB_SFLOAT) key() interface{} {
+	return "BC6H_RGB_SFLOAT"
+}
+func (*FmtBC6H_RGB_SFLOAT) size(w, h, d int) int {
+	return d * (sint.Max(sint.AlignUp(w, 4), 4) * sint.Max(sint.AlignUp(h, 4), 4))
+}
+func (f *FmtBC6H_RGB_SFLOAT) check(data []byte, w, h, d int) error {
+	return checkSize(data, f, w, h, d)
+}
+func (*FmtBC6H_RGB_SFLOAT) channels() stream.Channels {
+	return stream.Channels{stream.Channel_Red, stream.Channel_Green, stream.Channel_Blue}
+}
+
+// NewBC7_RGBA_U8_NORM returns a format representing the BC7 (BPTC unorm)
+// block texture compression format.
+func NewBC7_RGBA_U8_NORM(name string) *Format {
+	return &Format{Name: name, Format: &Format_Bc7RgbaU8Norm{&FmtBC7_RGBA_U8_NORM{}}}
+}
+
+// NewBC7_SRGBA_U8_NORM returns a format representing the sRGB BC7 (BPTC
+// unorm) block texture compression format.
+func NewBC7_SRGBA_U8_NORM(name string) *Format {
+	return &Format{Name: name, Format: &Format_Bc7RgbaU8Norm{&FmtBC7_RGBA_U8_NORM{Srgb: true}}}
+}
+
+func (f *FmtBC7_RGBA_U8_NORM) key() interface{} {
+	if f.Srgb {
+		return "BC7_SRGBA_U8_NORM"
+	}
+	return "BC7_RGBA_U8_NORM"
+}
+func (*FmtBC7_RGBA_U8_NORM) size(w, h, d int) int {
+	return d * (sint.Max(sint.AlignUp(w, 4), 4) * sint.Max(sint.AlignUp(h, 4), 4))
+}
+func (f *FmtBC7_RGBA_U8_NORM) check(data []byte, w, h, d int) error {
+	return checkSize(data, f, w, h, d)
+}
+func (*FmtBC7_RGBA_U8_NORM) channels() stream.Channels {
+	return stream.Channels{stream.Channel_Red, stream.Channel_Green, stream.Channel_Blue, stream.Channel_Alpha}
+}
+
+// bptcBits reads the bits of a 128 bit BPTC block, starting from the least
+// significant bit of the first byte.
+type bptcBits struct {
+	lo, hi uint64
+	pos    uint
+}
+
+func readBPTCBits(r binary.Reader) *bptcBits {
+	lo := r.Uint64()
+	hi := r.Uint64()
+	return &bptcBits{lo: lo, hi: hi}
+}
+
+// read returns the next n bits, n <= 32.
+func (b *bptcBits) read(n uint) int {
+	if n == 0 {
+		return 0
+	}
+	var v uint64
+	switch {
+	case b.pos >= 64:
+		v = b.hi >> (b.pos - 64)
+	case b.pos+n <= 64:
+		v = b.lo >> b.pos
+	default:
+		v = (b.lo >> b.pos) | (b.hi << (64 - b.pos))
+	}
+	b.pos += n
+	return int(v & (1<<n - 1))
+}
+
+// readReversed returns the next n bits, with the first bit read being the
+// most significant bit of the result.
+func (b *bptcBits) readReversed(n uint) int {
+	v := 0
+	for i := uint(0); i < n; i++ {
+		v = v<<1 | b.read(1)
+	}
+	return v
+}
+
+// The interpolation weights of the 2, 3 and 4 bit indices.
+var bptcWeights = [5][]int{
+	2: {0, 21, 43, 64},
+	3: {0, 9, 18, 27, 37, 46, 55, 64},
+	4: {0, 4, 9, 13, 17, 21, 26, 30, 34, 38, 43, 47, 51, 55, 60, 64},
+}
+
+func bptcInterpolate(e0, e1 int, index, indexBits uint) int {
+	w := bptcWeights[indexBits][index]
+	return ((64-w)*e0 + w*e1 + 32) >> 6
+}
+
+// bptcPartitions2 holds the 2 subset partitions, with a bit set for each pixel
+// in the second subset.
+var bptcPartitions2 = [64]uint16{
+	0xcccc, 0x8888, 0xeeee, 0xecc8, 0xc880, 0xfeec, 0xfec8, 0xec80,
+	0xc800, 0xffec, 0xfe80, 0xe800, 0xffe8, 0xff00, 0xfff0, 0xf000,
+	0xf710, 0x008e, 0x7100, 0x08ce, 0x008c, 0x7310, 0x3100, 0x8cce,
+	0x088c, 0x3110, 0x6666, 0x366c, 0x17e8, 0x0ff0, 0x718e, 0x399c,
+	0xaaaa, 0xf0f0, 0x5a5a, 0x33cc, 0x3c3c, 0x55aa, 0x9696, 0xa55a,
+	0x73ce, 0x13c8, 0x324c, 0x3bdc, 0x6996, 0xc33c, 0x9966, 0x0660,
+	0x0272, 0x04e4, 0x4e40, 0x2720, 0xc936, 0x936c, 0x39c6, 0x639c,
+	0x9336, 0x9cc6, 0x817e, 0xe718, 0xccf0, 0x0fcc, 0x7744, 0xee22,
+}
+
+// bptcPartitions3 holds the subset of each pixel of the 3 subset partitions.
+var bptcPartitions3 = [64][16]uint8{
+	{0, 0, 1, 1, 0, 0, 1, 1, 0, 2, 2, 1, 2, 2, 2, 2},
+	{0, 0, 0, 1, 0, 0, 1, 1, 2, 2, 1, 1, 2, 2, 2, 1},
+	{0, 0, 0, 0, 2, 0, 0, 1, 2, 2, 1, 1, 2, 2, 1, 1},
+	{0, 2, 2, 2, 0, 0, 2, 2, 0, 0, 1, 1, 0, 1, 1, 1},
+	{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 2, 2, 1, 1, 2, 2},
+	{0, 0, 1, 1, 0, 0, 1, 1, 0, 0, 2, 2, 0, 0, 2, 2},
+	{0, 0, 2, 2, 0, 0, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1},
+	{0, 0, 1, 1, 0, 0, 1, 1, 2, 2, 1, 1, 2, 2, 1, 1},
+	{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2},
+	{0, 0, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1, 2, 2, 2, 2},
+	{0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2},
+	{0, 0, 1, 2, 0, 0, 1, 2, 0, 0, 1, 2, 0, 0, 1, 2},
+	{0, 1, 1, 2, 0, 1, 1, 2, 0, 1, 1, 2, 0, 1, 1, 2},
+	{0, 1, 2, 2, 0, 1, 2, 2, 0, 1, 2, 2, 0, 1, 2, 2},
+	{0, 0, 1, 1, 0, 1, 1, 2, 1, 1, 2, 2, 1, 2, 2, 2},
+	{0, 0, 1, 1, 2, 0, 0, 1, 2, 2, 0, 0, 2, 2, 2, 0},
+	{0, 0, 0, 1, 0, 0, 1, 1, 0, 1, 1, 2, 1, 1, 2, 2},
+	{0, 1, 1, 1, 0, 0, 1, 1, 2, 0, 0, 1, 2, 2, 0, 0},
+	{0, 0, 0, 0, 1, 1, 2, 2, 1, 1, 2, 2, 1, 1, 2, 2},
+	{0, 0, 2, 2, 0, 0, 2, 2, 0, 0, 2, 2, 1, 1, 1, 1},
+	{0, 1, 1, 1, 0, 1, 1, 1, 0, 2, 2, 2, 0, 2, 2, 2},
+	{0, 0, 0, 1, 0, 0, 0, 1, 2, 2, 2, 1, 2, 2, 2, 1},
+	{0, 0, 0, 0, 0, 0, 1, 1, 0, 1, 2, 2, 0, 1, 2, 2},
+	{0, 0, 0, 0, 1, 1, 0, 0, 2, 2, 1, 0, 2, 2, 1, 0},
+	{0, 1, 2, 2, 0, 1, 2, 2, 0, 0, 1, 1, 0, 0, 0, 0},
+	{0, 0, 1, 2, 0, 0, 1, 2, 1, 1, 2, 2, 2, 2, 2, 2},
+	{0, 1, 1, 0, 1, 2, 2, 1, 1, 2, 2, 1, 0, 1, 1, 0},
+	{0, 0, 0, 0, 0, 1, 1, 0, 1, 2, 2, 1, 1, 2, 2, 1},
+	{0, 0, 2, 2, 1, 1, 0, 2, 1, 1, 0, 2, 0, 0, 2, 2},
+	{0, 1, 1, 0, 0, 1, 1, 0, 2, 0, 0, 2, 2, 2, 2, 2},
+	{0, 0, 1, 1, 0, 1, 2, 2, 0, 1, 2, 2, 0, 0, 1, 1},
+	{0, 0, 0, 0, 2, 0, 0, 0, 2, 2, 1, 1, 2, 2, 2, 1},
+	{0, 0, 0, 0, 0, 0, 0, 2, 1, 1, 2, 2, 1, 2, 2, 2},
+	{0, 2, 2, 2, 0, 0, 2, 2, 0, 0, 1, 2, 0, 0, 1, 1},
+	{0, 0, 1, 1, 0, 0, 1, 2, 0, 0, 2, 2, 0, 2, 2, 2},
+	{0, 1, 2, 0, 0, 1, 2, 0, 0, 1, 2, 0, 0, 1, 2, 0},
+	{0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 0, 0, 0, 0},
+	{0, 1, 2, 0, 1, 2, 0, 1, 2, 0, 1, 2, 0, 1, 2, 0},
+	{0, 1, 2, 0, 2, 0, 1, 2, 1, 2, 0, 1, 0, 1, 2, 0},
+	{0, 0, 1, 1, 2, 2, 0, 0, 1, 1, 2, 2, 0, 0, 1, 1},
+	{0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 0, 0, 0, 0, 1, 1},
+	{0, 1, 0, 1, 0, 1, 0, 1, 2, 2, 2, 2, 2, 2, 2, 2},
+	{0, 0, 0, 0, 0, 0, 0, 0, 2, 1, 2, 1, 2, 1, 2, 1},
+	{0, 0, 2, 2, 1, 1, 2, 2, 0, 0, 2, 2, 1, 1, 2, 2},
+	{0, 0, 2, 2, 0, 0, 1, 1, 0, 0, 2, 2, 0, 0, 1, 1},
+	{0, 2, 2, 0, 1, 2, 2, 1, 0, 2, 2, 0, 1, 2, 2, 1},
+	{0, 1, 0, 1, 2, 2, 2, 2, 2, 2, 2, 2, 0, 1, 0, 1},
+	{0, 0, 0, 0, 2, 1, 2, 1, 2, 1, 2, 1, 2, 1, 2, 1},
+	{0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 2, 2, 2, 2},
+	{0, 2, 2, 2, 0, 1, 1, 1, 0, 2, 2, 2, 0, 1, 1, 1},
+	{0, 0, 0, 2, 1, 1, 1, 2, 0, 0, 0, 2, 1, 1, 1, 2},
+	{0, 0, 0, 0, 2, 1, 1, 2, 2, 1, 1, 2, 2, 1, 1, 2},
+	{0, 2, 2, 2, 0, 1, 1, 1, 0, 1, 1, 1, 0, 2, 2, 2},
+	{0, 0, 0, 2, 1, 1, 1, 2, 1, 1, 1, 2, 0, 0, 0, 2},
+	{0, 1, 1, 0, 0, 1, 1, 0, 0, 1, 1, 0, 2, 2, 2, 2},
+	{0, 0, 0, 0, 0, 0, 0, 0, 2, 1, 1, 2, 2, 1, 1, 2},
+	{0, 1, 1, 0, 0, 1, 1, 0, 2, 2, 2, 2, 2, 2, 2, 2},
+	{0, 0, 2, 2, 0, 0, 1, 1, 0, 0, 1, 1, 0, 0, 2, 2},
+	{0, 0, 2, 2, 1, 1, 2, 2, 1, 1, 2, 2, 0, 0, 2, 2},
+	{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 1, 1, 2},
+	{0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 1},
+	{0, 2, 2, 2, 1, 2, 2, 2, 0, 2, 2, 2, 1, 2, 2, 2},
+	{0, 1, 0, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2},
+	{0, 1, 1, 1, 2, 0, 1, 1, 2, 2, 0, 1, 2, 2, 2, 0},
+}
+
+// The anchor pixels of the second subset of the 2 subset partitions, and of
+// the second and third subsets of the 3 subset partitions. The first subset
+// is always anchored at the first pixel.
+var (
+	bptcAnchors2 = [64]uint8{
+		15, 15, 15, 15, 15, 15, 15, 15,
+		15, 15, 15, 15, 15, 15, 15, 15,
+		15, 2, 8, 2, 2, 8, 8, 15,
+		2, 8, 2, 2, 8, 8, 2, 2,
+		15, 15, 6, 8, 2, 8, 15, 15,
+		2, 8, 2, 2, 2, 15, 15, 6,
+		6, 2, 6, 8, 15, 15, 2, 2,
+		15, 15, 15, 15, 15, 2, 2, 15,
+	}
+	bptcAnchors3a = [64]uint8{
+		3, 3, 15, 15, 8, 3, 15, 15,
+		8, 8, 6, 6, 6, 5, 3, 3,
+		3, 3, 8, 15, 3, 3, 6, 10,
+		5, 8, 8, 6, 8, 5, 15, 15,
+		8, 15, 3, 5, 6, 10, 8, 15,
+		15, 3, 15, 5, 15, 15, 15, 15,
+		3, 15, 5, 5, 5, 8, 5, 10,
+		5, 10, 8, 13, 15, 12, 3, 3,
+	}
+	bptcAnchors3b = [64]uint8{
+		15, 8, 8, 3, 15, 15, 3, 8,
+		15, 15, 15, 15, 15, 15, 15, 8,
+		15, 8, 15, 3, 15, 8, 15, 8,
+		3, 15, 6, 10, 15, 15, 10, 8,
+		15, 3, 15, 10, 10, 8, 9, 10,
+		6, 15, 8, 15, 3, 6, 6, 8,
+		15, 3, 15, 15, 15, 15, 15, 15,
+		15, 15, 15, 15, 3, 15, 15, 8,
+	}
+)
+
+// bptcSubsets returns the subset of each pixel and the anchor pixel of each
+// subset of the given partition.
+func bptcSubsets(numSubsets, partition int) (subsets [16]uint8, anchors []int) {
+	switch numSubsets {
+	case 2:
+		for i := range subsets {
+			subsets[i] = uint8(bptcPartitions2[partition]>>uint(i)) & 1
+		}
+		return subsets, []int{0, int(bptcAnchors2[partition])}
+	case 3:
+		return bptcPartitions3[partition], []int{0, int(bptcAnchors3a[partition]), int(bptcAnchors3b[partition])}
+	default:
+		return subsets, []int{0}
+	}
+}
+
+// readBPTCIndices reads the indices of the 16 pixels, where the anchor pixels
+// have their most significant bit implicitly zero.
+func readBPTCIndices(b *bptcBits, bits uint, anchors []int) (indices [16]uint) {
+	for i := range indices {
+		n := bits
+		for _, a := range anchors {
+			if i == a {
+				n--
+				break
+			}
+		}
+		indices[i] = uint(b.read(n))
+	}
+	return indices
+}
+
+type bc7Mode struct {
+	numSubsets     int
+	partitionBits  uint
+	rotationBits   uint
+	indexSelection bool
+	colorBits      uint
+	alphaBits      uint
+	endpointPBits  bool
+	sharedPBits    bool
+	indexBits      uint
+	indexBits2     uint
+}
+
+var bc7Modes = [8]bc7Mode{
+	{3, 4, 0, false, 4, 0, true, false, 3, 0},
+	{2, 6, 0, false, 6, 0, false, true, 3, 0},
+	{3, 6, 0, false, 5, 0, false, false, 2, 0},
+	{2, 6, 0, false, 7, 0, true, false, 2, 0},
+	{1, 0, 2, true, 5, 6, false, false, 2, 3},
+	{1, 0, 2, false, 7, 8, false, false, 2, 2},
+	{1, 0, 0, false, 7, 7, true, false, 4, 0},
+	{2, 6, 0, false, 5, 5, true, false, 2, 0},
+}
+
+// decodeBC7 decodes a 4x4 block of the BC7 format.
+func decodeBC7(r binary.Reader, dst []pixel) {
+	b := readBPTCBits(r)
+	mode := 0
+	for mode < 8 && b.read(1) == 0 {
+		mode++
+	}
+	if mode == 8 {
+		// Reserved mode.
+		for i := 0; i < 16; i++ {
+			dst[i].setToBlackRGBA()
+		}
+		return
+	}
+	m := bc7Modes[mode]
+
+	partition := b.read(m.partitionBits)
+	rotation := b.read(m.rotationBits)
+	indexSelection := m.indexSelection && b.read(1) == 1
+
+	// The endpoints of each subset, as {r, g, b, a}.
+	numEndpoints := m.numSubsets * 2
+	endpoints := make([][4]int, numEndpoints)
+	for c := 0; c < 3; c++ {
+		for e := range endpoints {
+			endpoints[e][c] = b.read(m.colorBits)
+		}
+	}
+	for e := range endpoints {
+		endpoints[e][3] = b.read(m.alphaBits)
+	}
+
+	colorBits, alphaBits := m.colorBits, m.alphaBits
+	switch {
+	case m.endpointPBits:
+		for e := range endpoints {
+			p := b.read(1)
+			for c := range endpoints[e] {
+				endpoints[e][c] = endpoints[e][c]<<1 | p
+			}
+		}
+		colorBits++
+		if alphaBits > 0 {
+			alphaBits++
+		}
+	case m.sharedPBits:
+		for s := 0; s < m.numSubsets; s++ {
+			p := b.read(1)
+			for e := 2 * s; e < 2*s+2; e++ {
+				for c := range endpoints[e] {
+					endpoints[e][c] = endpoints[e][c]<<1 | p
+				}
+			}
+		}
+		colorBits++
+	}
+
+	// Expand the endpoints to 8 bits by replicating their most significant
+	// bits.
+	expand := func(v int, bits uint) int {
+		v <<= 8 - bits
+		return v | v>>bits
+	}
+	for e := range endpoints {
+		for c := 0; c < 3; c++ {
+			endpoints[e][c] = expand(endpoints[e][c], colorBits)
+		}
+		if alphaBits > 0 {
+			endpoints[e][3] = expand(endpoints[e][3], alphaBits)
+		} else {
+			endpoints[e][3] = 255
+		}
+	}
+
+	subsets, anchors := bptcSubsets(m.numSubsets, partition)
+	colorIndexBits, alphaIndexBits := m.indexBits, m.indexBits
+	colorIndices := readBPTCIndices(b, m.indexBits, anchors)
+	alphaIndices := colorIndices
+	if m.indexBits2 > 0 {
+		alphaIndices = readBPTCIndices(b, m.indexBits2, anchors)
+		alphaIndexBits = m.indexBits2
+		if indexSelection {
+			colorIndices, alphaIndices = alphaIndices, colorIndices
+			colorIndexBits, alphaIndexBits = alphaIndexBits, colorIndexBits
+		}
+	}
+
+	for i := 0; i < 16; i++ {
+		e0, e1 := endpoints[2*subsets[i]], endpoints[2*subsets[i]+1]
+		p := pixel{
+			bptcInterpolate(e0[0], e1[0], colorIndices[i], colorIndexBits),
+			bptcInterpolate(e0[1], e1[1], colorIndices[i], colorIndexBits),
+			bptcInterpolate(e0[2], e1[2], colorIndices[i], colorIndexBits),
+			bptcInterpolate(e0[3], e1[3], alphaIndices[i], alphaIndexBits),
+		}
+		switch rotation {
+		case 1:
+			p.r, p.a = p.a, p.r
+		case 2:
+			p.g, p.a = p.a, p.g
+		case 3:
+			p.b, p.a = p.a, p.b
+		}
+		dst[i] = p
+	}
+}
+
+// bc6hField is a run of bits of a BC6H block holding the bits
+// [shift, shift+count) of a channel of an endpoint. The bits of a reversed run
+// are stored from the most significant one.
+type bc6hField struct {
+	endpoint, channel int
+	shift, count      uint
+	reversed          bool
+}
+
+type bc6hMode struct {
+	numSubsets   int
+	transformed  bool
+	endpointBits uint
+	deltaBits    [3]uint
+	fields       []bc6hField
+}
+
+// bc6hModes holds the BC6H modes, indexed by their 2 or 5 bit mode values.
+// The fields are listed in the order they are stored in the blocks, as the
+// runs of bits of the endpoints r0 to r3, g0 to g3 and b0 to b3. Endpoints 0
+// and 1 are the ones of the first subset, and endpoints 2 and 3 the ones of
+// the second subset.
+var bc6hModes = func() map[int]bc6hMode {
+	field := func(c int, reversed bool) func(e int, shift, count uint) bc6hField {
+		return func(e int, shift, count uint) bc6hField {
+			return bc6hField{e, c, shift, count, reversed}
+		}
+	}
+	r, g, b := field(0, false), field(1, false), field(2, false)
+	rr, gr, br := field(0, true), field(1, true), field(2, true)
+	return map[int]bc6hMode{
+		0x00: {2, true, 10, [3]uint{5, 5, 5}, []bc6hField{
+			g(2, 4, 1), b(2, 4, 1), b(3, 4, 1), r(0, 0, 10), g(0, 0, 10), b(0, 0, 10),
+			r(1, 0, 5), g(3, 4, 1), g(2, 0, 4), g(1, 0, 5), b(3, 0, 1), g(3, 0, 4),
+			b(1, 0, 5), b(3, 1, 1), b(2, 0, 4), r(2, 0, 5), b(3, 2, 1), r(3, 0, 5),
+			b(3, 3, 1)}},
+		0x01: {2, true, 7, [3]uint{6, 6, 6}, []bc6hField{
+			g(2, 5, 1), g(3, 4, 1), g(3, 5, 1), r(0, 0, 7), b(3, 0, 1), b(3, 1, 1),
+			b(2, 4, 1), g(0, 0, 7), b(2, 5, 1), b(3, 2, 1), g(2, 4, 1), b(0, 0, 7),
+			b(3, 3, 1), b(3, 5, 1), b(3, 4, 1), r(1, 0, 6), g(2, 0, 4), g(1, 0, 6),
+			g(3, 0, 4), b(1, 0, 6), b(2, 0, 4), r(2, 0, 6), r(3, 0, 6)}},
+		0x02: {2, true, 11, [3]uint{5, 4, 4}, []bc6hField{
+			r(0, 0, 10), g(0, 0, 10), b(0, 0, 10), r(1, 0, 5), r(0, 10, 1), g(2, 0, 4),
+			g(1, 0, 4), g(0, 10, 1), b(3, 0, 1), g(3, 0, 4), b(1, 0, 4), b(0, 10, 1),
+			b(3, 1, 1), b(2, 0, 4), r(2, 0, 5), b(3, 2, 1), r(3, 0, 5), b(3, 3, 1)}},
+		0x06: {2, true, 11, [3]uint{4, 5, 4}, []bc6hField{
+			r(0, 0, 10), g(0, 0, 10), b(0, 0, 10), r(1, 0, 4), r(0, 10, 1), g(3, 4, 1),
+			g(2, 0, 4), g(1, 0, 5), g(0, 10, 1), g(3, 0, 4), b(1, 0, 4), b(0, 10, 1),
+			b(3, 1, 1), b(2, 0, 4), r(2, 0, 4), b(3, 0, 1), b(3, 2, 1), r(3, 0, 4),
+			g(2, 4, 1), b(3, 3, 1)}},
+		0x0a: {2, true, 11, [3]uint{4, 4, 5}, []bc6hField{
+			r(0, 0, 10), g(0, 0, 10), b(0, 0, 10), r(1, 0, 4), r(0, 10, 1), b(2, 4, 1),
+			g(2, 0, 4), g(1, 0, 4), g(0, 10, 1), b(3, 0, 1), g(3, 0, 4), b(1, 0, 5),
+			b(0, 10, 1), b(2, 0, 4), r(2, 0, 4), b(3, 1, 1), b(3, 2, 1), r(3, 0, 4),
+			b(3, 4, 1), b(3, 3, 1)}},
+		0x0e: {2, true, 9, [3]uint{5, 5, 5}, []bc6hField{
+			r(0, 0, 9), b(2, 4, 1), g(0, 0, 9), g(2, 4, 1), b(0, 0, 9), b(3, 4, 1),
+			r(1, 0, 5), g(3, 4, 1), g(2, 0, 4), g(1, 0, 5), b(3, 0, 1), g(3, 0, 4),
+			b(1, 0, 5), b(3, 1, 1), b(2, 0, 4), r(2, 0, 5), b(3, 2, 1), r(3, 0, 5),
+			b(3, 3, 1)}},
+		0x12: {2, true, 8, [3]uint{6, 5, 5}, []bc6hField{
+			r(0, 0, 8), g(3, 4, 1), b(2, 4, 1), g(0, 0, 8), b(3, 2, 1), g(2, 4, 1),
+			b(0, 0, 8), b(3, 3, 1), b(3, 4, 1), r(1, 0, 6), g(2, 0, 4), g(1, 0, 5),
+			b(3, 0, 1), g(3, 0, 4), b(1, 0, 5), b(3, 1, 1), b(2, 0, 4), r(2, 0, 6),
+			r(3, 0, 6)}},
+		0x16: {2, true, 8, [3]uint{5, 6, 5}, []bc6hField{
+			r(0, 0, 8), b(3, 0, 1), b(2, 4, 1), g(0, 0, 8), g(2, 5, 1), g(2, 4, 1),
+			b(0, 0, 8), g(3, 5, 1), b(3, 4, 1), r(1, 0, 5), g(3, 4, 1), g(2, 0, 4),
+			g(1, 0, 6), g(3, 0, 4), b(1, 0, 5), b(3, 1, 1), b(2, 0, 4), r(2, 0, 5),
+			b(3, 2, 1), r(3, 0, 5), b(3, 3, 1)}},
+		0x1a: {2, true, 8, [3]uint{5, 5, 6}, []bc6hField{
+			r(0, 0, 8), b(3, 1, 1), b(2, 4, 1), g(0, 0, 8), b(2, 5, 1), g(2, 4, 1),
+			b(0, 0, 8), b(3, 5, 1), b(3, 4, 1), r(1, 0, 5), g(3, 4, 1), g(2, 0, 4),
+			g(1, 0, 5), b(3, 0, 1), g(3, 0, 4), b(1, 0, 6), b(2, 0, 4), r(2, 0, 5),
+			b(3, 2, 1), r(3, 0, 5), b(3, 3, 1)}},
+		0x1e: {2, false, 6, [3]uint{6, 6, 6}, []bc6hField{
+			r(0, 0, 6), g(3, 4, 1), b(3, 0, 1), b(3, 1, 1), b(2, 4, 1), g(0, 0, 6),
+			g(2, 5, 1), b(2, 5, 1), b(3, 2, 1), g(2, 4, 1), b(0, 0, 6), g(3, 5, 1),
+			b(3, 3, 1), b(3, 5, 1), b(3, 4, 1), r(1, 0, 6), g(2, 0, 4), g(1, 0, 6),
+			g(3, 0, 4), b(1, 0, 6), b(2, 0, 4), r(2, 0, 6), r(3, 0, 6)}},
+		0x03: {1, false, 10, [3]uint{10, 10, 10}, []bc6hField{
+			r(0, 0, 10), g(0, 0, 10), b(0, 0, 10), r(1, 0, 10), g(1, 0, 10), b(1, 0, 10)}},
+		0x07: {1, true, 11, [3]uint{9, 9, 9}, []bc6hField{
+			r(0, 0, 10), g(0, 0, 10), b(0, 0, 10), r(1, 0, 9), r(0, 10, 1), g(1, 0, 9),
+			g(0, 10, 1), b(1, 0, 9), b(0, 10, 1)}},
+		0x0b: {1, true, 12, [3]uint{8, 8, 8}, []bc6hField{
+			r(0, 0, 10), g(0, 0, 10), b(0, 0, 10), r(1, 0, 8), rr(0, 10, 2), g(1, 0, 8),
+			gr(0, 10, 2), b(1, 0, 8), br(0, 10, 2)}},
+		0x0f: {1, true, 16, [3]uint{4, 4, 4}, []bc6hField{
+			r(0, 0, 10), g(0, 0, 10), b(0, 0, 10), r(1, 0, 4), rr(0, 10, 6), g(1, 0, 4),
+			gr(0, 10, 6), b(1, 0, 4), br(0, 10, 6)}},
+	}
+}()
+
+// decodeBC6H decodes the BC6H image to RGBA_F32.
+func decodeBC6H(src []byte, width, height, depth int, signed bool) ([]byte, error) {
+	dst := make([]byte, width*height*depth*16)
+	block := [16][3]float32{}
+	r := endian.Reader(bytes.NewReader(src), device.LittleEndian)
+	put := func(i int, f float32) {
+		v := math.Float32bits(f)
+		dst[i], dst[i+1], dst[i+2], dst[i+3] = byte(v), byte(v>>8), byte(v>>16), byte(v>>24)
+	}
+	for z := 0; z < depth; z++ {
+		for y := 0; y < height; y += 4 {
+			for x := 0; x < width; x += 4 {
+				decodeBC6HBlock(r, signed, &block)
+				for dy := 0; dy < 4 && y+dy < height; dy++ {
+					for dx := 0; dx < 4 && x+dx < width; dx++ {
+						i := 16 * ((z*height+y+dy)*width + x + dx)
+						p := block[dy*4+dx]
+						put(i+0, p[0])
+						put(i+4, p[1])
+						put(i+8, p[2])
+						put(i+12, 1.0)
+					}
+				}
+			}
+		}
+	}
+	return dst, r.Error()
+}
+
+// decodeBC6HBlock decodes a 4x4 block of the BC6H format.
+func decodeBC6HBlock(r binary.Reader, signed bool, dst *[16][3]float32) {
+	b := readBPTCBits(r)
+	code := b.read(2)
+	if code > 1 {
+		code |= b.read(3) << 2
+	}
+	m, ok := bc6hModes[code]
+	if !ok {
+		// Reserved mode.
+		*dst = [16][3]float32{}
+		return
+	}
+
+	endpoints := [4][3]int{}
+	for _, f := range m.fields {
+		if f.reversed {
+			endpoints[f.endpoint][f.channel] |= b.readReversed(f.count) << f.shift
+		} else {
+			endpoints[f.endpoint][f.channel] |= b.read(f.count) << f.shift
+		}
+	}
+	partition := 0
+	if m.numSubsets == 2 {
+		partition = b.read(5)
+	}
+
+	numEndpoints := m.numSubsets * 2
+	for c := 0; c < 3; c++ {
+		if signed {
+			endpoints[0][c] = bc6hSignExtend(endpoints[0][c], m.endpointBits)
+		}
+		for e := 1; e < numEndpoints; e++ {
+			if m.transformed {
+				// The other endpoints are stored as deltas from the first one.
+				delta := bc6hSignExtend(endpoints[e][c], m.deltaBits[c])
+				endpoints[e][c] = (endpoints[0][c] + delta) & (1<<m.endpointBits - 1)
+			}
+			if signed {
+				endpoints[e][c] = bc6hSignExtend(endpoints[e][c], m.endpointBits)
+			}
+		}
+		for e := 0; e < numEndpoints; e++ {
+			endpoints[e][c] = bc6hUnquantize(endpoints[e][c], m.endpointBits, signed)
+		}
+	}
+
+	subsets, anchors := bptcSubsets(m.numSubsets, partition)
+	indexBits := uint(3)
+	if m.numSubsets == 1 {
+		indexBits = 4
+	}
+	indices := readBPTCIndices(b, indexBits, anchors)
+	for i := 0; i < 16; i++ {
+		e0, e1 := endpoints[2*subsets[i]], endpoints[2*subsets[i]+1]
+		for c := 0; c < 3; c++ {
+			v := bptcInterpolate(e0[c], e1[c], indices[i], indexBits)
+			dst[i][c] = bc6hToHalf(v, signed).Float32()
+		}
+	}
+}
+
+func bc6hSignExtend(v int, bits uint) int {
+	if v&(1<<(bits-1)) != 0 {
+		return v - 1<<bits
+	}
+	return v
+}
+
+// bc6hUnquantize scales the endpoint value to 16 bits.
+func bc6hUnquantize(v int, bits uint, signed bool) int {
+	if !signed {
+		switch {
+		case bits >= 15, v == 0:
+			return v
+		case v == 1<<bits-1:
+			return 0xffff
+		default:
+			return (v<<16 + 0x8000) >> bits
+		}
+	}
+	if bits >= 16 {
+		return v
+	}
+	negative := v < 0
+	if negative {
+		v = -v
+	}
+	switch {
+	case v == 0:
+	case v >= 1<<(bits-1)-1:
+		v = 0x7fff
+	default:
+		v = (v<<15 + 0x4000) >> (bits - 1)
+	}
+	if negative {
+		return -v
+	}
+	return v
+}
+
+// bc6hToHalf scales the interpolated value to the bits of a half float.
+func bc6hToHalf(v int, signed bool) f16.Number {
+	if !signed {
+		return f16.Number((v * 31) >> 6)
+	}
+	if v < 0 {
+		return f16.Number(0x8000 | ((-v * 31) >> 5))
+	}
+	return f16.Number((v * 31) >> 5)
+}
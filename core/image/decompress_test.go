@@ -309,3 +309,207 @@ func s16ToU8(src []byte, w, h, d int) ([]byte, error) {
 	}
 	return out, nil
 }
+
+// bptcBlock builds a 128 bit BPTC block from the given bit fields, as pairs of
+// value and bit count, stored from the least significant bit.
+func bptcBlock(fields ...uint64) []byte {
+	block := make([]byte, 16)
+	pos := uint(0)
+	for i := 0; i < len(fields); i += 2 {
+		v, n := fields[i], uint(fields[i+1])
+		for b := uint(0); b < n; b++ {
+			block[pos/8] |= byte((v>>b)&1) << (pos % 8)
+			pos++
+		}
+	}
+	return block
+}
+
+// bptcIndices returns the fields of the given indices of a block, where the
+// indices of the anchor pixels have one bit less.
+func bptcIndices(bits uint64, anchors []int, indices ...uint64) []uint64 {
+	fields := []uint64{}
+	for i, index := range indices {
+		n := bits
+		for _, a := range anchors {
+			if i == a {
+				n--
+			}
+		}
+		fields = append(fields, index, n)
+	}
+	return fields
+}
+
+// checkBC7 decodes the BC7 block and checks its pixels against the expected
+// RGBA values.
+func checkBC7(t *testing.T, name string, block []byte, format *image.Format, expected [16][4]byte) []byte {
+	out, err := image.Convert(block, 4, 4, 1, format, image.RGBA_U8_NORM)
+	if err != nil {
+		t.Fatalf("Failed to convert %s: %v", name, err)
+	}
+	for i := range expected {
+		for c := 0; c < 4; c++ {
+			if got := out[i*4+c]; got != expected[i][c] {
+				t.Errorf("%s pixel %d channel %d was %d, expected %d", name, i, c, got, expected[i][c])
+			}
+		}
+	}
+	return out
+}
+
+// checkBC6H decodes the BC6H block and checks its pixels against the expected
+// RGB values.
+func checkBC6H(t *testing.T, name string, block []byte, format *image.Format, expected [16][3]float32) {
+	out, err := image.Convert(block, 4, 4, 1, format, image.RGBA_F32)
+	if err != nil {
+		t.Fatalf("Failed to convert %s: %v", name, err)
+	}
+	r := endian.Reader(bytes.NewReader(out), device.LittleEndian)
+	for i := range expected {
+		got := [4]float32{r.Float32(), r.Float32(), r.Float32(), r.Float32()}
+		if got != [4]float32{expected[i][0], expected[i][1], expected[i][2], 1} {
+			t.Errorf("%s pixel %d was %v, expected %v", name, i, got, expected[i])
+		}
+	}
+}
+
+func TestDecompressBPTC(t *testing.T) {
+	ramp := []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+	// BC7 mode 6, from black transparent to white opaque.
+	bc7 := bptcBlock(append([]uint64{
+		1 << 6, 7, // mode
+		0, 7, 127, 7, // red
+		0, 7, 127, 7, // green
+		0, 7, 127, 7, // blue
+		0, 7, 127, 7, // alpha
+		0, 1, 1, 1, // p-bits
+	}, bptcIndices(4, []int{0}, ramp...)...)...)
+	expected := [16][4]byte{}
+	for i, v := range []byte{0, 16, 36, 52, 68, 84, 104, 120, 135, 151, 171, 187, 203, 219, 239, 255} {
+		expected[i] = [4]byte{v, v, v, v}
+	}
+	linear := checkBC7(t, "BC7 mode 6", bc7, image.BC7_RGBA_U8_NORM, expected)
+
+	// The sRGB block decodes to the same sRGB values, and to the linear values
+	// of the sRGB ones.
+	srgb, err := image.Convert(bc7, 4, 4, 1, image.BC7_SRGBA_U8_NORM, image.SRGBA_U8_NORM)
+	if err != nil {
+		t.Fatalf("Failed to convert sRGB BC7: %v", err)
+	}
+	if !bytes.Equal(srgb, linear) {
+		t.Errorf("sRGB BC7 was %v, expected %v", srgb, linear)
+	}
+	fromSRGB, err := image.Convert(linear, 4, 4, 1, image.SRGBA_U8_NORM, image.RGBA_U8_NORM)
+	if err != nil {
+		t.Fatalf("Failed to convert sRGB: %v", err)
+	}
+	for i := range expected {
+		expected[i] = [4]byte{fromSRGB[i*4], fromSRGB[i*4+1], fromSRGB[i*4+2], fromSRGB[i*4+3]}
+	}
+	checkBC7(t, "sRGB BC7 mode 6", bc7, image.BC7_SRGBA_U8_NORM, expected)
+
+	// BC7 mode 1 with partition 13, where the top half of the block is the
+	// first subset, with red from 0 to 63, and the bottom half is the second
+	// subset, with green from 63 to 0. The shared p-bits are 0 and 1.
+	bc7 = bptcBlock(append([]uint64{
+		1 << 1, 2, // mode
+		13, 6, // partition
+		0, 6, 63, 6, 0, 6, 0, 6, // red
+		0, 6, 0, 6, 0, 6, 63, 6, // green
+		0, 6, 0, 6, 31, 6, 31, 6, // blue
+		0, 1, 1, 1, // p-bits
+	}, bptcIndices(3, []int{0, 15}, 0, 1, 2, 3, 4, 5, 6, 7, 7, 6, 5, 4, 3, 2, 1, 0)...)...)
+	checkBC7(t, "BC7 mode 1", bc7, image.BC7_RGBA_U8_NORM, [16][4]byte{
+		{0, 0, 0, 255}, {36, 0, 0, 255}, {71, 0, 0, 255}, {107, 0, 0, 255},
+		{146, 0, 0, 255}, {182, 0, 0, 255}, {217, 0, 0, 255}, {253, 0, 0, 255},
+		{2, 255, 126, 255}, {2, 219, 126, 255}, {2, 184, 126, 255}, {2, 148, 126, 255},
+		{2, 109, 126, 255}, {2, 73, 126, 255}, {2, 38, 126, 255}, {2, 2, 126, 255},
+	})
+
+	// BC7 mode 4 with the red and alpha channels rotated, and with the 3 bit
+	// indices selected for the colors and the 2 bit ones for the alpha.
+	cycle := func(n uint64) []uint64 {
+		indices := make([]uint64, 16)
+		for i := range indices {
+			indices[i] = uint64(i) % n
+		}
+		return indices
+	}
+	bc7 = bptcBlock(append(append([]uint64{
+		1 << 4, 5, // mode
+		1, 2, // rotation
+		1, 1, // index selection
+		0, 5, 31, 5, // red
+		31, 5, 31, 5, // green
+		0, 5, 0, 5, // blue
+		0, 6, 63, 6, // alpha
+	}, bptcIndices(2, []int{0}, cycle(4)...)...), bptcIndices(3, []int{0}, cycle(8)...)...)...)
+	expected = [16][4]byte{}
+	for i := range expected {
+		expected[i] = [4]byte{[]byte{0, 84, 171, 255}[i%4], 255, 0, []byte{0, 36, 72, 108, 147, 183, 219, 255}[i%8]}
+	}
+	checkBC7(t, "BC7 mode 4", bc7, image.BC7_RGBA_U8_NORM, expected)
+
+	// BC6H mode 11, from black to the largest half float on the red channel.
+	bc6h := bptcBlock(append([]uint64{
+		0x03, 5, // mode
+		0, 10, 0, 10, 0, 10, // endpoint 0
+		1023, 10, 0, 10, 0, 10, // endpoint 1
+	}, bptcIndices(4, []int{0}, ramp...)...)...)
+	expectedF := [16][3]float32{}
+	for i, v := range []float32{
+		0, 0.000118255615, 0.0006637573, 0.002532959,
+		0.009643555, 0.036621094, 0.19921875, 0.765625,
+		2.9355469, 11.2421875, 58.46875, 225.875,
+		871.5, 3358, 17392, 65504,
+	} {
+		expectedF[i] = [3]float32{v, 0, 0}
+	}
+	checkBC6H(t, "BC6H mode 11", bc6h, image.BC6H_RGB_UFLOAT, expectedF)
+
+	// The signed BC6H mode 11, from the smallest to the largest half float on
+	// the red channel, and with the constant smallest green and largest blue.
+	bc6h = bptcBlock(append([]uint64{
+		0x03, 5, // mode
+		0x201, 10, 0x201, 10, 0x1ff, 10, // endpoint 0
+		0x1ff, 10, 0x201, 10, 0x1ff, 10, // endpoint 1
+	}, bptcIndices(4, []int{0}, ramp...)...)...)
+	for i, v := range []float32{
+		-65504, -4604, -163.875, -11.2421875,
+		-0.765625, -0.051757812, -0.0017700195, -0.000118255615,
+		0.000118255615, 0.0017700195, 0.051757812, 0.765625,
+		11.2421875, 163.875, 4604, 65504,
+	} {
+		expectedF[i] = [3]float32{v, -65504, 65504}
+	}
+	checkBC6H(t, "BC6H SFLOAT mode 11", bc6h, image.BC6H_RGB_SFLOAT, expectedF)
+
+	// BC6H mode 10 with partition 13, where the top half of the block is the
+	// first subset, with red from 0 to 63, and the bottom half is the second
+	// subset, with the constant color (63, 42, 21). The green and blue of the
+	// second subset are spread over the block.
+	bc6h = bptcBlock(append([]uint64{
+		0x1e, 5, // mode
+		0, 6, // r0
+		0, 1, 1, 1, 0, 1, 1, 1, // g3[4], b3[0], b3[1], b2[4]
+		0, 6, // g0
+		1, 1, 0, 1, 1, 1, 0, 1, // g2[5], b2[5], b3[2], g2[4]
+		0, 6, // b0
+		1, 1, 0, 1, 0, 1, 1, 1, // g3[5], b3[3], b3[5], b3[4]
+		63, 6, // r1
+		10, 4, // g2[3:0]
+		0, 6, // g1
+		10, 4, // g3[3:0]
+		0, 6, // b1
+		5, 4, // b2[3:0]
+		63, 6, 63, 6, // r2, r3
+		13, 5, // partition
+	}, bptcIndices(3, []int{0, 15}, 0, 1, 2, 3, 4, 5, 6, 7, 7, 6, 5, 4, 3, 2, 1, 0)...)...)
+	for i, v := range []float32{0, 0.0006637573, 0.013427734, 0.26953125, 7.6835938, 163.875, 3358, 65504} {
+		expectedF[i] = [3]float32{v, 0, 0}
+		expectedF[i+8] = [3]float32{65504, 50.75, 0.044189453}
+	}
+	checkBC6H(t, "BC6H mode 10", bc6h, image.BC6H_RGB_UFLOAT, expectedF)
+}
@@ -73,6 +73,9 @@ var _ = []format{
 	&FmtS3_DXT3_RGBA{},
 	&FmtS3_DXT5_RGBA{},
 	&FmtASTC{},
+	&FmtBC6H_RGB_UFLOAT{},
+	&FmtBC6H_RGB_SFLOAT{},
+	&FmtBC7_RGBA_U8_NORM{},
 }
 
 // Check returns an error if the combination of data, image width, image
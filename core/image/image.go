@@ -181,3 +181,48 @@ func Difference(a, b *Data) (float32, error) {
 	}
 	return sqrErr / float32(c), nil
 }
+
+// perceptibleDelta is the fraction of the maximal YIQ delta of two pixels
+// above which the difference of the pixels is perceptible.
+const perceptibleDelta = 0.1 * 0.1
+
+// PerceptualDifference returns the fraction of the pixels of the two images
+// that differ perceptibly, comparing the pixels in the YIQ color space which
+// weights the luminance above the chrominance like the human eye does.
+// A return value of 0 denotes images that look identical, a return value of 1
+// denotes images of which every pixel looks different.
+// The alpha channels of the images are ignored.
+func PerceptualDifference(a, b *Data) (float32, error) {
+	if a.Width != b.Width || a.Height != b.Height || a.Depth != b.Depth {
+		return 1, fmt.Errorf("Image dimensions are not identical. %dx%dx%d vs %dx%dx%d",
+			a.Width, a.Height, a.Depth, b.Width, b.Height, b.Depth)
+	}
+	a, err := a.Convert(RGBA_U8_NORM)
+	if err != nil {
+		return 1, err
+	}
+	b, err = b.Convert(RGBA_U8_NORM)
+	if err != nil {
+		return 1, err
+	}
+
+	// The largest delta of two pixels.
+	const maxDelta = 35215.0 / (255 * 255)
+	count := len(a.Bytes) / 4
+	if count == 0 {
+		return 0, nil
+	}
+	different := 0
+	for p := 0; p < len(a.Bytes); p += 4 {
+		r := float64(a.Bytes[p+0]) - float64(b.Bytes[p+0])
+		g := float64(a.Bytes[p+1]) - float64(b.Bytes[p+1])
+		bl := float64(a.Bytes[p+2]) - float64(b.Bytes[p+2])
+		y := (r*0.29889531 + g*0.58662247 + bl*0.11448223) / 255
+		i := (r*0.59597799 - g*0.27417610 - bl*0.32180189) / 255
+		q := (r*0.21147017 - g*0.52261711 + bl*0.31114694) / 255
+		if delta := 0.5053*y*y + 0.299*i*i + 0.1957*q*q; delta > maxDelta*perceptibleDelta {
+			different++
+		}
+	}
+	return float32(different) / float32(count), nil
+}
@@ -84,3 +84,58 @@ func TestDifference(t *testing.T) {
 		}
 	}
 }
+
+func TestPerceptualDifference(t *testing.T) {
+	fill := func(w, h uint32, pixels ...[4]byte) *image.Data {
+		bytes := make([]byte, w*h*4)
+		for p := 0; p < len(bytes); p += 4 {
+			copy(bytes[p:], pixels[(p/4)%len(pixels)][:])
+		}
+		return &image.Data{
+			Width:  w,
+			Height: h,
+			Depth:  1,
+			Bytes:  bytes,
+			Format: image.RGBA_U8_NORM,
+		}
+	}
+	white, black := [4]byte{0xff, 0xff, 0xff, 0xff}, [4]byte{0x00, 0x00, 0x00, 0xff}
+	for _, test := range []struct {
+		name string
+		a, b *image.Data
+		diff float32
+	}{
+		{
+			name: "white vs black",
+			a:    fill(8, 8, white),
+			b:    fill(8, 8, black),
+			diff: 1.0,
+		}, {
+			name: "white vs almost white",
+			a:    fill(8, 8, white),
+			b:    fill(8, 8, [4]byte{0xfe, 0xfd, 0xff, 0xff}),
+			diff: 0.0,
+		}, {
+			name: "white vs half black",
+			a:    fill(8, 8, white),
+			b:    fill(8, 8, white, black),
+			diff: 0.5,
+		}, {
+			name: "opaque-red vs transparent-red",
+			a:    fill(8, 8, [4]byte{0xff, 0x00, 0x00, 0xff}),
+			b:    fill(8, 8, [4]byte{0xff, 0x00, 0x00, 0x00}),
+			diff: 0.0,
+		},
+	} {
+		diff, err := image.PerceptualDifference(test.a, test.b)
+		if err != nil {
+			t.Errorf("PerceptualDifference of %v returned error: %v", test.name, err)
+			continue
+		}
+
+		if f32.Abs(diff-test.diff) > 0.0000001 {
+			t.Errorf("PerceptualDifference of %v gave value: %v, expected: %v",
+				test.name, diff, test.diff)
+		}
+	}
+}
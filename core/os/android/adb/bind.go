@@ -16,6 +16,7 @@ package adb
 
 import (
 	"context"
+	"net"
 
 	"github.com/google/gapid/core/os/android"
 	"github.com/google/gapid/core/os/device/bind"
@@ -34,6 +35,9 @@ type Device interface {
 	Forward(ctx context.Context, local, device Port) error
 	// RemoveForward removes a port forward made by Forward.
 	RemoveForward(ctx context.Context, local Port) error
+	// Dial opens a stream to the specified device Port through the adb server,
+	// without forwarding a local port.
+	Dial(ctx context.Context, device Port) (net.Conn, error)
 }
 
 // DeviceList is a list of devices.
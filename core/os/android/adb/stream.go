@@ -0,0 +1,134 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gapid/core/log"
+)
+
+// defaultServerPort is the port of the adb server if the
+// ANDROID_ADB_SERVER_PORT environment variable is not set.
+const defaultServerPort = "5037"
+
+// serverAddress returns the network and the address of the adb server, which
+// may run on another host. Like adb, it uses the ADB_SERVER_SOCKET
+// environment variable if set, in the tcp:<port>, tcp:<host>:<port> or
+// localfilesystem:<path> forms, or the ANDROID_ADB_SERVER_ADDRESS and
+// ANDROID_ADB_SERVER_PORT environment variables otherwise.
+func serverAddress() (network, address string, err error) {
+	if socket := os.Getenv("ADB_SERVER_SOCKET"); socket != "" {
+		switch {
+		case strings.HasPrefix(socket, "tcp:"):
+			addr := strings.TrimPrefix(socket, "tcp:")
+			if !strings.Contains(addr, ":") {
+				addr = net.JoinHostPort("localhost", addr)
+			}
+			return "tcp", addr, nil
+		case strings.HasPrefix(socket, "localfilesystem:"):
+			return "unix", strings.TrimPrefix(socket, "localfilesystem:"), nil
+		default:
+			return "", "", fmt.Errorf("Unsupported ADB_SERVER_SOCKET %q", socket)
+		}
+	}
+	host := os.Getenv("ANDROID_ADB_SERVER_ADDRESS")
+	if host == "" {
+		host = "localhost"
+	}
+	port := os.Getenv("ANDROID_ADB_SERVER_PORT")
+	if port == "" {
+		port = defaultServerPort
+	}
+	return "tcp", net.JoinHostPort(host, port), nil
+}
+
+// Dial opens a stream to the specified device Port through the adb server.
+// Unlike Forward, no local port is used, so the streams to the devices of a
+// shared host cannot collide.
+func (b *binding) Dial(ctx context.Context, device Port) (net.Conn, error) {
+	network, address, err := serverAddress()
+	if err != nil {
+		return nil, log.Err(ctx, err, "Finding the adb server")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Connecting to the adb server")
+	}
+	// The requests to the adb server must not outlive the context, but the
+	// stream may, so the deadline is only set for the requests.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Switch the connection to the device, then open the stream to the port.
+	// Once the adb server has accepted both requests, the connection is the
+	// stream.
+	for _, req := range []string{"host:transport:" + b.To.Serial, device.adbForwardString()} {
+		if err := serverRequest(conn, req); err != nil {
+			conn.Close()
+			return nil, log.Errf(ctx, err, "Requesting %v", req)
+		}
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// serverRequest sends the request to the adb server and reads its status.
+func serverRequest(conn io.ReadWriter, req string) error {
+	if _, err := fmt.Fprintf(conn, "%04x%s", len(req), req); err != nil {
+		return err
+	}
+	status := make([]byte, 4)
+	if _, err := io.ReadFull(conn, status); err != nil {
+		return err
+	}
+	switch string(status) {
+	case "OKAY":
+		return nil
+	case "FAIL":
+		msg, err := readServerMessage(conn)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("adb server: %v", msg)
+	default:
+		return fmt.Errorf("Unexpected adb server status %q", status)
+	}
+}
+
+// readServerMessage reads a message prefixed by its length in hexadecimal.
+func readServerMessage(r io.Reader) (string, error) {
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(r, size); err != nil {
+		return "", err
+	}
+	n, err := strconv.ParseUint(string(size), 16, 16)
+	if err != nil {
+		return "", fmt.Errorf("Invalid adb server message size %q", size)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return "", err
+	}
+	return string(msg), nil
+}
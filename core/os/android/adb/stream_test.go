@@ -0,0 +1,154 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adb_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android/adb"
+)
+
+// fakeServer is an adb server accepting a single connection, which replies
+// FAIL to the requests in fail, OKAY to the other requests, and then echoes
+// the stream.
+func fakeServer(t *testing.T, fail map[string]string) (requests <-chan string) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	os.Setenv("ANDROID_ADB_SERVER_PORT", strconv.Itoa(l.Addr().(*net.TCPAddr).Port))
+	out := make(chan string, 2)
+	go func() {
+		defer l.Close()
+		defer close(out)
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for i := 0; i < 2; i++ {
+			size := make([]byte, 4)
+			if _, err := io.ReadFull(conn, size); err != nil {
+				return
+			}
+			n, _ := strconv.ParseUint(string(size), 16, 16)
+			req := make([]byte, n)
+			if _, err := io.ReadFull(conn, req); err != nil {
+				return
+			}
+			out <- string(req)
+			if msg, ok := fail[string(req)]; ok {
+				fmt.Fprintf(conn, "FAIL%04x%s", len(msg), msg)
+				return
+			}
+			conn.Write([]byte("OKAY"))
+		}
+		io.Copy(conn, conn)
+	}()
+	return out
+}
+
+func TestDial(t *testing.T) {
+	ctx := log.Testing(t)
+	defer os.Unsetenv("ANDROID_ADB_SERVER_PORT")
+	d := mustConnect(ctx, "production_device")
+
+	requests := fakeServer(t, nil)
+	conn, err := d.Dial(ctx, adb.NamedAbstractSocket("gapir"))
+	if !assert.For(ctx, "Dial").ThatError(err).Succeeded() {
+		return
+	}
+	defer conn.Close()
+	assert.For(ctx, "transport").That(<-requests).Equals("host:transport:production_device")
+	assert.For(ctx, "service").That(<-requests).Equals("localabstract:gapir")
+
+	conn.Write([]byte("ping"))
+	got := make([]byte, 4)
+	_, err = io.ReadFull(conn, got)
+	assert.For(ctx, "Read").ThatError(err).Succeeded()
+	assert.For(ctx, "stream").ThatString(got).Equals("ping")
+
+	fakeServer(t, map[string]string{"localabstract:gapir": "closed"})
+	_, err = d.Dial(ctx, adb.NamedAbstractSocket("gapir"))
+	if assert.For(ctx, "Dial closed socket").ThatError(err).Failed() {
+		assert.For(ctx, "Dial error").ThatString(err.Error()).Contains("adb server: closed")
+	}
+}
+
+func TestDialDeadline(t *testing.T) {
+	ctx := log.Testing(t)
+	defer os.Unsetenv("ANDROID_ADB_SERVER_PORT")
+	d := mustConnect(ctx, "production_device")
+
+	// The deadline of the context only applies to the requests, not to the
+	// stream.
+	fakeServer(t, nil)
+	dialCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	conn, err := d.Dial(dialCtx, adb.NamedAbstractSocket("gapir"))
+	if !assert.For(ctx, "Dial").ThatError(err).Succeeded() {
+		return
+	}
+	defer conn.Close()
+	<-dialCtx.Done()
+	conn.Write([]byte("ping"))
+	got := make([]byte, 4)
+	_, err = io.ReadFull(conn, got)
+	assert.For(ctx, "Read after deadline").ThatError(err).Succeeded()
+
+	// A server which never replies fails the requests once the deadline is
+	// reached.
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer l.Close()
+	os.Setenv("ANDROID_ADB_SERVER_PORT", strconv.Itoa(l.Addr().(*net.TCPAddr).Port))
+	dialCtx, cancel = context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = d.Dial(dialCtx, adb.NamedAbstractSocket("gapir"))
+	assert.For(ctx, "Dial silent server").ThatError(err).Failed()
+}
+
+func TestDialServerSocket(t *testing.T) {
+	ctx := log.Testing(t)
+	defer os.Unsetenv("ANDROID_ADB_SERVER_PORT")
+	defer os.Unsetenv("ADB_SERVER_SOCKET")
+	d := mustConnect(ctx, "production_device")
+
+	requests := fakeServer(t, nil)
+	// ADB_SERVER_SOCKET takes precedence over ANDROID_ADB_SERVER_PORT.
+	os.Setenv("ADB_SERVER_SOCKET", "tcp:localhost:"+os.Getenv("ANDROID_ADB_SERVER_PORT"))
+	os.Setenv("ANDROID_ADB_SERVER_PORT", "1")
+	conn, err := d.Dial(ctx, adb.NamedAbstractSocket("gapir"))
+	if !assert.For(ctx, "Dial").ThatError(err).Succeeded() {
+		return
+	}
+	defer conn.Close()
+	assert.For(ctx, "transport").That(<-requests).Equals("host:transport:production_device")
+
+	os.Setenv("ADB_SERVER_SOCKET", "vsock:1")
+	_, err = d.Dial(ctx, adb.NamedAbstractSocket("gapir"))
+	assert.For(ctx, "Dial unsupported socket").ThatError(err).Failed()
+}
@@ -28,8 +28,11 @@ import (
 
 // Settings for encoding a video with Encode.
 type Settings struct {
-	FPS      int // Frames per second. Default: 30
-	DataRate int // Target bits-per-second. Default: 5000000
+	FPS      int     // Frames per second. Default: 30
+	DataRate int     // Target bits-per-second. Default: 5000000
+	Codec    string  // Name of the encoder's codec, such as libx264. Default: the default codec of the format
+	Format   string  // Container format, such as mp4, webm or mkv. Default: mp4
+	Scale    float64 // Scale of the output resolution relative to the frames. Default: 1
 }
 
 var encoder string
@@ -58,6 +61,12 @@ func Encode(ctx context.Context, settings Settings) (chan<- image.Image, io.Read
 	if settings.FPS == 0 {
 		settings.FPS = 30
 	}
+	if settings.Format == "" {
+		settings.Format = "mp4"
+	}
+	if settings.Scale == 0 {
+		settings.Scale = 1
+	}
 
 	crash.Go(func() {
 		// Get the first frame so we know what we're dealing with.
@@ -85,19 +94,30 @@ func Encode(ctx context.Context, settings Settings) (chan<- image.Image, io.Read
 		stdin, pixels := io.Pipe()
 		defer pixels.Close() // Stops the encoder
 
+		args := []string{
+			"-v", "verbose",
+			"-r", fmt.Sprint(settings.FPS),
+			"-pix_fmt", pixfmt,
+			"-f", "rawvideo",
+			"-s", fmt.Sprintf("%dx%d", frame.Bounds().Dx(), frame.Bounds().Dy()),
+			"-i", "pipe:0", // stdin
+			"-b:v", fmt.Sprint(settings.DataRate),
+		}
+		if settings.Codec != "" {
+			args = append(args, "-c:v", settings.Codec)
+		}
+		if settings.Scale != 1 {
+			// Most codecs require even dimensions.
+			args = append(args, "-vf", fmt.Sprintf("scale=trunc(iw*%[1]v/2)*2:trunc(ih*%[1]v/2)*2", settings.Scale))
+		}
+		args = append(args, "-f", settings.Format)
+		if settings.Format == "mp4" {
+			args = append(args, "-movflags", "frag_keyframe+empty_moov") // fragmented mp4, required for streaming.
+		}
+		args = append(args, "pipe:1") // stdout
+
 		crash.Go(func() {
-			err := shell.Command(encoder,
-				"-v", "verbose",
-				"-r", fmt.Sprint(settings.FPS),
-				"-pix_fmt", pixfmt,
-				"-f", "rawvideo",
-				"-s", fmt.Sprintf("%dx%d", frame.Bounds().Dx(), frame.Bounds().Dy()),
-				"-i", "pipe:0", // stdin
-				"-b:v", fmt.Sprint(settings.DataRate),
-				"-f", "mp4", // output should be a mp4
-				"-movflags", "frag_keyframe+empty_moov", // fragmented mp4, required for streaming.
-				"pipe:1", // stdout
-			).Read(stdin).Capture(mpg, debugWriter).Run(ctx)
+			err := shell.Command(encoder, args...).Read(stdin).Capture(mpg, debugWriter).Run(ctx)
 
 			if err != nil {
 				log.E(ctx, "%v returned error: %v", encoder, err)
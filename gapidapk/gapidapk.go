@@ -66,7 +66,7 @@ func ensureInstalled(ctx context.Context, d adb.Device, abi *device.ABI) (*APK,
 		return nil, log.Errf(ctx, nil, "Device does not support requested abi: %v", abi.Name)
 	}
 
-	name := pkgName(abi)
+	name := PackageName(abi)
 
 	log.I(ctx, "Examining gapid.apk on host...")
 	apkPath, err := layout.GapidApk(ctx, abi)
@@ -186,7 +186,8 @@ func (a APK) LibInterceptorPath(abi *device.ABI) string {
 	return a.LibsPath(abi) + "/libinterceptor.so"
 }
 
-func pkgName(abi *device.ABI) string {
+// PackageName returns the name of the gapid.apk package of the given abi.
+func PackageName(abi *device.ABI) string {
 	switch {
 	case abi.SameAs(device.AndroidARM),
 		abi.SameAs(device.AndroidARMv7a):
@@ -29,7 +29,8 @@ ConnectionHeader::ConnectionHeader()
       mNumFrames(0),
       mAPIs(0xFFFFFFFF),
       mFlags(0),
-      mGvrHandle(0) {}
+      mGvrHandle(0),
+      mStartMarker{} {}
 
 bool ConnectionHeader::read(core::StreamReader* reader) {
   if (!reader->read(mMagic)) {
@@ -49,7 +50,7 @@ bool ConnectionHeader::read(core::StreamReader* reader) {
   }
 
   const int kMinSupportedVersion = 1;
-  const int kMaxSupportedVersion = 1;
+  const int kMaxSupportedVersion = 2;
 
   if (mVersion < kMinSupportedVersion || mVersion > kMaxSupportedVersion) {
     GAPID_WARNING(
@@ -65,6 +66,13 @@ bool ConnectionHeader::read(core::StreamReader* reader) {
     return false;
   }
 
+  if (mVersion >= 2) {
+    if (!reader->read(mStartMarker)) {
+      return false;
+    }
+    mStartMarker[MAX_MARKER - 1] = 0;
+  }
+
   // Insert new version handling here. Don't forget to bump
   // kMaxSupportedVersion!
   return true;
@@ -37,6 +37,7 @@ class ConnectionHeader {
   ConnectionHeader();
 
   static const size_t MAX_PATH = 512;
+  static const size_t MAX_MARKER = 256;
 
   // Fakes no support for PCS, forcing the app to share shader source.
   static const uint32_t FLAG_DISABLE_PRECOMPILED_SHADERS = 0x00000001;
@@ -56,7 +57,7 @@ class ConnectionHeader {
   bool read(core::StreamReader* reader);
 
   uint8_t mMagic[4];                // 's', 'p', 'y', '0'
-  uint32_t mVersion;                // 1
+  uint32_t mVersion;                // 2
   uint32_t mObserveFrameFrequency;  // non-zero == enabled.
   uint32_t mObserveDrawFrequency;   // non-zero == enabled.
   uint32_t mStartFrame;             // non-zero == Frame to start at.
@@ -65,6 +66,7 @@ class ConnectionHeader {
   uint32_t mFlags;                  // Combination of FLAG_XX bits.
   uint64_t mGvrHandle;              // Handle of GVR library.
   char mLibInterceptorPath[MAX_PATH];  // Path of libinterceptor.so.
+  char mStartMarker[MAX_MARKER];       // non-empty == Marker to start at.
 };
 
 }  // namespace gapii
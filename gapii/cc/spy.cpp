@@ -178,6 +178,11 @@ Spy::Spy()
       (header.mFlags & ConnectionHeader::FLAG_DEFER_START)
           ? kSuspendIndefinitely
           : mSuspendCaptureFrames.load());
+  // The capture is suspended until the marker is pushed.
+  mStartMarker = header.mStartMarker;
+  if (!mStartMarker.empty()) {
+    mSuspendCaptureFrames.store(kSuspendIndefinitely);
+  }
 
   set_valid_apis(header.mAPIs);
   GAPID_ERROR("APIS %08x", header.mAPIs);
@@ -188,6 +193,7 @@ Spy::Spy()
              mDisablePrecompiledShaders ? "true" : "false");
   GAPID_INFO("Hide unknown extensions: %s",
              mHideUnknownExtensions ? "true" : "false");
+  GAPID_INFO("Start at debug marker: '%s'", mStartMarker.c_str());
 
   mEncoder = gapii::PackEncoder::create(
       mConnection, header.mFlags & ConnectionHeader::FLAG_NO_BUFFER);
@@ -220,7 +226,7 @@ Spy::Spy()
   SpyBase::init(context);
   exit();
 
-  if (mSuspendCaptureFrames.load() == kSuspendIndefinitely) {
+  if (header.mFlags & ConnectionHeader::FLAG_DEFER_START) {
     mDeferStartJob =
         std::unique_ptr<core::AsyncJob>(new core::AsyncJob([this]() {
           uint32_t buffer;
@@ -477,6 +483,17 @@ void Spy::onPreStartOfFrame(CallObserver* observer, uint8_t api) {
   mNumDrawsPerFrame = 0;
 }
 
+void Spy::onDebugMarker(const std::string& name) {
+  if (mStartMarker.empty() || name.find(mStartMarker) == std::string::npos) {
+    return;
+  }
+  // Start the capture at the next frame, unless it has already started.
+  int suspended = kSuspendIndefinitely;
+  if (mSuspendCaptureFrames.compare_exchange_strong(suspended, 1)) {
+    GAPID_INFO("Debug marker '%s' pushed, starting the capture", name.c_str());
+  }
+}
+
 void Spy::saveInitialState() {
   GAPID_INFO("Saving initial state");
 
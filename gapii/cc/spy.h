@@ -79,6 +79,7 @@ class Spy : public GlesSpy, public GvrSpy, public VulkanSpy {
   void onPreEndOfFrame(CallObserver* observer, uint8_t api) override;
   void onPostEndOfFrame() override;
   void onPostFence(CallObserver* observer) override;
+  void onDebugMarker(const std::string& name) override;
 
   inline void RegisterSymbol(const std::string& name, void* symbol) {
     mSymbols.emplace(name, symbol);
@@ -124,6 +125,8 @@ class Spy : public GlesSpy, public GvrSpy, public VulkanSpy {
 
   // The connection stream to the server
   std::shared_ptr<ConnectionStream> mConnection;
+  // The debug marker after which we want to start the capture, if any.
+  std::string mStartMarker;
   // The number of frames that we want to capture
   int mCaptureFrames;
   int mNumDraws;
@@ -167,6 +167,9 @@ class SpyBase {
   // onPostFence is called immediately after the driver call.
   inline virtual void onPostFence(CallObserver* observer) {}
 
+  // onDebugMarker is called when a debug marker or label is pushed.
+  inline virtual void onDebugMarker(const std::string& name) {}
+
   // The output stream encoder.
   PackEncoder::SPtr mEncoder;
 
@@ -466,6 +466,8 @@ void VulkanSpy::recordFenceReset(CallObserver*, uint64_t) {}
 void VulkanSpy::recordAcquireNextImage(CallObserver*, uint64_t, uint32_t) {}
 void VulkanSpy::recordPresentSwapchainImage(CallObserver*, uint64_t, uint32_t) {
 }
+void VulkanSpy::checkMemoryAliasing(CallObserver*, uint64_t, uint64_t, uint64_t,
+                                    uint64_t) {}
 
 bool VulkanSpy::hasDynamicProperty(CallObserver* observer,
                                    const VkPipelineDynamicStateCreateInfo* info,
@@ -494,7 +496,9 @@ void VulkanSpy::onDeferSubcommand(CallObserver*, gapil::Ref<CommandReference>) {
 }
 void VulkanSpy::onCommandAdded(CallObserver*, VkCommandBuffer) {}
 void VulkanSpy::postBindSparse(CallObserver*, gapil::Ref<QueuedSparseBinds>) {}
-void VulkanSpy::pushDebugMarker(CallObserver*, std::string) {}
+void VulkanSpy::pushDebugMarker(CallObserver*, std::string name) {
+  onDebugMarker(name);
+}
 void VulkanSpy::popDebugMarker(CallObserver*) {}
 void VulkanSpy::pushRenderPassMarker(CallObserver*, VkRenderPass) {}
 void VulkanSpy::popRenderPassMarker(CallObserver*) {}
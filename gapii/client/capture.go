@@ -84,6 +84,9 @@ type Options struct {
 	AdditionalFlags string
 	// The name of the pipe to connect/listen to.
 	PipeName string
+	// If non-empty, then the capture will only start at the frame after a
+	// debug marker containing the text is pushed.
+	StartMarker string
 }
 
 const sizeGap = 1024 * 1024 * 5
@@ -23,22 +23,25 @@ import (
 
 var magic = [4]byte{'s', 'p', 'y', '0'}
 
-const version = 1
+const version = 2
 
 // The GAPII header is defined as:
 //
 // const size_t MAX_PATH = 512;
+// const size_t MAX_MARKER = 256;
 //
 // struct ConnectionHeader {
 //     uint8_t  mMagic[4];                     // 's', 'p', 'y', '0'
-//     uint32_t mVersion;                      // 1
+//     uint32_t mVersion;                      // 2
 //     uint32_t mObserveFrameFrequency;        // non-zero == enabled.
 //     uint32_t mObserveDrawFrequency;         // non-zero == enabled.
 //     uint32_t mStartFrame;                   // non-zero == Frame to start at.
 //     uint32_t mNumFrames;                    // non-zero == Number of frames to capture.
 //     uint32_t mAPIs;                         // Bitset of APIS to enable.
 //     uint32_t mFlags;                        // Combination of FLAG_XX bits.
+//     uint64_t mGvrHandle;                    // Handle of GVR library.
 //     char     mLibInterceptorPath[MAX_PATH]; // Path to libinterceptor.so
+//     char     mStartMarker[MAX_MARKER];      // non-empty == Debug marker to start at.
 // };
 //
 // All fields are encoded little-endian with no compression, regardless of
@@ -47,6 +50,7 @@ const version = 1
 
 func sendHeader(out io.Writer, options Options, gvrHandle uint64, libInterceptorPath string) error {
 	const maxPath = 512
+	const maxMarker = 256
 	w := endian.Writer(out, device.LittleEndian)
 	for _, m := range magic {
 		w.Uint8(m)
@@ -62,5 +66,8 @@ func sendHeader(out io.Writer, options Options, gvrHandle uint64, libInterceptor
 	var path [maxPath]byte
 	copy(path[:], libInterceptorPath)
 	w.Data(path[:])
+	var marker [maxMarker]byte
+	copy(marker[:maxMarker-1], options.StartMarker)
+	w.Data(marker[:])
 	return w.Error()
 }
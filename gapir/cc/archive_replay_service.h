@@ -63,6 +63,11 @@ class ArchiveReplayService : public ReplayService {
     return true;
   }
 
+  virtual bool sendCommandTimings(
+      const std::unordered_map<uint32_t, uint64_t>& timings) override {
+    return true;
+  }
+
  private:
   std::string mFilePrefix;
   std::string mPostbackDir;
@@ -17,11 +17,84 @@
 #include "cached_resource_loader.h"
 #include "resource.h"
 
+#include "gapir/replay_service/service.pb.h"
+
+#include <string.h>
+
+#include <string>
 #include <utility>
 #include <vector>
 
 namespace gapir {
 
+std::unique_ptr<ReplayService::Resources> CachedResourceLoader::fetch(
+    const Resource* resources, size_t count) {
+  std::vector<bool> cached(count);
+  std::vector<Resource> uncached;
+  size_t totalSize = 0;
+  size_t uncachedSize = 0;
+  for (size_t i = 0; i < count; i++) {
+    const auto& r = resources[i];
+    cached[i] = mCache->hasCache(r);
+    if (!cached[i]) {
+      uncached.push_back(r);
+      uncachedSize += r.size;
+    }
+    totalSize += r.size;
+  }
+  if (uncached.size() > 0 && mFallbackLoader == nullptr) {
+    return nullptr;
+  }
+
+  // Load the cached resources first, as putting the fetched resources to the
+  // cache may evict them.
+  std::unique_ptr<replay_service::Resources> merged;
+  if (uncached.size() != count) {
+    merged.reset(new replay_service::Resources());
+    merged->mutable_data()->resize(totalSize);
+    uint8_t* dst = reinterpret_cast<uint8_t*>(&(*merged->mutable_data())[0]);
+    for (size_t i = 0; i < count; i++) {
+      const auto& r = resources[i];
+      if (cached[i] && !mCache->loadCache(r, dst)) {
+        return nullptr;
+      }
+      dst += r.size;
+    }
+  }
+
+  std::unique_ptr<ReplayService::Resources> fetched;
+  if (uncached.size() > 0) {
+    fetched = mFallbackLoader->fetch(uncached.data(), uncached.size());
+    if (fetched == nullptr || fetched->size() != uncachedSize) {
+      return nullptr;
+    }
+    const uint8_t* src = reinterpret_cast<const uint8_t*>(fetched->data());
+    for (const auto& r : uncached) {
+      mCache->putCache(r, src);
+      src += r.size;
+    }
+  }
+  if (merged == nullptr) {
+    return fetched;
+  }
+
+  // Fill in the fetched resources.
+  if (fetched != nullptr) {
+    uint8_t* dst = reinterpret_cast<uint8_t*>(&(*merged->mutable_data())[0]);
+    const uint8_t* src = reinterpret_cast<const uint8_t*>(fetched->data());
+    for (size_t i = 0; i < count; i++) {
+      const auto& r = resources[i];
+      if (!cached[i]) {
+        memcpy(dst, src, r.size);
+        src += r.size;
+      }
+      dst += r.size;
+    }
+  }
+  return std::unique_ptr<ReplayService::Resources>(
+      new ReplayService::Resources(std::move(merged)));
+}
+
 bool CachedResourceLoader::loadBatch(const ResourceLoadingBatch& bat) {
   if (bat.size() == 0) {
     return true;
@@ -33,12 +106,6 @@ bool CachedResourceLoader::loadBatch(const ResourceLoadingBatch& bat) {
   if (res->size() != bat.size()) {
     return false;
   }
-  size_t readSize = 0;
-  for (const auto r : bat.resources()) {
-    mCache->putCache(r,
-                     reinterpret_cast<const uint8_t*>(res->data()) + readSize);
-    readSize += r.size;
-  }
   const uint8_t* src = reinterpret_cast<const uint8_t*>(res->data());
   for (const auto dsp : bat.dstsAndSizes()) {
     memcpy(dsp.first, src, dsp.second);
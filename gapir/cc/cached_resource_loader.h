@@ -43,23 +43,19 @@ class CachedResourceLoader : public ResourceLoader {
   virtual bool load(const Resource* resources, size_t count, void* target,
                     size_t targetSize) override;
 
-  // Fetch defers the resources to the fallback loader to fetch the
-  // ReplayService::Resource instance.
+  // Fetch loads the cached resources from its cache, and uses its fallback
+  // loader to fetch the uncached resources, which are put to its cache. This
+  // allows a CachedResourceLoader to be the fallback loader of another one.
   virtual std::unique_ptr<ReplayService::Resources> fetch(
-      const Resource* resources, size_t count) override {
-    if (mFallbackLoader != nullptr) {
-      return mFallbackLoader->fetch(resources, count);
-    }
-    return nullptr;
-  }
+      const Resource* resources, size_t count) override;
 
   // Accessors
   ResourceCache* getCache() { return mCache; }
   ResourceLoader* getFallbackResourceLoader() { return mFallbackLoader.get(); }
 
  protected:
-  // loadBatch fetches the resources in the Batch, put the fetched resources to
-  // cache, then load the data to their corresponding destinations.
+  // loadBatch fetches the resources in the Batch, which puts the fetched
+  // resources to cache, then load the data to their corresponding destinations.
   bool loadBatch(const ResourceLoadingBatch& bat);
 
  private:
@@ -103,7 +103,7 @@ bool Context::initialize() {
   return true;
 }
 
-void Context::prefetch(ResourceCache* cache) const {
+void Context::prefetch(ResourceCache* cache, ResourceLoader* fetcher) const {
   auto cacheSize = static_cast<uint32_t>(mMemoryManager->getFreeSpace());
   cache->resize(cacheSize);
   auto resources = mReplayRequest->getResources();
@@ -111,8 +111,7 @@ void Context::prefetch(ResourceCache* cache) const {
     return;
   }
 
-  auto tempLoader = PassThroughResourceLoader::create(mSrv);
-  cache->prefetch(resources.data(), resources.size(), tempLoader.get());
+  cache->prefetch(resources.data(), resources.size(), fetcher);
 }
 
 bool Context::interpret() {
@@ -136,9 +135,15 @@ bool Context::interpret() {
                                      mReplayRequest->getStackSize(),
                                      std::move(callback)));
   registerCallbacks(mInterpreter.get());
+  if (mReplayRequest->getTimeCommands()) {
+    mInterpreter->enableCommandTimings();
+  }
   auto instAndCount = mReplayRequest->getInstructionList();
   auto res = mInterpreter->run(instAndCount.first, instAndCount.second) &&
              mPostBuffer->flush();
+  if (mReplayRequest->getTimeCommands() && mSrv != nullptr) {
+    res = mSrv->sendCommandTimings(mInterpreter->getCommandTimings()) && res;
+  }
   mInterpreter.reset(nullptr);
   return res;
 }
@@ -55,7 +55,9 @@ class Context : private Renderer::Listener {
 
   ~Context();
 
-  void prefetch(ResourceCache* cache) const;
+  // Prefetches the resources of the replay request to the cache, fetching
+  // them with the fetcher.
+  void prefetch(ResourceCache* cache, ResourceLoader* fetcher) const;
 
   // Run the interpreter over the opcode stream of the replay request and
   // returns true if the interpretation was successful false otherwise
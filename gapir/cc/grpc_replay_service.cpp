@@ -15,9 +15,12 @@
  */
 
 #include "grpc_replay_service.h"
+#include "lz4.h"
 
 #include <grpc++/grpc++.h>
+#include <zlib.h>
 #include <memory>
+#include <string>
 
 #include "core/cc/log.h"
 #include "gapir/replay_service/service.grpc.pb.h"
@@ -26,10 +29,59 @@
 
 namespace gapir {
 
+namespace {
+
+// Decompresses the data of the resources in place. Returns true if succeeded,
+// otherwise returns false.
+bool decompress(replay_service::Resources* resources) {
+  switch (resources->compression()) {
+    case replay_service::NoCompression:
+      return true;
+    case replay_service::ZlibCompression: {
+      std::string data(resources->uncompressed_size(), '\0');
+      uLongf size = data.size();
+      auto err = uncompress(
+          reinterpret_cast<Bytef*>(&data[0]), &size,
+          reinterpret_cast<const Bytef*>(resources->data().data()),
+          resources->data().size());
+      if (err != Z_OK || size != data.size()) {
+        GAPID_ERROR("Failed to decompress resources: %d (size: %lu/%zu)", err,
+                    size, data.size());
+        return false;
+      }
+      resources->set_data(std::move(data));
+      resources->set_compression(replay_service::NoCompression);
+      return true;
+    }
+    case replay_service::Lz4Compression: {
+      std::string data(resources->uncompressed_size(), '\0');
+      if (!decompressLZ4(resources->data(), &data)) {
+        GAPID_ERROR("Failed to decompress LZ4 resources (size: %zu)",
+                    data.size());
+        return false;
+      }
+      resources->set_data(std::move(data));
+      resources->set_compression(replay_service::NoCompression);
+      return true;
+    }
+    default:
+      GAPID_ERROR("Unsupported resources compression: %d",
+                  resources->compression());
+      return false;
+  }
+}
+
+}  // anonymous namespace
+
 std::unique_ptr<ReplayService::Payload> GrpcReplayService::getPayload() {
   // Send a replay response with payload request
   replay_service::ReplayResponse res;
   res.set_allocated_payload_request(new replay_service::PayloadRequest());
+  // The hosts prefer LZ4, zlib is only kept for the hosts not supporting it.
+  res.mutable_payload_request()->add_resource_compressions(
+      replay_service::Lz4Compression);
+  res.mutable_payload_request()->add_resource_compressions(
+      replay_service::ZlibCompression);
   mGrpcStream->Write(res);
   std::unique_ptr<replay_service::ReplayRequest> req(
       new replay_service::ReplayRequest());
@@ -68,6 +120,9 @@ std::unique_ptr<ReplayService::Resources> GrpcReplayService::getResources(
   if (req->req_case() != replay_service::ReplayRequest::kResources) {
     return nullptr;
   }
+  if (!decompress(req->mutable_resources())) {
+    return nullptr;
+  }
   return std::unique_ptr<ReplayService::Resources>(new ReplayService::Resources(
       std::unique_ptr<replay_service::Resources>(req->release_resources())));
 }
@@ -118,4 +173,16 @@ bool GrpcReplayService::sendNotification(uint64_t id, uint32_t severity,
   return mGrpcStream->Write(res);
 }
 
+bool GrpcReplayService::sendCommandTimings(
+    const std::unordered_map<uint32_t, uint64_t>& timings) {
+  replay_service::ReplayResponse res;
+  auto* commandTimings = res.mutable_command_timings();
+  for (const auto& it : timings) {
+    auto* timing = commandTimings->add_timings();
+    timing->set_label(it.first);
+    timing->set_cpu_time_ns(it.second);
+  }
+  return mGrpcStream->Write(res);
+}
+
 }  // namespace gapir
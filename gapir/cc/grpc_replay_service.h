@@ -22,6 +22,7 @@
 
 #include <memory>
 #include <string>
+#include <unordered_map>
 
 namespace grpc {
 template <typename RES, typename REQ>
@@ -85,6 +86,10 @@ class GrpcReplayService : public ReplayService {
                                 uint32_t api_index, uint64_t label,
                                 const std::string& msg, const void* data,
                                 uint32_t data_size) override;
+  // Sends the CPU time spent on each command. Returns true if succeeded,
+  // otherwise returns false.
+  virtual bool sendCommandTimings(
+      const std::unordered_map<uint32_t, uint64_t>& timings) override;
 
  protected:
   GrpcReplayService(ReplayGrpcStream* stream) : mGrpcStream(stream) {}
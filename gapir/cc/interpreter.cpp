@@ -19,6 +19,7 @@
 
 #include "core/cc/crash_handler.h"
 #include "core/cc/log.h"
+#include "core/cc/timer.h"
 
 #define __STDC_FORMAT_MACROS
 #include <inttypes.h>
@@ -56,6 +57,60 @@ inline bool sum(Stack& stack, uint32_t count) {
   return stack.isValid();
 }
 
+template <typename T>
+inline bool product(Stack& stack, uint32_t count) {
+  T v = 1;
+  for (uint32_t i = 0; i < count; i++) {
+    v = static_cast<T>(v * stack.pop<T>());
+  }
+  stack.push(v);
+  return stack.isValid();
+}
+
+// Pops the integer value from the top of the stack as a byte offset. Returns
+// false if the value is not an integer.
+inline bool popOffset(Stack& stack, int64_t* offset) {
+  auto type = stack.getTopType();
+  switch (type) {
+    case BaseType::Int8:
+      *offset = stack.pop<int8_t>();
+      break;
+    case BaseType::Int16:
+      *offset = stack.pop<int16_t>();
+      break;
+    case BaseType::Int32:
+      *offset = stack.pop<int32_t>();
+      break;
+    case BaseType::Int64:
+      *offset = stack.pop<int64_t>();
+      break;
+    case BaseType::Uint8:
+      *offset = stack.pop<uint8_t>();
+      break;
+    case BaseType::Uint16:
+      *offset = stack.pop<uint16_t>();
+      break;
+    case BaseType::Uint32:
+      *offset = stack.pop<uint32_t>();
+      break;
+    case BaseType::Uint64:
+      *offset = static_cast<int64_t>(stack.pop<uint64_t>());
+      break;
+    default:
+      GAPID_WARNING("Cannot use a value of type %s as an offset",
+                    baseTypeName(type));
+      return false;
+  }
+  return stack.isValid();
+}
+
+// Returns the address offset bytes from address.
+template <typename T>
+inline T* offsetAddress(T* address, int64_t offset) {
+  return reinterpret_cast<T*>(reinterpret_cast<uintptr_t>(address) +
+                              static_cast<uintptr_t>(offset));
+}
+
 }  // anonymous namespace
 
 Interpreter::Interpreter(core::CrashHandler& crash_handler,
@@ -71,7 +126,9 @@ Interpreter::Interpreter(core::CrashHandler& crash_handler,
       mInstructionCount(0),
       mCurrentInstruction(0),
       mNextThread(0),
-      mLabel(0) {
+      mLabel(0),
+      mTimeCommands(false),
+      mLabelStart(0) {
   registerBuiltin(GLOBAL_INDEX, PRINT_STACK_FUNCTION_ID,
                   [](uint32_t, Stack* stack, bool) {
                     stack->printStack();
@@ -99,6 +156,9 @@ bool Interpreter::run(const uint32_t* instructions, uint32_t count) {
   GAPID_ASSERT(mCurrentInstruction == 0);
   mInstructions = instructions;
   mInstructionCount = count;
+  if (mTimeCommands) {
+    mLabelStart = core::GetNanoseconds();
+  }
   auto unregisterHandler = mCrashHandler.registerHandler(
       [this](const std::string& minidumpPath, bool succeeded) {
         GAPID_ERROR("--- CRASH DURING REPLAY ---");
@@ -107,7 +167,11 @@ bool Interpreter::run(const uint32_t* instructions, uint32_t count) {
       });
   exec();
   unregisterHandler();
-  return mExecResult.get_future().get() == SUCCESS;
+  auto res = mExecResult.get_future().get() == SUCCESS;
+  if (mTimeCommands) {
+    updateCommandTiming();
+  }
+  return res;
 }
 
 void Interpreter::exec() {
@@ -283,11 +347,21 @@ Interpreter::Result Interpreter::store() {
 
 Interpreter::Result Interpreter::resource(uint32_t opcode) {
   mStack.push<uint32_t>(extract26bitData(opcode));
-  return this->call(Interpreter::RESOURCE_FUNCTION_ID);
+  return this->callUntimed(Interpreter::RESOURCE_FUNCTION_ID);
 }
 
 Interpreter::Result Interpreter::post() {
-  return this->call(Interpreter::POST_FUNCTION_ID);
+  return this->callUntimed(Interpreter::POST_FUNCTION_ID);
+}
+
+Interpreter::Result Interpreter::callUntimed(uint32_t opcode) {
+  if (!mTimeCommands) {
+    return this->call(opcode);
+  }
+  auto start = core::GetNanoseconds();
+  auto res = this->call(opcode);
+  mLabelStart += core::GetNanoseconds() - start;
+  return res;
 }
 
 Interpreter::Result Interpreter::copy(uint32_t opcode) {
@@ -447,10 +521,19 @@ Interpreter::Result Interpreter::add(uint32_t opcode) {
 }
 
 Interpreter::Result Interpreter::label(uint32_t opcode) {
+  if (mTimeCommands) {
+    updateCommandTiming();
+  }
   mLabel = extract26bitData(opcode);
   return SUCCESS;
 }
 
+void Interpreter::updateCommandTiming() {
+  auto now = core::GetNanoseconds();
+  mCommandTimings[mLabel] += now - mLabelStart;
+  mLabelStart = now;
+}
+
 Interpreter::Result Interpreter::switchThread(uint32_t opcode) {
   auto thread = extract26bitData(opcode);
   GAPID_DEBUG("Switch thread %d -> %d", mNextThread, thread);
@@ -458,6 +541,129 @@ Interpreter::Result Interpreter::switchThread(uint32_t opcode) {
   return CHANGE_THREAD;
 }
 
+Interpreter::Result Interpreter::mul(uint32_t opcode) {
+  uint32_t count = extract26bitData(opcode);
+  if (count < 2) {
+    return mStack.isValid() ? SUCCESS : ERROR;
+  }
+  auto type = mStack.getTopType();
+  bool ok = false;
+  switch (type) {
+    case BaseType::Int8: {
+      ok = product<int8_t>(mStack, count);
+      break;
+    }
+    case BaseType::Int16: {
+      ok = product<int16_t>(mStack, count);
+      break;
+    }
+    case BaseType::Int32: {
+      ok = product<int32_t>(mStack, count);
+      break;
+    }
+    case BaseType::Int64: {
+      ok = product<int64_t>(mStack, count);
+      break;
+    }
+    case BaseType::Uint8: {
+      ok = product<uint8_t>(mStack, count);
+      break;
+    }
+    case BaseType::Uint16: {
+      ok = product<uint16_t>(mStack, count);
+      break;
+    }
+    case BaseType::Uint32: {
+      ok = product<uint32_t>(mStack, count);
+      break;
+    }
+    case BaseType::Uint64: {
+      ok = product<uint64_t>(mStack, count);
+      break;
+    }
+    case BaseType::Float: {
+      ok = product<float>(mStack, count);
+      break;
+    }
+    case BaseType::Double: {
+      ok = product<double>(mStack, count);
+      break;
+    }
+    default:
+      GAPID_WARNING("Cannot multiply values of type %s", baseTypeName(type));
+      return ERROR;
+  }
+  return ok ? SUCCESS : ERROR;
+}
+
+Interpreter::Result Interpreter::loadOffset(uint32_t opcode) {
+  BaseType type = extractType(opcode);
+  if (!isValid(type)) {
+    GAPID_WARNING("Error: loadOffset basic type invalid %u",
+                  (unsigned int)type);
+    return ERROR;
+  }
+  int64_t offset = 0;
+  if (!popOffset(mStack, &offset)) {
+    return ERROR;
+  }
+  const void* base = mStack.pop<const void*>();
+  if (base == nullptr) {
+    GAPID_WARNING("Error: loadOffset base address is null");
+    return ERROR;
+  }
+  const void* address = offsetAddress(base, offset);
+  if (!isReadAddress(address)) {
+    GAPID_WARNING("Error: loadOffset not readable address %p", address);
+    return ERROR;
+  }
+  mStack.pushFrom(type, address);
+  return mStack.isValid() ? SUCCESS : ERROR;
+}
+
+Interpreter::Result Interpreter::storeOffset() {
+  int64_t offset = 0;
+  if (!popOffset(mStack, &offset)) {
+    return ERROR;
+  }
+  void* base = mStack.pop<void*>();
+  if (base == nullptr) {
+    GAPID_WARNING("Error: storeOffset base address is null");
+    return ERROR;
+  }
+  void* address = offsetAddress(base, offset);
+  if (!isWriteAddress(address)) {
+    GAPID_WARNING("Error: storeOffset not write address %p", address);
+    return ERROR;
+  }
+  mStack.popTo(address);
+  return mStack.isValid() ? SUCCESS : ERROR;
+}
+
+Interpreter::Result Interpreter::jump(uint32_t opcode, bool ifZero) {
+  uint32_t count = extract26bitData(opcode);
+  auto type = mStack.getTopType();
+  auto value = mStack.popBaseValue();
+  if (!mStack.isValid()) {
+    return ERROR;
+  }
+  // Only the bytes of the type are set in the value.
+  uint32_t size = baseTypeSize(type);
+  if (size < sizeof(value)) {
+    value &= (Stack::BaseValue(1) << (size * 8)) - 1;
+  }
+  if ((value == 0) != ifZero) {
+    return SUCCESS;
+  }
+  if (count >= mInstructionCount - mCurrentInstruction) {
+    GAPID_WARNING("Error: jump over %u instructions past the end", count);
+    return ERROR;
+  }
+  // The skipped instructions are the ones following the jump.
+  mCurrentInstruction += count;
+  return SUCCESS;
+}
+
 #define DEBUG_OPCODE(name, value) GAPID_VERBOSE(name)
 #define DEBUG_OPCODE_26(name, value) \
   GAPID_VERBOSE(name "(%#010x)", value& DATA_MASK26)
@@ -520,6 +726,21 @@ Interpreter::Result Interpreter::interpret(uint32_t opcode) {
     case InstructionCode::SWITCH_THREAD:
       DEBUG_OPCODE_26("SWITCH_THREAD", opcode);
       return this->switchThread(opcode);
+    case InstructionCode::MUL:
+      DEBUG_OPCODE_26("MUL", opcode);
+      return this->mul(opcode);
+    case InstructionCode::LOAD_OFFSET:
+      DEBUG_OPCODE_TY_20("LOAD_OFFSET", opcode);
+      return this->loadOffset(opcode);
+    case InstructionCode::STORE_OFFSET:
+      DEBUG_OPCODE("STORE_OFFSET", opcode);
+      return this->storeOffset();
+    case InstructionCode::JUMP_Z:
+      DEBUG_OPCODE_26("JUMP_Z", opcode);
+      return this->jump(opcode, true);
+    case InstructionCode::JUMP_NZ:
+      DEBUG_OPCODE_26("JUMP_NZ", opcode);
+      return this->jump(opcode, false);
     default:
       GAPID_WARNING("Unknown opcode! %#010x", opcode);
       return ERROR;
@@ -88,6 +88,16 @@ class Interpreter {
   // Returns the last reached label value.
   inline uint32_t getLabel() const;
 
+  // Enables the measurement of the time spent between reaching a label and
+  // reaching the next one, excluding the time spent fetching the resources and
+  // posting back data.
+  inline void enableCommandTimings();
+
+  // Returns the time in nanoseconds spent on each reached label, if the
+  // measurement was enabled.
+  inline const std::unordered_map<uint32_t, uint64_t>& getCommandTimings()
+      const;
+
  private:
   void exec();
 
@@ -137,6 +147,10 @@ class Interpreter {
   Result add(uint32_t opcode);
   Result label(uint32_t opcode);
   Result switchThread(uint32_t opcode);
+  Result mul(uint32_t opcode);
+  Result loadOffset(uint32_t opcode);
+  Result storeOffset();
+  Result jump(uint32_t opcode, bool ifZero);
 
   // Returns true, if address..address+size(type) is "constant" memory.
   bool isConstantAddressForType(const void* address, BaseType type) const;
@@ -153,6 +167,14 @@ class Interpreter {
   // Interpret one specific opcode.
   Result interpret(uint32_t opcode);
 
+  // Adds the time spent since the last label was reached to its timing.
+  void updateCommandTiming();
+
+  // Calls the builtin function, excluding the time spent in it from the
+  // timing of the last label, so that the resource fetches and the postbacks
+  // are not counted as the time of the commands.
+  Result callUntimed(uint32_t opcode);
+
   // The crash handler used for catching and reporting crashes.
   core::CrashHandler& mCrashHandler;
 
@@ -186,6 +208,15 @@ class Interpreter {
   // The last reached label value.
   uint32_t mLabel;
 
+  // Whether the time spent on each label is measured.
+  bool mTimeCommands;
+
+  // The time in nanoseconds at which the last label was reached.
+  uint64_t mLabelStart;
+
+  // The accumulated time in nanoseconds spent on each label.
+  std::unordered_map<uint32_t, uint64_t> mCommandTimings;
+
   // The result of the thread-chained exec() calls.
   std::promise<Result> mExecResult;
 
@@ -218,6 +249,13 @@ inline bool Interpreter::isWriteAddress(void* address) const {
 
 inline uint32_t Interpreter::getLabel() const { return mLabel; }
 
+inline void Interpreter::enableCommandTimings() { mTimeCommands = true; }
+
+inline const std::unordered_map<uint32_t, uint64_t>&
+Interpreter::getCommandTimings() const {
+  return mCommandTimings;
+}
+
 }  // namespace gapir
 
 #endif  // GAPIR_INTERPRETER_H
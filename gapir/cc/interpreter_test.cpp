@@ -299,6 +299,100 @@ TEST_F(InterpreterTest, Add3xFloat) {
   EXPECT_TRUE(res);
 }
 
+TEST_F(InterpreterTest, Mul2xUint64) {
+  mInterpreter->registerBuiltin(0, 0,
+                                CheckTopOfStack<uint64_t>{0x300000000ULL});
+
+  std::vector<uint32_t> instructions{
+      instruction(Interpreter::InstructionCode::PUSH_I, BaseType::Uint64,
+                  0x40),
+      instruction(Interpreter::InstructionCode::EXTEND, 0),  // 1 << 32
+      instruction(Interpreter::InstructionCode::PUSH_I, BaseType::Uint64, 3),
+      instruction(Interpreter::InstructionCode::MUL, 2),
+      instruction(Interpreter::InstructionCode::CALL, 0)};
+  bool res = mInterpreter->run(instructions.data(), instructions.size());
+  EXPECT_TRUE(res);
+}
+
+TEST_F(InterpreterTest, LoadOffset) {
+  *static_cast<int32_t*>(mMemoryManager->volatileToAbsolute(788)) = -987654321;
+  mInterpreter->registerBuiltin(0, 0, CheckTopOfStack<int32_t>{-987654321});
+
+  std::vector<uint32_t> instructions{
+      instruction(Interpreter::InstructionCode::PUSH_I,
+                  BaseType::VolatilePointer, 780),
+      instruction(Interpreter::InstructionCode::PUSH_I, BaseType::Uint64, 8),
+      instruction(Interpreter::InstructionCode::LOAD_OFFSET, BaseType::Int32,
+                  0),
+      instruction(Interpreter::InstructionCode::CALL, 0)};
+  bool res = mInterpreter->run(instructions.data(), instructions.size());
+  EXPECT_TRUE(res);
+}
+
+TEST_F(InterpreterTest, StoreOffset) {
+  std::vector<uint32_t> instructions{
+      instruction(Interpreter::InstructionCode::PUSH_I, BaseType::Uint32,
+                  987654),
+      instruction(Interpreter::InstructionCode::PUSH_I,
+                  BaseType::VolatilePointer, 264),
+      instruction(Interpreter::InstructionCode::PUSH_I, BaseType::Int32,
+                  0xffffc),  // -4
+      instruction(Interpreter::InstructionCode::STORE_OFFSET)};
+  bool res = mInterpreter->run(instructions.data(), instructions.size());
+  EXPECT_TRUE(res);
+
+  EXPECT_EQ(987654,
+            *static_cast<uint32_t*>(mMemoryManager->volatileToAbsolute(260)));
+}
+
+TEST_F(InterpreterTest, JumpZ) {
+  uint32_t callCount = 0;
+  mInterpreter->registerBuiltin(0, 0, [&callCount](uint32_t, Stack*, bool) {
+    ++callCount;
+    return true;
+  });
+
+  std::vector<uint32_t> instructions{
+      instruction(Interpreter::InstructionCode::PUSH_I, BaseType::Bool, 0),
+      instruction(Interpreter::InstructionCode::JUMP_Z, 1),
+      instruction(Interpreter::InstructionCode::CALL, 0),
+      instruction(Interpreter::InstructionCode::PUSH_I, BaseType::Bool, 1),
+      instruction(Interpreter::InstructionCode::JUMP_Z, 1),
+      instruction(Interpreter::InstructionCode::CALL, 0)};
+  bool res = mInterpreter->run(instructions.data(), instructions.size());
+  EXPECT_TRUE(res);
+  EXPECT_EQ(1, callCount);
+}
+
+TEST_F(InterpreterTest, JumpNZ) {
+  uint32_t callCount = 0;
+  mInterpreter->registerBuiltin(0, 0, [&callCount](uint32_t, Stack*, bool) {
+    ++callCount;
+    return true;
+  });
+
+  std::vector<uint32_t> instructions{
+      instruction(Interpreter::InstructionCode::PUSH_I, BaseType::Uint32, 0),
+      instruction(Interpreter::InstructionCode::JUMP_NZ, 1),
+      instruction(Interpreter::InstructionCode::CALL, 0),
+      instruction(Interpreter::InstructionCode::PUSH_I, BaseType::Uint32, 2),
+      instruction(Interpreter::InstructionCode::JUMP_NZ, 2),
+      instruction(Interpreter::InstructionCode::CALL, 0),
+      instruction(Interpreter::InstructionCode::CALL, 0)};
+  bool res = mInterpreter->run(instructions.data(), instructions.size());
+  EXPECT_TRUE(res);
+  EXPECT_EQ(1, callCount);
+}
+
+TEST_F(InterpreterTest, JumpPastTheEnd) {
+  std::vector<uint32_t> instructions{
+      instruction(Interpreter::InstructionCode::PUSH_I, BaseType::Bool, 0),
+      instruction(Interpreter::InstructionCode::JUMP_Z, 2),
+      instruction(Interpreter::InstructionCode::POP, 0)};
+  bool res = mInterpreter->run(instructions.data(), instructions.size());
+  EXPECT_FALSE(res);
+}
+
 TEST_F(InterpreterTest, Strcpy) {
   uint8_t const_memory[20] = {};
   const char* constantMemory = "abc";
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2018 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+#include "lz4.h"
+
+#include <cstdint>
+#include <cstring>
+
+namespace gapir {
+
+bool decompressLZ4(const std::string& src, std::string* dst) {
+  auto in = reinterpret_cast<const uint8_t*>(src.data());
+  auto inEnd = in + src.size();
+  auto outStart = reinterpret_cast<uint8_t*>(&(*dst)[0]);
+  auto out = outStart;
+  auto outEnd = outStart + dst->size();
+
+  // Reads the bytes extending a literal or match length.
+  auto readLength = [&](size_t* length) {
+    uint8_t b;
+    do {
+      if (in >= inEnd) {
+        return false;
+      }
+      b = *in++;
+      *length += b;
+    } while (b == 255);
+    return true;
+  };
+
+  while (in < inEnd) {
+    uint8_t token = *in++;
+    size_t literals = token >> 4;
+    if (literals == 15 && !readLength(&literals)) {
+      return false;
+    }
+    if (literals > size_t(inEnd - in) || literals > size_t(outEnd - out)) {
+      return false;
+    }
+    memcpy(out, in, literals);
+    in += literals;
+    out += literals;
+    if (in == inEnd) {
+      // The last sequence has no match.
+      break;
+    }
+
+    if (inEnd - in < 2) {
+      return false;
+    }
+    size_t offset = size_t(in[0]) | (size_t(in[1]) << 8);
+    in += 2;
+    size_t length = token & 15;
+    if (length == 15 && !readLength(&length)) {
+      return false;
+    }
+    length += 4;
+    if (offset == 0 || offset > size_t(out - outStart) ||
+        length > size_t(outEnd - out)) {
+      return false;
+    }
+    // The match may overlap the bytes it writes, so it is copied byte by byte.
+    for (auto match = out - offset; length > 0; length--) {
+      *out++ = *match++;
+    }
+  }
+  return out == outEnd;
+}
+
+}  // namespace gapir
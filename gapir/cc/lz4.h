@@ -0,0 +1,32 @@
+/*
+ * Copyright (C) 2018 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+#ifndef GAPIR_LZ4_H
+#define GAPIR_LZ4_H
+
+#include <string>
+
+namespace gapir {
+
+// Decompresses the src data in the LZ4 block format, without the LZ4 frame, to
+// dst, which must have the size of the decompressed data. Returns true if
+// succeeded, otherwise returns false, including when the data is corrupt or
+// does not decompress to exactly the size of dst.
+bool decompressLZ4(const std::string& src, std::string* dst);
+
+}  // namespace gapir
+
+#endif  // GAPIR_LZ4_H
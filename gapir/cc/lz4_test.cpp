@@ -0,0 +1,99 @@
+/*
+ * Copyright (C) 2018 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+#include "lz4.h"
+
+#include <gtest/gtest.h>
+
+#include <string>
+
+namespace gapir {
+namespace test {
+namespace {
+
+// Decompresses the given LZ4 block to the given size. Returns true and sets
+// out if succeeded.
+bool decompress(const std::string& block, size_t size, std::string* out) {
+  std::string data(size, '\0');
+  if (!decompressLZ4(block, &data)) {
+    return false;
+  }
+  *out = data;
+  return true;
+}
+
+}  // anonymous namespace
+
+TEST(LZ4Test, Literals) {
+  std::string out;
+  EXPECT_TRUE(decompress(std::string("\x50hello", 6), 5, &out));
+  EXPECT_EQ("hello", out);
+}
+
+TEST(LZ4Test, Empty) {
+  std::string out;
+  EXPECT_TRUE(decompress(std::string("\x00", 1), 0, &out));
+  EXPECT_EQ("", out);
+}
+
+TEST(LZ4Test, OverlappingMatch) {
+  // "ab" followed by a match of 8 bytes at offset 2, and the last literals.
+  std::string block("\x24"
+                    "ab"
+                    "\x02\x00"
+                    "\x50"
+                    "cdefg",
+                    11);
+  std::string out;
+  EXPECT_TRUE(decompress(block, 15, &out));
+  EXPECT_EQ("ababababab"
+            "cdefg",
+            out);
+}
+
+TEST(LZ4Test, LongLengths) {
+  // 300 literals, then a match of 4 + 15 + 255 + 6 = 280 bytes at offset 1,
+  // and the last literals.
+  std::string literals(300, 'x');
+  literals[299] = 'y';
+  std::string block = std::string("\xff\xff\x1e", 3) + literals +
+                      std::string("\x01\x00\xff\x06\x50", 5) + "abcde";
+  std::string out;
+  EXPECT_TRUE(decompress(block, 300 + 280 + 5, &out));
+  EXPECT_EQ(literals + std::string(280, 'y') + "abcde", out);
+}
+
+TEST(LZ4Test, Corrupt) {
+  std::string out;
+  // The decompressed size differs from the expected one.
+  EXPECT_FALSE(decompress(std::string("\x50hello", 6), 6, &out));
+  EXPECT_FALSE(decompress(std::string("\x50hello", 6), 4, &out));
+  // The literals are truncated.
+  EXPECT_FALSE(decompress(std::string("\x50hel", 4), 5, &out));
+  // The length extension is missing.
+  EXPECT_FALSE(decompress(std::string("\xf0", 1), 15, &out));
+  // The offset is truncated.
+  EXPECT_FALSE(decompress(std::string("\x14" "a" "\x01", 3), 9, &out));
+  // The offset is 0.
+  EXPECT_FALSE(decompress(std::string("\x14" "a" "\x00\x00", 4), 9, &out));
+  // The offset is before the start of the data.
+  EXPECT_FALSE(decompress(std::string("\x14" "a" "\x02\x00", 4), 9, &out));
+  // The match overflows the decompressed data.
+  EXPECT_FALSE(decompress(std::string("\x1f" "a" "\x01\x00\x10", 5), 9, &out));
+}
+
+}  // namespace test
+}  // namespace gapir
@@ -22,6 +22,7 @@
 
 #include <memory>
 #include <string>
+#include <unordered_map>
 
 #include <gmock/gmock.h>
 
@@ -40,6 +41,8 @@ class MockReplayService : public GrpcReplayService {
   MOCK_METHOD7(sendNotification,
                bool(uint64_t, uint32_t, uint32_t, uint64_t, const std::string&,
                     const void*, uint32_t));
+  MOCK_METHOD1(sendCommandTimings,
+               bool(const std::unordered_map<uint32_t, uint64_t>&));
 };
 }  // namespace test
 }  // namespace gapir
@@ -19,10 +19,13 @@
 
 #include "core/cc/log.h"
 
+#include <ctype.h>
 #include <errno.h>
 #include <stdio.h>
 #include <sys/stat.h>
 
+#include <algorithm>
+#include <iterator>
 #include <memory>
 #include <string>
 #include <utility>
@@ -30,8 +33,10 @@
 
 #if TARGET_OS == GAPID_OS_WINDOWS
 #include <direct.h>
+#include <windows.h>
 #define mkdir(path, mode) _mkdir(path)
 #else
+#include <dirent.h>
 static const mode_t MKDIR_MODE = 0755;
 #endif
 
@@ -58,6 +63,67 @@ int mkdirAll(const std::string& path) {
   return 0;
 }
 
+// The name of the journal file of the persistent cache.
+const char* kJournalFileName = "journal";
+// The name of the file the journal is compacted to, before it replaces the
+// journal.
+const char* kCompactedJournalFileName = "journal.tmp";
+
+// The journal is compacted once it holds this many records per cached
+// resource, and at least kMinJournalRecords records.
+const size_t kJournalRecordsPerEntry = 4;
+const size_t kMinJournalRecords = 256;
+
+// Returns true if the resource identifier can be used as a file name.
+bool isValidFileName(const ResourceId& id) {
+  if (id.empty() || id == kJournalFileName) {
+    return false;
+  }
+  for (char c : id) {
+    if (!isalnum(static_cast<unsigned char>(c))) {
+      return false;
+    }
+  }
+  return true;
+}
+
+// Returns the size of the file, or -1 if it cannot be accessed.
+int64_t fileSize(const std::string& path) {
+  struct stat st;
+  if (0 != stat(path.c_str(), &st)) {
+    return -1;
+  }
+  return st.st_size;
+}
+
+// Returns the names of the files in the directory.
+std::vector<std::string> listFiles(const std::string& dir) {
+  std::vector<std::string> names;
+#if TARGET_OS == GAPID_OS_WINDOWS
+  WIN32_FIND_DATAA data;
+  HANDLE find = FindFirstFileA((dir + "*").c_str(), &data);
+  if (find == INVALID_HANDLE_VALUE) {
+    return names;
+  }
+  do {
+    if (!(data.dwFileAttributes & FILE_ATTRIBUTE_DIRECTORY)) {
+      names.push_back(data.cFileName);
+    }
+  } while (FindNextFileA(find, &data));
+  FindClose(find);
+#else
+  DIR* d = opendir(dir.c_str());
+  if (d == nullptr) {
+    return names;
+  }
+  while (struct dirent* entry = readdir(d)) {
+    names.push_back(entry->d_name);
+  }
+  closedir(d);
+#endif
+  return names;
+}
+
 }  // anonymous namespace
 
 std::unique_ptr<OnDiskResourceCache> OnDiskResourceCache::create(
@@ -92,4 +158,263 @@ bool OnDiskResourceCache::loadCache(const Resource& resource, void* data) {
   return mArchive.read(resource.id, data, resource.size);
 }
 
+std::unique_ptr<PersistentResourceCache> PersistentResourceCache::create(
+    const std::string& path, size_t size) {
+  if (0 != mkdirAll(path)) {
+    GAPID_WARNING(
+        "Couldn't access/create persistent cache directory %s; disabling "
+        "persistent cache.",
+        path.c_str());
+    return nullptr;
+  }
+  std::string diskPath = path;
+  if (diskPath.back() != PATH_DELIMITER) {
+    diskPath.push_back(PATH_DELIMITER);
+  }
+  std::unique_ptr<PersistentResourceCache> cache(
+      new PersistentResourceCache(diskPath, size));
+  if (!cache->load()) {
+    GAPID_WARNING(
+        "Couldn't write persistent cache journal in %s; disabling persistent "
+        "cache.",
+        path.c_str());
+    return nullptr;
+  }
+  return cache;
+}
+
+PersistentResourceCache::PersistentResourceCache(const std::string& path,
+                                                 size_t size)
+    : mPath(path),
+      mLimit(size),
+      mSize(0),
+      mJournal(nullptr),
+      mJournalRecords(0) {}
+
+PersistentResourceCache::~PersistentResourceCache() {
+  if (mJournal != nullptr) {
+    fclose(mJournal);
+  }
+}
+
+bool PersistentResourceCache::load() {
+  const std::string journalPath = mPath + kJournalFileName;
+  // Replay the journal, from the least to the most recently used resource.
+  if (FILE* journal = fopen(journalPath.c_str(), "r")) {
+    char op;
+    char id[256];
+    unsigned long long size;
+    while (fscanf(journal, " %c%255s", &op, id) == 2) {
+      auto it = mIndex.find(id);
+      if (it != mIndex.end()) {
+        mEntries.erase(it->second);
+        mIndex.erase(it);
+      }
+      if (op == '+') {
+        if (fscanf(journal, "%llu", &size) != 1) {
+          break;
+        }
+        mEntries.push_front(Entry{id, static_cast<uint32_t>(size)});
+        mIndex[id] = mEntries.begin();
+      }
+    }
+    fclose(journal);
+  }
+
+  // Delete the resource files which are not in the journal, e.g. if the
+  // journal was lost, so they do not take space beyond the size of the cache.
+  // Also delete the journal left by an interrupted compaction.
+  for (const auto& name : listFiles(mPath)) {
+    if (name == kCompactedJournalFileName ||
+        (isValidFileName(name) && mIndex.count(name) == 0)) {
+      remove((mPath + name).c_str());
+    }
+  }
+
+  // Drop the resources whose files were not completely written.
+  for (auto it = mEntries.begin(); it != mEntries.end();) {
+    auto path = resourcePath(it->id);
+    if (!isValidFileName(it->id) || fileSize(path) != it->size) {
+      remove(path.c_str());
+      mIndex.erase(it->id);
+      it = mEntries.erase(it);
+    } else {
+      mSize += it->size;
+      ++it;
+    }
+  }
+
+  if (!compact()) {
+    return false;
+  }
+  evict(0);
+  return true;
+}
+
+bool PersistentResourceCache::compact() {
+  // Write the compacted journal to another file, and then rename it over the
+  // journal, so that the journal is never lost if GAPIR is killed meanwhile.
+  const std::string journalPath = mPath + kJournalFileName;
+  const std::string compactedPath = mPath + kCompactedJournalFileName;
+  FILE* compacted = fopen(compactedPath.c_str(), "w");
+  if (compacted == nullptr) {
+    return false;
+  }
+  bool ok = true;
+  for (auto it = mEntries.rbegin(); it != mEntries.rend(); ++it) {
+    ok = fprintf(compacted, "+%s %u\n", it->id.c_str(), it->size) > 0 && ok;
+  }
+  ok = (fclose(compacted) == 0) && ok;
+  if (!ok) {
+    remove(compactedPath.c_str());
+    return false;
+  }
+
+  if (mJournal != nullptr) {
+    fclose(mJournal);
+  }
+#if TARGET_OS == GAPID_OS_WINDOWS
+  // rename() does not replace an existing file on Windows.
+  bool renamed = MoveFileExA(compactedPath.c_str(), journalPath.c_str(),
+                             MOVEFILE_REPLACE_EXISTING) != 0;
+#else
+  bool renamed = rename(compactedPath.c_str(), journalPath.c_str()) == 0;
+#endif
+  if (!renamed) {
+    remove(compactedPath.c_str());
+  }
+  // Keep appending to the journal, compacted or not.
+  mJournal = fopen(journalPath.c_str(), "a");
+  if (!renamed || mJournal == nullptr) {
+    return false;
+  }
+  mJournalRecords = mEntries.size();
+  return true;
+}
+
+bool PersistentResourceCache::putCache(const Resource& resource,
+                                       const void* data) {
+  if (!isValidFileName(resource.id) || resource.size > mLimit) {
+    return false;
+  }
+  auto it = mIndex.find(resource.id);
+  if (it != mIndex.end()) {
+    if (it->second->size == resource.size) {
+      touch(it->second);
+      return true;
+    }
+    erase(it->second);
+  }
+  evict(resource.size);
+
+  // Record the resource first, so that a partially written file is dropped on
+  // the next run.
+  mEntries.push_front(Entry{resource.id, resource.size});
+  mIndex[resource.id] = mEntries.begin();
+  mSize += resource.size;
+  record('+', mEntries.front());
+
+  auto path = resourcePath(resource.id);
+  FILE* file = fopen(path.c_str(), "wb");
+  bool ok = file != nullptr;
+  if (ok) {
+    ok = fwrite(data, 1, resource.size, file) == resource.size;
+    ok = (fclose(file) == 0) && ok;
+  }
+  if (!ok) {
+    GAPID_WARNING("Couldn't write persistent cache file %s", path.c_str());
+    erase(mEntries.begin());
+  }
+  return ok;
+}
+
+bool PersistentResourceCache::hasCache(const Resource& resource) {
+  auto it = mIndex.find(resource.id);
+  return it != mIndex.end() && it->second->size == resource.size;
+}
+
+bool PersistentResourceCache::loadCache(const Resource& resource, void* data) {
+  auto it = mIndex.find(resource.id);
+  if (it == mIndex.end() || it->second->size != resource.size) {
+    return false;
+  }
+  auto path = resourcePath(resource.id);
+  FILE* file = fopen(path.c_str(), "rb");
+  bool ok = file != nullptr;
+  if (ok) {
+    ok = fread(data, 1, resource.size, file) == resource.size;
+    fclose(file);
+  }
+  if (!ok) {
+    GAPID_WARNING("Couldn't read persistent cache file %s", path.c_str());
+    erase(it->second);
+    return false;
+  }
+  touch(it->second);
+  return true;
+}
+
+void PersistentResourceCache::dump(FILE* file) {
+  fprintf(file, "Persistent cache %s: %zu / %zu bytes\n", mPath.c_str(),
+          mSize, mLimit);
+  for (const auto& entry : mEntries) {
+    fprintf(file, "  %s: %u bytes\n", entry.id.c_str(), entry.size);
+  }
+}
+
+void PersistentResourceCache::clear() {
+  while (!mEntries.empty()) {
+    erase(mEntries.begin());
+  }
+}
+
+void PersistentResourceCache::touch(EntryIterator it) {
+  mEntries.splice(mEntries.begin(), mEntries, it);
+  record('+', *it);
+}
+
+void PersistentResourceCache::evict(size_t size) {
+  while (!mEntries.empty() && mSize + size > mLimit) {
+    erase(std::prev(mEntries.end()));
+  }
+}
+
+void PersistentResourceCache::erase(EntryIterator it) {
+  // Delete the file first, so that a deleted resource is never recorded as
+  // cached. The entry is removed before it is recorded, so a compaction of
+  // the journal does not keep it.
+  Entry entry = *it;
+  remove(resourcePath(entry.id).c_str());
+  mSize -= entry.size;
+  mIndex.erase(entry.id);
+  mEntries.erase(it);
+  record('-', entry);
+}
+
+void PersistentResourceCache::record(char op, const Entry& entry) {
+  if (mJournal == nullptr) {
+    return;
+  }
+  if (op == '+') {
+    fprintf(mJournal, "+%s %u\n", entry.id.c_str(), entry.size);
+  } else {
+    fprintf(mJournal, "-%s\n", entry.id.c_str());
+  }
+  fflush(mJournal);
+
+  // Every cache hit is recorded, so compact the journal before it grows
+  // without bound in a long-lived GAPIR.
+  if (++mJournalRecords >=
+      std::max(mEntries.size() * kJournalRecordsPerEntry, kMinJournalRecords)) {
+    if (!compact()) {
+      GAPID_WARNING("Couldn't compact persistent cache journal in %s",
+                    mPath.c_str());
+    }
+  }
+}
+
+std::string PersistentResourceCache::resourcePath(const ResourceId& id) const {
+  return mPath + id;
+}
+
 }  // namespace gapir
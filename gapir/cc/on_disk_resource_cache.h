@@ -23,9 +23,13 @@
 
 #include "core/cc/archive.h"
 
+#include <stdio.h>
+
 #include <limits>
+#include <list>
 #include <memory>
 #include <string>
+#include <unordered_map>
 
 #if TARGET_OS == GAPID_OS_LINUX || TARGET_OS == GAPID_OS_OSX
 #include <unistd.h>
@@ -72,6 +76,85 @@ class OnDiskResourceCache : public ResourceCache {
   bool mCleanUp;
 };
 
+// Size limited cache on disk for resources, which is kept across the replays
+// and the runs of GAPIR. Each resource is stored in its own file, and the least
+// recently used resources are deleted to make room for the new ones.
+class PersistentResourceCache : public ResourceCache {
+ public:
+  // Creates a new persistent cache of size bytes in the specified directory,
+  // holding the resources cached by the previous runs. Returns nullptr if the
+  // directory is not accessible.
+  static std::unique_ptr<PersistentResourceCache> create(
+      const std::string& path, size_t size);
+
+  virtual ~PersistentResourceCache();
+
+  // ResourceCache interface implementation
+  virtual bool putCache(const Resource& res, const void* resData) override;
+  virtual bool hasCache(const Resource& res) override;
+  virtual bool loadCache(const Resource& res, void* target) override;
+  virtual size_t totalCacheSize() const override { return mLimit; }
+  // Do not support resize, the size is set on creation.
+  virtual bool resize(size_t newSize) override { return true; };
+  virtual void dump(FILE*) override;
+
+  // Deletes all the cached resources.
+  void clear();
+
+ private:
+  struct Entry {
+    ResourceId id;
+    uint32_t size;
+  };
+  typedef std::list<Entry>::iterator EntryIterator;
+
+  PersistentResourceCache(const std::string& path, size_t size);
+
+  // Loads the cached resources recorded in the journal, deletes the resource
+  // files which are not in the journal, and then rewrites the journal with
+  // only the resources still cached. Returns false if the journal cannot be
+  // written.
+  bool load();
+
+  // Marks the cached resource as the most recently used.
+  void touch(EntryIterator it);
+
+  // Deletes the least recently used resources until size bytes are free.
+  void evict(size_t size);
+
+  // Deletes the cached resource.
+  void erase(EntryIterator it);
+
+  // Appends the caching (op is '+') or the deletion (op is '-') of the
+  // resource to the journal, and compacts the journal once it holds too many
+  // records for the cached resources.
+  void record(char op, const Entry& entry);
+
+  // Rewrites the journal with only the resources still cached. The journal is
+  // replaced by the rewritten one at once, so it is kept whole if GAPIR is
+  // killed meanwhile. Returns false if the journal cannot be rewritten.
+  bool compact();
+
+  // Returns the path of the file holding the resource data.
+  std::string resourcePath(const ResourceId& id) const;
+
+  // The directory holding the resource files and the journal.
+  const std::string mPath;
+
+  // The maximum and the current total size in bytes of the cached resources.
+  const size_t mLimit;
+  size_t mSize;
+
+  // The cached resources, from the most to the least recently used.
+  std::list<Entry> mEntries;
+  std::unordered_map<ResourceId, EntryIterator> mIndex;
+
+  // The journal of the cached and the deleted resources, replayed on creation.
+  FILE* mJournal;
+  // The number of records in the journal.
+  size_t mJournalRecords;
+};
+
 }  // namespace gapir
 
 #endif  // GAPIR_ON_DISK_RESOURCE_CACHE_H
@@ -0,0 +1,220 @@
+/*
+ * Copyright (C) 2018 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+#include "on_disk_resource_cache.h"
+#include "cached_resource_loader.h"
+#include "mock_resource_loader.h"
+#include "replay_service.h"
+#include "test_utilities.h"
+
+#include <gmock/gmock.h>
+#include <gtest/gtest.h>
+
+#include <stdio.h>
+#include <stdlib.h>
+
+#include <memory>
+#include <string>
+#include <vector>
+
+using namespace ::testing;
+
+namespace gapir {
+namespace test {
+namespace {
+
+const size_t CACHE_SIZE = 1024;
+
+const Resource A("A", 64);
+const Resource B("B", 256);
+const Resource C("C", 512);
+const Resource D("D", 512);
+const Resource E("E", 2048);
+
+class PersistentResourceCacheTest : public Test {
+ protected:
+  virtual void SetUp() {
+    const char* tmpDir = getenv("TEST_TMPDIR");
+    mPath = std::string(tmpDir != nullptr ? tmpDir : ".") +
+            "/persistent-resource-cache";
+    reopen();
+    mCache->clear();
+  }
+
+  virtual void TearDown() {
+    if (mCache != nullptr) {
+      mCache->clear();
+    }
+  }
+
+  // Recreates the cache, as done by a new run of GAPIR.
+  void reopen() {
+    mCache.reset();
+    mCache = PersistentResourceCache::create(mPath, CACHE_SIZE);
+    ASSERT_NE(nullptr, mCache);
+  }
+
+  void put(const Resource& resource) {
+    auto data = createResourcesData({resource});
+    EXPECT_TRUE(mCache->putCache(resource, data.data()));
+  }
+
+  void expectCached(const Resource& resource) {
+    SCOPED_TRACE(resource.id);
+    EXPECT_TRUE(mCache->hasCache(resource));
+    std::vector<uint8_t> got(resource.size);
+    EXPECT_TRUE(mCache->loadCache(resource, got.data()));
+    EXPECT_EQ(createResourcesData({resource}), got);
+  }
+
+  std::string mPath;
+  std::unique_ptr<PersistentResourceCache> mCache;
+};
+
+}  // anonymous namespace
+
+TEST_F(PersistentResourceCacheTest, PutLoad) {
+  EXPECT_FALSE(mCache->hasCache(A));
+  put(A);
+  put(B);
+  expectCached(A);
+  expectCached(B);
+  EXPECT_FALSE(mCache->hasCache(Resource("A", 65)));
+  EXPECT_FALSE(mCache->hasCache(C));
+}
+
+TEST_F(PersistentResourceCacheTest, PutTooLarge) {
+  auto data = createResourcesData({E});
+  EXPECT_FALSE(mCache->putCache(E, data.data()));
+  EXPECT_FALSE(mCache->hasCache(E));
+}
+
+TEST_F(PersistentResourceCacheTest, PutInvalidId) {
+  const Resource invalid("../A", 64);
+  auto data = createResourcesData({invalid});
+  EXPECT_FALSE(mCache->putCache(invalid, data.data()));
+  EXPECT_FALSE(mCache->hasCache(invalid));
+}
+
+TEST_F(PersistentResourceCacheTest, EvictLeastRecentlyUsed) {
+  put(C);
+  put(B);
+  expectCached(C);
+  put(D);  // Evicts B, the least recently used resource.
+  EXPECT_FALSE(mCache->hasCache(B));
+  expectCached(C);
+  expectCached(D);
+}
+
+TEST_F(PersistentResourceCacheTest, KeptAcrossRuns) {
+  put(C);
+  put(B);
+  expectCached(C);
+  reopen();
+  expectCached(B);
+  expectCached(C);
+  put(D);  // Evicts B, the least recently used resource.
+  reopen();
+  EXPECT_FALSE(mCache->hasCache(B));
+  expectCached(C);
+  expectCached(D);
+}
+
+TEST_F(PersistentResourceCacheTest, DropIncompleteFiles) {
+  put(A);
+  put(B);
+  // Truncate the file of B, as if GAPIR was killed while writing it.
+  FILE* file = fopen((mPath + "/B").c_str(), "wb");
+  ASSERT_NE(nullptr, file);
+  fclose(file);
+  reopen();
+  expectCached(A);
+  EXPECT_FALSE(mCache->hasCache(B));
+}
+
+TEST_F(PersistentResourceCacheTest, Clear) {
+  put(A);
+  put(B);
+  mCache->clear();
+  EXPECT_FALSE(mCache->hasCache(A));
+  EXPECT_FALSE(mCache->hasCache(B));
+  reopen();
+  EXPECT_FALSE(mCache->hasCache(A));
+  EXPECT_FALSE(mCache->hasCache(B));
+}
+
+TEST_F(PersistentResourceCacheTest, CompactJournal) {
+  put(A);
+  put(B);
+  for (int i = 0; i < 10000; i++) {
+    expectCached(i % 2 == 0 ? A : B);
+  }
+  // Every cache hit is recorded, but the journal stays bounded.
+  FILE* journal = fopen((mPath + "/journal").c_str(), "rb");
+  ASSERT_NE(nullptr, journal);
+  fseek(journal, 0, SEEK_END);
+  EXPECT_LT(ftell(journal), 4096);
+  fclose(journal);
+  // The journal is compacted to another file, which replaces it.
+  EXPECT_EQ(nullptr, fopen((mPath + "/journal.tmp").c_str(), "rb"));
+  reopen();
+  expectCached(A);
+  expectCached(B);
+}
+
+TEST_F(PersistentResourceCacheTest, DeleteUnlistedFiles) {
+  put(A);
+  // Write the file of a resource missing from the journal, as if the journal
+  // was lost, and a journal left by an interrupted compaction.
+  for (const char* name : {"/B", "/journal.tmp"}) {
+    FILE* file = fopen((mPath + name).c_str(), "wb");
+    ASSERT_NE(nullptr, file);
+    fclose(file);
+  }
+  reopen();
+  expectCached(A);
+  EXPECT_FALSE(mCache->hasCache(B));
+  EXPECT_EQ(nullptr, fopen((mPath + "/B").c_str(), "rb"));
+  EXPECT_EQ(nullptr, fopen((mPath + "/journal.tmp").c_str(), "rb"));
+}
+
+TEST_F(PersistentResourceCacheTest, FetchPartialCacheHit) {
+  auto loader = CachedResourceLoader::create(
+      mCache.get(),
+      std::unique_ptr<ResourceLoader>(new StrictMock<MockResourceLoader>()));
+  auto fallbackLoader = static_cast<StrictMock<MockResourceLoader>*>(
+      loader->getFallbackResourceLoader());
+
+  put(B);
+  std::vector<Resource> resources = {A, B, C};
+  std::vector<Resource> uncached = {A, C};
+  EXPECT_CALL(*fallbackLoader, fetch(_, _))
+      .With(Args<0, 1>(ElementsAreArray(uncached)))
+      .WillOnce(Return(ByMove(createResources(createResourcesData(uncached)))));
+  auto fetched = loader->fetch(resources.data(), resources.size());
+  ASSERT_NE(nullptr, fetched);
+
+  auto data = createResourcesData(resources);
+  EXPECT_EQ(data, std::vector<uint8_t>(
+                      static_cast<const uint8_t*>(fetched->data()),
+                      static_cast<const uint8_t*>(fetched->data()) +
+                          fetched->size()));
+  expectCached(A);
+  expectCached(C);
+}
+
+}  // namespace test
+}  // namespace gapir
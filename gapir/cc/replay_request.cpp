@@ -61,6 +61,7 @@ std::unique_ptr<ReplayRequest> ReplayRequest::create(
   req->mInstructionList = {
       static_cast<const uint32_t*>(payload->opcodes_data()), instCount};
   GAPID_DEBUG("Instruction count: %" PRIu32, instCount);
+  req->mTimeCommands = payload->time_commands();
   memoryManager->setReplayData(
       (const uint8_t*)payload->constants_data(), payload->constants_size(),
       (const uint8_t*)payload->opcodes_data(), payload->opcodes_size());
@@ -88,4 +89,6 @@ const std::pair<const uint32_t*, uint32_t>& ReplayRequest::getInstructionList()
   return mInstructionList;
 }
 
+bool ReplayRequest::getTimeCommands() const { return mTimeCommands; }
+
 }  // namespace gapir
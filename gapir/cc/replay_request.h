@@ -58,6 +58,10 @@ class ReplayRequest {
   // instruction list
   const std::pair<const uint32_t*, uint32_t>& getInstructionList() const;
 
+  // Returns true if the time spent on each command should be measured and
+  // sent back to the server.
+  bool getTimeCommands() const;
+
  private:
   ReplayRequest() = default;
 
@@ -76,6 +80,9 @@ class ReplayRequest {
   // The list of resources (resource id, resource size) used by the replay
   std::vector<Resource> mResources;
 
+  // Whether the time spent on each command should be measured
+  bool mTimeCommands;
+
   // This is the payload provided by the server.
   // mConstnatMemory/mInstructionList point into this payload.
   std::unique_ptr<ReplayService::Payload> mPayload;
@@ -108,6 +108,10 @@ const void* ReplayService::Payload::opcodes_data() const {
   return mProtoPayload->opcodes().data();
 }
 
+bool ReplayService::Payload::time_commands() const {
+  return mProtoPayload->time_commands();
+}
+
 // Resources member methods
 
 ReplayService::Resources::Resources(
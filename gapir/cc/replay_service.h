@@ -25,6 +25,7 @@
 #include <memory>
 #include <string>
 #include <tuple>
+#include <unordered_map>
 #include <vector>
 
 namespace replay_service {
@@ -113,6 +114,8 @@ class ReplayService {
     size_t opcodes_size() const;
     // Gets a pointer to the opcodes in this replay payload.
     const void* opcodes_data() const;
+    // Returns true if the time spent on each command should be measured.
+    bool time_commands() const;
 
    private:
     // The internal proto object.
@@ -172,6 +175,10 @@ class ReplayService {
                                 uint32_t api_index, uint64_t label,
                                 const std::string& msg, const void* data,
                                 uint32_t data_size) = 0;
+  // Sends the CPU time in nanoseconds spent on each command, keyed by the
+  // command labels. Returns true if succeeded, otherwise returns false.
+  virtual bool sendCommandTimings(
+      const std::unordered_map<uint32_t, uint64_t>& timings) = 0;
 };
 }  // namespace gapir
 
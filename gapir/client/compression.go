@@ -0,0 +1,165 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+
+	replaysrv "github.com/google/gapid/gapir/replay_service"
+)
+
+// minCompressedResourcesSize is the size in bytes under which the resources
+// are not worth compressing.
+const minCompressedResourcesSize = 64 * 1024
+
+// resourceCompressions are the compressions of the resources, in order of
+// preference. LZ4 is fast enough to compress the resources while they are
+// streamed, zlib is only used by the GAPIR devices not supporting LZ4.
+// TODO: Offer zstd once GAPIR links a zstd decoder. It is not in the
+// dependencies of GAPIR yet.
+var resourceCompressions = []struct {
+	compression replaysrv.Compression
+	compress    func(data []byte) ([]byte, error)
+}{
+	{replaysrv.Compression_Lz4Compression, lz4Compress},
+	{replaysrv.Compression_ZlibCompression, zlibCompress},
+}
+
+// compressResources returns the resources compressed with the preferred
+// compression supported by the GAPIR device, or the given resources if they
+// are too small, do not compress, or no compression is supported.
+func compressResources(res *replaysrv.Resources, supported func(replaysrv.Compression) bool) (*replaysrv.Resources, error) {
+	if len(res.Data) < minCompressedResourcesSize {
+		return res, nil
+	}
+	for _, c := range resourceCompressions {
+		if !supported(c.compression) {
+			continue
+		}
+		data, err := c.compress(res.Data)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) >= len(res.Data) {
+			return res, nil
+		}
+		return &replaysrv.Resources{
+			Data:             data,
+			Compression:      c.compression,
+			UncompressedSize: uint64(len(res.Data)),
+		}, nil
+	}
+	return res, nil
+}
+
+// zlibCompress returns the data compressed in the zlib format.
+func zlibCompress(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w, err := zlib.NewWriterLevel(buf, zlib.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// The constants of the LZ4 block format.
+const (
+	lz4MinMatch  = 4
+	lz4MaxOffset = 65535
+	// The last match must start at least 12 bytes before the end of the block,
+	// and the last 5 bytes are always literals.
+	lz4MFLimit      = 12
+	lz4LastLiterals = 5
+	// The number of bits of the hashes of the table of the previous positions.
+	lz4HashLog = 16
+	// The number of missed matches after which the search skips bytes, so the
+	// data which doesn't compress is quickly copied.
+	lz4SkipTrigger = 6
+)
+
+// lz4Compress returns the data compressed in the LZ4 block format, without the
+// frame. The matches are found greedily with a table of the previous positions
+// of the hashes of 4 bytes.
+func lz4Compress(data []byte) ([]byte, error) {
+	n := len(data)
+	out := make([]byte, 0, n+n/255+16)
+	table := make([]int, 1<<lz4HashLog)
+	anchor := 0
+	for i := 0; i+lz4MFLimit <= n; {
+		v := binary.LittleEndian.Uint32(data[i:])
+		h := (v * 2654435761) >> (32 - lz4HashLog)
+		// The positions are stored plus one, so 0 is no position.
+		ref := table[h] - 1
+		table[h] = i + 1
+		if ref < 0 || i-ref > lz4MaxOffset || binary.LittleEndian.Uint32(data[ref:]) != v {
+			i += 1 + (i-anchor)>>lz4SkipTrigger
+			continue
+		}
+		end := i + lz4MinMatch
+		for m := ref + lz4MinMatch; end < n-lz4LastLiterals && data[end] == data[m]; m++ {
+			end++
+		}
+		out = lz4Sequence(out, data[anchor:i], i-ref, end-i)
+		i, anchor = end, end
+	}
+	return lz4Sequence(out, data[anchor:], 0, 0), nil
+}
+
+// lz4Sequence appends the sequence of the literals followed by the match of
+// the given offset and length, or by no match if the offset is 0.
+func lz4Sequence(out, literals []byte, offset, length int) []byte {
+	token := byte(0)
+	if len(literals) >= 15 {
+		token = 15 << 4
+	} else {
+		token = byte(len(literals)) << 4
+	}
+	length -= lz4MinMatch
+	if offset > 0 {
+		if length >= 15 {
+			token |= 15
+		} else {
+			token |= byte(length)
+		}
+	}
+	out = append(out, token)
+	if len(literals) >= 15 {
+		out = lz4Length(out, len(literals)-15)
+	}
+	out = append(out, literals...)
+	if offset > 0 {
+		out = append(out, byte(offset), byte(offset>>8))
+		if length >= 15 {
+			out = lz4Length(out, length-15)
+		}
+	}
+	return out
+}
+
+// lz4Length appends the bytes extending a literal or match length.
+func lz4Length(out []byte, l int) []byte {
+	for ; l >= 255; l -= 255 {
+		out = append(out, 255)
+	}
+	return append(out, byte(l))
+}
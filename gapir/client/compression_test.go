@@ -0,0 +1,192 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	replaysrv "github.com/google/gapid/gapir/replay_service"
+)
+
+// lz4Decompress decompresses the data in the LZ4 block format, checking the
+// restrictions of the format on the end of the block: the last match starts
+// at least 12 bytes before the end of the block, and the last 5 bytes are
+// literals.
+func lz4Decompress(data []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	length := func(l int) (int, error) {
+		for {
+			if len(data) == 0 {
+				return 0, fmt.Errorf("Truncated length")
+			}
+			b := data[0]
+			data = data[1:]
+			l += int(b)
+			if b != 255 {
+				return l, nil
+			}
+		}
+	}
+	for len(data) > 0 {
+		token := data[0]
+		data = data[1:]
+		literals := int(token >> 4)
+		if literals == 15 {
+			var err error
+			if literals, err = length(literals); err != nil {
+				return nil, err
+			}
+		}
+		if literals > len(data) {
+			return nil, fmt.Errorf("Truncated literals")
+		}
+		out = append(out, data[:literals]...)
+		data = data[literals:]
+		if len(data) == 0 {
+			break
+		}
+		if len(data) < 2 {
+			return nil, fmt.Errorf("Truncated offset")
+		}
+		offset := int(data[0]) | int(data[1])<<8
+		data = data[2:]
+		matchLength := int(token & 15)
+		if matchLength == 15 {
+			var err error
+			if matchLength, err = length(matchLength); err != nil {
+				return nil, err
+			}
+		}
+		matchLength += lz4MinMatch
+		if offset == 0 || offset > len(out) {
+			return nil, fmt.Errorf("Invalid offset %v at %v", offset, len(out))
+		}
+		if len(out) > size-lz4MFLimit {
+			return nil, fmt.Errorf("Match at %v starts in the last %v bytes", len(out), lz4MFLimit)
+		}
+		if len(out)+matchLength > size-lz4LastLiterals {
+			return nil, fmt.Errorf("Match at %v ends in the last %v bytes", len(out), lz4LastLiterals)
+		}
+		for i := 0; i < matchLength; i++ {
+			out = append(out, out[len(out)-offset])
+		}
+	}
+	if len(out) != size {
+		return nil, fmt.Errorf("Decompressed %v bytes, expected %v", len(out), size)
+	}
+	return out, nil
+}
+
+func TestLZ4RoundTrip(t *testing.T) {
+	ctx := log.Testing(t)
+	r := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		r.Read(b)
+		return b
+	}
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 1000)
+	zeros := make([]byte, 100000)
+	// Data repeating with a period longer than the maximum offset, so that
+	// none of the repetitions can be matched.
+	farRepeat := random(lz4MaxOffset + 100)
+	farRepeat = append(farRepeat, farRepeat[:1000]...)
+
+	for _, test := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"tiny", []byte("abc")},
+		{"text", text},
+		{"zeros", zeros},
+		{"incompressible", random(100000)},
+		{"far repeat", farRepeat},
+		{"incompressible tail", append(append([]byte{}, zeros[:1000]...), random(1000)...)},
+	} {
+		compressed, err := lz4Compress(test.data)
+		if !assert.For(ctx, "%v compress", test.name).ThatError(err).Succeeded() {
+			continue
+		}
+		got, err := lz4Decompress(compressed, len(test.data))
+		if !assert.For(ctx, "%v decompress", test.name).ThatError(err).Succeeded() {
+			continue
+		}
+		assert.For(ctx, "%v round trip", test.name).That(bytes.Equal(got, test.data)).Equals(true)
+	}
+
+	// The last literals and the last match around the end of the block.
+	for n := 0; n <= 2*lz4MFLimit+2; n++ {
+		for _, data := range [][]byte{zeros[:n], text[:n], random(n)} {
+			compressed, err := lz4Compress(data)
+			if !assert.For(ctx, "%v bytes compress", n).ThatError(err).Succeeded() {
+				continue
+			}
+			got, err := lz4Decompress(compressed, n)
+			if !assert.For(ctx, "%v bytes decompress", n).ThatError(err).Succeeded() {
+				continue
+			}
+			assert.For(ctx, "%v bytes round trip", n).That(bytes.Equal(got, data)).Equals(true)
+		}
+	}
+
+	// The compressed zeros are much smaller, and the incompressible data only
+	// grows by the length bytes of its literals.
+	compressed, _ := lz4Compress(zeros)
+	assert.For(ctx, "zeros compressed size").That(len(compressed) < len(zeros)/100).Equals(true)
+	incompressible := random(100000)
+	compressed, _ = lz4Compress(incompressible)
+	assert.For(ctx, "incompressible size").That(len(compressed) <= len(incompressible)+len(incompressible)/255+16).Equals(true)
+}
+
+func TestCompressResources(t *testing.T) {
+	ctx := log.Testing(t)
+	r := rand.New(rand.NewSource(1))
+	compressible := &replaysrv.Resources{Data: make([]byte, 2*minCompressedResourcesSize)}
+	incompressible := &replaysrv.Resources{Data: make([]byte, 2*minCompressedResourcesSize)}
+	r.Read(incompressible.Data)
+	small := &replaysrv.Resources{Data: make([]byte, minCompressedResourcesSize-1)}
+	all := func(replaysrv.Compression) bool { return true }
+	zlibOnly := func(c replaysrv.Compression) bool { return c == replaysrv.Compression_ZlibCompression }
+	none := func(replaysrv.Compression) bool { return false }
+
+	res, err := compressResources(compressible, all)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "LZ4").That(res.Compression).Equals(replaysrv.Compression_Lz4Compression)
+	assert.For(ctx, "LZ4 size").That(res.UncompressedSize).Equals(uint64(len(compressible.Data)))
+
+	res, err = compressResources(compressible, zlibOnly)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "zlib").That(res.Compression).Equals(replaysrv.Compression_ZlibCompression)
+
+	for _, test := range []struct {
+		name      string
+		res       *replaysrv.Resources
+		supported func(replaysrv.Compression) bool
+	}{
+		{"unsupported", compressible, none},
+		{"small", small, all},
+		{"incompressible", incompressible, all},
+	} {
+		res, err := compressResources(test.res, test.supported)
+		assert.For(ctx, "%v err", test.name).ThatError(err).Succeeded()
+		assert.For(ctx, "%v uncompressed", test.name).That(res == test.res).Equals(true)
+	}
+}
@@ -50,6 +50,8 @@ type (
 	PostData = replaysrv.PostData
 	// Notification contains an Id, the ApiIndex, Label, Msg in string and arbitary Data in bytes.
 	Notification = replaysrv.Notification
+	// CommandTimings contains the Label and the CPU time in nanoseconds of each command of a replay.
+	CommandTimings = replaysrv.CommandTimings
 	// Severity represents the severity level of notification messages. It uses the same enum as gapis
 	Severity = severity.Severity
 )
@@ -65,11 +67,17 @@ type Connection struct {
 	servClient replaysrv.GapirClient
 	stream     replaysrv.Gapir_ReplayClient
 	authToken  auth.Token
+	// If true, the resources are compressed if the GAPIR device supports it.
+	compressResources bool
+	// The compressions of the resources supported by the GAPIR device of the
+	// current replay.
+	resourceCompressions []replaysrv.Compression
 }
 
-func newConnection(addr string, authToken auth.Token, timeout time.Duration) (*Connection, error) {
-	conn, err := grpc.Dial(addr, grpc.WithInsecure(), grpc.WithBlock(),
-		grpc.WithTimeout(timeout))
+func newConnection(addr string, authToken auth.Token, timeout time.Duration, opts ...grpc.DialOption) (*Connection, error) {
+	opts = append([]grpc.DialOption{grpc.WithInsecure(), grpc.WithBlock(),
+		grpc.WithTimeout(timeout)}, opts...)
+	conn, err := grpc.Dial(addr, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -129,9 +137,17 @@ func (c *Connection) SendResources(ctx context.Context, resources []byte) error
 	if c.stream == nil {
 		return log.Err(ctx, nil, "Replay communication not initiated")
 	}
+	res := &replaysrv.Resources{Data: resources}
+	if c.compressResources {
+		compressed, err := compressResources(res, c.supportsResourceCompression)
+		if err != nil {
+			return log.Err(ctx, err, "Compressing resources")
+		}
+		res = compressed
+	}
 	resReq := replaysrv.ReplayRequest{
 		Req: &replaysrv.ReplayRequest_Resources{
-			Resources: &replaysrv.Resources{Data: resources},
+			Resources: res,
 		},
 	}
 	if err := c.stream.Send(&resReq); err != nil {
@@ -173,6 +189,8 @@ type ReplayResponseHandler interface {
 	HandlePostData(context.Context, *PostData, *Connection) error
 	// HandleNotification handles the given notification message.
 	HandleNotification(context.Context, *Notification, *Connection) error
+	// HandleCommandTimings handles the given command timings message.
+	HandleCommandTimings(context.Context, *CommandTimings, *Connection) error
 }
 
 // HandleReplayCommunication handles the communication with the GAPIR device on
@@ -204,6 +222,7 @@ func (c *Connection) HandleReplayCommunication(
 			c.stream.CloseSend()
 			c.stream = nil
 		}
+		c.resourceCompressions = nil
 	}()
 	for {
 		if c.stream == nil {
@@ -215,6 +234,7 @@ func (c *Connection) HandleReplayCommunication(
 		}
 		switch r.Res.(type) {
 		case *replaysrv.ReplayResponse_PayloadRequest:
+			c.resourceCompressions = r.GetPayloadRequest().GetResourceCompressions()
 			if err := handler.HandlePayloadRequest(ctx, c); err != nil {
 				return log.Errf(ctx, err, "Handling replay payload request")
 			}
@@ -236,6 +256,10 @@ func (c *Connection) HandleReplayCommunication(
 			if err := handler.HandleNotification(ctx, r.GetNotification(), c); err != nil {
 				return log.Errf(ctx, err, "Handling notification")
 			}
+		case *replaysrv.ReplayResponse_CommandTimings:
+			if err := handler.HandleCommandTimings(ctx, r.GetCommandTimings(), c); err != nil {
+				return log.Errf(ctx, err, "Handling command timings")
+			}
 		case *replaysrv.ReplayResponse_Finished:
 			log.D(ctx, "Replay Finished Response received")
 			return nil
@@ -245,6 +269,17 @@ func (c *Connection) HandleReplayCommunication(
 	}
 }
 
+// supportsResourceCompression returns true if the GAPIR device of the current
+// replay supports the compression of the resources.
+func (c *Connection) supportsResourceCompression(compression replaysrv.Compression) bool {
+	for _, s := range c.resourceCompressions {
+		if s == compression {
+			return true
+		}
+	}
+	return false
+}
+
 // beginReplay begins a replay stream connection and attach the authentication,
 // if any, token in the metadata.
 func (c *Connection) beginReplay(ctx context.Context, id string) error {
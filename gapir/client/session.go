@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -38,6 +39,7 @@ import (
 	"github.com/google/gapid/core/text"
 	"github.com/google/gapid/core/vulkan/loader"
 	"github.com/google/gapid/gapidapk"
+	"google.golang.org/grpc"
 )
 
 const (
@@ -48,12 +50,24 @@ const (
 	heartbeatInterval          = time.Millisecond * 500
 )
 
+// ForwardADBPorts is true if the connections to the GAPIR of the Android
+// devices are made on local ports forwarded with adb forward, rather than on
+// streams opened through the adb server. The forwarded ports are only
+// reachable if the adb server runs on the local host.
+var ForwardADBPorts = false
+
 type session struct {
-	device   bind.Device
-	port     int
-	auth     auth.Token
-	closeCBs []func()
-	inited   chan struct{}
+	device bind.Device
+	port   int
+	// If not nil, the connections are made on the streams opened by dial
+	// rather than on the port.
+	dial func(addr string, timeout time.Duration) (net.Conn, error)
+	// If true, the resources sent on the connections are compressed, as the
+	// transfers to the device are slower than the compression.
+	compressResources bool
+	auth              auth.Token
+	closeCBs          []func()
+	inited            chan struct{}
 	// The connection for heartbeat
 	conn *Connection
 }
@@ -190,6 +204,7 @@ func (s *session) newRemote(ctx context.Context, d remotessh.Device, abi *device
 
 	s.port = port
 	s.auth = authToken
+	s.compressResources = true
 	return nil
 }
 
@@ -294,12 +309,6 @@ func (s *session) newADB(ctx context.Context, d adb.Device, abi *device.ABI) err
 		return err
 	}
 
-	log.I(ctx, "Setting up port forwarding...")
-	localPort, err := adb.LocalFreeTCPPort()
-	if err != nil {
-		return log.Err(ctx, err, "Finding free port")
-	}
-	s.port = int(localPort)
 	socket, ok := socketNames[abi.Architecture]
 	ctx = log.V{"socket": socket}.Bind(ctx)
 	if !ok {
@@ -327,13 +336,31 @@ func (s *session) newADB(ctx context.Context, d adb.Device, abi *device.ABI) err
 	}
 	log.I(ctx, "Gapir socket: '%v' is opened now", socketPath)
 
-	if err := d.Forward(ctx, localPort, adb.NamedFileSystemSocket(socketPath)); err != nil {
-		return log.Err(ctx, err, "Forwarding port")
+	if ForwardADBPorts {
+		log.I(ctx, "Setting up port forwarding...")
+		localPort, err := adb.LocalFreeTCPPort()
+		if err != nil {
+			return log.Err(ctx, err, "Finding free port")
+		}
+		if err := d.Forward(ctx, localPort, adb.NamedFileSystemSocket(socketPath)); err != nil {
+			return log.Err(ctx, err, "Forwarding port")
+		}
+		s.onClose(func() { d.RemoveForward(ctx, localPort) })
+		s.port = int(localPort)
+	} else {
+		// The connections are made on streams opened through the adb server,
+		// rather than on a forwarded local port, so that the sessions on the
+		// devices of a shared host cannot collide on the ports.
+		s.dial = func(addr string, timeout time.Duration) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return d.Dial(ctx, adb.NamedFileSystemSocket(socketPath))
+		}
 	}
-	s.onClose(func() { d.RemoveForward(ctx, localPort) })
+	s.compressResources = true
 
 	log.I(ctx, "Waiting for connection to GAPIR...")
-	s.conn, err = newConnection(fmt.Sprintf("localhost:%d", localPort), s.auth, connectTimeout)
+	s.conn, err = s.newConnection()
 	if err != nil {
 		return log.Err(ctx, err, "Timeout waiting for connection")
 	}
@@ -348,7 +375,23 @@ func (s *session) newADB(ctx context.Context, d adb.Device, abi *device.ABI) err
 
 func (s *session) connect(ctx context.Context) (*Connection, error) {
 	<-s.inited
-	return newConnection(fmt.Sprintf("localhost:%d", s.port), s.auth, connectTimeout)
+	return s.newConnection()
+}
+
+// newConnection returns a new connection to the GAPIR of the session.
+func (s *session) newConnection() (*Connection, error) {
+	var conn *Connection
+	var err error
+	if s.dial != nil {
+		conn, err = newConnection("gapir", s.auth, connectTimeout, grpc.WithDialer(s.dial))
+	} else {
+		conn, err = newConnection(fmt.Sprintf("localhost:%d", s.port), s.auth, connectTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.compressResources = s.compressResources
+	return conn, nil
 }
 
 func (s *session) onClose(f func()) {
@@ -42,6 +42,11 @@ enum class Opcode {
   ADD = 14,
   LABEL = 15,
   SWITCH_THREAD = 16,
+  MUL = 17,
+  LOAD_OFFSET = 18,
+  STORE_OFFSET = 19,
+  JUMP_Z = 20,
+  JUMP_NZ = 21,
 };
 
 // Unique ID for each supported data type. The ID have to fit into 6 bits (0-63)
@@ -0,0 +1,120 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package analysis provides the registration of analysis passes maintained
+// out of tree, linked into GAPIS or loaded from Go plugins.
+//
+// An analysis pass receives the capture, the state and the footprint of the
+// commands, and can contribute items to the report of the capture and custom
+// service endpoints. The passes are registered as GAPIS extensions, so their
+// report items are added to the reports requesting the analyses, and their
+// endpoints are called with the CallExtension RPC.
+package analysis
+
+import (
+	"context"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/extensions"
+	"github.com/google/gapid/gapis/resolve/dependencygraph"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// Input is the input of an analysis pass.
+type Input struct {
+	// The path to the analyzed capture.
+	Path *path.Capture
+	// The analyzed capture.
+	Capture   *capture.Capture
+	footprint *dependencygraph.Footprint
+}
+
+// Footprint returns the footprint of the commands of the capture. The
+// footprint is built on the first call. Its commands start with the commands
+// building the initial state of the capture.
+func (in *Input) Footprint(ctx context.Context) (*dependencygraph.Footprint, error) {
+	if in.footprint == nil {
+		ft, err := dependencygraph.GetFootprint(ctx, in.Path)
+		if err != nil {
+			return nil, err
+		}
+		in.footprint = ft
+	}
+	return in.footprint, nil
+}
+
+// ForeachState mutates a new state with the commands of the capture, calling
+// cb with the state after every command. The state includes the initial state
+// of the capture.
+func (in *Input) ForeachState(ctx context.Context, cb func(ctx context.Context, id api.CmdID, cmd api.Cmd, s *api.GlobalState) error) error {
+	s := in.Capture.NewState(ctx)
+	return api.ForeachCmd(ctx, in.Capture.Commands, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
+		cmd.Mutate(ctx, id, s, nil, nil)
+		return cb(ctx, id, cmd, s)
+	})
+}
+
+// Endpoint is a custom service endpoint of an analysis pass. The encoding of
+// the arguments and of the result is defined by the pass.
+type Endpoint func(ctx context.Context, in *Input, args []byte) ([]byte, error)
+
+// Pass is an analysis pass.
+// It should be registered at application initialization with Register.
+type Pass struct {
+	// Name of the pass, which is also the name of its extension.
+	Name string
+	// Report returns the report items of the capture, by command. The items
+	// not related to a command use the api.CmdNoID key. The messages of the
+	// items are usually built with messages.AnalysisItem.
+	Report func(ctx context.Context, in *Input) (map[api.CmdID][]extensions.ReportItem, error)
+	// Custom service endpoints, by name.
+	Endpoints map[string]Endpoint
+}
+
+// Register registers the analysis pass p.
+func Register(p Pass) {
+	e := extensions.Extension{Name: p.Name}
+	if p.Report != nil {
+		e.ReportItems = func(ctx context.Context, c *path.Capture) (map[api.CmdID][]extensions.ReportItem, error) {
+			in, err := newInput(ctx, c)
+			if err != nil {
+				return nil, err
+			}
+			return p.Report(ctx, in)
+		}
+	}
+	if len(p.Endpoints) > 0 {
+		e.Endpoints = map[string]extensions.Endpoint{}
+		for name, f := range p.Endpoints {
+			f := f
+			e.Endpoints[name] = func(ctx context.Context, c *path.Capture, args []byte) ([]byte, error) {
+				in, err := newInput(ctx, c)
+				if err != nil {
+					return nil, err
+				}
+				return f(ctx, in, args)
+			}
+		}
+	}
+	extensions.Register(e)
+}
+
+func newInput(ctx context.Context, p *path.Capture) (*Input, error) {
+	c, err := capture.ResolveFromPath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return &Input{Path: p, Capture: c}, nil
+}
@@ -91,6 +91,14 @@ type APIObject interface {
 	API() API
 }
 
+// Handle is the interface implemented by the types of the handles of the API
+// objects. The handle values are chosen by the driver, so the same object has
+// different handles in different captures.
+type Handle interface {
+	// Handle returns the value of the handle.
+	Handle() uint64
+}
+
 var apis = map[ID]API{}
 var indices = map[uint8]API{}
 
@@ -27,6 +27,7 @@ const (
 	PopUserMarker
 	UserMarker
 	ExecutedDraw
+	ExecutedDispatch
 )
 
 // IsDrawCall returns true if the command is a draw call.
@@ -61,3 +62,7 @@ func (f CmdFlags) IsUserMarker() bool { return (f & UserMarker) != 0 }
 // IsExecutedDraw returns true if the command is a draw call that gets executed
 // as a subcommand.
 func (f CmdFlags) IsExecutedDraw() bool { return (f & ExecutedDraw) != 0 }
+
+// IsExecutedDispatch returns true if the command is a compute dispatch that
+// gets executed as a subcommand.
+func (f CmdFlags) IsExecutedDispatch() bool { return (f & ExecutedDispatch) != 0 }
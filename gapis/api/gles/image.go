@@ -340,6 +340,16 @@ func getCompressedImageFormat(format GLenum) (*image.Format, error) {
 		return image.NewS3_DXT3_RGBA("GL_COMPRESSED_RGBA_S3TC_DXT3_EXT"), nil
 	case GLenum_GL_COMPRESSED_RGBA_S3TC_DXT5_EXT:
 		return image.NewS3_DXT5_RGBA("GL_COMPRESSED_RGBA_S3TC_DXT5_EXT"), nil
+
+	// BPTC
+	case GLenum_GL_COMPRESSED_RGBA_BPTC_UNORM:
+		return image.NewBC7_RGBA_U8_NORM("GL_COMPRESSED_RGBA_BPTC_UNORM"), nil
+	case GLenum_GL_COMPRESSED_SRGB_ALPHA_BPTC_UNORM:
+		return image.NewBC7_SRGBA_U8_NORM("GL_COMPRESSED_SRGB_ALPHA_BPTC_UNORM"), nil
+	case GLenum_GL_COMPRESSED_RGB_BPTC_SIGNED_FLOAT:
+		return image.NewBC6H_RGB_SFLOAT("GL_COMPRESSED_RGB_BPTC_SIGNED_FLOAT"), nil
+	case GLenum_GL_COMPRESSED_RGB_BPTC_UNSIGNED_FLOAT:
+		return image.NewBC6H_RGB_UFLOAT("GL_COMPRESSED_RGB_BPTC_UNSIGNED_FLOAT"), nil
 	}
 
 	return nil, fmt.Errorf("Unsupported compressed format: %s", format)
@@ -0,0 +1,372 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/resolve/dependencygraph"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/stringtable"
+)
+
+const (
+	graphicsStages = VkPipelineStageFlags(
+		VkPipelineStageFlagBits_VK_PIPELINE_STAGE_VERTEX_INPUT_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_VERTEX_SHADER_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TESSELLATION_CONTROL_SHADER_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TESSELLATION_EVALUATION_SHADER_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_GEOMETRY_SHADER_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_FRAGMENT_SHADER_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_EARLY_FRAGMENT_TESTS_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_LATE_FRAGMENT_TESTS_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_COLOR_ATTACHMENT_OUTPUT_BIT)
+	meshStages = VkPipelineStageFlags(
+		VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TASK_SHADER_BIT_EXT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_MESH_SHADER_BIT_EXT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_FRAGMENT_SHADER_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_EARLY_FRAGMENT_TESTS_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_LATE_FRAGMENT_TESTS_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_COLOR_ATTACHMENT_OUTPUT_BIT)
+	attachmentStages = VkPipelineStageFlags(
+		VkPipelineStageFlagBits_VK_PIPELINE_STAGE_EARLY_FRAGMENT_TESTS_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_LATE_FRAGMENT_TESTS_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_COLOR_ATTACHMENT_OUTPUT_BIT)
+	indirectStage = VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_DRAW_INDIRECT_BIT)
+	computeStage  = VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_COMPUTE_SHADER_BIT)
+	transferStage = VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TRANSFER_BIT)
+	// The stages the commands are attributed to by barrierStages.
+	trackedStages = graphicsStages | meshStages | indirectStage | computeStage | transferStage
+	// The stages of the masks of the barriers which stand for other stages,
+	// expanded by expandStages.
+	expandedStages = VkPipelineStageFlags(
+		VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TOP_OF_PIPE_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_BOTTOM_OF_PIPE_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_ALL_GRAPHICS_BIT |
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_ALL_COMMANDS_BIT)
+)
+
+// The bits of the VK_KHR_synchronization2 stage masks which do not match the
+// bits of the original stage masks.
+const (
+	stage2Copy                  = uint64(1) << 32
+	stage2Resolve               = uint64(1) << 33
+	stage2Blit                  = uint64(1) << 34
+	stage2Clear                 = uint64(1) << 35
+	stage2IndexInput            = uint64(1) << 36
+	stage2VertexAttributeInput  = uint64(1) << 37
+	stage2PreRasterizationStage = uint64(1) << 38
+)
+
+// stageMask2 returns the original stage mask equivalent to the given
+// VK_KHR_synchronization2 stage mask. ok is false if the mask has stages
+// without equivalent.
+func stageMask2(mask VkPipelineStageFlags2KHR) (flags VkPipelineStageFlags, ok bool) {
+	m := uint64(mask)
+	flags = VkPipelineStageFlags(m & 0xffffffff)
+	m &^= 0xffffffff
+	if m&(stage2Copy|stage2Resolve|stage2Blit|stage2Clear) != 0 {
+		flags |= transferStage
+	}
+	if m&(stage2IndexInput|stage2VertexAttributeInput) != 0 {
+		flags |= VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_VERTEX_INPUT_BIT)
+	}
+	if m&stage2PreRasterizationStage != 0 {
+		flags |= VkPipelineStageFlags(
+			VkPipelineStageFlagBits_VK_PIPELINE_STAGE_VERTEX_SHADER_BIT |
+				VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TESSELLATION_CONTROL_SHADER_BIT |
+				VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TESSELLATION_EVALUATION_SHADER_BIT |
+				VkPipelineStageFlagBits_VK_PIPELINE_STAGE_GEOMETRY_SHADER_BIT |
+				VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TASK_SHADER_BIT_EXT |
+				VkPipelineStageFlagBits_VK_PIPELINE_STAGE_MESH_SHADER_BIT_EXT)
+	}
+	m &^= stage2Copy | stage2Resolve | stage2Blit | stage2Clear | stage2IndexInput |
+		stage2VertexAttributeInput | stage2PreRasterizationStage
+	return flags, m == 0
+}
+
+// dependencyInfoStages returns the union of the source and destination stage
+// masks of the barriers of the given dependency info, as original stage
+// masks. ok is false if a mask has stages without equivalent.
+func dependencyInfoStages(ctx context.Context, cmd api.Cmd, s *api.GlobalState,
+	info VkDependencyInfoKHR) (src, dst VkPipelineStageFlags, ok bool) {
+	l := s.MemoryLayout
+	ok = true
+	add := func(srcMask, dstMask VkPipelineStageFlags2KHR) {
+		srcFlags, srcOk := stageMask2(srcMask)
+		dstFlags, dstOk := stageMask2(dstMask)
+		src, dst, ok = src|srcFlags, dst|dstFlags, ok && srcOk && dstOk
+	}
+	for _, b := range info.PMemoryBarriers().Slice(0,
+		uint64(info.MemoryBarrierCount()), l).MustRead(ctx, cmd, s, nil) {
+		add(b.SrcStageMask(), b.DstStageMask())
+	}
+	for _, b := range info.PBufferMemoryBarriers().Slice(0,
+		uint64(info.BufferMemoryBarrierCount()), l).MustRead(ctx, cmd, s, nil) {
+		add(b.SrcStageMask(), b.DstStageMask())
+	}
+	for _, b := range info.PImageMemoryBarriers().Slice(0,
+		uint64(info.ImageMemoryBarrierCount()), l).MustRead(ctx, cmd, s, nil) {
+		add(b.SrcStageMask(), b.DstStageMask())
+	}
+	return src, dst, ok
+}
+
+// barrierStages returns the pipeline stages in which the given command
+// recorded in a command buffer accesses memory, or 0 if the command is not
+// tracked by the barrier analysis.
+func barrierStages(cmd api.Cmd) VkPipelineStageFlags {
+	switch cmd.(type) {
+	case *VkCmdCopyImage, *VkCmdCopyBuffer, *VkCmdCopyImageToBuffer,
+		*VkCmdCopyBufferToImage, *VkCmdBlitImage, *VkCmdBlitImage2KHR,
+		*VkCmdResolveImage, *VkCmdResolveImage2KHR, *VkCmdFillBuffer,
+		*VkCmdUpdateBuffer, *VkCmdClearColorImage, *VkCmdClearDepthStencilImage,
+		*VkCmdCopyQueryPoolResults:
+		return transferStage
+	case *VkCmdDispatch:
+		return computeStage
+	case *VkCmdDispatchIndirect:
+		return computeStage | indirectStage
+	case *VkCmdDraw, *VkCmdDrawIndexed:
+		return graphicsStages
+	case *VkCmdDrawIndirect, *VkCmdDrawIndexedIndirect,
+		*VkCmdDrawIndirectCountKHR, *VkCmdDrawIndexedIndirectCountKHR:
+		return graphicsStages | indirectStage
+	case *VkCmdDrawMeshTasksEXT, *VkCmdDrawMeshTasksNV:
+		return meshStages
+	case *VkCmdDrawMeshTasksIndirectEXT, *VkCmdDrawMeshTasksIndirectNV,
+		*VkCmdDrawMeshTasksIndirectCountEXT, *VkCmdDrawMeshTasksIndirectCountNV:
+		return meshStages | indirectStage
+	case *VkCmdBeginRenderPass, *VkCmdBeginRenderPass2, *VkCmdNextSubpass,
+		*VkCmdNextSubpass2, *VkCmdEndRenderPass, *VkCmdEndRenderPass2,
+		*VkCmdClearAttachments:
+		// The load, store and resolve operations, and the clears of the
+		// attachments.
+		return attachmentStages
+	}
+	return 0
+}
+
+// expandStages returns the tracked stages covered by the given stage mask of
+// a barrier. src tells if the mask is the source mask, in which the bottom of
+// the pipe covers all the stages, or the destination mask, in which the top of
+// the pipe does.
+func expandStages(mask VkPipelineStageFlags, src bool) VkPipelineStageFlags {
+	all := VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TOP_OF_PIPE_BIT
+	if src {
+		all = VkPipelineStageFlagBits_VK_PIPELINE_STAGE_BOTTOM_OF_PIPE_BIT
+	}
+	if mask&VkPipelineStageFlags(all|VkPipelineStageFlagBits_VK_PIPELINE_STAGE_ALL_COMMANDS_BIT) != 0 {
+		mask |= trackedStages
+	}
+	if mask&VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_ALL_GRAPHICS_BIT) != 0 {
+		mask |= graphicsStages | meshStages | indirectStage
+	}
+	return mask & trackedStages
+}
+
+// stageNames returns the names of the stages of the given mask, separated by
+// '|'.
+func stageNames(mask VkPipelineStageFlags) string {
+	names := []string{}
+	for bit := VkPipelineStageFlags(1); bit != 0 && bit <= mask; bit <<= 1 {
+		if mask&bit != 0 {
+			names = append(names, fmt.Sprint(VkPipelineStageFlagBits(bit)))
+		}
+	}
+	if len(names) == 0 {
+		return "0"
+	}
+	return strings.Join(names, "|")
+}
+
+// barrierUse is the data flow through a pipeline barrier or an event wait
+// command, over all the submissions of the command buffer it is recorded to.
+type barrierUse struct {
+	srcMask, dstMask VkPipelineStageFlags
+	// The stages of the commands that accessed the data guarded by the
+	// barrier before it, and after it.
+	src, dst VkPipelineStageFlags
+	// untracked is true if the data guarded by the barrier is accessed by
+	// commands not tracked by barrierStages, or if the stage masks cannot be
+	// represented, in which case the barrier is never narrowed.
+	untracked bool
+}
+
+// narrowed returns the stages required by the data flow, if they are narrower
+// than the stages covered by the given mask of the barrier, or 0. The stages
+// of the mask which are not tracked by the analysis, such as the host stage,
+// are kept.
+func narrowed(mask, required VkPipelineStageFlags, src bool) VkPipelineStageFlags {
+	covered := expandStages(mask, src)
+	if required == 0 || required&^covered != 0 || required == covered {
+		return 0
+	}
+	return required | mask&^trackedStages&^expandedStages
+}
+
+// barrierAnalyzer tracks the stages of the commands accessing the data
+// guarded by the pipeline barriers and event waits, while the
+// FootprintBuilder rolls out the submitted commands.
+type barrierAnalyzer struct {
+	// The barriers by the IDs of the commands that record them.
+	barriers map[api.CmdID]*barrierUse
+	// The stages of the last write of each variable, and of the reads since
+	// then.
+	accessed map[dependencygraph.DefUseVariable]VkPipelineStageFlags
+	// The variables whose last write, or a read since then, is made by an
+	// untracked command.
+	untracked map[dependencygraph.DefUseVariable]struct{}
+	// The barriers that guard each variable since its last write.
+	pending map[dependencygraph.DefUseVariable][]*barrierUse
+	// The stages of the running command, or the barrier it runs. running is
+	// true while a submitted command runs, as opposed to the behaviors of the
+	// submissions themselves.
+	running bool
+	stages  VkPipelineStageFlags
+	barrier *barrierUse
+}
+
+func newBarrierAnalyzer() *barrierAnalyzer {
+	return &barrierAnalyzer{
+		barriers:  map[api.CmdID]*barrierUse{},
+		accessed:  map[dependencygraph.DefUseVariable]VkPipelineStageFlags{},
+		untracked: map[dependencygraph.DefUseVariable]struct{}{},
+		pending:   map[dependencygraph.DefUseVariable][]*barrierUse{},
+	}
+}
+
+// declare records the stage masks of the barrier or event wait recorded by
+// the command id. ok is false if the masks cannot be represented. It is a
+// no-op on a nil analyzer.
+func (a *barrierAnalyzer) declare(id api.CmdID, src, dst VkPipelineStageFlags, ok bool) {
+	if a == nil {
+		return
+	}
+	a.barriers[id] = &barrierUse{srcMask: src, dstMask: dst, untracked: !ok}
+}
+
+// begin sets the given submitted command as the running one. It is a no-op on
+// a nil analyzer.
+func (a *barrierAnalyzer) begin(ft *dependencygraph.Footprint, sc *submittedCommand) {
+	if a == nil {
+		return
+	}
+	a.running, a.stages, a.barrier = true, 0, nil
+	if sc.cmd == nil || sc.cmd.b == nil || len(sc.cmd.b.Owner) == 0 ||
+		sc.cmd.b.Owner[0] >= uint64(len(ft.Commands)) {
+		return
+	}
+	id := api.CmdID(sc.cmd.b.Owner[0])
+	if b, ok := a.barriers[id]; ok {
+		a.barrier = b
+		return
+	}
+	a.stages = barrierStages(ft.Commands[id])
+}
+
+// end clears the running command. It is a no-op on a nil analyzer.
+func (a *barrierAnalyzer) end() {
+	if a == nil {
+		return
+	}
+	a.running, a.stages, a.barrier = false, 0, nil
+}
+
+// access implements the footprintObserver interface. It records the read or
+// write of the variable by the running command.
+func (a *barrierAnalyzer) access(bh *dependencygraph.Behavior, write bool,
+	c dependencygraph.DefUseVariable) {
+	switch {
+	case a.barrier != nil:
+		if !write {
+			return
+		}
+		for _, b := range a.pending[c] {
+			if b == a.barrier {
+				return
+			}
+		}
+		a.barrier.src |= a.accessed[c]
+		if _, ok := a.untracked[c]; ok {
+			a.barrier.untracked = true
+		}
+		a.pending[c] = append(a.pending[c], a.barrier)
+	case a.stages != 0:
+		for _, b := range a.pending[c] {
+			b.dst |= a.stages
+		}
+		if write {
+			delete(a.pending, c)
+			delete(a.untracked, c)
+			a.accessed[c] = a.stages
+		} else {
+			a.accessed[c] |= a.stages
+		}
+	case a.running:
+		// The stages of the command are unknown, so the barriers guarding
+		// the data cannot be narrowed.
+		for _, b := range a.pending[c] {
+			b.untracked = true
+		}
+		if write {
+			delete(a.pending, c)
+			delete(a.accessed, c)
+		}
+		a.untracked[c] = struct{}{}
+	}
+}
+
+// broadBarriers returns the messages suggesting narrower stage masks for the
+// barriers whose masks cover more stages than the data flow through them
+// requires. The barriers recorded by the commands that build the initial
+// state are dropped.
+func (a *barrierAnalyzer) broadBarriers(numInitialCmds int) map[api.CmdID]*stringtable.Msg {
+	out := map[api.CmdID]*stringtable.Msg{}
+	for id, b := range a.barriers {
+		if id < api.CmdID(numInitialCmds) || b.untracked {
+			continue
+		}
+		src := narrowed(b.srcMask, b.src, true)
+		dst := narrowed(b.dstMask, b.dst, false)
+		if src == 0 && dst == 0 {
+			continue
+		}
+		if src == 0 {
+			src = b.srcMask
+		}
+		if dst == 0 {
+			dst = b.dstMask
+		}
+		out[id-api.CmdID(numInitialCmds)] = messages.WarnBroadBarrier(
+			stageNames(b.srcMask), stageNames(src), stageNames(b.dstMask), stageNames(dst))
+	}
+	return out
+}
+
+// AnalyzeBarriers implements the resolve.BarrierAnalyzer interface. It returns
+// the pipeline barriers and event waits of the given capture whose stage masks
+// are broader than required, from the analysis of the capture.
+func (API) AnalyzeBarriers(ctx context.Context, p *path.Capture) (map[api.CmdID]*stringtable.Msg, error) {
+	a, err := analyzeCapture(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return a.broadBarriers, nil
+}
@@ -0,0 +1,213 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// BoundPipelineState is the effective pipeline state when a submitted command
+// is executed, i.e. the state bound by the commands executed before it in its
+// command buffer, and the render pass begun on its queue.
+type BoundPipelineState struct {
+	// The bound pipelines, indexed by the bind points.
+	Pipelines map[VkPipelineBindPoint]VkPipeline
+	// The last command that set each dynamic state or the push constants,
+	// indexed by the command names. The values of the dynamic states are the
+	// parameters of the commands.
+	DynamicStates map[string]api.Cmd
+	// The bound descriptor sets, indexed by the set numbers.
+	DescriptorSets map[uint32]BoundDescriptorSet
+	// The render pass and framebuffer begun, and the index of the current
+	// subpass. The render pass is VkRenderPass(0) outside of render passes.
+	RenderPass  VkRenderPass
+	Framebuffer VkFramebuffer
+	Subpass     uint64
+	// The bound vertex buffers, indexed by the binding numbers.
+	VertexBuffers map[uint32]BoundBuffer
+	// The bound index buffer, and the type of its indices.
+	IndexBuffer BoundBuffer
+	IndexType   VkIndexType
+}
+
+// BoundDescriptorSet is a descriptor set bound to a set number.
+type BoundDescriptorSet struct {
+	Set            VkDescriptorSet
+	DynamicOffsets []uint32
+	// The descriptors of the set when the command is executed, indexed by the
+	// binding numbers and the array elements. The descriptors which are never
+	// written are nil.
+	Bindings map[uint32][]*BoundDescriptor
+}
+
+// BoundDescriptor is the resource a descriptor points at. The image view and
+// the image are set for image descriptors, the sampler for sampler and
+// combined image sampler descriptors, and the buffer for buffer and texel
+// buffer descriptors. The offsets of the dynamic buffer descriptors include
+// their dynamic offsets. Range is VK_WHOLE_SIZE if the descriptor covers the
+// rest of the buffer.
+type BoundDescriptor struct {
+	Type      VkDescriptorType
+	ImageView VkImageView
+	Image     VkImage
+	Sampler   VkSampler
+	Buffer    VkBuffer
+	Offset    uint64
+	Range     uint64
+}
+
+// BoundBuffer is a buffer bound at an offset.
+type BoundBuffer struct {
+	Buffer VkBuffer
+	Offset uint64
+}
+
+// boundStateRecorder records the bound pipeline states at the submitted
+// commands when the FootprintBuilder rolls out the submitted commands. The
+// commands are indexed by their full command indices seen by the
+// FootprintBuilder. The consecutive commands of a queue with the same state
+// share the recorded state.
+type boundStateRecorder struct {
+	states api.SubCmdIdxTrie
+	// The last state recorded on each queue.
+	last map[*queueExecutionState]*BoundPipelineState
+}
+
+func newBoundStateRecorder() *boundStateRecorder {
+	return &boundStateRecorder{last: map[*queueExecutionState]*BoundPipelineState{}}
+}
+
+// record records the state of the given queue at the given full command index
+// of the footprint. It must be called before the command is executed. It is a
+// no-op on a nil recorder, so the FootprintBuilder can call it
+// unconditionally.
+func (r *boundStateRecorder) record(fci api.SubCmdIdx, qei *queueExecutionState) {
+	if r == nil {
+		return
+	}
+	state := newBoundPipelineState(qei)
+	if last := r.last[qei]; last != nil && reflect.DeepEqual(last, state) {
+		state = last
+	}
+	r.last[qei] = state
+	r.states.SetValue(fci, state)
+}
+
+// newBoundPipelineState returns the state bound on the given queue.
+func newBoundPipelineState(qei *queueExecutionState) *BoundPipelineState {
+	cbs := qei.currentCmdBufState
+	state := &BoundPipelineState{
+		Pipelines:      make(map[VkPipelineBindPoint]VkPipeline, len(cbs.pipelines)),
+		DynamicStates:  make(map[string]api.Cmd, len(cbs.dynamicStateCmds)),
+		DescriptorSets: make(map[uint32]BoundDescriptorSet, len(cbs.descriptorSets)),
+		RenderPass:     qei.renderPass,
+		VertexBuffers:  make(map[uint32]BoundBuffer, len(cbs.vertexBuffers)),
+		IndexBuffer:    BoundBuffer{cbs.indexBuffer, cbs.indexBufferOffset},
+		IndexType:      cbs.indexType,
+	}
+	for bp, vkPi := range cbs.pipelines {
+		state.Pipelines[bp] = vkPi
+	}
+	for name, cmd := range cbs.dynamicStateCmds {
+		state.DynamicStates[name] = cmd
+	}
+	for set, bds := range cbs.descriptorSets {
+		state.DescriptorSets[set] = BoundDescriptorSet{
+			Set:            bds.vkSet,
+			DynamicOffsets: append([]uint32{}, bds.dynamicOffsets...),
+			Bindings:       bds.boundDescriptors(),
+		}
+	}
+	if qei.renderPass != VkRenderPass(0) {
+		state.Framebuffer = qei.framebuffer.VulkanHandle()
+		state.Subpass = qei.subpass.val
+	}
+	for binding, vkBuf := range cbs.vertexBuffers {
+		state.VertexBuffers[binding] = BoundBuffer{vkBuf, cbs.vertexBufferOffsets[binding]}
+	}
+	return state
+}
+
+// ResolveBoundPipelineState returns the bound pipeline state when the given
+// submitted command is executed, e.g. at a draw call, including the resources
+// pointed at by the descriptors of the bound descriptor sets, from the
+// analysis of the capture of the command.
+func ResolveBoundPipelineState(ctx context.Context, p *path.Command) (*BoundPipelineState, error) {
+	if _, ok := cmdBufNestingLevel(p.Indices); !ok {
+		return nil, fmt.Errorf("Not a submitted command: %v", p.Indices)
+	}
+	a, err := analyzeCapture(ctx, p.Capture)
+	if err != nil {
+		return nil, err
+	}
+	fci := append(api.SubCmdIdx{p.Indices[0] + uint64(a.numInitialCmds)}, p.Indices[1:]...)
+	state, ok := a.boundStates.states.Value(fci).(*BoundPipelineState)
+	if !ok {
+		return nil, fmt.Errorf("Command %v is not executed", p.Indices)
+	}
+	return state, nil
+}
+
+// boundDescriptors returns the descriptors of the bound descriptor set. The
+// dynamic offsets are consumed by the dynamic buffer descriptors of the
+// layout in the order of their binding numbers and array elements, whether
+// they are written or not.
+func (bds *boundDescriptorSet) boundDescriptors() map[uint32][]*BoundDescriptor {
+	ds := bds.descriptorSet
+	out := map[uint32][]*BoundDescriptor{}
+	if ds == nil {
+		return out
+	}
+	doi := 0
+	for _, bi := range ds.sortedBindings() {
+		_, dynamic := ds.dynamicBindings[bi]
+		descriptors := make([]*BoundDescriptor, ds.descriptorCounts[bi])
+		for di := range descriptors {
+			dynamicOffset := -1
+			if dynamic {
+				dynamicOffset = doi
+				doi++
+			}
+			v := ds.descriptors.Value([]uint64{bi, uint64(di)})
+			d, ok := v.(*descriptor)
+			if !ok {
+				continue
+			}
+			bd := &BoundDescriptor{
+				Type:      d.ty,
+				ImageView: d.view,
+				Image:     d.img,
+				Buffer:    d.buf,
+				Offset:    uint64(d.bufOffset),
+				Range:     uint64(d.bufRng),
+			}
+			if d.sampler != nil {
+				bd.Sampler = VkSampler(d.sampler.handle)
+			}
+			if isDynamicDescriptorType(d.ty) && dynamicOffset >= 0 &&
+				dynamicOffset < len(bds.dynamicOffsets) {
+				bd.Offset += uint64(bds.dynamicOffsets[dynamicOffset])
+			}
+			descriptors[di] = bd
+		}
+		out[uint32(bi)] = descriptors
+	}
+	return out
+}
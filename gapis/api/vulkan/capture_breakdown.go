@@ -0,0 +1,129 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// ResolveCaptureBreakdown implements the resolve.CaptureBreakdownResolver
+// interface. The shader modules, pipelines and device memory allocations are
+// the ones of the initial state and the ones created by the commands. The draw calls are counted in
+// the render pass they are recorded in, so the draw calls of the secondary
+// command buffers are not counted.
+func (API) ResolveCaptureBreakdown(ctx context.Context, p *path.Capture, out *service.CaptureBreakdown) error {
+	ctx = capture.Put(ctx, p)
+	c, err := capture.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	s, err := capture.NewState(ctx)
+	if err != nil {
+		return err
+	}
+	st := GetState(s)
+	l := s.MemoryLayout
+
+	modules := map[VkShaderModule]struct{}{}
+	for _, m := range st.ShaderModules().Keys() {
+		modules[m] = struct{}{}
+	}
+	pipelines := map[VkPipeline]struct{}{}
+	for _, pi := range st.GraphicsPipelines().Keys() {
+		pipelines[pi] = struct{}{}
+	}
+	for _, pi := range st.ComputePipelines().Keys() {
+		pipelines[pi] = struct{}{}
+	}
+	allocated := uint64(0)
+	for _, m := range st.DeviceMemories().All() {
+		allocated += uint64(m.AllocationSize())
+	}
+	// The render passes being recorded, by command buffer.
+	renderPasses := map[VkCommandBuffer]*service.RenderPassDraws{}
+	beginRenderPass := func(id api.CmdID, vkCb VkCommandBuffer) {
+		rp := &service.RenderPassDraws{Begin: p.Command(uint64(id))}
+		out.RenderPasses = append(out.RenderPasses, rp)
+		renderPasses[vkCb] = rp
+	}
+	numCmdBufs, numRecorded := uint64(0), uint64(0)
+
+	api.ForeachCmd(ctx, c.Commands, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
+		cmd.Mutate(ctx, id, s, nil, nil)
+		switch cmd := cmd.(type) {
+		case *VkCreateShaderModule:
+			if cmd.Result() == VkResult_VK_SUCCESS {
+				modules[cmd.PShaderModule().MustRead(ctx, cmd, s, nil)] = struct{}{}
+			}
+		case *VkAllocateMemory:
+			if cmd.Result() == VkResult_VK_SUCCESS {
+				vkMem := cmd.PMemory().MustRead(ctx, cmd, s, nil)
+				if m := st.DeviceMemories().Get(vkMem); !m.IsNil() {
+					allocated += uint64(m.AllocationSize())
+				}
+			}
+		case *VkCreateGraphicsPipelines:
+			if cmd.Result() == VkResult_VK_SUCCESS {
+				count := uint64(cmd.CreateInfoCount())
+				for _, pi := range cmd.PPipelines().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
+					pipelines[pi] = struct{}{}
+				}
+			}
+		case *VkCreateComputePipelines:
+			if cmd.Result() == VkResult_VK_SUCCESS {
+				count := uint64(cmd.CreateInfoCount())
+				for _, pi := range cmd.PPipelines().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
+					pipelines[pi] = struct{}{}
+				}
+			}
+		case *VkCmdBeginRenderPass:
+			beginRenderPass(id, cmd.CommandBuffer())
+		case *VkCmdBeginRenderPass2:
+			beginRenderPass(id, cmd.CommandBuffer())
+		case *VkCmdEndRenderPass:
+			delete(renderPasses, cmd.CommandBuffer())
+		case *VkCmdEndRenderPass2:
+			delete(renderPasses, cmd.CommandBuffer())
+		case *VkEndCommandBuffer:
+			delete(renderPasses, cmd.CommandBuffer())
+			if cb := st.CommandBuffers().Get(cmd.CommandBuffer()); !cb.IsNil() {
+				numCmdBufs++
+				numRecorded += uint64(cb.CommandReferences().Len())
+			}
+		default:
+			if cb, ok := cmd.(interface{ CommandBuffer() VkCommandBuffer }); ok {
+				if rp := renderPasses[cb.CommandBuffer()]; rp != nil &&
+					cmd.CmdFlags(ctx, id, s).IsExecutedDraw() {
+					rp.Draws++
+				}
+			}
+		}
+		return nil
+	})
+
+	out.ShaderModules += uint64(len(modules))
+	out.Pipelines += uint64(len(pipelines))
+	out.AllocatedDeviceMemory += allocated
+	if numCmdBufs > 0 {
+		out.CommandBuffers += numCmdBufs
+		out.AverageCommandBufferSize = float64(numRecorded) / float64(numCmdBufs)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// physicalDeviceFeatures are the names and getters of the features of
+// VkPhysicalDeviceFeatures, in the order of the struct.
+var physicalDeviceFeatures = []struct {
+	name string
+	get  func(VkPhysicalDeviceFeatures) VkBool32
+}{
+	{"robustBufferAccess", VkPhysicalDeviceFeatures.RobustBufferAccess},
+	{"fullDrawIndexUint32", VkPhysicalDeviceFeatures.FullDrawIndexUint32},
+	{"imageCubeArray", VkPhysicalDeviceFeatures.ImageCubeArray},
+	{"independentBlend", VkPhysicalDeviceFeatures.IndependentBlend},
+	{"geometryShader", VkPhysicalDeviceFeatures.GeometryShader},
+	{"tessellationShader", VkPhysicalDeviceFeatures.TessellationShader},
+	{"sampleRateShading", VkPhysicalDeviceFeatures.SampleRateShading},
+	{"dualSrcBlend", VkPhysicalDeviceFeatures.DualSrcBlend},
+	{"logicOp", VkPhysicalDeviceFeatures.LogicOp},
+	{"multiDrawIndirect", VkPhysicalDeviceFeatures.MultiDrawIndirect},
+	{"drawIndirectFirstInstance", VkPhysicalDeviceFeatures.DrawIndirectFirstInstance},
+	{"depthClamp", VkPhysicalDeviceFeatures.DepthClamp},
+	{"depthBiasClamp", VkPhysicalDeviceFeatures.DepthBiasClamp},
+	{"fillModeNonSolid", VkPhysicalDeviceFeatures.FillModeNonSolid},
+	{"depthBounds", VkPhysicalDeviceFeatures.DepthBounds},
+	{"wideLines", VkPhysicalDeviceFeatures.WideLines},
+	{"largePoints", VkPhysicalDeviceFeatures.LargePoints},
+	{"alphaToOne", VkPhysicalDeviceFeatures.AlphaToOne},
+	{"multiViewport", VkPhysicalDeviceFeatures.MultiViewport},
+	{"samplerAnisotropy", VkPhysicalDeviceFeatures.SamplerAnisotropy},
+	{"textureCompressionETC2", VkPhysicalDeviceFeatures.TextureCompressionETC2},
+	{"textureCompressionASTC_LDR", VkPhysicalDeviceFeatures.TextureCompressionASTC_LDR},
+	{"textureCompressionBC", VkPhysicalDeviceFeatures.TextureCompressionBC},
+	{"occlusionQueryPrecise", VkPhysicalDeviceFeatures.OcclusionQueryPrecise},
+	{"pipelineStatisticsQuery", VkPhysicalDeviceFeatures.PipelineStatisticsQuery},
+	{"vertexPipelineStoresAndAtomics", VkPhysicalDeviceFeatures.VertexPipelineStoresAndAtomics},
+	{"fragmentStoresAndAtomics", VkPhysicalDeviceFeatures.FragmentStoresAndAtomics},
+	{"shaderTessellationAndGeometryPointSize", VkPhysicalDeviceFeatures.ShaderTessellationAndGeometryPointSize},
+	{"shaderImageGatherExtended", VkPhysicalDeviceFeatures.ShaderImageGatherExtended},
+	{"shaderStorageImageExtendedFormats", VkPhysicalDeviceFeatures.ShaderStorageImageExtendedFormats},
+	{"shaderStorageImageMultisample", VkPhysicalDeviceFeatures.ShaderStorageImageMultisample},
+	{"shaderStorageImageReadWithoutFormat", VkPhysicalDeviceFeatures.ShaderStorageImageReadWithoutFormat},
+	{"shaderStorageImageWriteWithoutFormat", VkPhysicalDeviceFeatures.ShaderStorageImageWriteWithoutFormat},
+	{"shaderUniformBufferArrayDynamicIndexing", VkPhysicalDeviceFeatures.ShaderUniformBufferArrayDynamicIndexing},
+	{"shaderSampledImageArrayDynamicIndexing", VkPhysicalDeviceFeatures.ShaderSampledImageArrayDynamicIndexing},
+	{"shaderStorageBufferArrayDynamicIndexing", VkPhysicalDeviceFeatures.ShaderStorageBufferArrayDynamicIndexing},
+	{"shaderStorageImageArrayDynamicIndexing", VkPhysicalDeviceFeatures.ShaderStorageImageArrayDynamicIndexing},
+	{"shaderClipDistance", VkPhysicalDeviceFeatures.ShaderClipDistance},
+	{"shaderCullDistance", VkPhysicalDeviceFeatures.ShaderCullDistance},
+	{"shaderFloat64", VkPhysicalDeviceFeatures.ShaderFloat64},
+	{"shaderInt64", VkPhysicalDeviceFeatures.ShaderInt64},
+	{"shaderInt16", VkPhysicalDeviceFeatures.ShaderInt16},
+	{"shaderResourceResidency", VkPhysicalDeviceFeatures.ShaderResourceResidency},
+	{"shaderResourceMinLod", VkPhysicalDeviceFeatures.ShaderResourceMinLod},
+	{"sparseBinding", VkPhysicalDeviceFeatures.SparseBinding},
+	{"sparseResidencyBuffer", VkPhysicalDeviceFeatures.SparseResidencyBuffer},
+	{"sparseResidencyImage2D", VkPhysicalDeviceFeatures.SparseResidencyImage2D},
+	{"sparseResidencyImage3D", VkPhysicalDeviceFeatures.SparseResidencyImage3D},
+	{"sparseResidency2Samples", VkPhysicalDeviceFeatures.SparseResidency2Samples},
+	{"sparseResidency4Samples", VkPhysicalDeviceFeatures.SparseResidency4Samples},
+	{"sparseResidency8Samples", VkPhysicalDeviceFeatures.SparseResidency8Samples},
+	{"sparseResidency16Samples", VkPhysicalDeviceFeatures.SparseResidency16Samples},
+	{"sparseResidencyAliased", VkPhysicalDeviceFeatures.SparseResidencyAliased},
+	{"variableMultisampleRate", VkPhysicalDeviceFeatures.VariableMultisampleRate},
+	{"inheritedQueries", VkPhysicalDeviceFeatures.InheritedQueries},
+}
+
+// enabledFeatures returns the names of the enabled features.
+func enabledFeatures(f VkPhysicalDeviceFeatures) []string {
+	out := []string{}
+	for _, feature := range physicalDeviceFeatures {
+		if feature.get(f) != VkBool32(0) {
+			out = append(out, feature.name)
+		}
+	}
+	return out
+}
+
+// enabledNames returns the names of the map of enabled extensions or layers,
+// in the order they were enabled.
+func enabledNames(m U32ːstringᵐ) []string {
+	out := []string{}
+	for _, i := range m.Keys() {
+		out = append(out, m.Get(i))
+	}
+	return out
+}
+
+// maxPhysicalDeviceNameSize is VK_MAX_PHYSICAL_DEVICE_NAME_SIZE.
+const maxPhysicalDeviceNameSize = 256
+
+// physicalDeviceName returns the name of the physical device, which is stored
+// as a null-terminated string.
+func physicalDeviceName(props VkPhysicalDeviceProperties) string {
+	name := []byte{}
+	for i := 0; i < maxPhysicalDeviceNameSize; i++ {
+		c := props.DeviceName().Get(i)
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return string(name)
+}
+
+// ResolveCaptureEnvironment implements the resolve.CaptureEnvironmentResolver
+// interface. The instances and devices are the ones of the initial state and
+// the ones created by the commands, including the ones destroyed later.
+func (API) ResolveCaptureEnvironment(ctx context.Context, p *path.Capture, out *service.CaptureEnvironment) error {
+	ctx = capture.Put(ctx, p)
+	c, err := capture.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	s, err := capture.NewState(ctx)
+	if err != nil {
+		return err
+	}
+	st := GetState(s)
+
+	instances := map[VkInstance]struct{}{}
+	devices := map[VkDevice]struct{}{}
+	record := func() {
+		for _, vkInst := range st.Instances().Keys() {
+			if _, ok := instances[vkInst]; ok {
+				continue
+			}
+			instances[vkInst] = struct{}{}
+			inst := st.Instances().Get(vkInst)
+			out.Instances = append(out.Instances, &service.EnvironmentInstance{
+				Api:               "Vulkan",
+				Handle:            uint64(vkInst),
+				ApiVersion:        inst.ApiVersion(),
+				EnabledLayers:     enabledNames(inst.EnabledLayers()),
+				EnabledExtensions: enabledNames(inst.EnabledExtensions()),
+			})
+		}
+		for _, vkDev := range st.Devices().Keys() {
+			if _, ok := devices[vkDev]; ok {
+				continue
+			}
+			devices[vkDev] = struct{}{}
+			dev := st.Devices().Get(vkDev)
+			env := &service.EnvironmentDevice{
+				Api:               "Vulkan",
+				Handle:            uint64(vkDev),
+				EnabledLayers:     enabledNames(dev.EnabledLayers()),
+				EnabledExtensions: enabledNames(dev.EnabledExtensions()),
+				EnabledFeatures:   enabledFeatures(dev.EnabledFeatures()),
+			}
+			if phyDev, ok := st.PhysicalDevices().Lookup(dev.PhysicalDevice()); ok {
+				props := phyDev.PhysicalDeviceProperties()
+				env.Name = physicalDeviceName(props)
+				env.Type = props.DeviceType().String()
+				env.ApiVersion = props.ApiVersion()
+				env.DriverVersion = props.DriverVersion()
+				env.VendorId = props.VendorID()
+				env.DeviceId = props.DeviceID()
+			}
+			out.Devices = append(out.Devices, env)
+		}
+	}
+
+	record()
+	api.ForeachCmd(ctx, c.Commands, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
+		cmd.Mutate(ctx, id, s, nil, nil)
+		switch cmd.(type) {
+		case *VkCreateInstance, *VkCreateDevice:
+			record()
+		}
+		return nil
+	})
+	return nil
+}
+
+// CaptureEnvironmentMismatches implements the
+// resolve.CaptureEnvironmentResolver interface. The layers and instance
+// extensions are checked against the ones installed on the replay device, and
+// the physical devices against the ones of the replay device. The device
+// extensions and features are not listed by the replay device, so they are not
+// checked.
+func (API) CaptureEnvironmentMismatches(ctx context.Context, env *service.CaptureEnvironment, d *device.Instance) []string {
+	out := []string{}
+	driver := d.GetConfiguration().GetDrivers().GetVulkan()
+	if driver == nil {
+		for _, inst := range env.Instances {
+			if inst.Api == "Vulkan" {
+				return append(out, "The replay device does not support Vulkan")
+			}
+		}
+		return out
+	}
+
+	layers := map[string]bool{}
+	extensions := map[string]bool{}
+	for _, e := range driver.GetIcdAndImplicitLayerExtensions() {
+		extensions[e] = true
+	}
+	for _, l := range driver.GetLayers() {
+		layers[l.GetName()] = true
+		for _, e := range l.GetExtensions() {
+			extensions[e] = true
+		}
+	}
+	for _, inst := range env.Instances {
+		if inst.Api != "Vulkan" {
+			continue
+		}
+		for _, l := range inst.EnabledLayers {
+			if !layers[l] {
+				out = append(out, fmt.Sprintf("Instance %v enables the layer %v, which is not installed", inst.Handle, l))
+			}
+		}
+		for _, e := range inst.EnabledExtensions {
+			if !extensions[e] {
+				out = append(out, fmt.Sprintf("Instance %v enables the extension %v, which is not supported", inst.Handle, e))
+			}
+		}
+	}
+
+	for _, dev := range env.Devices {
+		if dev.Api != "Vulkan" {
+			continue
+		}
+		var match *device.VulkanPhysicalDevice
+		for _, phy := range driver.GetPhysicalDevices() {
+			if phy.GetVendorId() == dev.VendorId && phy.GetDeviceId() == dev.DeviceId {
+				match = phy
+				break
+			}
+		}
+		switch {
+		case match == nil:
+			out = append(out, fmt.Sprintf("Device %v was created on %v (vendor 0x%x, device 0x%x), which the replay device does not have",
+				dev.Handle, dev.Name, dev.VendorId, dev.DeviceId))
+		case match.GetApiVersion() < dev.ApiVersion:
+			out = append(out, fmt.Sprintf("Device %v supports the API version 0x%x, but the replay device only supports 0x%x",
+				dev.Handle, dev.ApiVersion, match.GetApiVersion()))
+		case match.GetDriverVersion() != dev.DriverVersion:
+			out = append(out, fmt.Sprintf("Device %v was created with the driver version 0x%x, but the replay device has 0x%x",
+				dev.Handle, dev.DriverVersion, match.GetDriverVersion()))
+		}
+	}
+	return out
+}
@@ -96,10 +96,15 @@ func allocateNewCmdBufFromExistingOneAndBegin(
 			allocateData.Ptr(), newCmdBufData.Ptr(), VkResult_VK_SUCCESS,
 		).AddRead(allocateData.Data()).AddWrite(newCmdBufData.Data()))
 
+	// A secondary command buffer executed within a render pass must continue
+	// the render pass, otherwise its draw commands are invalid.
+	usage := VkCommandBufferUsageFlags(VkCommandBufferUsageFlagBits_VK_COMMAND_BUFFER_USAGE_ONE_TIME_SUBMIT_BIT)
+	usage |= modelCmdBufObj.BeginInfo().Flags() &
+		VkCommandBufferUsageFlags(VkCommandBufferUsageFlagBits_VK_COMMAND_BUFFER_USAGE_RENDER_PASS_CONTINUE_BIT)
 	beginInfo := NewVkCommandBufferBeginInfo(a,
 		VkStructureType_VK_STRUCTURE_TYPE_COMMAND_BUFFER_BEGIN_INFO,
 		NewVoidᶜᵖ(memory.Nullptr),
-		VkCommandBufferUsageFlags(VkCommandBufferUsageFlagBits_VK_COMMAND_BUFFER_USAGE_ONE_TIME_SUBMIT_BIT),
+		usage,
 		NewVkCommandBufferInheritanceInfoᶜᵖ(memory.Nullptr),
 	)
 	if bi := modelCmdBufObj.BeginInfo(); bi.Inherited() {
@@ -744,6 +749,54 @@ func rebuildVkCmdDrawIndirect(
 	), nil
 }
 
+func rebuildVkCmdDrawIndirectCountKHR(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdDrawIndirectCountKHRArgsʳ) (func(), api.Cmd, error) {
+
+	if !GetState(s).Buffers().Contains(d.Buffer()) {
+		return nil, nil, fmt.Errorf("Cannot find Buffer %v", d.Buffer())
+	}
+	if !GetState(s).Buffers().Contains(d.CountBuffer()) {
+		return nil, nil, fmt.Errorf("Cannot find Buffer %v", d.CountBuffer())
+	}
+	return func() {}, cb.VkCmdDrawIndirectCountKHR(commandBuffer,
+		d.Buffer(),
+		d.Offset(),
+		d.CountBuffer(),
+		d.CountBufferOffset(),
+		d.MaxDrawCount(),
+		d.Stride(),
+	), nil
+}
+
+func rebuildVkCmdDrawIndexedIndirectCountKHR(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdDrawIndexedIndirectCountKHRArgsʳ) (func(), api.Cmd, error) {
+
+	if !GetState(s).Buffers().Contains(d.Buffer()) {
+		return nil, nil, fmt.Errorf("Cannot find Buffer %v", d.Buffer())
+	}
+	if !GetState(s).Buffers().Contains(d.CountBuffer()) {
+		return nil, nil, fmt.Errorf("Cannot find Buffer %v", d.CountBuffer())
+	}
+	return func() {}, cb.VkCmdDrawIndexedIndirectCountKHR(commandBuffer,
+		d.Buffer(),
+		d.Offset(),
+		d.CountBuffer(),
+		d.CountBufferOffset(),
+		d.MaxDrawCount(),
+		d.Stride(),
+	), nil
+}
+
 func rebuildVkCmdEndQuery(
 	ctx context.Context,
 	cb CommandBuilder,
@@ -1141,6 +1194,590 @@ func rebuildVkCmdDebugMarkerInsertEXT(
 			markerNameData.Data()).AddRead(markerInfoData.Data()), nil
 }
 
+// unpackVideoReferenceSlots allocates the given recorded video reference slots
+// as VkVideoReferenceSlotInfoKHR structs, along with the picture resources
+// they point to. It returns the allocated reference slots and a function to
+// free all the allocated data.
+func unpackVideoReferenceSlots(ctx context.Context, s *api.GlobalState,
+	slots []VideoReferenceSlot) (api.AllocResult, func()) {
+	a := s.Arena // TODO: Should this be a seperate temporary arena?
+
+	pictureData := []api.AllocResult{}
+	infos := make([]VkVideoReferenceSlotInfoKHR, len(slots))
+	for i, slot := range slots {
+		picturePtr := memory.Nullptr
+		if slot.HasPictureResource() {
+			data := s.AllocDataOrPanic(ctx, slot.PictureResource())
+			pictureData = append(pictureData, data)
+			picturePtr = data.Ptr()
+		}
+		infos[i] = NewVkVideoReferenceSlotInfoKHR(a,
+			VkStructureType_VK_STRUCTURE_TYPE_VIDEO_REFERENCE_SLOT_INFO_KHR, // sType
+			NewVoidᶜᵖ(memory.Nullptr),                                       // pNext
+			slot.SlotIndex(),                                                // slotIndex
+			NewVkVideoPictureResourceInfoKHRᶜᵖ(picturePtr),                  // pPictureResource
+		)
+	}
+	infoData := s.AllocDataOrPanic(ctx, infos)
+	return infoData, func() {
+		infoData.Free()
+		for _, d := range pictureData {
+			d.Free()
+		}
+	}
+}
+
+func videoReferenceSlots(m U32ːVideoReferenceSlotᵐ) []VideoReferenceSlot {
+	slots := make([]VideoReferenceSlot, m.Len())
+	for i := range slots {
+		slots[i] = m.Get(uint32(i))
+	}
+	return slots
+}
+
+func rebuildVkCmdBeginVideoCodingKHR(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdBeginVideoCodingKHRArgsʳ) (func(), api.Cmd, error) {
+
+	a := s.Arena // TODO: Should this be a seperate temporary arena?
+
+	if !GetState(s).VideoSessions().Contains(d.VideoSession()) {
+		return nil, nil, fmt.Errorf("Cannot find VideoSession %v", d.VideoSession())
+	}
+	if d.VideoSessionParameters() != VkVideoSessionParametersKHR(0) &&
+		!GetState(s).VideoSessionParameters().Contains(d.VideoSessionParameters()) {
+		return nil, nil, fmt.Errorf("Cannot find VideoSessionParameters %v", d.VideoSessionParameters())
+	}
+
+	slotData, freeSlots := unpackVideoReferenceSlots(ctx, s, videoReferenceSlots(d.ReferenceSlots()))
+	begin := NewVkVideoBeginCodingInfoKHR(a,
+		VkStructureType_VK_STRUCTURE_TYPE_VIDEO_BEGIN_CODING_INFO_KHR, // sType
+		NewVoidᶜᵖ(memory.Nullptr),                                     // pNext
+		0,                                                             // flags
+		d.VideoSession(),                                              // videoSession
+		d.VideoSessionParameters(),                                    // videoSessionParameters
+		uint32(d.ReferenceSlots().Len()),                              // referenceSlotCount
+		NewVkVideoReferenceSlotInfoKHRᶜᵖ(slotData.Ptr()), // pReferenceSlots
+	)
+	beginData := s.AllocDataOrPanic(ctx, begin)
+
+	return func() {
+			freeSlots()
+			beginData.Free()
+		}, cb.VkCmdBeginVideoCodingKHR(commandBuffer,
+			beginData.Ptr()).AddRead(beginData.Data()).AddRead(slotData.Data()), nil
+}
+
+func rebuildVkCmdEndVideoCodingKHR(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdEndVideoCodingKHRArgsʳ) (func(), api.Cmd, error) {
+
+	a := s.Arena // TODO: Should this be a seperate temporary arena?
+
+	end := NewVkVideoEndCodingInfoKHR(a,
+		VkStructureType_VK_STRUCTURE_TYPE_VIDEO_END_CODING_INFO_KHR, // sType
+		NewVoidᶜᵖ(memory.Nullptr),                                   // pNext
+		d.Flags(),                                                   // flags
+	)
+	endData := s.AllocDataOrPanic(ctx, end)
+
+	return func() {
+			endData.Free()
+		}, cb.VkCmdEndVideoCodingKHR(commandBuffer,
+			endData.Ptr()).AddRead(endData.Data()), nil
+}
+
+func rebuildVkCmdControlVideoCodingKHR(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdControlVideoCodingKHRArgsʳ) (func(), api.Cmd, error) {
+
+	a := s.Arena // TODO: Should this be a seperate temporary arena?
+
+	control := NewVkVideoCodingControlInfoKHR(a,
+		VkStructureType_VK_STRUCTURE_TYPE_VIDEO_CODING_CONTROL_INFO_KHR, // sType
+		NewVoidᶜᵖ(memory.Nullptr),                                       // pNext
+		d.Flags(),                                                       // flags
+	)
+	controlData := s.AllocDataOrPanic(ctx, control)
+
+	return func() {
+			controlData.Free()
+		}, cb.VkCmdControlVideoCodingKHR(commandBuffer,
+			controlData.Ptr()).AddRead(controlData.Data()), nil
+}
+
+func rebuildVkCmdDecodeVideoKHR(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdDecodeVideoKHRArgsʳ) (func(), api.Cmd, error) {
+
+	a := s.Arena // TODO: Should this be a seperate temporary arena?
+
+	if !GetState(s).Buffers().Contains(d.SrcBuffer()) {
+		return nil, nil, fmt.Errorf("Cannot find Buffer %v", d.SrcBuffer())
+	}
+
+	setupSlots := []VideoReferenceSlot{}
+	if d.HasSetupReferenceSlot() {
+		setupSlots = append(setupSlots, d.SetupReferenceSlot())
+	}
+	setupData, freeSetup := unpackVideoReferenceSlots(ctx, s, setupSlots)
+	setupPtr := memory.Nullptr
+	if d.HasSetupReferenceSlot() {
+		setupPtr = setupData.Ptr()
+	}
+	slotData, freeSlots := unpackVideoReferenceSlots(ctx, s, videoReferenceSlots(d.ReferenceSlots()))
+
+	info := NewVkVideoDecodeInfoKHR(a,
+		VkStructureType_VK_STRUCTURE_TYPE_VIDEO_DECODE_INFO_KHR, // sType
+		NewVoidᶜᵖ(memory.Nullptr),                               // pNext
+		d.Flags(),                                               // flags
+		d.SrcBuffer(),                                           // srcBuffer
+		d.SrcBufferOffset(),                                     // srcBufferOffset
+		d.SrcBufferRange(),                                      // srcBufferRange
+		d.DstPictureResource(),                                  // dstPictureResource
+		NewVkVideoReferenceSlotInfoKHRᶜᵖ(setupPtr),              // pSetupReferenceSlot
+		uint32(d.ReferenceSlots().Len()),                        // referenceSlotCount
+		NewVkVideoReferenceSlotInfoKHRᶜᵖ(slotData.Ptr()),        // pReferenceSlots
+	)
+	infoData := s.AllocDataOrPanic(ctx, info)
+
+	return func() {
+			freeSetup()
+			freeSlots()
+			infoData.Free()
+		}, cb.VkCmdDecodeVideoKHR(commandBuffer,
+			infoData.Ptr()).AddRead(infoData.Data()).AddRead(setupData.Data()).AddRead(slotData.Data()), nil
+}
+
+func rebuildVkCmdEncodeVideoKHR(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdEncodeVideoKHRArgsʳ) (func(), api.Cmd, error) {
+
+	a := s.Arena // TODO: Should this be a seperate temporary arena?
+
+	if !GetState(s).Buffers().Contains(d.DstBuffer()) {
+		return nil, nil, fmt.Errorf("Cannot find Buffer %v", d.DstBuffer())
+	}
+
+	setupSlots := []VideoReferenceSlot{}
+	if d.HasSetupReferenceSlot() {
+		setupSlots = append(setupSlots, d.SetupReferenceSlot())
+	}
+	setupData, freeSetup := unpackVideoReferenceSlots(ctx, s, setupSlots)
+	setupPtr := memory.Nullptr
+	if d.HasSetupReferenceSlot() {
+		setupPtr = setupData.Ptr()
+	}
+	slotData, freeSlots := unpackVideoReferenceSlots(ctx, s, videoReferenceSlots(d.ReferenceSlots()))
+
+	info := NewVkVideoEncodeInfoKHR(a,
+		VkStructureType_VK_STRUCTURE_TYPE_VIDEO_ENCODE_INFO_KHR, // sType
+		NewVoidᶜᵖ(memory.Nullptr),                               // pNext
+		d.Flags(),                                               // flags
+		d.DstBuffer(),                                           // dstBuffer
+		d.DstBufferOffset(),                                     // dstBufferOffset
+		d.DstBufferRange(),                                      // dstBufferRange
+		d.SrcPictureResource(),                                  // srcPictureResource
+		NewVkVideoReferenceSlotInfoKHRᶜᵖ(setupPtr),              // pSetupReferenceSlot
+		uint32(d.ReferenceSlots().Len()),                        // referenceSlotCount
+		NewVkVideoReferenceSlotInfoKHRᶜᵖ(slotData.Ptr()),        // pReferenceSlots
+		d.PrecedingExternallyEncodedBytes(),                     // precedingExternallyEncodedBytes
+	)
+	infoData := s.AllocDataOrPanic(ctx, info)
+
+	return func() {
+			freeSetup()
+			freeSlots()
+			infoData.Free()
+		}, cb.VkCmdEncodeVideoKHR(commandBuffer,
+			infoData.Ptr()).AddRead(infoData.Data()).AddRead(setupData.Data()).AddRead(slotData.Data()), nil
+}
+
+func rebuildVkCmdDrawMeshTasksEXT(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdDrawMeshTasksEXTArgsʳ) (func(), api.Cmd, error) {
+	return func() {}, cb.VkCmdDrawMeshTasksEXT(commandBuffer,
+		d.GroupCountX(),
+		d.GroupCountY(),
+		d.GroupCountZ(),
+	), nil
+}
+
+func rebuildVkCmdDrawMeshTasksIndirectEXT(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdDrawMeshTasksIndirectEXTArgsʳ) (func(), api.Cmd, error) {
+
+	if !GetState(s).Buffers().Contains(d.Buffer()) {
+		return nil, nil, fmt.Errorf("Cannot find Buffer %v", d.Buffer())
+	}
+	return func() {}, cb.VkCmdDrawMeshTasksIndirectEXT(commandBuffer,
+		d.Buffer(),
+		d.Offset(),
+		d.DrawCount(),
+		d.Stride(),
+	), nil
+}
+
+func rebuildVkCmdDrawMeshTasksIndirectCountEXT(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdDrawMeshTasksIndirectCountEXTArgsʳ) (func(), api.Cmd, error) {
+
+	if !GetState(s).Buffers().Contains(d.Buffer()) {
+		return nil, nil, fmt.Errorf("Cannot find Buffer %v", d.Buffer())
+	}
+	if !GetState(s).Buffers().Contains(d.CountBuffer()) {
+		return nil, nil, fmt.Errorf("Cannot find Buffer %v", d.CountBuffer())
+	}
+	return func() {}, cb.VkCmdDrawMeshTasksIndirectCountEXT(commandBuffer,
+		d.Buffer(),
+		d.Offset(),
+		d.CountBuffer(),
+		d.CountBufferOffset(),
+		d.MaxDrawCount(),
+		d.Stride(),
+	), nil
+}
+
+func rebuildVkCmdDrawMeshTasksNV(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdDrawMeshTasksNVArgsʳ) (func(), api.Cmd, error) {
+	return func() {}, cb.VkCmdDrawMeshTasksNV(commandBuffer,
+		d.TaskCount(),
+		d.FirstTask(),
+	), nil
+}
+
+func rebuildVkCmdDrawMeshTasksIndirectNV(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdDrawMeshTasksIndirectNVArgsʳ) (func(), api.Cmd, error) {
+
+	if !GetState(s).Buffers().Contains(d.Buffer()) {
+		return nil, nil, fmt.Errorf("Cannot find Buffer %v", d.Buffer())
+	}
+	return func() {}, cb.VkCmdDrawMeshTasksIndirectNV(commandBuffer,
+		d.Buffer(),
+		d.Offset(),
+		d.DrawCount(),
+		d.Stride(),
+	), nil
+}
+
+func rebuildVkCmdDrawMeshTasksIndirectCountNV(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdDrawMeshTasksIndirectCountNVArgsʳ) (func(), api.Cmd, error) {
+
+	if !GetState(s).Buffers().Contains(d.Buffer()) {
+		return nil, nil, fmt.Errorf("Cannot find Buffer %v", d.Buffer())
+	}
+	if !GetState(s).Buffers().Contains(d.CountBuffer()) {
+		return nil, nil, fmt.Errorf("Cannot find Buffer %v", d.CountBuffer())
+	}
+	return func() {}, cb.VkCmdDrawMeshTasksIndirectCountNV(commandBuffer,
+		d.Buffer(),
+		d.Offset(),
+		d.CountBuffer(),
+		d.CountBufferOffset(),
+		d.MaxDrawCount(),
+		d.Stride(),
+	), nil
+}
+
+func rebuildVkCmdSetFragmentShadingRateKHR(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdSetFragmentShadingRateKHRArgsʳ) (func(), api.Cmd, error) {
+
+	sizeData := s.AllocDataOrPanic(ctx, d.FragmentSize())
+	combinerOps := NewVkFragmentShadingRateCombinerOpKHRː2ᵃ(s.Arena,
+		d.PrimitiveCombinerOp(), d.AttachmentCombinerOp())
+
+	return func() {
+			sizeData.Free()
+		}, cb.VkCmdSetFragmentShadingRateKHR(commandBuffer,
+			sizeData.Ptr(),
+			combinerOps,
+		).AddRead(sizeData.Data()), nil
+}
+
+// unpackDependencyInfo allocates the barrier arrays of the given dependency
+// info and returns a VkDependencyInfoKHR referencing them, along with the
+// allocations backing it.
+func unpackDependencyInfo(
+	ctx context.Context,
+	s *api.GlobalState,
+	d DependencyInfoʳ) (VkDependencyInfoKHR, []api.AllocResult, error) {
+
+	a := s.Arena // TODO: Should this be a seperate temporary arena?
+
+	for i, c := 0, d.BufferMemoryBarriers().Len(); i < c; i++ {
+		buf := d.BufferMemoryBarriers().Get(uint32(i)).Buffer()
+		if !GetState(s).Buffers().Contains(buf) {
+			return NilVkDependencyInfoKHR, nil, fmt.Errorf("Cannot find Buffer %v", buf)
+		}
+	}
+
+	for i, c := 0, d.ImageMemoryBarriers().Len(); i < c; i++ {
+		img := d.ImageMemoryBarriers().Get(uint32(i)).Image()
+		if !GetState(s).Images().Contains(img) {
+			return NilVkDependencyInfoKHR, nil, fmt.Errorf("Cannot find Image %v", img)
+		}
+	}
+
+	memoryBarrierData, memoryBarrierCount := unpackMap(ctx, s, d.MemoryBarriers())
+	bufferMemoryBarrierData, bufferMemoryBarrierCount := unpackMap(ctx, s, d.BufferMemoryBarriers())
+	imageMemoryBarrierData, imageMemoryBarrierCount := unpackMap(ctx, s, d.ImageMemoryBarriers())
+
+	info := NewVkDependencyInfoKHR(a,
+		VkStructureType_VK_STRUCTURE_TYPE_DEPENDENCY_INFO_KHR, // sType
+		0,                   // pNext
+		d.DependencyFlags(), // dependencyFlags
+		memoryBarrierCount,  // memoryBarrierCount
+		NewVkMemoryBarrier2KHRᶜᵖ(memoryBarrierData.Ptr()),             // pMemoryBarriers
+		bufferMemoryBarrierCount,                                      // bufferMemoryBarrierCount
+		NewVkBufferMemoryBarrier2KHRᶜᵖ(bufferMemoryBarrierData.Ptr()), // pBufferMemoryBarriers
+		imageMemoryBarrierCount,                                       // imageMemoryBarrierCount
+		NewVkImageMemoryBarrier2KHRᶜᵖ(imageMemoryBarrierData.Ptr()),   // pImageMemoryBarriers
+	)
+	return info, []api.AllocResult{memoryBarrierData, bufferMemoryBarrierData, imageMemoryBarrierData}, nil
+}
+
+func rebuildVkCmdSetEvent2KHR(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdSetEvent2KHRArgsʳ) (func(), api.Cmd, error) {
+	if !GetState(s).Events().Contains(d.Event()) {
+		return nil, nil, fmt.Errorf("Cannot find Event %v", d.Event())
+	}
+
+	info, barrierData, err := unpackDependencyInfo(ctx, s, d.DependencyInfo())
+	if err != nil {
+		return nil, nil, err
+	}
+	infoData := s.AllocDataOrPanic(ctx, info)
+
+	cmd := cb.VkCmdSetEvent2KHR(commandBuffer,
+		d.Event(),
+		infoData.Ptr(),
+	).AddRead(infoData.Data())
+	for _, data := range barrierData {
+		cmd.AddRead(data.Data())
+	}
+
+	return func() {
+		infoData.Free()
+		for _, data := range barrierData {
+			data.Free()
+		}
+	}, cmd, nil
+}
+
+func rebuildVkCmdResetEvent2KHR(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdResetEvent2KHRArgsʳ) (func(), api.Cmd, error) {
+	if !GetState(s).Events().Contains(d.Event()) {
+		return nil, nil, fmt.Errorf("Cannot find Event %v", d.Event())
+	}
+	return func() {
+		}, cb.VkCmdResetEvent2KHR(commandBuffer,
+			d.Event(),
+			d.StageMask(),
+		), nil
+}
+
+func rebuildVkCmdWaitEvents2KHR(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdWaitEvents2KHRArgsʳ) (func(), api.Cmd, error) {
+
+	for i, c := 0, d.Events().Len(); i < c; i++ {
+		evt := d.Events().Get(uint32(i))
+		if !GetState(s).Events().Contains(evt) {
+			return nil, nil, fmt.Errorf("Cannot find Event %v", evt)
+		}
+	}
+
+	infos := make([]VkDependencyInfoKHR, d.DependencyInfos().Len())
+	allData := []api.AllocResult{}
+	for i := range infos {
+		info, barrierData, err := unpackDependencyInfo(ctx, s, d.DependencyInfos().Get(uint32(i)))
+		if err != nil {
+			for _, data := range allData {
+				data.Free()
+			}
+			return nil, nil, err
+		}
+		infos[i] = info
+		allData = append(allData, barrierData...)
+	}
+
+	eventData, eventCount := unpackMap(ctx, s, d.Events())
+	infoData := s.AllocDataOrPanic(ctx, infos)
+	allData = append(allData, eventData, infoData)
+
+	cmd := cb.VkCmdWaitEvents2KHR(commandBuffer,
+		eventCount,
+		eventData.Ptr(),
+		infoData.Ptr(),
+	)
+	for _, data := range allData {
+		cmd.AddRead(data.Data())
+	}
+
+	return func() {
+		for _, data := range allData {
+			data.Free()
+		}
+	}, cmd, nil
+}
+
+func rebuildVkCmdPipelineBarrier2KHR(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdPipelineBarrier2KHRArgsʳ) (func(), api.Cmd, error) {
+
+	info, barrierData, err := unpackDependencyInfo(ctx, s, d.DependencyInfo())
+	if err != nil {
+		return nil, nil, err
+	}
+	infoData := s.AllocDataOrPanic(ctx, info)
+
+	cmd := cb.VkCmdPipelineBarrier2KHR(commandBuffer,
+		infoData.Ptr(),
+	).AddRead(infoData.Data())
+	for _, data := range barrierData {
+		cmd.AddRead(data.Data())
+	}
+
+	return func() {
+		infoData.Free()
+		for _, data := range barrierData {
+			data.Free()
+		}
+	}, cmd, nil
+}
+
+func rebuildVkCmdBeginDebugUtilsLabelEXT(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdBeginDebugUtilsLabelEXTArgsʳ) (func(), api.Cmd, error) {
+
+	a := s.Arena // TODO: Should this be a seperate temporary arena?
+
+	labelNameData := s.AllocDataOrPanic(ctx, d.LabelName())
+	color := NewF32ː4ᵃ(a, d.Color().Get(0), d.Color().Get(1), d.Color().Get(2), d.Color().Get(3))
+	labelInfoData := s.AllocDataOrPanic(ctx,
+		NewVkDebugUtilsLabelEXT(a,
+			VkStructureType_VK_STRUCTURE_TYPE_DEBUG_UTILS_LABEL_EXT,
+			NewVoidᶜᵖ(memory.Nullptr),
+			NewCharᶜᵖ(labelNameData.Ptr()),
+			color,
+		))
+	return func() {
+			labelNameData.Free()
+			labelInfoData.Free()
+		}, cb.VkCmdBeginDebugUtilsLabelEXT(commandBuffer, labelInfoData.Ptr()).AddRead(
+			labelNameData.Data()).AddRead(labelInfoData.Data()), nil
+}
+
+func rebuildVkCmdEndDebugUtilsLabelEXT(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdEndDebugUtilsLabelEXTArgsʳ) (func(), api.Cmd, error) {
+	return func() {}, cb.VkCmdEndDebugUtilsLabelEXT(commandBuffer), nil
+}
+
+func rebuildVkCmdInsertDebugUtilsLabelEXT(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdInsertDebugUtilsLabelEXTArgsʳ) (func(), api.Cmd, error) {
+
+	a := s.Arena // TODO: Should this be a seperate temporary arena?
+
+	labelNameData := s.AllocDataOrPanic(ctx, d.LabelName())
+	color := NewF32ː4ᵃ(a, d.Color().Get(0), d.Color().Get(1), d.Color().Get(2), d.Color().Get(3))
+	labelInfoData := s.AllocDataOrPanic(ctx,
+		NewVkDebugUtilsLabelEXT(a,
+			VkStructureType_VK_STRUCTURE_TYPE_DEBUG_UTILS_LABEL_EXT,
+			NewVoidᶜᵖ(memory.Nullptr),
+			NewCharᶜᵖ(labelNameData.Ptr()),
+			color,
+		))
+	return func() {
+			labelNameData.Free()
+			labelInfoData.Free()
+		}, cb.VkCmdInsertDebugUtilsLabelEXT(commandBuffer, labelInfoData.Ptr()).AddRead(
+			labelNameData.Data()).AddRead(labelInfoData.Data()), nil
+}
+
 // GetCommandArgs takes a command reference and returns the command arguments
 // of that recorded command.
 func GetCommandArgs(ctx context.Context,
@@ -1244,6 +1881,48 @@ func GetCommandArgs(ctx context.Context,
 		return cmds.VkCmdDebugMarkerEndEXT().Get(cr.MapIndex())
 	case CommandType_cmd_vkCmdDebugMarkerInsertEXT:
 		return cmds.VkCmdDebugMarkerInsertEXT().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdBeginVideoCodingKHR:
+		return cmds.VkCmdBeginVideoCodingKHR().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdEndVideoCodingKHR:
+		return cmds.VkCmdEndVideoCodingKHR().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdControlVideoCodingKHR:
+		return cmds.VkCmdControlVideoCodingKHR().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdDecodeVideoKHR:
+		return cmds.VkCmdDecodeVideoKHR().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdEncodeVideoKHR:
+		return cmds.VkCmdEncodeVideoKHR().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdDrawMeshTasksEXT:
+		return cmds.VkCmdDrawMeshTasksEXT().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdDrawMeshTasksIndirectEXT:
+		return cmds.VkCmdDrawMeshTasksIndirectEXT().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdDrawMeshTasksIndirectCountEXT:
+		return cmds.VkCmdDrawMeshTasksIndirectCountEXT().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdDrawMeshTasksNV:
+		return cmds.VkCmdDrawMeshTasksNV().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdDrawMeshTasksIndirectNV:
+		return cmds.VkCmdDrawMeshTasksIndirectNV().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdDrawMeshTasksIndirectCountNV:
+		return cmds.VkCmdDrawMeshTasksIndirectCountNV().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdSetFragmentShadingRateKHR:
+		return cmds.VkCmdSetFragmentShadingRateKHR().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdSetEvent2KHR:
+		return cmds.VkCmdSetEvent2KHR().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdResetEvent2KHR:
+		return cmds.VkCmdResetEvent2KHR().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdWaitEvents2KHR:
+		return cmds.VkCmdWaitEvents2KHR().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdPipelineBarrier2KHR:
+		return cmds.VkCmdPipelineBarrier2KHR().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdBeginDebugUtilsLabelEXT:
+		return cmds.VkCmdBeginDebugUtilsLabelEXT().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdEndDebugUtilsLabelEXT:
+		return cmds.VkCmdEndDebugUtilsLabelEXT().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdInsertDebugUtilsLabelEXT:
+		return cmds.VkCmdInsertDebugUtilsLabelEXT().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdDrawIndirectCountKHR:
+		return cmds.VkCmdDrawIndirectCountKHR().Get(cr.MapIndex())
+	case CommandType_cmd_vkCmdDrawIndexedIndirectCountKHR:
+		return cmds.VkCmdDrawIndexedIndirectCountKHR().Get(cr.MapIndex())
 	default:
 		x := fmt.Sprintf("Should not reach here: %T", cr)
 		panic(x)
@@ -1349,6 +2028,48 @@ func GetCommandFunction(cr *CommandReference) interface{} {
 		return subDovkCmdDebugMarkerEndEXT
 	case CommandType_cmd_vkCmdDebugMarkerInsertEXT:
 		return subDovkCmdDebugMarkerInsertEXT
+	case CommandType_cmd_vkCmdBeginVideoCodingKHR:
+		return subDovkCmdBeginVideoCodingKHR
+	case CommandType_cmd_vkCmdEndVideoCodingKHR:
+		return subDovkCmdEndVideoCodingKHR
+	case CommandType_cmd_vkCmdControlVideoCodingKHR:
+		return subDovkCmdControlVideoCodingKHR
+	case CommandType_cmd_vkCmdDecodeVideoKHR:
+		return subDovkCmdDecodeVideoKHR
+	case CommandType_cmd_vkCmdEncodeVideoKHR:
+		return subDovkCmdEncodeVideoKHR
+	case CommandType_cmd_vkCmdDrawMeshTasksEXT:
+		return subDovkCmdDrawMeshTasksEXT
+	case CommandType_cmd_vkCmdDrawMeshTasksIndirectEXT:
+		return subDovkCmdDrawMeshTasksIndirectEXT
+	case CommandType_cmd_vkCmdDrawMeshTasksIndirectCountEXT:
+		return subDovkCmdDrawMeshTasksIndirectCountEXT
+	case CommandType_cmd_vkCmdDrawMeshTasksNV:
+		return subDovkCmdDrawMeshTasksNV
+	case CommandType_cmd_vkCmdDrawMeshTasksIndirectNV:
+		return subDovkCmdDrawMeshTasksIndirectNV
+	case CommandType_cmd_vkCmdDrawMeshTasksIndirectCountNV:
+		return subDovkCmdDrawMeshTasksIndirectCountNV
+	case CommandType_cmd_vkCmdSetFragmentShadingRateKHR:
+		return subDovkCmdSetFragmentShadingRateKHR
+	case CommandType_cmd_vkCmdSetEvent2KHR:
+		return subDovkCmdSetEvent2KHR
+	case CommandType_cmd_vkCmdResetEvent2KHR:
+		return subDovkCmdResetEvent2KHR
+	case CommandType_cmd_vkCmdWaitEvents2KHR:
+		return subDovkCmdWaitEvents2KHR
+	case CommandType_cmd_vkCmdPipelineBarrier2KHR:
+		return subDovkCmdPipelineBarrier2KHR
+	case CommandType_cmd_vkCmdBeginDebugUtilsLabelEXT:
+		return subDovkCmdBeginDebugUtilsLabelEXT
+	case CommandType_cmd_vkCmdEndDebugUtilsLabelEXT:
+		return subDovkCmdEndDebugUtilsLabelEXT
+	case CommandType_cmd_vkCmdInsertDebugUtilsLabelEXT:
+		return subDovkCmdInsertDebugUtilsLabelEXT
+	case CommandType_cmd_vkCmdDrawIndirectCountKHR:
+		return subDovkCmdDrawIndirectCountKHR
+	case CommandType_cmd_vkCmdDrawIndexedIndirectCountKHR:
+		return subDovkCmdDrawIndexedIndirectCountKHR
 	default:
 		x := fmt.Sprintf("Should not reach here: %T", cr)
 		panic(x)
@@ -1461,6 +2182,48 @@ func AddCommand(ctx context.Context,
 		return rebuildVkCmdDebugMarkerEndEXT(ctx, cb, commandBuffer, r, s, t)
 	case VkCmdDebugMarkerInsertEXTArgsʳ:
 		return rebuildVkCmdDebugMarkerInsertEXT(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdBeginVideoCodingKHRArgsʳ:
+		return rebuildVkCmdBeginVideoCodingKHR(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdEndVideoCodingKHRArgsʳ:
+		return rebuildVkCmdEndVideoCodingKHR(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdControlVideoCodingKHRArgsʳ:
+		return rebuildVkCmdControlVideoCodingKHR(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdDecodeVideoKHRArgsʳ:
+		return rebuildVkCmdDecodeVideoKHR(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdEncodeVideoKHRArgsʳ:
+		return rebuildVkCmdEncodeVideoKHR(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdDrawMeshTasksEXTArgsʳ:
+		return rebuildVkCmdDrawMeshTasksEXT(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdDrawMeshTasksIndirectEXTArgsʳ:
+		return rebuildVkCmdDrawMeshTasksIndirectEXT(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdDrawMeshTasksIndirectCountEXTArgsʳ:
+		return rebuildVkCmdDrawMeshTasksIndirectCountEXT(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdDrawMeshTasksNVArgsʳ:
+		return rebuildVkCmdDrawMeshTasksNV(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdDrawMeshTasksIndirectNVArgsʳ:
+		return rebuildVkCmdDrawMeshTasksIndirectNV(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdDrawMeshTasksIndirectCountNVArgsʳ:
+		return rebuildVkCmdDrawMeshTasksIndirectCountNV(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdSetFragmentShadingRateKHRArgsʳ:
+		return rebuildVkCmdSetFragmentShadingRateKHR(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdSetEvent2KHRArgsʳ:
+		return rebuildVkCmdSetEvent2KHR(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdResetEvent2KHRArgsʳ:
+		return rebuildVkCmdResetEvent2KHR(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdWaitEvents2KHRArgsʳ:
+		return rebuildVkCmdWaitEvents2KHR(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdPipelineBarrier2KHRArgsʳ:
+		return rebuildVkCmdPipelineBarrier2KHR(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdBeginDebugUtilsLabelEXTArgsʳ:
+		return rebuildVkCmdBeginDebugUtilsLabelEXT(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdEndDebugUtilsLabelEXTArgsʳ:
+		return rebuildVkCmdEndDebugUtilsLabelEXT(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdInsertDebugUtilsLabelEXTArgsʳ:
+		return rebuildVkCmdInsertDebugUtilsLabelEXT(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdDrawIndirectCountKHRArgsʳ:
+		return rebuildVkCmdDrawIndirectCountKHR(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdDrawIndexedIndirectCountKHRArgsʳ:
+		return rebuildVkCmdDrawIndexedIndirectCountKHR(ctx, cb, commandBuffer, r, s, t)
 	default:
 		x := fmt.Sprintf("Should not reach here: %T", t)
 		panic(x)
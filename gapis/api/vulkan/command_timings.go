@@ -0,0 +1,90 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	gapir "github.com/google/gapid/gapir/client"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/builder"
+)
+
+var (
+	_ = transform.Transformer(&commandTimings{})
+)
+
+// commandTimingsRequest is a request of the CPU time spent by the replay
+// device on each command of the capture.
+type commandTimingsRequest struct {
+}
+
+// commandTimingsConfig is a replay.Config used by commandTimingsRequests.
+type commandTimingsConfig struct {
+}
+
+// commandTimings is a transform that makes the replay device measure the CPU
+// time spent on each command, and reports the timings of the commands of the
+// capture to the results.
+type commandTimings struct {
+	numInitialCmds int
+	numCmds        int
+	results        []replay.Result
+}
+
+func newCommandTimings(numInitialCmds, numCmds int) *commandTimings {
+	return &commandTimings{
+		numInitialCmds: numInitialCmds,
+		numCmds:        numCmds,
+	}
+}
+
+func (t *commandTimings) reportTo(r replay.Result) { t.results = append(t.results, r) }
+
+func (t *commandTimings) Transform(ctx context.Context, id api.CmdID, cmd api.Cmd, out transform.Writer) {
+	out.MutateAndWrite(ctx, id, cmd)
+}
+
+func (t *commandTimings) Flush(ctx context.Context, out transform.Writer) {
+	cb := CommandBuilder{Thread: 0, Arena: out.State().Arena}
+	out.MutateAndWrite(ctx, api.CmdNoID, cb.Custom(func(ctx context.Context, s *api.GlobalState, b *builder.Builder) error {
+		b.RegisterCommandTimingsReader(func(timings gapir.CommandTimings) {
+			res := []replay.CommandTiming{}
+			for _, timing := range timings.GetTimings() {
+				// The labels are the IDs of the commands, offset by the
+				// state rebuilding commands. The time spent on the state
+				// rebuilding commands, and on the commands injected by the
+				// transforms, is not reported.
+				label := timing.GetLabel()
+				if label < uint64(t.numInitialCmds) || label >= uint64(t.numInitialCmds+t.numCmds) {
+					continue
+				}
+				res = append(res, replay.CommandTiming{
+					Command: api.CmdID(label - uint64(t.numInitialCmds)),
+					Time:    time.Duration(timing.GetCpuTimeNs()),
+				})
+			}
+			sort.Slice(res, func(i, j int) bool { return res[i].Command < res[j].Command })
+			for _, r := range t.results {
+				r(res, nil)
+			}
+		})
+		return nil
+	}))
+}
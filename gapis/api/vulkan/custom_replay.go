@@ -237,6 +237,13 @@ func (i VkDebugReportCallbackEXT) remap(api.Cmd, *api.GlobalState) (key interfac
 	return
 }
 
+func (i VkDebugUtilsMessengerEXT) remap(api.Cmd, *api.GlobalState) (key interface{}, remap bool) {
+	if i != 0 {
+		key, remap = i, true
+	}
+	return
+}
+
 func (a *VkCreateInstance) Mutate(ctx context.Context, id api.CmdID, s *api.GlobalState, b *builder.Builder, w api.StateWatcher) error {
 	cb := CommandBuilder{Thread: a.Thread(), Arena: s.Arena}
 	// Hijack VkCreateInstance's Mutate() method entirely with our ReplayCreateVkInstance's Mutate().
@@ -246,9 +253,43 @@ func (a *VkCreateInstance) Mutate(ctx context.Context, id api.CmdID, s *api.Glob
 	// ReplayCreateVkInstance's Mutate() will invoke our custom wrapper function replayCreateVkInstance()
 	// in vulkan_gfx_api_extras.cpp, which modifies VkInstanceCreateInfo to enable virtual swapchain
 	// layer before delegating the real work back to the normal flow.
+	// And we need to strip off the VK_EXT_debug_utils extension name when
+	// building instructions for replay, as its commands are not replayed.
+	createInfoPtr := a.PCreateInfo()
+	allocated := []*api.AllocResult{}
+	if b != nil {
+		a.Extras().Observations().ApplyReads(s.Memory.ApplicationPool())
+		createInfo := a.PCreateInfo().MustRead(ctx, a, s, nil)
+		defer func() {
+			for _, d := range allocated {
+				d.Free()
+			}
+		}()
+		extensionCount := uint64(createInfo.EnabledExtensionCount())
+		newExtensionNames := []memory.Pointer{}
+		for _, e := range createInfo.PpEnabledExtensionNames().Slice(0, extensionCount, s.MemoryLayout).MustRead(ctx, a, s, nil) {
+			extensionName := string(memory.CharToBytes(e.StringSlice(ctx, s).MustRead(ctx, a, s, nil)))
+			if !strings.Contains(extensionName, "VK_EXT_debug_utils") {
+				nameSliceData := s.AllocDataOrPanic(ctx, extensionName)
+				allocated = append(allocated, &nameSliceData)
+				newExtensionNames = append(newExtensionNames, nameSliceData.Ptr())
+			}
+		}
+		newExtensionNamesData := s.AllocDataOrPanic(ctx, newExtensionNames)
+		allocated = append(allocated, &newExtensionNamesData)
+		createInfo.SetEnabledExtensionCount(uint32(len(newExtensionNames)))
+		createInfo.SetPpEnabledExtensionNames(NewCharᶜᵖᶜᵖ(newExtensionNamesData.Ptr()))
 
-	hijack := cb.ReplayCreateVkInstance(a.PCreateInfo(), a.PAllocator(), a.PInstance(), a.Result())
+		newCreateInfoData := s.AllocDataOrPanic(ctx, createInfo)
+		allocated = append(allocated, &newCreateInfoData)
+		createInfoPtr = NewVkInstanceCreateInfoᶜᵖ(newCreateInfoData.Ptr())
+	}
+
+	hijack := cb.ReplayCreateVkInstance(createInfoPtr, a.PAllocator(), a.PInstance(), a.Result())
 	hijack.Extras().MustClone(a.Extras().All()...)
+	for _, d := range allocated {
+		hijack.AddRead(d.Data())
+	}
 	err := hijack.Mutate(ctx, id, s, b, w)
 
 	if b == nil || err != nil {
@@ -422,6 +463,25 @@ func (a *VkAcquireNextImageKHR) Mutate(ctx context.Context, id api.CmdID, s *api
 	return err
 }
 
+func (a *VkAcquireNextImage2KHR) Mutate(ctx context.Context, id api.CmdID, s *api.GlobalState, b *builder.Builder, w api.StateWatcher) error {
+	// Same as vkAcquireNextImageKHR, the mutation must be done before building
+	// the replay instructions to pass the captured image index to the replay
+	// device. The command is replayed as vkAcquireNextImageKHR, as the virtual
+	// swapchain only intercepts that one. The device mask is dropped, same as
+	// the other device group info.
+	err := a.mutate(ctx, id, s, nil, w)
+	if b != nil {
+		l := s.MemoryLayout
+		info := a.PAcquireInfo().MustRead(ctx, a, s, nil)
+		cb := CommandBuilder{Thread: a.Thread(), Arena: s.Arena}
+		hijack := cb.VkAcquireNextImageKHR(a.Device(), info.Swapchain(), info.Timeout(),
+			info.Semaphore(), info.Fence(), a.PImageIndex(), a.Result())
+		hijack.PImageIndex().Slice(0, 1, l).OnRead(ctx, hijack, s, b)
+		hijack.Call(ctx, s, b)
+	}
+	return err
+}
+
 type structWithPNext interface {
 	PNext() Voidᶜᵖ
 	SetPNext(v Voidᶜᵖ)
@@ -0,0 +1,703 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/core/data/binary"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/replay/value"
+	"github.com/google/gapid/gapis/service"
+)
+
+var (
+	_ = transform.Transformer(&dispatchBuffers{})
+)
+
+// dispatchBufferRange is a range of a buffer bound as a storage buffer
+// descriptor at a dispatch.
+type dispatchBufferRange struct {
+	set, binding, element uint32
+	buffer                VkBuffer
+	offset, size          uint64
+}
+
+// dispatchBuffersRequest requests a postback of the given ranges of the
+// storage buffers right before and right after the dispatch.
+type dispatchBuffersRequest struct {
+	dispatch []uint64
+	ranges   []dispatchBufferRange
+}
+
+// dispatchBuffersRead is a requested read of the storage buffers of a
+// dispatch.
+type dispatchBuffersRead struct {
+	dispatch api.SubCmdIdx
+	ranges   []dispatchBufferRange
+	res      replay.Result
+	// The sizes of the ranges, once resolved against the sizes of the
+	// buffers.
+	sizes []uint64
+	// The contents of the ranges, or the error of the read.
+	before, after [][]byte
+	err           error
+}
+
+// dispatchBuffers is a transform copying the storage buffers of the requested
+// dispatches to a staging buffer right before and right after the dispatches,
+// and reading back the staging buffer after the submissions of the
+// dispatches. Only the dispatches recorded in primary command buffers are
+// supported.
+type dispatchBuffers struct {
+	// The requested reads, by indices of the dispatches in the replay.
+	reads *api.SubCmdIdxTrie
+	// The submissions of the requested dispatches.
+	submits map[api.CmdID]struct{}
+	all     []*dispatchBuffersRead
+}
+
+func newDispatchBuffers() *dispatchBuffers {
+	return &dispatchBuffers{
+		reads:   &api.SubCmdIdxTrie{},
+		submits: map[api.CmdID]struct{}{},
+	}
+}
+
+// add requests the storage buffers of the dispatch. It returns false if the
+// request is rejected, in which case the error is passed to res.
+func (t *dispatchBuffers) add(ctx context.Context, extraCommands uint64, req dispatchBuffersRequest, res replay.Result) bool {
+	if len(req.dispatch) != 4 {
+		res(nil, &service.ErrInvalidArgument{
+			Reason: messages.ErrMessage(fmt.Sprintf(
+				"Storage buffers of %v are not supported, only the dispatches of primary command buffers are", req.dispatch)),
+		})
+		return false
+	}
+	idx := append(api.SubCmdIdx{req.dispatch[0] + extraCommands}, req.dispatch[1:]...)
+	r := &dispatchBuffersRead{dispatch: req.dispatch, ranges: req.ranges, res: res}
+	t.reads.SetValue(idx, r)
+	t.submits[api.CmdID(idx[0])] = struct{}{}
+	t.all = append(t.all, r)
+	return true
+}
+
+// fail records the error as the result of the reads.
+func (t *dispatchBuffers) fail(reads []*dispatchBuffersRead, err error) {
+	for _, r := range reads {
+		r.err = err
+	}
+}
+
+// dispatchBuffersCopy is a copy of a range of a storage buffer to the staging
+// buffer.
+type dispatchBuffersCopy struct {
+	buffer               VkBuffer
+	offset, size, staged uint64
+}
+
+func (t *dispatchBuffers) Transform(ctx context.Context, id api.CmdID, cmd api.Cmd, out transform.Writer) {
+	submit, ok := cmd.(*VkQueueSubmit)
+	if _, marked := t.submits[id]; !ok || !marked {
+		out.MutateAndWrite(ctx, id, cmd)
+		return
+	}
+
+	gs := out.State()
+	st := GetState(gs)
+	cb := CommandBuilder{Thread: cmd.Thread(), Arena: gs.Arena}
+
+	var allocated []*api.AllocResult
+	defer func() {
+		for _, d := range allocated {
+			d.Free()
+		}
+	}()
+	mustAllocData := func(v ...interface{}) api.AllocResult {
+		res := gs.AllocDataOrPanic(ctx, v...)
+		allocated = append(allocated, &res)
+		return res
+	}
+
+	l := gs.MemoryLayout
+	submit.Extras().Observations().ApplyReads(gs.Memory.ApplicationPool())
+	submitCount := submit.SubmitCount()
+	submitInfos := submit.PSubmits().Slice(0, uint64(submitCount), l).MustRead(ctx, submit, gs, nil)
+
+	// The reads of the submission, in the order of their staging ranges.
+	reads := []*dispatchBuffersRead{}
+	// The copies before and after each dispatch, by indices of the
+	// dispatches in the command buffers.
+	type rewrite struct {
+		submitInfo, cmdBuffer uint32
+		before, after         map[uint32][]dispatchBuffersCopy
+	}
+	rewrites := []rewrite{}
+	stagingSize := uint64(0)
+	for i := uint32(0); i < submitCount; i++ {
+		si := submitInfos[i]
+		cmdBuffers := si.PCommandBuffers().Slice(0, uint64(si.CommandBufferCount()), l).MustRead(ctx, submit, gs, nil)
+		for j, buf := range cmdBuffers {
+			bInfo, ok := st.CommandBuffers().Lookup(buf)
+			if !ok {
+				continue
+			}
+			rw := rewrite{i, uint32(j), map[uint32][]dispatchBuffersCopy{}, map[uint32][]dispatchBuffersCopy{}}
+			for k := 0; k < bInfo.CommandReferences().Len(); k++ {
+				r, ok := t.reads.Value(api.SubCmdIdx{uint64(id), uint64(i), uint64(j), uint64(k)}).(*dispatchBuffersRead)
+				if !ok {
+					continue
+				}
+				switch bInfo.CommandReferences().Get(uint32(k)).Type() {
+				case CommandType_cmd_vkCmdDispatch, CommandType_cmd_vkCmdDispatchIndirect:
+				default:
+					t.fail([]*dispatchBuffersRead{r}, &service.ErrInvalidArgument{
+						Reason: messages.ErrMessage(fmt.Sprintf("Command %v is not a dispatch", r.dispatch)),
+					})
+					continue
+				}
+				before, after, err := t.stage(st, r, &stagingSize)
+				if err != nil {
+					t.fail([]*dispatchBuffersRead{r}, err)
+					continue
+				}
+				if len(before) > 0 {
+					rw.before[uint32(k)], rw.after[uint32(k)] = before, after
+				}
+				reads = append(reads, r)
+			}
+			if len(rw.before) > 0 {
+				rewrites = append(rewrites, rw)
+			}
+		}
+	}
+	if len(reads) == 0 {
+		out.MutateAndWrite(ctx, id, cmd)
+		return
+	}
+	if stagingSize == 0 {
+		// All the storage buffer ranges are empty, there is nothing to copy.
+		t.split(reads, nil)
+		out.MutateAndWrite(ctx, id, cmd)
+		return
+	}
+
+	queue := st.Queues().Get(submit.Queue())
+	device := queue.Device()
+	stagingBuffer, stagingMemory := t.createStagingBuffer(ctx, cb, out, device, stagingSize, mustAllocData)
+
+	readsData := []api.AllocResult{}
+	allocAndRead := func(v ...interface{}) api.AllocResult {
+		res := mustAllocData(v)
+		readsData = append(readsData, res)
+		return res
+	}
+	newSubmitInfos := make([]VkSubmitInfo, submitCount)
+	for i := uint32(0); i < submitCount; i++ {
+		si := submitInfos[i]
+
+		waitSemPtr := memory.Nullptr
+		waitDstStagePtr := memory.Nullptr
+		if count := uint64(si.WaitSemaphoreCount()); count > 0 {
+			waitSemPtr = allocAndRead(si.PWaitSemaphores().
+				Slice(0, count, l).
+				MustRead(ctx, submit, gs, nil)).Ptr()
+			waitDstStagePtr = allocAndRead(si.PWaitDstStageMask().
+				Slice(0, count, l).
+				MustRead(ctx, submit, gs, nil)).Ptr()
+		}
+
+		signalSemPtr := memory.Nullptr
+		if count := uint64(si.SignalSemaphoreCount()); count > 0 {
+			signalSemPtr = allocAndRead(si.PSignalSemaphores().
+				Slice(0, count, l).
+				MustRead(ctx, submit, gs, nil)).Ptr()
+		}
+
+		cmdBufferPtr := memory.Nullptr
+		if count := uint64(si.CommandBufferCount()); count > 0 {
+			cmdBuffers := si.PCommandBuffers().
+				Slice(0, count, l).
+				MustRead(ctx, submit, gs, nil)
+			for _, r := range rewrites {
+				if r.submitInfo != i {
+					continue
+				}
+				newCmdBuffer, err := t.rewriteCommandBuffer(ctx, cb, gs, st,
+					cmdBuffers[r.cmdBuffer], stagingBuffer, r.before, r.after, mustAllocData, out)
+				if err != nil {
+					t.fail(reads, log.Err(ctx, err, "Couldn't inject the storage buffer copies"))
+					out.MutateAndWrite(ctx, id, cmd)
+					return
+				}
+				cmdBuffers[r.cmdBuffer] = newCmdBuffer
+			}
+			cmdBufferPtr = allocAndRead(cmdBuffers).Ptr()
+		}
+
+		newSubmitInfos[i] = NewVkSubmitInfo(gs.Arena,
+			VkStructureType_VK_STRUCTURE_TYPE_SUBMIT_INFO,
+			0,                            // pNext
+			si.WaitSemaphoreCount(),      // waitSemaphoreCount
+			NewVkSemaphoreᶜᵖ(waitSemPtr), // pWaitSemaphores
+			NewVkPipelineStageFlagsᶜᵖ(waitDstStagePtr), // pWaitDstStageMask
+			si.CommandBufferCount(),                    // commandBufferCount
+			NewVkCommandBufferᶜᵖ(cmdBufferPtr),         // pCommandBuffers
+			si.SignalSemaphoreCount(),                  // signalSemaphoreCount
+			NewVkSemaphoreᶜᵖ(signalSemPtr),             // pSignalSemaphores
+		)
+	}
+	submitInfoPtr := allocAndRead(newSubmitInfos).Ptr()
+
+	newCmd := cb.VkQueueSubmit(
+		submit.Queue(),
+		submit.SubmitCount(),
+		submitInfoPtr,
+		submit.Fence(),
+		VkResult_VK_SUCCESS,
+	)
+	for _, read := range readsData {
+		newCmd.AddRead(read.Data())
+	}
+	out.MutateAndWrite(ctx, id, newCmd)
+
+	t.readStagingBuffer(ctx, cb, out, submit.Queue(), device, stagingBuffer, stagingMemory, stagingSize, reads, mustAllocData)
+}
+
+// stage returns the copies of the ranges of the read before and after the
+// dispatch, placed in the staging buffer from *stagingSize, which is updated
+// to the end of the copies.
+func (t *dispatchBuffers) stage(st *State, r *dispatchBuffersRead, stagingSize *uint64) (before, after []dispatchBuffersCopy, err error) {
+	sizes := make([]uint64, len(r.ranges))
+	for i, rng := range r.ranges {
+		buffer, ok := st.Buffers().Lookup(rng.buffer)
+		if !ok {
+			return nil, nil, &service.ErrDataUnavailable{
+				Reason: messages.ErrMessage(fmt.Sprintf("Buffer %v does not exist at the dispatch", rng.buffer)),
+			}
+		}
+		bufferSize := uint64(buffer.Info().Size())
+		size := rng.size
+		if size == vkWholeSize && rng.offset <= bufferSize {
+			size = bufferSize - rng.offset
+		}
+		if rng.offset > bufferSize || size > bufferSize-rng.offset {
+			return nil, nil, &service.ErrDataUnavailable{
+				Reason: messages.ErrMessage(fmt.Sprintf("The storage buffer range of binding %v of set %v is out of the buffer",
+					rng.binding, rng.set)),
+			}
+		}
+		sizes[i] = size
+		if size == 0 {
+			continue
+		}
+		before = append(before, dispatchBuffersCopy{rng.buffer, rng.offset, size, *stagingSize})
+		after = append(after, dispatchBuffersCopy{rng.buffer, rng.offset, size, *stagingSize + size})
+		*stagingSize += 2 * size
+	}
+	r.sizes = sizes
+	return before, after, nil
+}
+
+// createStagingBuffer creates a host visible buffer of the given size, used
+// as the destination of the copies of the storage buffers.
+func (t *dispatchBuffers) createStagingBuffer(ctx context.Context,
+	cb CommandBuilder,
+	out transform.Writer,
+	device VkDevice,
+	size uint64,
+	alloc func(v ...interface{}) api.AllocResult) (VkBuffer, VkDeviceMemory) {
+	s := out.State()
+	st := GetState(s)
+	physicalDevice := st.PhysicalDevices().Get(st.Devices().Get(device).PhysicalDevice())
+
+	memoryTypeIndex := uint32(0)
+	for i := uint32(0); i < physicalDevice.MemoryProperties().MemoryTypeCount(); i++ {
+		t := physicalDevice.MemoryProperties().MemoryTypes().Get(int(i))
+		if 0 != (t.PropertyFlags() & VkMemoryPropertyFlags(
+			VkMemoryPropertyFlagBits_VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT|
+				VkMemoryPropertyFlagBits_VK_MEMORY_PROPERTY_HOST_COHERENT_BIT)) {
+			memoryTypeIndex = i
+			break
+		}
+	}
+
+	buffer := VkBuffer(newUnusedID(false, func(x uint64) bool { return st.Buffers().Contains(VkBuffer(x)) }))
+	deviceMemory := VkDeviceMemory(newUnusedID(false, func(x uint64) bool { return st.DeviceMemories().Contains(VkDeviceMemory(x)) }))
+	bufferData := alloc(buffer)
+	bufferCreateInfo := alloc(NewVkBufferCreateInfo(s.Arena,
+		VkStructureType_VK_STRUCTURE_TYPE_BUFFER_CREATE_INFO, // sType
+		NewVoidᶜᵖ(memory.Nullptr),                            // pNext
+		VkBufferCreateFlags(0),                               // flags
+		VkDeviceSize(size),                                   // size
+		VkBufferUsageFlags(VkBufferUsageFlagBits_VK_BUFFER_USAGE_TRANSFER_DST_BIT), // usage
+		VkSharingMode_VK_SHARING_MODE_EXCLUSIVE,                                    // sharingMode
+		0,                                                                          // queueFamilyIndexCount
+		NewU32ᶜᵖ(memory.Nullptr),                                                   // pQueueFamilyIndices
+	))
+	// Like postBufferData, allocate twice the size of the buffer rather than
+	// querying its memory requirements.
+	memoryData := alloc(deviceMemory)
+	memoryAllocInfo := alloc(NewVkMemoryAllocateInfo(s.Arena,
+		VkStructureType_VK_STRUCTURE_TYPE_MEMORY_ALLOCATE_INFO, // sType
+		0,                    // pNext
+		VkDeviceSize(size*2), // allocationSize
+		memoryTypeIndex,      // memoryTypeIndex
+	))
+
+	writeEach(ctx, out,
+		cb.VkCreateBuffer(
+			device,
+			bufferCreateInfo.Ptr(),
+			memory.Nullptr,
+			bufferData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(bufferCreateInfo.Data()).AddWrite(bufferData.Data()),
+		cb.VkAllocateMemory(
+			device,
+			memoryAllocInfo.Ptr(),
+			memory.Nullptr,
+			memoryData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(memoryAllocInfo.Data()).AddWrite(memoryData.Data()),
+		cb.VkBindBufferMemory(device, buffer, deviceMemory, VkDeviceSize(0), VkResult_VK_SUCCESS),
+	)
+	return buffer, deviceMemory
+}
+
+// rewriteCommandBuffer records a copy of the command buffer, with the copies
+// to the staging buffer recorded before and after the commands at the indices
+// of the before and after maps.
+func (t *dispatchBuffers) rewriteCommandBuffer(ctx context.Context,
+	cb CommandBuilder,
+	gs *api.GlobalState,
+	st *State,
+	cmdBuffer VkCommandBuffer,
+	stagingBuffer VkBuffer,
+	before, after map[uint32][]dispatchBuffersCopy,
+	alloc func(v ...interface{}) api.AllocResult,
+	out transform.Writer,
+) (VkCommandBuffer, error) {
+	bInfo := st.CommandBuffers().Get(cmdBuffer)
+
+	newCmdBuffer, cmds, cleanup := allocateNewCmdBufFromExistingOneAndBegin(
+		ctx, cb, cmdBuffer, gs)
+	writeEach(ctx, out, cmds...)
+	for _, f := range cleanup {
+		f()
+	}
+
+	for i := 0; i < bInfo.CommandReferences().Len(); i++ {
+		if copies, ok := before[uint32(i)]; ok {
+			t.recordCopies(ctx, cb, gs, newCmdBuffer, stagingBuffer, copies, alloc, out)
+		}
+		cr := bInfo.CommandReferences().Get(uint32(i))
+		cleanup, cmd, err := AddCommand(ctx, cb, newCmdBuffer, gs, gs, GetCommandArgs(ctx, cr, st))
+		if err != nil {
+			return 0, err
+		}
+		writeEach(ctx, out, cmd)
+		cleanup()
+		if copies, ok := after[uint32(i)]; ok {
+			t.recordCopies(ctx, cb, gs, newCmdBuffer, stagingBuffer, copies, alloc, out)
+		}
+	}
+	writeEach(ctx, out, cb.VkEndCommandBuffer(newCmdBuffer, VkResult_VK_SUCCESS))
+	return newCmdBuffer, nil
+}
+
+// recordCopies records the copies of the storage buffer ranges to the staging
+// buffer. The copies wait for the writes of the previous commands, and the
+// next commands wait for the copies, so that they do not overwrite the ranges
+// before they are copied.
+func (t *dispatchBuffers) recordCopies(ctx context.Context,
+	cb CommandBuilder,
+	gs *api.GlobalState,
+	cmdBuffer VkCommandBuffer,
+	stagingBuffer VkBuffer,
+	copies []dispatchBuffersCopy,
+	alloc func(v ...interface{}) api.AllocResult,
+	out transform.Writer) {
+
+	barriers := make([]VkBufferMemoryBarrier, len(copies))
+	for i, c := range copies {
+		barriers[i] = NewVkBufferMemoryBarrier(gs.Arena,
+			VkStructureType_VK_STRUCTURE_TYPE_BUFFER_MEMORY_BARRIER, // sType
+			0, // pNext
+			VkAccessFlags((VkAccessFlagBits_VK_ACCESS_MEMORY_WRITE_BIT-1)|VkAccessFlagBits_VK_ACCESS_MEMORY_WRITE_BIT), // srcAccessMask
+			VkAccessFlags(VkAccessFlagBits_VK_ACCESS_TRANSFER_READ_BIT),                                                // dstAccessMask
+			queueFamilyIgnore,      // srcQueueFamilyIndex
+			queueFamilyIgnore,      // dstQueueFamilyIndex
+			c.buffer,               // buffer
+			VkDeviceSize(c.offset), // offset
+			VkDeviceSize(c.size),   // size
+		)
+	}
+	barriersData := alloc(barriers)
+	writeEach(ctx, out, cb.VkCmdPipelineBarrier(
+		cmdBuffer,
+		VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_ALL_COMMANDS_BIT),
+		VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TRANSFER_BIT),
+		VkDependencyFlags(0),
+		0,
+		memory.Nullptr,
+		uint32(len(barriers)),
+		barriersData.Ptr(),
+		0,
+		memory.Nullptr,
+	).AddRead(barriersData.Data()))
+
+	for _, c := range copies {
+		if c.size == 0 {
+			continue
+		}
+		region := alloc(NewVkBufferCopy(gs.Arena,
+			VkDeviceSize(c.offset), // srcOffset
+			VkDeviceSize(c.staged), // dstOffset
+			VkDeviceSize(c.size),   // size
+		))
+		writeEach(ctx, out, cb.VkCmdCopyBuffer(
+			cmdBuffer,
+			c.buffer,
+			stagingBuffer,
+			1,
+			region.Ptr(),
+		).AddRead(region.Data()))
+	}
+
+	writeEach(ctx, out, cb.VkCmdPipelineBarrier(
+		cmdBuffer,
+		VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TRANSFER_BIT),
+		VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_ALL_COMMANDS_BIT),
+		VkDependencyFlags(0),
+		0,
+		memory.Nullptr,
+		0,
+		memory.Nullptr,
+		0,
+		memory.Nullptr,
+	))
+}
+
+// readStagingBuffer waits for the queue to be idle, then reads back the
+// staging buffer, splits it into the contents of the storage buffers of the
+// reads, and destroys the staging buffer.
+func (t *dispatchBuffers) readStagingBuffer(ctx context.Context,
+	cb CommandBuilder,
+	out transform.Writer,
+	queue VkQueue,
+	device VkDevice,
+	stagingBuffer VkBuffer,
+	stagingMemory VkDeviceMemory,
+	size uint64,
+	reads []*dispatchBuffersRead,
+	alloc func(v ...interface{}) api.AllocResult) {
+	s := out.State()
+
+	at, err := s.Alloc(ctx, size)
+	if err != nil {
+		t.fail(reads, &service.ErrDataUnavailable{Reason: messages.ErrMessage("Device Memory -> Host mapping failed")})
+		return
+	}
+	defer at.Free()
+	mappedPointer := alloc(at.Address())
+	mappedMemoryRange := alloc(NewVkMappedMemoryRange(s.Arena,
+		VkStructureType_VK_STRUCTURE_TYPE_MAPPED_MEMORY_RANGE, // sType
+		0,                         // pNext
+		stagingMemory,             // memory
+		VkDeviceSize(0),           // offset
+		VkDeviceSize(vkWholeSize), // size
+	))
+
+	writeEach(ctx, out,
+		cb.VkQueueWaitIdle(queue, VkResult_VK_SUCCESS),
+		cb.VkMapMemory(
+			device,
+			stagingMemory,
+			VkDeviceSize(0),
+			VkDeviceSize(size),
+			VkMemoryMapFlags(0),
+			mappedPointer.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddWrite(mappedPointer.Data()),
+		cb.VkInvalidateMappedMemoryRanges(
+			device,
+			1,
+			mappedMemoryRange.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(mappedMemoryRange.Data()),
+		cb.Custom(func(ctx context.Context, s *api.GlobalState, b *builder.Builder) error {
+			b.Post(value.ObservedPointer(at.Address()), size, func(r binary.Reader, err error) {
+				data := make([]byte, size)
+				if err == nil {
+					r.Data(data)
+					err = r.Error()
+				}
+				if err != nil {
+					t.fail(reads, log.Err(ctx, err, "Couldn't read the storage buffers"))
+					return
+				}
+				t.split(reads, data)
+			})
+			return nil
+		}),
+		cb.VkUnmapMemory(device, stagingMemory),
+		cb.VkDestroyBuffer(device, stagingBuffer, memory.Nullptr),
+		cb.VkFreeMemory(device, stagingMemory, memory.Nullptr),
+	)
+}
+
+// split sets the contents of the ranges of the reads from the data of the
+// staging buffer. The ranges are staged in the order of the reads, with the
+// content before the dispatch followed by the content after.
+func (t *dispatchBuffers) split(reads []*dispatchBuffersRead, data []byte) {
+	offset := uint64(0)
+	for _, rd := range reads {
+		rd.before = make([][]byte, len(rd.ranges))
+		rd.after = make([][]byte, len(rd.ranges))
+		for i, n := range rd.sizes {
+			rd.before[i] = data[offset : offset+n]
+			rd.after[i] = data[offset+n : offset+2*n]
+			offset += 2 * n
+		}
+	}
+}
+
+func (t *dispatchBuffers) Flush(ctx context.Context, out transform.Writer) {
+	s := out.State()
+	cb := CommandBuilder{Thread: 0, Arena: s.Arena}
+	out.MutateAndWrite(ctx, api.CmdNoID, cb.Custom(func(ctx context.Context, s *api.GlobalState, b *builder.Builder) error {
+		code := uint32(0xbeefcace)
+		b.Push(value.U32(code))
+		b.Post(b.Buffer(1), 4, func(r binary.Reader, err error) {
+			if err == nil && r.Uint32() != code {
+				err = fmt.Errorf("Unexpected EOS code")
+			}
+			for _, rd := range t.all {
+				rd := rd
+				rd.res.Do(func() (interface{}, error) {
+					if err != nil {
+						return nil, log.Err(ctx, err, "Flush did not get expected EOS code")
+					}
+					return rd.collect()
+				})
+			}
+		})
+		return nil
+	}))
+}
+
+// collect returns the contents of the storage buffers of the read, or its
+// error.
+func (r *dispatchBuffersRead) collect() ([]*service.DispatchBuffer, error) {
+	switch {
+	case r.err != nil:
+		return nil, r.err
+	case r.before == nil:
+		return nil, &service.ErrDataUnavailable{
+			Reason: messages.ErrMessage(fmt.Sprintf("No storage buffers for %v, it was not replayed", r.dispatch)),
+		}
+	}
+	out := make([]*service.DispatchBuffer, len(r.ranges))
+	for i, rng := range r.ranges {
+		out[i] = &service.DispatchBuffer{
+			Set:     rng.set,
+			Binding: rng.binding,
+			Element: rng.element,
+			Buffer:  uint64(rng.buffer),
+			Offset:  rng.offset,
+			Size:    uint64(len(r.before[i])),
+			Before:  r.before[i],
+			After:   r.after[i],
+		}
+	}
+	return out, nil
+}
+
+// storageBufferRanges returns the ranges of the storage buffer descriptors of
+// the bound descriptor sets, in the order of the set numbers, binding numbers
+// and array elements.
+func storageBufferRanges(state *BoundPipelineState) []dispatchBufferRange {
+	out := []dispatchBufferRange{}
+	for set, bds := range state.DescriptorSets {
+		for binding, descriptors := range bds.Bindings {
+			for element, d := range descriptors {
+				if d == nil {
+					continue
+				}
+				switch d.Type {
+				case VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_BUFFER,
+					VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_BUFFER_DYNAMIC:
+					out = append(out, dispatchBufferRange{set, binding, uint32(element), d.Buffer, d.Offset, d.Range})
+				}
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case a.set != b.set:
+			return a.set < b.set
+		case a.binding != b.binding:
+			return a.binding < b.binding
+		default:
+			return a.element < b.element
+		}
+	})
+	return out
+}
+
+// QueryDispatchBuffers returns the contents of the storage buffers bound to
+// the dispatch, right before and right after the dispatch, read back from the
+// replay.
+func (a API) QueryDispatchBuffers(
+	ctx context.Context,
+	intent replay.Intent,
+	mgr replay.Manager,
+	dispatch []uint64,
+	hints *service.UsageHints) ([]*service.DispatchBuffer, error) {
+
+	state, err := ResolveBoundPipelineState(ctx, intent.Capture.Command(dispatch[0], dispatch[1:]...))
+	if err != nil {
+		return nil, err
+	}
+	if state.Pipelines[VkPipelineBindPoint_VK_PIPELINE_BIND_POINT_COMPUTE] == VkPipeline(0) {
+		return nil, &service.ErrInvalidArgument{
+			Reason: messages.ErrMessage(fmt.Sprintf("No compute pipeline is bound at %v", dispatch)),
+		}
+	}
+	ranges := storageBufferRanges(state)
+	if len(ranges) == 0 {
+		return []*service.DispatchBuffer{}, nil
+	}
+
+	c, r := dispatchBuffersConfig{}, dispatchBuffersRequest{dispatch: dispatch, ranges: ranges}
+	res, err := mgr.Replay(ctx, intent, c, r, a, hints)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := mgr.(replay.Exporter); ok {
+		return nil, nil
+	}
+	return res.([]*service.DispatchBuffer), nil
+}
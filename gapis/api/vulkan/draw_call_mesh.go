@@ -15,14 +15,19 @@
 package vulkan
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 
+	"github.com/google/gapid/core/data/binary"
+	"github.com/google/gapid/core/data/endian"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/stream"
 	"github.com/google/gapid/core/stream/fmts"
 	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/replay"
 	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
 	"github.com/google/gapid/gapis/vertex"
 )
@@ -83,80 +88,131 @@ func drawCallMesh(ctx context.Context, dc *VkQueueSubmit, p *path.Mesh, r *path.
 
 	noData := p.GetOptions().GetExcludeData()
 
-	// In total there are four kinds of draw calls: vkCmdDraw, vkCmdDrawIndexed,
-	// vkCmdDrawIndirect, vkCmdDrawIndexedIndirect. Each is processed in one of
-	// the branches.
-	if p := lastDrawInfo.CommandParameters().Draw(); !p.IsNil() {
-		// Last draw call is vkCmdDraw
-		// Generate an index buffer with value: 0, 1, 2, 3 ... vertexCount-1
-		var indices []uint32
+	// The vertex indices of all the draws of the command, and the range of
+	// the vertices referenced by them.
+	var indices []uint32
+	minVertex, endVertex := uint32(0xFFFFFFFF), uint32(0)
+	addVertices := func(first, count uint32) {
+		if count == 0 {
+			return
+		}
+		if first < minVertex {
+			minVertex = first
+		}
+		if first+count > endVertex {
+			endVertex = first + count
+		}
+	}
+
+	// drawMesh adds the vertices and statistics of a non-indexed draw.
+	drawMesh := func(vertexCount, firstVertex uint32) {
+		// Generate the indices: firstVertex, firstVertex+1 ... firstVertex+vertexCount-1
 		if !noData {
-			indices := make([]uint32, p.VertexCount())
-			for i := range indices {
-				indices[i] = uint32(i)
+			for i := uint32(0); i < vertexCount; i++ {
+				indices = append(indices, firstVertex+i)
 			}
 		}
-		ib = &api.IndexBuffer{Indices: indices}
+		addVertices(firstVertex, vertexCount)
+		stats.Vertices += vertexCount
+		stats.Primitives += drawPrimitive.Count(vertexCount)
+	}
 
-		// Get the current bound vertex buffers
-		vb, err = getVertexBuffers(ctx, s, dc.Thread(), p.VertexCount(), p.FirstVertex(), noData)
-		if err != nil {
-			return nil, err
-		}
-		stats.Vertices = p.VertexCount()
-		stats.Primitives = drawPrimitive.Count(p.VertexCount())
-	} else if p := lastDrawInfo.CommandParameters().DrawIndexed(); !p.IsNil() {
-		// Last draw call is vkCmdDrawIndexed
+	// drawIndexedMesh adds the indices and statistics of an indexed draw.
+	uniqueIndices := make(map[uint32]bool)
+	drawIndexedMesh := func(indexCount, firstIndex uint32, vertexOffset int32) error {
 		// Get the current bound index buffer
 		if lastDrawInfo.BoundIndexBuffer().BoundBuffer().Buffer().IsNil() {
-			return nil, fmt.Errorf("Cannot find last used index buffer")
+			return fmt.Errorf("Cannot find last used index buffer")
 		}
 
-		var indices []uint32
 		if !noData {
-			indices, err = getIndicesData(ctx, s, dc.Thread(), lastDrawInfo.BoundIndexBuffer(), p.IndexCount(), p.FirstIndex(), p.VertexOffset())
+			drawIndices, err := getIndicesData(ctx, s, dc.Thread(), lastDrawInfo.BoundIndexBuffer(), indexCount, firstIndex, vertexOffset)
 			if err != nil {
-				return nil, err
+				return err
 			}
+			for _, i := range drawIndices {
+				addVertices(i, 1)
+				uniqueIndices[i] = true
+			}
+			indices = append(indices, drawIndices...)
 		}
+		stats.Vertices = uint32(len(uniqueIndices))
+		stats.Indices += indexCount
+		stats.Primitives += drawPrimitive.Count(indexCount)
+		return nil
+	}
 
-		// Calculate the vertex count and the first vertex
-		maxIndex := uint32(0)
-		minIndex := uint32(0xFFFFFFFF)
-		uniqueIndices := make(map[uint32]bool)
-		for _, i := range indices {
-			if maxIndex < i {
-				maxIndex = i
-			}
-			if i < minIndex {
-				minIndex = i
-			}
-			uniqueIndices[i] = true
+	// In total there are six kinds of draw calls: vkCmdDraw, vkCmdDrawIndexed,
+	// vkCmdDrawIndirect, vkCmdDrawIndexedIndirect, vkCmdDrawIndirectCountKHR
+	// and vkCmdDrawIndexedIndirectCountKHR. Each is processed in one of the
+	// branches. The parameters and the draw counts of the indirect draws are
+	// read back from the replay, as they may be written by the GPU. The mesh
+	// holds the geometry of all the draws of a multi-draw.
+	if p := lastDrawInfo.CommandParameters().Draw(); !p.IsNil() {
+		// Last draw call is vkCmdDraw
+		drawMesh(p.VertexCount(), p.FirstVertex())
+	} else if p := lastDrawInfo.CommandParameters().DrawIndexed(); !p.IsNil() {
+		// Last draw call is vkCmdDrawIndexed
+		if err := drawIndexedMesh(p.IndexCount(), p.FirstIndex(), p.VertexOffset()); err != nil {
+			return nil, err
 		}
-		vertexCount := maxIndex - minIndex + 1
-		// Get the current bound vertex buffers
-		vb, err = getVertexBuffers(ctx, s, dc.Thread(), vertexCount, minIndex, noData)
+	} else if p := lastDrawInfo.CommandParameters().DrawIndirect(); !p.IsNil() {
+		// Last draw call is vkCmdDrawIndirect
+		err := readIndirectDraws(ctx, s, cmdPath, r, p.Buffer(), p.Offset(),
+			p.DrawCount(), p.Stride(), drawIndirectCommandSize, drawIndirectMesh(drawMesh))
 		if err != nil {
 			return nil, err
 		}
+	} else if p := lastDrawInfo.CommandParameters().DrawIndexedIndirect(); !p.IsNil() {
+		// Last draw call is vkCmdDrawIndexedIndirect
+		err := readIndirectDraws(ctx, s, cmdPath, r, p.Buffer(), p.Offset(),
+			p.DrawCount(), p.Stride(), drawIndexedIndirectCommandSize, drawIndexedIndirectMesh(drawIndexedMesh))
+		if err != nil {
+			return nil, err
+		}
+	} else if p := lastDrawInfo.CommandParameters().DrawIndirectCount(); !p.IsNil() {
+		// Last draw call is vkCmdDrawIndirectCountKHR
+		count, err := readIndirectDrawCount(ctx, s, cmdPath, r, p.CountBuffer(), p.CountBufferOffset(), p.MaxDrawCount())
+		if err != nil {
+			return nil, err
+		}
+		err = readIndirectDraws(ctx, s, cmdPath, r, p.Buffer(), p.Offset(),
+			count, p.Stride(), drawIndirectCommandSize, drawIndirectMesh(drawMesh))
+		if err != nil {
+			return nil, err
+		}
+	} else if p := lastDrawInfo.CommandParameters().DrawIndexedIndirectCount(); !p.IsNil() {
+		// Last draw call is vkCmdDrawIndexedIndirectCountKHR
+		count, err := readIndirectDrawCount(ctx, s, cmdPath, r, p.CountBuffer(), p.CountBufferOffset(), p.MaxDrawCount())
+		if err != nil {
+			return nil, err
+		}
+		err = readIndirectDraws(ctx, s, cmdPath, r, p.Buffer(), p.Offset(),
+			count, p.Stride(), drawIndexedIndirectCommandSize, drawIndexedIndirectMesh(drawIndexedMesh))
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		// Shift indices, as we only extract the vertex data from minIndex to
-		// maxIndex, we need to minus the minimum index value make the new indices
-		// value valid for the extracted vertices value.
+	if endVertex < minVertex {
+		// No vertices are referenced.
+		minVertex, endVertex = 0, 0
+	}
+	// Get the current bound vertex buffers
+	vb, err = getVertexBuffers(ctx, s, dc.Thread(), endVertex-minVertex, minVertex, noData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Shift indices, as we only extract the vertex data from minVertex to
+	// endVertex, we need to minus the minimum index value make the new indices
+	// value valid for the extracted vertices value.
+	if !noData {
 		shiftedIndices := make([]uint32, len(indices))
 		for i, index := range indices {
-			shiftedIndices[i] = index - minIndex
-		}
-		ib = &api.IndexBuffer{
-			Indices: shiftedIndices,
+			shiftedIndices[i] = index - minVertex
 		}
-		stats.Vertices = uint32(len(uniqueIndices))
-		stats.Indices = p.IndexCount()
-		stats.Primitives = drawPrimitive.Count(p.IndexCount())
-	} else if p := lastDrawInfo.CommandParameters().DrawIndirect(); !p.IsNil() {
-		return nil, fmt.Errorf("Draw mesh for vkCmdDrawIndirect not implemented")
-	} else if p := lastDrawInfo.CommandParameters().DrawIndexedIndirect(); !p.IsNil() {
-		return nil, fmt.Errorf("Draw mesh for vkCmdDrawIndexedIndirect not implemented")
+		ib = &api.IndexBuffer{Indices: shiftedIndices}
 	}
 
 	guessSemantics(vb, p.Options.Hints())
@@ -174,8 +230,124 @@ func drawCallMesh(ctx context.Context, dc *VkQueueSubmit, p *path.Mesh, r *path.
 	return mesh, nil
 }
 
+const (
+	// The sizes of VkDrawIndirectCommand and VkDrawIndexedIndirectCommand.
+	drawIndirectCommandSize        = 16
+	drawIndexedIndirectCommandSize = 20
+)
+
+// drawIndirectMesh returns the function adding the draw of the parameters
+// of a VkDrawIndirectCommand with drawMesh.
+func drawIndirectMesh(drawMesh func(vertexCount, firstVertex uint32)) func(binary.Reader) error {
+	return func(params binary.Reader) error {
+		// VkDrawIndirectCommand: vertexCount, instanceCount, firstVertex,
+		// firstInstance.
+		vertexCount := params.Uint32()
+		params.Uint32()
+		firstVertex := params.Uint32()
+		if err := params.Error(); err != nil {
+			return err
+		}
+		drawMesh(vertexCount, firstVertex)
+		return nil
+	}
+}
+
+// drawIndexedIndirectMesh returns the function adding the draw of the
+// parameters of a VkDrawIndexedIndirectCommand with drawIndexedMesh.
+func drawIndexedIndirectMesh(drawIndexedMesh func(indexCount, firstIndex uint32, vertexOffset int32) error) func(binary.Reader) error {
+	return func(params binary.Reader) error {
+		// VkDrawIndexedIndirectCommand: indexCount, instanceCount, firstIndex,
+		// vertexOffset, firstInstance.
+		indexCount := params.Uint32()
+		params.Uint32()
+		firstIndex := params.Uint32()
+		vertexOffset := params.Int32()
+		if err := params.Error(); err != nil {
+			return err
+		}
+		return drawIndexedMesh(indexCount, firstIndex, vertexOffset)
+	}
+}
+
+// readIndirectDraws reads back the parameters of the count draws of the
+// given size, stride bytes apart from the given offset of the indirect
+// buffer, and calls draw with the parameters of each draw.
+func readIndirectDraws(ctx context.Context, s *api.GlobalState,
+	p *path.Command, r *path.ResolveConfig, buffer VkBuffer, offset VkDeviceSize,
+	count, stride uint32, size uint64, draw func(binary.Reader) error) error {
+	if count == 0 {
+		return nil
+	}
+	if stride == 0 {
+		// The stride is ignored if there is only one draw.
+		stride = uint32(size)
+	}
+	data, err := readBufferData(ctx, p, r, buffer, offset, uint64(count-1)*uint64(stride)+size)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < uint64(count); i++ {
+		params := data[i*uint64(stride) : i*uint64(stride)+size]
+		if err := draw(endian.Reader(bytes.NewReader(params), s.MemoryLayout.GetEndian())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readIndirectDrawCount reads back the draw count of an indirect draw at the
+// given offset of the count buffer, clamped to the max draw count.
+func readIndirectDrawCount(ctx context.Context, s *api.GlobalState,
+	p *path.Command, r *path.ResolveConfig, buffer VkBuffer, offset VkDeviceSize,
+	maxDrawCount uint32) (uint32, error) {
+	data, err := readBufferData(ctx, p, r, buffer, offset, 4)
+	if err != nil {
+		return 0, err
+	}
+	params := endian.Reader(bytes.NewReader(data), s.MemoryLayout.GetEndian())
+	count := params.Uint32()
+	if err := params.Error(); err != nil {
+		return 0, err
+	}
+	if count > maxDrawCount {
+		count = maxDrawCount
+	}
+	return count, nil
+}
+
+// readBufferData reads back the given range of the buffer, as it is when the
+// draw command at p is executed in the replay on the device of r.
+func readBufferData(ctx context.Context, p *path.Command, r *path.ResolveConfig,
+	buffer VkBuffer, offset VkDeviceSize, size uint64) ([]byte, error) {
+	if r.GetReplayDevice() == nil {
+		return nil, fmt.Errorf("No replay device to read back the indirect draw parameters")
+	}
+	intent := replay.Intent{
+		Device:  r.GetReplayDevice(),
+		Capture: p.Capture,
+	}
+	data, err := API{}.QueryBufferData(ctx, intent, replay.GetManager(ctx),
+		p.Indices, buffer, uint64(offset), size, &service.UsageHints{Primary: true})
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) < size {
+		return nil, fmt.Errorf("Could not read back the indirect draw parameters")
+	}
+	return data, nil
+}
+
 func getIndicesData(ctx context.Context, s *api.GlobalState, thread uint64, boundIndexBuffer BoundIndexBufferʳ, indexCount, firstIndex uint32, vertexOffset int32) ([]uint32, error) {
-	backingMem := boundIndexBuffer.BoundBuffer().Buffer().Memory()
+	return readIndices(ctx, s, thread, boundIndexBuffer.BoundBuffer().Buffer(),
+		boundIndexBuffer.BoundBuffer().Offset(), boundIndexBuffer.Type(),
+		indexCount, firstIndex, vertexOffset)
+}
+
+// readIndices reads the indices from the given index buffer, bound at the
+// given offset, and returns them with the vertexOffset added.
+func readIndices(ctx context.Context, s *api.GlobalState, thread uint64, buffer BufferObjectʳ, bufferOffset VkDeviceSize, indexType VkIndexType, indexCount, firstIndex uint32, vertexOffset int32) ([]uint32, error) {
+	backingMem := buffer.Memory()
 	if backingMem.IsNil() {
 		return []uint32{}, nil
 	}
@@ -185,8 +357,8 @@ func getIndicesData(ctx context.Context, s *api.GlobalState, thread uint64, boun
 		size := uint64(indexCount) * sizeOfIndex
 
 		backingMemoryPieces, err := subGetBufferBoundMemoryPiecesInRange(
-			ctx, nil, api.CmdNoID, nil, s, nil, thread, nil, nil, boundIndexBuffer.BoundBuffer().Buffer(),
-			boundIndexBuffer.BoundBuffer().Offset()+VkDeviceSize(uint64(firstIndex)*sizeOfIndex),
+			ctx, nil, api.CmdNoID, nil, s, nil, thread, nil, nil, buffer,
+			bufferOffset+VkDeviceSize(uint64(firstIndex)*sizeOfIndex),
 			VkDeviceSize(size))
 		if err != nil {
 			return []uint32{}, err
@@ -228,7 +400,7 @@ func getIndicesData(ctx context.Context, s *api.GlobalState, thread uint64, boun
 		return indices, nil
 	}
 
-	switch boundIndexBuffer.Type() {
+	switch indexType {
 	case VkIndexType_VK_INDEX_TYPE_UINT16:
 		return extractIndices(2)
 	case VkIndexType_VK_INDEX_TYPE_UINT32:
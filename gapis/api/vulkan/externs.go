@@ -22,6 +22,7 @@ import (
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/messages"
 	"github.com/google/gapid/gapis/replay"
 	rb "github.com/google/gapid/gapis/replay/builder"
 	"github.com/google/gapid/gapis/replay/protocol"
@@ -404,6 +405,52 @@ func (e externs) fetchLinearImageSubresourceLayouts(dev VkDevice, img ImageObjec
 	return NilLinearImageLayoutsʳ
 }
 
+// checkMemoryAliasing reports the buffers and images that are bound to ranges
+// of the given device memory overlapping with the range bound to the given
+// buffer or image.
+func (e externs) checkMemoryAliasing(memory VkDeviceMemory, handle uint64, offset, size VkDeviceSize) {
+	f := e.s.NewMessage
+	if f == nil {
+		return
+	}
+	memObj := GetState(e.s).DeviceMemories().Get(memory)
+	if memObj.IsNil() {
+		return
+	}
+	for _, other := range memObj.BoundObjects().Keys() {
+		if other == handle {
+			continue
+		}
+		otherOffset := memObj.BoundObjects().Get(other)
+		otherName, otherSize, ok := e.boundObject(other)
+		if !ok {
+			continue
+		}
+		if otherOffset < offset+size && offset < otherOffset+otherSize {
+			name, _, _ := e.boundObject(handle)
+			f(log.Warning, messages.WarnMemoryAliasing(name, uint64(memory), otherName))
+		}
+	}
+}
+
+// boundObject returns the description and the size of the buffer or image
+// with the given handle. The returned boolean is false if there is no such
+// buffer or image.
+func (e externs) boundObject(handle uint64) (string, VkDeviceSize, bool) {
+	st := GetState(e.s)
+	if buf := st.Buffers().Get(VkBuffer(handle)); !buf.IsNil() {
+		return fmt.Sprintf("VkBuffer %v", handle), buf.Info().Size(), true
+	}
+	if img := st.Images().Get(VkImage(handle)); !img.IsNil() {
+		size, err := subInferImageSize(e.ctx, nil, api.CmdNoID, nil, e.s, st, 0, nil, nil, img)
+		if err != nil {
+			return "", 0, false
+		}
+		return fmt.Sprintf("VkImage %v", handle), size, true
+	}
+	return "", 0, false
+}
+
 func (e externs) onVkError(issue replay.Issue) {
 	if f := e.s.OnError; f != nil {
 		f(issue)
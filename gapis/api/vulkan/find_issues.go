@@ -20,6 +20,7 @@ import (
 
 	"github.com/google/gapid/core/data/binary"
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
 	gapir "github.com/google/gapid/gapir/client"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/api/transform"
@@ -39,14 +40,15 @@ var validationLayers = [...]string{
 }
 
 const (
-	validationMetaLayer  = "VK_LAYER_LUNARG_standard_validation"
-	debugReportExtension = "VK_EXT_debug_report"
+	validationMetaLayer    = "VK_LAYER_LUNARG_standard_validation"
+	khronosValidationLayer = "VK_LAYER_KHRONOS_validation"
+	debugReportExtension   = "VK_EXT_debug_report"
 )
 
 // isValidationLayer returns true if any of the given string matches with any
 // validation layer names. Otherwise returns false.
 func isValidationLayer(n string) bool {
-	if n == validationMetaLayer {
+	if n == validationMetaLayer || n == khronosValidationLayer {
 		return true
 	}
 	for _, v := range validationLayers {
@@ -57,6 +59,18 @@ func isValidationLayer(n string) bool {
 	return false
 }
 
+// replayValidationLayers returns the validation layers to enable for the
+// replay on the given device: the VK_LAYER_KHRONOS_validation layer if the
+// device has it, otherwise the individual legacy validation layers.
+func replayValidationLayers(d *device.Instance) []string {
+	for _, l := range d.GetConfiguration().GetDrivers().GetVulkan().GetLayers() {
+		if l.Name == khronosValidationLayer {
+			return []string{khronosValidationLayer}
+		}
+	}
+	return validationLayers[:]
+}
+
 // findIssues is a command transform that detects issues when replaying the
 // stream of commands. Any issues that are found are written to all the chans in
 // the slice out. Once the last issue is sent (if any) all the chans in out are
@@ -68,12 +82,14 @@ type findIssues struct {
 	issues          []replay.Issue
 	res             []replay.Result
 	reportCallbacks map[VkInstance]VkDebugReportCallbackEXT
+	layers          []string
 }
 
-func newFindIssues(ctx context.Context, c *capture.Capture, numInitialCmds int) *findIssues {
+func newFindIssues(ctx context.Context, c *capture.Capture, numInitialCmds int, layers []string) *findIssues {
 	t := &findIssues{
 		state:           c.NewState(ctx),
 		numInitialCmds:  numInitialCmds,
+		layers:          layers,
 		reportCallbacks: map[VkInstance]VkDebugReportCallbackEXT{},
 	}
 	t.state.OnError = func(err interface{}) {
@@ -123,8 +139,8 @@ func (t *findIssues) Transform(ctx context.Context, id api.CmdID, cmd api.Cmd, o
 
 	switch cmd := cmd.(type) {
 	// Modify the vkCreateInstance to remove any validation layers first, and
-	// insert the individual validation layers in order. This is because Android
-	// does not support the meta layer, and the order does matter.Also enable the
+	// insert the validation layers of the replay device in order. This is because
+	// Android does not support the meta layer, and the order does matter. Also enable the
 	// VK_EXT_debug_report extension.
 	case *VkCreateInstance:
 		cmd.Extras().Observations().ApplyReads(s.Memory.ApplicationPool())
@@ -138,7 +154,7 @@ func (t *findIssues) Transform(ctx context.Context, id api.CmdID, cmd api.Cmd, o
 		}
 
 		validationLayersData := []api.AllocResult{}
-		for _, v := range validationLayers {
+		for _, v := range t.layers {
 			d := mustAlloc(ctx, v)
 			validationLayersData = append(validationLayersData, d)
 			layers = append(layers, NewCharᶜᵖ(d.Ptr()))
@@ -202,7 +218,7 @@ func (t *findIssues) Transform(ctx context.Context, id api.CmdID, cmd api.Cmd, o
 		}
 
 		validationLayersData := []api.AllocResult{}
-		for _, v := range validationLayers {
+		for _, v := range t.layers {
 			d := mustAlloc(ctx, v)
 			validationLayersData = append(validationLayersData, d)
 			layers = append(layers, NewCharᶜᵖ(d.Ptr()))
@@ -0,0 +1,103 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/resolve/dependencygraph"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/stringtable"
+)
+
+// footprintAnalysis is the analysis of a capture recorded by the
+// FootprintBuilder in the same pass as the footprint of the capture, and kept
+// with the footprint. The commands of the findings, the frame ends and the
+// handle lifetimes are the ones of the capture, the recorders keep the
+// commands seen by the FootprintBuilder, which are shifted by the number of
+// the initial commands.
+type footprintAnalysis struct {
+	// The number of the commands of the capture, and of the commands
+	// prepended to build its initial state.
+	numCmds        int
+	numInitialCmds int
+
+	broadBarriers map[api.CmdID]*stringtable.Msg
+	lint          map[api.CmdID][]*stringtable.Msg
+	lifetimes     map[handleKey][]handleLifetime
+	frameEnds     []api.CmdID
+
+	resourceUses *resourceUseRecorder
+	rollOut      *rollOutTrace
+	imageLayouts *imageLayoutsRecorder
+	boundStates  *boundStateRecorder
+}
+
+// analyze makes the FootprintBuilder record the analysis of the capture while
+// it builds the footprint.
+func (vb *FootprintBuilder) analyze() {
+	vb.resourceUses = newResourceUseRecorder()
+	vb.barriers = newBarrierAnalyzer()
+	vb.lint = newLintAnalyzer()
+	vb.lifetimes = newHandleLifetimeRecorder()
+	vb.frames = newFrameBoundaries()
+	vb.rollOut = &rollOutTrace{}
+	vb.imageLayouts = newImageLayoutsRecorder()
+	vb.boundStates = newBoundStateRecorder()
+	vb.observers = append(vb.observers, vb.resourceUses, vb.barriers, vb.lint, vb.imageLayouts)
+}
+
+// Analysis implements the dependencygraph.FootprintAnalyzer interface. It
+// returns the *footprintAnalysis of the capture, or nil if the builder does
+// not analyze the capture.
+func (vb *FootprintBuilder) Analysis(ctx context.Context, ft *dependencygraph.Footprint) interface{} {
+	if vb.resourceUses == nil {
+		return nil
+	}
+	numInitialCmds := ft.NumInitialCommands
+	a := &footprintAnalysis{
+		numCmds:        len(ft.Commands) - numInitialCmds,
+		numInitialCmds: numInitialCmds,
+		broadBarriers:  vb.barriers.broadBarriers(numInitialCmds),
+		lint:           vb.lint.findings(numInitialCmds),
+		lifetimes:      vb.lifetimes.handleLifetimes(numInitialCmds),
+		frameEnds:      vb.frames.captureFrameEnds(numInitialCmds),
+		resourceUses:   vb.resourceUses,
+		rollOut:        vb.rollOut,
+		imageLayouts:   vb.imageLayouts,
+		boundStates:    vb.boundStates,
+	}
+	// The variables of the resources are only needed while the footprint is
+	// built.
+	a.resourceUses.vars = nil
+	a.imageLayouts.images = nil
+	return a
+}
+
+// analyzeCapture returns the analysis of the given capture, recorded along
+// with its footprint.
+func analyzeCapture(ctx context.Context, p *path.Capture) (*footprintAnalysis, error) {
+	obj, err := dependencygraph.GetFootprintAnalysis(ctx, p, API{})
+	if err != nil {
+		return nil, err
+	}
+	a, ok := obj.(*footprintAnalysis)
+	if !ok {
+		return nil, fmt.Errorf("Capture %v is not analyzed", p.ID)
+	}
+	return a, nil
+}
@@ -17,6 +17,9 @@ package vulkan
 import (
 	"context"
 	"fmt"
+	"path"
+	"runtime"
+	"sort"
 
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/math/interval"
@@ -33,6 +36,7 @@ const vkWholeSize = uint64(0xFFFFFFFFFFFFFFFF)
 const vkAttachmentUnused = uint32(0xFFFFFFFF)
 const vkRemainingArrayLayers = uint32(0xFFFFFFFF)
 const vkRemainingMipLevels = uint32(0xFFFFFFFF)
+const vkQueueFamilyIgnored = uint32(0xFFFFFFFF)
 
 // Assume the value of a Vulkan handle is always unique
 type vkHandle struct {
@@ -66,9 +70,29 @@ func (l *label) SetDefBehavior(b *dependencygraph.Behavior) {
 	l.b = b
 }
 
-var nextLabelVal uint64 = 1
+// labelChunkSize is the number of labels allocated at a time.
+const labelChunkSize = 4096
 
-func newLabel() *label { i := nextLabelVal; nextLabelVal++; return &label{i, nil} }
+// labelAllocator hands out the labels of a FootprintBuilder, with values
+// unique and deterministic within that builder. Labels are allocated in chunks
+// as every command creates several of them, and one heap allocation per label
+// dominates the memory used to build the footprint of large captures.
+type labelAllocator struct {
+	last uint64
+	free []label
+}
+
+// newLabel returns a new label with a unique value.
+func (a *labelAllocator) newLabel() *label {
+	if len(a.free) == 0 {
+		a.free = make([]label, labelChunkSize)
+	}
+	a.last++
+	l := &a.free[0]
+	a.free = a.free[1:]
+	l.uint64 = a.last
+	return l
+}
 
 // Forward-paired label
 type forwardPairedLabel struct {
@@ -83,10 +107,10 @@ func (l *forwardPairedLabel) SetDefBehavior(b *dependencygraph.Behavior) {
 	l.b = b
 }
 
-func newForwardPairedLabel(ctx context.Context,
+func newForwardPairedLabel(ctx context.Context, vb *FootprintBuilder,
 	bh *dependencygraph.Behavior) *forwardPairedLabel {
 	fpl := &forwardPairedLabel{labelReadBehaviors: []*dependencygraph.Behavior{}, b: nil}
-	write(ctx, bh, fpl)
+	vb.write(ctx, bh, fpl)
 	return fpl
 }
 
@@ -143,11 +167,12 @@ type commandBufferCommand struct {
 
 func (cbc *commandBufferCommand) newBehavior(ctx context.Context,
 	sc submittedCommand, qei *queueExecutionState) *dependencygraph.Behavior {
-	bh := dependencygraph.NewBehavior(sc.id)
-	read(ctx, bh, cbc)
-	read(ctx, bh, qei.currentSubmitInfo.queued)
+	vb := qei.vb
+	bh := vb.behaviors.NewBehavior(sc.id)
+	vb.read(ctx, bh, cbc)
+	vb.read(ctx, bh, qei.currentSubmitInfo.queued)
 	if sc.parentCmd != nil {
-		read(ctx, bh, sc.parentCmd)
+		vb.read(ctx, bh, sc.parentCmd)
 	}
 	return bh
 }
@@ -192,6 +217,11 @@ type queueSubmitInfo struct {
 	signalSemaphores []VkSemaphore
 	signalFence      VkFence
 	pendingCommands  []*submittedCommand
+	// The contents of the descriptor sets bound by the submitted commands,
+	// resolved at submission. Descriptor sets created with update-after-bind
+	// can be updated after being bound, so their contents are not known until
+	// the command buffers are submitted.
+	descriptorSets map[VkDescriptorSet]*descriptorSet
 }
 
 type event struct {
@@ -209,26 +239,190 @@ type query struct {
 	begin  *label
 	end    *label
 	result *label
+	// availability is written when the query becomes available, i.e. when the
+	// query ends, and when it becomes unavailable, i.e. when it is reset.
+	availability *label
 }
 
-func newQuery() *query {
+func newQuery(la *labelAllocator) *query {
 	return &query{
-		reset:  newLabel(),
-		begin:  newLabel(),
-		end:    newLabel(),
-		result: newLabel(),
+		reset:        la.newLabel(),
+		begin:        la.newLabel(),
+		end:          la.newLabel(),
+		result:       la.newLabel(),
+		availability: la.newLabel(),
+	}
+}
+
+// resultDependencies returns the variables read when the result of the query
+// is retrieved with the given flags, either by vkGetQueryPoolResults or by
+// vkCmdCopyQueryPoolResults.
+func (q *query) resultDependencies(flags VkQueryResultFlags) []dependencygraph.DefUseVariable {
+	wait := flags&VkQueryResultFlags(VkQueryResultFlagBits_VK_QUERY_RESULT_WAIT_BIT) != 0
+	partial := flags&VkQueryResultFlags(VkQueryResultFlagBits_VK_QUERY_RESULT_PARTIAL_BIT) != 0
+	withAvailability := flags&VkQueryResultFlags(VkQueryResultFlagBits_VK_QUERY_RESULT_WITH_AVAILABILITY_BIT) != 0
+	deps := []dependencygraph.DefUseVariable{q.result}
+	// Without the WAIT bit and the PARTIAL bit, the result is written only if
+	// the query is available. With the WAIT bit, the retrieval waits for the
+	// query to become available. With the WITH_AVAILABILITY bit, the
+	// availability status is written along with the result.
+	if wait || withAvailability || !partial {
+		deps = append(deps, q.availability)
+	}
+	// With the PARTIAL bit but not the WAIT bit, the intermediate result of an
+	// active query may be returned.
+	if partial && !wait {
+		deps = append(deps, q.begin)
 	}
+	return deps
 }
 
 type queryPool struct {
 	queries []*query
+	// profilingLock is the profiling lock of the device that owns the query
+	// pool, if the query pool is a performance query pool. Otherwise it is
+	// nil.
+	profilingLock *label
+}
+
+// profilingLockDeps returns the variables to be read by the commands which
+// begin or end queries in this query pool.
+func (qp *queryPool) profilingLockDeps() []dependencygraph.DefUseVariable {
+	if qp.profilingLock == nil {
+		return []dependencygraph.DefUseVariable{}
+	}
+	return []dependencygraph.DefUseVariable{qp.profilingLock}
+}
+
+// maxPipelineCacheContributions is the number of contributions to the content
+// of a pipeline cache that are tracked separately. The following ones are
+// chained to the last one, so the reads of the content don't grow with the
+// number of pipelines created with the cache.
+const maxPipelineCacheContributions = 64
+
+// pipelineCache records the labels of the contributions to the content of a
+// pipeline cache. The content is written on the creation of the cache, then
+// accumulated by the creation of pipelines with the cache and the merges of
+// other caches into it.
+type pipelineCache struct {
+	content []*label
+}
+
+func newPipelineCache(la *labelAllocator) *pipelineCache {
+	return &pipelineCache{content: []*label{la.newLabel()}}
+}
+
+// contribute records a new contribution of the given behavior to the content
+// of the pipeline cache. Once the cache has maxPipelineCacheContributions, the
+// contribution modifies the last one instead, which keeps the previous
+// contributor alive along with the new one.
+func (pc *pipelineCache) contribute(ctx context.Context, vb *FootprintBuilder,
+	bh *dependencygraph.Behavior) {
+	if len(pc.content) < maxPipelineCacheContributions {
+		l := vb.labels.newLabel()
+		pc.content = append(pc.content, l)
+		vb.write(ctx, bh, l)
+		return
+	}
+	vb.modify(ctx, bh, pc.content[len(pc.content)-1])
+}
+
+// contentDeps returns the variables to be read by the commands that consume
+// the content of the pipeline cache.
+func (pc *pipelineCache) contentDeps() []dependencygraph.DefUseVariable {
+	deps := make([]dependencygraph.DefUseVariable, 0, len(pc.content))
+	for _, l := range pc.content {
+		deps = append(deps, l)
+	}
+	return deps
+}
+
+// videoSession records the states of a video session: the memory bound to
+// the session, the coding control parameters and the decoded picture buffer
+// (DPB) slots. A DPB slot label is written when a picture is set up in the
+// slot, and read when the slot is referred by video coding commands.
+type videoSession struct {
+	memory  *label
+	control *label
+	slots   map[int32]*label
+}
+
+func newVideoSession(la *labelAllocator) *videoSession {
+	return &videoSession{
+		memory:  la.newLabel(),
+		control: la.newLabel(),
+		slots:   map[int32]*label{},
+	}
+}
+
+func (vs *videoSession) getSlot(la *labelAllocator, index int32) *label {
+	if _, ok := vs.slots[index]; !ok {
+		vs.slots[index] = la.newLabel()
+	}
+	return vs.slots[index]
+}
+
+// swapchainImages records the images of a swapchain in the order of their
+// image indices, and for each image, the labels to track the acquire-present
+// pair of the image in the presentation engine.
+type swapchainImages struct {
+	images    []VkImage
+	acquired  []*label
+	presented []*label
+}
+
+// reset updates the images of the swapchain with the images returned by
+// vkGetSwapchainImagesKHR. Labels are kept for the images that are already
+// known at the same index, so repeated queries do not lose the acquire-present
+// state, and are renewed for the others.
+func (si *swapchainImages) reset(la *labelAllocator, images []VkImage) {
+	acquired := make([]*label, len(images))
+	presented := make([]*label, len(images))
+	for i, img := range images {
+		if i < len(si.images) && si.images[i] == img {
+			acquired[i] = si.acquired[i]
+			presented[i] = si.presented[i]
+		} else {
+			acquired[i] = la.newLabel()
+			presented[i] = la.newLabel()
+		}
+	}
+	si.images = images
+	si.acquired = acquired
+	si.presented = presented
+}
+
+// image returns the image and the acquire-present labels at the given image
+// index. The returned boolean is false if the index is out of the range of the
+// known images.
+func (si *swapchainImages) image(index uint32) (VkImage, *label, *label, bool) {
+	if si == nil || uint64(index) >= uint64(len(si.images)) {
+		return VkImage(0), nil, nil, false
+	}
+	return si.images[index], si.acquired[index], si.presented[index], true
+}
+
+func (vs *videoSession) allSlots() []dependencygraph.DefUseVariable {
+	slots := make([]dependencygraph.DefUseVariable, 0, len(vs.slots))
+	for _, l := range vs.slots {
+		slots = append(slots, l)
+	}
+	return slots
+}
+
+// videoReferenceSlot is a DPB slot used by a video coding command, along with
+// the underlying data of the picture resource bound to the slot.
+type videoReferenceSlot struct {
+	index int32
+	data  []dependencygraph.DefUseVariable
 }
 
 type subpassAttachmentInfo struct {
 	fullImageData bool
 	data          []dependencygraph.DefUseVariable
-	layout        *label
+	layout        []dependencygraph.DefUseVariable
 	desc          VkAttachmentDescription
+	index         uint32
 }
 
 type subpassInfo struct {
@@ -238,6 +432,12 @@ type subpassInfo struct {
 	resolveAttachments     []*subpassAttachmentInfo
 	inputAttachments       []*subpassAttachmentInfo
 	depthStencilAttachment *subpassAttachmentInfo
+	// The depth/stencil resolve attachment is only available for the subpasses
+	// described with VkSubpassDescription2.
+	depthStencilResolveAttachment *subpassAttachmentInfo
+	// The fragment shading rate attachment is only read by draw commands, it
+	// does not take part in the load and store operations of the render pass.
+	shadingRateAttachment  *subpassAttachmentInfo
 	modifiedDescriptorData []dependencygraph.DefUseVariable
 }
 
@@ -255,30 +455,60 @@ func (si *subpassIndex) SetDefBehavior(b *dependencygraph.Behavior) {
 
 type commandBufferExecutionState struct {
 	vertexBufferResBindings map[uint32]resBindingList
-	indexBufferResBindings  resBindingList
-	indexType               VkIndexType
-	descriptorSets          map[uint32]*boundDescriptorSet
-	pipeline                *label
-	dynamicState            *label
+	// The bound vertex buffers and their offsets in the buffers, indexed by
+	// the binding numbers.
+	vertexBuffers       map[uint32]VkBuffer
+	vertexBufferOffsets map[uint32]uint64
+	// The vertex input bindings of the bound graphics pipeline, nil if the
+	// bound pipeline is unknown.
+	vertexInputBindings map[uint32]VkVertexInputBindingDescription
+	// The sizes of the vertices fetched from each binding by the bound
+	// pipeline, the end of the furthest attribute of the binding.
+	vertexSizes            map[uint32]uint64
+	indexBufferResBindings resBindingList
+	indexBuffer            VkBuffer
+	indexBufferOffset      uint64
+	indexType              VkIndexType
+	descriptorSets         map[uint32]*boundDescriptorSet
+	pipeline               *label
+	dynamicState           *label
+	// The bound pipelines, indexed by the bind points.
+	pipelines map[VkPipelineBindPoint]VkPipeline
+	// The last command that set each dynamic state, indexed by the command
+	// names.
+	dynamicStateCmds map[string]api.Cmd
+	// The video session bound by vkCmdBeginVideoCodingKHR, nil if not in a
+	// video coding scope.
+	videoSession *videoSession
 }
 
-func newCommandBufferExecutionState() *commandBufferExecutionState {
+func newCommandBufferExecutionState(la *labelAllocator) *commandBufferExecutionState {
 	return &commandBufferExecutionState{
 		vertexBufferResBindings: map[uint32]resBindingList{},
+		vertexBuffers:           map[uint32]VkBuffer{},
+		vertexBufferOffsets:     map[uint32]uint64{},
 		descriptorSets:          map[uint32]*boundDescriptorSet{},
-		pipeline:                newLabel(),
-		dynamicState:            newLabel(),
+		pipeline:                la.newLabel(),
+		dynamicState:            la.newLabel(),
+		pipelines:               map[VkPipelineBindPoint]VkPipeline{},
+		dynamicStateCmds:        map[string]api.Cmd{},
 	}
 }
 
 type queueExecutionState struct {
-	currentCmdBufState   *commandBufferExecutionState
-	primaryCmdBufState   *commandBufferExecutionState
-	secondaryCmdBufState *commandBufferExecutionState
+	currentCmdBufState *commandBufferExecutionState
+	// The execution states of the command buffers being executed, indexed by
+	// the nesting level of the command buffers. The primary command buffer is
+	// at level 0, the secondary command buffers it executes are at level 1,
+	// and so on.
+	cmdBufStates []*commandBufferExecutionState
 
 	subpasses       []subpassInfo
 	subpass         *subpassIndex
 	renderPassBegin *forwardPairedLabel
+	// The render pass begun on the queue, VkRenderPass(0) outside of render
+	// passes.
+	renderPass VkRenderPass
 
 	currentCommand api.SubCmdIdx
 
@@ -286,44 +516,65 @@ type queueExecutionState struct {
 
 	lastSubmitID      api.CmdID
 	currentSubmitInfo *queueSubmitInfo
+
+	// The queue family of the queue, used to tell the release operations of
+	// queue family ownership transfers from the acquire operations.
+	queueFamily uint32
+
+	vb *FootprintBuilder
 }
 
-func newQueueExecutionState(id api.CmdID) *queueExecutionState {
+func newQueueExecutionState(vb *FootprintBuilder, id api.CmdID,
+	queueFamily uint32) *queueExecutionState {
 	return &queueExecutionState{
+		vb:             vb,
 		subpasses:      []subpassInfo{},
 		lastSubmitID:   id,
 		currentCommand: api.SubCmdIdx([]uint64{0, 0, 0, 0}),
+		queueFamily:    queueFamily,
+	}
+}
+
+// cmdBufNestingLevel returns the nesting level of the command buffer that
+// contains the subcommand indexed by the given full command index. A full
+// command index of a command in a primary command buffer has four elements:
+// the queue submit command, the submit info, the command buffer and the
+// command. Each level of nesting adds two more elements: the command buffer
+// index in the parent vkCmdExecuteCommands and the command. Returns false if
+// the given full command index is not in this form.
+func cmdBufNestingLevel(fci api.SubCmdIdx) (int, bool) {
+	if len(fci) < 4 || len(fci)%2 != 0 {
+		return 0, false
 	}
+	return (len(fci) - 4) / 2, true
 }
 
 func (qei *queueExecutionState) updateCurrentCommand(ctx context.Context,
-	fci api.SubCmdIdx) {
-	switch len(fci) {
-	case 4:
-		current := api.SubCmdIdx(qei.currentCommand[0:3])
-		comming := api.SubCmdIdx(fci[0:3])
-		if current.LessThan(comming) {
-			// primary command buffer changed
-			qei.primaryCmdBufState = newCommandBufferExecutionState()
-		}
-		qei.currentCmdBufState = qei.primaryCmdBufState
-	case 6:
-		if len(qei.currentCommand) != 6 {
-			// Transit from primary command buffer to secondary command buffer
-			qei.secondaryCmdBufState = newCommandBufferExecutionState()
-		} else {
-			current := api.SubCmdIdx(qei.currentCommand[0:5])
-			comming := api.SubCmdIdx(fci[0:5])
-			if current.LessThan(comming) {
-				// secondary command buffer changed
-				qei.secondaryCmdBufState = newCommandBufferExecutionState()
-			}
-		}
-		qei.currentCmdBufState = qei.secondaryCmdBufState
-	default:
-		log.E(ctx, "FootprintBuilder: Invalid length of full command index")
+	fci api.SubCmdIdx) bool {
+	level, ok := cmdBufNestingLevel(fci)
+	if !ok {
+		log.E(ctx, "FootprintBuilder: Invalid length of full command index: %v", fci)
+		return false
+	}
+	// The command buffer of the coming command differs from the one of the
+	// current command if the current command is at a shallower level, i.e.
+	// transiting from the parent command buffer to a nested one, or if the
+	// indices of the command buffer changed.
+	prefixLen := len(fci) - 1
+	cmdBufChanged := len(qei.currentCommand) < len(fci) ||
+		api.SubCmdIdx(qei.currentCommand[0:prefixLen]).LessThan(fci[0:prefixLen])
+	for len(qei.cmdBufStates) <= level {
+		qei.cmdBufStates = append(qei.cmdBufStates, newCommandBufferExecutionState(qei.vb.labels))
 	}
+	// The states of the command buffers nested deeper than the coming command
+	// are finished.
+	qei.cmdBufStates = qei.cmdBufStates[0 : level+1]
+	if cmdBufChanged {
+		qei.cmdBufStates[level] = newCommandBufferExecutionState(qei.vb.labels)
+	}
+	qei.currentCmdBufState = qei.cmdBufStates[level]
 	qei.currentCommand = fci
+	return true
 }
 
 func (o VkAttachmentLoadOp) isLoad() bool {
@@ -336,40 +587,42 @@ func (o VkAttachmentStoreOp) isStore() bool {
 
 func (qei *queueExecutionState) startSubpass(ctx context.Context,
 	bh *dependencygraph.Behavior) {
-	write(ctx, bh, qei.subpass)
+	vb := qei.vb
+	vb.write(ctx, bh, qei.subpass)
 	subpassI := qei.subpass.val
 	noDsAttLoadOp := func(ctx context.Context, bh *dependencygraph.Behavior,
 		attachment *subpassAttachmentInfo) {
 		// TODO: Not all subpasses change layouts
-		modify(ctx, bh, attachment.layout)
+		vb.modify(ctx, bh, attachment.layout...)
 		if attachment.desc.LoadOp().isLoad() {
-			read(ctx, bh, attachment.data...)
+			vb.read(ctx, bh, attachment.data...)
 		} else {
 			if attachment.fullImageData {
-				write(ctx, bh, attachment.data...)
+				vb.write(ctx, bh, attachment.data...)
 			} else {
-				modify(ctx, bh, attachment.data...)
+				vb.modify(ctx, bh, attachment.data...)
 			}
 		}
 	}
 	dsAttLoadOp := func(ctx context.Context, bh *dependencygraph.Behavior,
 		attachment *subpassAttachmentInfo) {
 		// TODO: Not all subpasses change layouts
-		modify(ctx, bh, attachment.layout)
+		vb.modify(ctx, bh, attachment.layout...)
 		if !attachment.desc.LoadOp().isLoad() && !attachment.desc.StencilLoadOp().isLoad() {
 			if attachment.fullImageData {
-				write(ctx, bh, attachment.data...)
+				vb.write(ctx, bh, attachment.data...)
 			} else {
-				modify(ctx, bh, attachment.data...)
+				vb.modify(ctx, bh, attachment.data...)
 			}
 		} else if attachment.desc.LoadOp().isLoad() && attachment.desc.StencilLoadOp().isLoad() {
-			read(ctx, bh, attachment.data...)
+			vb.read(ctx, bh, attachment.data...)
 		} else {
-			modify(ctx, bh, attachment.data...)
+			vb.modify(ctx, bh, attachment.data...)
 		}
 	}
 	for _, l := range qei.subpasses[subpassI].loadAttachments {
-		if qei.subpasses[subpassI].depthStencilAttachment == l {
+		if qei.subpasses[subpassI].depthStencilAttachment == l ||
+			qei.subpasses[subpassI].depthStencilResolveAttachment == l {
 			dsAttLoadOp(ctx, bh, l)
 		} else {
 			noDsAttLoadOp(ctx, bh, l)
@@ -379,6 +632,7 @@ func (qei *queueExecutionState) startSubpass(ctx context.Context,
 
 func (qei *queueExecutionState) emitSubpassOutput(ctx context.Context,
 	ft *dependencygraph.Footprint, sc submittedCommand) {
+	vb := qei.vb
 	subpassI := qei.subpass.val
 	noDsAttStoreOp := func(ctx context.Context, ft *dependencygraph.Footprint,
 		sc submittedCommand, att *subpassAttachmentInfo,
@@ -386,42 +640,48 @@ func (qei *queueExecutionState) emitSubpassOutput(ctx context.Context,
 		// Two behaviors for each attachment. One to represent the dependency of
 		// image layout, another one for the data.
 		behaviorForLayout := sc.cmd.newBehavior(ctx, sc, qei)
-		modify(ctx, behaviorForLayout, att.layout)
-		read(ctx, behaviorForLayout, qei.subpass)
+		vb.modify(ctx, behaviorForLayout, att.layout...)
+		vb.read(ctx, behaviorForLayout, qei.subpass)
 		ft.AddBehavior(ctx, behaviorForLayout)
 
 		behaviorForData := sc.cmd.newBehavior(ctx, sc, qei)
 		if readAtt != nil {
-			read(ctx, behaviorForData, readAtt.data...)
+			vb.read(ctx, behaviorForData, readAtt.data...)
 		}
 		if att.desc.StoreOp().isStore() {
-			modify(ctx, behaviorForData, att.data...)
+			vb.modify(ctx, behaviorForData, att.data...)
+			vb.lint.stored(qei.renderPass, att.index, att.data...)
 		} else {
 			// If the attachment fully covers the unlying image, this will clear
 			// the image data, which is a write operation.
 			if att.fullImageData {
-				write(ctx, behaviorForData, att.data...)
+				vb.write(ctx, behaviorForData, att.data...)
 			} else {
-				modify(ctx, behaviorForData, att.data...)
+				vb.modify(ctx, behaviorForData, att.data...)
 			}
 		}
-		read(ctx, behaviorForData, qei.subpass)
+		vb.read(ctx, behaviorForData, qei.subpass)
 		ft.AddBehavior(ctx, behaviorForData)
 	}
 
 	dsAttStoreOp := func(ctx context.Context, ft *dependencygraph.Footprint,
-		sc submittedCommand, dsAtt *subpassAttachmentInfo) {
+		sc submittedCommand, dsAtt *subpassAttachmentInfo,
+		readAtt *subpassAttachmentInfo) {
 		bh := sc.cmd.newBehavior(ctx, sc, qei)
+		if readAtt != nil {
+			vb.read(ctx, bh, readAtt.data...)
+		}
 		if dsAtt.desc.StoreOp().isStore() || dsAtt.desc.StencilStoreOp().isStore() {
-			modify(ctx, bh, dsAtt.data...)
+			vb.modify(ctx, bh, dsAtt.data...)
+			vb.lint.stored(qei.renderPass, dsAtt.index, dsAtt.data...)
 		} else {
 			if dsAtt.fullImageData {
-				write(ctx, bh, dsAtt.data...)
+				vb.write(ctx, bh, dsAtt.data...)
 			} else {
-				modify(ctx, bh, dsAtt.data...)
+				vb.modify(ctx, bh, dsAtt.data...)
 			}
 		}
-		read(ctx, bh, qei.subpass)
+		vb.read(ctx, bh, qei.subpass)
 		ft.AddBehavior(ctx, bh)
 	}
 
@@ -451,12 +711,15 @@ func (qei *queueExecutionState) emitSubpassOutput(ctx context.Context,
 		}
 	}
 	if isStoreAtt(qei.subpasses[subpassI].depthStencilAttachment) {
-		dsAttStoreOp(ctx, ft, sc, qei.subpasses[subpassI].depthStencilAttachment)
+		dsAttStoreOp(ctx, ft, sc, qei.subpasses[subpassI].depthStencilAttachment, nil)
+	}
+	if r := qei.subpasses[subpassI].depthStencilResolveAttachment; r != nil && isStoreAtt(r) {
+		dsAttStoreOp(ctx, ft, sc, r, qei.subpasses[subpassI].depthStencilAttachment)
 	}
 	for _, modified := range qei.subpasses[subpassI].modifiedDescriptorData {
 		bh := sc.cmd.newBehavior(ctx, sc, qei)
-		modify(ctx, bh, modified)
-		read(ctx, bh, qei.subpass)
+		vb.modify(ctx, bh, modified)
+		vb.read(ctx, bh, qei.subpass)
 		ft.AddBehavior(ctx, bh)
 	}
 }
@@ -465,15 +728,16 @@ func (qei *queueExecutionState) endSubpass(ctx context.Context,
 	ft *dependencygraph.Footprint, bh *dependencygraph.Behavior,
 	sc submittedCommand) {
 	qei.emitSubpassOutput(ctx, ft, sc)
-	read(ctx, bh, qei.subpass)
+	qei.vb.read(ctx, bh, qei.subpass)
 }
 
 func (qei *queueExecutionState) beginRenderPass(ctx context.Context,
 	vb *FootprintBuilder, bh *dependencygraph.Behavior,
 	rp RenderPassObjectʳ, fb FramebufferObjectʳ) {
-	read(ctx, bh, vb.toVkHandle(uint64(rp.VulkanHandle())))
-	read(ctx, bh, vb.toVkHandle(uint64(fb.VulkanHandle())))
+	vb.read(ctx, bh, vb.toVkHandle(uint64(rp.VulkanHandle())))
+	vb.read(ctx, bh, vb.toVkHandle(uint64(fb.VulkanHandle())))
 	qei.framebuffer = fb
+	qei.renderPass = rp.VulkanHandle()
 	qei.subpasses = make([]subpassInfo, 0, rp.SubpassDescriptions().Len())
 
 	// Record which subpass that loads or stores the attachments. A subpass loads
@@ -485,7 +749,8 @@ func (qei *queueExecutionState) beginRenderPass(ctx context.Context,
 	recordAttachment := func(ai, si uint32) *subpassAttachmentInfo {
 		viewObj := fb.ImageAttachments().Get(ai)
 		imgObj := viewObj.Image()
-		imgLayout, imgData := vb.getImageLayoutAndData(ctx, bh, imgObj.VulkanHandle())
+		imgLayout, imgData := vb.getImageSubresourceLayoutAndData(ctx, bh,
+			imgObj.VulkanHandle(), viewObj.SubresourceRange())
 		attDesc := rp.AttachmentDescriptions().Get(ai)
 		fullImageData := false
 		switch viewObj.Type() {
@@ -502,7 +767,7 @@ func (qei *queueExecutionState) beginRenderPass(ctx context.Context,
 				fullImageData = true
 			}
 		}
-		attachmentInfo := &subpassAttachmentInfo{fullImageData, imgData, imgLayout, attDesc}
+		attachmentInfo := &subpassAttachmentInfo{fullImageData, imgData, imgLayout, attDesc, ai}
 		if _, ok := attLoadSubpass[ai]; !ok {
 			attLoadSubpass[ai] = si
 			qei.subpasses[si].loadAttachments = append(
@@ -552,8 +817,8 @@ func (qei *queueExecutionState) beginRenderPass(ctx context.Context,
 		// TODO: handle preserveAttachments
 
 		for _, viewObj := range fb.ImageAttachments().All() {
-			if read(ctx, bh, vb.toVkHandle(uint64(viewObj.VulkanHandle()))) {
-				read(ctx, bh, vb.toVkHandle(uint64(viewObj.Image().VulkanHandle())))
+			if vb.read(ctx, bh, vb.toVkHandle(uint64(viewObj.VulkanHandle()))) {
+				vb.read(ctx, bh, vb.toVkHandle(uint64(viewObj.Image().VulkanHandle())))
 			}
 		}
 
@@ -579,7 +844,8 @@ func (qei *queueExecutionState) beginRenderPass(ctx context.Context,
 			if dsAi != vkAttachmentUnused {
 				viewObj := fb.ImageAttachments().Get(dsAi)
 				imgObj := viewObj.Image()
-				imgLayout, imgData := vb.getImageLayoutAndData(ctx, bh, imgObj.VulkanHandle())
+				imgLayout, imgData := vb.getImageSubresourceLayoutAndData(ctx, bh,
+					imgObj.VulkanHandle(), viewObj.SubresourceRange())
 				attDesc := rp.AttachmentDescriptions().Get(dsAi)
 				fullImageData := false
 				switch viewObj.Type() {
@@ -597,7 +863,23 @@ func (qei *queueExecutionState) beginRenderPass(ctx context.Context,
 					}
 				}
 				qei.subpasses[subpass].depthStencilAttachment = &subpassAttachmentInfo{
-					fullImageData, imgData, imgLayout, attDesc}
+					fullImageData, imgData, imgLayout, attDesc, dsAi}
+			}
+		}
+		if !desc.DepthStencilResolveAttachment().IsNil() {
+			dsrAi := desc.DepthStencilResolveAttachment().Attachment()
+			if dsrAi != vkAttachmentUnused {
+				qei.subpasses[subpass].depthStencilResolveAttachment = recordAttachment(dsrAi, subpass)
+			}
+		}
+		if !desc.FragmentShadingRateAttachment().IsNil() {
+			srAi := desc.FragmentShadingRateAttachment().Attachment()
+			if srAi != vkAttachmentUnused {
+				viewObj := fb.ImageAttachments().Get(srAi)
+				imgLayout, imgData := vb.getImageSubresourceLayoutAndData(ctx, bh,
+					viewObj.Image().VulkanHandle(), viewObj.SubresourceRange())
+				qei.subpasses[subpass].shadingRateAttachment = &subpassAttachmentInfo{
+					false, imgData, imgLayout, rp.AttachmentDescriptions().Get(srAi), srAi}
 			}
 		}
 	}
@@ -617,6 +899,7 @@ func (qei *queueExecutionState) endRenderPass(ctx context.Context,
 	ft *dependencygraph.Footprint, bh *dependencygraph.Behavior,
 	sc submittedCommand) {
 	qei.endSubpass(ctx, ft, bh, sc)
+	qei.renderPass = VkRenderPass(0)
 }
 
 type renderpass struct {
@@ -628,6 +911,8 @@ type commandBuffer struct {
 	begin           *label
 	end             *label
 	renderPassBegin *label
+	// descriptor sets bound by the recorded commands
+	descriptorSets map[VkDescriptorSet]struct{}
 }
 
 type resBinding struct {
@@ -675,33 +960,33 @@ func (bd *resBinding) duplicate() memBinding {
 	return &newB
 }
 
-func newResBinding(ctx context.Context, bh *dependencygraph.Behavior,
+func newResBinding(ctx context.Context, vb *FootprintBuilder, bh *dependencygraph.Behavior,
 	resOffset, size uint64, res dependencygraph.DefUseVariable) *resBinding {
 	d := &resBinding{resourceOffset: resOffset, bindSize: size, backingData: res}
 	if bh != nil {
-		write(ctx, bh, d)
+		vb.write(ctx, bh, d)
 	}
 	return d
 }
 
 func newSpanResBinding(ctx context.Context, vb *FootprintBuilder, bh *dependencygraph.Behavior,
 	memory VkDeviceMemory, resOffset, size, memoryOffset uint64) *resBinding {
-	return newResBinding(ctx, bh, resOffset, size, vb.newMemorySpan(memory, memoryOffset, size))
+	return newResBinding(ctx, vb, bh, resOffset, size, vb.newMemorySpan(memory, memoryOffset, size))
 }
 
-func newNonSpanResBinding(ctx context.Context, bh *dependencygraph.Behavior,
-	size uint64) *resBinding {
-	return newResBinding(ctx, bh, 0, size, newLabel())
+func newNonSpanResBinding(ctx context.Context, vb *FootprintBuilder,
+	bh *dependencygraph.Behavior, size uint64) *resBinding {
+	return newResBinding(ctx, vb, bh, 0, size, vb.labels.newLabel())
 }
 
-func (bd *resBinding) newSubBinding(ctx context.Context,
+func (bd *resBinding) newSubBinding(ctx context.Context, vb *FootprintBuilder,
 	bh *dependencygraph.Behavior, offset, size uint64) (*resBinding, error) {
 	subBinding, _ := bd.duplicate().(*resBinding)
 	if err := subBinding.shrink(offset, size); err != nil {
 		return nil, err
 	}
 	if bh != nil {
-		write(ctx, bh, subBinding)
+		vb.write(ctx, bh, subBinding)
 	}
 	return subBinding, nil
 }
@@ -737,7 +1022,7 @@ func addResBinding(ctx context.Context, l resBindingList, b *resBinding) resBind
 	return resBindingList(ml)
 }
 
-func (l resBindingList) getSubBindingList(ctx context.Context,
+func (l resBindingList) getSubBindingList(ctx context.Context, vb *FootprintBuilder,
 	bh *dependencygraph.Behavior, offset, size uint64) resBindingList {
 	subBindings := resBindingList{}
 	if offset+size < offset {
@@ -760,9 +1045,9 @@ func (l resBindingList) getSubBindingList(ctx context.Context,
 				end = offset + size
 			}
 			if bh != nil {
-				read(ctx, bh, bl[i])
+				vb.read(ctx, bh, bl[i])
 			}
-			newB, err := bl[i].newSubBinding(ctx, bh, start-bl[i].span().Start, end-start)
+			newB, err := bl[i].newSubBinding(ctx, vb, bh, start-bl[i].span().Start, end-start)
 			if err != nil {
 				log.E(ctx, "FootprintBuilder: %s", err.Error())
 			}
@@ -774,10 +1059,10 @@ func (l resBindingList) getSubBindingList(ctx context.Context,
 	return subBindings
 }
 
-func (l resBindingList) getBoundData(ctx context.Context,
+func (l resBindingList) getBoundData(ctx context.Context, vb *FootprintBuilder,
 	bh *dependencygraph.Behavior, offset, size uint64) []dependencygraph.DefUseVariable {
 	data := []dependencygraph.DefUseVariable{}
-	bindingList := l.getSubBindingList(ctx, bh, offset, size)
+	bindingList := l.getSubBindingList(ctx, vb, bh, offset, size)
 	for _, b := range bindingList.resBindings() {
 		if b == nil {
 			// skip invalid bindings
@@ -791,7 +1076,8 @@ func (l resBindingList) getBoundData(ctx context.Context,
 type descriptor struct {
 	ty VkDescriptorType
 	// for image descriptor
-	img VkImage
+	view VkImageView
+	img  VkImage
 	// only used for sampler and sampler combined descriptors
 	sampler *vkHandle
 	// for buffer descriptor
@@ -810,31 +1096,81 @@ func (dp *descriptor) SetDefBehavior(b *dependencygraph.Behavior) {
 }
 
 type descriptorSet struct {
-	descriptors            api.SubCmdIdxTrie
-	descriptorCounts       map[uint64]uint64 // binding -> descriptor count of that binding
+	descriptors      api.SubCmdIdxTrie
+	descriptorCounts map[uint64]uint64 // binding -> descriptor count of that binding
+	// the bindings of dynamic buffer descriptors in the layout of the set, and
+	// the number of their descriptors, which is the number of dynamic offsets
+	// consumed by the set, whether the descriptors are written or not.
+	dynamicBindings        map[uint64]struct{}
 	dynamicDescriptorCount uint64
+	// whether the layout of the set has update-after-bind bindings, so the
+	// descriptors may be updated after the set is bound.
+	updateAfterBind bool
 }
 
 func newDescriptorSet() *descriptorSet {
 	return &descriptorSet{
 		descriptors:            api.SubCmdIdxTrie{},
 		descriptorCounts:       map[uint64]uint64{},
+		dynamicBindings:        map[uint64]struct{}{},
 		dynamicDescriptorCount: uint64(0),
 	}
 }
 
-func (ds *descriptorSet) reserveDescriptor(bi, di uint64) {
+// isDynamicDescriptorType returns true if the descriptors of the type consume
+// a dynamic offset.
+func isDynamicDescriptorType(ty VkDescriptorType) bool {
+	return ty == VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_BUFFER_DYNAMIC ||
+		ty == VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER_DYNAMIC
+}
+
+// sortedBindings returns the binding numbers of the descriptor set in
+// ascending order, which is the order the dynamic offsets are consumed in.
+func (ds *descriptorSet) sortedBindings() []uint64 {
+	bindings := make([]uint64, 0, len(ds.descriptorCounts))
+	for bi := range ds.descriptorCounts {
+		bindings = append(bindings, bi)
+	}
+	sort.Slice(bindings, func(i, j int) bool { return bindings[i] < bindings[j] })
+	return bindings
+}
+
+// snapshot returns a copy of the descriptor set with the current descriptors,
+// so that later updates to the descriptor set do not affect the copy.
+func (ds *descriptorSet) snapshot() *descriptorSet {
+	c := newDescriptorSet()
+	c.dynamicDescriptorCount = ds.dynamicDescriptorCount
+	c.updateAfterBind = ds.updateAfterBind
+	for bi := range ds.dynamicBindings {
+		c.dynamicBindings[bi] = struct{}{}
+	}
+	for bi, count := range ds.descriptorCounts {
+		c.descriptorCounts[bi] = count
+		for di := uint64(0); di < count; di++ {
+			if v := ds.descriptors.Value([]uint64{bi, di}); v != nil {
+				c.descriptors.SetValue([]uint64{bi, di}, v)
+			}
+		}
+	}
+	return c
+}
+
+func (ds *descriptorSet) reserveDescriptor(bi, di uint64, ty VkDescriptorType) {
 	if _, ok := ds.descriptorCounts[bi]; !ok {
 		ds.descriptorCounts[bi] = uint64(0)
 	}
 	ds.descriptorCounts[bi]++
+	if isDynamicDescriptorType(ty) {
+		ds.dynamicBindings[bi] = struct{}{}
+		ds.dynamicDescriptorCount++
+	}
 }
 
-func (ds *descriptorSet) getDescriptor(ctx context.Context,
+func (ds *descriptorSet) getDescriptor(ctx context.Context, vb *FootprintBuilder,
 	bh *dependencygraph.Behavior, bi, di uint64) *descriptor {
 	if v := ds.descriptors.Value([]uint64{bi, di}); v != nil {
 		if d, ok := v.(*descriptor); ok {
-			read(ctx, bh, d)
+			vb.read(ctx, bh, d)
 			return d
 		}
 		log.E(ctx, "FootprintBuilder: Not *descriptor type in descriptorSet: %v, with "+
@@ -844,42 +1180,41 @@ func (ds *descriptorSet) getDescriptor(ctx context.Context,
 	return nil
 }
 
-func (ds *descriptorSet) setDescriptor(ctx context.Context,
-	bh *dependencygraph.Behavior, bi, di uint64, ty VkDescriptorType,
+func (ds *descriptorSet) setDescriptor(ctx context.Context, vb *FootprintBuilder,
+	bh *dependencygraph.Behavior, bi, di uint64, ty VkDescriptorType, vkView VkImageView,
 	vkImg VkImage, sampler *vkHandle, vkBuf VkBuffer, boundOffset, rng VkDeviceSize) {
 	if v := ds.descriptors.Value([]uint64{bi, di}); v != nil {
-		if d, ok := v.(*descriptor); ok {
-			if d.ty == VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_BUFFER_DYNAMIC ||
-				d.ty == VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER_DYNAMIC {
-				ds.dynamicDescriptorCount--
-			}
-		} else {
+		if _, ok := v.(*descriptor); !ok {
 			log.E(ctx, "FootprintBuilder: Not *descriptor type in descriptorSet: %v, with "+
 				"binding: %v, array index: %v", *ds, bi, di)
 		}
 	}
-	d := &descriptor{ty: ty, img: vkImg, sampler: sampler, buf: vkBuf, bufOffset: boundOffset, bufRng: rng}
+	d := &descriptor{ty: ty, view: vkView, img: vkImg, sampler: sampler, buf: vkBuf, bufOffset: boundOffset, bufRng: rng}
 	ds.descriptors.SetValue([]uint64{bi, di}, d)
-    write(ctx, bh, d)
-	if ty == VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_BUFFER_DYNAMIC ||
-		ty == VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER_DYNAMIC {
-		ds.dynamicDescriptorCount++
-	}
+    vb.write(ctx, bh, d)
 }
 
 func (ds *descriptorSet) useDescriptors(ctx context.Context, vb *FootprintBuilder,
 	bh *dependencygraph.Behavior, dynamicOffsets []uint32) []dependencygraph.DefUseVariable {
 	modified := []dependencygraph.DefUseVariable{}
 	doi := 0
-	for binding, count := range ds.descriptorCounts {
-		for di := uint64(0); di < count; di++ {
-			d := ds.getDescriptor(ctx, bh, binding, di)
+	for _, binding := range ds.sortedBindings() {
+		_, dynamic := ds.dynamicBindings[binding]
+		for di := uint64(0); di < ds.descriptorCounts[binding]; di++ {
+			// The dynamic offsets are consumed by the dynamic descriptors of
+			// the layout, even if they are not written.
+			dynamicOffset := -1
+			if dynamic {
+				dynamicOffset = doi
+				doi++
+			}
+			d := ds.getDescriptor(ctx, vb, bh, binding, di)
 			if d != nil {
-				read(ctx, bh, d.sampler)
+				vb.read(ctx, bh, d.sampler)
 				switch d.ty {
 				case VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_IMAGE:
 					data := vb.getImageData(ctx, bh, d.img)
-					modify(ctx, bh, data...)
+					vb.modify(ctx, bh, data...)
 					modified = append(modified, data...)
 				case VkDescriptorType_VK_DESCRIPTOR_TYPE_SAMPLER:
 					// pass, as the sampler has been 'read' before the switch
@@ -887,18 +1222,17 @@ func (ds *descriptorSet) useDescriptors(ctx context.Context, vb *FootprintBuilde
 					VkDescriptorType_VK_DESCRIPTOR_TYPE_SAMPLED_IMAGE,
 					VkDescriptorType_VK_DESCRIPTOR_TYPE_INPUT_ATTACHMENT:
 					data := vb.getImageData(ctx, bh, d.img)
-					read(ctx, bh, data...)
+					vb.read(ctx, bh, data...)
 				case VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_BUFFER,
 					VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_TEXEL_BUFFER:
 					data := vb.getBufferData(ctx, bh, d.buf, uint64(d.bufOffset), uint64(d.bufRng))
-					modify(ctx, bh, data...)
+					vb.modify(ctx, bh, data...)
 					modified = append(modified, data...)
 				case VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_BUFFER_DYNAMIC:
-					if doi < len(dynamicOffsets) {
+					if dynamicOffset >= 0 && dynamicOffset < len(dynamicOffsets) {
 						data := vb.getBufferData(ctx, bh, d.buf,
-							uint64(dynamicOffsets[doi])+uint64(d.bufOffset), uint64(d.bufRng))
-						doi++
-						modify(ctx, bh, data...)
+							uint64(dynamicOffsets[dynamicOffset])+uint64(d.bufOffset), uint64(d.bufRng))
+						vb.modify(ctx, bh, data...)
 						modified = append(modified, data...)
 					} else {
 						log.E(ctx, "FootprintBuilder: DescriptorSet: %v has more dynamic descriptors than reserved dynamic offsets", *ds)
@@ -906,13 +1240,12 @@ func (ds *descriptorSet) useDescriptors(ctx context.Context, vb *FootprintBuilde
 				case VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER,
 					VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_TEXEL_BUFFER:
 					data := vb.getBufferData(ctx, bh, d.buf, uint64(d.bufOffset), uint64(d.bufRng))
-					read(ctx, bh, data...)
+					vb.read(ctx, bh, data...)
 				case VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER_DYNAMIC:
-					if doi < len(dynamicOffsets) {
+					if dynamicOffset >= 0 && dynamicOffset < len(dynamicOffsets) {
 						data := vb.getBufferData(ctx, bh, d.buf,
-							uint64(dynamicOffsets[doi])+uint64(d.bufOffset), uint64(d.bufRng))
-						doi++
-						read(ctx, bh, data...)
+							uint64(dynamicOffsets[dynamicOffset])+uint64(d.bufOffset), uint64(d.bufRng))
+						vb.read(ctx, bh, data...)
 					} else {
 						log.E(ctx, "FootprintBuilder: DescriptorSet: %v has more dynamic descriptors than reserved dynamic offsets", *ds)
 					}
@@ -946,19 +1279,20 @@ func (ds *descriptorSet) writeDescriptors(ctx context.Context,
 		for _, imageInfo := range write.PImageInfo().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
 			updateDstForOverflow()
 			sampler := vb.toVkHandle(0)
+			vkView := VkImageView(0)
 			vkImg := VkImage(0)
 			if write.DescriptorType() != VkDescriptorType_VK_DESCRIPTOR_TYPE_SAMPLER &&
-				read(ctx, bh, vb.toVkHandle(uint64(imageInfo.ImageView()))) {
-				vkView := imageInfo.ImageView()
+				vb.read(ctx, bh, vb.toVkHandle(uint64(imageInfo.ImageView()))) {
+				vkView = imageInfo.ImageView()
 				vkImg = GetState(s).ImageViews().Get(vkView).Image().VulkanHandle()
 			}
 			if (write.DescriptorType() == VkDescriptorType_VK_DESCRIPTOR_TYPE_SAMPLER ||
 				write.DescriptorType() == VkDescriptorType_VK_DESCRIPTOR_TYPE_COMBINED_IMAGE_SAMPLER) &&
-				read(ctx, bh, vb.toVkHandle(uint64(imageInfo.Sampler()))) {
+				vb.read(ctx, bh, vb.toVkHandle(uint64(imageInfo.Sampler()))) {
 				sampler = vb.toVkHandle(uint64(imageInfo.Sampler()))
 			}
-			ds.setDescriptor(ctx, bh, dstBinding, dstElm, write.DescriptorType(),
-				vkImg, sampler, VkBuffer(0), 0, 0)
+			ds.setDescriptor(ctx, vb, bh, dstBinding, dstElm, write.DescriptorType(),
+				vkView, vkImg, sampler, VkBuffer(0), 0, 0)
 			dstElm++
 		}
 	case VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER,
@@ -966,10 +1300,10 @@ func (ds *descriptorSet) writeDescriptors(ctx context.Context,
 		for _, bufferInfo := range write.PBufferInfo().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
 			updateDstForOverflow()
 			vkBuf := bufferInfo.Buffer()
-			read(ctx, bh, vb.toVkHandle(uint64(vkBuf)))
-			vb.buffers[vkBuf].getSubBindingList(ctx, bh, uint64(bufferInfo.Offset()), uint64(bufferInfo.Range()))
-			ds.setDescriptor(ctx, bh, dstBinding, dstElm, write.DescriptorType(), VkImage(0),
-				vb.toVkHandle(0), vkBuf, bufferInfo.Offset(), bufferInfo.Range())
+			vb.read(ctx, bh, vb.toVkHandle(uint64(vkBuf)))
+			vb.buffers[vkBuf].getSubBindingList(ctx, vb, bh, uint64(bufferInfo.Offset()), uint64(bufferInfo.Range()))
+			ds.setDescriptor(ctx, vb, bh, dstBinding, dstElm, write.DescriptorType(), VkImageView(0),
+				VkImage(0), vb.toVkHandle(0), vkBuf, bufferInfo.Offset(), bufferInfo.Range())
 			dstElm++
 		}
 	case VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_BUFFER_DYNAMIC,
@@ -977,28 +1311,28 @@ func (ds *descriptorSet) writeDescriptors(ctx context.Context,
 		for _, bufferInfo := range write.PBufferInfo().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
 			updateDstForOverflow()
 			vkBuf := bufferInfo.Buffer()
-			read(ctx, bh, vb.toVkHandle(uint64(vkBuf)))
-			vb.buffers[vkBuf].getSubBindingList(ctx, bh, uint64(bufferInfo.Offset()), uint64(bufferInfo.Range()))
-			ds.setDescriptor(ctx, bh, dstBinding, dstElm, write.DescriptorType(), VkImage(0),
-				vb.toVkHandle(0), vkBuf, bufferInfo.Offset(), bufferInfo.Range())
+			vb.read(ctx, bh, vb.toVkHandle(uint64(vkBuf)))
+			vb.buffers[vkBuf].getSubBindingList(ctx, vb, bh, uint64(bufferInfo.Offset()), uint64(bufferInfo.Range()))
+			ds.setDescriptor(ctx, vb, bh, dstBinding, dstElm, write.DescriptorType(), VkImageView(0),
+				VkImage(0), vb.toVkHandle(0), vkBuf, bufferInfo.Offset(), bufferInfo.Range())
 			dstElm++
 		}
 	case VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_TEXEL_BUFFER,
 		VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_TEXEL_BUFFER:
 		for _, vkBufView := range write.PTexelBufferView().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
 			updateDstForOverflow()
-			read(ctx, bh, vb.toVkHandle(uint64(vkBufView)))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(vkBufView)))
 			bufView := GetState(s).BufferViews().Get(vkBufView)
 			vkBuf := GetState(s).BufferViews().Get(vkBufView).Buffer().VulkanHandle()
-			ds.setDescriptor(ctx, bh, dstBinding, dstElm, write.DescriptorType(),
-				VkImage(0), vb.toVkHandle(0), vkBuf, bufView.Offset(), bufView.Range())
+			ds.setDescriptor(ctx, vb, bh, dstBinding, dstElm, write.DescriptorType(),
+				VkImageView(0), VkImage(0), vb.toVkHandle(0), vkBuf, bufView.Offset(), bufView.Range())
 			dstElm++
 		}
 	}
 }
 
 func (ds *descriptorSet) copyDescriptors(ctx context.Context,
-	cmd api.Cmd, s *api.GlobalState, bh *dependencygraph.Behavior,
+	cmd api.Cmd, s *api.GlobalState, vb *FootprintBuilder, bh *dependencygraph.Behavior,
 	srcDs *descriptorSet, copy VkCopyDescriptorSet) {
 	dstElm := uint64(copy.DstArrayElement())
 	srcElm := uint64(copy.SrcArrayElement())
@@ -1016,10 +1350,10 @@ func (ds *descriptorSet) copyDescriptors(ctx context.Context,
 	}
 	for i := uint64(0); i < uint64(copy.DescriptorCount()); i++ {
 		updateDstAndSrcForOverflow()
-		srcD := srcDs.getDescriptor(ctx, bh, srcBinding, srcElm)
+		srcD := srcDs.getDescriptor(ctx, vb, bh, srcBinding, srcElm)
 		if srcD != nil {
-			ds.setDescriptor(ctx, bh, dstBinding, dstElm, srcD.ty,
-				srcD.img, srcD.sampler, srcD.buf, srcD.bufOffset, srcD.bufRng)
+			ds.setDescriptor(ctx, vb, bh, dstBinding, dstElm, srcD.ty,
+				srcD.view, srcD.img, srcD.sampler, srcD.buf, srcD.bufOffset, srcD.bufRng)
 		}
 		srcElm++
 		dstElm++
@@ -1027,14 +1361,17 @@ func (ds *descriptorSet) copyDescriptors(ctx context.Context,
 }
 
 type boundDescriptorSet struct {
+	layout         VkPipelineLayout
+	vkSet          VkDescriptorSet
 	descriptorSet  *descriptorSet
 	dynamicOffsets []uint32
 	b              *dependencygraph.Behavior
 }
 
-func newBoundDescriptorSet(ctx context.Context, bh *dependencygraph.Behavior,
-	ds *descriptorSet, dynamicOffsets []uint32) *boundDescriptorSet {
-	bds := &boundDescriptorSet{descriptorSet: ds}
+func newBoundDescriptorSet(ctx context.Context, vb *FootprintBuilder, bh *dependencygraph.Behavior,
+	layout VkPipelineLayout, vkSet VkDescriptorSet, ds *descriptorSet,
+	dynamicOffsets []uint32) *boundDescriptorSet {
+	bds := &boundDescriptorSet{layout: layout, vkSet: vkSet, descriptorSet: ds}
 	bds.dynamicOffsets = make([]uint32, ds.dynamicDescriptorCount)
 	dOffsetCount := len(dynamicOffsets)
 	if len(bds.dynamicOffsets) < dOffsetCount {
@@ -1043,7 +1380,7 @@ func newBoundDescriptorSet(ctx context.Context, bh *dependencygraph.Behavior,
 	for i := 0; i < dOffsetCount; i++ {
 		bds.dynamicOffsets[i] = dynamicOffsets[i]
 	}
-	write(ctx, bh, bds)
+	vb.write(ctx, bh, bds)
 	return bds
 }
 
@@ -1063,7 +1400,7 @@ func newSparseImageMemoryBinding(ctx context.Context, vb *FootprintBuilder,
 	bh *dependencygraph.Behavior, memory VkDeviceMemory,
 	memoryOffset, size uint64) *sparseImageMemoryBinding {
 	b := &sparseImageMemoryBinding{backingData: vb.newMemorySpan(memory, memoryOffset, size)}
-	write(ctx, bh, b)
+	vb.write(ctx, bh, b)
 	return b
 }
 
@@ -1074,26 +1411,207 @@ func (simb *sparseImageMemoryBinding) SetDefBehavior(b *dependencygraph.Behavior
 	simb.b = b
 }
 
+// imageSubresourceLayouts contains one layout label for each subresource of
+// an image, by aspect bit in ascending order. The layout labels are kept in
+// slices rather than maps, so they are always visited in the same order.
+type imageSubresourceLayouts []aspectLayouts
+
+// aspectLayouts contains the layout labels of the subresources of an aspect of
+// an image, indexed by array layer and mip level.
+type aspectLayouts struct {
+	aspect VkImageAspectFlagBits
+	layers [][]*label
+}
+
 type imageLayoutAndData struct {
-	layout     *label
+	layouts    imageSubresourceLayouts
 	opaqueData resBindingList
 	sparseData map[VkImageAspectFlags]map[uint32]map[uint32]map[uint64]*sparseImageMemoryBinding
 }
 
-func newImageLayoutAndData(ctx context.Context,
-	bh *dependencygraph.Behavior) *imageLayoutAndData {
-	d := &imageLayoutAndData{layout: newLabel()}
+func newImageLayoutAndData(ctx context.Context, vb *FootprintBuilder,
+	bh *dependencygraph.Behavior, imgObj ImageObjectʳ) *imageLayoutAndData {
+	d := &imageLayoutAndData{}
 	d.sparseData = map[VkImageAspectFlags]map[uint32]map[uint32]map[uint64]*sparseImageMemoryBinding{}
-	write(ctx, bh, d.layout)
+	aspects := []VkImageAspectFlagBits{VkImageAspectFlagBits_VK_IMAGE_ASPECT_COLOR_BIT}
+	layerCount, levelCount := uint32(1), uint32(1)
+	if !imgObj.IsNil() {
+		aspects = unpackImageAspectFlags(imgObj.ImageAspect())
+		layerCount = imgObj.Info().ArrayLayers()
+		levelCount = imgObj.Info().MipLevels()
+	}
+	for _, aspect := range aspects {
+		layers := make([][]*label, layerCount)
+		for layer := range layers {
+			layers[layer] = make([]*label, levelCount)
+			for level := range layers[layer] {
+				layers[layer][level] = vb.labels.newLabel()
+				vb.write(ctx, bh, layers[layer][level])
+			}
+		}
+		d.layouts = append(d.layouts, aspectLayouts{aspect, layers})
+	}
 	return d
 }
 
+// allLayouts returns the layout labels of all the subresources of the image.
+func (d *imageLayoutAndData) allLayouts() []dependencygraph.DefUseVariable {
+	return d.layoutsInRange(VkImageAspectFlags(0xFFFFFFFF), 0, vkRemainingArrayLayers,
+		0, vkRemainingMipLevels)
+}
+
+// layoutsInRange returns the layout labels of the subresources covered by the
+// given aspects, array layers and mip levels. vkRemainingArrayLayers and
+// vkRemainingMipLevels can be used as the layer and level count to cover all
+// the remaining layers or levels.
+func (d *imageLayoutAndData) layoutsInRange(aspects VkImageAspectFlags,
+	baseLayer, layerCount, baseLevel, levelCount uint32) []dependencygraph.DefUseVariable {
+	inRange := func(i, base, count, remaining uint32) bool {
+		if i < base {
+			return false
+		}
+		return count == remaining || uint64(i) < uint64(base)+uint64(count)
+	}
+	ret := []dependencygraph.DefUseVariable{}
+	for _, a := range d.layouts {
+		if uint32(a.aspect)&uint32(aspects) == 0 {
+			continue
+		}
+		for layer, levels := range a.layers {
+			if !inRange(uint32(layer), baseLayer, layerCount, vkRemainingArrayLayers) {
+				continue
+			}
+			for level, l := range levels {
+				if !inRange(uint32(level), baseLevel, levelCount, vkRemainingMipLevels) {
+					continue
+				}
+				ret = append(ret, l)
+			}
+		}
+	}
+	return ret
+}
+
+// layoutsInSubresourceRange returns the layout labels of the subresources
+// covered by the given subresource range.
+func (d *imageLayoutAndData) layoutsInSubresourceRange(
+	rng VkImageSubresourceRange) []dependencygraph.DefUseVariable {
+	return d.layoutsInRange(rng.AspectMask(), rng.BaseArrayLayer(),
+		rng.LayerCount(), rng.BaseMipLevel(), rng.LevelCount())
+}
+
+// layoutsInSubresourceLayers returns the layout labels of the subresources
+// covered by the given subresource layers.
+func (d *imageLayoutAndData) layoutsInSubresourceLayers(
+	layers VkImageSubresourceLayers) []dependencygraph.DefUseVariable {
+	return d.layoutsInRange(layers.AspectMask(), layers.BaseArrayLayer(),
+		layers.LayerCount(), layers.MipLevel(), 1)
+}
+
+func unpackImageAspectFlags(flags VkImageAspectFlags) []VkImageAspectFlagBits {
+	bits := []VkImageAspectFlagBits{}
+	for b := uint32(1); b != 0 && b <= uint32(flags); b <<= 1 {
+		if uint32(flags)&b != 0 {
+			bits = append(bits, VkImageAspectFlagBits(b))
+		}
+	}
+	return bits
+}
+
 type memorySpanRecords struct {
 	records map[VkDeviceMemory]memorySpanList
+	// Device memories that are shared with other processes or APIs through
+	// external memory handles. Writes to such memories are always kept alive,
+	// as their consumers may not be in the capture. Each memory maps to the
+	// variable that bridges its accesses with the commands of the other APIs
+	// in the capture.
+	external map[VkDeviceMemory]dependencygraph.DefUseVariable
+	// The ranges of device memories bound to buffers and images, and the
+	// device memories each buffer or image is bound to.
+	bindings map[VkDeviceMemory][]resourceMemoryBinding
+	boundTo  map[uint64][]VkDeviceMemory
+	// The precision of the recorded memory spans.
+	granularity footprintGranularity
+}
+
+// footprintGranularity is the precision of the memory data tracked by the
+// FootprintBuilder. Coarser levels record fewer memory spans, so they take
+// less time and memory to build the footprint, but keep more commands alive.
+type footprintGranularity int
+
+const (
+	// footprintGranularityByteRange tracks the byte ranges accessed by each
+	// command.
+	footprintGranularityByteRange footprintGranularity = iota
+	// footprintGranularityBinding tracks the data of the whole range of each
+	// device memory bound to a buffer or an image.
+	footprintGranularityBinding
+	// footprintGranularityHandle tracks the data of each device memory as a
+	// whole.
+	footprintGranularityHandle
+)
+
+// trackedSpan returns the range of the device memory tracked for the given
+// memory span at the granularity of the records.
+func (r *memorySpanRecords) trackedSpan(s *memorySpan) interval.U64Span {
+	if r.granularity == footprintGranularityHandle {
+		return interval.U64Span{Start: 0, End: ^uint64(0)}
+	}
+	return s.span()
+}
+
+// resourceMemoryBinding records the range of a device memory bound to a
+// buffer or an image.
+type resourceMemoryBinding struct {
+	handle uint64
+	span   interval.U64Span
+}
+
+// bindResource records the binding of the given buffer or image to the given
+// range of the device memory, and returns the handles of the other buffers and
+// images bound to overlapping ranges of the same device memory.
+func (r *memorySpanRecords) bindResource(mem VkDeviceMemory, handle, offset,
+	size uint64) []uint64 {
+	sp := interval.U64Span{Start: offset, End: offset + size}
+	if sp.End < sp.Start {
+		// overflow
+		sp.End = vkWholeSize
+	}
+	aliased := []uint64{}
+	for _, b := range r.bindings[mem] {
+		if b.handle != handle && b.span.Start < sp.End && sp.Start < b.span.End {
+			aliased = append(aliased, b.handle)
+		}
+	}
+	r.bindings[mem] = append(r.bindings[mem], resourceMemoryBinding{handle, sp})
+	r.boundTo[handle] = append(r.boundTo[handle], mem)
+	return aliased
+}
+
+// unbindResource removes all the memory bindings of the given buffer or
+// image.
+func (r *memorySpanRecords) unbindResource(handle uint64) {
+	for _, mem := range r.boundTo[handle] {
+		kept := []resourceMemoryBinding{}
+		for _, b := range r.bindings[mem] {
+			if b.handle != handle {
+				kept = append(kept, b)
+			}
+		}
+		r.bindings[mem] = kept
+	}
+	delete(r.boundTo, handle)
 }
 
 // FootprintBuilder implements the FootprintBuilder interface and builds
 // Footprint for Vulkan commands.
+//
+// The footprint is built serially, one command at a time. The recording
+// behaviors of different command buffers can not be built on worker
+// goroutines yet: the command arguments must be read from the state right
+// after the command is mutated; the handles, images, buffers and memory span
+// records are shared by all the command buffers; and writing a memory span
+// updates the records in place, so the order of the writes matters.
 type FootprintBuilder struct {
 	// handles
 	handles map[uint64]*vkHandle
@@ -1109,22 +1627,79 @@ type FootprintBuilder struct {
 	fences           map[VkFence]*fence
 	events           map[VkEvent]*event
 	querypools       map[VkQueryPool]*queryPool
+	profilingLocks   map[VkDevice]*label
+	pipelineCaches   map[VkPipelineCache]*pipelineCache
 	commandBuffers   map[VkCommandBuffer]*commandBuffer
 	images           map[VkImage]*imageLayoutAndData
 	buffers          map[VkBuffer]resBindingList
 	descriptorSets   map[VkDescriptorSet]*descriptorSet
 
+	// descriptor sets allocated from each descriptor pool
+	descriptorPools map[VkDescriptorPool]map[VkDescriptorSet]struct{}
+
+	// descriptor set layouts created with update-after-bind bindings
+	updateAfterBindLayouts map[VkDescriptorSetLayout]struct{}
+
+	// labels of the queue family ownership transfers of buffers and images
+	ownershipTransfers map[ownershipTransfer]*label
+
+	// memory requirements queried for images and buffers, keyed by the
+	// image or buffer handles.
+	memoryRequirements map[uint64]*label
+
+	// video sessions and the content of video session parameters
+	videoSessions          map[VkVideoSessionKHR]*videoSession
+	videoSessionParameters map[VkVideoSessionParametersKHR]*label
+
 	// execution info
 	executionStates map[VkQueue]*queueExecutionState
 	submitInfos     map[api.CmdID] /*ID of VkQueueSubmit*/ *queueSubmitInfo
 	submitIDs       map[*VkQueueSubmit]api.CmdID
+	// ranges of the vertices referenced by the indexed draws, read when the
+	// draws are executed, indexed by the full indices of the draws.
+	indexedVertexRanges api.SubCmdIdxTrie
 
 	// presentation info
-	swapchainImageAcquired  map[VkSwapchainKHR][]*label
-	swapchainImagePresented map[VkSwapchainKHR][]*label
+	swapchains map[VkSwapchainKHR]*swapchainImages
+	// presentations of the swapchain images, only recorded when the capture
+	// is analyzed.
+	frames *frameBoundaries
 
 	// memory
 	deviceMemoryRecords *memorySpanRecords
+
+	// The info recorded for the analysis of the capture, only recorded when
+	// the capture is analyzed: the roll-out of the submitted commands, the
+	// bound pipeline states at the submitted commands, the lifetimes of the
+	// objects of the handles that can be followed, the layouts of the image
+	// subresources, the uses of the resources, and the analyses of the
+	// barriers and of the lint rules.
+	rollOut      *rollOutTrace
+	boundStates  *boundStateRecorder
+	lifetimes    *handleLifetimeRecorder
+	imageLayouts *imageLayoutsRecorder
+	resourceUses *resourceUseRecorder
+	barriers     *barrierAnalyzer
+	lint         *lintAnalyzer
+
+	// the observers of the reads and writes of the variables, empty unless
+	// the capture is analyzed.
+	observers []footprintObserver
+
+	// labels
+	labels *labelAllocator
+
+	// behaviors
+	behaviors *dependencygraph.BehaviorAllocator
+
+	// the precision of the tracked memory data
+	granularity footprintGranularity
+}
+
+// footprintObserver is notified of the reads and writes of the variables by
+// the behaviors, in the order the FootprintBuilder emits them.
+type footprintObserver interface {
+	access(bh *dependencygraph.Behavior, write bool, c dependencygraph.DefUseVariable)
 }
 
 // toVkHandle takes the handle value in uint64, check if the build has seen
@@ -1147,34 +1722,82 @@ func (vb *FootprintBuilder) newMemorySpan(mem VkDeviceMemory, offset, size uint6
 }
 
 // getImageData records a read operation of the Vulkan image handle, a read
-// operation of the image layout, a read operation of the image bindings, then
-// returns the underlying data.
+// operation of the layouts of all the image subresources, a read operation of
+// the image bindings, then returns the underlying data.
 func (vb *FootprintBuilder) getImageData(ctx context.Context,
 	bh *dependencygraph.Behavior, vkImg VkImage) []dependencygraph.DefUseVariable {
 	if bh != nil {
-		if !read(ctx, bh, vb.toVkHandle(uint64(vkImg))) {
-			return []dependencygraph.DefUseVariable{}
-		}
-		if !read(ctx, bh, vb.images[vkImg].layout) {
+		if !vb.read(ctx, bh, vb.toVkHandle(uint64(vkImg))) {
 			return []dependencygraph.DefUseVariable{}
 		}
 	}
 	if vb.images[vkImg] == nil {
 		return []dependencygraph.DefUseVariable{}
 	}
-	data := vb.images[vkImg].opaqueData.getBoundData(ctx, bh, 0, vkWholeSize)
+	if bh != nil {
+		vb.read(ctx, bh, vb.images[vkImg].allLayouts()...)
+	}
+	return vb.getImageBoundData(ctx, bh, vkImg)
+}
+
+// getImageSubresourceData records a read operation of the Vulkan image
+// handle, a read operation of the layouts of the image subresources covered
+// by the given subresource layers, a read operation of the image bindings,
+// then returns the underlying data.
+func (vb *FootprintBuilder) getImageSubresourceData(ctx context.Context,
+	bh *dependencygraph.Behavior, vkImg VkImage,
+	layers ...VkImageSubresourceLayers) []dependencygraph.DefUseVariable {
+	if !vb.read(ctx, bh, vb.toVkHandle(uint64(vkImg))) {
+		return []dependencygraph.DefUseVariable{}
+	}
+	if vb.images[vkImg] == nil {
+		return []dependencygraph.DefUseVariable{}
+	}
+	for _, l := range layers {
+		vb.read(ctx, bh, vb.images[vkImg].layoutsInSubresourceLayers(l)...)
+	}
+	return vb.getImageBoundData(ctx, bh, vkImg)
+}
+
+// getImageSubresourceRangeData is the same as getImageSubresourceData, except
+// that the image subresources are specified with subresource ranges.
+func (vb *FootprintBuilder) getImageSubresourceRangeData(ctx context.Context,
+	bh *dependencygraph.Behavior, vkImg VkImage,
+	rngs ...VkImageSubresourceRange) []dependencygraph.DefUseVariable {
+	if !vb.read(ctx, bh, vb.toVkHandle(uint64(vkImg))) {
+		return []dependencygraph.DefUseVariable{}
+	}
+	if vb.images[vkImg] == nil {
+		return []dependencygraph.DefUseVariable{}
+	}
+	for _, r := range rngs {
+		vb.read(ctx, bh, vb.images[vkImg].layoutsInSubresourceRange(r)...)
+	}
+	return vb.getImageBoundData(ctx, bh, vkImg)
+}
+
+// getImageBoundData records a read operation of the image bindings, then
+// returns the underlying data.
+func (vb *FootprintBuilder) getImageBoundData(ctx context.Context,
+	bh *dependencygraph.Behavior, vkImg VkImage) []dependencygraph.DefUseVariable {
+	data := vb.images[vkImg].opaqueData.getBoundData(ctx, vb, bh, 0, vkWholeSize)
 	for _, aspecti := range vb.images[vkImg].sparseData {
 		for _, layeri := range aspecti {
 			for _, leveli := range layeri {
 				for _, blocki := range leveli {
 					if bh != nil {
-						read(ctx, bh, blocki)
+						vb.read(ctx, bh, blocki)
 					}
 					data = append(data, blocki.backingData)
 				}
 			}
 		}
 	}
+	if vb.resourceUses != nil {
+		vb.resourceUses.tag(uint64(vkImg), false, data...)
+		vb.resourceUses.tag(uint64(vkImg), true, vb.images[vkImg].allLayouts()...)
+	}
+	vb.lint.tagImage(vkImg, data...)
 	return data
 }
 
@@ -1185,8 +1808,13 @@ func (vb *FootprintBuilder) getImageData(ctx context.Context,
 // by swapchains.
 func (vb *FootprintBuilder) getImageOpaqueData(ctx context.Context,
 	bh *dependencygraph.Behavior, vkImg VkImage, offset, size uint64) []dependencygraph.DefUseVariable {
-	read(ctx, bh, vb.toVkHandle(uint64(vkImg)))
-	data := vb.images[vkImg].opaqueData.getBoundData(ctx, bh, offset, size)
+	if vb.granularity != footprintGranularityByteRange {
+		offset, size = 0, vkWholeSize
+	}
+	vb.read(ctx, bh, vb.toVkHandle(uint64(vkImg)))
+	data := vb.images[vkImg].opaqueData.getBoundData(ctx, vb, bh, offset, size)
+	vb.resourceUses.tag(uint64(vkImg), false, data...)
+	vb.lint.tagImage(vkImg, data...)
 	return data
 }
 
@@ -1215,11 +1843,26 @@ func (vb *FootprintBuilder) getSparseImageBindData(ctx context.Context,
 
 // getImageLayoutAndData records a read operation of the Vulkan handle, a read
 // operation of the image binding, but not the image layout. Then returns the
-// image layout label and underlying data.
+// layout labels of all the image subresources and underlying data.
 func (vb *FootprintBuilder) getImageLayoutAndData(ctx context.Context,
-	bh *dependencygraph.Behavior, vkImg VkImage) (*label, []dependencygraph.DefUseVariable) {
-	read(ctx, bh, vb.toVkHandle(uint64(vkImg)))
-	return vb.images[vkImg].layout, vb.getImageData(ctx, bh, vkImg)
+	bh *dependencygraph.Behavior, vkImg VkImage) ([]dependencygraph.DefUseVariable, []dependencygraph.DefUseVariable) {
+	if !vb.read(ctx, bh, vb.toVkHandle(uint64(vkImg))) || vb.images[vkImg] == nil {
+		return []dependencygraph.DefUseVariable{}, []dependencygraph.DefUseVariable{}
+	}
+	return vb.images[vkImg].allLayouts(), vb.getImageBoundData(ctx, bh, vkImg)
+}
+
+// getImageSubresourceLayoutAndData records a read operation of the Vulkan
+// handle, a read operation of the image binding, but not the image layout.
+// Then returns the layout labels of the image subresources covered by the
+// given subresource range and underlying data.
+func (vb *FootprintBuilder) getImageSubresourceLayoutAndData(ctx context.Context,
+	bh *dependencygraph.Behavior, vkImg VkImage,
+	rng VkImageSubresourceRange) ([]dependencygraph.DefUseVariable, []dependencygraph.DefUseVariable) {
+	if !vb.read(ctx, bh, vb.toVkHandle(uint64(vkImg))) || vb.images[vkImg] == nil {
+		return []dependencygraph.DefUseVariable{}, []dependencygraph.DefUseVariable{}
+	}
+	return vb.images[vkImg].layoutsInSubresourceRange(rng), vb.getImageBoundData(ctx, bh, vkImg)
 }
 
 func (vb *FootprintBuilder) addOpaqueImageMemBinding(ctx context.Context,
@@ -1227,12 +1870,13 @@ func (vb *FootprintBuilder) addOpaqueImageMemBinding(ctx context.Context,
 	size, memOffset uint64) {
 	vb.images[vkImg].opaqueData = addResBinding(ctx, vb.images[vkImg].opaqueData,
 		newSpanResBinding(ctx, vb, bh, vkMem, resOffset, size, memOffset))
+	vb.bindAliasedMemory(ctx, bh, uint64(vkImg), vkMem, memOffset, size)
 }
 
 func (vb *FootprintBuilder) addSwapchainImageMemBinding(ctx context.Context,
 	bh *dependencygraph.Behavior, vkImg VkImage) {
 	vb.images[vkImg].opaqueData = addResBinding(ctx, vb.images[vkImg].opaqueData,
-		newNonSpanResBinding(ctx, bh, vkWholeSize))
+		newNonSpanResBinding(ctx, vb, bh, vkWholeSize))
 }
 
 // Traverse through the blocks covered by the given bind.
@@ -1292,11 +1936,17 @@ func (vb *FootprintBuilder) addSparseImageMemBinding(ctx context.Context,
 func (vb *FootprintBuilder) getBufferData(ctx context.Context,
 	bh *dependencygraph.Behavior, vkBuf VkBuffer,
 	offset, size uint64) []dependencygraph.DefUseVariable {
-	read(ctx, bh, vb.toVkHandle(uint64(vkBuf)))
+	if vb.granularity != footprintGranularityByteRange {
+		offset, size = 0, vkWholeSize
+	}
+	vb.read(ctx, bh, vb.toVkHandle(uint64(vkBuf)))
 	for _, bb := range vb.buffers[vkBuf].resBindings() {
-		read(ctx, bh, bb)
+		vb.read(ctx, bh, bb)
 	}
-	return vb.buffers[vkBuf].getBoundData(ctx, bh, offset, size)
+	data := vb.buffers[vkBuf].getBoundData(ctx, vb, bh, offset, size)
+	vb.resourceUses.tag(uint64(vkBuf), false, data...)
+	vb.lint.tagBuffer(vkBuf, data...)
+	return data
 }
 
 func (vb *FootprintBuilder) addBufferMemBinding(ctx context.Context,
@@ -1304,15 +1954,100 @@ func (vb *FootprintBuilder) addBufferMemBinding(ctx context.Context,
 	vkMem VkDeviceMemory, resOffset, size, memOffset uint64) {
 	vb.buffers[vkBuf] = addResBinding(ctx, vb.buffers[vkBuf],
 		newSpanResBinding(ctx, vb, bh, vkMem, resOffset, size, memOffset))
+	vb.bindAliasedMemory(ctx, bh, uint64(vkBuf), vkMem, memOffset, size)
+}
+
+// bindAliasedMemory records the binding of the given buffer or image to the
+// given range of the device memory. The data of the resources bound to
+// overlapping ranges are shared through the memory spans, so writes to one
+// resource are seen by the reads of the others. In addition, the binding
+// modifies the aliasing resources, as their content is no longer defined only
+// by their own writes.
+func (vb *FootprintBuilder) bindAliasedMemory(ctx context.Context,
+	bh *dependencygraph.Behavior, handle uint64, vkMem VkDeviceMemory,
+	memOffset, size uint64) {
+	for _, aliased := range vb.deviceMemoryRecords.bindResource(vkMem, handle, memOffset, size) {
+		debug(ctx, "Resource: %v aliases resource: %v in memory: %v", handle, aliased, vkMem)
+		vb.modify(ctx, bh, vb.toVkHandle(aliased))
+		vb.modify(ctx, bh, vb.toVkHandle(handle))
+	}
+}
+
+// shareExternalMemory records the given device memory as being shared through
+// external memory handles. The whole allocation is written by the given
+// behavior, as its content may be modified outside of the capture at any
+// time, and the behavior is kept alive.
+func (vb *FootprintBuilder) shareExternalMemory(ctx context.Context,
+	bh *dependencygraph.Behavior, s *api.GlobalState,
+	ft *dependencygraph.Footprint, vkMem VkDeviceMemory) {
+	memObj := GetState(s).DeviceMemories().Get(vkMem)
+	if memObj.IsNil() {
+		return
+	}
+	vb.deviceMemoryRecords.external[vkMem] = ft.SharedVariable(
+		dependencygraph.ExternalMemory(uint64(vkMem)))
+	vb.write(ctx, bh, vb.newMemorySpan(vkMem, 0, uint64(memObj.AllocationSize())))
+	bh.Alive = true
+}
+
+// importSemaphore records the replacement of the payload of the given
+// semaphore with a payload imported from an external handle.
+func (vb *FootprintBuilder) importSemaphore(ctx context.Context,
+	bh *dependencygraph.Behavior, vkSp VkSemaphore) {
+	if vb.read(ctx, bh, vb.toVkHandle(uint64(vkSp))) {
+		if _, ok := vb.semaphoreSignals[vkSp]; ok {
+			vb.write(ctx, bh, vb.semaphoreSignals[vkSp])
+		}
+	}
+	bh.Alive = true
+}
+
+// exportSemaphore records the export of the payload of the given semaphore to
+// an external handle. Exporting with copy transference unsignals the
+// semaphore, so the signal state is modified.
+func (vb *FootprintBuilder) exportSemaphore(ctx context.Context,
+	bh *dependencygraph.Behavior, vkSp VkSemaphore) {
+	if vb.read(ctx, bh, vb.toVkHandle(uint64(vkSp))) {
+		if _, ok := vb.semaphoreSignals[vkSp]; ok {
+			vb.modify(ctx, bh, vb.semaphoreSignals[vkSp])
+		}
+	}
+	bh.Alive = true
+}
+
+// importFence records the replacement of the payload of the given fence with
+// a payload imported from an external handle.
+func (vb *FootprintBuilder) importFence(ctx context.Context,
+	bh *dependencygraph.Behavior, vkFe VkFence) {
+	if vb.read(ctx, bh, vb.toVkHandle(uint64(vkFe))) {
+		if _, ok := vb.fences[vkFe]; ok {
+			vb.write(ctx, bh, vb.fences[vkFe].signal)
+			vb.write(ctx, bh, vb.fences[vkFe].unsignal)
+		}
+	}
+	bh.Alive = true
+}
+
+// exportFence records the export of the payload of the given fence to an
+// external handle. Exporting with copy transference resets the fence.
+func (vb *FootprintBuilder) exportFence(ctx context.Context,
+	bh *dependencygraph.Behavior, vkFe VkFence) {
+	if vb.read(ctx, bh, vb.toVkHandle(uint64(vkFe))) {
+		if _, ok := vb.fences[vkFe]; ok {
+			vb.read(ctx, bh, vb.fences[vkFe].signal)
+			vb.write(ctx, bh, vb.fences[vkFe].unsignal)
+		}
+	}
+	bh.Alive = true
 }
 
 func (vb *FootprintBuilder) newCommand(ctx context.Context,
 	bh *dependencygraph.Behavior, vkCb VkCommandBuffer) *commandBufferCommand {
 	cbc := &commandBufferCommand{}
-	read(ctx, bh, vb.toVkHandle(uint64(vkCb)))
+	vb.read(ctx, bh, vb.toVkHandle(uint64(vkCb)))
 	if _, ok := vb.commandBuffers[vkCb]; ok {
-		read(ctx, bh, vb.commandBuffers[vkCb].begin)
-		write(ctx, bh, cbc)
+		vb.read(ctx, bh, vb.commandBuffers[vkCb].begin)
+		vb.write(ctx, bh, cbc)
 		vb.commands[vkCb] = append(vb.commands[vkCb], cbc)
 		return cbc
 	}
@@ -1320,24 +2055,41 @@ func (vb *FootprintBuilder) newCommand(ctx context.Context,
 }
 
 func newFootprintBuilder() *FootprintBuilder {
+	granularity := footprintGranularity(config.FootprintGranularity)
 	return &FootprintBuilder{
-		handles:                 map[uint64]*vkHandle{},
-		commands:                map[VkCommandBuffer][]*commandBufferCommand{},
-		mappedCoherentMemories:  map[VkDeviceMemory]DeviceMemoryObjectʳ{},
-		semaphoreSignals:        map[VkSemaphore]*label{},
-		fences:                  map[VkFence]*fence{},
-		events:                  map[VkEvent]*event{},
-		querypools:              map[VkQueryPool]*queryPool{},
-		commandBuffers:          map[VkCommandBuffer]*commandBuffer{},
-		images:                  map[VkImage]*imageLayoutAndData{},
-		buffers:                 map[VkBuffer]resBindingList{},
-		descriptorSets:          map[VkDescriptorSet]*descriptorSet{},
-		executionStates:         map[VkQueue]*queueExecutionState{},
-		submitInfos:             map[api.CmdID]*queueSubmitInfo{},
-		submitIDs:               map[*VkQueueSubmit]api.CmdID{},
-		swapchainImageAcquired:  map[VkSwapchainKHR][]*label{},
-		swapchainImagePresented: map[VkSwapchainKHR][]*label{},
-		deviceMemoryRecords:     &memorySpanRecords{records: map[VkDeviceMemory]memorySpanList{}},
+		handles:                map[uint64]*vkHandle{},
+		commands:               map[VkCommandBuffer][]*commandBufferCommand{},
+		mappedCoherentMemories: map[VkDeviceMemory]DeviceMemoryObjectʳ{},
+		semaphoreSignals:       map[VkSemaphore]*label{},
+		fences:                 map[VkFence]*fence{},
+		events:                 map[VkEvent]*event{},
+		querypools:             map[VkQueryPool]*queryPool{},
+		profilingLocks:         map[VkDevice]*label{},
+		pipelineCaches:         map[VkPipelineCache]*pipelineCache{},
+		memoryRequirements:     map[uint64]*label{},
+		videoSessions:          map[VkVideoSessionKHR]*videoSession{},
+		videoSessionParameters: map[VkVideoSessionParametersKHR]*label{},
+		commandBuffers:         map[VkCommandBuffer]*commandBuffer{},
+		images:                 map[VkImage]*imageLayoutAndData{},
+		buffers:                map[VkBuffer]resBindingList{},
+		descriptorSets:         map[VkDescriptorSet]*descriptorSet{},
+		descriptorPools:        map[VkDescriptorPool]map[VkDescriptorSet]struct{}{},
+		updateAfterBindLayouts: map[VkDescriptorSetLayout]struct{}{},
+		ownershipTransfers:     map[ownershipTransfer]*label{},
+		executionStates:        map[VkQueue]*queueExecutionState{},
+		submitInfos:            map[api.CmdID]*queueSubmitInfo{},
+		submitIDs:              map[*VkQueueSubmit]api.CmdID{},
+		swapchains:             map[VkSwapchainKHR]*swapchainImages{},
+		labels:                 &labelAllocator{},
+		behaviors:              &dependencygraph.BehaviorAllocator{},
+		granularity:            granularity,
+		deviceMemoryRecords: &memorySpanRecords{
+			records:     map[VkDeviceMemory]memorySpanList{},
+			external:    map[VkDeviceMemory]dependencygraph.DefUseVariable{},
+			bindings:    map[VkDeviceMemory][]resourceMemoryBinding{},
+			boundTo:     map[uint64][]VkDeviceMemory{},
+			granularity: granularity,
+		},
 	}
 }
 
@@ -1348,13 +2100,13 @@ func (vb *FootprintBuilder) rollOutExecuted(ctx context.Context,
 		submitID := executedFCI[0]
 		submitinfo := vb.submitInfos[api.CmdID(submitID)]
 		if !submitinfo.began {
-			bh := dependencygraph.NewBehavior(api.SubCmdIdx{submitID})
+			bh := vb.behaviors.NewBehavior(api.SubCmdIdx{submitID})
 			for _, sp := range submitinfo.waitSemaphores {
-				if read(ctx, bh, vb.toVkHandle(uint64(sp))) {
-					modify(ctx, bh, vb.semaphoreSignals[sp])
+				if vb.read(ctx, bh, vb.toVkHandle(uint64(sp))) {
+					vb.modify(ctx, bh, vb.semaphoreSignals[sp])
 				}
 			}
-			// write(ctx, bh, submitinfo.queued)
+			// vb.write(ctx, bh, submitinfo.queued)
 			ft.AddBehavior(ctx, bh)
 			submitinfo.began = true
 		}
@@ -1362,8 +2114,15 @@ func (vb *FootprintBuilder) rollOutExecuted(ctx context.Context,
 		if executedFCI.Equals(submittedCmd.id) {
 			execInfo := vb.executionStates[submitinfo.queue]
 			execInfo.currentSubmitInfo = submitinfo
-			execInfo.updateCurrentCommand(ctx, executedFCI)
-			submittedCmd.runCommand(ctx, ft, execInfo)
+			if execInfo.updateCurrentCommand(ctx, executedFCI) {
+				vb.boundStates.record(executedFCI, execInfo)
+				vb.barriers.begin(ft, submittedCmd)
+				vb.lint.begin(ft, submittedCmd)
+				submittedCmd.runCommand(ctx, ft, execInfo)
+				vb.lint.end()
+				vb.barriers.end()
+				vb.rollOut.record(submitinfo.queue, executedFCI)
+			}
 		} else {
 			log.E(ctx, "FootprintBuilder: Execution order differs from submission order. "+
 				"Index of executed command: %v, Index of submitted command: %v",
@@ -1376,24 +2135,126 @@ func (vb *FootprintBuilder) rollOutExecuted(ctx context.Context,
 		// After the last command of the submit, we need to add a behavior for
 		// semaphore and fence signaling.
 		if len(submitinfo.pendingCommands) == 0 {
-			bh := dependencygraph.NewBehavior(api.SubCmdIdx{
+			bh := vb.behaviors.NewBehavior(api.SubCmdIdx{
 				executedFCI[0]})
 			// add writes to the semaphores and fences
-			read(ctx, bh, submitinfo.queued)
-			write(ctx, bh, submitinfo.done)
+			vb.read(ctx, bh, submitinfo.queued)
+			vb.write(ctx, bh, submitinfo.done)
 			for _, sp := range submitinfo.signalSemaphores {
-				if read(ctx, bh, vb.toVkHandle(uint64(sp))) {
-					write(ctx, bh, vb.semaphoreSignals[sp])
+				if vb.read(ctx, bh, vb.toVkHandle(uint64(sp))) {
+					vb.write(ctx, bh, vb.semaphoreSignals[sp])
 				}
 			}
-			if read(ctx, bh, vb.toVkHandle(uint64(submitinfo.signalFence))) {
-				write(ctx, bh, vb.fences[submitinfo.signalFence].signal)
+			if vb.read(ctx, bh, vb.toVkHandle(uint64(submitinfo.signalFence))) {
+				vb.write(ctx, bh, vb.fences[submitinfo.signalFence].signal)
 			}
 			ft.AddBehavior(ctx, bh)
 		}
 	}
 }
 
+// getMemoryRequirements returns the label of the memory requirements of the
+// given image or buffer handle. The label is written by the commands that
+// query the memory requirements, and read by the commands that bind memory to
+// the image or buffer.
+func (vb *FootprintBuilder) getMemoryRequirements(handle uint64) *label {
+	if _, ok := vb.memoryRequirements[handle]; !ok {
+		vb.memoryRequirements[handle] = vb.labels.newLabel()
+	}
+	return vb.memoryRequirements[handle]
+}
+
+// writePipelineCache records the writes to the content of the given pipeline
+// cache by creating pipelines with it. Pipeline creation does not read the
+// content of the cache, as the created pipelines do not depend on it.
+func (vb *FootprintBuilder) writePipelineCache(ctx context.Context,
+	bh *dependencygraph.Behavior, vkCache VkPipelineCache) {
+	if !vb.read(ctx, bh, vb.toVkHandle(uint64(vkCache))) {
+		return
+	}
+	if pc, ok := vb.pipelineCaches[vkCache]; ok {
+		pc.contribute(ctx, vb, bh)
+	}
+}
+
+// getProfilingLock returns the label of the profiling lock of the given
+// device, which is acquired by vkAcquireProfilingLockKHR and released by
+// vkReleaseProfilingLockKHR.
+func (vb *FootprintBuilder) getProfilingLock(dev VkDevice) *label {
+	if _, ok := vb.profilingLocks[dev]; !ok {
+		vb.profilingLocks[dev] = vb.labels.newLabel()
+	}
+	return vb.profilingLocks[dev]
+}
+
+// resetQueriesOnHost records the behavior of resetting queries from the host,
+// i.e. by vkResetQueryPool or vkResetQueryPoolEXT. Unlike
+// vkCmdResetQueryPool, the reset takes effect immediately.
+func (vb *FootprintBuilder) resetQueriesOnHost(ctx context.Context,
+	bh *dependencygraph.Behavior, vkQp VkQueryPool, first, count uint32) {
+	if !vb.read(ctx, bh, vb.toVkHandle(uint64(vkQp))) {
+		return
+	}
+	qp, ok := vb.querypools[vkQp]
+	if !ok {
+		return
+	}
+	for i := first; i < first+count && int(i) < len(qp.queries); i++ {
+		vb.write(ctx, bh, qp.queries[i].reset, qp.queries[i].availability)
+	}
+}
+
+// submitCommandBuffer appends the commands recorded in the given command
+// buffer to the pending commands of the given submit info, with full command
+// indices prefixed by the given prefix. The commands in the command buffers
+// executed by vkCmdExecuteCommands are appended recursively, with the
+// vkCmdExecuteCommands being their parent command. Command buffers in
+// executing are tracked to avoid infinite recursion in case of malformed
+// captures. Returns true if any command is appended.
+func (vb *FootprintBuilder) submitCommandBuffer(ctx context.Context,
+	bh *dependencygraph.Behavior, submitInfo *queueSubmitInfo,
+	prefix api.SubCmdIdx, vkCb VkCommandBuffer, parent *commandBufferCommand,
+	executing map[VkCommandBuffer]struct{}) bool {
+	if _, ok := executing[vkCb]; ok {
+		log.E(ctx, "FootprintBuilder: Command buffer: %v executes itself, "+
+			"full command index: %v", vkCb, prefix)
+		return false
+	}
+	executing[vkCb] = struct{}{}
+	defer delete(executing, vkCb)
+	for vkSet := range vb.commandBuffers[vkCb].descriptorSets {
+		if _, ok := submitInfo.descriptorSets[vkSet]; ok {
+			continue
+		}
+		// Only the sets with update-after-bind bindings may be updated
+		// between their binding and the submission, the other sets are used
+		// as they are when the commands are executed.
+		if ds, ok := vb.descriptorSets[vkSet]; ok && ds.updateAfterBind {
+			submitInfo.descriptorSets[vkSet] = ds.snapshot()
+		}
+	}
+	hasCmd := false
+	for k, cbc := range vb.commands[vkCb] {
+		hasCmd = true
+		fci := append(append(api.SubCmdIdx{}, prefix...), uint64(k))
+		submitInfo.pendingCommands = append(submitInfo.pendingCommands,
+			newSubmittedCommand(fci, cbc, parent))
+		if cbc.isCmdExecuteCommands {
+			for scbi, scb := range cbc.secondaryCommandBuffers {
+				// In case of invalid secondary command buffer, stop traversing
+				// all the secondary command buffers
+				if _, ok := vb.commandBuffers[scb]; !ok {
+					break
+				}
+				vb.read(ctx, bh, vb.commandBuffers[scb].end)
+				vb.submitCommandBuffer(ctx, bh, submitInfo,
+					append(append(api.SubCmdIdx{}, fci...), uint64(scbi)), scb, cbc, executing)
+			}
+		}
+	}
+	return hasCmd
+}
+
 func (vb *FootprintBuilder) recordReadsWritesModifies(
 	ctx context.Context, ft *dependencygraph.Footprint, bh *dependencygraph.Behavior,
 	vkCb VkCommandBuffer, reads []dependencygraph.DefUseVariable,
@@ -1401,20 +2262,40 @@ func (vb *FootprintBuilder) recordReadsWritesModifies(
 	cbc := vb.newCommand(ctx, bh, vkCb)
 	cbc.behave = func(sc submittedCommand, execInfo *queueExecutionState) {
 		cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
-		read(ctx, cbh, reads...)
-		write(ctx, cbh, writes...)
-		modify(ctx, cbh, modifies...)
+		vb.read(ctx, cbh, reads...)
+		vb.write(ctx, cbh, writes...)
+		vb.modify(ctx, cbh, modifies...)
 		ft.AddBehavior(ctx, cbh)
 	}
 }
 
+// recordImageTransfer records the behavior of a command which reads the given
+// subresources of the source image and writes to the given subresources of
+// the destination image. If the destination image is overwritten, the data
+// of the destination image is written, otherwise it is modified.
+func (vb *FootprintBuilder) recordImageTransfer(ctx context.Context,
+	ft *dependencygraph.Footprint, bh *dependencygraph.Behavior,
+	vkCb VkCommandBuffer, srcImg, dstImg VkImage,
+	srcLayers, dstLayers []VkImageSubresourceLayers, overwritten bool) {
+	src := vb.getImageSubresourceData(ctx, bh, srcImg, srcLayers...)
+	dst := vb.getImageSubresourceData(ctx, bh, dstImg, dstLayers...)
+	if overwritten {
+		vb.recordReadsWritesModifies(
+			ctx, ft, bh, vkCb, src, dst, emptyDefUseVars)
+	} else {
+		vb.recordReadsWritesModifies(
+			ctx, ft, bh, vkCb, src, emptyDefUseVars, dst)
+	}
+}
+
 func (vb *FootprintBuilder) recordModifingDynamicStates(
 	ctx context.Context, ft *dependencygraph.Footprint, bh *dependencygraph.Behavior,
-	vkCb VkCommandBuffer) {
+	vkCb VkCommandBuffer, cmd api.Cmd) {
 	cbc := vb.newCommand(ctx, bh, vkCb)
 	cbc.behave = func(sc submittedCommand, execInfo *queueExecutionState) {
 		cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
-		modify(ctx, cbh, execInfo.currentCmdBufState.dynamicState)
+		vb.modify(ctx, cbh, execInfo.currentCmdBufState.dynamicState)
+		execInfo.currentCmdBufState.dynamicStateCmds[cmd.CmdName()] = cmd
 		ft.AddBehavior(ctx, cbh)
 	}
 }
@@ -1424,39 +2305,228 @@ func (vb *FootprintBuilder) useBoundDescriptorSets(ctx context.Context,
 	cmdBufState *commandBufferExecutionState) []dependencygraph.DefUseVariable {
 	modified := []dependencygraph.DefUseVariable{}
 	for _, bds := range cmdBufState.descriptorSets {
-		read(ctx, bh, bds)
+		vb.read(ctx, bh, bds)
 		ds := bds.descriptorSet
 		modified = append(modified, ds.useDescriptors(ctx, vb, bh, bds.dynamicOffsets)...)
 	}
 	return modified
 }
 
-func (vb *FootprintBuilder) draw(ctx context.Context,
-	bh *dependencygraph.Behavior, execInfo *queueExecutionState) {
-	read(ctx, bh, execInfo.subpass)
-	read(ctx, bh, execInfo.currentCmdBufState.pipeline)
-	read(ctx, bh, execInfo.currentCmdBufState.dynamicState)
-	subpassI := execInfo.subpass.val
-	for _, b := range execInfo.currentCmdBufState.vertexBufferResBindings {
-		read(ctx, bh, b.getBoundData(ctx, bh, 0, vkWholeSize)...)
-	}
-	modifiedDs := vb.useBoundDescriptorSets(ctx, bh, execInfo.currentCmdBufState)
-	execInfo.subpasses[execInfo.subpass.val].modifiedDescriptorData = append(
-		execInfo.subpasses[execInfo.subpass.val].modifiedDescriptorData,
-		modifiedDs...)
-	if execInfo.currentCmdBufState.indexBufferResBindings != nil {
-		read(ctx, bh, execInfo.currentCmdBufState.indexBufferResBindings.getBoundData(
-			ctx, bh, 0, vkWholeSize)...)
+// vertexInputSizes returns the sizes of the vertices fetched from each
+// binding by the given attributes: the end of the furthest attribute of the
+// binding. The bindings with an attribute of unknown format are not returned.
+func vertexInputSizes(ctx context.Context, s *api.GlobalState,
+	attributes U32ːVkVertexInputAttributeDescriptionᵐ) map[uint32]uint64 {
+	sizes := map[uint32]uint64{}
+	unknown := map[uint32]bool{}
+	for _, attribute := range attributes.All() {
+		info, err := subGetElementAndTexelBlockSize(ctx, nil, api.CmdNoID, nil, s, nil, 0, nil, nil, attribute.Fmt())
+		if err != nil {
+			unknown[attribute.Binding()] = true
+			continue
+		}
+		end := uint64(attribute.Offset()) + uint64(info.ElementSize())
+		if end > sizes[attribute.Binding()] {
+			sizes[attribute.Binding()] = end
+		}
 	}
-	for _, input := range execInfo.subpasses[subpassI].inputAttachments {
-		read(ctx, bh, input.data...)
+	for binding := range unknown {
+		delete(sizes, binding)
+	}
+	return sizes
+}
+
+// vertexBufferReadRange returns the offset and size of the data read from a
+// vertex buffer bound at bindOffset with the given binding description,
+// whose vertices are vertexSize bytes long, or 0 if unknown. The last vertex
+// may extend past the stride, so the whole buffer is returned if the fetched
+// range is unknown.
+func vertexBufferReadRange(desc VkVertexInputBindingDescription, bindOffset, vertexSize uint64,
+	firstVertex, vertexCount, firstInstance, instanceCount uint64) (uint64, uint64) {
+	first, count := firstVertex, vertexCount
+	if desc.InputRate() == VkVertexInputRate_VK_VERTEX_INPUT_RATE_INSTANCE {
+		first, count = firstInstance, instanceCount
+	}
+	stride := uint64(desc.Stride())
+	if count == vkWholeSize || stride == 0 || vertexSize == 0 {
+		return 0, vkWholeSize
+	}
+	if count == 0 {
+		return bindOffset + first*stride, 0
+	}
+	last := stride
+	if vertexSize > last {
+		last = vertexSize
+	}
+	return bindOffset + first*stride, (count-1)*stride + last
+}
+
+// draw records the reads of the vertex buffers, the index buffer and all the
+// states used by a draw command. The vertices and instances fetched by the
+// draw are given by the firstVertex, vertexCount, firstInstance and
+// instanceCount, a count of vkWholeSize means the range is unknown, e.g. for
+// indirect draws.
+func (vb *FootprintBuilder) draw(ctx context.Context,
+	bh *dependencygraph.Behavior, execInfo *queueExecutionState,
+	firstVertex, vertexCount, firstInstance, instanceCount uint64) {
+	cbState := execInfo.currentCmdBufState
+	for binding, b := range cbState.vertexBufferResBindings {
+		offset, size := uint64(0), vkWholeSize
+		if cbState.vertexInputBindings != nil {
+			desc, ok := cbState.vertexInputBindings[binding]
+			if !ok {
+				// The binding is not used by the bound pipeline.
+				continue
+			}
+			offset, size = vertexBufferReadRange(desc, cbState.vertexBufferOffsets[binding],
+				cbState.vertexSizes[binding], firstVertex, vertexCount, firstInstance, instanceCount)
+		}
+		vb.read(ctx, bh, b.getBoundData(ctx, vb, bh, offset, size)...)
+	}
+	if execInfo.currentCmdBufState.indexBufferResBindings != nil {
+		vb.read(ctx, bh, execInfo.currentCmdBufState.indexBufferResBindings.getBoundData(
+			ctx, vb, bh, 0, vkWholeSize)...)
+	}
+	vb.rasterize(ctx, bh, execInfo)
+}
+
+// rasterize records the reads of the current subpass, the bound pipeline,
+// the dynamic states and the bound descriptor sets, and the modifications of
+// the attachments of the current subpass, which are shared by all the draw
+// commands, including the mesh shading ones that do not fetch vertices.
+func (vb *FootprintBuilder) rasterize(ctx context.Context,
+	bh *dependencygraph.Behavior, execInfo *queueExecutionState) {
+	vb.read(ctx, bh, execInfo.subpass)
+	vb.read(ctx, bh, execInfo.currentCmdBufState.pipeline)
+	vb.read(ctx, bh, execInfo.currentCmdBufState.dynamicState)
+	subpassI := execInfo.subpass.val
+	modifiedDs := vb.useBoundDescriptorSets(ctx, bh, execInfo.currentCmdBufState)
+	execInfo.subpasses[execInfo.subpass.val].modifiedDescriptorData = append(
+		execInfo.subpasses[execInfo.subpass.val].modifiedDescriptorData,
+		modifiedDs...)
+	for _, input := range execInfo.subpasses[subpassI].inputAttachments {
+		vb.read(ctx, bh, input.data...)
+	}
+	if execInfo.subpasses[subpassI].shadingRateAttachment != nil {
+		vb.read(ctx, bh, execInfo.subpasses[subpassI].shadingRateAttachment.data...)
 	}
 	for _, color := range execInfo.subpasses[subpassI].colorAttachments {
-		modify(ctx, bh, color.data...)
+		vb.modify(ctx, bh, color.data...)
 	}
 	if execInfo.subpasses[subpassI].depthStencilAttachment != nil {
 		dsAtt := execInfo.subpasses[subpassI].depthStencilAttachment
-		modify(ctx, bh, dsAtt.data...)
+		vb.modify(ctx, bh, dsAtt.data...)
+	}
+}
+
+// drawMeshTasks records the behavior of a mesh shading draw command to be
+// rolled out at execution. src contains the indirect draw parameters and draw
+// count read by the command, if any.
+func (vb *FootprintBuilder) drawMeshTasks(ctx context.Context,
+	ft *dependencygraph.Footprint, bh *dependencygraph.Behavior,
+	vkCb VkCommandBuffer, src []dependencygraph.DefUseVariable) {
+	if _, ok := vb.commandBuffers[vkCb]; ok {
+		vb.read(ctx, bh, vb.commandBuffers[vkCb].renderPassBegin)
+	}
+	if cbc := vb.newCommand(ctx, bh, vkCb); cbc != nil {
+		cbc.behave = func(sc submittedCommand,
+			execInfo *queueExecutionState) {
+			cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
+			vb.rasterize(ctx, cbh, execInfo)
+			vb.read(ctx, cbh, src...)
+			ft.AddBehavior(ctx, cbh)
+		}
+	}
+}
+
+// getIndirectCommandsData returns the underlying data of count indirect
+// commands of the given size stored in the given buffer.
+func (vb *FootprintBuilder) getIndirectCommandsData(ctx context.Context,
+	bh *dependencygraph.Behavior, buf VkBuffer, offset, count, stride,
+	size uint64) []dependencygraph.DefUseVariable {
+	src := []dependencygraph.DefUseVariable{}
+	for i := uint64(0); i < count; i++ {
+		src = append(src, vb.getBufferData(ctx, bh, buf, offset, size)...)
+		offset += stride
+	}
+	return src
+}
+
+// getVideoPictureData records a read operation of the image view bound to the
+// given video picture resource, a read operation of the layouts of the image
+// subresources covered by the image view, then returns the underlying data of
+// the image.
+func (vb *FootprintBuilder) getVideoPictureData(ctx context.Context,
+	bh *dependencygraph.Behavior, s *api.GlobalState,
+	pic VkVideoPictureResourceInfoKHR) []dependencygraph.DefUseVariable {
+	vkView := pic.ImageViewBinding()
+	if !vb.read(ctx, bh, vb.toVkHandle(uint64(vkView))) {
+		return []dependencygraph.DefUseVariable{}
+	}
+	view := GetState(s).ImageViews().Get(vkView)
+	if view.IsNil() || view.Image().IsNil() {
+		return []dependencygraph.DefUseVariable{}
+	}
+	return vb.getImageSubresourceRangeData(ctx, bh, view.Image().VulkanHandle(),
+		view.SubresourceRange())
+}
+
+// getVideoReferenceSlots returns the DPB slots referred by the given
+// VkVideoReferenceSlotInfoKHR structs, along with the underlying data of the
+// picture resources bound to the slots.
+func (vb *FootprintBuilder) getVideoReferenceSlots(ctx context.Context,
+	cmd api.Cmd, s *api.GlobalState, bh *dependencygraph.Behavior,
+	pSlots VkVideoReferenceSlotInfoKHRᶜᵖ, count uint64) []videoReferenceSlot {
+	if pSlots == memory.Nullptr {
+		return []videoReferenceSlot{}
+	}
+	l := s.MemoryLayout
+	slots := make([]videoReferenceSlot, 0, count)
+	for _, info := range pSlots.Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
+		slot := videoReferenceSlot{index: info.SlotIndex(),
+			data: []dependencygraph.DefUseVariable{}}
+		if info.PPictureResource() != memory.Nullptr {
+			slot.data = vb.getVideoPictureData(ctx, bh, s,
+				info.PPictureResource().MustRead(ctx, cmd, s, nil))
+		}
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
+// recordVideoCoding records the behavior of a video decode or encode command
+// to be rolled out at execution. The command reads the source data, the
+// pictures and the DPB slots of the references, and the memory and the coding
+// control state of the bound video session. The destination data and the picture of the setup slot are
+// modified, and the setup slot is overwritten.
+func (vb *FootprintBuilder) recordVideoCoding(ctx context.Context,
+	ft *dependencygraph.Footprint, bh *dependencygraph.Behavior,
+	vkCb VkCommandBuffer, src, dst []dependencygraph.DefUseVariable,
+	setup []videoReferenceSlot, refs []videoReferenceSlot) {
+	cbc := vb.newCommand(ctx, bh, vkCb)
+	cbc.behave = func(sc submittedCommand, execInfo *queueExecutionState) {
+		cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
+		vb.read(ctx, cbh, src...)
+		for _, ref := range refs {
+			vb.read(ctx, cbh, ref.data...)
+		}
+		vb.modify(ctx, cbh, dst...)
+		vs := execInfo.currentCmdBufState.videoSession
+		if vs == nil {
+			log.E(ctx, "FootprintBuilder: Video coding command: %v is not in a video coding scope", sc.id)
+			ft.AddBehavior(ctx, cbh)
+			return
+		}
+		vb.read(ctx, cbh, vs.memory)
+		vb.read(ctx, cbh, vs.control)
+		for _, ref := range refs {
+			vb.read(ctx, cbh, vs.getSlot(vb.labels, ref.index))
+		}
+		for _, slot := range setup {
+			vb.modify(ctx, cbh, slot.data...)
+			vb.write(ctx, cbh, vs.getSlot(vb.labels, slot.index))
+		}
+		ft.AddBehavior(ctx, cbh)
 	}
 }
 
@@ -1499,19 +2569,218 @@ func (vb *FootprintBuilder) readBoundIndexBuffer(ctx context.Context,
 	case *VkCmdDrawIndexedIndirect:
 	}
 	dataToRead := execInfo.currentCmdBufState.indexBufferResBindings.getBoundData(
-		ctx, bh, offset, size)
-	read(ctx, bh, dataToRead...)
+		ctx, vb, bh, offset, size)
+	vb.read(ctx, bh, dataToRead...)
 }
 
-func (vb *FootprintBuilder) recordBarriers(ctx context.Context,
-	s *api.GlobalState, ft *dependencygraph.Footprint, cmd api.Cmd,
-	bh *dependencygraph.Behavior, vkCb VkCommandBuffer, memoryBarrierCount uint32,
-	bufferBarrierCount uint32, pBufferBarriers VkBufferMemoryBarrierᶜᵖ,
-	imageBarrierCount uint32, pImageBarriers VkImageMemoryBarrierᶜᵖ,
-	attachedReads []dependencygraph.DefUseVariable) {
+// vertexRange is the range of the vertices fetched by a draw.
+type vertexRange struct {
+	first, count uint64
+}
+
+// indexedVertexRange reads back the indices used by the given indexed draw
+// from the index buffer bound when the draw is executed and returns the range
+// of the vertices referenced by them. The whole range is returned if the
+// indices cannot be read.
+func indexedVertexRange(ctx context.Context, s *api.GlobalState, thread uint64,
+	args VkCmdDrawIndexedArgsʳ) (uint64, uint64) {
+	lastQueue := GetState(s).LastBoundQueue()
+	if lastQueue.IsNil() || args.IndexCount() == 0 {
+		return 0, vkWholeSize
+	}
+	lastDrawInfo, ok := GetState(s).LastDrawInfos().Lookup(lastQueue.VulkanHandle())
+	if !ok || lastDrawInfo.BoundIndexBuffer().IsNil() ||
+		lastDrawInfo.BoundIndexBuffer().BoundBuffer().Buffer().IsNil() {
+		return 0, vkWholeSize
+	}
+	indexBuffer := lastDrawInfo.BoundIndexBuffer()
+	indices, err := readIndices(ctx, s, thread, indexBuffer.BoundBuffer().Buffer(),
+		indexBuffer.BoundBuffer().Offset(), indexBuffer.Type(),
+		args.IndexCount(), args.FirstIndex(), args.VertexOffset())
+	if err != nil || len(indices) == 0 {
+		debug(ctx, "Failed to read back the indices of the indexed draw: %v", err)
+		return 0, vkWholeSize
+	}
+	minIndex, maxIndex := indices[0], indices[0]
+	for _, i := range indices {
+		if i < minIndex {
+			minIndex = i
+		}
+		if i > maxIndex {
+			maxIndex = i
+		}
+	}
+	return uint64(minIndex), uint64(maxIndex-minIndex) + 1
+}
+
+func (vb *FootprintBuilder) recordBeginRenderPass(ctx context.Context,
+	s *api.GlobalState, ft *dependencygraph.Footprint, bh *dependencygraph.Behavior,
+	vkCb VkCommandBuffer, begin VkRenderPassBeginInfo) {
+	vkRp := begin.RenderPass()
+	vb.read(ctx, bh, vb.toVkHandle(uint64(vkRp)))
+	vkFb := begin.Framebuffer()
+	vb.read(ctx, bh, vb.toVkHandle(uint64(vkFb)))
+	if _, ok := vb.commandBuffers[vkCb]; ok {
+		vb.write(ctx, bh, vb.commandBuffers[vkCb].renderPassBegin)
+	}
+	rp := GetState(s).RenderPasses().Get(vkRp)
+	fb := GetState(s).Framebuffers().Get(vkFb)
+	vb.read(ctx, bh, vb.toVkHandle(uint64(fb.RenderPass().VulkanHandle())))
+	for _, ia := range fb.ImageAttachments().All() {
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(ia.VulkanHandle()))) {
+			vb.read(ctx, bh, vb.toVkHandle(uint64(ia.Image().VulkanHandle())))
+		}
+	}
+	if cbc := vb.newCommand(ctx, bh, vkCb); cbc != nil {
+		cbc.behave = func(sc submittedCommand,
+			execInfo *queueExecutionState) {
+			cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
+			execInfo.beginRenderPass(ctx, vb, cbh, rp, fb)
+			execInfo.renderPassBegin = newForwardPairedLabel(ctx, vb, cbh)
+			ft.AddBehavior(ctx, cbh)
+			cbh.Alive = true // TODO(awoloszyn)(BUG:1158): Investigate why this is needed.
+			// Without this, we drop some needed commands.
+		}
+	}
+}
+
+func (vb *FootprintBuilder) recordNextSubpass(ctx context.Context,
+	ft *dependencygraph.Footprint, bh *dependencygraph.Behavior, vkCb VkCommandBuffer) {
+	cbc := vb.newCommand(ctx, bh, vkCb)
+	cbc.behave = func(sc submittedCommand,
+		execInfo *queueExecutionState) {
+		cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
+		execInfo.nextSubpass(ctx, ft, cbh, sc)
+		ft.AddBehavior(ctx, cbh)
+		cbh.Alive = true // TODO(awoloszyn)(BUG:1158): Investigate why this is needed.
+		// Without this, we drop some needed commands.
+	}
+}
+
+func (vb *FootprintBuilder) recordEndRenderPass(ctx context.Context,
+	ft *dependencygraph.Footprint, bh *dependencygraph.Behavior, vkCb VkCommandBuffer) {
+	if _, ok := vb.commandBuffers[vkCb]; ok {
+		vb.read(ctx, bh, vb.commandBuffers[vkCb].renderPassBegin)
+		cbc := vb.newCommand(ctx, bh, vkCb)
+		cbc.behave = func(sc submittedCommand,
+			execInfo *queueExecutionState) {
+			cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
+			execInfo.endRenderPass(ctx, ft, cbh, sc)
+			vb.read(ctx, cbh, execInfo.renderPassBegin)
+			ft.AddBehavior(ctx, cbh)
+			cbh.Alive = true // TODO(awoloszyn)(BUG:1158): Investigate why this is needed.
+			// Without this, we drop some needed commands.
+		}
+	}
+}
+
+// bufferBarrier and imageBarrier hold the parts of the buffer and image
+// memory barriers, either from the v1 barrier commands or from a
+// VkDependencyInfoKHR, that the footprint builder cares about.
+type bufferBarrier struct {
+	buffer         VkBuffer
+	offset         uint64
+	size           uint64
+	srcQueueFamily uint32
+	dstQueueFamily uint32
+}
+
+type imageBarrier struct {
+	image          VkImage
+	rng            VkImageSubresourceRange
+	srcQueueFamily uint32
+	dstQueueFamily uint32
+	oldLayout      VkImageLayout
+	newLayout      VkImageLayout
+}
+
+// ownershipTransfer identifies a queue family ownership transfer of a buffer
+// or image.
+type ownershipTransfer struct {
+	handle         uint64
+	srcQueueFamily uint32
+	dstQueueFamily uint32
+}
+
+// getOwnershipTransfer returns the label which is written by the release
+// operation and read by the acquire operation of the given queue family
+// ownership transfer. If the transfer has not been seen before, a new label
+// will be created.
+func (vb *FootprintBuilder) getOwnershipTransfer(t ownershipTransfer) *label {
+	if _, ok := vb.ownershipTransfers[t]; !ok {
+		vb.ownershipTransfers[t] = vb.labels.newLabel()
+	}
+	return vb.ownershipTransfers[t]
+}
+
+// recordOwnershipTransfer records the release or the acquire operation of a
+// queue family ownership transfer, depending on the queue family of the queue
+// executing the barrier. Barriers which do not transfer the ownership are
+// ignored.
+func (vb *FootprintBuilder) recordOwnershipTransfer(ctx context.Context,
+	bh *dependencygraph.Behavior, execInfo *queueExecutionState, t ownershipTransfer) {
+	if t.srcQueueFamily == t.dstQueueFamily ||
+		t.srcQueueFamily == vkQueueFamilyIgnored ||
+		t.dstQueueFamily == vkQueueFamilyIgnored {
+		return
+	}
+	switch execInfo.queueFamily {
+	case t.srcQueueFamily:
+		vb.write(ctx, bh, vb.getOwnershipTransfer(t))
+	case t.dstQueueFamily:
+		vb.read(ctx, bh, vb.getOwnershipTransfer(t))
+	}
+}
+
+func readBufferBarriers(ctx context.Context, cmd api.Cmd, s *api.GlobalState,
+	count uint32, pBarriers VkBufferMemoryBarrierᶜᵖ) []bufferBarrier {
+	barriers := []bufferBarrier{}
+	for _, b := range pBarriers.Slice(0, uint64(count), s.MemoryLayout).MustRead(ctx, cmd, s, nil) {
+		barriers = append(barriers, bufferBarrier{b.Buffer(), uint64(b.Offset()),
+			uint64(b.Size()), b.SrcQueueFamilyIndex(), b.DstQueueFamilyIndex()})
+	}
+	return barriers
+}
+
+func readImageBarriers(ctx context.Context, cmd api.Cmd, s *api.GlobalState,
+	count uint32, pBarriers VkImageMemoryBarrierᶜᵖ) []imageBarrier {
+	barriers := []imageBarrier{}
+	for _, b := range pBarriers.Slice(0, uint64(count), s.MemoryLayout).MustRead(ctx, cmd, s, nil) {
+		barriers = append(barriers, imageBarrier{b.Image(), b.SubresourceRange(),
+			b.SrcQueueFamilyIndex(), b.DstQueueFamilyIndex(), b.OldLayout(), b.NewLayout()})
+	}
+	return barriers
+}
+
+// readDependencyInfo reads the barriers of the given VkDependencyInfoKHR.
+// The returned boolean tells whether the dependency info contains any global
+// memory barrier.
+func readDependencyInfo(ctx context.Context, cmd api.Cmd, s *api.GlobalState,
+	info VkDependencyInfoKHR) (bool, []bufferBarrier, []imageBarrier) {
 	l := s.MemoryLayout
+	bufferBarriers := []bufferBarrier{}
+	for _, b := range info.PBufferMemoryBarriers().Slice(0,
+		uint64(info.BufferMemoryBarrierCount()), l).MustRead(ctx, cmd, s, nil) {
+		bufferBarriers = append(bufferBarriers, bufferBarrier{b.Buffer(), uint64(b.Offset()),
+			uint64(b.Size()), b.SrcQueueFamilyIndex(), b.DstQueueFamilyIndex()})
+	}
+	imageBarriers := []imageBarrier{}
+	for _, b := range info.PImageMemoryBarriers().Slice(0,
+		uint64(info.ImageMemoryBarrierCount()), l).MustRead(ctx, cmd, s, nil) {
+		imageBarriers = append(imageBarriers, imageBarrier{b.Image(), b.SubresourceRange(),
+			b.SrcQueueFamilyIndex(), b.DstQueueFamilyIndex(), b.OldLayout(), b.NewLayout()})
+	}
+	return info.MemoryBarrierCount() > 0, bufferBarriers, imageBarriers
+}
+
+func (vb *FootprintBuilder) recordBarriers(ctx context.Context,
+	ft *dependencygraph.Footprint, bh *dependencygraph.Behavior,
+	vkCb VkCommandBuffer, hasMemoryBarrier bool, bufferBarriers []bufferBarrier,
+	imageBarriers []imageBarrier, attachedReads []dependencygraph.DefUseVariable,
+	attachedWrites []dependencygraph.DefUseVariable) {
 	touchedData := []dependencygraph.DefUseVariable{}
-	if memoryBarrierCount > 0 {
+	transitions := map[VkImage][]dependencygraph.DefUseVariable{}
+	if hasMemoryBarrier {
 		// touch all buffer and image backing data
 		for i := range vb.images {
 			touchedData = append(touchedData, vb.getImageData(ctx, bh, i)...)
@@ -1520,29 +2789,47 @@ func (vb *FootprintBuilder) recordBarriers(ctx context.Context,
 			touchedData = append(touchedData, vb.getBufferData(ctx, bh, b, 0, vkWholeSize)...)
 		}
 	} else {
-		for _, barrier := range pBufferBarriers.Slice(0,
-			uint64(bufferBarrierCount), l).MustRead(ctx, cmd, s, nil) {
-			touchedData = append(touchedData, vb.getBufferData(ctx, bh, barrier.Buffer(),
-				uint64(barrier.Offset()), uint64(barrier.Size()))...)
-		}
-		for _, barrier := range pImageBarriers.Slice(0,
-			uint64(imageBarrierCount), l).MustRead(ctx, cmd, s, nil) {
-			imgLayout, imgData := vb.getImageLayoutAndData(ctx, bh, barrier.Image())
-			touchedData = append(touchedData, imgLayout)
+		for _, barrier := range bufferBarriers {
+			touchedData = append(touchedData, vb.getBufferData(ctx, bh, barrier.buffer,
+				barrier.offset, barrier.size)...)
+		}
+		for _, barrier := range imageBarriers {
+			imgLayout, imgData := vb.getImageSubresourceLayoutAndData(ctx, bh,
+				barrier.image, barrier.rng)
+			touchedData = append(touchedData, imgLayout...)
 			touchedData = append(touchedData, imgData...)
+			if barrier.oldLayout != barrier.newLayout {
+				transitions[barrier.image] = append(transitions[barrier.image], imgLayout...)
+			}
 		}
 	}
+	transfers := []ownershipTransfer{}
+	for _, barrier := range bufferBarriers {
+		transfers = append(transfers, ownershipTransfer{uint64(barrier.buffer),
+			barrier.srcQueueFamily, barrier.dstQueueFamily})
+	}
+	for _, barrier := range imageBarriers {
+		transfers = append(transfers, ownershipTransfer{uint64(barrier.image),
+			barrier.srcQueueFamily, barrier.dstQueueFamily})
+	}
 	cbc := vb.newCommand(ctx, bh, vkCb)
 	cbc.behave = func(sc submittedCommand,
 		execInfo *queueExecutionState) {
 		for _, d := range touchedData {
 			cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
-			read(ctx, cbh, attachedReads...)
-			modify(ctx, cbh, d)
+			vb.read(ctx, cbh, attachedReads...)
+			vb.modify(ctx, cbh, d)
 			ft.AddBehavior(ctx, cbh)
 		}
 		cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
-		read(ctx, cbh, attachedReads...)
+		vb.read(ctx, cbh, attachedReads...)
+		vb.write(ctx, cbh, attachedWrites...)
+		for _, t := range transfers {
+			vb.recordOwnershipTransfer(ctx, cbh, execInfo, t)
+		}
+		for img, layouts := range transitions {
+			vb.lint.transition(img, layouts...)
+		}
 		ft.AddBehavior(ctx, cbh)
 	}
 }
@@ -1572,12 +2859,34 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		executedCommands = append(executedCommands, fci)
 	}
 
+	// Register callback function to read the indices of the indexed draws
+	// before they are executed, as the previous commands of the same
+	// submission may modify the index buffers.
+	GetState(s).PreSubcommand = func(a interface{}) {
+		ref, ok := a.(CommandReferenceʳ)
+		if !ok || ref.Type() != CommandType_cmd_vkCmdDrawIndexed ||
+			!config.IndexedVertexRangesInDeadCodeElimination {
+			return
+		}
+		queueSubmit, _ := (GetState(s).CurrentSubmission).(*VkQueueSubmit)
+		fci := api.SubCmdIdx{uint64(vb.submitIDs[queueSubmit])}
+		fci = append(fci, GetState(s).SubCmdIdx...)
+		args := GetCommandArgs(ctx, ref, GetState(s)).(VkCmdDrawIndexedArgsʳ)
+		first, count := indexedVertexRange(ctx, s, cmd.Thread(), args)
+		vb.indexedVertexRanges.SetValue(fci, vertexRange{first, count})
+	}
+
 	// Register callback function to track sparse bindings
 	sparseBindingInfo := []QueuedSparseBinds{}
 	GetState(s).postBindSparse = func(binds QueuedSparseBindsʳ) {
 		sparseBindingInfo = append(sparseBindingInfo, binds.Get())
 	}
 
+	// The lifetimes of the handles and the image layouts are recorded from
+	// the state after the command.
+	defer vb.lifetimes.record(vb, s, id, cmd)
+	defer vb.imageLayouts.record(vb, s, id)
+
 	// Mutate
 	if err := cmd.Mutate(ctx, id, s, nil, nil); err != nil {
 		// Continue the footprint building without emitting errors here. It is the
@@ -1585,20 +2894,29 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		return
 	}
 
-	bh := dependencygraph.NewBehavior(api.SubCmdIdx{uint64(id)})
+	bh := vb.behaviors.NewBehavior(api.SubCmdIdx{uint64(id)})
 
 	// The main switch
 	switch cmd := cmd.(type) {
 	// device memory
 	case *VkAllocateMemory:
 		vkMem := cmd.PMemory().MustRead(ctx, cmd, s, nil)
-		write(ctx, bh, vb.toVkHandle(uint64(vkMem)))
+		vb.write(ctx, bh, vb.toVkHandle(uint64(vkMem)))
+		memObj := GetState(s).DeviceMemories().Get(vkMem)
+		if !memObj.IsNil() && memObj.ExternalHandleTypes() != VkExternalMemoryHandleTypeFlags(0) {
+			vb.shareExternalMemory(ctx, bh, s, ft, vkMem)
+		}
 	case *VkFreeMemory:
 		vkMem := cmd.Memory()
-		read(ctx, bh, vb.toVkHandle(uint64(vkMem)))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(vkMem)))
+		if _, ok := vb.deviceMemoryRecords.external[vkMem]; ok {
+			ft.RemoveSharedVariable(dependencygraph.ExternalMemory(uint64(vkMem)))
+			delete(vb.deviceMemoryRecords.external, vkMem)
+		}
+		delete(vb.deviceMemoryRecords.bindings, vkMem)
 		bh.Alive = true
 	case *VkMapMemory:
-		modify(ctx, bh, vb.toVkHandle(uint64(cmd.Memory())))
+		vb.modify(ctx, bh, vb.toVkHandle(uint64(cmd.Memory())))
 		memObj := GetState(s).DeviceMemories().Get(cmd.Memory())
 		isCoherent, _ := subIsMemoryCoherent(ctx, cmd, id, nil, s, GetState(s),
 			cmd.Thread(), nil, nil, memObj)
@@ -1607,7 +2925,7 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		}
 		bh.Alive = true
 	case *VkUnmapMemory:
-		modify(ctx, bh, vb.toVkHandle(uint64(cmd.Memory())))
+		vb.modify(ctx, bh, vb.toVkHandle(uint64(cmd.Memory())))
 		vb.writeCoherentMemoryData(ctx, cmd, bh)
 		if _, mappedCoherent := vb.mappedCoherentMemories[cmd.Memory()]; mappedCoherent {
 			delete(vb.mappedCoherentMemories, cmd.Memory())
@@ -1617,7 +2935,7 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		coherentMemDone := false
 		count := uint64(cmd.MemoryRangeCount())
 		for _, rng := range cmd.PMemoryRanges().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
-			read(ctx, bh, vb.toVkHandle(uint64(rng.Memory())))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(rng.Memory())))
 			mem := GetState(s).DeviceMemories().Get(rng.Memory())
 			if mem.IsNil() {
 				continue
@@ -1637,12 +2955,12 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 			// 	sp:     interval.U64Span{Start: offset, End: offset + size},
 			// 	memory: rng.Memory(),
 			// }
-			write(ctx, bh, ms)
+			vb.write(ctx, bh, ms)
 		}
 	case *VkInvalidateMappedMemoryRanges:
 		count := uint64(cmd.MemoryRangeCount())
 		for _, rng := range cmd.PMemoryRanges().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
-			read(ctx, bh, vb.toVkHandle(uint64(rng.Memory())))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(rng.Memory())))
 			offset := uint64(rng.Offset())
 			size := uint64(rng.Size())
 			ms := vb.newMemorySpan(rng.Memory(), offset, size)
@@ -1650,38 +2968,62 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 			// 	sp:     interval.U64Span{Start: offset, End: offset + size},
 			// 	memory: rng.Memory(),
 			// }
-			read(ctx, bh, ms)
-		}
+			vb.read(ctx, bh, ms)
+		}
+
+	// external memory
+	case *VkGetMemoryFdKHR:
+		vkMem := cmd.PGetFdInfo().MustRead(ctx, cmd, s, nil).Memory()
+		vb.read(ctx, bh, vb.toVkHandle(uint64(vkMem)))
+		vb.shareExternalMemory(ctx, bh, s, ft, vkMem)
+	case *VkGetMemoryWin32HandleKHR:
+		vkMem := cmd.PGetWin32HandleInfo().MustRead(ctx, cmd, s, nil).Memory()
+		vb.read(ctx, bh, vb.toVkHandle(uint64(vkMem)))
+		vb.shareExternalMemory(ctx, bh, s, ft, vkMem)
+	case *VkGetMemoryFdPropertiesKHR,
+		*VkGetMemoryWin32HandlePropertiesKHR:
+		// The queried external handles are not tracked, be conservative and
+		// keep the queries alive.
+		bh.Alive = true
 
 	// image
 	case *VkCreateImage:
 		vkImg := cmd.PImage().MustRead(ctx, cmd, s, nil)
-		write(ctx, bh, vb.toVkHandle(uint64(vkImg)))
-		vb.images[vkImg] = newImageLayoutAndData(ctx, bh)
+		vb.write(ctx, bh, vb.toVkHandle(uint64(vkImg)))
+		vb.images[vkImg] = newImageLayoutAndData(ctx, vb, bh, GetState(s).Images().Get(vkImg))
+		vb.imageLayouts.track(vkImg, vb.images[vkImg])
 	case *VkDestroyImage:
 		vkImg := cmd.Image()
-		if read(ctx, bh, vb.toVkHandle(uint64(vkImg))) {
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(vkImg))) {
 			delete(vb.images, vkImg)
+			delete(vb.memoryRequirements, uint64(vkImg))
+			vb.deviceMemoryRecords.unbindResource(uint64(vkImg))
 		}
 		bh.Alive = true
 	case *VkGetImageMemoryRequirements:
-		// TODO: Once the memory requirements are moved out from the image object,
-		// drop the 'modify' on the image handle, replace it with another proper
-		// representation of the cached data.
-		modify(ctx, bh, vb.toVkHandle(uint64(cmd.Image())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Image())))
+		vb.write(ctx, bh, vb.getMemoryRequirements(uint64(cmd.Image())))
 	case *VkGetImageSparseMemoryRequirements:
-		// TODO: Once the memory requirements are moved out from the image object,
-		// drop the 'modify' on the image handle, replace it with another proper
-		// representation of the cached data.
-		modify(ctx, bh, vb.toVkHandle(uint64(cmd.Image())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Image())))
+		vb.write(ctx, bh, vb.getMemoryRequirements(uint64(cmd.Image())))
+	case *VkGetImageMemoryRequirements2KHR:
+		vkImg := cmd.PInfo().MustRead(ctx, cmd, s, nil).Image()
+		vb.read(ctx, bh, vb.toVkHandle(uint64(vkImg)))
+		vb.write(ctx, bh, vb.getMemoryRequirements(uint64(vkImg)))
+	case *VkGetImageSparseMemoryRequirements2KHR:
+		vkImg := cmd.PInfo().MustRead(ctx, cmd, s, nil).Image()
+		vb.read(ctx, bh, vb.toVkHandle(uint64(vkImg)))
+		vb.write(ctx, bh, vb.getMemoryRequirements(uint64(vkImg)))
 
 	case *ReplayAllocateImageMemory:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Image())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Image())))
+		vb.read(ctx, bh, vb.getMemoryRequirements(uint64(cmd.Image())))
 		vkMem := cmd.PMemory().MustRead(ctx, cmd, s, nil)
-		write(ctx, bh, vb.toVkHandle(uint64(vkMem)))
+		vb.write(ctx, bh, vb.toVkHandle(uint64(vkMem)))
 	case *VkBindImageMemory:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Image())))
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Memory())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Image())))
+		vb.read(ctx, bh, vb.getMemoryRequirements(uint64(cmd.Image())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Memory())))
 		offset := uint64(cmd.MemoryOffset())
 		inferredSize, err := subInferImageSize(ctx, cmd, id, nil, s, nil, cmd.Thread(),
 			nil, nil, GetState(s).Images().Get(cmd.Image()))
@@ -1694,181 +3036,235 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		vb.addOpaqueImageMemBinding(ctx, bh, cmd.Image(), cmd.Memory(), 0, size, offset)
 
 	case *VkCreateImageView:
-		write(ctx, bh, vb.toVkHandle(uint64(cmd.PView().MustRead(ctx, cmd, s, nil))))
+		vb.write(ctx, bh, vb.toVkHandle(uint64(cmd.PView().MustRead(ctx, cmd, s, nil))))
 		img := cmd.PCreateInfo().MustRead(ctx, cmd, s, nil).Image()
-		read(ctx, bh, vb.getImageData(ctx, bh, img)...)
+		vb.read(ctx, bh, vb.getImageData(ctx, bh, img)...)
 	case *VkDestroyImageView:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.ImageView())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.ImageView())))
 		bh.Alive = true
 
 	// buffer
 	case *VkCreateBuffer:
 		vkBuf := cmd.PBuffer().MustRead(ctx, cmd, s, nil)
-		write(ctx, bh, vb.toVkHandle(uint64(vkBuf)))
+		vb.write(ctx, bh, vb.toVkHandle(uint64(vkBuf)))
 	case *VkDestroyBuffer:
 		vkBuf := cmd.Buffer()
-		if read(ctx, bh, vb.toVkHandle(uint64(vkBuf))) {
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(vkBuf))) {
 			delete(vb.buffers, vkBuf)
+			delete(vb.memoryRequirements, uint64(vkBuf))
+			vb.deviceMemoryRecords.unbindResource(uint64(vkBuf))
 		}
 		bh.Alive = true
 	case *VkGetBufferMemoryRequirements:
-		// TODO: Once the memory requirements are moved out from the buffer object,
-		// drop the 'modify' on the buffer handle, replace it with another proper
-		// representation of the cached data.
-		modify(ctx, bh, vb.toVkHandle(uint64(cmd.Buffer())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Buffer())))
+		vb.write(ctx, bh, vb.getMemoryRequirements(uint64(cmd.Buffer())))
+	case *VkGetBufferMemoryRequirements2KHR:
+		vkBuf := cmd.PInfo().MustRead(ctx, cmd, s, nil).Buffer()
+		vb.read(ctx, bh, vb.toVkHandle(uint64(vkBuf)))
+		vb.write(ctx, bh, vb.getMemoryRequirements(uint64(vkBuf)))
 
 	case *VkBindBufferMemory:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Buffer())))
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Memory())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Buffer())))
+		vb.read(ctx, bh, vb.getMemoryRequirements(uint64(cmd.Buffer())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Memory())))
 		offset := uint64(cmd.MemoryOffset())
 		size := uint64(GetState(s).Buffers().Get(cmd.Buffer()).Info().Size())
 		vb.addBufferMemBinding(ctx, bh, cmd.Buffer(), cmd.Memory(), 0, size, offset)
 	case *VkCreateBufferView:
-		write(ctx, bh, vb.toVkHandle(uint64(cmd.PView().MustRead(ctx, cmd, s, nil))))
+		vb.write(ctx, bh, vb.toVkHandle(uint64(cmd.PView().MustRead(ctx, cmd, s, nil))))
 		info := cmd.PCreateInfo().MustRead(ctx, cmd, s, nil)
 		buf := info.Buffer()
 		offset := uint64(info.Offset())
 		size := uint64(info.Range())
-		read(ctx, bh, vb.getBufferData(ctx, bh, buf, offset, size)...)
+		vb.read(ctx, bh, vb.getBufferData(ctx, bh, buf, offset, size)...)
 	case *VkDestroyBufferView:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.BufferView())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.BufferView())))
 		bh.Alive = true
 
 	// swapchain
 	case *VkCreateSwapchainKHR:
+		info := cmd.PCreateInfo().MustRead(ctx, cmd, s, nil)
+		// The old swapchain is retired by the new one, but it may still be used
+		// to present the images acquired before the recreation.
+		vb.read(ctx, bh, vb.toVkHandle(uint64(info.OldSwapchain())))
 		vkSw := cmd.PSwapchain().MustRead(ctx, cmd, s, nil)
-		write(ctx, bh, vb.toVkHandle(uint64(vkSw)))
+		vb.write(ctx, bh, vb.toVkHandle(uint64(vkSw)))
+		vb.swapchains[vkSw] = &swapchainImages{}
 
 	case *VkCreateSharedSwapchainsKHR:
 		count := uint64(cmd.SwapchainCount())
+		for _, info := range cmd.PCreateInfos().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
+			vb.read(ctx, bh, vb.toVkHandle(uint64(info.OldSwapchain())))
+		}
 		for _, vkSw := range cmd.PSwapchains().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
-			write(ctx, bh, vb.toVkHandle(uint64(vkSw)))
+			vb.write(ctx, bh, vb.toVkHandle(uint64(vkSw)))
+			vb.swapchains[vkSw] = &swapchainImages{}
 		}
 
 	case *VkGetSwapchainImagesKHR:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Swapchain())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Swapchain())))
 		if cmd.PSwapchainImages() == 0 {
-			modify(ctx, bh, vb.toVkHandle(uint64(cmd.Swapchain())))
+			vb.modify(ctx, bh, vb.toVkHandle(uint64(cmd.Swapchain())))
 		} else {
 			count := uint64(cmd.PSwapchainImageCount().MustRead(ctx, cmd, s, nil))
-			for _, vkImg := range cmd.PSwapchainImages().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
-				write(ctx, bh, vb.toVkHandle(uint64(vkImg)))
-				vb.images[vkImg] = newImageLayoutAndData(ctx, bh)
+			vkImgs := cmd.PSwapchainImages().Slice(0, count, l).MustRead(ctx, cmd, s, nil)
+			for _, vkImg := range vkImgs {
+				vb.write(ctx, bh, vb.toVkHandle(uint64(vkImg)))
+				vb.images[vkImg] = newImageLayoutAndData(ctx, vb, bh, GetState(s).Images().Get(vkImg))
+				vb.imageLayouts.track(vkImg, vb.images[vkImg])
 				vb.addSwapchainImageMemBinding(ctx, bh, vkImg)
-				vb.swapchainImageAcquired[cmd.Swapchain()] = append(
-					vb.swapchainImageAcquired[cmd.Swapchain()], newLabel())
-				vb.swapchainImagePresented[cmd.Swapchain()] = append(
-					vb.swapchainImagePresented[cmd.Swapchain()], newLabel())
 			}
+			if _, ok := vb.swapchains[cmd.Swapchain()]; !ok {
+				vb.swapchains[cmd.Swapchain()] = &swapchainImages{}
+			}
+			vb.swapchains[cmd.Swapchain()].reset(vb.labels, vkImgs)
 		}
 	case *VkDestroySwapchainKHR:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Swapchain())))
-		delete(vb.swapchainImageAcquired, cmd.Swapchain())
-		delete(vb.swapchainImagePresented, cmd.Swapchain())
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Swapchain())))
+		// The swapchain images are destroyed along with the swapchain.
+		if sw, ok := vb.swapchains[cmd.Swapchain()]; ok {
+			for _, vkImg := range sw.images {
+				delete(vb.images, vkImg)
+			}
+		}
+		delete(vb.swapchains, cmd.Swapchain())
 		bh.Alive = true
 
 	// presentation engine
 	case *VkAcquireNextImageKHR:
-		if read(ctx, bh, vb.toVkHandle(uint64(cmd.Semaphore()))) {
-			write(ctx, bh, vb.semaphoreSignals[cmd.Semaphore()])
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Swapchain())))
+		if !imageAcquired(cmd.Result()) {
+			break
 		}
-		if read(ctx, bh, vb.toVkHandle(uint64(cmd.Fence()))) {
-			write(ctx, bh, vb.fences[cmd.Fence()].signal)
-		}
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Swapchain())))
 		// The value of this imgId should have been written by the driver.
 		imgID := cmd.PImageIndex().MustRead(ctx, cmd, s, nil)
-		vkImg := GetState(s).Swapchains().Get(cmd.Swapchain()).SwapchainImages().Get(imgID).VulkanHandle()
-		if read(ctx, bh, vb.toVkHandle(uint64(vkImg))) {
-			imgLayout, imgData := vb.getImageLayoutAndData(ctx, bh, vkImg)
-			write(ctx, bh, imgLayout)
-			write(ctx, bh, imgData...)
+		vb.acquireNextImage(ctx, bh, cmd.Swapchain(), cmd.Semaphore(), cmd.Fence(), imgID)
+
+	case *VkAcquireNextImage2KHR:
+		info := cmd.PAcquireInfo().MustRead(ctx, cmd, s, nil)
+		vb.read(ctx, bh, vb.toVkHandle(uint64(info.Swapchain())))
+		if !imageAcquired(cmd.Result()) {
+			break
 		}
-		write(ctx, bh, vb.swapchainImageAcquired[cmd.Swapchain()][imgID])
-		read(ctx, bh, vb.swapchainImagePresented[cmd.Swapchain()][imgID])
+		imgID := cmd.PImageIndex().MustRead(ctx, cmd, s, nil)
+		vb.acquireNextImage(ctx, bh, info.Swapchain(), info.Semaphore(), info.Fence(), imgID)
 
 	case *VkQueuePresentKHR:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Queue())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Queue())))
 		info := cmd.PPresentInfo().MustRead(ctx, cmd, s, nil)
 		spCount := uint64(info.WaitSemaphoreCount())
 		for _, vkSp := range info.PWaitSemaphores().Slice(0, spCount, l).MustRead(ctx, cmd, s, nil) {
-			if read(ctx, bh, vb.toVkHandle(uint64(vkSp))) {
-				read(ctx, bh, vb.semaphoreSignals[vkSp])
+			if vb.read(ctx, bh, vb.toVkHandle(uint64(vkSp))) {
+				vb.read(ctx, bh, vb.semaphoreSignals[vkSp])
 			}
 		}
 		swCount := uint64(info.SwapchainCount())
 		imgIds := info.PImageIndices().Slice(0, swCount, l)
 		for swi, vkSw := range info.PSwapchains().Slice(0, swCount, l).MustRead(ctx, cmd, s, nil) {
-			read(ctx, bh, vb.toVkHandle(uint64(vkSw)))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(vkSw)))
 			imgID := imgIds.Index(uint64(swi)).MustRead(ctx, cmd, s, nil)[0]
-			vkImg := GetState(s).Swapchains().Get(vkSw).SwapchainImages().Get(imgID).VulkanHandle()
+			// Even if the presentation is rejected, e.g. the swapchain is out of
+			// date, the image is still released back to the presentation engine.
+			// But an image index which does not refer to a known image of the
+			// swapchain cannot be tracked.
+			vkImg, acquired, presented, ok := vb.swapchains[vkSw].image(imgID)
+			if !ok {
+				debug(ctx, "Image index: %v of swapchain: %v is not tracked", imgID, vkSw)
+				continue
+			}
+			vb.frames.present(id, vkSw)
 			imgLayout, imgData := vb.getImageLayoutAndData(ctx, bh, vkImg)
-			read(ctx, bh, imgLayout)
-			read(ctx, bh, imgData...)
+			vb.read(ctx, bh, imgLayout...)
+			vb.read(ctx, bh, imgData...)
 
 			// For each image to be presented, one extra behavior is requied to
 			// track the acquire-present pair of the image state in the presentation
 			// engine. And this extra behavior must be kept alive to prevent the
 			// presentation engine from hang.
-			extraBh := dependencygraph.NewBehavior(api.SubCmdIdx{uint64(id)})
+			extraBh := vb.behaviors.NewBehavior(api.SubCmdIdx{uint64(id)})
 			for _, vkSp := range info.PWaitSemaphores().Slice(0, spCount, l).MustRead(ctx, cmd, s, nil) {
-				read(ctx, extraBh, vb.toVkHandle(uint64(cmd.Queue())))
-				if read(ctx, extraBh, vb.toVkHandle(uint64(vkSp))) {
-					read(ctx, extraBh, vb.semaphoreSignals[vkSp])
+				vb.read(ctx, extraBh, vb.toVkHandle(uint64(cmd.Queue())))
+				if vb.read(ctx, extraBh, vb.toVkHandle(uint64(vkSp))) {
+					vb.read(ctx, extraBh, vb.semaphoreSignals[vkSp])
 				}
 			}
-			read(ctx, extraBh, vb.swapchainImageAcquired[vkSw][imgID])
-			write(ctx, extraBh, vb.swapchainImagePresented[vkSw][imgID])
+			vb.read(ctx, extraBh, acquired)
+			vb.write(ctx, extraBh, presented)
 			extraBh.Alive = true
 			ft.AddBehavior(ctx, extraBh)
 		}
 
 	// sampler
 	case *VkCreateSampler:
-		write(ctx, bh, vb.toVkHandle(uint64(cmd.PSampler().MustRead(ctx, cmd, s, nil))))
+		vb.write(ctx, bh, vb.toVkHandle(uint64(cmd.PSampler().MustRead(ctx, cmd, s, nil))))
 	case *VkDestroySampler:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Sampler())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Sampler())))
 		bh.Alive = true
 
 	// query pool
 	case *VkCreateQueryPool:
 		vkQp := cmd.PQueryPool().MustRead(ctx, cmd, s, nil)
-		write(ctx, bh, vb.toVkHandle(uint64(vkQp)))
-		count := uint64(cmd.PCreateInfo().MustRead(ctx, cmd, s, nil).QueryCount())
+		vb.write(ctx, bh, vb.toVkHandle(uint64(vkQp)))
+		info := cmd.PCreateInfo().MustRead(ctx, cmd, s, nil)
+		count := uint64(info.QueryCount())
 		vb.querypools[vkQp] = &queryPool{
 			queries: make([]*query, 0, count),
 		}
+		if info.QueryType() == VkQueryType_VK_QUERY_TYPE_PERFORMANCE_QUERY_KHR {
+			vb.querypools[vkQp].profilingLock = vb.getProfilingLock(cmd.Device())
+		}
 		for i := uint64(0); i < count; i++ {
-			vb.querypools[vkQp].queries = append(vb.querypools[vkQp].queries, newQuery())
+			vb.querypools[vkQp].queries = append(vb.querypools[vkQp].queries, newQuery(vb.labels))
 		}
 	case *VkDestroyQueryPool:
-		if read(ctx, bh, vb.toVkHandle(uint64(cmd.QueryPool()))) {
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.QueryPool()))) {
 			delete(vb.querypools, cmd.QueryPool())
 		}
 		bh.Alive = true
 	case *VkGetQueryPoolResults:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.QueryPool())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.QueryPool())))
 		count := uint64(cmd.QueryCount())
 		first := uint64(cmd.FirstQuery())
 		for i := uint64(0); i < count; i++ {
-			read(ctx, bh, vb.querypools[cmd.QueryPool()].queries[i+first].result)
-		}
+			vb.read(ctx, bh, vb.querypools[cmd.QueryPool()].queries[i+first].resultDependencies(cmd.Flags())...)
+		}
+	// Acquiring and releasing the profiling lock both modify the lock, so the
+	// commands on performance query pools depend on the latest acquisition,
+	// and an acquisition depends on the release of the previous acquisition.
+	case *VkAcquireProfilingLockKHR:
+		vb.modify(ctx, bh, vb.getProfilingLock(cmd.Device()))
+	case *VkReleaseProfilingLockKHR:
+		vb.modify(ctx, bh, vb.getProfilingLock(cmd.Device()))
+	case *VkResetQueryPool:
+		vb.resetQueriesOnHost(ctx, bh, cmd.QueryPool(), cmd.FirstQuery(), cmd.QueryCount())
+	case *VkResetQueryPoolEXT:
+		vb.resetQueriesOnHost(ctx, bh, cmd.QueryPool(), cmd.FirstQuery(), cmd.QueryCount())
 
 	// descriptor set
 	case *VkCreateDescriptorSetLayout:
-		write(ctx, bh, vb.toVkHandle(uint64(cmd.PSetLayout().MustRead(ctx, cmd, s, nil))))
+		vkLayout := cmd.PSetLayout().MustRead(ctx, cmd, s, nil)
+		vb.write(ctx, bh, vb.toVkHandle(uint64(vkLayout)))
 		info := cmd.PCreateInfo().MustRead(ctx, cmd, s, nil)
+		// The layouts with update-after-bind bindings must be created with
+		// the update-after-bind pool flag.
+		if info.Flags()&VkDescriptorSetLayoutCreateFlags(
+			VkDescriptorSetLayoutCreateFlagBits_VK_DESCRIPTOR_SET_LAYOUT_CREATE_UPDATE_AFTER_BIND_POOL_BIT_EXT) != 0 {
+			vb.updateAfterBindLayouts[vkLayout] = struct{}{}
+		} else {
+			delete(vb.updateAfterBindLayouts, vkLayout)
+		}
 		bindings := info.PBindings().Slice(0, uint64(info.BindingCount()), l).MustRead(ctx, cmd, s, nil)
 		for _, b := range bindings {
 			if b.PImmutableSamplers() != memory.Nullptr {
 				samplers := b.PImmutableSamplers().Slice(0, uint64(b.DescriptorCount()), l).MustRead(ctx, cmd, s, nil)
 				for _, sam := range samplers {
-					read(ctx, bh, vb.toVkHandle(uint64(sam)))
+					vb.read(ctx, bh, vb.toVkHandle(uint64(sam)))
 				}
 			}
 		}
 	case *VkDestroyDescriptorSetLayout:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.DescriptorSetLayout())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.DescriptorSetLayout())))
+		delete(vb.updateAfterBindLayouts, cmd.DescriptorSetLayout())
 		bh.Alive = true
 	case *VkAllocateDescriptorSets:
 		info := cmd.PAllocateInfo().MustRead(ctx, cmd, s, nil)
@@ -1876,13 +3272,18 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		vkLayouts := info.PSetLayouts().Slice(0, setCount, l)
 		for i, vkSet := range cmd.PDescriptorSets().Slice(0, setCount, l).MustRead(ctx, cmd, s, nil) {
 			vkLayout := vkLayouts.Index(uint64(i)).MustRead(ctx, cmd, s, nil)[0]
-			read(ctx, bh, vb.toVkHandle(uint64(vkLayout)))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(vkLayout)))
 			layoutObj := GetState(s).DescriptorSetLayouts().Get(vkLayout)
-			write(ctx, bh, vb.toVkHandle(uint64(vkSet)))
+			vb.write(ctx, bh, vb.toVkHandle(uint64(vkSet)))
 			vb.descriptorSets[vkSet] = newDescriptorSet()
+			_, vb.descriptorSets[vkSet].updateAfterBind = vb.updateAfterBindLayouts[vkLayout]
+			if _, ok := vb.descriptorPools[info.DescriptorPool()]; !ok {
+				vb.descriptorPools[info.DescriptorPool()] = map[VkDescriptorSet]struct{}{}
+			}
+			vb.descriptorPools[info.DescriptorPool()][vkSet] = struct{}{}
 			for bi, bindingInfo := range layoutObj.Bindings().All() {
 				for di := uint32(0); di < bindingInfo.Count(); di++ {
-					vb.descriptorSets[vkSet].reserveDescriptor(uint64(bi), uint64(di))
+					vb.descriptorSets[vkSet].reserveDescriptor(uint64(bi), uint64(di), bindingInfo.Type())
 				}
 			}
 		}
@@ -1891,7 +3292,7 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		if writeCount > 0 {
 			for _, write := range cmd.PDescriptorWrites().Slice(0, uint64(writeCount),
 				l).MustRead(ctx, cmd, s, nil) {
-				read(ctx, bh, vb.toVkHandle(uint64(write.DstSet())))
+				vb.read(ctx, bh, vb.toVkHandle(uint64(write.DstSet())))
 				ds := vb.descriptorSets[write.DstSet()]
 				ds.writeDescriptors(ctx, cmd, s, vb, bh, write)
 			}
@@ -1900,9 +3301,9 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		if copyCount > 0 {
 			for _, copy := range cmd.PDescriptorCopies().Slice(0, uint64(copyCount),
 				l).MustRead(ctx, cmd, s, nil) {
-				read(ctx, bh, vb.toVkHandle(uint64(copy.SrcSet())))
-				read(ctx, bh, vb.toVkHandle(uint64(copy.DstSet())))
-				vb.descriptorSets[copy.DstSet()].copyDescriptors(ctx, cmd, s, bh,
+				vb.read(ctx, bh, vb.toVkHandle(uint64(copy.SrcSet())))
+				vb.read(ctx, bh, vb.toVkHandle(uint64(copy.DstSet())))
+				vb.descriptorSets[copy.DstSet()].copyDescriptors(ctx, cmd, s, vb, bh,
 					vb.descriptorSets[copy.SrcSet()], copy)
 			}
 		}
@@ -1910,126 +3311,210 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 	case *VkFreeDescriptorSets:
 		count := uint64(cmd.DescriptorSetCount())
 		for _, vkSet := range cmd.PDescriptorSets().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
-			read(ctx, bh, vb.toVkHandle(uint64(vkSet)))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(vkSet)))
 			delete(vb.descriptorSets, vkSet)
+			delete(vb.descriptorPools[cmd.DescriptorPool()], vkSet)
 		}
 		bh.Alive = true
+	case *VkResetDescriptorPool:
+		vb.freeDescriptorPoolSets(ctx, bh, cmd.DescriptorPool())
+		bh.Alive = true
+	case *VkDestroyDescriptorPool:
+		vb.freeDescriptorPoolSets(ctx, bh, cmd.DescriptorPool())
+		bh.Alive = true
 
 	// pipelines
 	case *VkCreatePipelineLayout:
 		info := cmd.PCreateInfo().MustRead(ctx, cmd, s, nil)
-		write(ctx, bh, vb.toVkHandle(uint64(cmd.PPipelineLayout().MustRead(ctx, cmd, s, nil))))
+		vb.write(ctx, bh, vb.toVkHandle(uint64(cmd.PPipelineLayout().MustRead(ctx, cmd, s, nil))))
 		setCount := uint64(info.SetLayoutCount())
 		for _, setLayout := range info.PSetLayouts().Slice(0, setCount, l).MustRead(ctx, cmd, s, nil) {
-			read(ctx, bh, vb.toVkHandle(uint64(setLayout)))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(setLayout)))
 		}
 	case *VkDestroyPipelineLayout:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.PipelineLayout())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.PipelineLayout())))
 		bh.Alive = true
 	case *VkCreateGraphicsPipelines:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.PipelineCache())))
+		vb.writePipelineCache(ctx, bh, cmd.PipelineCache())
 		infoCount := uint64(cmd.CreateInfoCount())
 		for _, info := range cmd.PCreateInfos().Slice(0, infoCount, l).MustRead(ctx, cmd, s, nil) {
 			stageCount := uint64(info.StageCount())
 			for _, stage := range info.PStages().Slice(0, stageCount, l).MustRead(ctx, cmd, s, nil) {
 				module := stage.Module()
-				read(ctx, bh, vb.toVkHandle(uint64(module)))
+				vb.read(ctx, bh, vb.toVkHandle(uint64(module)))
 			}
-			read(ctx, bh, vb.toVkHandle(uint64(info.Layout())))
-			read(ctx, bh, vb.toVkHandle(uint64(info.RenderPass())))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(info.Layout())))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(info.RenderPass())))
 		}
 		for _, vkPl := range cmd.PPipelines().Slice(0, infoCount, l).MustRead(ctx, cmd, s, nil) {
-			write(ctx, bh, vb.toVkHandle(uint64(vkPl)))
+			vb.write(ctx, bh, vb.toVkHandle(uint64(vkPl)))
 		}
 	case *VkCreateComputePipelines:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.PipelineCache())))
+		vb.writePipelineCache(ctx, bh, cmd.PipelineCache())
 		infoCount := uint64(cmd.CreateInfoCount())
 		for _, info := range cmd.PCreateInfos().Slice(0, infoCount, l).MustRead(ctx, cmd, s, nil) {
 			stage := info.Stage()
 			module := stage.Module()
-			read(ctx, bh, vb.toVkHandle(uint64(module)))
-			read(ctx, bh, vb.toVkHandle(uint64(info.Layout())))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(module)))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(info.Layout())))
 		}
 		for _, vkPl := range cmd.PPipelines().Slice(0, infoCount, l).MustRead(ctx, cmd, s, nil) {
-			write(ctx, bh, vb.toVkHandle(uint64(vkPl)))
+			vb.write(ctx, bh, vb.toVkHandle(uint64(vkPl)))
 		}
 	case *VkDestroyPipeline:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Pipeline())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Pipeline())))
 		bh.Alive = true
 
 	case *VkCreatePipelineCache:
-		write(ctx, bh, vb.toVkHandle(uint64(cmd.PPipelineCache().MustRead(ctx, cmd, s, nil))))
+		vkCache := cmd.PPipelineCache().MustRead(ctx, cmd, s, nil)
+		vb.write(ctx, bh, vb.toVkHandle(uint64(vkCache)))
+		vb.pipelineCaches[vkCache] = newPipelineCache(vb.labels)
+		vb.write(ctx, bh, vb.pipelineCaches[vkCache].content[0])
 	case *VkDestroyPipelineCache:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.PipelineCache())))
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.PipelineCache()))) {
+			delete(vb.pipelineCaches, cmd.PipelineCache())
+		}
 		bh.Alive = true
 	case *VkGetPipelineCacheData:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.PipelineCache())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.PipelineCache())))
+		if pc, ok := vb.pipelineCaches[cmd.PipelineCache()]; ok {
+			vb.read(ctx, bh, pc.contentDeps()...)
+		}
 	case *VkMergePipelineCaches:
-		modify(ctx, bh, vb.toVkHandle(uint64(cmd.DstCache())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.DstCache())))
+		dst, ok := vb.pipelineCaches[cmd.DstCache()]
+		if !ok {
+			break
+		}
 		srcCount := uint64(cmd.SrcCacheCount())
 		for _, src := range cmd.PSrcCaches().Slice(0, srcCount, l).MustRead(ctx, cmd, s, nil) {
-			read(ctx, bh, vb.toVkHandle(uint64(src)))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(src)))
+			if pc, ok := vb.pipelineCaches[src]; ok {
+				// The merge is the single contribution of the source caches to the
+				// destination, so the consumers of the destination cache depend on
+				// the contributors of the sources through the merge.
+				vb.read(ctx, bh, pc.contentDeps()...)
+			}
+		}
+		dst.contribute(ctx, vb, bh)
+
+	// video session
+	case *VkCreateVideoSessionKHR:
+		vkSession := cmd.PVideoSession().MustRead(ctx, cmd, s, nil)
+		vb.write(ctx, bh, vb.toVkHandle(uint64(vkSession)))
+		vb.videoSessions[vkSession] = newVideoSession(vb.labels)
+	case *VkDestroyVideoSessionKHR:
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.VideoSession()))) {
+			delete(vb.videoSessions, cmd.VideoSession())
+			delete(vb.memoryRequirements, uint64(cmd.VideoSession()))
+		}
+		bh.Alive = true
+	case *VkGetVideoSessionMemoryRequirementsKHR:
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.VideoSession())))
+		vb.write(ctx, bh, vb.getMemoryRequirements(uint64(cmd.VideoSession())))
+	case *VkBindVideoSessionMemoryKHR:
+		if !vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.VideoSession()))) {
+			break
+		}
+		vb.read(ctx, bh, vb.getMemoryRequirements(uint64(cmd.VideoSession())))
+		count := uint64(cmd.BindSessionMemoryInfoCount())
+		for _, bind := range cmd.PBindSessionMemoryInfos().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
+			vb.read(ctx, bh, vb.toVkHandle(uint64(bind.Memory())))
+			vb.read(ctx, bh, vb.newMemorySpan(bind.Memory(), uint64(bind.MemoryOffset()),
+				uint64(bind.MemorySize())))
+		}
+		// Memory can be bound to different bind indices of a session by
+		// multiple commands, all of them are required.
+		if vs, ok := vb.videoSessions[cmd.VideoSession()]; ok {
+			vb.modify(ctx, bh, vs.memory)
+		}
+	case *VkCreateVideoSessionParametersKHR:
+		info := cmd.PCreateInfo().MustRead(ctx, cmd, s, nil)
+		vb.read(ctx, bh, vb.toVkHandle(uint64(info.VideoSession())))
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(info.VideoSessionParametersTemplate()))) {
+			if content, ok := vb.videoSessionParameters[info.VideoSessionParametersTemplate()]; ok {
+				vb.read(ctx, bh, content)
+			}
 		}
+		vkParams := cmd.PVideoSessionParameters().MustRead(ctx, cmd, s, nil)
+		vb.write(ctx, bh, vb.toVkHandle(uint64(vkParams)))
+		vb.videoSessionParameters[vkParams] = vb.labels.newLabel()
+		vb.write(ctx, bh, vb.videoSessionParameters[vkParams])
+	case *VkUpdateVideoSessionParametersKHR:
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.VideoSessionParameters())))
+		if content, ok := vb.videoSessionParameters[cmd.VideoSessionParameters()]; ok {
+			// Updates add parameters to the existing ones.
+			vb.modify(ctx, bh, content)
+		}
+	case *VkDestroyVideoSessionParametersKHR:
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.VideoSessionParameters()))) {
+			delete(vb.videoSessionParameters, cmd.VideoSessionParameters())
+		}
+		bh.Alive = true
 
 	// Shader module
 	case *VkCreateShaderModule:
-		write(ctx, bh, vb.toVkHandle(uint64(cmd.PShaderModule().MustRead(ctx, cmd, s, nil))))
+		vb.write(ctx, bh, vb.toVkHandle(uint64(cmd.PShaderModule().MustRead(ctx, cmd, s, nil))))
 	case *VkDestroyShaderModule:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.ShaderModule())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.ShaderModule())))
 		bh.Alive = true
 
 	// create/destroy renderpass
 	case *VkCreateRenderPass:
-		write(ctx, bh, vb.toVkHandle(uint64(cmd.PRenderPass().MustRead(ctx, cmd, s, nil))))
+		vb.write(ctx, bh, vb.toVkHandle(uint64(cmd.PRenderPass().MustRead(ctx, cmd, s, nil))))
+	case *VkCreateRenderPass2:
+		vb.write(ctx, bh, vb.toVkHandle(uint64(cmd.PRenderPass().MustRead(ctx, cmd, s, nil))))
 	case *VkDestroyRenderPass:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.RenderPass())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.RenderPass())))
 		bh.Alive = true
 
 	// create/destroy framebuffer
 	case *VkCreateFramebuffer:
 		info := cmd.PCreateInfo().MustRead(ctx, cmd, s, nil)
-		read(ctx, bh, vb.toVkHandle(uint64(info.RenderPass())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(info.RenderPass())))
 		attCount := uint64(info.AttachmentCount())
 		for _, att := range info.PAttachments().Slice(0, attCount, l).MustRead(ctx, cmd, s, nil) {
-			read(ctx, bh, vb.toVkHandle(uint64(att)))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(att)))
 		}
-		write(ctx, bh, vb.toVkHandle(uint64(cmd.PFramebuffer().MustRead(ctx, cmd, s, nil))))
+		vb.write(ctx, bh, vb.toVkHandle(uint64(cmd.PFramebuffer().MustRead(ctx, cmd, s, nil))))
 	case *VkDestroyFramebuffer:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Framebuffer())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Framebuffer())))
 		bh.Alive = true
 
 	// debug marker name and tag setting commands. Always kept alive.
 	case *VkDebugMarkerSetObjectTagEXT:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.PTagInfo().MustRead(ctx, cmd, s, nil).Object())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.PTagInfo().MustRead(ctx, cmd, s, nil).Object())))
 		bh.Alive = true
 	case *VkDebugMarkerSetObjectNameEXT:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.PNameInfo().MustRead(ctx, cmd, s, nil).Object())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.PNameInfo().MustRead(ctx, cmd, s, nil).Object())))
 		bh.Alive = true
 
 	// commandbuffer
 	case *VkAllocateCommandBuffers:
 		count := uint64(cmd.PAllocateInfo().MustRead(ctx, cmd, s, nil).CommandBufferCount())
 		for _, vkCb := range cmd.PCommandBuffers().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
-			write(ctx, bh, vb.toVkHandle(uint64(vkCb)))
-			vb.commandBuffers[vkCb] = &commandBuffer{begin: newLabel(),
-				end: newLabel(), renderPassBegin: newLabel()}
+			vb.write(ctx, bh, vb.toVkHandle(uint64(vkCb)))
+			vb.commandBuffers[vkCb] = &commandBuffer{begin: vb.labels.newLabel(),
+				end: vb.labels.newLabel(), renderPassBegin: vb.labels.newLabel(),
+				descriptorSets: map[VkDescriptorSet]struct{}{}}
 		}
 
 	case *VkResetCommandBuffer:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.CommandBuffer())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.CommandBuffer())))
 		if _, ok := vb.commandBuffers[cmd.CommandBuffer()]; ok {
-			write(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].begin)
-			write(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].end)
+			vb.write(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].begin)
+			vb.write(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].end)
 			vb.commands[cmd.CommandBuffer()] = []*commandBufferCommand{}
+			vb.commandBuffers[cmd.CommandBuffer()].descriptorSets = map[VkDescriptorSet]struct{}{}
 		}
 
 	case *VkFreeCommandBuffers:
 		count := uint64(cmd.CommandBufferCount())
 		for _, vkCb := range cmd.PCommandBuffers().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
 			if _, ok := vb.commandBuffers[vkCb]; ok {
-				if read(ctx, bh, vb.toVkHandle(uint64(vkCb))) {
-					write(ctx, bh, vb.commandBuffers[vkCb].begin)
-					write(ctx, bh, vb.commandBuffers[vkCb].end)
+				if vb.read(ctx, bh, vb.toVkHandle(uint64(vkCb))) {
+					vb.write(ctx, bh, vb.commandBuffers[vkCb].begin)
+					vb.write(ctx, bh, vb.commandBuffers[vkCb].end)
 					delete(vb.commandBuffers, vkCb)
 					delete(vb.commands, vkCb)
 				}
@@ -2038,30 +3523,35 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		bh.Alive = true
 
 	case *VkBeginCommandBuffer:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.CommandBuffer())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.CommandBuffer())))
 		if _, ok := vb.commandBuffers[cmd.CommandBuffer()]; ok {
-			write(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].begin)
+			vb.write(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].begin)
 			vb.commands[cmd.CommandBuffer()] = []*commandBufferCommand{}
+			vb.commandBuffers[cmd.CommandBuffer()].descriptorSets = map[VkDescriptorSet]struct{}{}
 		}
 	case *VkEndCommandBuffer:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.CommandBuffer())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.CommandBuffer())))
 		if _, ok := vb.commandBuffers[cmd.CommandBuffer()]; ok {
-			read(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].begin)
-			write(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].end)
+			vb.read(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].begin)
+			vb.write(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].end)
 		}
 
 	// copy, blit, resolve, clear, fill, update image and buffer
 	case *VkCmdCopyImage:
-		dst := vb.getImageData(ctx, bh, cmd.DstImage())
-		src := vb.getImageData(ctx, bh, cmd.SrcImage())
 		overwritten := false
 		count := uint64(cmd.RegionCount())
+		srcLayers := make([]VkImageSubresourceLayers, 0, count)
+		dstLayers := make([]VkImageSubresourceLayers, 0, count)
 		// TODO: check dst image coverage correctly
 		for _, region := range cmd.PRegions().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
 			overwritten = overwritten || subresourceLayersFullyCoverImage(
 				GetState(s).Images().Get(cmd.DstImage()),
 				region.DstSubresource(), region.DstOffset(), region.Extent())
+			srcLayers = append(srcLayers, region.SrcSubresource())
+			dstLayers = append(dstLayers, region.DstSubresource())
 		}
+		dst := vb.getImageSubresourceData(ctx, bh, cmd.DstImage(), dstLayers...)
+		src := vb.getImageSubresourceData(ctx, bh, cmd.SrcImage(), srcLayers...)
 		if overwritten {
 			vb.recordReadsWritesModifies(
 				ctx, ft, bh, cmd.CommandBuffer(), src, dst, emptyDefUseVars)
@@ -2080,27 +3570,35 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 			dst = append(dst, vb.getBufferData(ctx, bh, cmd.DstBuffer(),
 				uint64(region.DstOffset()), uint64(region.Size()))...)
 		}
+		vb.lint.recordUpload(id, cmd.DstBuffer(), GetState(s).Buffers().Get(cmd.DstBuffer()))
 		vb.recordReadsWritesModifies(
 			ctx, ft, bh, cmd.CommandBuffer(), src, dst, emptyDefUseVars)
 
 	case *VkCmdCopyImageToBuffer:
 		// TODO: calculate the ranges for the overwritten data
 		dst := vb.getBufferData(ctx, bh, cmd.DstBuffer(), 0, vkWholeSize)
-		src := vb.getImageData(ctx, bh, cmd.SrcImage())
+		count := uint64(cmd.RegionCount())
+		srcLayers := make([]VkImageSubresourceLayers, 0, count)
+		for _, region := range cmd.PRegions().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
+			srcLayers = append(srcLayers, region.ImageSubresource())
+		}
+		src := vb.getImageSubresourceData(ctx, bh, cmd.SrcImage(), srcLayers...)
 		vb.recordReadsWritesModifies(
 			ctx, ft, bh, cmd.CommandBuffer(), src, emptyDefUseVars, dst)
 
 	case *VkCmdCopyBufferToImage:
 		// TODO: calculate the ranges for the source data
 		src := vb.getBufferData(ctx, bh, cmd.SrcBuffer(), 0, vkWholeSize)
-		dst := vb.getImageData(ctx, bh, cmd.DstImage())
 		overwritten := false
 		count := uint64(cmd.RegionCount())
+		dstLayers := make([]VkImageSubresourceLayers, 0, count)
 		for _, region := range cmd.PRegions().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
 			overwritten = overwritten || subresourceLayersFullyCoverImage(
 				GetState(s).Images().Get(cmd.DstImage()),
 				region.ImageSubresource(), region.ImageOffset(), region.ImageExtent())
+			dstLayers = append(dstLayers, region.ImageSubresource())
 		}
+		dst := vb.getImageSubresourceData(ctx, bh, cmd.DstImage(), dstLayers...)
 		if overwritten {
 			vb.recordReadsWritesModifies(
 				ctx, ft, bh, cmd.CommandBuffer(), src, dst, emptyDefUseVars)
@@ -2110,41 +3608,68 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		}
 
 	case *VkCmdBlitImage:
-		src := vb.getImageData(ctx, bh, cmd.SrcImage())
-		dst := vb.getImageData(ctx, bh, cmd.DstImage())
 		overwritten := false
 		count := uint64(cmd.RegionCount())
+		srcLayers := make([]VkImageSubresourceLayers, 0, count)
+		dstLayers := make([]VkImageSubresourceLayers, 0, count)
 		for _, region := range cmd.PRegions().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
 			overwritten = overwritten || blitFullyCoverImage(
 				GetState(s).Images().Get(cmd.DstImage()),
 				region.DstSubresource(),
 				region.DstOffsets().Get(0), region.DstOffsets().Get(1))
+			srcLayers = append(srcLayers, region.SrcSubresource())
+			dstLayers = append(dstLayers, region.DstSubresource())
 		}
-		if overwritten {
-			vb.recordReadsWritesModifies(
-				ctx, ft, bh, cmd.CommandBuffer(), src, dst, emptyDefUseVars)
-		} else {
-			vb.recordReadsWritesModifies(
-				ctx, ft, bh, cmd.CommandBuffer(), src, emptyDefUseVars, dst)
+		vb.recordImageTransfer(ctx, ft, bh, cmd.CommandBuffer(), cmd.SrcImage(),
+			cmd.DstImage(), srcLayers, dstLayers, overwritten)
+
+	case *VkCmdBlitImage2KHR:
+		info := cmd.PBlitImageInfo().MustRead(ctx, cmd, s, nil)
+		overwritten := false
+		count := uint64(info.RegionCount())
+		srcLayers := make([]VkImageSubresourceLayers, 0, count)
+		dstLayers := make([]VkImageSubresourceLayers, 0, count)
+		for _, region := range info.PRegions().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
+			overwritten = overwritten || blitFullyCoverImage(
+				GetState(s).Images().Get(info.DstImage()),
+				region.DstSubresource(),
+				region.DstOffsets().Get(0), region.DstOffsets().Get(1))
+			srcLayers = append(srcLayers, region.SrcSubresource())
+			dstLayers = append(dstLayers, region.DstSubresource())
 		}
+		vb.recordImageTransfer(ctx, ft, bh, cmd.CommandBuffer(), info.SrcImage(),
+			info.DstImage(), srcLayers, dstLayers, overwritten)
 
 	case *VkCmdResolveImage:
-		src := vb.getImageData(ctx, bh, cmd.SrcImage())
-		dst := vb.getImageData(ctx, bh, cmd.DstImage())
 		overwritten := false
 		count := uint64(cmd.RegionCount())
+		srcLayers := make([]VkImageSubresourceLayers, 0, count)
+		dstLayers := make([]VkImageSubresourceLayers, 0, count)
 		for _, region := range cmd.PRegions().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
 			overwritten = overwritten || subresourceLayersFullyCoverImage(
 				GetState(s).Images().Get(cmd.DstImage()),
 				region.DstSubresource(), region.DstOffset(), region.Extent())
+			srcLayers = append(srcLayers, region.SrcSubresource())
+			dstLayers = append(dstLayers, region.DstSubresource())
 		}
-		if overwritten {
-			vb.recordReadsWritesModifies(
-				ctx, ft, bh, cmd.CommandBuffer(), src, dst, emptyDefUseVars)
-		} else {
-			vb.recordReadsWritesModifies(
-				ctx, ft, bh, cmd.CommandBuffer(), src, emptyDefUseVars, dst)
+		vb.recordImageTransfer(ctx, ft, bh, cmd.CommandBuffer(), cmd.SrcImage(),
+			cmd.DstImage(), srcLayers, dstLayers, overwritten)
+
+	case *VkCmdResolveImage2KHR:
+		info := cmd.PResolveImageInfo().MustRead(ctx, cmd, s, nil)
+		overwritten := false
+		count := uint64(info.RegionCount())
+		srcLayers := make([]VkImageSubresourceLayers, 0, count)
+		dstLayers := make([]VkImageSubresourceLayers, 0, count)
+		for _, region := range info.PRegions().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
+			overwritten = overwritten || subresourceLayersFullyCoverImage(
+				GetState(s).Images().Get(info.DstImage()),
+				region.DstSubresource(), region.DstOffset(), region.Extent())
+			srcLayers = append(srcLayers, region.SrcSubresource())
+			dstLayers = append(dstLayers, region.DstSubresource())
 		}
+		vb.recordImageTransfer(ctx, ft, bh, cmd.CommandBuffer(), info.SrcImage(),
+			info.DstImage(), srcLayers, dstLayers, overwritten)
 
 	case *VkCmdFillBuffer:
 		dst := vb.getBufferData(ctx, bh, cmd.DstBuffer(), uint64(cmd.DstOffset()), uint64(cmd.Size()))
@@ -2153,18 +3678,20 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 
 	case *VkCmdUpdateBuffer:
 		dst := vb.getBufferData(ctx, bh, cmd.DstBuffer(), uint64(cmd.DstOffset()), uint64(cmd.DataSize()))
+		vb.lint.recordUpload(id, cmd.DstBuffer(), GetState(s).Buffers().Get(cmd.DstBuffer()))
 		vb.recordReadsWritesModifies(ctx, ft, bh, cmd.CommandBuffer(),
 			emptyDefUseVars, dst, emptyDefUseVars)
 
 	case *VkCmdClearColorImage:
-		dst := vb.getImageData(ctx, bh, cmd.Image())
 		count := uint64(cmd.RangeCount())
 		overwritten := false
-		for _, rng := range cmd.PRanges().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
+		rngs := cmd.PRanges().Slice(0, count, l).MustRead(ctx, cmd, s, nil)
+		for _, rng := range rngs {
 			if subresourceRangeFullyCoverImage(GetState(s).Images().Get(cmd.Image()), rng) {
 				overwritten = true
 			}
 		}
+		dst := vb.getImageSubresourceRangeData(ctx, bh, cmd.Image(), rngs...)
 		if overwritten {
 			vb.recordReadsWritesModifies(ctx, ft, bh, cmd.CommandBuffer(),
 				emptyDefUseVars, dst, emptyDefUseVars)
@@ -2174,14 +3701,15 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		}
 
 	case *VkCmdClearDepthStencilImage:
-		dst := vb.getImageData(ctx, bh, cmd.Image())
 		count := uint64(cmd.RangeCount())
 		overwritten := false
-		for _, rng := range cmd.PRanges().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
+		rngs := cmd.PRanges().Slice(0, count, l).MustRead(ctx, cmd, s, nil)
+		for _, rng := range rngs {
 			if subresourceRangeFullyCoverImage(GetState(s).Images().Get(cmd.Image()), rng) {
 				overwritten = true
 			}
 		}
+		dst := vb.getImageSubresourceRangeData(ctx, bh, cmd.Image(), rngs...)
 		if overwritten {
 			vb.recordReadsWritesModifies(ctx, ft, bh, cmd.CommandBuffer(),
 				emptyDefUseVars, dst, emptyDefUseVars)
@@ -2192,66 +3720,28 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 
 	// renderpass and subpass
 	case *VkCmdBeginRenderPass:
-		vkRp := cmd.PRenderPassBegin().MustRead(ctx, cmd, s, nil).RenderPass()
-		read(ctx, bh, vb.toVkHandle(uint64(vkRp)))
-		vkFb := cmd.PRenderPassBegin().MustRead(ctx, cmd, s, nil).Framebuffer()
-		read(ctx, bh, vb.toVkHandle(uint64(vkFb)))
-		if _, ok := vb.commandBuffers[cmd.CommandBuffer()]; ok {
-			write(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].renderPassBegin)
-		}
-		rp := GetState(s).RenderPasses().Get(vkRp)
-		fb := GetState(s).Framebuffers().Get(vkFb)
-		read(ctx, bh, vb.toVkHandle(uint64(fb.RenderPass().VulkanHandle())))
-		for _, ia := range fb.ImageAttachments().All() {
-			if read(ctx, bh, vb.toVkHandle(uint64(ia.VulkanHandle()))) {
-				read(ctx, bh, vb.toVkHandle(uint64(ia.Image().VulkanHandle())))
-			}
-		}
-		if cbc := vb.newCommand(ctx, bh, cmd.CommandBuffer()); cbc != nil {
-			cbc.behave = func(sc submittedCommand,
-				execInfo *queueExecutionState) {
-				cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
-				execInfo.beginRenderPass(ctx, vb, cbh, rp, fb)
-				execInfo.renderPassBegin = newForwardPairedLabel(ctx, cbh)
-				ft.AddBehavior(ctx, cbh)
-				cbh.Alive = true // TODO(awoloszyn)(BUG:1158): Investigate why this is needed.
-				// Without this, we drop some needed commands.
-			}
-		}
-
+		vb.recordBeginRenderPass(ctx, s, ft, bh, cmd.CommandBuffer(),
+			cmd.PRenderPassBegin().MustRead(ctx, cmd, s, nil))
+	case *VkCmdBeginRenderPass2:
+		vb.recordBeginRenderPass(ctx, s, ft, bh, cmd.CommandBuffer(),
+			cmd.PRenderPassBegin().MustRead(ctx, cmd, s, nil))
 	case *VkCmdNextSubpass:
-		cbc := vb.newCommand(ctx, bh, cmd.CommandBuffer())
-		cbc.behave = func(sc submittedCommand,
-			execInfo *queueExecutionState) {
-			cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
-			execInfo.nextSubpass(ctx, ft, cbh, sc)
-			ft.AddBehavior(ctx, cbh)
-			cbh.Alive = true // TODO(awoloszyn)(BUG:1158): Investigate why this is needed.
-			// Without this, we drop some needed commands.
-		}
-
+		vb.recordNextSubpass(ctx, ft, bh, cmd.CommandBuffer())
+	case *VkCmdNextSubpass2:
+		vb.recordNextSubpass(ctx, ft, bh, cmd.CommandBuffer())
 	case *VkCmdEndRenderPass:
-		if _, ok := vb.commandBuffers[cmd.CommandBuffer()]; ok {
-			read(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].renderPassBegin)
-			cbc := vb.newCommand(ctx, bh, cmd.CommandBuffer())
-			cbc.behave = func(sc submittedCommand,
-				execInfo *queueExecutionState) {
-				cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
-				execInfo.endRenderPass(ctx, ft, cbh, sc)
-				read(ctx, cbh, execInfo.renderPassBegin)
-				ft.AddBehavior(ctx, cbh)
-				cbh.Alive = true // TODO(awoloszyn)(BUG:1158): Investigate why this is needed.
-				// Without this, we drop some needed commands.
-			}
-		}
+		vb.recordEndRenderPass(ctx, ft, bh, cmd.CommandBuffer())
+	case *VkCmdEndRenderPass2:
+		vb.recordEndRenderPass(ctx, ft, bh, cmd.CommandBuffer())
 
 	// bind vertex buffers, index buffer, pipeline and descriptors
 	case *VkCmdBindVertexBuffers:
 		count := uint64(cmd.BindingCount())
 		offsets := cmd.POffsets().Slice(0, count, l).MustRead(ctx, cmd, s, nil)
 		subBindings := []resBindingList{}
-		for i, vkBuf := range cmd.PBuffers().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
-			subBindings = append(subBindings, vb.buffers[vkBuf].getSubBindingList(ctx, bh,
+		vkBufs := cmd.PBuffers().Slice(0, count, l).MustRead(ctx, cmd, s, nil)
+		for i, vkBuf := range vkBufs {
+			subBindings = append(subBindings, vb.buffers[vkBuf].getSubBindingList(ctx, vb, bh,
 				uint64(offsets[i]), vkWholeSize))
 		}
 		firstBinding := cmd.FirstBinding()
@@ -2262,38 +3752,60 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 			for i, sb := range subBindings {
 				binding := firstBinding + uint32(i)
 				execInfo.currentCmdBufState.vertexBufferResBindings[binding] = sb
+				execInfo.currentCmdBufState.vertexBuffers[binding] = vkBufs[i]
+				execInfo.currentCmdBufState.vertexBufferOffsets[binding] = uint64(offsets[i])
 			}
 			ft.AddBehavior(ctx, cbh)
 		}
 	case *VkCmdBindIndexBuffer:
-		subBindings := vb.buffers[cmd.Buffer()].getSubBindingList(ctx, bh,
+		subBindings := vb.buffers[cmd.Buffer()].getSubBindingList(ctx, vb, bh,
 			uint64(cmd.Offset()), vkWholeSize)
 		cbc := vb.newCommand(ctx, bh, cmd.CommandBuffer())
 		cbc.behave = func(sc submittedCommand,
 			execInfo *queueExecutionState) {
 			cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
 			execInfo.currentCmdBufState.indexBufferResBindings = subBindings
+			execInfo.currentCmdBufState.indexBuffer = cmd.Buffer()
+			execInfo.currentCmdBufState.indexBufferOffset = uint64(cmd.Offset())
 			execInfo.currentCmdBufState.indexType = cmd.IndexType()
 			ft.AddBehavior(ctx, cbh)
 		}
 	case *VkCmdBindPipeline:
 		vkPi := cmd.Pipeline()
-		read(ctx, bh, vb.toVkHandle(uint64(vkPi)))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(vkPi)))
+		isGraphics := cmd.PipelineBindPoint() == VkPipelineBindPoint_VK_PIPELINE_BIND_POINT_GRAPHICS
+		var vertexInputBindings map[uint32]VkVertexInputBindingDescription
+		var vertexSizes map[uint32]uint64
+		if gp := GetState(s).GraphicsPipelines().Get(vkPi); isGraphics && !gp.IsNil() {
+			bindings := gp.VertexInputState().BindingDescriptions()
+			vertexInputBindings = make(map[uint32]VkVertexInputBindingDescription, bindings.Len())
+			for _, binding := range bindings.Keys() {
+				vertexInputBindings[binding] = bindings.Get(binding)
+			}
+			vertexSizes = vertexInputSizes(ctx, s, gp.VertexInputState().AttributeDescriptions())
+		}
 		cbc := vb.newCommand(ctx, bh, cmd.CommandBuffer())
 		cbc.behave = func(sc submittedCommand,
 			execInfo *queueExecutionState) {
 			cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
-			read(ctx, cbh, vb.toVkHandle(uint64(vkPi)))
-			write(ctx, cbh, execInfo.currentCmdBufState.pipeline)
+			vb.read(ctx, cbh, vb.toVkHandle(uint64(vkPi)))
+			vb.write(ctx, cbh, execInfo.currentCmdBufState.pipeline)
+			execInfo.currentCmdBufState.pipelines[cmd.PipelineBindPoint()] = vkPi
+			if isGraphics {
+				execInfo.currentCmdBufState.vertexInputBindings = vertexInputBindings
+				execInfo.currentCmdBufState.vertexSizes = vertexSizes
+			}
 			ft.AddBehavior(ctx, cbh)
 		}
 	case *VkCmdBindDescriptorSets:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Layout())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Layout())))
 		count := uint64(cmd.DescriptorSetCount())
-		dss := make([]*descriptorSet, 0, count)
-		for _, vkSet := range cmd.PDescriptorSets().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
-			read(ctx, bh, vb.toVkHandle(uint64(vkSet)))
-			dss = append(dss, vb.descriptorSets[vkSet])
+		vkSets := cmd.PDescriptorSets().Slice(0, count, l).MustRead(ctx, cmd, s, nil)
+		for _, vkSet := range vkSets {
+			vb.read(ctx, bh, vb.toVkHandle(uint64(vkSet)))
+			if cb, ok := vb.commandBuffers[cmd.CommandBuffer()]; ok {
+				cb.descriptorSets[vkSet] = struct{}{}
+			}
 		}
 		firstSet := cmd.FirstSet()
 		dOffsets := []uint32{}
@@ -2305,9 +3817,25 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		cbc.behave = func(sc submittedCommand,
 			execInfo *queueExecutionState) {
 			cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
-			for i, ds := range dss {
+			// The dynamic offsets are consumed by the sets in order.
+			setOffsets := dOffsets
+			for i, vkSet := range vkSets {
+				// Use the descriptors resolved at submission, as they may have
+				// been updated after binding.
+				ds, ok := execInfo.currentSubmitInfo.descriptorSets[vkSet]
+				if !ok {
+					ds = vb.descriptorSets[vkSet]
+				}
 				set := firstSet + uint32(i)
-				execInfo.currentCmdBufState.descriptorSets[set] = newBoundDescriptorSet(ctx, cbh, ds, dOffsets)
+				bds := newBoundDescriptorSet(ctx, vb, cbh, cmd.Layout(), vkSet, ds, setOffsets)
+				if n := int(ds.dynamicDescriptorCount); n < len(setOffsets) {
+					setOffsets = setOffsets[n:]
+				} else {
+					setOffsets = nil
+				}
+				vb.lint.bindDescriptorSet(set,
+					execInfo.currentCmdBufState.descriptorSets[set], bds)
+				execInfo.currentCmdBufState.descriptorSets[set] = bds
 			}
 			ft.AddBehavior(ctx, cbh)
 		}
@@ -2315,32 +3843,40 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 	// draw and dispatch
 	case *VkCmdDraw:
 		if _, ok := vb.commandBuffers[cmd.CommandBuffer()]; ok {
-			read(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].renderPassBegin)
+			vb.read(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].renderPassBegin)
 			cbc := vb.newCommand(ctx, bh, cmd.CommandBuffer())
 			cbc.behave = func(sc submittedCommand,
 				execInfo *queueExecutionState) {
 				cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
-				vb.draw(ctx, cbh, execInfo)
+				vb.draw(ctx, cbh, execInfo, uint64(cmd.FirstVertex()), uint64(cmd.VertexCount()),
+					uint64(cmd.FirstInstance()), uint64(cmd.InstanceCount()))
 				ft.AddBehavior(ctx, cbh)
 			}
 		}
 
 	case *VkCmdDrawIndexed:
 		if _, ok := vb.commandBuffers[cmd.CommandBuffer()]; ok {
-			read(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].renderPassBegin)
+			vb.read(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].renderPassBegin)
 			cbc := vb.newCommand(ctx, bh, cmd.CommandBuffer())
 			cbc.behave = func(sc submittedCommand,
 				execInfo *queueExecutionState) {
 				cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
 				vb.readBoundIndexBuffer(ctx, cbh, execInfo, cmd)
-				vb.draw(ctx, cbh, execInfo)
+				// The vertices fetched depend on the index values.
+				firstVertex, vertexCount := uint64(0), vkWholeSize
+				if r, ok := vb.indexedVertexRanges.Value(sc.id).(vertexRange); ok {
+					firstVertex, vertexCount = r.first, r.count
+					vb.indexedVertexRanges.RemoveValue(sc.id)
+				}
+				vb.draw(ctx, cbh, execInfo, firstVertex, vertexCount,
+					uint64(cmd.FirstInstance()), uint64(cmd.InstanceCount()))
 				ft.AddBehavior(ctx, cbh)
 			}
 		}
 
 	case *VkCmdDrawIndirect:
 		if _, ok := vb.commandBuffers[cmd.CommandBuffer()]; ok {
-			read(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].renderPassBegin)
+			vb.read(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].renderPassBegin)
 		}
 		count := uint64(cmd.DrawCount())
 		sizeOfDrawIndirectdCommand := uint64(4 * 4)
@@ -2355,15 +3891,15 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 			cbc.behave = func(sc submittedCommand,
 				execInfo *queueExecutionState) {
 				cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
-				vb.draw(ctx, cbh, execInfo)
-				read(ctx, cbh, src...)
+				vb.draw(ctx, cbh, execInfo, 0, vkWholeSize, 0, vkWholeSize)
+				vb.read(ctx, cbh, src...)
 				ft.AddBehavior(ctx, cbh)
 			}
 		}
 
 	case *VkCmdDrawIndexedIndirect:
 		if _, ok := vb.commandBuffers[cmd.CommandBuffer()]; ok {
-			read(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].renderPassBegin)
+			vb.read(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].renderPassBegin)
 		}
 		count := uint64(cmd.DrawCount())
 		sizeOfDrawIndexedIndirectCommand := uint64(5 * 4)
@@ -2379,20 +3915,88 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 				execInfo *queueExecutionState) {
 				cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
 				vb.readBoundIndexBuffer(ctx, cbh, execInfo, cmd)
-				vb.draw(ctx, cbh, execInfo)
-				read(ctx, cbh, src...)
+				vb.draw(ctx, cbh, execInfo, 0, vkWholeSize, 0, vkWholeSize)
+				vb.read(ctx, cbh, src...)
+				ft.AddBehavior(ctx, cbh)
+			}
+		}
+
+	case *VkCmdDrawIndirectCountKHR:
+		if _, ok := vb.commandBuffers[cmd.CommandBuffer()]; ok {
+			vb.read(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].renderPassBegin)
+		}
+		// The actual draw count is only known on the device, so all the
+		// commands up to the max draw count are considered to be read.
+		sizeOfDrawIndirectdCommand := uint64(4 * 4)
+		src := vb.getBufferData(ctx, bh, cmd.CountBuffer(), uint64(cmd.CountBufferOffset()), 4)
+		src = append(src, vb.getIndirectCommandsData(ctx, bh, cmd.Buffer(), uint64(cmd.Offset()),
+			uint64(cmd.MaxDrawCount()), uint64(cmd.Stride()), sizeOfDrawIndirectdCommand)...)
+		if cbc := vb.newCommand(ctx, bh, cmd.CommandBuffer()); cbc != nil {
+			cbc.behave = func(sc submittedCommand,
+				execInfo *queueExecutionState) {
+				cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
+				vb.draw(ctx, cbh, execInfo, 0, vkWholeSize, 0, vkWholeSize)
+				vb.read(ctx, cbh, src...)
+				ft.AddBehavior(ctx, cbh)
+			}
+		}
+
+	case *VkCmdDrawIndexedIndirectCountKHR:
+		if _, ok := vb.commandBuffers[cmd.CommandBuffer()]; ok {
+			vb.read(ctx, bh, vb.commandBuffers[cmd.CommandBuffer()].renderPassBegin)
+		}
+		sizeOfDrawIndexedIndirectCommand := uint64(5 * 4)
+		src := vb.getBufferData(ctx, bh, cmd.CountBuffer(), uint64(cmd.CountBufferOffset()), 4)
+		src = append(src, vb.getIndirectCommandsData(ctx, bh, cmd.Buffer(), uint64(cmd.Offset()),
+			uint64(cmd.MaxDrawCount()), uint64(cmd.Stride()), sizeOfDrawIndexedIndirectCommand)...)
+		if cbc := vb.newCommand(ctx, bh, cmd.CommandBuffer()); cbc != nil {
+			cbc.behave = func(sc submittedCommand,
+				execInfo *queueExecutionState) {
+				cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
+				vb.readBoundIndexBuffer(ctx, cbh, execInfo, cmd)
+				vb.draw(ctx, cbh, execInfo, 0, vkWholeSize, 0, vkWholeSize)
+				vb.read(ctx, cbh, src...)
 				ft.AddBehavior(ctx, cbh)
 			}
 		}
 
+	case *VkCmdDrawMeshTasksEXT:
+		vb.drawMeshTasks(ctx, ft, bh, cmd.CommandBuffer(), []dependencygraph.DefUseVariable{})
+	case *VkCmdDrawMeshTasksNV:
+		vb.drawMeshTasks(ctx, ft, bh, cmd.CommandBuffer(), []dependencygraph.DefUseVariable{})
+	case *VkCmdDrawMeshTasksIndirectEXT:
+		sizeOfDrawMeshTasksIndirectCommand := uint64(3 * 4)
+		src := vb.getIndirectCommandsData(ctx, bh, cmd.Buffer(), uint64(cmd.Offset()),
+			uint64(cmd.DrawCount()), uint64(cmd.Stride()), sizeOfDrawMeshTasksIndirectCommand)
+		vb.drawMeshTasks(ctx, ft, bh, cmd.CommandBuffer(), src)
+	case *VkCmdDrawMeshTasksIndirectNV:
+		sizeOfDrawMeshTasksIndirectCommand := uint64(2 * 4)
+		src := vb.getIndirectCommandsData(ctx, bh, cmd.Buffer(), uint64(cmd.Offset()),
+			uint64(cmd.DrawCount()), uint64(cmd.Stride()), sizeOfDrawMeshTasksIndirectCommand)
+		vb.drawMeshTasks(ctx, ft, bh, cmd.CommandBuffer(), src)
+	case *VkCmdDrawMeshTasksIndirectCountEXT:
+		// The actual draw count is only known on the device, so all the
+		// commands up to the max draw count are considered to be read.
+		sizeOfDrawMeshTasksIndirectCommand := uint64(3 * 4)
+		src := vb.getBufferData(ctx, bh, cmd.CountBuffer(), uint64(cmd.CountBufferOffset()), 4)
+		src = append(src, vb.getIndirectCommandsData(ctx, bh, cmd.Buffer(), uint64(cmd.Offset()),
+			uint64(cmd.MaxDrawCount()), uint64(cmd.Stride()), sizeOfDrawMeshTasksIndirectCommand)...)
+		vb.drawMeshTasks(ctx, ft, bh, cmd.CommandBuffer(), src)
+	case *VkCmdDrawMeshTasksIndirectCountNV:
+		sizeOfDrawMeshTasksIndirectCommand := uint64(2 * 4)
+		src := vb.getBufferData(ctx, bh, cmd.CountBuffer(), uint64(cmd.CountBufferOffset()), 4)
+		src = append(src, vb.getIndirectCommandsData(ctx, bh, cmd.Buffer(), uint64(cmd.Offset()),
+			uint64(cmd.MaxDrawCount()), uint64(cmd.Stride()), sizeOfDrawMeshTasksIndirectCommand)...)
+		vb.drawMeshTasks(ctx, ft, bh, cmd.CommandBuffer(), src)
+
 	case *VkCmdDispatch:
 		cbc := vb.newCommand(ctx, bh, cmd.CommandBuffer())
 		cbc.behave = func(sc submittedCommand,
 			execInfo *queueExecutionState) {
 			cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
-			read(ctx, cbh, execInfo.currentCmdBufState.pipeline)
+			vb.read(ctx, cbh, execInfo.currentCmdBufState.pipeline)
 			modified := vb.useBoundDescriptorSets(ctx, cbh, execInfo.currentCmdBufState)
-			modify(ctx, cbh, modified...)
+			vb.modify(ctx, cbh, modified...)
 			ft.AddBehavior(ctx, cbh)
 		}
 
@@ -2403,35 +4007,37 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		cbc.behave = func(sc submittedCommand,
 			execInfo *queueExecutionState) {
 			cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
-			read(ctx, cbh, execInfo.currentCmdBufState.pipeline)
+			vb.read(ctx, cbh, execInfo.currentCmdBufState.pipeline)
 			modified := vb.useBoundDescriptorSets(ctx, cbh, execInfo.currentCmdBufState)
-			modify(ctx, cbh, modified...)
-			read(ctx, cbh, src...)
+			vb.modify(ctx, cbh, modified...)
+			vb.read(ctx, cbh, src...)
 			ft.AddBehavior(ctx, cbh)
 		}
 
 	// pipeline settings
 	case *VkCmdPushConstants:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Layout())))
-		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer())
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Layout())))
+		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer(), cmd)
 	case *VkCmdSetLineWidth:
-		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer())
+		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer(), cmd)
 	case *VkCmdSetScissor:
-		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer())
+		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer(), cmd)
 	case *VkCmdSetViewport:
-		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer())
+		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer(), cmd)
 	case *VkCmdSetDepthBias:
-		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer())
+		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer(), cmd)
 	case *VkCmdSetDepthBounds:
-		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer())
+		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer(), cmd)
 	case *VkCmdSetBlendConstants:
-		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer())
+		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer(), cmd)
 	case *VkCmdSetStencilCompareMask:
-		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer())
+		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer(), cmd)
 	case *VkCmdSetStencilWriteMask:
-		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer())
+		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer(), cmd)
 	case *VkCmdSetStencilReference:
-		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer())
+		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer(), cmd)
+	case *VkCmdSetFragmentShadingRateKHR:
+		vb.recordModifingDynamicStates(ctx, ft, bh, cmd.CommandBuffer(), cmd)
 
 	// clear attachments
 	case *VkCmdClearAttachments:
@@ -2457,89 +4063,210 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 
 	// query pool commands
 	case *VkCmdResetQueryPool:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.QueryPool())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.QueryPool())))
 		resetLabels := []dependencygraph.DefUseVariable{}
 		count := uint64(cmd.QueryCount())
 		first := uint64(cmd.FirstQuery())
 		for i := uint64(0); i < count; i++ {
 			resetLabels = append(resetLabels,
-				vb.querypools[cmd.QueryPool()].queries[first+i].reset)
+				vb.querypools[cmd.QueryPool()].queries[first+i].reset,
+				vb.querypools[cmd.QueryPool()].queries[first+i].availability)
 		}
 		vb.recordReadsWritesModifies(ctx, ft, bh, cmd.CommandBuffer(), emptyDefUseVars,
 			resetLabels, emptyDefUseVars)
 	case *VkCmdBeginQuery:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.QueryPool())))
-		resetLabels := []dependencygraph.DefUseVariable{
-			vb.querypools[cmd.QueryPool()].queries[cmd.Query()].reset}
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.QueryPool())))
+		resetLabels := append([]dependencygraph.DefUseVariable{
+			vb.querypools[cmd.QueryPool()].queries[cmd.Query()].reset},
+			vb.querypools[cmd.QueryPool()].profilingLockDeps()...)
 		beginLabels := []dependencygraph.DefUseVariable{
 			vb.querypools[cmd.QueryPool()].queries[cmd.Query()].begin}
 		vb.recordReadsWritesModifies(ctx, ft, bh, cmd.CommandBuffer(), resetLabels,
 			beginLabels, emptyDefUseVars)
 	case *VkCmdEndQuery:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.QueryPool())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.QueryPool())))
 		endAndResultLabels := []dependencygraph.DefUseVariable{
 			vb.querypools[cmd.QueryPool()].queries[cmd.Query()].end,
 			vb.querypools[cmd.QueryPool()].queries[cmd.Query()].result,
+			vb.querypools[cmd.QueryPool()].queries[cmd.Query()].availability,
 		}
-		beginLabels := []dependencygraph.DefUseVariable{
-			vb.querypools[cmd.QueryPool()].queries[cmd.Query()].begin}
+		beginLabels := append([]dependencygraph.DefUseVariable{
+			vb.querypools[cmd.QueryPool()].queries[cmd.Query()].begin},
+			vb.querypools[cmd.QueryPool()].profilingLockDeps()...)
 		vb.recordReadsWritesModifies(ctx, ft, bh, cmd.CommandBuffer(), beginLabels,
 			endAndResultLabels, emptyDefUseVars)
 	case *VkCmdWriteTimestamp:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.QueryPool())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.QueryPool())))
 		resetLabels := []dependencygraph.DefUseVariable{
 			vb.querypools[cmd.QueryPool()].queries[cmd.Query()].reset}
 		resultLabels := []dependencygraph.DefUseVariable{
-			vb.querypools[cmd.QueryPool()].queries[cmd.Query()].result}
+			vb.querypools[cmd.QueryPool()].queries[cmd.Query()].result,
+			vb.querypools[cmd.QueryPool()].queries[cmd.Query()].availability}
 		vb.recordReadsWritesModifies(ctx, ft, bh, cmd.CommandBuffer(), resetLabels,
 			resultLabels, emptyDefUseVars)
 	case *VkCmdCopyQueryPoolResults:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.QueryPool())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.QueryPool())))
 		// TODO: calculate the range
 		src := []dependencygraph.DefUseVariable{}
 		dst := vb.getBufferData(ctx, bh, cmd.DstBuffer(), 0, vkWholeSize)
 		count := uint64(cmd.QueryCount())
 		first := uint64(cmd.FirstQuery())
 		for i := uint64(0); i < count; i++ {
-			src = append(src, vb.querypools[cmd.QueryPool()].queries[first+i].result)
+			src = append(src, vb.querypools[cmd.QueryPool()].queries[first+i].resultDependencies(cmd.Flags())...)
 		}
 		vb.recordReadsWritesModifies(ctx, ft, bh, cmd.CommandBuffer(), src, emptyDefUseVars, dst)
 
-	// debug marker extension commandbuffer commands. Those commands are kept
-	// alive if they are submitted.
+	// video coding commands
+	case *VkCmdBeginVideoCodingKHR:
+		info := cmd.PBeginInfo().MustRead(ctx, cmd, s, nil)
+		vb.read(ctx, bh, vb.toVkHandle(uint64(info.VideoSession())))
+		vs := vb.videoSessions[info.VideoSession()]
+		params := []dependencygraph.DefUseVariable{}
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(info.VideoSessionParameters()))) {
+			if content, ok := vb.videoSessionParameters[info.VideoSessionParameters()]; ok {
+				params = append(params, content)
+			}
+		}
+		cbc := vb.newCommand(ctx, bh, cmd.CommandBuffer())
+		cbc.behave = func(sc submittedCommand, execInfo *queueExecutionState) {
+			cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
+			vb.read(ctx, cbh, params...)
+			if vs != nil {
+				vb.read(ctx, cbh, vs.memory)
+			}
+			execInfo.currentCmdBufState.videoSession = vs
+			ft.AddBehavior(ctx, cbh)
+		}
+	case *VkCmdEndVideoCodingKHR:
+		cbc := vb.newCommand(ctx, bh, cmd.CommandBuffer())
+		cbc.behave = func(sc submittedCommand, execInfo *queueExecutionState) {
+			cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
+			execInfo.currentCmdBufState.videoSession = nil
+			ft.AddBehavior(ctx, cbh)
+		}
+	case *VkCmdControlVideoCodingKHR:
+		flags := cmd.PCodingControlInfo().MustRead(ctx, cmd, s, nil).Flags()
+		reset := flags&VkVideoCodingControlFlagsKHR(
+			VkVideoCodingControlFlagBitsKHR_VK_VIDEO_CODING_CONTROL_RESET_BIT_KHR) != 0
+		cbc := vb.newCommand(ctx, bh, cmd.CommandBuffer())
+		cbc.behave = func(sc submittedCommand, execInfo *queueExecutionState) {
+			cbh := sc.cmd.newBehavior(ctx, sc, execInfo)
+			if vs := execInfo.currentCmdBufState.videoSession; vs != nil {
+				// Resetting the session invalidates all the DPB slots.
+				if reset {
+					vb.write(ctx, cbh, vs.allSlots()...)
+				}
+				vb.write(ctx, cbh, vs.control)
+			}
+			ft.AddBehavior(ctx, cbh)
+		}
+	case *VkCmdDecodeVideoKHR:
+		info := cmd.PDecodeInfo().MustRead(ctx, cmd, s, nil)
+		src := vb.getBufferData(ctx, bh, info.SrcBuffer(),
+			uint64(info.SrcBufferOffset()), uint64(info.SrcBufferRange()))
+		dst := vb.getVideoPictureData(ctx, bh, s, info.DstPictureResource())
+		setup := vb.getVideoReferenceSlots(ctx, cmd, s, bh, info.PSetupReferenceSlot(), 1)
+		refs := vb.getVideoReferenceSlots(ctx, cmd, s, bh, info.PReferenceSlots(),
+			uint64(info.ReferenceSlotCount()))
+		vb.recordVideoCoding(ctx, ft, bh, cmd.CommandBuffer(), src, dst, setup, refs)
+	case *VkCmdEncodeVideoKHR:
+		info := cmd.PEncodeInfo().MustRead(ctx, cmd, s, nil)
+		src := vb.getVideoPictureData(ctx, bh, s, info.SrcPictureResource())
+		dst := vb.getBufferData(ctx, bh, info.DstBuffer(),
+			uint64(info.DstBufferOffset()), uint64(info.DstBufferRange()))
+		setup := vb.getVideoReferenceSlots(ctx, cmd, s, bh, info.PSetupReferenceSlot(), 1)
+		refs := vb.getVideoReferenceSlots(ctx, cmd, s, bh, info.PReferenceSlots(),
+			uint64(info.ReferenceSlotCount()))
+		vb.recordVideoCoding(ctx, ft, bh, cmd.CommandBuffer(), src, dst, setup, refs)
+
+	// debug marker and debug utils extension commandbuffer commands. Those
+	// commands are kept alive if they are submitted.
 	case *VkCmdDebugMarkerBeginEXT:
 		vb.keepSubmittedCommandAlive(ctx, ft, bh, cmd.CommandBuffer())
 	case *VkCmdDebugMarkerEndEXT:
 		vb.keepSubmittedCommandAlive(ctx, ft, bh, cmd.CommandBuffer())
 	case *VkCmdDebugMarkerInsertEXT:
 		vb.keepSubmittedCommandAlive(ctx, ft, bh, cmd.CommandBuffer())
+	case *VkCmdBeginDebugUtilsLabelEXT:
+		vb.keepSubmittedCommandAlive(ctx, ft, bh, cmd.CommandBuffer())
+	case *VkCmdEndDebugUtilsLabelEXT:
+		vb.keepSubmittedCommandAlive(ctx, ft, bh, cmd.CommandBuffer())
+	case *VkCmdInsertDebugUtilsLabelEXT:
+		vb.keepSubmittedCommandAlive(ctx, ft, bh, cmd.CommandBuffer())
 
 	// event commandbuffer commands
 	case *VkCmdSetEvent:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Event())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Event())))
 		vb.recordReadsWritesModifies(ctx, ft, bh, cmd.CommandBuffer(), emptyDefUseVars,
 			[]dependencygraph.DefUseVariable{vb.events[cmd.Event()].signal}, emptyDefUseVars)
 	case *VkCmdResetEvent:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Event())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Event())))
 		vb.recordReadsWritesModifies(ctx, ft, bh, cmd.CommandBuffer(), emptyDefUseVars,
 			[]dependencygraph.DefUseVariable{vb.events[cmd.Event()].unsignal}, emptyDefUseVars)
 	case *VkCmdWaitEvents:
 		evCount := uint64(cmd.EventCount())
 		eventLabels := make([]dependencygraph.DefUseVariable, 0, evCount*uint64(2))
 		for _, vkEv := range cmd.PEvents().Slice(0, evCount, l).MustRead(ctx, cmd, s, nil) {
-			read(ctx, bh, vb.toVkHandle(uint64(vkEv)))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(vkEv)))
+			eventLabels = append(eventLabels, vb.events[vkEv].signal,
+				vb.events[vkEv].unsignal)
+		}
+		vb.barriers.declare(id, cmd.SrcStageMask(), cmd.DstStageMask(), true)
+		vb.recordBarriers(ctx, ft, bh, cmd.CommandBuffer(), cmd.MemoryBarrierCount() > 0,
+			readBufferBarriers(ctx, cmd, s, cmd.BufferMemoryBarrierCount(), cmd.PBufferMemoryBarriers()),
+			readImageBarriers(ctx, cmd, s, cmd.ImageMemoryBarrierCount(), cmd.PImageMemoryBarriers()),
+			eventLabels, emptyDefUseVars)
+	case *VkCmdSetEvent2KHR:
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Event())))
+		hasMemoryBarrier, bufferBarriers, imageBarriers := readDependencyInfo(ctx, cmd, s,
+			cmd.PDependencyInfo().MustRead(ctx, cmd, s, nil))
+		vb.recordBarriers(ctx, ft, bh, cmd.CommandBuffer(), hasMemoryBarrier,
+			bufferBarriers, imageBarriers, emptyDefUseVars,
+			[]dependencygraph.DefUseVariable{vb.events[cmd.Event()].signal})
+	case *VkCmdResetEvent2KHR:
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Event())))
+		vb.recordReadsWritesModifies(ctx, ft, bh, cmd.CommandBuffer(), emptyDefUseVars,
+			[]dependencygraph.DefUseVariable{vb.events[cmd.Event()].unsignal}, emptyDefUseVars)
+	case *VkCmdWaitEvents2KHR:
+		evCount := uint64(cmd.EventCount())
+		eventLabels := make([]dependencygraph.DefUseVariable, 0, evCount*uint64(2))
+		for _, vkEv := range cmd.PEvents().Slice(0, evCount, l).MustRead(ctx, cmd, s, nil) {
+			vb.read(ctx, bh, vb.toVkHandle(uint64(vkEv)))
 			eventLabels = append(eventLabels, vb.events[vkEv].signal,
 				vb.events[vkEv].unsignal)
 		}
-		vb.recordBarriers(ctx, s, ft, cmd, bh, cmd.CommandBuffer(), cmd.MemoryBarrierCount(),
-			cmd.BufferMemoryBarrierCount(), cmd.PBufferMemoryBarriers(),
-			cmd.ImageMemoryBarrierCount(), cmd.PImageMemoryBarriers(), eventLabels)
+		// Each event comes with its own dependency info, the barriers of all of
+		// them are recorded as one.
+		hasMemoryBarrier := false
+		bufferBarriers := []bufferBarrier{}
+		imageBarriers := []imageBarrier{}
+		srcStages, dstStages, stagesOk := VkPipelineStageFlags(0), VkPipelineStageFlags(0), true
+		for _, info := range cmd.PDependencyInfos().Slice(0, evCount, l).MustRead(ctx, cmd, s, nil) {
+			m, b, i := readDependencyInfo(ctx, cmd, s, info)
+			hasMemoryBarrier = hasMemoryBarrier || m
+			bufferBarriers = append(bufferBarriers, b...)
+			imageBarriers = append(imageBarriers, i...)
+			src, dst, ok := dependencyInfoStages(ctx, cmd, s, info)
+			srcStages, dstStages, stagesOk = srcStages|src, dstStages|dst, stagesOk && ok
+		}
+		vb.barriers.declare(id, srcStages, dstStages, stagesOk)
+		vb.recordBarriers(ctx, ft, bh, cmd.CommandBuffer(), hasMemoryBarrier,
+			bufferBarriers, imageBarriers, eventLabels, emptyDefUseVars)
 
 	// pipeline barrier
 	case *VkCmdPipelineBarrier:
-		vb.recordBarriers(ctx, s, ft, cmd, bh, cmd.CommandBuffer(), cmd.MemoryBarrierCount(),
-			cmd.BufferMemoryBarrierCount(), cmd.PBufferMemoryBarriers(),
-			cmd.ImageMemoryBarrierCount(), cmd.PImageMemoryBarriers(), emptyDefUseVars)
+		vb.barriers.declare(id, cmd.SrcStageMask(), cmd.DstStageMask(), true)
+		vb.recordBarriers(ctx, ft, bh, cmd.CommandBuffer(), cmd.MemoryBarrierCount() > 0,
+			readBufferBarriers(ctx, cmd, s, cmd.BufferMemoryBarrierCount(), cmd.PBufferMemoryBarriers()),
+			readImageBarriers(ctx, cmd, s, cmd.ImageMemoryBarrierCount(), cmd.PImageMemoryBarriers()),
+			emptyDefUseVars, emptyDefUseVars)
+	case *VkCmdPipelineBarrier2KHR:
+		info := cmd.PDependencyInfo().MustRead(ctx, cmd, s, nil)
+		srcStages, dstStages, stagesOk := dependencyInfoStages(ctx, cmd, s, info)
+		vb.barriers.declare(id, srcStages, dstStages, stagesOk)
+		hasMemoryBarrier, bufferBarriers, imageBarriers := readDependencyInfo(ctx, cmd, s, info)
+		vb.recordBarriers(ctx, ft, bh, cmd.CommandBuffer(), hasMemoryBarrier,
+			bufferBarriers, imageBarriers, emptyDefUseVars, emptyDefUseVars)
 
 	// secondary command buffers
 	case *VkCmdExecuteCommands:
@@ -2548,23 +4275,25 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		count := uint64(cmd.CommandBufferCount())
 		for _, vkScb := range cmd.PCommandBuffers().Slice(0, count, l).MustRead(ctx, cmd, s, nil) {
 			cbc.recordSecondaryCommandBuffer(vkScb)
-			read(ctx, bh, vb.toVkHandle(uint64(vkScb)))
+			vb.read(ctx, bh, vb.toVkHandle(uint64(vkScb)))
 		}
 		cbc.behave = func(sc submittedCommand, execInfo *queueExecutionState) {}
 
 	// execution triggering
 	case *VkQueueSubmit:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Queue())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Queue())))
 		if _, ok := vb.executionStates[cmd.Queue()]; !ok {
-			vb.executionStates[cmd.Queue()] = newQueueExecutionState(id)
+			vb.executionStates[cmd.Queue()] = newQueueExecutionState(vb, id,
+				GetState(s).Queues().Get(cmd.Queue()).Family())
 		}
 		vb.executionStates[cmd.Queue()].lastSubmitID = id
 		// collect submission info and submitted commands
 		vb.submitInfos[id] = &queueSubmitInfo{
-			began:  false,
-			queued: newLabel(),
-			done:   newLabel(),
-			queue:  cmd.Queue(),
+			began:          false,
+			queued:         vb.labels.newLabel(),
+			done:           vb.labels.newLabel(),
+			queue:          cmd.Queue(),
+			descriptorSets: map[VkDescriptorSet]*descriptorSet{},
 		}
 		submitCount := uint64(cmd.SubmitCount())
 		hasCmd := false
@@ -2577,29 +4306,11 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 				if _, ok := vb.commandBuffers[vkCb]; !ok {
 					break
 				}
-				read(ctx, bh, vb.commandBuffers[vkCb].end)
-				for k, cbc := range vb.commands[vkCb] {
-					if !hasCmd {
-						hasCmd = true
-					}
-					fci := api.SubCmdIdx{uint64(id), uint64(i), uint64(j), uint64(k)}
-					submittedCmd := newSubmittedCommand(fci, cbc, nil)
-					vb.submitInfos[id].pendingCommands = append(vb.submitInfos[id].pendingCommands, submittedCmd)
-					if cbc.isCmdExecuteCommands {
-						for scbi, scb := range cbc.secondaryCommandBuffers {
-							// In case of invalid secondary command buffer, stop traversing
-							// all the secondary command buffers
-							if _, ok := vb.commandBuffers[scb]; !ok {
-								break
-							}
-							read(ctx, bh, vb.commandBuffers[scb].end)
-							for sci, scbc := range vb.commands[scb] {
-								fci := api.SubCmdIdx{uint64(id), uint64(i), uint64(j), uint64(k), uint64(scbi), uint64(sci)}
-								submittedCmd := newSubmittedCommand(fci, scbc, cbc)
-								vb.submitInfos[id].pendingCommands = append(vb.submitInfos[id].pendingCommands, submittedCmd)
-							}
-						}
-					}
+				vb.read(ctx, bh, vb.commandBuffers[vkCb].end)
+				if vb.submitCommandBuffer(ctx, bh, vb.submitInfos[id],
+					api.SubCmdIdx{uint64(id), uint64(i), uint64(j)}, vkCb, nil,
+					map[VkCommandBuffer]struct{}{}) {
+					hasCmd = true
 				}
 			}
 			waitSemaphoreCount := uint64(submit.WaitSemaphoreCount())
@@ -2625,9 +4336,9 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 
 		// queue execution begin
 		vb.writeCoherentMemoryData(ctx, cmd, bh)
-		if read(ctx, bh, vb.toVkHandle(uint64(cmd.Fence()))) {
-			read(ctx, bh, vb.fences[cmd.Fence()].unsignal)
-			write(ctx, bh, vb.fences[cmd.Fence()].signal)
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Fence()))) {
+			vb.read(ctx, bh, vb.fences[cmd.Fence()].unsignal)
+			vb.write(ctx, bh, vb.fences[cmd.Fence()].signal)
 		}
 		// If the submission does not contains commands, records the write
 		// behavior here as we don't have any callbacks for those operations.
@@ -2638,46 +4349,47 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		// TODO: Once we merge the dependency tree building process to mutate
 		// calls, make sure the signal/unsignal operations in pending state
 		// are handled correctly.
-		write(ctx, bh, vb.submitInfos[id].queued)
+		vb.write(ctx, bh, vb.submitInfos[id].queued)
 		for _, sp := range vb.submitInfos[id].waitSemaphores {
-			if read(ctx, bh, vb.toVkHandle(uint64(sp))) {
+			if vb.read(ctx, bh, vb.toVkHandle(uint64(sp))) {
 				if !hasCmd {
-					modify(ctx, bh, vb.semaphoreSignals[sp])
+					vb.modify(ctx, bh, vb.semaphoreSignals[sp])
 				}
 			}
 		}
 		for _, sp := range vb.submitInfos[id].signalSemaphores {
-			if read(ctx, bh, vb.toVkHandle(uint64(sp))) {
+			if vb.read(ctx, bh, vb.toVkHandle(uint64(sp))) {
 				if !hasCmd {
-					write(ctx, bh, vb.toVkHandle(uint64(sp)))
+					vb.write(ctx, bh, vb.toVkHandle(uint64(sp)))
 				}
 			}
 		}
-		if read(ctx, bh, vb.toVkHandle(uint64(cmd.Fence()))) {
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Fence()))) {
 			if !hasCmd {
-				write(ctx, bh, vb.fences[cmd.Fence()].signal)
+				vb.write(ctx, bh, vb.fences[cmd.Fence()].signal)
 			}
 		}
 
 	case *VkSetEvent:
-		if read(ctx, bh, vb.toVkHandle(uint64(cmd.Event()))) {
-			write(ctx, bh, vb.events[cmd.Event()].signal)
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Event()))) {
+			vb.write(ctx, bh, vb.events[cmd.Event()].signal)
 			vb.writeCoherentMemoryData(ctx, cmd, bh)
 			bh.Alive = true
 		}
 
 	case *VkQueueBindSparse:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Queue())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Queue())))
 		for _, bindInfo := range cmd.PBindInfo().Slice(0, uint64(cmd.BindInfoCount()), l).MustRead(
 			ctx, cmd, s, nil) {
 			for _, bufferBinds := range bindInfo.PBufferBinds().Slice(0,
 				uint64(bindInfo.BufferBindCount()), l).MustRead(ctx, cmd, s, nil) {
-				if read(ctx, bh, vb.toVkHandle(uint64(bufferBinds.Buffer()))) {
+				if vb.read(ctx, bh, vb.toVkHandle(uint64(bufferBinds.Buffer()))) {
 					buf := bufferBinds.Buffer()
+					vb.read(ctx, bh, vb.getMemoryRequirements(uint64(buf)))
 					binds := bufferBinds.PBinds().Slice(0, uint64(bufferBinds.BindCount()), l).MustRead(
 						ctx, cmd, s, nil)
 					for _, bind := range binds {
-						if read(ctx, bh, vb.toVkHandle(uint64(bind.Memory()))) {
+						if vb.read(ctx, bh, vb.toVkHandle(uint64(bind.Memory()))) {
 							vb.addBufferMemBinding(ctx, bh, buf, bind.Memory(),
 								uint64(bind.ResourceOffset()), uint64(bind.Size()), uint64(bind.MemoryOffset()))
 						}
@@ -2686,12 +4398,13 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 			}
 			for _, opaqueBinds := range bindInfo.PImageOpaqueBinds().Slice(0,
 				uint64(bindInfo.ImageOpaqueBindCount()), l).MustRead(ctx, cmd, s, nil) {
-				if read(ctx, bh, vb.toVkHandle(uint64(opaqueBinds.Image()))) {
+				if vb.read(ctx, bh, vb.toVkHandle(uint64(opaqueBinds.Image()))) {
 					img := opaqueBinds.Image()
+					vb.read(ctx, bh, vb.getMemoryRequirements(uint64(img)))
 					binds := opaqueBinds.PBinds().Slice(0, uint64(opaqueBinds.BindCount()), l).MustRead(
 						ctx, cmd, s, nil)
 					for _, bind := range binds {
-						if read(ctx, bh, vb.toVkHandle(uint64(bind.Memory()))) {
+						if vb.read(ctx, bh, vb.toVkHandle(uint64(bind.Memory()))) {
 							vb.addOpaqueImageMemBinding(ctx, bh, img, bind.Memory(),
 								uint64(bind.ResourceOffset()), uint64(bind.Size()), uint64(bind.MemoryOffset()))
 						}
@@ -2700,12 +4413,13 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 			}
 			for _, imageBinds := range bindInfo.PImageBinds().Slice(0,
 				uint64(bindInfo.ImageBindCount()), l).MustRead(ctx, cmd, s, nil) {
-				if read(ctx, bh, vb.toVkHandle(uint64(imageBinds.Image()))) {
+				if vb.read(ctx, bh, vb.toVkHandle(uint64(imageBinds.Image()))) {
 					img := imageBinds.Image()
+					vb.read(ctx, bh, vb.getMemoryRequirements(uint64(img)))
 					binds := imageBinds.PBinds().Slice(0, uint64(imageBinds.BindCount()), l).MustRead(
 						ctx, cmd, s, nil)
 					for _, bind := range binds {
-						if read(ctx, bh, vb.toVkHandle(uint64(bind.Memory()))) {
+						if vb.read(ctx, bh, vb.toVkHandle(uint64(bind.Memory()))) {
 							vb.addSparseImageMemBinding(ctx, cmd, id, s, bh, img, bind)
 						}
 					}
@@ -2715,78 +4429,106 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 
 	// synchronization primitives
 	case *VkResetEvent:
-		if read(ctx, bh, vb.toVkHandle(uint64(cmd.Event()))) {
-			write(ctx, bh, vb.events[cmd.Event()].unsignal)
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Event()))) {
+			vb.write(ctx, bh, vb.events[cmd.Event()].unsignal)
 			bh.Alive = true
 		}
 
 	case *VkCreateSemaphore:
 		vkSp := cmd.PSemaphore().MustRead(ctx, cmd, s, nil)
-		write(ctx, bh, vb.toVkHandle(uint64(vkSp)))
-		vb.semaphoreSignals[vkSp] = newLabel()
+		vb.write(ctx, bh, vb.toVkHandle(uint64(vkSp)))
+		vb.semaphoreSignals[vkSp] = vb.labels.newLabel()
 	case *VkDestroySemaphore:
 		vkSp := cmd.Semaphore()
-		if read(ctx, bh, vb.toVkHandle(uint64(vkSp))) {
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(vkSp))) {
 			delete(vb.semaphoreSignals, vkSp)
 			bh.Alive = true
 		}
 
+	// external semaphore
+	case *VkImportSemaphoreFdKHR:
+		vb.importSemaphore(ctx, bh,
+			cmd.PImportSemaphoreFdInfo().MustRead(ctx, cmd, s, nil).Semaphore())
+	case *VkImportSemaphoreWin32HandleKHR:
+		vb.importSemaphore(ctx, bh,
+			cmd.PImportSemaphoreWin32HandleInfo().MustRead(ctx, cmd, s, nil).Semaphore())
+	case *VkGetSemaphoreFdKHR:
+		vb.exportSemaphore(ctx, bh,
+			cmd.PGetFdInfo().MustRead(ctx, cmd, s, nil).Semaphore())
+	case *VkGetSemaphoreWin32HandleKHR:
+		vb.exportSemaphore(ctx, bh,
+			cmd.PGetWin32HandleInfo().MustRead(ctx, cmd, s, nil).Semaphore())
+
 	case *VkCreateEvent:
 		vkEv := cmd.PEvent().MustRead(ctx, cmd, s, nil)
-		write(ctx, bh, vb.toVkHandle(uint64(vkEv)))
-		vb.events[vkEv] = &event{signal: newLabel(), unsignal: newLabel()}
+		vb.write(ctx, bh, vb.toVkHandle(uint64(vkEv)))
+		vb.events[vkEv] = &event{signal: vb.labels.newLabel(), unsignal: vb.labels.newLabel()}
 	case *VkGetEventStatus:
 		vkEv := cmd.Event()
-		if read(ctx, bh, vb.toVkHandle(uint64(vkEv))) {
-			read(ctx, bh, vb.events[vkEv].signal)
-			read(ctx, bh, vb.events[vkEv].unsignal)
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(vkEv))) {
+			vb.read(ctx, bh, vb.events[vkEv].signal)
+			vb.read(ctx, bh, vb.events[vkEv].unsignal)
 			bh.Alive = true
 		}
 	case *VkDestroyEvent:
 		vkEv := cmd.Event()
-		if read(ctx, bh, vb.toVkHandle(uint64(vkEv))) {
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(vkEv))) {
 			delete(vb.events, vkEv)
 			bh.Alive = true
 		}
 
 	case *VkCreateFence:
 		vkFe := cmd.PFence().MustRead(ctx, cmd, s, nil)
-		write(ctx, bh, vb.toVkHandle(uint64(vkFe)))
-		vb.fences[vkFe] = &fence{signal: newLabel(), unsignal: newLabel()}
+		vb.write(ctx, bh, vb.toVkHandle(uint64(vkFe)))
+		vb.fences[vkFe] = &fence{signal: vb.labels.newLabel(), unsignal: vb.labels.newLabel()}
 	case *VkGetFenceStatus:
 		vkFe := cmd.Fence()
-		if read(ctx, bh, vb.toVkHandle(uint64(vkFe))) {
-			read(ctx, bh, vb.fences[vkFe].signal)
-			read(ctx, bh, vb.fences[vkFe].unsignal)
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(vkFe))) {
+			vb.read(ctx, bh, vb.fences[vkFe].signal)
+			vb.read(ctx, bh, vb.fences[vkFe].unsignal)
 			bh.Alive = true
 		}
 	case *VkWaitForFences:
 		fenceCount := uint64(cmd.FenceCount())
 		for _, vkFe := range cmd.PFences().Slice(0, fenceCount, l).MustRead(ctx, cmd, s, nil) {
-			if read(ctx, bh, vb.toVkHandle(uint64(vkFe))) {
-				read(ctx, bh, vb.fences[vkFe].signal)
-				read(ctx, bh, vb.fences[vkFe].unsignal)
+			if vb.read(ctx, bh, vb.toVkHandle(uint64(vkFe))) {
+				vb.read(ctx, bh, vb.fences[vkFe].signal)
+				vb.read(ctx, bh, vb.fences[vkFe].unsignal)
 				bh.Alive = true
 			}
 		}
 	case *VkResetFences:
 		fenceCount := uint64(cmd.FenceCount())
 		for _, vkFe := range cmd.PFences().Slice(0, fenceCount, l).MustRead(ctx, cmd, s, nil) {
-			if read(ctx, bh, vb.toVkHandle(uint64(vkFe))) {
-				write(ctx, bh, vb.fences[vkFe].unsignal)
+			if vb.read(ctx, bh, vb.toVkHandle(uint64(vkFe))) {
+				vb.write(ctx, bh, vb.fences[vkFe].unsignal)
 				bh.Alive = true
 			}
 		}
 	case *VkDestroyFence:
 		vkFe := cmd.Fence()
-		if read(ctx, bh, vb.toVkHandle(uint64(vkFe))) {
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(vkFe))) {
 			delete(vb.fences, vkFe)
 			bh.Alive = true
 		}
 
+	// external fence
+	case *VkImportFenceFdKHR:
+		vb.importFence(ctx, bh,
+			cmd.PImportFenceFdInfo().MustRead(ctx, cmd, s, nil).Fence())
+	case *VkImportFenceWin32HandleKHR:
+		vb.importFence(ctx, bh,
+			cmd.PImportFenceWin32HandleInfo().MustRead(ctx, cmd, s, nil).Fence())
+	case *VkGetFenceFdKHR:
+		vb.exportFence(ctx, bh,
+			cmd.PGetFdInfo().MustRead(ctx, cmd, s, nil).Fence())
+	case *VkGetFenceWin32HandleKHR:
+		vb.exportFence(ctx, bh,
+			cmd.PGetWin32HandleInfo().MustRead(ctx, cmd, s, nil).Fence())
+
 	case *VkQueueWaitIdle:
 		vkQu := cmd.Queue()
-		if read(ctx, bh, vb.toVkHandle(uint64(vkQu))) {
+		if vb.read(ctx, bh, vb.toVkHandle(uint64(vkQu))) {
 			if _, ok := vb.executionStates[vkQu]; ok {
 				bh.Alive = true
 			}
@@ -2795,17 +4537,17 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 	case *VkDeviceWaitIdle:
 		for _, qei := range vb.executionStates {
 			lastSubmitInfo := vb.submitInfos[qei.lastSubmitID]
-			read(ctx, bh, lastSubmitInfo.done)
+			vb.read(ctx, bh, lastSubmitInfo.done)
 			bh.Alive = true
 		}
 
 	// Property queries, can be dropped if they are not the requested command.
 	case *VkGetDeviceMemoryCommitment:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Memory())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Memory())))
 	case *VkGetImageSubresourceLayout:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.Image())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.Image())))
 	case *VkGetRenderAreaGranularity:
-		read(ctx, bh, vb.toVkHandle(uint64(cmd.RenderPass())))
+		vb.read(ctx, bh, vb.toVkHandle(uint64(cmd.RenderPass())))
 	case *VkEnumerateInstanceExtensionProperties,
 		*VkEnumerateDeviceExtensionProperties,
 		*VkEnumerateInstanceLayerProperties,
@@ -2823,9 +4565,7 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		bh.Alive = true
 	case *VkGetDeviceQueue:
 		bh.Alive = true
-	case *VkCreateDescriptorPool,
-		*VkDestroyDescriptorPool,
-		*VkResetDescriptorPool:
+	case *VkCreateDescriptorPool:
 		bh.Alive = true
 	case *VkCreateAndroidSurfaceKHR,
 		*VkCreateXlibSurfaceKHR,
@@ -2857,7 +4597,10 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		*VkGetPhysicalDeviceFeatures,
 		*VkGetPhysicalDeviceFormatProperties,
 		*VkGetPhysicalDeviceImageFormatProperties,
-		*VkGetPhysicalDeviceSparseImageFormatProperties:
+		*VkGetPhysicalDeviceSparseImageFormatProperties,
+		*VkEnumeratePhysicalDeviceQueueFamilyPerformanceQueryCountersKHR,
+		*VkGetPhysicalDeviceQueueFamilyPerformanceQueryPassesKHR,
+		*VkGetPhysicalDeviceFragmentShadingRatesKHR:
 		bh.Alive = true
 	case *VkGetPhysicalDeviceSurfaceSupportKHR,
 		*VkGetPhysicalDeviceSurfaceCapabilitiesKHR,
@@ -2906,8 +4649,8 @@ func (vb *FootprintBuilder) BuildFootprint(ctx context.Context,
 		}
 	}
 	if len(fbData) > 0 {
-		fbh := dependencygraph.NewBehavior(api.SubCmdIdx{uint64(id)})
-		read(ctx, fbh, fbData...)
+		fbh := vb.behaviors.NewBehavior(api.SubCmdIdx{uint64(id)})
+		vb.read(ctx, fbh, fbData...)
 		ft.AddBehavior(ctx, fbh)
 	}
 }
@@ -2948,7 +4691,7 @@ func (vb *FootprintBuilder) writeCoherentMemoryData(ctx context.Context,
 				intersect := ro.Range.Intersect(mappedRng)
 				offset := uint64(mm.MappedOffset()) + intersect.Base - mm.MappedLocation().Address()
 				ms := vb.newMemorySpan(vkDm, offset, intersect.Size)
-				write(ctx, bh, ms)
+				vb.write(ctx, bh, ms)
 			}
 		}
 	}
@@ -2961,78 +4704,224 @@ func debug(ctx context.Context, fmt string, args ...interface{}) {
 	}
 }
 
-func read(ctx context.Context, bh *dependencygraph.Behavior,
+// annotate records the provenance of the read or write of the given variable
+// by the behavior, when debugging the dead code elimination.
+func annotate(bh *dependencygraph.Behavior, write bool, c dependencygraph.DefUseVariable) {
+	if config.DebugDeadCodeElimination {
+		bh.Annotate(write, c, provenanceSource())
+	}
+}
+
+// provenanceSource returns the function and source line of the
+// FootprintBuilder code that emits a read or a write, skipping the helpers
+// that emit them on behalf of their callers.
+func provenanceSource() string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		f, more := frames.Next()
+		switch fn := path.Base(f.Function); fn {
+		case "vulkan.annotate", "vulkan.(*FootprintBuilder).read",
+			"vulkan.(*FootprintBuilder).write", "vulkan.(*FootprintBuilder).modify",
+			"vulkan.writeMemorySpan", "dependencygraph.ReadVariable",
+			"dependencygraph.WriteVariable":
+		default:
+			return fmt.Sprintf("%v (%v:%v)", fn, path.Base(f.File), f.Line)
+		}
+		if !more {
+			return "<unknown>"
+		}
+	}
+}
+
+// freeDescriptorPoolSets overwrites and forgets all the descriptor sets
+// allocated from the given descriptor pool, as the pool is being reset or
+// destroyed, which implicitly frees those descriptor sets.
+func (vb *FootprintBuilder) freeDescriptorPoolSets(ctx context.Context,
+	bh *dependencygraph.Behavior, vkPool VkDescriptorPool) {
+	for vkSet := range vb.descriptorPools[vkPool] {
+		vb.write(ctx, bh, vb.toVkHandle(uint64(vkSet)))
+		delete(vb.descriptorSets, vkSet)
+	}
+	delete(vb.descriptorPools, vkPool)
+}
+
+// imageAcquired returns true if the given result of vkAcquireNextImageKHR or
+// vkAcquireNextImage2KHR means an image has been acquired. On other results,
+// e.g. VK_ERROR_OUT_OF_DATE_KHR or VK_TIMEOUT, no image is acquired, and the
+// semaphore and fence are left unaffected.
+func imageAcquired(result VkResult) bool {
+	return result == VkResult_VK_SUCCESS || result == VkResult_VK_SUBOPTIMAL_KHR
+}
+
+// acquireNextImage records the behavior of acquiring the image at the given
+// index from the given swapchain, which signals the given semaphore and fence.
+func (vb *FootprintBuilder) acquireNextImage(ctx context.Context,
+	bh *dependencygraph.Behavior, vkSw VkSwapchainKHR, vkSp VkSemaphore,
+	vkFence VkFence, imgID uint32) {
+	if vb.read(ctx, bh, vb.toVkHandle(uint64(vkSp))) {
+		vb.write(ctx, bh, vb.semaphoreSignals[vkSp])
+	}
+	if vb.read(ctx, bh, vb.toVkHandle(uint64(vkFence))) {
+		vb.write(ctx, bh, vb.fences[vkFence].signal)
+	}
+	vkImg, acquired, presented, ok := vb.swapchains[vkSw].image(imgID)
+	if !ok {
+		debug(ctx, "Image index: %v of swapchain: %v is not tracked", imgID, vkSw)
+		return
+	}
+	if vb.read(ctx, bh, vb.toVkHandle(uint64(vkImg))) {
+		imgLayout, imgData := vb.getImageLayoutAndData(ctx, bh, vkImg)
+		vb.write(ctx, bh, imgLayout...)
+		vb.write(ctx, bh, imgData...)
+	}
+	vb.write(ctx, bh, acquired)
+	vb.read(ctx, bh, presented)
+}
+
+// VariableKind implements dependencygraph.KindedVariable.
+func (*vkHandle) VariableKind() dependencygraph.VariableKind {
+	return dependencygraph.VariableKind{
+		Name:  "vkHandle",
+		Read:  readVkHandle,
+		Write: writeVkHandle,
+	}
+}
+
+// VariableKind implements dependencygraph.KindedVariable.
+func (*forwardPairedLabel) VariableKind() dependencygraph.VariableKind {
+	return dependencygraph.VariableKind{
+		Name: "forwardPairedLabel",
+		Read: readForwardPairedLabel,
+	}
+}
+
+// VariableKind implements dependencygraph.KindedVariable.
+func (*memorySpan) VariableKind() dependencygraph.VariableKind {
+	return dependencygraph.VariableKind{
+		Name:  "memorySpan",
+		Read:  readMemorySpan,
+		Write: writeMemorySpan,
+	}
+}
+
+func readVkHandle(ctx context.Context, bh *dependencygraph.Behavior,
+	v dependencygraph.DefUseVariable) bool {
+	c := v.(*vkHandle)
+	if c.isNullHandle() {
+		debug(ctx, "Read to VK_NULL_HANDLE is ignored")
+		return false
+	}
+	bh.Read(c)
+	return true
+}
+
+func writeVkHandle(ctx context.Context, bh *dependencygraph.Behavior,
+	v dependencygraph.DefUseVariable) bool {
+	c := v.(*vkHandle)
+	if c.isNullHandle() {
+		debug(ctx, "Write to VK_NULL_HANDLE is ignored")
+		return false
+	}
+	bh.Write(c)
+	return true
+}
+
+func readForwardPairedLabel(ctx context.Context, bh *dependencygraph.Behavior,
+	v dependencygraph.DefUseVariable) bool {
+	c := v.(*forwardPairedLabel)
+	// c.GetDefBehavior().DependsOn[bh] = struct{}{}
+	c.labelReadBehaviors = append(c.labelReadBehaviors, bh)
+	bh.Read(c)
+	return true
+}
+
+func readMemorySpan(ctx context.Context, bh *dependencygraph.Behavior,
+	v dependencygraph.DefUseVariable) bool {
+	c := v.(*memorySpan)
+	if c.memory == VkDeviceMemory(0) {
+		return true
+	}
+	first, count := interval.Intersect(memBindingList(c.recordTo.records[c.memory]),
+		c.recordTo.trackedSpan(c))
+	if count > 0 {
+		for i := first; i < first+count; i++ {
+			sp := c.recordTo.records[c.memory][i].(*memorySpan)
+			bh.Read(sp)
+		}
+	}
+	if shared, ok := c.recordTo.external[c.memory]; ok {
+		bh.Read(shared)
+	}
+	return true
+}
+
+func writeMemorySpan(ctx context.Context, bh *dependencygraph.Behavior,
+	v dependencygraph.DefUseVariable) bool {
+	c := v.(*memorySpan)
+	if c.memory == VkDeviceMemory(0) {
+		return true
+	}
+	c = c.duplicate().(*memorySpan)
+	c.sp = c.recordTo.trackedSpan(c)
+	if c.recordTo.granularity != footprintGranularityByteRange {
+		// The command may write only part of the tracked span, so the
+		// earlier writes to the span are not overwritten.
+		readMemorySpan(ctx, bh, c)
+		annotate(bh, false, c)
+	}
+	newList, err := addBinding(memBindingList(c.recordTo.records[c.memory]), c)
+	if err != nil {
+		debug(ctx, "Adding memory span failed. DeviceMemory: %v, Span: %v", c.memory, c.span())
+		return false
+	}
+	c.recordTo.records[c.memory] = memorySpanList(newList)
+	if shared, ok := c.recordTo.external[c.memory]; ok {
+		bh.Alive = true
+		bh.Modify(shared)
+	}
+	bh.Write(c)
+	return true
+}
+
+func (vb *FootprintBuilder) read(ctx context.Context, bh *dependencygraph.Behavior,
 	cs ...dependencygraph.DefUseVariable) bool {
 	allSucceeded := true
 	for _, c := range cs {
-		switch c := c.(type) {
-		case *vkHandle:
-			if c.isNullHandle() {
-				debug(ctx, "Read to VK_NULL_HANDLE is ignored")
-				allSucceeded = false
-				continue
-			}
-			bh.Read(c)
-		case *forwardPairedLabel:
-			// c.GetDefBehavior().DependsOn[bh] = struct{}{}
-			c.labelReadBehaviors = append(c.labelReadBehaviors, bh)
-			bh.Read(c)
-		case *memorySpan:
-			if c.memory == VkDeviceMemory(0) {
-				continue
-			}
-			first, count := interval.Intersect(memBindingList(c.recordTo.records[c.memory]), c.span())
-			if count > 0 {
-				for i := first; i < first+count; i++ {
-					sp := c.recordTo.records[c.memory][i].(*memorySpan)
-					bh.Read(sp)
-				}
-			}
-		default:
-			bh.Read(c)
+		if !dependencygraph.ReadVariable(ctx, bh, c) {
+			allSucceeded = false
+			continue
 		}
 		debug(ctx, "<Behavior: %v, Read: %v>", bh, c)
+		annotate(bh, false, c)
+		for _, o := range vb.observers {
+			o.access(bh, false, c)
+		}
 	}
 	return allSucceeded
 }
 
-func write(ctx context.Context, bh *dependencygraph.Behavior,
+func (vb *FootprintBuilder) write(ctx context.Context, bh *dependencygraph.Behavior,
 	cs ...dependencygraph.DefUseVariable) bool {
 	allSucceeded := true
 	for _, c := range cs {
-		switch c := c.(type) {
-		case *vkHandle:
-			if c.isNullHandle() {
-				debug(ctx, "Write to VK_NULL_HANDLE is ignored")
-				allSucceeded = false
-				continue
-			}
-			bh.Write(c)
-		case *memorySpan:
-			if c.memory == VkDeviceMemory(0) {
-				continue
-			}
-			c = c.duplicate().(*memorySpan)
-			newList, err := addBinding(memBindingList(c.recordTo.records[c.memory]), c)
-			if err != nil {
-				debug(ctx, "Adding memory span failed. DeviceMemory: %v, Span: %v", c.memory, c.span())
-				allSucceeded = false
-				continue
-			}
-			c.recordTo.records[c.memory] = memorySpanList(newList)
-			bh.Write(c)
-		default:
-			bh.Write(c)
+		if !dependencygraph.WriteVariable(ctx, bh, c) {
+			allSucceeded = false
+			continue
 		}
 		debug(ctx, "<Behavior: %v, Write: %v>", bh, c)
+		annotate(bh, true, c)
+		for _, o := range vb.observers {
+			o.access(bh, true, c)
+		}
 	}
 	return allSucceeded
 }
 
-func modify(ctx context.Context, bh *dependencygraph.Behavior,
+func (vb *FootprintBuilder) modify(ctx context.Context, bh *dependencygraph.Behavior,
 	cs ...dependencygraph.DefUseVariable) bool {
-	allSucceeded := read(ctx, bh, cs...)
-	return allSucceeded && write(ctx, bh, cs...)
+	allSucceeded := vb.read(ctx, bh, cs...)
+	return allSucceeded && vb.write(ctx, bh, cs...)
 }
 
 func framebufferPortCoveredByClearRect(fb FramebufferObjectʳ, r VkClearRect) bool {
@@ -3048,11 +4937,12 @@ func framebufferPortCoveredByClearRect(fb FramebufferObjectʳ, r VkClearRect) bo
 
 func clearAttachmentData(ctx context.Context, bh *dependencygraph.Behavior,
 	execInfo *queueExecutionState, a VkClearAttachment, rects []VkClearRect) {
+	vb := execInfo.vb
 	subpass := &execInfo.subpasses[execInfo.subpass.val]
 	if a.AspectMask() == VkImageAspectFlags(VkImageAspectFlagBits_VK_IMAGE_ASPECT_DEPTH_BIT) ||
 		a.AspectMask() == VkImageAspectFlags(VkImageAspectFlagBits_VK_IMAGE_ASPECT_STENCIL_BIT) {
 		if subpass.depthStencilAttachment != nil {
-			modify(ctx, bh, subpass.depthStencilAttachment.data...)
+			vb.modify(ctx, bh, subpass.depthStencilAttachment.data...)
 			return
 		}
 	} else if a.AspectMask() == VkImageAspectFlags(
@@ -3066,10 +4956,10 @@ func clearAttachmentData(ctx context.Context, bh *dependencygraph.Behavior,
 				}
 			}
 			if overwritten && subpass.depthStencilAttachment.fullImageData {
-				write(ctx, bh, subpass.depthStencilAttachment.data...)
+				vb.write(ctx, bh, subpass.depthStencilAttachment.data...)
 				return
 			}
-			modify(ctx, bh, subpass.depthStencilAttachment.data...)
+			vb.modify(ctx, bh, subpass.depthStencilAttachment.data...)
 			return
 		}
 	} else {
@@ -3082,10 +4972,10 @@ func clearAttachmentData(ctx context.Context, bh *dependencygraph.Behavior,
 			}
 			att := subpass.colorAttachments[a.ColorAttachment()]
 			if overwritten && att.fullImageData {
-				write(ctx, bh, att.data...)
+				vb.write(ctx, bh, att.data...)
 				return
 			}
-			modify(ctx, bh, att.data...)
+			vb.modify(ctx, bh, att.data...)
 			return
 		}
 	}
@@ -15,13 +15,20 @@
 package vulkan
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"reflect"
 	"testing"
 
 	"github.com/google/gapid/core/assert"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/math/interval"
+	"github.com/google/gapid/core/memory/arena"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/resolve/dependencygraph"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
 )
 
 func TestAddResBinding(t *testing.T) {
@@ -31,6 +38,7 @@ func TestAddResBinding(t *testing.T) {
 
 func TestSubBinding(t *testing.T) {
 	ctx := log.Testing(t)
+	vb := newFootprintBuilder()
 	resSize := uint64(2048)
 	memOffset := uint64(1024)
 	span := &memorySpan{
@@ -38,11 +46,11 @@ func TestSubBinding(t *testing.T) {
 		memory: VkDeviceMemory(0xabcd),
 	}
 	newSubBindingForTest := func(ctx context.Context, base *resBinding, offset, size uint64) *resBinding {
-		r, _ := base.newSubBinding(ctx, nil, offset, size)
+		r, _ := base.newSubBinding(ctx, vb, nil, offset, size)
 		return r
 	}
-	spanBase := newResBinding(ctx, nil, 0, resSize, span)
-	labelBase := newResBinding(ctx, nil, 0, resSize, newLabel())
+	spanBase := newResBinding(ctx, vb, nil, 0, resSize, span)
+	labelBase := newResBinding(ctx, vb, nil, 0, resSize, (&labelAllocator{}).newLabel())
 
 	invalidSubBoundData := func(offset, size uint64, base *resBinding) {
 		assert.For(ctx, "Invalid range Offset: %v, size: %v on base: %v, expect return nil",
@@ -67,14 +75,14 @@ func TestSubBinding(t *testing.T) {
 
 	validSubBoundData(0, 2048, spanBase, spanBase)
 	validSubBoundData(0, vkWholeSize, spanBase, spanBase)
-	validSubBoundData(1024, 512, spanBase, newResBinding(ctx, nil, 1024, 512, &memorySpan{
+	validSubBoundData(1024, 512, spanBase, newResBinding(ctx, vb, nil, 1024, 512, &memorySpan{
 		sp: interval.U64Span{
 			Start: memOffset + uint64(1024),
 			End:   memOffset + uint64(1024) + uint64(512),
 		},
 		memory: VkDeviceMemory(0xabcd),
 	}))
-	validSubBoundData(512, vkWholeSize, spanBase, newResBinding(ctx, nil, 512, 1536, &memorySpan{
+	validSubBoundData(512, vkWholeSize, spanBase, newResBinding(ctx, vb, nil, 512, 1536, &memorySpan{
 		sp: interval.U64Span{
 			Start: memOffset + uint64(512),
 			End:   memOffset + resSize,
@@ -82,3 +90,359 @@ func TestSubBinding(t *testing.T) {
 		memory: VkDeviceMemory(0xabcd),
 	}))
 }
+
+func TestImageLayoutsInRange(t *testing.T) {
+	ctx := log.Testing(t)
+	color := VkImageAspectFlagBits_VK_IMAGE_ASPECT_COLOR_BIT
+	la := &labelAllocator{}
+	layers := [][]*label{make([]*label, 4), make([]*label, 4)}
+	for _, levels := range layers {
+		for level := range levels {
+			levels[level] = la.newLabel()
+		}
+	}
+	d := &imageLayoutAndData{layouts: imageSubresourceLayouts{{color, layers}}}
+	colorMask := VkImageAspectFlags(color)
+	depthMask := VkImageAspectFlags(VkImageAspectFlagBits_VK_IMAGE_ASPECT_DEPTH_BIT)
+
+	assert.For(ctx, "All layouts").That(len(d.allLayouts())).Equals(8)
+	assert.For(ctx, "Level 0 of all layers").That(
+		len(d.layoutsInRange(colorMask, 0, vkRemainingArrayLayers, 0, 1))).Equals(2)
+	assert.For(ctx, "Remaining levels from level 1 of layer 1").That(
+		len(d.layoutsInRange(colorMask, 1, 1, 1, vkRemainingMipLevels))).Equals(3)
+	assert.For(ctx, "Out of range levels").That(
+		len(d.layoutsInRange(colorMask, 0, 2, 4, 1))).Equals(0)
+	assert.For(ctx, "Unmatched aspect").That(
+		len(d.layoutsInRange(depthMask, 0, vkRemainingArrayLayers, 0, vkRemainingMipLevels))).Equals(0)
+
+	mip0 := d.layoutsInRange(colorMask, 0, 1, 0, 1)
+	assert.For(ctx, "Single subresource").That(len(mip0)).Equals(1)
+	assert.For(ctx, "Single subresource label").That(
+		mip0[0] == dependencygraph.DefUseVariable(layers[0][0])).Equals(true)
+
+	// The labels are returned by layer and level, whatever the run.
+	assert.For(ctx, "Ordered layouts").That(d.layoutsInRange(colorMask, 0, 2, 2, 2)).DeepEquals(
+		[]dependencygraph.DefUseVariable{layers[0][2], layers[0][3], layers[1][2], layers[1][3]})
+}
+
+func TestCmdBufNestingLevel(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, test := range []struct {
+		fci   api.SubCmdIdx
+		level int
+		ok    bool
+	}{
+		{api.SubCmdIdx{1, 0, 0}, 0, false},
+		{api.SubCmdIdx{1, 0, 0, 2}, 0, true},
+		{api.SubCmdIdx{1, 0, 0, 2, 0}, 0, false},
+		{api.SubCmdIdx{1, 0, 0, 2, 0, 3}, 1, true},
+		{api.SubCmdIdx{1, 0, 0, 2, 0, 3, 1, 0}, 2, true},
+	} {
+		level, ok := cmdBufNestingLevel(test.fci)
+		assert.For(ctx, "Valid full command index %v", test.fci).That(ok).Equals(test.ok)
+		if ok {
+			assert.For(ctx, "Nesting level of %v", test.fci).That(level).Equals(test.level)
+		}
+	}
+}
+
+func TestDescriptorSetSnapshot(t *testing.T) {
+	ctx := log.Testing(t)
+	vb := newFootprintBuilder()
+	bh := dependencygraph.NewBehavior(api.SubCmdIdx{0})
+	ds := newDescriptorSet()
+	uniform := VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER
+	ds.reserveDescriptor(0, 0, uniform)
+	ds.reserveDescriptor(0, 1, uniform)
+	ds.setDescriptor(ctx, vb, bh, 0, 0, uniform, VkImageView(0), VkImage(0), nil, VkBuffer(1), 0, 16)
+
+	snapshot := ds.snapshot()
+	before := snapshot.getDescriptor(ctx, vb, bh, 0, 0)
+	assert.For(ctx, "Snapshot descriptor").That(before != nil && before.buf == VkBuffer(1)).Equals(true)
+	assert.For(ctx, "Snapshot descriptor counts").That(snapshot.descriptorCounts[0]).Equals(uint64(2))
+
+	// Update after the snapshot is taken.
+	ds.setDescriptor(ctx, vb, bh, 0, 0, uniform, VkImageView(0), VkImage(0), nil, VkBuffer(2), 0, 16)
+	ds.setDescriptor(ctx, vb, bh, 0, 1, uniform, VkImageView(0), VkImage(0), nil, VkBuffer(3), 0, 16)
+	after := snapshot.getDescriptor(ctx, vb, bh, 0, 0)
+	assert.For(ctx, "Updated descriptor in snapshot").That(after.buf).Equals(VkBuffer(1))
+	assert.For(ctx, "New descriptor in snapshot").That(
+		snapshot.getDescriptor(ctx, vb, bh, 0, 1) == nil).Equals(true)
+	assert.For(ctx, "Updated descriptor in set").That(
+		ds.getDescriptor(ctx, vb, bh, 0, 0).buf).Equals(VkBuffer(2))
+}
+
+func TestOwnershipTransfer(t *testing.T) {
+	ctx := log.Testing(t)
+	vb := newFootprintBuilder()
+	graphics := newQueueExecutionState(vb, 0, 0)
+	compute := newQueueExecutionState(vb, 0, 1)
+	transfer := ownershipTransfer{handle: 1, srcQueueFamily: 0, dstQueueFamily: 1}
+
+	release := dependencygraph.NewBehavior(api.SubCmdIdx{0})
+	vb.recordOwnershipTransfer(ctx, release, graphics, transfer)
+	acquire := dependencygraph.NewBehavior(api.SubCmdIdx{1})
+	vb.recordOwnershipTransfer(ctx, acquire, compute, transfer)
+	_, dependsOnRelease := acquire.DependsOn[release]
+	assert.For(ctx, "Acquire depends on release").That(dependsOnRelease).Equals(true)
+
+	ignored := ownershipTransfer{handle: 2, srcQueueFamily: vkQueueFamilyIgnored,
+		dstQueueFamily: vkQueueFamilyIgnored}
+	barrier := dependencygraph.NewBehavior(api.SubCmdIdx{2})
+	vb.recordOwnershipTransfer(ctx, barrier, graphics, ignored)
+	assert.For(ctx, "Barrier without transfer").That(len(vb.ownershipTransfers)).Equals(1)
+}
+
+func TestVertexBufferReadRange(t *testing.T) {
+	ctx := log.Testing(t)
+	a := arena.New()
+	defer a.Dispose()
+	perVertex := NewVkVertexInputBindingDescription(a, 0, 16,
+		VkVertexInputRate_VK_VERTEX_INPUT_RATE_VERTEX)
+	perInstance := NewVkVertexInputBindingDescription(a, 1, 32,
+		VkVertexInputRate_VK_VERTEX_INPUT_RATE_INSTANCE)
+
+	offset, size := vertexBufferReadRange(perVertex, 256, 12, 4, 10, 0, 2)
+	assert.For(ctx, "Per vertex offset").That(offset).Equals(uint64(256 + 4*16))
+	assert.For(ctx, "Per vertex size").That(size).Equals(uint64(10 * 16))
+
+	offset, size = vertexBufferReadRange(perInstance, 0, 32, 4, 10, 1, 2)
+	assert.For(ctx, "Per instance offset").That(offset).Equals(uint64(32))
+	assert.For(ctx, "Per instance size").That(size).Equals(uint64(2 * 32))
+
+	// The last attribute ends past the stride.
+	offset, size = vertexBufferReadRange(perVertex, 256, 24, 4, 10, 0, 2)
+	assert.For(ctx, "Overlapping vertex offset").That(offset).Equals(uint64(256 + 4*16))
+	assert.For(ctx, "Overlapping vertex size").That(size).Equals(uint64(9*16 + 24))
+
+	offset, size = vertexBufferReadRange(perVertex, 256, 0, 4, 10, 0, 2)
+	assert.For(ctx, "Unknown vertex size offset").That(offset).Equals(uint64(0))
+	assert.For(ctx, "Unknown vertex size size").That(size).Equals(vkWholeSize)
+
+	offset, size = vertexBufferReadRange(perVertex, 256, 12, 0, vkWholeSize, 0, 2)
+	assert.For(ctx, "Unknown vertex range offset").That(offset).Equals(uint64(0))
+	assert.For(ctx, "Unknown vertex range size").That(size).Equals(vkWholeSize)
+}
+
+func TestSwapchainImagesReset(t *testing.T) {
+	ctx := log.Testing(t)
+	la := &labelAllocator{}
+	sw := &swapchainImages{}
+	_, _, _, ok := sw.image(0)
+	assert.For(ctx, "Image before query").That(ok).Equals(false)
+
+	sw.reset(la, []VkImage{1, 2})
+	_, acquired, presented, ok := sw.image(1)
+	assert.For(ctx, "Image after query").That(ok).Equals(true)
+	_, _, _, ok = sw.image(2)
+	assert.For(ctx, "Out of range image").That(ok).Equals(false)
+
+	// Querying the same images again keeps the acquire-present labels.
+	sw.reset(la, []VkImage{1, 2})
+	_, a, p, _ := sw.image(1)
+	assert.For(ctx, "Kept acquired label").That(a == acquired).Equals(true)
+	assert.For(ctx, "Kept presented label").That(p == presented).Equals(true)
+
+	// A different image at the same index gets new labels.
+	sw.reset(la, []VkImage{1, 3, 4})
+	img, a, _, _ := sw.image(1)
+	assert.For(ctx, "New image").That(img).Equals(VkImage(3))
+	assert.For(ctx, "Renewed acquired label").That(a == acquired).Equals(false)
+
+	var unknown *swapchainImages
+	_, _, _, ok = unknown.image(0)
+	assert.For(ctx, "Unknown swapchain").That(ok).Equals(false)
+}
+
+func TestMemoryAliasing(t *testing.T) {
+	ctx := log.Testing(t)
+	r := &memorySpanRecords{
+		records:  map[VkDeviceMemory]memorySpanList{},
+		external: map[VkDeviceMemory]struct{}{},
+		bindings: map[VkDeviceMemory][]resourceMemoryBinding{},
+		boundTo:  map[uint64][]VkDeviceMemory{},
+	}
+	mem := VkDeviceMemory(1)
+	assert.For(ctx, "First binding").That(r.bindResource(mem, 10, 0, 256)).DeepEquals([]uint64{})
+	assert.For(ctx, "Disjoint binding").That(r.bindResource(mem, 11, 256, 256)).DeepEquals([]uint64{})
+	assert.For(ctx, "Other memory").That(r.bindResource(VkDeviceMemory(2), 12, 0, 512)).DeepEquals([]uint64{})
+	assert.For(ctx, "Aliasing binding").That(r.bindResource(mem, 13, 128, 256)).DeepEquals([]uint64{10, 11})
+
+	r.unbindResource(10)
+	assert.For(ctx, "Unbound resource").That(r.bindResource(mem, 14, 0, 64)).DeepEquals([]uint64{})
+}
+
+func TestRollOutTrace(t *testing.T) {
+	ctx := log.Testing(t)
+	var none *rollOutTrace
+	none.record(VkQueue(1), api.SubCmdIdx{1, 0, 0})
+
+	tr := &rollOutTrace{}
+	tr.record(VkQueue(1), api.SubCmdIdx{10, 0, 0, 0})
+	tr.record(VkQueue(2), api.SubCmdIdx{11, 0, 0, 0})
+	tr.record(VkQueue(1), api.SubCmdIdx{10, 0, 0, 1})
+
+	buf := &bytes.Buffer{}
+	assert.For(ctx, "Write").ThatError(tr.writeJSON(buf)).Succeeded()
+	trace := struct {
+		TraceEvents []chromeTraceEvent `json:"traceEvents"`
+	}{}
+	assert.For(ctx, "Decode").ThatError(json.Unmarshal(buf.Bytes(), &trace)).Succeeded()
+
+	slices := map[uint64][]string{}
+	names := map[uint64]interface{}{}
+	for _, e := range trace.TraceEvents {
+		switch e.Ph {
+		case "M":
+			names[e.Tid] = e.Args["name"]
+		case "X":
+			slices[e.Tid] = append(slices[e.Tid], e.Name)
+		}
+	}
+	assert.For(ctx, "Queue tracks").That(names).DeepEquals(map[uint64]interface{}{
+		1: "VkQueue 0x1",
+		2: "VkQueue 0x2",
+	})
+	assert.For(ctx, "Slices").That(slices).DeepEquals(map[uint64][]string{
+		1: {"[10 0 0 0]", "[10 0 0 1]"},
+		2: {"[11 0 0 0]"},
+	})
+}
+
+func TestLabelAllocator(t *testing.T) {
+	ctx := log.Testing(t)
+	a, b := &labelAllocator{}, &labelAllocator{}
+	seen := map[*label]struct{}{}
+	for i := uint64(1); i <= labelChunkSize+1; i++ {
+		l := a.newLabel()
+		_, reused := seen[l]
+		assert.For(ctx, "Reused").That(reused).Equals(false)
+		seen[l] = struct{}{}
+		assert.For(ctx, "Label value").That(l.uint64).Equals(i)
+	}
+	assert.For(ctx, "Other builder").That(b.newLabel().uint64).Equals(uint64(1))
+}
+
+func TestMemorySpanGranularity(t *testing.T) {
+	ctx := log.Testing(t)
+	dependsOn := func(g footprintGranularity) bool {
+		r := &memorySpanRecords{
+			records:     map[VkDeviceMemory]memorySpanList{},
+			granularity: g,
+		}
+		span := func(offset, size uint64) *memorySpan {
+			return &memorySpan{memory: VkDeviceMemory(1),
+				sp: interval.U64Span{Start: offset, End: offset + size}, recordTo: r}
+		}
+		vb := newFootprintBuilder()
+		first := dependencygraph.NewBehavior(api.SubCmdIdx{0})
+		vb.write(ctx, first, span(0, 16))
+		second := dependencygraph.NewBehavior(api.SubCmdIdx{1})
+		vb.write(ctx, second, span(32, 16))
+		_, ok := second.DependsOn[first]
+		return ok
+	}
+	assert.For(ctx, "Byte range").That(dependsOn(footprintGranularityByteRange)).Equals(false)
+	assert.For(ctx, "Whole memory").That(dependsOn(footprintGranularityHandle)).Equals(true)
+}
+
+func TestFrameBoundaries(t *testing.T) {
+	ctx := log.Testing(t)
+	a, b := VkSwapchainKHR(1), VkSwapchainKHR(2)
+
+	// One swapchain, every presentation ends a frame.
+	f := newFrameBoundaries()
+	f.present(3, a)
+	f.present(7, a)
+	f.present(9, a)
+	assert.For(ctx, "One swapchain").ThatSlice(f.frameEnds()).Equals([]api.CmdID{3, 7, 9})
+
+	// Two swapchains presented with separate calls, possibly from different
+	// queues, end a frame once both are presented.
+	f = newFrameBoundaries()
+	f.present(3, a)
+	f.present(4, b)
+	f.present(7, a)
+	f.present(8, b)
+	f.present(10, a)
+	assert.For(ctx, "Separate presentations").ThatSlice(f.frameEnds()).Equals([]api.CmdID{4, 8, 10})
+
+	// Two swapchains presented with a single call.
+	f = newFrameBoundaries()
+	f.present(3, a)
+	f.present(3, b)
+	f.present(6, a)
+	f.present(6, b)
+	assert.For(ctx, "Single presentation").ThatSlice(f.frameEnds()).Equals([]api.CmdID{3, 6})
+
+	// No presentation.
+	f = newFrameBoundaries()
+	assert.For(ctx, "No presentation").That(len(f.frameEnds())).Equals(0)
+}
+
+func TestImageLayoutTimeline(t *testing.T) {
+	ctx := log.Testing(t)
+	color := VkImageAspectFlagBits_VK_IMAGE_ASPECT_COLOR_BIT
+	undefined := VkImageLayout_VK_IMAGE_LAYOUT_UNDEFINED
+	general := VkImageLayout_VK_IMAGE_LAYOUT_GENERAL
+	img := VkImage(1)
+	r := newImageLayoutsRecorder()
+	r.timelines[img] = []*imageLayoutTimeline{
+		{
+			created: 2,
+			changes: map[imageSubresource][]imageLayoutChange{
+				{color, 0, 1}: {{2, undefined, nil}},
+				{color, 0, 0}: {{2, undefined, nil}, {5, general, api.SubCmdIdx{5, 0, 0, 1}}},
+			},
+		},
+		{
+			created: 8,
+			changes: map[imageSubresource][]imageLayoutChange{
+				{color, 0, 0}: {{8, general, api.SubCmdIdx{8}}},
+			},
+		},
+	}
+
+	// The commands are shifted by one initial command.
+	p := &path.Capture{}
+	assert.For(ctx, "Not created").That(r.layouts(p, 1, img, 1)).IsNil()
+	assert.For(ctx, "Created").That(r.layouts(p, 1, img, 4)).DeepEquals([]*service.ImageSubresourceLayout{
+		{Aspect: uint32(color), Level: 0, Layout: uint32(undefined), LayoutName: undefined.String()},
+		{Aspect: uint32(color), Level: 1, Layout: uint32(undefined), LayoutName: undefined.String()},
+	})
+	assert.For(ctx, "Transitioned").That(r.layouts(p, 1, img, 5)).DeepEquals([]*service.ImageSubresourceLayout{
+		{Aspect: uint32(color), Level: 0, Layout: uint32(general), LayoutName: general.String(),
+			LastSet: p.Command(4, 0, 0, 1)},
+		{Aspect: uint32(color), Level: 1, Layout: uint32(undefined), LayoutName: undefined.String()},
+	})
+	assert.For(ctx, "Recreated").That(r.layouts(p, 1, img, 9)).DeepEquals([]*service.ImageSubresourceLayout{
+		{Aspect: uint32(color), Level: 0, Layout: uint32(general), LayoutName: general.String(),
+			LastSet: p.Command(7)},
+	})
+}
+
+func TestBoundDescriptors(t *testing.T) {
+	ctx := log.Testing(t)
+	vb := newFootprintBuilder()
+	bh := dependencygraph.NewBehavior(api.SubCmdIdx{0})
+	ds := newDescriptorSet()
+	dynamic := VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER_DYNAMIC
+	sampled := VkDescriptorType_VK_DESCRIPTOR_TYPE_COMBINED_IMAGE_SAMPLER
+	ds.reserveDescriptor(0, 0, sampled)
+	ds.reserveDescriptor(1, 0, dynamic)
+	ds.reserveDescriptor(1, 1, dynamic)
+	ds.reserveDescriptor(2, 0, dynamic)
+	ds.setDescriptor(ctx, vb, bh, 0, 0, sampled, VkImageView(1), VkImage(2),
+		&vkHandle{handle: 3}, VkBuffer(0), 0, 0)
+	ds.setDescriptor(ctx, vb, bh, 1, 0, dynamic, VkImageView(0), VkImage(0), nil, VkBuffer(4), 16, 64)
+	ds.setDescriptor(ctx, vb, bh, 2, 0, dynamic, VkImageView(0), VkImage(0), nil, VkBuffer(5), 0, 32)
+
+	// The unwritten descriptor of binding 1 still consumes the offset 512.
+	bds := newBoundDescriptorSet(ctx, vb, bh, VkPipelineLayout(6), VkDescriptorSet(7), ds, []uint32{256, 512, 1024})
+	assert.For(ctx, "Bound descriptors").That(bds.boundDescriptors()).DeepEquals(
+		map[uint32][]*BoundDescriptor{
+			0: {{Type: sampled, ImageView: 1, Image: 2, Sampler: 3}},
+			1: {{Type: dynamic, Buffer: 4, Offset: 16 + 256, Range: 64}, nil},
+			2: {{Type: dynamic, Buffer: 5, Offset: 1024, Range: 32}},
+		})
+}
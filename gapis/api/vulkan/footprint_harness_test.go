@@ -0,0 +1,910 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/resolve/dependencygraph"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// footprintHarness builds the footprint of a synthetic capture fragment. The
+// commands are created with the stateBuilder helpers, so that their memory
+// observations are set up as in a real capture, and are fed to a
+// FootprintBuilder one by one.
+type footprintHarness struct {
+	ctx        context.Context
+	sb         *stateBuilder
+	out        *footprintHarnessOutput
+	accesses   *footprintAccesses
+	lastHandle uint64
+}
+
+// footprintHarnessOutput is the stateBuilderOutput of the footprintHarness,
+// which builds the footprint of each written command.
+type footprintHarnessOutput struct {
+	s  *api.GlobalState
+	vb *FootprintBuilder
+	ft *dependencygraph.Footprint
+}
+
+func (o *footprintHarnessOutput) write(ctx context.Context, cmd api.Cmd, _ api.CmdID) {
+	id := api.CmdID(len(o.ft.Commands))
+	o.ft.Commands = append(o.ft.Commands, cmd)
+	o.vb.BuildFootprint(ctx, o.s, o.ft, id, cmd)
+}
+
+func (o *footprintHarnessOutput) getOldState() *api.GlobalState {
+	return o.s
+}
+
+func (o *footprintHarnessOutput) getNewState() *api.GlobalState {
+	return o.s
+}
+
+func newFootprintHarness(ctx context.Context) *footprintHarness {
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	s := api.NewStateWithEmptyAllocator(device.Little32)
+	out := &footprintHarnessOutput{
+		s:  s,
+		vb: newFootprintBuilder(),
+		ft: dependencygraph.NewFootprint(ctx, []api.Cmd{}, 0),
+	}
+	accesses := &footprintAccesses{
+		vb:     out.vb,
+		reads:  map[string]map[string]struct{}{},
+		writes: map[string]map[string]struct{}{},
+	}
+	out.vb.observers = []footprintObserver{accesses}
+	return &footprintHarness{
+		ctx:        ctx,
+		sb:         GetState(s).newStateBuilder(ctx, out),
+		out:        out,
+		accesses:   accesses,
+		lastHandle: 0x1000,
+	}
+}
+
+func (h *footprintHarness) newHandle() uint64 {
+	h.lastHandle++
+	return h.lastHandle
+}
+
+// write builds the footprint of the given command, and returns its ID.
+func (h *footprintHarness) write(cmd api.Cmd) api.CmdID {
+	id := api.CmdID(len(h.out.ft.Commands))
+	numBehaviors := len(h.out.ft.Behaviors)
+	h.sb.write(cmd)
+	assert.For(h.ctx, "Behaviors of %v", cmd).That(len(h.out.ft.Behaviors) > numBehaviors).Equals(true)
+	return id
+}
+
+// device adds a device with a single queue to the state. The device and queue
+// are not created with commands, as the FootprintBuilder only needs their
+// handles.
+func (h *footprintHarness) device() (VkDevice, VkQueue) {
+	a := h.out.s.Arena
+	dev := VkDevice(h.newHandle())
+	devObj := MakeDeviceObjectʳ(a)
+	devObj.SetVulkanHandle(dev)
+	GetState(h.out.s).Devices().Add(dev, devObj)
+	q := VkQueue(h.newHandle())
+	qObj := MakeQueueObjectʳ(a)
+	qObj.SetDevice(dev)
+	qObj.SetFamily(0)
+	qObj.SetVulkanHandle(q)
+	GetState(h.out.s).Queues().Add(q, qObj)
+	return dev, q
+}
+
+func (h *footprintHarness) allocateMemory(dev VkDevice, size uint64) (VkDeviceMemory, api.CmdID) {
+	mem := VkDeviceMemory(h.newHandle())
+	sb := h.sb
+	return mem, h.write(sb.cb.VkAllocateMemory(
+		dev,
+		NewVkMemoryAllocateInfoᶜᵖ(sb.MustAllocReadData(
+			NewVkMemoryAllocateInfo(sb.ta,
+				VkStructureType_VK_STRUCTURE_TYPE_MEMORY_ALLOCATE_INFO, // sType
+				0,                  // pNext
+				VkDeviceSize(size), // allocationSize
+				0,                  // memoryTypeIndex
+			)).Ptr()),
+		memory.Nullptr,
+		sb.MustAllocWriteData(mem).Ptr(),
+		VkResult_VK_SUCCESS,
+	))
+}
+
+func (h *footprintHarness) freeMemory(dev VkDevice, mem VkDeviceMemory) api.CmdID {
+	return h.write(h.sb.cb.VkFreeMemory(dev, mem, memory.Nullptr))
+}
+
+func (h *footprintHarness) createBuffer(dev VkDevice, size uint64,
+	flags VkBufferCreateFlags) (VkBuffer, api.CmdID) {
+	return h.createBufferWithUsage(dev, size, flags, 0)
+}
+
+// createBufferWithUsage creates a buffer usable for the transfers, and for
+// the given usage.
+func (h *footprintHarness) createBufferWithUsage(dev VkDevice, size uint64,
+	flags VkBufferCreateFlags, usage VkBufferUsageFlags) (VkBuffer, api.CmdID) {
+	buf := VkBuffer(h.newHandle())
+	sb := h.sb
+	return buf, h.write(sb.cb.VkCreateBuffer(
+		dev,
+		sb.MustAllocReadData(
+			NewVkBufferCreateInfo(sb.ta,
+				VkStructureType_VK_STRUCTURE_TYPE_BUFFER_CREATE_INFO, // sType
+				0,                  // pNext
+				flags,              // flags
+				VkDeviceSize(size), // size
+				usage|VkBufferUsageFlags(VkBufferUsageFlagBits_VK_BUFFER_USAGE_TRANSFER_SRC_BIT|
+					VkBufferUsageFlagBits_VK_BUFFER_USAGE_TRANSFER_DST_BIT), // usage
+				VkSharingMode_VK_SHARING_MODE_EXCLUSIVE, // sharingMode
+				0,                                       // queueFamilyIndexCount
+				0,                                       // pQueueFamilyIndices
+			)).Ptr(),
+		memory.Nullptr,
+		sb.MustAllocWriteData(buf).Ptr(),
+		VkResult_VK_SUCCESS,
+	))
+}
+
+func (h *footprintHarness) bindBufferMemory(dev VkDevice, buf VkBuffer,
+	mem VkDeviceMemory, offset uint64) api.CmdID {
+	return h.write(h.sb.cb.VkBindBufferMemory(
+		dev, buf, mem, VkDeviceSize(offset), VkResult_VK_SUCCESS))
+}
+
+func (h *footprintHarness) bindSparseBufferMemory(q VkQueue, buf VkBuffer,
+	mem VkDeviceMemory, offset, size uint64) api.CmdID {
+	sb := h.sb
+	return h.write(sb.cb.VkQueueBindSparse(
+		q,
+		1,
+		sb.MustAllocReadData(
+			NewVkBindSparseInfo(sb.ta,
+				VkStructureType_VK_STRUCTURE_TYPE_BIND_SPARSE_INFO, // sType
+				0, // pNext
+				0, // waitSemaphoreCount
+				0, // pWaitSemaphores
+				1, // bufferBindCount
+				NewVkSparseBufferMemoryBindInfoᶜᵖ(sb.MustAllocReadData( // pBufferBinds
+					NewVkSparseBufferMemoryBindInfo(sb.ta,
+						buf, // buffer
+						1,   // bindCount
+						NewVkSparseMemoryBindᶜᵖ(sb.MustAllocReadData( // pBinds
+							NewVkSparseMemoryBind(sb.ta,
+								0,                    // resourceOffset
+								VkDeviceSize(size),   // size
+								mem,                  // memory
+								VkDeviceSize(offset), // memoryOffset
+								0,                    // flags
+							)).Ptr()),
+					)).Ptr()),
+				0, // imageOpaqueBindCount
+				0, // pImageOpaqueBinds
+				0, // imageBindCount
+				0, // pImageBinds
+				0, // signalSemaphoreCount
+				0, // pSignalSemaphores
+			)).Ptr(),
+		VkFence(0),
+		VkResult_VK_SUCCESS,
+	))
+}
+
+// bufferFixture is a device with a single queue, and buffers of 256 bytes
+// bound one after the other to the same device memory.
+type bufferFixture struct {
+	dev     VkDevice
+	q       VkQueue
+	mem     VkDeviceMemory
+	alloc   api.CmdID
+	buffers []VkBuffer
+	creates []api.CmdID
+	binds   []api.CmdID
+}
+
+// buffers creates the bufferFixture, with a buffer for each of the given
+// usages. All the buffers are usable for the transfers.
+func (h *footprintHarness) buffers(usages ...VkBufferUsageFlags) *bufferFixture {
+	f := &bufferFixture{}
+	f.dev, f.q = h.device()
+	f.mem, f.alloc = h.allocateMemory(f.dev, uint64(256*len(usages)))
+	for _, usage := range usages {
+		buf, create := h.createBufferWithUsage(f.dev, 256, 0, usage)
+		f.buffers = append(f.buffers, buf)
+		f.creates = append(f.creates, create)
+	}
+	for i, buf := range f.buffers {
+		f.binds = append(f.binds, h.bindBufferMemory(f.dev, buf, f.mem, uint64(256*i)))
+	}
+	return f
+}
+
+// commandBuffer creates a command pool and a primary command buffer, and
+// begins the command buffer.
+func (h *footprintHarness) commandBuffer(dev VkDevice) VkCommandBuffer {
+	vkCb, _, _ := h.allocateCommandBuffer(dev)
+	return vkCb
+}
+
+// allocateCommandBuffer creates a command pool and a primary command buffer,
+// and begins the command buffer. It returns the command buffer with the
+// commands allocating and beginning it.
+func (h *footprintHarness) allocateCommandBuffer(dev VkDevice) (VkCommandBuffer, api.CmdID, api.CmdID) {
+	sb := h.sb
+	pool := VkCommandPool(h.newHandle())
+	h.write(sb.cb.VkCreateCommandPool(
+		dev,
+		sb.MustAllocReadData(NewVkCommandPoolCreateInfo(sb.ta,
+			VkStructureType_VK_STRUCTURE_TYPE_COMMAND_POOL_CREATE_INFO, // sType
+			0, // pNext
+			0, // flags
+			0, // queueFamilyIndex
+		)).Ptr(),
+		memory.Nullptr,
+		sb.MustAllocWriteData(pool).Ptr(),
+		VkResult_VK_SUCCESS,
+	))
+	vkCb := VkCommandBuffer(h.newHandle())
+	allocate := h.write(sb.cb.VkAllocateCommandBuffers(
+		dev,
+		sb.MustAllocReadData(NewVkCommandBufferAllocateInfo(sb.ta,
+			VkStructureType_VK_STRUCTURE_TYPE_COMMAND_BUFFER_ALLOCATE_INFO, // sType
+			0,    // pNext
+			pool, // commandPool
+			VkCommandBufferLevel_VK_COMMAND_BUFFER_LEVEL_PRIMARY, // level
+			uint32(1), // commandBufferCount
+		)).Ptr(),
+		sb.MustAllocWriteData(vkCb).Ptr(),
+		VkResult_VK_SUCCESS,
+	))
+	begin := h.write(sb.cb.VkBeginCommandBuffer(
+		vkCb,
+		sb.MustAllocReadData(NewVkCommandBufferBeginInfo(sb.ta,
+			VkStructureType_VK_STRUCTURE_TYPE_COMMAND_BUFFER_BEGIN_INFO, // sType
+			0, // pNext
+			VkCommandBufferUsageFlags(VkCommandBufferUsageFlagBits_VK_COMMAND_BUFFER_USAGE_ONE_TIME_SUBMIT_BIT), // flags
+			0, // pInheritanceInfo
+		)).Ptr(),
+		VkResult_VK_SUCCESS,
+	))
+	return vkCb, allocate, begin
+}
+
+func (h *footprintHarness) endCommandBuffer(vkCb VkCommandBuffer) api.CmdID {
+	return h.write(h.sb.cb.VkEndCommandBuffer(vkCb, VkResult_VK_SUCCESS))
+}
+
+func (h *footprintHarness) cmdFillBuffer(vkCb VkCommandBuffer, buf VkBuffer,
+	offset, size uint64) api.CmdID {
+	return h.write(h.sb.cb.VkCmdFillBuffer(
+		vkCb, buf, VkDeviceSize(offset), VkDeviceSize(size), 0))
+}
+
+func (h *footprintHarness) cmdBufferBarrier(vkCb VkCommandBuffer, buf VkBuffer,
+	srcStages, dstStages VkPipelineStageFlagBits) api.CmdID {
+	sb := h.sb
+	return h.write(sb.cb.VkCmdPipelineBarrier(
+		vkCb,
+		VkPipelineStageFlags(srcStages),
+		VkPipelineStageFlags(dstStages),
+		VkDependencyFlags(0),
+		0,
+		memory.Nullptr,
+		1,
+		sb.MustAllocReadData(NewVkBufferMemoryBarrier(sb.ta,
+			VkStructureType_VK_STRUCTURE_TYPE_BUFFER_MEMORY_BARRIER, // sType
+			0, // pNext
+			VkAccessFlags(VkAccessFlagBits_VK_ACCESS_TRANSFER_WRITE_BIT), // srcAccessMask
+			VkAccessFlags(VkAccessFlagBits_VK_ACCESS_TRANSFER_READ_BIT),  // dstAccessMask
+			queueFamilyIgnore,         // srcQueueFamilyIndex
+			queueFamilyIgnore,         // dstQueueFamilyIndex
+			buf,                       // buffer
+			0,                         // offset
+			VkDeviceSize(vkWholeSize), // size
+		)).Ptr(),
+		0,
+		memory.Nullptr,
+	))
+}
+
+func (h *footprintHarness) cmdCopyBuffer(vkCb VkCommandBuffer, src, dst VkBuffer,
+	size uint64) api.CmdID {
+	sb := h.sb
+	return h.write(sb.cb.VkCmdCopyBuffer(
+		vkCb,
+		src,
+		dst,
+		1,
+		sb.MustAllocReadData(NewVkBufferCopy(sb.ta,
+			0,                  // srcOffset
+			0,                  // dstOffset
+			VkDeviceSize(size), // size
+		)).Ptr(),
+	))
+}
+
+// renderPass creates a render pass without attachments, and a framebuffer
+// for it.
+func (h *footprintHarness) renderPass(dev VkDevice) (VkRenderPass, api.CmdID, VkFramebuffer, api.CmdID) {
+	sb := h.sb
+	rp := VkRenderPass(h.newHandle())
+	rpID := h.write(sb.cb.VkCreateRenderPass(
+		dev,
+		NewVkRenderPassCreateInfoᶜᵖ(sb.MustAllocReadData(
+			NewVkRenderPassCreateInfo(sb.ta,
+				VkStructureType_VK_STRUCTURE_TYPE_RENDER_PASS_CREATE_INFO, // sType
+				0, // pNext
+				0, // flags
+				0, // attachmentCount
+				0, // pAttachments
+				1, // subpassCount
+				NewVkSubpassDescriptionᶜᵖ(sb.MustAllocReadData( // pSubpasses
+					NewVkSubpassDescription(sb.ta,
+						0, // flags
+						VkPipelineBindPoint_VK_PIPELINE_BIND_POINT_GRAPHICS, // pipelineBindPoint
+						0, // inputAttachmentCount
+						0, // pInputAttachments
+						0, // colorAttachmentCount
+						0, // pColorAttachments
+						0, // pResolveAttachments
+						0, // pDepthStencilAttachment
+						0, // preserveAttachmentCount
+						0, // pPreserveAttachments
+					)).Ptr()),
+				0, // dependencyCount
+				0, // pDependencies
+			)).Ptr()),
+		memory.Nullptr,
+		sb.MustAllocWriteData(rp).Ptr(),
+		VkResult_VK_SUCCESS,
+	))
+	fb := VkFramebuffer(h.newHandle())
+	fbID := h.write(sb.cb.VkCreateFramebuffer(
+		dev,
+		NewVkFramebufferCreateInfoᶜᵖ(sb.MustAllocReadData(
+			NewVkFramebufferCreateInfo(sb.ta,
+				VkStructureType_VK_STRUCTURE_TYPE_FRAMEBUFFER_CREATE_INFO, // sType
+				0,  // pNext
+				0,  // flags
+				rp, // renderPass
+				0,  // attachmentCount
+				0,  // pAttachments
+				16, // width
+				16, // height
+				1,  // layers
+			)).Ptr()),
+		memory.Nullptr,
+		sb.MustAllocWriteData(fb).Ptr(),
+		VkResult_VK_SUCCESS,
+	))
+	return rp, rpID, fb, fbID
+}
+
+func (h *footprintHarness) cmdBeginRenderPass(vkCb VkCommandBuffer,
+	rp VkRenderPass, fb VkFramebuffer) api.CmdID {
+	sb := h.sb
+	return h.write(sb.cb.VkCmdBeginRenderPass(
+		vkCb,
+		sb.MustAllocReadData(
+			NewVkRenderPassBeginInfo(sb.ta,
+				VkStructureType_VK_STRUCTURE_TYPE_RENDER_PASS_BEGIN_INFO, // sType
+				NewVoidᶜᵖ(memory.Nullptr),                                // pNext
+				rp,                                                       // renderPass
+				fb,                                                       // framebuffer
+				NewVkRect2D(sb.ta, // renderArea
+					MakeVkOffset2D(sb.ta),
+					NewVkExtent2D(sb.ta, 16, 16),
+				),
+				0, // clearValueCount
+				0, // pClearValues
+			)).Ptr(),
+		VkSubpassContents(0),
+	))
+}
+
+func (h *footprintHarness) cmdEndRenderPass(vkCb VkCommandBuffer) api.CmdID {
+	return h.write(h.sb.cb.VkCmdEndRenderPass(vkCb))
+}
+
+func (h *footprintHarness) cmdBindVertexBuffer(vkCb VkCommandBuffer, binding uint32,
+	buf VkBuffer, offset uint64) api.CmdID {
+	sb := h.sb
+	return h.write(sb.cb.VkCmdBindVertexBuffers(
+		vkCb,
+		binding,
+		1,
+		sb.MustAllocReadData(buf).Ptr(),
+		sb.MustAllocReadData(VkDeviceSize(offset)).Ptr(),
+	))
+}
+
+func (h *footprintHarness) cmdBindIndexBuffer(vkCb VkCommandBuffer, buf VkBuffer,
+	offset uint64, indexType VkIndexType) api.CmdID {
+	return h.write(h.sb.cb.VkCmdBindIndexBuffer(vkCb, buf, VkDeviceSize(offset), indexType))
+}
+
+func (h *footprintHarness) cmdSetLineWidth(vkCb VkCommandBuffer, width float32) api.CmdID {
+	return h.write(h.sb.cb.VkCmdSetLineWidth(vkCb, width))
+}
+
+func (h *footprintHarness) submit(q VkQueue, vkCbs ...VkCommandBuffer) api.CmdID {
+	sb := h.sb
+	return h.write(sb.cb.VkQueueSubmit(
+		q,
+		1,
+		sb.MustAllocReadData(NewVkSubmitInfo(sb.ta,
+			VkStructureType_VK_STRUCTURE_TYPE_SUBMIT_INFO, // sType
+			0,                  // pNext
+			0,                  // waitSemaphoreCount
+			0,                  // pWaitSemaphores
+			0,                  // pWaitDstStageMask
+			uint32(len(vkCbs)), // commandBufferCount
+			NewVkCommandBufferᶜᵖ(sb.MustAllocReadData(vkCbs).Ptr()), // pCommandBuffers
+			0, // signalSemaphoreCount
+			0, // pSignalSemaphores
+		)).Ptr(),
+		VkFence(0),
+		VkResult_VK_SUCCESS,
+	))
+}
+
+// dependencies returns the commands and subcommands that the behaviors of
+// the given command or subcommand directly depend on, in the order of their
+// indices, a command before its subcommands.
+func (h *footprintHarness) dependencies(owner api.SubCmdIdx) []api.SubCmdIdx {
+	seen := map[string]struct{}{}
+	out := []api.SubCmdIdx{}
+	for _, b := range h.out.ft.Behaviors {
+		if !b.Owner.Equals(owner) {
+			continue
+		}
+		for d := range b.DependsOn {
+			key := fmt.Sprint(d.Owner)
+			if _, ok := seen[key]; ok || d.Owner.Equals(owner) {
+				continue
+			}
+			seen[key] = struct{}{}
+			out = append(out, d.Owner)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return out
+}
+
+// footprintAccesses records the variables read and written by the behaviors
+// of each command and subcommand, as their descriptions, so that the tests
+// can assert the exact read and write sets.
+type footprintAccesses struct {
+	vb     *FootprintBuilder
+	reads  map[string]map[string]struct{}
+	writes map[string]map[string]struct{}
+}
+
+func (a *footprintAccesses) access(bh *dependencygraph.Behavior, write bool,
+	c dependencygraph.DefUseVariable) {
+	accesses := a.reads
+	if write {
+		accesses = a.writes
+	}
+	owner := fmt.Sprint(bh.Owner)
+	if _, ok := accesses[owner]; !ok {
+		accesses[owner] = map[string]struct{}{}
+	}
+	accesses[owner][a.describe(c)] = struct{}{}
+}
+
+// describe returns the description of the variable. The handles, the memory
+// spans, the resource bindings and the labels of the command buffers and of
+// the memory requirements are named after their objects. The recorded
+// commands are described as "command", the other labels as "label", and the
+// other variables by their types.
+func (a *footprintAccesses) describe(c dependencygraph.DefUseVariable) string {
+	switch c := c.(type) {
+	case *vkHandle:
+		return handleVar(c.handle)
+	case *memorySpan:
+		return memoryVar(c.memory, c.sp.Start, c.sp.End)
+	case *resBinding:
+		return "binding of " + a.describe(c.backingData)
+	case *commandBufferCommand:
+		return "command"
+	case *label:
+		for vkCb, cb := range a.vb.commandBuffers {
+			switch c {
+			case cb.begin:
+				return beginVar(vkCb)
+			case cb.end:
+				return endVar(vkCb)
+			case cb.renderPassBegin:
+				return fmt.Sprintf("render pass begin of %#x", uint64(vkCb))
+			}
+		}
+		for handle, l := range a.vb.memoryRequirements {
+			if c == l {
+				return requirementsVar(handle)
+			}
+		}
+		return "label"
+	}
+	return fmt.Sprintf("%T", c)
+}
+
+func handleVar(handle uint64) string {
+	return fmt.Sprintf("handle %#x", handle)
+}
+
+func memoryVar(mem VkDeviceMemory, start, end uint64) string {
+	return fmt.Sprintf("memory %#x [%d, %d)", uint64(mem), start, end)
+}
+
+func bindingVar(mem VkDeviceMemory, start, end uint64) string {
+	return "binding of " + memoryVar(mem, start, end)
+}
+
+func requirementsVar(handle uint64) string {
+	return fmt.Sprintf("memory requirements of %#x", handle)
+}
+
+func beginVar(vkCb VkCommandBuffer) string {
+	return fmt.Sprintf("begin of %#x", uint64(vkCb))
+}
+
+func endVar(vkCb VkCommandBuffer) string {
+	return fmt.Sprintf("end of %#x", uint64(vkCb))
+}
+
+// assertAccesses asserts that the behaviors of the given command or
+// subcommand read and write exactly the given variables, in any order.
+func (h *footprintHarness) assertAccesses(name string, owner api.SubCmdIdx,
+	reads, writes []string) {
+	sorted := func(accesses map[string]struct{}) []string {
+		out := []string{}
+		for v := range accesses {
+			out = append(out, v)
+		}
+		sort.Strings(out)
+		return out
+	}
+	set := func(vs []string) map[string]struct{} {
+		out := map[string]struct{}{}
+		for _, v := range vs {
+			out[v] = struct{}{}
+		}
+		return out
+	}
+	key := fmt.Sprint(owner)
+	assert.For(h.ctx, "%s reads", name).That(sorted(h.accesses.reads[key])).DeepEquals(sorted(set(reads)))
+	assert.For(h.ctx, "%s writes", name).That(sorted(h.accesses.writes[key])).DeepEquals(sorted(set(writes)))
+}
+
+func cmdIdx(id api.CmdID, sub ...uint64) api.SubCmdIdx {
+	return append(api.SubCmdIdx{uint64(id)}, sub...)
+}
+
+func TestFootprintHarnessBufferCopies(t *testing.T) {
+	h := newFootprintHarness(log.Testing(t))
+	ctx := h.ctx
+	f := h.buffers(0, 0, 0)
+	mem, alloc := f.mem, f.alloc
+	a, b, c := f.buffers[0], f.buffers[1], f.buffers[2]
+	createA, createB, createC := f.creates[0], f.creates[1], f.creates[2]
+	bindA, bindB, bindC := f.binds[0], f.binds[1], f.binds[2]
+	vkCb, allocCb, beginCb := h.allocateCommandBuffer(f.dev)
+	recordFill := h.cmdFillBuffer(vkCb, a, 0, 256)
+	recordAB := h.cmdCopyBuffer(vkCb, a, b, 256)
+	recordBC := h.cmdCopyBuffer(vkCb, b, c, 256)
+	end := h.endCommandBuffer(vkCb)
+	submit := h.submit(f.q, vkCb)
+
+	assert.For(ctx, "bind A").That(h.dependencies(cmdIdx(bindA))).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(alloc), cmdIdx(createA)})
+	assert.For(ctx, "bind B").That(h.dependencies(cmdIdx(bindB))).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(alloc), cmdIdx(createB)})
+	assert.For(ctx, "record fill").That(h.dependencies(cmdIdx(recordFill))).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(createA), cmdIdx(bindA), cmdIdx(allocCb), cmdIdx(beginCb)})
+	assert.For(ctx, "record copy A to B").That(h.dependencies(cmdIdx(recordAB))).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(createA), cmdIdx(createB), cmdIdx(bindA), cmdIdx(bindB),
+			cmdIdx(allocCb), cmdIdx(beginCb)})
+	assert.For(ctx, "record copy B to C").That(h.dependencies(cmdIdx(recordBC))).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(createB), cmdIdx(createC), cmdIdx(bindB), cmdIdx(bindC),
+			cmdIdx(allocCb), cmdIdx(beginCb)})
+	assert.For(ctx, "end").That(h.dependencies(cmdIdx(end))).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(allocCb), cmdIdx(beginCb)})
+	assert.For(ctx, "submit").That(h.dependencies(cmdIdx(submit))).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(end)})
+
+	fill := cmdIdx(submit, 0, 0, 0)
+	copyAB := cmdIdx(submit, 0, 0, 1)
+	copyBC := cmdIdx(submit, 0, 0, 2)
+	assert.For(ctx, "fill").That(h.dependencies(fill)).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(recordFill), cmdIdx(submit)})
+	assert.For(ctx, "copy A to B").That(h.dependencies(copyAB)).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(recordAB), cmdIdx(submit), fill})
+	assert.For(ctx, "copy B to C").That(h.dependencies(copyBC)).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(recordBC), cmdIdx(submit), copyAB})
+
+	h.assertAccesses("allocate", cmdIdx(alloc), nil, []string{handleVar(uint64(mem))})
+	h.assertAccesses("create A", cmdIdx(createA), nil, []string{handleVar(uint64(a))})
+	h.assertAccesses("bind A", cmdIdx(bindA),
+		[]string{handleVar(uint64(a)), requirementsVar(uint64(a)), handleVar(uint64(mem))},
+		[]string{bindingVar(mem, 0, 256)})
+	h.assertAccesses("record fill", cmdIdx(recordFill),
+		[]string{handleVar(uint64(a)), bindingVar(mem, 0, 256),
+			handleVar(uint64(vkCb)), beginVar(vkCb)},
+		[]string{bindingVar(mem, 0, 256), "command"})
+	h.assertAccesses("record copy A to B", cmdIdx(recordAB),
+		[]string{handleVar(uint64(a)), bindingVar(mem, 0, 256),
+			handleVar(uint64(b)), bindingVar(mem, 256, 512),
+			handleVar(uint64(vkCb)), beginVar(vkCb)},
+		[]string{bindingVar(mem, 0, 256), bindingVar(mem, 256, 512), "command"})
+	h.assertAccesses("end", cmdIdx(end),
+		[]string{handleVar(uint64(vkCb)), beginVar(vkCb)},
+		[]string{endVar(vkCb)})
+	// The subcommands read their recorded commands and the label of the
+	// submission.
+	h.assertAccesses("fill", fill,
+		[]string{"command", "label"},
+		[]string{memoryVar(mem, 0, 256)})
+	h.assertAccesses("copy A to B", copyAB,
+		[]string{"command", "label", memoryVar(mem, 0, 256)},
+		[]string{memoryVar(mem, 256, 512)})
+	h.assertAccesses("copy B to C", copyBC,
+		[]string{"command", "label", memoryVar(mem, 256, 512)},
+		[]string{memoryVar(mem, 512, 768)})
+}
+
+func TestFootprintHarnessSparseBinding(t *testing.T) {
+	h := newFootprintHarness(log.Testing(t))
+	ctx := h.ctx
+	dev, q := h.device()
+	mem, alloc := h.allocateMemory(dev, 512)
+	sparse, createSparse := h.createBuffer(dev, 256,
+		VkBufferCreateFlags(VkBufferCreateFlagBits_VK_BUFFER_CREATE_SPARSE_BINDING_BIT))
+	dst, createDst := h.createBuffer(dev, 256, 0)
+	bindDst := h.bindBufferMemory(dev, dst, mem, 256)
+	bindSparse := h.bindSparseBufferMemory(q, sparse, mem, 0, 256)
+	vkCb, allocCb, beginCb := h.allocateCommandBuffer(dev)
+	record := h.cmdCopyBuffer(vkCb, sparse, dst, 256)
+	h.endCommandBuffer(vkCb)
+	submit := h.submit(q, vkCb)
+
+	assert.For(ctx, "bind sparse").That(h.dependencies(cmdIdx(bindSparse))).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(alloc), cmdIdx(createSparse)})
+	assert.For(ctx, "record copy").That(h.dependencies(cmdIdx(record))).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(createSparse), cmdIdx(createDst), cmdIdx(bindDst),
+			cmdIdx(bindSparse), cmdIdx(allocCb), cmdIdx(beginCb)})
+	// Nothing was written to the sparse buffer before the copy.
+	assert.For(ctx, "copy").That(h.dependencies(cmdIdx(submit, 0, 0, 0))).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(record), cmdIdx(submit)})
+}
+
+func TestFootprintHarnessRenderPass(t *testing.T) {
+	h := newFootprintHarness(log.Testing(t))
+	ctx := h.ctx
+	dev, q := h.device()
+	rp, createRp, fb, createFb := h.renderPass(dev)
+	vkCb, allocCb, beginCb := h.allocateCommandBuffer(dev)
+	begin := h.cmdBeginRenderPass(vkCb, rp, fb)
+	endRp := h.cmdEndRenderPass(vkCb)
+	end := h.endCommandBuffer(vkCb)
+	submit := h.submit(q, vkCb)
+
+	assert.For(ctx, "create render pass").That(h.dependencies(cmdIdx(createRp))).DeepEquals(
+		[]api.SubCmdIdx{})
+	assert.For(ctx, "create framebuffer").That(h.dependencies(cmdIdx(createFb))).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(createRp)})
+	assert.For(ctx, "record begin").That(h.dependencies(cmdIdx(begin))).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(createRp), cmdIdx(createFb), cmdIdx(allocCb), cmdIdx(beginCb)})
+	assert.For(ctx, "record end").That(h.dependencies(cmdIdx(endRp))).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(allocCb), cmdIdx(beginCb), cmdIdx(begin)})
+	assert.For(ctx, "submit").That(h.dependencies(cmdIdx(submit))).DeepEquals(
+		[]api.SubCmdIdx{cmdIdx(end)})
+}
+
+func TestFootprintHarnessBoundPipelineState(t *testing.T) {
+	h := newFootprintHarness(log.Testing(t))
+	h.out.vb.analyze()
+	ctx := h.ctx
+	f := h.buffers(0, 0)
+	vertices, indices := f.buffers[0], f.buffers[1]
+	rp, _, fb, _ := h.renderPass(f.dev)
+	vkCb := h.commandBuffer(f.dev)
+	h.cmdBeginRenderPass(vkCb, rp, fb)
+	h.cmdBindVertexBuffer(vkCb, 1, vertices, 16)
+	h.cmdBindIndexBuffer(vkCb, indices, 32, VkIndexType_VK_INDEX_TYPE_UINT16)
+	setLineWidth := h.cmdSetLineWidth(vkCb, 2)
+	h.cmdEndRenderPass(vkCb)
+	h.endCommandBuffer(vkCb)
+
+	// The state at the end of the render pass, before it is ended.
+	submitID := api.CmdID(len(h.out.ft.Commands))
+	h.submit(f.q, vkCb)
+
+	state, _ := h.out.vb.boundStates.states.Value(cmdIdx(submitID, 0, 0, 4)).(*BoundPipelineState)
+	if !assert.For(ctx, "Recorded").That(state != nil).Equals(true) {
+		return
+	}
+	assert.For(ctx, "Render pass").That(state.RenderPass).Equals(rp)
+	assert.For(ctx, "Framebuffer").That(state.Framebuffer).Equals(fb)
+	assert.For(ctx, "Subpass").That(state.Subpass).Equals(uint64(0))
+	assert.For(ctx, "Vertex buffers").That(state.VertexBuffers).DeepEquals(
+		map[uint32]BoundBuffer{1: {vertices, 16}})
+	assert.For(ctx, "Index buffer").That(state.IndexBuffer).Equals(BoundBuffer{indices, 32})
+	assert.For(ctx, "Index type").That(state.IndexType).Equals(VkIndexType_VK_INDEX_TYPE_UINT16)
+	lineWidth := h.out.ft.Commands[setLineWidth]
+	assert.For(ctx, "Dynamic states").That(state.DynamicStates).DeepEquals(
+		map[string]api.Cmd{lineWidth.CmdName(): lineWidth})
+	assert.For(ctx, "Pipelines").That(len(state.Pipelines)).Equals(0)
+}
+
+func TestFootprintHarnessResourceUses(t *testing.T) {
+	h := newFootprintHarness(log.Testing(t))
+	h.out.vb.analyze()
+	r := h.out.vb.resourceUses
+	ctx := h.ctx
+	f := h.buffers(0, 0)
+	a, b := f.buffers[0], f.buffers[1]
+	createA, createB := f.creates[0], f.creates[1]
+	bindA, bindB := f.binds[0], f.binds[1]
+	vkCb := h.commandBuffer(f.dev)
+	fill := h.cmdFillBuffer(vkCb, a, 0, 256)
+	copyAB := h.cmdCopyBuffer(vkCb, a, b, 256)
+	fillB := h.cmdFillBuffer(vkCb, b, 0, 256)
+	h.endCommandBuffer(vkCb)
+	submit := h.submit(f.q, vkCb)
+
+	p := &path.Capture{}
+	assert.For(ctx, "Uses of A").That(r.resourceUses(p, uint64(a), 0)).DeepEquals([]*service.ResourceUse{
+		{Command: p.Command(uint64(createA)), Write: true},
+		{Command: p.Command(uint64(bindA)), Read: true},
+		{Command: p.Command(uint64(fill)), Read: true},
+		{Command: p.Command(uint64(copyAB)), Read: true},
+		{Command: p.Command(uint64(submit), 0, 0, 0), Write: true},
+		{Command: p.Command(uint64(submit), 0, 0, 1), Read: true},
+	})
+	assert.For(ctx, "Uses of B").That(r.resourceUses(p, uint64(b), 0)).DeepEquals([]*service.ResourceUse{
+		{Command: p.Command(uint64(createB)), Write: true},
+		{Command: p.Command(uint64(bindB)), Read: true},
+		{Command: p.Command(uint64(copyAB)), Read: true},
+		{Command: p.Command(uint64(fillB)), Read: true},
+		{Command: p.Command(uint64(submit), 0, 0, 1), Write: true},
+		{Command: p.Command(uint64(submit), 0, 0, 2), Write: true},
+	})
+}
+
+func TestFootprintHarnessBarrierAnalysis(t *testing.T) {
+	h := newFootprintHarness(log.Testing(t))
+	h.out.vb.analyze()
+	a := h.out.vb.barriers
+	ctx := h.ctx
+	f := h.buffers(0, 0)
+	src, dst := f.buffers[0], f.buffers[1]
+	vkCb := h.commandBuffer(f.dev)
+	h.cmdFillBuffer(vkCb, src, 0, 256)
+	broad := h.cmdBufferBarrier(vkCb, src,
+		VkPipelineStageFlagBits_VK_PIPELINE_STAGE_ALL_COMMANDS_BIT,
+		VkPipelineStageFlagBits_VK_PIPELINE_STAGE_ALL_COMMANDS_BIT)
+	h.cmdCopyBuffer(vkCb, src, dst, 256)
+	narrow := h.cmdBufferBarrier(vkCb, dst,
+		VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TRANSFER_BIT,
+		VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TRANSFER_BIT)
+	h.cmdFillBuffer(vkCb, dst, 0, 256)
+	h.endCommandBuffer(vkCb)
+	h.submit(f.q, vkCb)
+
+	for _, id := range []api.CmdID{broad, narrow} {
+		b := a.barriers[id]
+		if !assert.For(ctx, "Barrier %v analyzed", id).That(b != nil).Equals(true) {
+			continue
+		}
+		assert.For(ctx, "Barrier %v source stages", id).That(b.src).Equals(transferStage)
+		assert.For(ctx, "Barrier %v destination stages", id).That(b.dst).Equals(transferStage)
+	}
+	found := a.broadBarriers(0)
+	assert.For(ctx, "Broad barriers").That(len(found)).Equals(1)
+	assert.For(ctx, "Broad barrier").That(found[broad] != nil).Equals(true)
+}
+
+func TestNarrowedKeepsUntrackedStages(t *testing.T) {
+	ctx := log.Testing(t)
+	host := VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_HOST_BIT)
+	all := VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_ALL_COMMANDS_BIT)
+	assert.For(ctx, "Narrowed").That(narrowed(all|host, transferStage, true)).Equals(transferStage | host)
+	assert.For(ctx, "Not narrowed").That(narrowed(transferStage|host, transferStage, true)).Equals(VkPipelineStageFlags(0))
+
+	a := newBarrierAnalyzer()
+	a.declare(1, all, all, true)
+	a.declare(2, all, all, false)
+	a.barriers[1].src, a.barriers[1].dst = transferStage, transferStage
+	a.barriers[1].untracked = true
+	assert.For(ctx, "Untracked barriers").That(len(a.broadBarriers(0))).Equals(0)
+}
+
+func TestFootprintHarnessLint(t *testing.T) {
+	h := newFootprintHarness(log.Testing(t))
+	h.out.vb.analyze()
+	a := h.out.vb.lint
+	ctx := h.ctx
+	f := h.buffers(0, VkBufferUsageFlags(VkBufferUsageFlagBits_VK_BUFFER_USAGE_VERTEX_BUFFER_BIT))
+	staging, vertices := f.buffers[0], f.buffers[1]
+	vkCb := h.commandBuffer(f.dev)
+	h.cmdFillBuffer(vkCb, staging, 0, 256)
+	unread := h.cmdCopyBuffer(vkCb, staging, vertices, 256)
+	h.cmdCopyBuffer(vkCb, staging, vertices, 256)
+	h.cmdCopyBuffer(vkCb, vertices, staging, 256)
+	neverRead := h.cmdCopyBuffer(vkCb, staging, vertices, 256)
+	h.endCommandBuffer(vkCb)
+	h.submit(f.q, vkCb)
+
+	found := a.findings(0)
+	assert.For(ctx, "Lint findings").That(len(found)).Equals(2)
+	assert.For(ctx, "Unread upload").That(len(found[unread])).Equals(1)
+	assert.For(ctx, "Never read upload").That(len(found[neverRead])).Equals(1)
+}
+
+func TestFootprintHarnessMemoryTimeline(t *testing.T) {
+	h := newFootprintHarness(log.Testing(t))
+	ctx := h.ctx
+	st := GetState(h.out.s)
+	tl := newMemoryTimeline()
+	dev, _ := h.device()
+	a, allocA := h.allocateMemory(dev, 512)
+	tl.track(st, allocA, h.out.ft.Commands[allocA])
+	b, allocB := h.allocateMemory(dev, 256)
+	tl.track(st, allocB, h.out.ft.Commands[allocB])
+	freeA := h.freeMemory(dev, a)
+	tl.track(st, freeA, h.out.ft.Commands[freeA])
+
+	assert.For(ctx, "Events").That(len(tl.events)).Equals(3)
+	for i, e := range []struct {
+		cmd   api.CmdID
+		mem   VkDeviceMemory
+		size  uint64
+		freed bool
+	}{{allocA, a, 512, false}, {allocB, b, 256, false}, {freeA, a, 512, true}} {
+		assert.For(ctx, "Event %d command", i).That(tl.events[i].Command).Equals(uint64(e.cmd))
+		assert.For(ctx, "Event %d memory", i).That(tl.events[i].Memory).Equals(uint64(e.mem))
+		assert.For(ctx, "Event %d size", i).That(tl.events[i].Size).Equals(e.size)
+		assert.For(ctx, "Event %d freed", i).That(tl.events[i].Freed).Equals(e.freed)
+	}
+	key := memoryHeapKey{dev, 0}
+	peaks := memoryHeapPeaks(tl.events)
+	assert.For(ctx, "Peak").That(peaks[key].size).Equals(uint64(768))
+	assert.For(ctx, "Peak command").That(peaks[key].command).Equals(uint64(allocB))
+	h.assertAccesses("free", cmdIdx(freeA), []string{handleVar(uint64(a))}, nil)
+}
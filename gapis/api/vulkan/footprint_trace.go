@@ -0,0 +1,113 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// rollOutSlice is a submitted command executed on a queue during the roll-out
+// of the queue submissions.
+type rollOutSlice struct {
+	queue VkQueue
+	cmd   api.SubCmdIdx
+}
+
+// rollOutTrace records the order in which the FootprintBuilder rolls out the
+// submitted commands.
+type rollOutTrace struct {
+	slices []rollOutSlice
+}
+
+// record appends the given submitted command to the trace. It is a no-op on
+// a nil trace, so the FootprintBuilder can call it unconditionally.
+func (t *rollOutTrace) record(queue VkQueue, cmd api.SubCmdIdx) {
+	if t == nil {
+		return
+	}
+	t.slices = append(t.slices, rollOutSlice{
+		queue: queue,
+		cmd:   append(api.SubCmdIdx{}, cmd...),
+	})
+}
+
+// chromeTraceEvent is an event in the Chrome tracing JSON format.
+type chromeTraceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   uint64                 `json:"ts"`
+	Dur  uint64                 `json:"dur,omitempty"`
+	Pid  uint64                 `json:"pid"`
+	Tid  uint64                 `json:"tid"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// writeJSON writes the trace to w in the Chrome tracing JSON format, with one
+// track per VkQueue and one slice per submitted command. The roll-out does not
+// carry any timing info, so each slice takes one microsecond and the slices
+// are laid out in the order they were rolled out.
+func (t *rollOutTrace) writeJSON(w io.Writer) error {
+	events := []chromeTraceEvent{}
+	tids := map[VkQueue]uint64{}
+	for i, s := range t.slices {
+		tid, ok := tids[s.queue]
+		if !ok {
+			tid = uint64(len(tids) + 1)
+			tids[s.queue] = tid
+			events = append(events, chromeTraceEvent{
+				Name: "thread_name",
+				Ph:   "M",
+				Tid:  tid,
+				Args: map[string]interface{}{
+					"name": fmt.Sprintf("VkQueue 0x%x", uint64(s.queue)),
+				},
+			})
+		}
+		events = append(events, chromeTraceEvent{
+			Name: fmt.Sprint(s.cmd),
+			Cat:  "submit",
+			Ph:   "X",
+			Ts:   uint64(i),
+			Dur:  1,
+			Tid:  tid,
+			Args: map[string]interface{}{
+				"submit":  s.cmd[0],
+				"command": fmt.Sprint(s.cmd),
+			},
+		})
+	}
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents []chromeTraceEvent `json:"traceEvents"`
+	}{events})
+}
+
+// WriteRollOutTrace writes the queue submission roll-out inferred by the
+// FootprintBuilder for the given capture to w as a Chrome tracing JSON
+// timeline, which can be loaded in chrome://tracing. The roll-out is recorded
+// by the analysis of the capture.
+func WriteRollOutTrace(ctx context.Context, p *path.Capture, w io.Writer) error {
+	a, err := analyzeCapture(ctx, p)
+	if err != nil {
+		return err
+	}
+	return a.rollOut.writeJSON(w)
+}
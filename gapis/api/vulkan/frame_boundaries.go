@@ -0,0 +1,90 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// frameBoundaries infers the frame boundaries from the presentations of the
+// swapchain images tracked by the FootprintBuilder. A frame presents each
+// swapchain at most once, no matter how many swapchains are presented, on
+// which queue, or how many vkQueuePresentKHR calls are used, so a frame ends
+// with the last presentation before a swapchain is presented again.
+type frameBoundaries struct {
+	// The IDs of the last command of each complete frame.
+	ends []api.CmdID
+	// The swapchains presented in the current frame.
+	presented map[VkSwapchainKHR]struct{}
+	// The last presentation in the current frame.
+	last api.CmdID
+}
+
+func newFrameBoundaries() *frameBoundaries {
+	return &frameBoundaries{presented: map[VkSwapchainKHR]struct{}{}}
+}
+
+// present records that the command with the given ID presents an image of
+// the given swapchain. It is a no-op on nil frameBoundaries, so the
+// FootprintBuilder can call it unconditionally.
+func (f *frameBoundaries) present(id api.CmdID, vkSw VkSwapchainKHR) {
+	if f == nil {
+		return
+	}
+	if _, ok := f.presented[vkSw]; ok && f.last != id {
+		f.ends = append(f.ends, f.last)
+		f.presented = map[VkSwapchainKHR]struct{}{}
+	}
+	f.presented[vkSw] = struct{}{}
+	f.last = id
+}
+
+// frameEnds returns the IDs of the last command of each frame, in ascending
+// order. The presentations after the last complete frame are considered as
+// the end of one more frame.
+func (f *frameBoundaries) frameEnds() []api.CmdID {
+	if len(f.presented) == 0 {
+		return f.ends
+	}
+	return append(append([]api.CmdID{}, f.ends...), f.last)
+}
+
+// captureFrameEnds returns the IDs of the last command of each frame of the
+// capture. The presentations in the commands that build the initial state do
+// not end any frame of the capture.
+func (f *frameBoundaries) captureFrameEnds(numInitialCmds int) []api.CmdID {
+	ends := []api.CmdID{}
+	for _, id := range f.frameEnds() {
+		if uint64(id) >= uint64(numInitialCmds) {
+			ends = append(ends, id-api.CmdID(numInitialCmds))
+		}
+	}
+	return ends
+}
+
+// InferFrameBoundaries implements the resolve.FrameBoundaryInferrer
+// interface. It returns the frame boundaries inferred from the presentations
+// of the swapchain images of the given capture, from the analysis of the
+// capture.
+func (API) InferFrameBoundaries(ctx context.Context, p *path.Capture) ([]api.CmdID, error) {
+	a, err := analyzeCapture(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return a.frameEnds, nil
+}
@@ -0,0 +1,241 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/resolve/dependencygraph"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// imageSubresource identifies a subresource of an image.
+type imageSubresource struct {
+	aspect VkImageAspectFlagBits
+	layer  uint32
+	level  uint32
+}
+
+// imageLayoutChange is the layout of an image subresource after a command, and
+// the command which last set it, nil if it is never set.
+type imageLayoutChange struct {
+	after   api.CmdID
+	layout  VkImageLayout
+	lastSet api.SubCmdIdx
+}
+
+// imageLayoutTimeline is the changes of the layouts of the subresources of an
+// image, in the order of the commands, since the image is created.
+type imageLayoutTimeline struct {
+	created api.CmdID
+	changes map[imageSubresource][]imageLayoutChange
+}
+
+// imageLayoutsRecorder records the changes of the layouts of the subresources
+// of the images, while the FootprintBuilder builds the footprint. A change is
+// recorded for each subresource of an image after it is created, and after
+// the commands which write the layout labels of the image. The layouts are
+// taken from the state, and the commands which last set them from the layout
+// labels of the footprint. The command IDs are the ones seen by the
+// FootprintBuilder.
+type imageLayoutsRecorder struct {
+	// The timelines of the images created with each handle.
+	timelines map[VkImage][]*imageLayoutTimeline
+	// The images of the layout labels.
+	images map[dependencygraph.DefUseVariable]VkImage
+	// The images whose layout labels are written by the current command.
+	written map[VkImage]struct{}
+}
+
+func newImageLayoutsRecorder() *imageLayoutsRecorder {
+	return &imageLayoutsRecorder{
+		timelines: map[VkImage][]*imageLayoutTimeline{},
+		images:    map[dependencygraph.DefUseVariable]VkImage{},
+		written:   map[VkImage]struct{}{},
+	}
+}
+
+// track starts the timeline of the newly created image. It is a no-op on a
+// nil recorder.
+func (r *imageLayoutsRecorder) track(vkImg VkImage, img *imageLayoutAndData) {
+	if r == nil {
+		return
+	}
+	r.timelines[vkImg] = append(r.timelines[vkImg], &imageLayoutTimeline{
+		created: api.CmdNoID,
+		changes: map[imageSubresource][]imageLayoutChange{},
+	})
+	for _, l := range img.allLayouts() {
+		r.images[l] = vkImg
+	}
+	r.written[vkImg] = struct{}{}
+}
+
+// access implements the footprintObserver interface. It marks the image of
+// the written layout label.
+func (r *imageLayoutsRecorder) access(bh *dependencygraph.Behavior, write bool,
+	c dependencygraph.DefUseVariable) {
+	if !write {
+		return
+	}
+	if vkImg, ok := r.images[c]; ok {
+		r.written[vkImg] = struct{}{}
+	}
+}
+
+// record records the layouts of the subresources of the images whose layout
+// labels are written by the command id. It must be called after the command
+// is executed. It is a no-op on a nil recorder.
+func (r *imageLayoutsRecorder) record(vb *FootprintBuilder, s *api.GlobalState, id api.CmdID) {
+	if r == nil || len(r.written) == 0 {
+		return
+	}
+	for vkImg := range r.written {
+		imgObj := GetState(s).Images().Get(vkImg)
+		img, ok := vb.images[vkImg]
+		timelines := r.timelines[vkImg]
+		if imgObj.IsNil() || !ok || len(timelines) == 0 {
+			continue
+		}
+		t := timelines[len(timelines)-1]
+		if t.created == api.CmdNoID {
+			t.created = id
+		}
+		for _, a := range img.layouts {
+			aspectObj, ok := imgObj.Aspects().Lookup(a.aspect)
+			if !ok {
+				continue
+			}
+			for layer, levels := range a.layers {
+				layerObj, ok := aspectObj.Layers().Lookup(uint32(layer))
+				if !ok {
+					continue
+				}
+				for level, l := range levels {
+					levelObj, ok := layerObj.Levels().Lookup(uint32(level))
+					if !ok {
+						continue
+					}
+					var lastSet api.SubCmdIdx
+					if b := l.GetDefBehavior(); b != nil {
+						lastSet = b.Owner
+					}
+					key := imageSubresource{a.aspect, uint32(layer), uint32(level)}
+					changes := t.changes[key]
+					if n := len(changes); n > 0 && changes[n-1].layout == levelObj.Layout() &&
+						changes[n-1].lastSet.Equals(lastSet) {
+						continue
+					}
+					t.changes[key] = append(changes, imageLayoutChange{
+						after:   id,
+						layout:  levelObj.Layout(),
+						lastSet: lastSet,
+					})
+				}
+			}
+		}
+	}
+	r.written = map[VkImage]struct{}{}
+}
+
+// layouts returns the layouts of the subresources of the image after the
+// command id seen by the FootprintBuilder, sorted by aspect, layer and level,
+// with the commands of the given capture which last set them. Returns nil if
+// the image is not created by then.
+func (r *imageLayoutsRecorder) layouts(p *path.Capture, numInitialCmds int,
+	vkImg VkImage, id api.CmdID) []*service.ImageSubresourceLayout {
+	var t *imageLayoutTimeline
+	for _, timeline := range r.timelines[vkImg] {
+		if timeline.created != api.CmdNoID && timeline.created <= id {
+			t = timeline
+		}
+	}
+	if t == nil {
+		return nil
+	}
+	// lastSet returns the command which last set the layout, or nil if it
+	// was set by the commands building the initial state.
+	lastSet := func(idx api.SubCmdIdx) *path.Command {
+		if len(idx) == 0 || idx[0] < uint64(numInitialCmds) {
+			return nil
+		}
+		return p.Command(idx[0]-uint64(numInitialCmds), idx[1:]...)
+	}
+	out := []*service.ImageSubresourceLayout{}
+	for key, changes := range t.changes {
+		// The last change after the command.
+		i := sort.Search(len(changes), func(i int) bool { return changes[i].after > id }) - 1
+		if i < 0 {
+			continue
+		}
+		c := changes[i]
+		out = append(out, &service.ImageSubresourceLayout{
+			Aspect:     uint32(key.aspect),
+			Layer:      key.layer,
+			Level:      key.level,
+			Layout:     uint32(c.layout),
+			LayoutName: c.layout.String(),
+			LastSet:    lastSet(c.lastSet),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case a.Aspect != b.Aspect:
+			return a.Aspect < b.Aspect
+		case a.Layer != b.Layer:
+			return a.Layer < b.Layer
+		default:
+			return a.Level < b.Level
+		}
+	})
+	return out
+}
+
+// ResolveImageLayouts implements the resolve.ImageLayoutsResolver interface.
+// It returns the layouts of the subresources of the image after the given
+// command, with the commands which last set them, from the analysis of the
+// capture of the command.
+func (API) ResolveImageLayouts(ctx context.Context, after *path.Command, image uint64) ([]*service.ImageSubresourceLayout, error) {
+	if len(after.Indices) != 1 {
+		return nil, fmt.Errorf("Image layouts after subcommand %v are not supported", after.Indices)
+	}
+	a, err := analyzeCapture(ctx, after.Capture)
+	if err != nil {
+		return nil, err
+	}
+	if after.Indices[0] >= uint64(a.numCmds) {
+		return nil, fmt.Errorf("Command %v is not in the capture", after.Indices)
+	}
+	notAlive := &service.ErrDataUnavailable{
+		Reason: messages.ErrMessage(fmt.Sprintf("Image %v is not alive after command %v", VkImage(image), after.Indices)),
+	}
+	idx := api.SubCmdIdx(after.Indices)
+	l := lifetimeAt(a.lifetimes[handleKey{"VkImage", image}], idx)
+	if l == nil || (l.destroyed != nil && l.destroyed.Equals(idx)) {
+		return nil, notAlive
+	}
+	layouts := a.imageLayouts.layouts(after.Capture, a.numInitialCmds, VkImage(image),
+		api.CmdID(after.Indices[0])+api.CmdID(a.numInitialCmds))
+	if layouts == nil {
+		return nil, notAlive
+	}
+	return layouts, nil
+}
@@ -0,0 +1,327 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/gapid/core/data/dictionary"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// handleMap is a map of the state holding the objects of a handle type.
+type handleMap struct {
+	field string
+	get   func(s *State) interface{}
+}
+
+// contains returns true if the map of the state holds the object of the
+// handle.
+func (m handleMap) contains(s *State, handle uint64) bool {
+	d := dictionary.From(m.get(s))
+	return d.Contains(reflect.ValueOf(handle).Convert(d.KeyTy()).Interface())
+}
+
+// handles returns the handles of the objects held by the map of the state.
+func (m handleMap) handles(s *State) []uint64 {
+	keys := dictionary.From(m.get(s)).Keys()
+	out := make([]uint64, len(keys))
+	for i, k := range keys {
+		out[i] = reflect.ValueOf(k).Uint()
+	}
+	return out
+}
+
+// handleMaps are the state maps of the objects of the handle types that can be
+// followed, by handle type name.
+var handleMaps = map[string][]handleMap{
+	"VkBuffer":       {{"Buffers", func(s *State) interface{} { return s.Buffers() }}},
+	"VkBufferView":   {{"BufferViews", func(s *State) interface{} { return s.BufferViews() }}},
+	"VkDeviceMemory": {{"DeviceMemories", func(s *State) interface{} { return s.DeviceMemories() }}},
+	"VkFramebuffer":  {{"Framebuffers", func(s *State) interface{} { return s.Framebuffers() }}},
+	"VkImage":        {{"Images", func(s *State) interface{} { return s.Images() }}},
+	"VkImageView":    {{"ImageViews", func(s *State) interface{} { return s.ImageViews() }}},
+	"VkPipeline": {
+		{"GraphicsPipelines", func(s *State) interface{} { return s.GraphicsPipelines() }},
+		{"ComputePipelines", func(s *State) interface{} { return s.ComputePipelines() }},
+	},
+	"VkPipelineLayout": {{"PipelineLayouts", func(s *State) interface{} { return s.PipelineLayouts() }}},
+	"VkRenderPass":     {{"RenderPasses", func(s *State) interface{} { return s.RenderPasses() }}},
+	"VkSampler":        {{"Samplers", func(s *State) interface{} { return s.Samplers() }}},
+	"VkShaderModule":   {{"ShaderModules", func(s *State) interface{} { return s.ShaderModules() }}},
+}
+
+// objectCommandPrefixes are the prefixes of the names of the commands that may
+// create or destroy objects without changing the number of objects, e.g. by
+// destroying an object and creating another one.
+var objectCommandPrefixes = []string{"vkCreate", "vkDestroy", "vkAllocate", "vkFree", "vkGetSwapchainImages"}
+
+// mayReplaceObjects returns true if the command may create and destroy
+// objects of the same handle type.
+func mayReplaceObjects(cmd api.Cmd) bool {
+	for _, prefix := range objectCommandPrefixes {
+		if strings.HasPrefix(cmd.CmdName(), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleLifetime is the span of commands during which a handle refers to the
+// same object. The commands are nil if the object is created before the
+// capture starts, or is never destroyed.
+type handleLifetime struct {
+	created   api.SubCmdIdx
+	destroyed api.SubCmdIdx
+}
+
+// handleKey identifies a handle of a handle type.
+type handleKey struct {
+	ty     string
+	handle uint64
+}
+
+// handleLifetimeRecorder records the lifetimes of the objects referred by all
+// the handles that can be followed, while the FootprintBuilder builds the
+// footprint. The creation of an object is attributed to the behavior defining
+// the handle.
+type handleLifetimeRecorder struct {
+	// The handles alive after the last recorded command, and their number,
+	// by handle type name.
+	alive  map[string]map[uint64]struct{}
+	counts map[string]int
+	// The lifetimes of the handles, in the order of the commands.
+	lifetimes map[handleKey][]handleLifetime
+}
+
+func newHandleLifetimeRecorder() *handleLifetimeRecorder {
+	return &handleLifetimeRecorder{
+		alive:     map[string]map[uint64]struct{}{},
+		counts:    map[string]int{},
+		lifetimes: map[handleKey][]handleLifetime{},
+	}
+}
+
+// record updates the lifetimes with the state after the command id. The
+// handles of a type are only compared with the state if the number of
+// objects changed, or if the command may replace objects. It is a no-op on a
+// nil recorder.
+func (r *handleLifetimeRecorder) record(vb *FootprintBuilder, s *api.GlobalState, id api.CmdID, cmd api.Cmd) {
+	if r == nil {
+		return
+	}
+	st := GetState(s)
+	replace := mayReplaceObjects(cmd)
+	for ty, maps := range handleMaps {
+		count := 0
+		for _, m := range maps {
+			count += dictionary.From(m.get(st)).Len()
+		}
+		alive, ok := r.alive[ty]
+		if ok && !replace && count == r.counts[ty] {
+			continue
+		}
+		if !ok {
+			alive = map[uint64]struct{}{}
+			r.alive[ty] = alive
+		}
+		r.counts[ty] = count
+		handles := map[uint64]struct{}{}
+		for _, m := range maps {
+			for _, h := range m.handles(st) {
+				handles[h] = struct{}{}
+			}
+		}
+		for h := range handles {
+			if _, ok := alive[h]; ok {
+				continue
+			}
+			created := api.SubCmdIdx{uint64(id)}
+			if vh, ok := vb.handles[h]; ok && vh.b != nil && vh.b.Owner[0] == uint64(id) {
+				created = vh.b.Owner
+			}
+			key := handleKey{ty, h}
+			r.lifetimes[key] = append(r.lifetimes[key], handleLifetime{created: created})
+			alive[h] = struct{}{}
+		}
+		for h := range alive {
+			if _, ok := handles[h]; !ok {
+				l := r.lifetimes[handleKey{ty, h}]
+				l[len(l)-1].destroyed = api.SubCmdIdx{uint64(id)}
+				delete(alive, h)
+			}
+		}
+	}
+}
+
+// handleLifetimes returns the recorded lifetimes of each handle, with the
+// indices of the capture commands. The lifetimes ending in the commands that
+// build the initial state are dropped.
+func (r *handleLifetimeRecorder) handleLifetimes(numInitialCmds int) map[handleKey][]handleLifetime {
+	rebase := func(idx api.SubCmdIdx) api.SubCmdIdx {
+		if idx == nil || idx[0] < uint64(numInitialCmds) {
+			return nil
+		}
+		return append(api.SubCmdIdx{idx[0] - uint64(numInitialCmds)}, idx[1:]...)
+	}
+	out := map[handleKey][]handleLifetime{}
+	for key, lifetimes := range r.lifetimes {
+		for _, l := range lifetimes {
+			if l.destroyed != nil && l.destroyed[0] < uint64(numInitialCmds) {
+				continue
+			}
+			out[key] = append(out[key], handleLifetime{rebase(l.created), rebase(l.destroyed)})
+		}
+	}
+	return out
+}
+
+// lifetimeAt returns the lifetime including the command idx, or nil if there
+// is none.
+func lifetimeAt(lifetimes []handleLifetime, idx api.SubCmdIdx) *handleLifetime {
+	for i, l := range lifetimes {
+		if (l.created == nil || !idx.LessThan(l.created)) && (l.destroyed == nil || !l.destroyed.LessThan(idx)) {
+			return &lifetimes[i]
+		}
+	}
+	return nil
+}
+
+// linkHandle returns the link of the handle of the given type used by the
+// command at p, where key is the handle as a key of the state maps. A handle
+// used by the command creating its object links to the command destroying it,
+// and a handle used by the command destroying its object links to the command
+// creating it. Otherwise, or if there is no such command, the handle links to
+// its object in the state after the command.
+func linkHandle(ctx context.Context, p path.Node, r *path.ResolveConfig,
+	ty string, handle uint64, key interface{}) (path.Node, error) {
+	cmdPath := path.FindCommand(p)
+	if cmdPath == nil || handle == 0 {
+		return nil, nil
+	}
+	if _, ok := handleMaps[ty]; !ok {
+		return nil, fmt.Errorf("Handles of type %v cannot be followed", ty)
+	}
+	a, err := analyzeCapture(ctx, cmdPath.Capture)
+	if err != nil {
+		return nil, err
+	}
+	idx := api.SubCmdIdx(cmdPath.Indices)
+	lifetimes := a.lifetimes[handleKey{ty, handle}]
+	if l := lifetimeAt(lifetimes, idx); l != nil {
+		switch {
+		case l.created != nil && l.created.Equals(idx) && l.destroyed != nil:
+			return cmdPath.Capture.Command(l.destroyed[0], l.destroyed[1:]...), nil
+		case l.destroyed != nil && l.destroyed.Equals(idx):
+			if l.created == nil {
+				return nil, nil
+			}
+			return cmdPath.Capture.Command(l.created[0], l.created[1:]...), nil
+		}
+	}
+
+	stateObj, err := resolve.State(ctx, cmdPath.StateAfter(), r)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range handleMaps[ty] {
+		if m.contains(stateObj.(*State), handle) {
+			return cmdPath.StateAfter().Field(m.field).MapIndex(key), nil
+		}
+	}
+	return nil, nil
+}
+
+// Link returns the link to the creation or destruction command of the buffer,
+// or to the buffer object in the state.
+// If nil, nil is returned then the path cannot be followed.
+func (o VkBuffer) Link(ctx context.Context, p path.Node, r *path.ResolveConfig) (path.Node, error) {
+	return linkHandle(ctx, p, r, "VkBuffer", uint64(o), o)
+}
+
+// Link returns the link to the creation or destruction command of the buffer
+// view, or to the buffer view object in the state.
+// If nil, nil is returned then the path cannot be followed.
+func (o VkBufferView) Link(ctx context.Context, p path.Node, r *path.ResolveConfig) (path.Node, error) {
+	return linkHandle(ctx, p, r, "VkBufferView", uint64(o), o)
+}
+
+// Link returns the link to the allocation or free command of the device
+// memory, or to the device memory object in the state.
+// If nil, nil is returned then the path cannot be followed.
+func (o VkDeviceMemory) Link(ctx context.Context, p path.Node, r *path.ResolveConfig) (path.Node, error) {
+	return linkHandle(ctx, p, r, "VkDeviceMemory", uint64(o), o)
+}
+
+// Link returns the link to the creation or destruction command of the
+// framebuffer, or to the framebuffer object in the state.
+// If nil, nil is returned then the path cannot be followed.
+func (o VkFramebuffer) Link(ctx context.Context, p path.Node, r *path.ResolveConfig) (path.Node, error) {
+	return linkHandle(ctx, p, r, "VkFramebuffer", uint64(o), o)
+}
+
+// Link returns the link to the creation or destruction command of the image,
+// or to the image object in the state.
+// If nil, nil is returned then the path cannot be followed.
+func (o VkImage) Link(ctx context.Context, p path.Node, r *path.ResolveConfig) (path.Node, error) {
+	return linkHandle(ctx, p, r, "VkImage", uint64(o), o)
+}
+
+// Link returns the link to the creation or destruction command of the image
+// view, or to the image view object in the state.
+// If nil, nil is returned then the path cannot be followed.
+func (o VkImageView) Link(ctx context.Context, p path.Node, r *path.ResolveConfig) (path.Node, error) {
+	return linkHandle(ctx, p, r, "VkImageView", uint64(o), o)
+}
+
+// Link returns the link to the creation or destruction command of the
+// pipeline, or to the pipeline object in the state.
+// If nil, nil is returned then the path cannot be followed.
+func (o VkPipeline) Link(ctx context.Context, p path.Node, r *path.ResolveConfig) (path.Node, error) {
+	return linkHandle(ctx, p, r, "VkPipeline", uint64(o), o)
+}
+
+// Link returns the link to the creation or destruction command of the
+// pipeline layout, or to the pipeline layout object in the state.
+// If nil, nil is returned then the path cannot be followed.
+func (o VkPipelineLayout) Link(ctx context.Context, p path.Node, r *path.ResolveConfig) (path.Node, error) {
+	return linkHandle(ctx, p, r, "VkPipelineLayout", uint64(o), o)
+}
+
+// Link returns the link to the creation or destruction command of the render
+// pass, or to the render pass object in the state.
+// If nil, nil is returned then the path cannot be followed.
+func (o VkRenderPass) Link(ctx context.Context, p path.Node, r *path.ResolveConfig) (path.Node, error) {
+	return linkHandle(ctx, p, r, "VkRenderPass", uint64(o), o)
+}
+
+// Link returns the link to the creation or destruction command of the
+// sampler, or to the sampler object in the state.
+// If nil, nil is returned then the path cannot be followed.
+func (o VkSampler) Link(ctx context.Context, p path.Node, r *path.ResolveConfig) (path.Node, error) {
+	return linkHandle(ctx, p, r, "VkSampler", uint64(o), o)
+}
+
+// Link returns the link to the creation or destruction command of the shader
+// module, or to the shader module object in the state.
+// If nil, nil is returned then the path cannot be followed.
+func (o VkShaderModule) Link(ctx context.Context, p path.Node, r *path.ResolveConfig) (path.Node, error) {
+	return linkHandle(ctx, p, r, "VkShaderModule", uint64(o), o)
+}
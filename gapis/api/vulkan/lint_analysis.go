@@ -0,0 +1,395 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/resolve/dependencygraph"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/stringtable"
+)
+
+// The buffer usages that only allow the transfers. The buffers uploaded to
+// with such usages are staging buffers, which are not linted.
+const transferBufferUsages = VkBufferUsageFlags(
+	VkBufferUsageFlagBits_VK_BUFFER_USAGE_TRANSFER_SRC_BIT |
+		VkBufferUsageFlagBits_VK_BUFFER_USAGE_TRANSFER_DST_BIT)
+
+type lintRule int
+
+const (
+	// An image layout transition followed by another transition of the same
+	// subresources, before any access to the image data.
+	lintRedundantTransition lintRule = iota
+	// An upload to a buffer overwritten before being read.
+	lintUnreadUpload
+	// A render pass attachment stored, then overwritten before being read.
+	lintUnneededStore
+	// A descriptor set bound to a set number that is already bound to a
+	// descriptor set with identical contents.
+	lintRedundantBind
+)
+
+// lintKey identifies what a lint rule is applied to: the command that records
+// it, and the handle and index of the object in the command.
+type lintKey struct {
+	id     api.CmdID
+	rule   lintRule
+	handle uint64
+	index  uint32
+}
+
+// lintResult is the outcome of a lint rule over all the submissions of the
+// command. The command is flagged only if the rule matched every time.
+type lintResult struct {
+	matched, unmatched bool
+}
+
+// lintPending is a write of some variables, by one run of a submitted
+// command, that is not yet known to be used.
+type lintPending struct {
+	key lintKey
+	// The run of the command that wrote the variables.
+	run int
+	// The number of variables not yet overwritten.
+	left int
+	used bool
+}
+
+// lintAnalyzer applies the lint rules to the data flow of the submitted
+// commands, while the FootprintBuilder rolls them out.
+type lintAnalyzer struct {
+	results map[lintKey]*lintResult
+	// The images and buffers that own the data variables.
+	images  map[dependencygraph.DefUseVariable]VkImage
+	buffers map[dependencygraph.DefUseVariable]VkBuffer
+	// The buffers linted for unread uploads, by the IDs of the commands that
+	// upload to them.
+	uploadCmds map[api.CmdID]VkBuffer
+	// The pending uploads and stores, by the data variables they wrote.
+	pending map[dependencygraph.DefUseVariable]*lintPending
+	// The pending layout transitions of each image, by the layout variables
+	// they wrote.
+	transitions map[VkImage]map[dependencygraph.DefUseVariable]*lintPending
+	// The running command, the buffer it uploads to, and whether it is a
+	// barrier, whose accesses are not uses of the data.
+	run      int
+	id       api.CmdID
+	upload   VkBuffer
+	uploaded *lintPending
+	barrier  bool
+}
+
+func newLintAnalyzer() *lintAnalyzer {
+	return &lintAnalyzer{
+		results:     map[lintKey]*lintResult{},
+		images:      map[dependencygraph.DefUseVariable]VkImage{},
+		buffers:     map[dependencygraph.DefUseVariable]VkBuffer{},
+		uploadCmds:  map[api.CmdID]VkBuffer{},
+		pending:     map[dependencygraph.DefUseVariable]*lintPending{},
+		transitions: map[VkImage]map[dependencygraph.DefUseVariable]*lintPending{},
+		id:          api.CmdNoID,
+	}
+}
+
+func (a *lintAnalyzer) result(key lintKey) *lintResult {
+	r, ok := a.results[key]
+	if !ok {
+		r = &lintResult{}
+		a.results[key] = r
+	}
+	return r
+}
+
+// overwritten drops one variable of the pending write, and matches the rule if
+// all of them are overwritten unused.
+func (a *lintAnalyzer) overwritten(p *lintPending) {
+	p.left--
+	if p.left == 0 && !p.used {
+		a.result(p.key).matched = true
+	}
+}
+
+func (a *lintAnalyzer) use(p *lintPending) {
+	if !p.used {
+		p.used = true
+		a.result(p.key).unmatched = true
+	}
+}
+
+// add sets the pending write as the last one of the given variables, unless
+// they are written by another write of the same run.
+func (a *lintAnalyzer) add(pending map[dependencygraph.DefUseVariable]*lintPending,
+	p *lintPending, cs ...dependencygraph.DefUseVariable) {
+	for _, c := range cs {
+		q := pending[c]
+		if q == p || (q != nil && q.run == p.run) {
+			continue
+		}
+		if q != nil {
+			a.overwritten(q)
+		}
+		pending[c] = p
+		p.left++
+	}
+}
+
+// tagImage records the given data variables as owned by the image. It is a
+// no-op on a nil analyzer.
+func (a *lintAnalyzer) tagImage(vkImg VkImage, cs ...dependencygraph.DefUseVariable) {
+	if a == nil {
+		return
+	}
+	for _, c := range cs {
+		a.images[c] = vkImg
+	}
+}
+
+// tagBuffer records the given data variables as owned by the buffer. It is a
+// no-op on a nil analyzer.
+func (a *lintAnalyzer) tagBuffer(vkBuf VkBuffer, cs ...dependencygraph.DefUseVariable) {
+	if a == nil {
+		return
+	}
+	for _, c := range cs {
+		a.buffers[c] = vkBuf
+	}
+}
+
+// recordUpload records the command with the given ID as an upload to the
+// given buffer, if the buffer is used for more than the transfers. It is a
+// no-op on a nil analyzer.
+func (a *lintAnalyzer) recordUpload(id api.CmdID, vkBuf VkBuffer, buf BufferObjectʳ) {
+	if a == nil || buf.IsNil() {
+		return
+	}
+	if buf.Info().Usage()&^transferBufferUsages != 0 {
+		a.uploadCmds[id] = vkBuf
+	}
+}
+
+// begin sets the given submitted command as the running one. It is a no-op on
+// a nil analyzer.
+func (a *lintAnalyzer) begin(ft *dependencygraph.Footprint, sc *submittedCommand) {
+	if a == nil {
+		return
+	}
+	a.end()
+	if sc.cmd == nil || sc.cmd.b == nil || len(sc.cmd.b.Owner) == 0 ||
+		sc.cmd.b.Owner[0] >= uint64(len(ft.Commands)) {
+		return
+	}
+	a.id = api.CmdID(sc.cmd.b.Owner[0])
+	a.upload = a.uploadCmds[a.id]
+	switch ft.Commands[a.id].(type) {
+	case *VkCmdPipelineBarrier, *VkCmdPipelineBarrier2KHR, *VkCmdWaitEvents,
+		*VkCmdWaitEvents2KHR, *VkCmdSetEvent2KHR:
+		a.barrier = true
+	}
+}
+
+// end clears the running command. The accesses until the next command are
+// done by a new run. It is a no-op on a nil analyzer.
+func (a *lintAnalyzer) end() {
+	if a == nil {
+		return
+	}
+	a.run++
+	a.id, a.upload, a.uploaded, a.barrier = api.CmdNoID, 0, nil, false
+}
+
+// access implements the footprintObserver interface. It records the read or
+// write of the variable by the running command.
+func (a *lintAnalyzer) access(bh *dependencygraph.Behavior, write bool,
+	c dependencygraph.DefUseVariable) {
+	if a.barrier {
+		return
+	}
+	if vkImg, ok := a.images[c]; ok {
+		for _, p := range a.transitions[vkImg] {
+			a.use(p)
+		}
+		delete(a.transitions, vkImg)
+	}
+	if p := a.pending[c]; p != nil && p.run != a.run {
+		delete(a.pending, c)
+		if write {
+			a.overwritten(p)
+		} else {
+			a.use(p)
+		}
+	}
+	if write && a.upload != 0 && a.buffers[c] == a.upload {
+		if a.uploaded == nil {
+			a.uploaded = &lintPending{
+				key: lintKey{a.id, lintUnreadUpload, uint64(a.upload), 0},
+				run: a.run,
+			}
+		}
+		a.add(a.pending, a.uploaded, c)
+	}
+}
+
+// transition records the layout transition of the subresources of the image
+// with the given layout variables, by the running command. It is a no-op on a
+// nil analyzer.
+func (a *lintAnalyzer) transition(vkImg VkImage, layouts ...dependencygraph.DefUseVariable) {
+	if a == nil || a.id == api.CmdNoID {
+		return
+	}
+	pending, ok := a.transitions[vkImg]
+	if !ok {
+		pending = map[dependencygraph.DefUseVariable]*lintPending{}
+		a.transitions[vkImg] = pending
+	}
+	p := &lintPending{key: lintKey{a.id, lintRedundantTransition, uint64(vkImg), 0}, run: a.run}
+	a.add(pending, p, layouts...)
+}
+
+// stored records the store operation of the attachment of the render pass
+// with the given data variables, by the running command. It is a no-op on a
+// nil analyzer.
+func (a *lintAnalyzer) stored(rp VkRenderPass, attachment uint32, data ...dependencygraph.DefUseVariable) {
+	if a == nil || a.id == api.CmdNoID {
+		return
+	}
+	p := &lintPending{key: lintKey{a.id, lintUnneededStore, uint64(rp), attachment}, run: a.run}
+	a.add(a.pending, p, data...)
+}
+
+// bindDescriptorSet records the binding of the descriptor set to the set
+// number, by the running command, given the descriptor set previously bound
+// to it. The descriptor sets are compared by their contents, so binding
+// another descriptor set with the same descriptors is also redundant. It is a
+// no-op on a nil analyzer.
+func (a *lintAnalyzer) bindDescriptorSet(set uint32, prev, bound *boundDescriptorSet) {
+	if a == nil || a.id == api.CmdNoID {
+		return
+	}
+	r := a.result(lintKey{a.id, lintRedundantBind, uint64(bound.vkSet), set})
+	if prev == nil || prev.layout != bound.layout ||
+		!sameDescriptors(prev.descriptorSet, bound.descriptorSet) ||
+		len(prev.dynamicOffsets) != len(bound.dynamicOffsets) {
+		r.unmatched = true
+		return
+	}
+	for i, o := range prev.dynamicOffsets {
+		if o != bound.dynamicOffsets[i] {
+			r.unmatched = true
+			return
+		}
+	}
+	r.matched = true
+}
+
+// sameDescriptors returns true if the two descriptor sets hold the same
+// descriptors.
+func sameDescriptors(x, y *descriptorSet) bool {
+	if x == y {
+		return true
+	}
+	if x == nil || y == nil || len(x.descriptorCounts) != len(y.descriptorCounts) {
+		return false
+	}
+	for bi, count := range x.descriptorCounts {
+		if c, ok := y.descriptorCounts[bi]; !ok || c != count {
+			return false
+		}
+		for di := uint64(0); di < count; di++ {
+			dx, _ := x.descriptors.Value([]uint64{bi, di}).(*descriptor)
+			dy, _ := y.descriptors.Value([]uint64{bi, di}).(*descriptor)
+			if dx == dy {
+				continue
+			}
+			if dx == nil || dy == nil || dx.ty != dy.ty || dx.view != dy.view ||
+				dx.img != dy.img || dx.sampler != dy.sampler || dx.buf != dy.buf ||
+				dx.bufOffset != dy.bufOffset || dx.bufRng != dy.bufRng {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// flush matches the rules of the uploads still pending at the end of the
+// capture, as their data is never read.
+func (a *lintAnalyzer) flush() {
+	for _, p := range a.pending {
+		if !p.used && p.key.rule == lintUnreadUpload {
+			a.result(p.key).matched = true
+		}
+	}
+	a.pending = map[dependencygraph.DefUseVariable]*lintPending{}
+}
+
+// findings returns the messages of the lint rules matched by every
+// submission of the commands. The uploads still pending at the end of the
+// capture are flagged, as they are never read, while the other pending writes
+// may be read by the presentation. The commands that build the initial state
+// are dropped.
+func (a *lintAnalyzer) findings(numInitialCmds int) map[api.CmdID][]*stringtable.Msg {
+	a.flush()
+	found := []lintKey{}
+	for key, r := range a.results {
+		if r.matched && !r.unmatched && key.id >= api.CmdID(numInitialCmds) {
+			found = append(found, key)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		x, y := found[i], found[j]
+		switch {
+		case x.id != y.id:
+			return x.id < y.id
+		case x.rule != y.rule:
+			return x.rule < y.rule
+		case x.handle != y.handle:
+			return x.handle < y.handle
+		}
+		return x.index < y.index
+	})
+
+	out := map[api.CmdID][]*stringtable.Msg{}
+	for _, key := range found {
+		var msg *stringtable.Msg
+		switch key.rule {
+		case lintRedundantTransition:
+			msg = messages.WarnRedundantLayoutTransition(key.handle)
+		case lintUnreadUpload:
+			msg = messages.WarnUnreadBufferUpload(key.handle)
+		case lintUnneededStore:
+			msg = messages.WarnUnneededStoreOp(key.index, key.handle)
+		case lintRedundantBind:
+			msg = messages.WarnRedundantDescriptorSetBind(key.handle, key.index)
+		}
+		id := key.id - api.CmdID(numInitialCmds)
+		out[id] = append(out[id], msg)
+	}
+	return out
+}
+
+// Lint implements the resolve.Linter interface. It returns the messages of
+// the lint rules matched by the commands of the given capture, from the
+// analysis of the capture.
+func (API) Lint(ctx context.Context, p *path.Capture) (map[api.CmdID][]*stringtable.Msg, error) {
+	a, err := analyzeCapture(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return a.lint, nil
+}
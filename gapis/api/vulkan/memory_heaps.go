@@ -0,0 +1,264 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// memoryTimeline records the device memories allocated and freed by the
+// commands of a capture, with the heaps they are allocated from.
+type memoryTimeline struct {
+	events []*service.MemoryEvent
+	// The allocation events and the objects of the live device memories, and
+	// their number after the last tracked command.
+	alive   map[VkDeviceMemory]*service.MemoryEvent
+	objects map[VkDeviceMemory]DeviceMemoryObjectʳ
+	count   int
+}
+
+func newMemoryTimeline() *memoryTimeline {
+	return &memoryTimeline{
+		alive:   map[VkDeviceMemory]*service.MemoryEvent{},
+		objects: map[VkDeviceMemory]DeviceMemoryObjectʳ{},
+	}
+}
+
+// memoryHeapKey identifies a memory heap of a device.
+type memoryHeapKey struct {
+	device VkDevice
+	heap   uint32
+}
+
+// memoryHeapPeak is the highest usage of a memory heap, and the command after
+// which it is first reached.
+type memoryHeapPeak struct {
+	size    uint64
+	command uint64
+}
+
+// track records the device memories allocated and freed by the command id,
+// or by the initial state if cmd is nil. The device memories are only
+// compared with the state if their number changed, or if the command may
+// allocate and free memories.
+func (t *memoryTimeline) track(st *State, id api.CmdID, cmd api.Cmd) {
+	memories := st.DeviceMemories()
+	if cmd != nil && !mayReplaceObjects(cmd) && memories.Len() == t.count {
+		return
+	}
+	t.count = memories.Len()
+	initial := cmd == nil
+	command := uint64(0)
+	if !initial {
+		command = uint64(id)
+	}
+
+	// The handles reused by other allocations are freed first.
+	freed := []VkDeviceMemory{}
+	for vkMem, obj := range t.objects {
+		if mem, ok := memories.Lookup(vkMem); !ok || mem != obj {
+			freed = append(freed, vkMem)
+		}
+	}
+	sort.Slice(freed, func(i, j int) bool { return freed[i] < freed[j] })
+	for _, vkMem := range freed {
+		a := t.alive[vkMem]
+		t.events = append(t.events, &service.MemoryEvent{
+			Command: command,
+			Initial: initial,
+			Device:  a.Device,
+			Heap:    a.Heap,
+			Memory:  a.Memory,
+			Size:    a.Size,
+			Freed:   true,
+		})
+		delete(t.alive, vkMem)
+		delete(t.objects, vkMem)
+	}
+
+	for _, vkMem := range memories.Keys() {
+		if _, ok := t.alive[vkMem]; ok {
+			continue
+		}
+		mem := memories.Get(vkMem)
+		e := &service.MemoryEvent{
+			Command: command,
+			Initial: initial,
+			Device:  uint64(mem.Device()),
+			Memory:  uint64(vkMem),
+			Size:    uint64(mem.AllocationSize()),
+		}
+		if dev := st.Devices().Get(mem.Device()); !dev.IsNil() {
+			phyDev := st.PhysicalDevices().Get(dev.PhysicalDevice())
+			if !phyDev.IsNil() {
+				props := phyDev.MemoryProperties()
+				if int(mem.MemoryTypeIndex()) < int(props.MemoryTypeCount()) {
+					e.Heap = props.MemoryTypes().Get(int(mem.MemoryTypeIndex())).HeapIndex()
+				}
+			}
+		}
+		t.alive[vkMem] = e
+		t.objects[vkMem] = mem
+		t.events = append(t.events, e)
+	}
+}
+
+// memoryHeapPeaks returns the highest usage of each memory heap reached by
+// the events of the timeline.
+func memoryHeapPeaks(events []*service.MemoryEvent) map[memoryHeapKey]memoryHeapPeak {
+	usage := map[memoryHeapKey]uint64{}
+	peaks := map[memoryHeapKey]memoryHeapPeak{}
+	for _, e := range events {
+		key := memoryHeapKey{VkDevice(e.Device), e.Heap}
+		if e.Freed {
+			usage[key] -= e.Size
+			continue
+		}
+		usage[key] += e.Size
+		if usage[key] > peaks[key].size {
+			peaks[key] = memoryHeapPeak{usage[key], e.Command}
+		}
+	}
+	return peaks
+}
+
+// Resolve implements the database.Resolver interface. It mutates the
+// commands of the capture once, and returns the timeline of the device memory
+// allocations and frees of the capture.
+func (r *MemoryTimelineResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	ctx = capture.Put(ctx, r.Capture)
+	c, err := capture.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, err := capture.NewState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t := newMemoryTimeline()
+	t.track(GetState(s), api.CmdNoID, nil)
+	err = api.ForeachCmd(ctx, c.Commands, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
+		if err := cmd.Mutate(ctx, id, s, nil, nil); err != nil {
+			log.W(ctx, "Command %v %v: %v", id, cmd, err)
+		}
+		t.track(GetState(s), id, cmd)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t.events, nil
+}
+
+// ResolveMemoryHeaps implements the resolve.MemoryHeapsResolver interface.
+// It adds the memory heaps of the devices alive after the given command, with
+// the allocations of the memory breakdown of the state grouped by their
+// memory types, and the timeline of the allocations up to the command, from
+// the timeline of the whole capture.
+func (API) ResolveMemoryHeaps(ctx context.Context, after *path.Command, out *service.MemoryHeaps) error {
+	if len(after.Indices) != 1 {
+		return fmt.Errorf("Memory heaps after subcommand %v are not supported", after.Indices)
+	}
+	obj, err := database.Build(ctx, &MemoryTimelineResolvable{Capture: after.Capture})
+	if err != nil {
+		return err
+	}
+	timeline := []*service.MemoryEvent{}
+	for _, e := range obj.([]*service.MemoryEvent) {
+		if !e.Initial && e.Command > after.Indices[0] {
+			break
+		}
+		timeline = append(timeline, e)
+	}
+	peaks := memoryHeapPeaks(timeline)
+
+	s, err := resolve.GlobalState(ctx, after.GlobalStateAfter(), nil)
+	if err != nil {
+		return err
+	}
+	breakdown, err := API{}.MemoryBreakdown(s)
+	if err != nil {
+		return err
+	}
+	st := GetState(s)
+	heaps := []*service.MemoryHeap{}
+	types := map[VkDevice][]*service.MemoryHeapType{}
+	for _, vkDev := range st.Devices().Keys() {
+		phyDev := st.PhysicalDevices().Get(st.Devices().Get(vkDev).PhysicalDevice())
+		if phyDev.IsNil() {
+			continue
+		}
+		props := phyDev.MemoryProperties()
+		devHeaps := make([]*service.MemoryHeap, props.MemoryHeapCount())
+		for i := range devHeaps {
+			heap := props.MemoryHeaps().Get(i)
+			devHeaps[i] = &service.MemoryHeap{
+				Device: uint64(vkDev),
+				Index:  uint32(i),
+				Size:   uint64(heap.Size()),
+				Flags:  uint32(heap.Flags()),
+				Types:  []*service.MemoryHeapType{},
+			}
+			if peak, ok := peaks[memoryHeapKey{vkDev, uint32(i)}]; ok {
+				devHeaps[i].Peak = peak.size
+				devHeaps[i].PeakCommand = peak.command
+			}
+		}
+		types[vkDev] = make([]*service.MemoryHeapType, props.MemoryTypeCount())
+		for i := range types[vkDev] {
+			typ := props.MemoryTypes().Get(i)
+			types[vkDev][i] = &service.MemoryHeapType{
+				Index:       uint32(i),
+				Flags:       uint32(typ.PropertyFlags()),
+				Allocations: []*api.MemoryAllocation{},
+			}
+			if h := int(typ.HeapIndex()); h < len(devHeaps) {
+				devHeaps[h].Types = append(devHeaps[h].Types, types[vkDev][i])
+			}
+		}
+		heaps = append(heaps, devHeaps...)
+	}
+
+	allocs := breakdown.Allocations
+	sort.Slice(allocs, func(i, j int) bool { return allocs[i].Handle < allocs[j].Handle })
+	for _, alloc := range allocs {
+		devTypes := types[VkDevice(alloc.Device)]
+		if int(alloc.MemoryType) >= len(devTypes) {
+			continue
+		}
+		typ := devTypes[alloc.MemoryType]
+		sort.SliceStable(alloc.Bindings, func(i, j int) bool { return alloc.Bindings[i].Offset < alloc.Bindings[j].Offset })
+		typ.Allocations = append(typ.Allocations, alloc)
+		typ.Allocated += alloc.Size
+	}
+	for _, heap := range heaps {
+		for _, typ := range heap.Types {
+			heap.Allocated += typ.Allocated
+		}
+	}
+	out.Heaps = append(out.Heaps, heaps...)
+	out.Timeline = append(out.Timeline, timeline...)
+	return nil
+}
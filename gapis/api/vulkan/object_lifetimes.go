@@ -0,0 +1,182 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/google/gapid/core/data/dictionary"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// objectMap is a map of the state holding the objects of a handle type.
+type objectMap struct {
+	ty  string
+	get func(s *State) interface{}
+	// implicit returns true if the object is not destroyed by the application,
+	// as it is destroyed with its parent object or never destroyed. It is nil
+	// if all the objects must be destroyed by the application.
+	implicit func(o interface{}) bool
+}
+
+// allImplicit is the implicit function of the handle types whose objects are
+// never destroyed by the application.
+func allImplicit(interface{}) bool { return true }
+
+// objectMaps are the state maps of the objects of all the handle types.
+var objectMaps = []objectMap{
+	{"VkInstance", func(s *State) interface{} { return s.Instances() }, nil},
+	{"VkPhysicalDevice", func(s *State) interface{} { return s.PhysicalDevices() }, allImplicit},
+	{"VkDevice", func(s *State) interface{} { return s.Devices() }, nil},
+	{"VkQueue", func(s *State) interface{} { return s.Queues() }, allImplicit},
+	{"VkCommandBuffer", func(s *State) interface{} { return s.CommandBuffers() }, allImplicit},
+	{"VkDeviceMemory", func(s *State) interface{} { return s.DeviceMemories() }, nil},
+	{"VkBuffer", func(s *State) interface{} { return s.Buffers() }, nil},
+	{"VkBufferView", func(s *State) interface{} { return s.BufferViews() }, nil},
+	{"VkImage", func(s *State) interface{} { return s.Images() }, func(o interface{}) bool {
+		return o.(ImageObjectʳ).IsSwapchainImage()
+	}},
+	{"VkImageView", func(s *State) interface{} { return s.ImageViews() }, nil},
+	{"VkShaderModule", func(s *State) interface{} { return s.ShaderModules() }, nil},
+	{"VkPipeline", func(s *State) interface{} { return s.GraphicsPipelines() }, nil},
+	{"VkPipeline", func(s *State) interface{} { return s.ComputePipelines() }, nil},
+	{"VkPipelineLayout", func(s *State) interface{} { return s.PipelineLayouts() }, nil},
+	{"VkSampler", func(s *State) interface{} { return s.Samplers() }, nil},
+	{"VkDescriptorSet", func(s *State) interface{} { return s.DescriptorSets() }, allImplicit},
+	{"VkDescriptorSetLayout", func(s *State) interface{} { return s.DescriptorSetLayouts() }, nil},
+	{"VkDescriptorPool", func(s *State) interface{} { return s.DescriptorPools() }, nil},
+	{"VkFence", func(s *State) interface{} { return s.Fences() }, nil},
+	{"VkSemaphore", func(s *State) interface{} { return s.Semaphores() }, nil},
+	{"VkEvent", func(s *State) interface{} { return s.Events() }, nil},
+	{"VkQueryPool", func(s *State) interface{} { return s.QueryPools() }, nil},
+	{"VkFramebuffer", func(s *State) interface{} { return s.Framebuffers() }, nil},
+	{"VkRenderPass", func(s *State) interface{} { return s.RenderPasses() }, nil},
+	{"VkPipelineCache", func(s *State) interface{} { return s.PipelineCaches() }, nil},
+	{"VkCommandPool", func(s *State) interface{} { return s.CommandPools() }, nil},
+	{"VkSurfaceKHR", func(s *State) interface{} { return s.Surfaces() }, nil},
+	{"VkSwapchainKHR", func(s *State) interface{} { return s.Swapchains() }, nil},
+	{"VkDisplayModeKHR", func(s *State) interface{} { return s.DisplayModes() }, allImplicit},
+	{"VkDebugReportCallbackEXT", func(s *State) interface{} { return s.DebugReportCallbacks() }, nil},
+	{"VkDebugUtilsMessengerEXT", func(s *State) interface{} { return s.DebugUtilsMessengers() }, nil},
+	{"VkVideoSessionKHR", func(s *State) interface{} { return s.VideoSessions() }, nil},
+	{"VkVideoSessionParametersKHR", func(s *State) interface{} { return s.VideoSessionParameters() }, nil},
+}
+
+// aliveObject is an object alive in a map of the state, with its lifetime.
+type aliveObject struct {
+	object   interface{}
+	lifetime *service.ObjectLifetime
+	implicit bool
+}
+
+// objectTracker tracks the objects alive in the maps of the state.
+type objectTracker struct {
+	p      *path.Capture
+	out    *service.ObjectLifetimes
+	alive  []map[uint64]aliveObject
+	counts []int
+}
+
+// update records the objects created and destroyed by the command cmd with
+// the given id, or by the initial state if cmd is nil. The objects are paired
+// by handle, and a handle refers to a new object if the object in the state
+// changed. The objects of a map are only compared with the state if their
+// number changed, or if the command may replace objects.
+func (t *objectTracker) update(st *State, id api.CmdID, cmd api.Cmd) {
+	var p *path.Command
+	if cmd != nil {
+		p = t.p.Command(uint64(id))
+	}
+	for i, m := range objectMaps {
+		d := dictionary.From(m.get(st))
+		if t.alive[i] != nil && !mayReplaceObjects(cmd) && d.Len() == t.counts[i] {
+			continue
+		}
+		if t.alive[i] == nil {
+			t.alive[i] = map[uint64]aliveObject{}
+		}
+		t.counts[i] = d.Len()
+		objects := map[uint64]interface{}{}
+		for _, k := range d.Keys() {
+			objects[reflect.ValueOf(k).Uint()] = d.Get(k)
+		}
+
+		// The handles reused by other objects are destroyed first.
+		for h, a := range t.alive[i] {
+			if o, ok := objects[h]; !ok || o != a.object {
+				a.lifetime.Destroyed = p
+				delete(t.alive[i], h)
+			}
+		}
+		for _, k := range d.Keys() {
+			h := reflect.ValueOf(k).Uint()
+			if _, ok := t.alive[i][h]; ok {
+				continue
+			}
+			l := &service.ObjectLifetime{
+				Api:     "Vulkan",
+				Type:    m.ty,
+				Handle:  h,
+				Created: p,
+			}
+			o := objects[h]
+			t.alive[i][h] = aliveObject{o, l, m.implicit != nil && m.implicit(o)}
+			t.out.Objects = append(t.out.Objects, l)
+		}
+	}
+}
+
+// ResolveObjectLifetimes implements the resolve.ObjectLifetimesResolver
+// interface. The objects still alive at the end of the capture are marked as
+// leaked, except the ones the application doesn't destroy, such as the queues
+// and the command buffers.
+func (API) ResolveObjectLifetimes(ctx context.Context, p *path.Capture, out *service.ObjectLifetimes) error {
+	ctx = capture.Put(ctx, p)
+	c, err := capture.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	s, err := capture.NewState(ctx)
+	if err != nil {
+		return err
+	}
+	st := GetState(s)
+
+	t := &objectTracker{
+		p:      p,
+		out:    out,
+		alive:  make([]map[uint64]aliveObject, len(objectMaps)),
+		counts: make([]int, len(objectMaps)),
+	}
+	t.update(st, api.CmdNoID, nil)
+	err = api.ForeachCmd(ctx, c.Commands, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
+		cmd.Mutate(ctx, id, s, nil, nil)
+		t.update(st, id, cmd)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, alive := range t.alive {
+		for _, a := range alive {
+			a.lifetime.Leaked = !a.implicit
+		}
+	}
+	return nil
+}
@@ -39,27 +39,63 @@ var (
 type stencilOverdraw struct {
 	rewrite    map[api.CmdID]replay.Result
 	lastSubIdx map[api.CmdID]api.SubCmdIdx
+	// The first subcommands of the submits counted in the overdraw. The
+	// commands of the render pass before them are drawn without being counted.
+	firstSubIdx map[api.CmdID]api.SubCmdIdx
+}
+
+// overdrawPipeline identifies the pipeline created to replace a graphics
+// pipeline of the render pass, which counts the draws or not.
+type overdrawPipeline struct {
+	pipeline VkPipeline
+	counted  bool
+}
+
+// overdrawCommandBuffer identifies the command buffer created to replace a
+// secondary command buffer of the render pass, which counts the draws or not.
+type overdrawCommandBuffer struct {
+	commandBuffer VkCommandBuffer
+	counted       bool
 }
 
 func newStencilOverdraw() *stencilOverdraw {
 	return &stencilOverdraw{
-		rewrite:    map[api.CmdID]replay.Result{},
-		lastSubIdx: map[api.CmdID]api.SubCmdIdx{},
+		rewrite:     map[api.CmdID]replay.Result{},
+		lastSubIdx:  map[api.CmdID]api.SubCmdIdx{},
+		firstSubIdx: map[api.CmdID]api.SubCmdIdx{},
 	}
 }
 
-func (s *stencilOverdraw) add(ctx context.Context, extraCommands uint64, after []uint64, capt *path.Capture, res replay.Result) {
+// add requests the overdraw of the last render pass submitted before or at
+// after. Only the draws from the command first to the command after are
+// counted, if first is not nil.
+func (s *stencilOverdraw) add(ctx context.Context, extraCommands uint64, first, after []uint64, capt *path.Capture, res replay.Result) {
 	c, err := capture.ResolveFromPath(ctx, capt)
 	if err != nil {
 		res(nil, err)
 		return
 	}
+	if len(first) > 0 && api.SubCmdIdx(after).LessThan(api.SubCmdIdx(first)) {
+		res(nil, &service.ErrInvalidArgument{
+			Reason: messages.ErrMessage(fmt.Sprintf("Overdraw range %v to %v is empty", first, after)),
+		})
+		return
+	}
 	for lastSubmit := int64(after[0]); lastSubmit >= 0; lastSubmit-- {
 		switch (c.Commands[lastSubmit]).(type) {
 		case *VkQueueSubmit:
+			if len(first) > 0 && first[0] > uint64(lastSubmit) {
+				res(nil, &service.ErrDataUnavailable{
+					Reason: messages.ErrMessage("No queue submission in the overdraw range"),
+				})
+				return
+			}
 			id := api.CmdID(uint64(lastSubmit) + extraCommands)
 			s.rewrite[id] = res
 			s.lastSubIdx[id] = api.SubCmdIdx(after[1:])
+			if len(first) > 0 && first[0] == uint64(lastSubmit) {
+				s.firstSubIdx[id] = api.SubCmdIdx(first[1:])
+			}
 			log.D(ctx, "Overdraw marked for submit id %v", lastSubmit)
 			return
 		}
@@ -129,8 +165,14 @@ func (s *stencilOverdraw) Transform(ctx context.Context, id api.CmdID, cmd api.C
 		return
 	}
 
+	first, last := s.firstSubIdx[id], s.lastSubIdx[id]
+	counted := func(idx api.SubCmdIdx) bool {
+		return (len(first) == 0 || !idx.LessThan(first)) &&
+			(len(last) == 0 || idx.LEQ(last))
+	}
+
 	img, err := s.rewriteQueueSubmit(ctx, cb, gs, st, arena, submit,
-		lastRenderPassArgs, lastRenderPassIdx, id,
+		lastRenderPassArgs, lastRenderPassIdx, id, counted,
 		mustAllocData, addCleanup, out)
 	if err != nil {
 		res(nil, &service.ErrDataUnavailable{
@@ -925,6 +967,7 @@ func (s *stencilOverdraw) createGraphicsPipeline(ctx context.Context,
 	device VkDevice,
 	pipeline VkPipeline,
 	renderPass VkRenderPass,
+	counted bool,
 	alloc func(v ...interface{}) api.AllocResult,
 	addCleanup func(func()),
 	out transform.Writer,
@@ -937,7 +980,7 @@ func (s *stencilOverdraw) createGraphicsPipeline(ctx context.Context,
 	}
 
 	createInfo, err := s.createGraphicsPipelineCreateInfo(ctx,
-		cb, gs, st, a, pipeline, renderPass, alloc, allocAndRead,
+		cb, gs, st, a, pipeline, renderPass, counted, alloc, allocAndRead,
 		addCleanup, out)
 	if err != nil {
 		return 0, err
@@ -987,6 +1030,7 @@ func (s *stencilOverdraw) createGraphicsPipelineCreateInfo(ctx context.Context,
 	a arena.Arena,
 	pipeline VkPipeline,
 	renderPass VkRenderPass,
+	counted bool,
 	alloc func(v ...interface{}) api.AllocResult,
 	allocAndRead func(v ...interface{}) api.AllocResult,
 	addCleanup func(func()),
@@ -1143,14 +1187,19 @@ func (s *stencilOverdraw) createGraphicsPipelineCreateInfo(ctx context.Context,
 	var depthStencilPtr memory.Pointer
 	{
 		// FIXME: work with existing depth buffer
+		passOp := VkStencilOp_VK_STENCIL_OP_INCREMENT_AND_CLAMP
+		if !counted {
+			// The draws out of the requested range leave the counts as is.
+			passOp = VkStencilOp_VK_STENCIL_OP_KEEP
+		}
 		stencilOp := NewVkStencilOpState(a,
-			0, // failOp
-			VkStencilOp_VK_STENCIL_OP_INCREMENT_AND_CLAMP, // passOp
-			0, // depthFailOp
+			0,                                // failOp
+			passOp,                           // passOp
+			0,                                // depthFailOp
 			VkCompareOp_VK_COMPARE_OP_ALWAYS, // compareOp
-			255, // compareMask
-			255, // writeMask
-			0,   // reference
+			255,                              // compareMask
+			255,                              // writeMask
+			0,                                // reference
 		)
 		state := MakeVkPipelineDepthStencilStateCreateInfo(a)
 		state.SetSType(
@@ -1903,6 +1952,7 @@ func (s *stencilOverdraw) createCommandBuffer(ctx context.Context,
 	cmdBuffer VkCommandBuffer,
 	renderInfo renderInfo,
 	rpStartIdx uint64,
+	counted func(idx uint64) bool,
 	alloc func(v ...interface{}) api.AllocResult,
 	addCleanup func(func()),
 	out transform.Writer,
@@ -1920,14 +1970,49 @@ func (s *stencilOverdraw) createCommandBuffer(ctx context.Context,
 		f()
 	}
 
-	pipelines := map[VkPipeline]VkPipeline{}
-	secCmdBuffers := map[VkCommandBuffer]VkCommandBuffer{}
+	pipelines := map[overdrawPipeline]VkPipeline{}
+	secCmdBuffers := map[overdrawCommandBuffer]VkCommandBuffer{}
+
+	// bindPipeline returns the arguments binding the pipeline replacing the
+	// bound graphics pipeline, which counts the draws or not.
+	bindPipeline := func(ar VkCmdBindPipelineArgsʳ, count bool) (VkCmdBindPipelineArgsʳ, error) {
+		key := overdrawPipeline{ar.Pipeline(), count}
+		newPipe, ok := pipelines[key]
+		if !ok {
+			var err error
+			newPipe, err = s.createGraphicsPipeline(ctx, cb, gs, st,
+				a, device, ar.Pipeline(), renderInfo.renderPass, count,
+				alloc, addCleanup, out)
+			if err != nil {
+				return NilVkCmdBindPipelineArgsʳ, err
+			}
+			pipelines[key] = newPipe
+		}
+		newArgs := ar.Clone(a, api.CloneContext{})
+		newArgs.SetPipeline(newPipe)
+		return newArgs, nil
+	}
+	boundPipeline := NilVkCmdBindPipelineArgsʳ
+	boundCounted := false
 
 	rpEnded := false
 	for i := 0; i < bInfo.CommandReferences().Len(); i++ {
 		cr := bInfo.CommandReferences().Get(uint32(i))
 		args := GetCommandArgs(ctx, cr, st)
 		if uint64(i) >= rpStartIdx && !rpEnded {
+			// Switch the bound pipeline if the draw is not counted the same
+			// way as the previous ones.
+			if isDrawCommand(cr.Type()) && !boundPipeline.IsNil() &&
+				counted(uint64(i)) != boundCounted {
+				boundCounted = counted(uint64(i))
+				bindArgs, err := bindPipeline(boundPipeline, boundCounted)
+				if err != nil {
+					return 0, err
+				}
+				cleanup, cmd, _ := AddCommand(ctx, cb, newCmdBuffer, gs, gs, bindArgs)
+				writeEach(ctx, out, cmd)
+				cleanup()
+			}
 			switch ar := args.(type) {
 			case VkCmdBeginRenderPassArgsʳ:
 				// Transition the stencil image to the right layout
@@ -1979,38 +2064,32 @@ func (s *stencilOverdraw) createCommandBuffer(ctx context.Context,
 				newArgs := ar
 				if ar.PipelineBindPoint() ==
 					VkPipelineBindPoint_VK_PIPELINE_BIND_POINT_GRAPHICS {
-					newArgs = ar.Clone(a, api.CloneContext{})
-
-					pipe := ar.Pipeline()
-					newPipe, ok := pipelines[pipe]
-					if !ok {
-						var err error
-						newPipe, err = s.createGraphicsPipeline(ctx, cb, gs, st,
-							a, device, pipe, renderInfo.renderPass, alloc,
-							addCleanup, out)
-						if err != nil {
-							return 0, err
-						}
-						pipelines[pipe] = newPipe
+					boundPipeline, boundCounted = ar, counted(uint64(i))
+					var err error
+					newArgs, err = bindPipeline(ar, boundCounted)
+					if err != nil {
+						return 0, err
 					}
-					newArgs.SetPipeline(newPipe)
 				}
 				args = newArgs
 			case VkCmdExecuteCommandsArgsʳ:
 				newArgs := ar
+				// The secondary command buffers are counted as a whole.
+				count := counted(uint64(i))
 				for i := uint32(0); i < uint32(ar.CommandBuffers().Len()); i++ {
 					cmdbuf := ar.CommandBuffers().Get(i)
-					newCmdbuf, ok := secCmdBuffers[cmdbuf]
+					key := overdrawCommandBuffer{cmdbuf, count}
+					newCmdbuf, ok := secCmdBuffers[key]
 					if !ok {
 						var err error
 						newCmdbuf, err = s.createCommandBuffer(ctx, cb,
 							gs, st, a, queue, cmdbuf,
-							renderInfo, 0, alloc,
-							addCleanup, out)
+							renderInfo, 0, func(uint64) bool { return count },
+							alloc, addCleanup, out)
 						if err != nil {
 							return 0, err
 						}
-						secCmdBuffers[cmdbuf] = newCmdbuf
+						secCmdBuffers[key] = newCmdbuf
 					}
 					newArgs.CommandBuffers().Add(i, newCmdbuf)
 				}
@@ -2037,6 +2116,27 @@ func (s *stencilOverdraw) createCommandBuffer(ctx context.Context,
 	return newCmdBuffer, nil
 }
 
+// isDrawCommand returns true if the command of the given type draws in the
+// render pass.
+func isDrawCommand(ty CommandType) bool {
+	switch ty {
+	case CommandType_cmd_vkCmdDraw,
+		CommandType_cmd_vkCmdDrawIndexed,
+		CommandType_cmd_vkCmdDrawIndirect,
+		CommandType_cmd_vkCmdDrawIndexedIndirect,
+		CommandType_cmd_vkCmdDrawIndirectCountKHR,
+		CommandType_cmd_vkCmdDrawIndexedIndirectCountKHR,
+		CommandType_cmd_vkCmdDrawMeshTasksEXT,
+		CommandType_cmd_vkCmdDrawMeshTasksNV,
+		CommandType_cmd_vkCmdDrawMeshTasksIndirectEXT,
+		CommandType_cmd_vkCmdDrawMeshTasksIndirectNV,
+		CommandType_cmd_vkCmdDrawMeshTasksIndirectCountEXT,
+		CommandType_cmd_vkCmdDrawMeshTasksIndirectCountNV:
+		return true
+	}
+	return false
+}
+
 func (s *stencilOverdraw) rewriteQueueSubmit(ctx context.Context,
 	cb CommandBuilder,
 	gs *api.GlobalState,
@@ -2046,6 +2146,7 @@ func (s *stencilOverdraw) rewriteQueueSubmit(ctx context.Context,
 	rpBeginArgs VkCmdBeginRenderPassArgsʳ,
 	rpBeginIdx api.SubCmdIdx,
 	cmdId api.CmdID,
+	counted func(idx api.SubCmdIdx) bool,
 	alloc func(v ...interface{}) api.AllocResult,
 	addCleanup func(func()),
 	out transform.Writer,
@@ -2108,6 +2209,9 @@ func (s *stencilOverdraw) rewriteQueueSubmit(ctx context.Context,
 						cmdBuffers[rpBeginIdx[1]],
 						renderInfo,
 						rpBeginIdx[2],
+						func(idx uint64) bool {
+							return counted(api.SubCmdIdx{rpBeginIdx[0], rpBeginIdx[1], idx})
+						},
 						alloc, addCleanup, out)
 				if err != nil {
 					return stencilImage{}, err
@@ -0,0 +1,444 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/data/binary"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/replay/value"
+	"github.com/google/gapid/gapis/service"
+)
+
+var (
+	_ = transform.Transformer(&pipelineStatistics{})
+)
+
+// pipelineStatisticsFlags are the statistics queried around each draw. The
+// results of a query are in the order of the bits.
+const pipelineStatisticsFlags = VkQueryPipelineStatisticFlags(
+	VkQueryPipelineStatisticFlagBits_VK_QUERY_PIPELINE_STATISTIC_INPUT_ASSEMBLY_VERTICES_BIT |
+		VkQueryPipelineStatisticFlagBits_VK_QUERY_PIPELINE_STATISTIC_INPUT_ASSEMBLY_PRIMITIVES_BIT |
+		VkQueryPipelineStatisticFlagBits_VK_QUERY_PIPELINE_STATISTIC_VERTEX_SHADER_INVOCATIONS_BIT |
+		VkQueryPipelineStatisticFlagBits_VK_QUERY_PIPELINE_STATISTIC_CLIPPING_INVOCATIONS_BIT |
+		VkQueryPipelineStatisticFlagBits_VK_QUERY_PIPELINE_STATISTIC_CLIPPING_PRIMITIVES_BIT |
+		VkQueryPipelineStatisticFlagBits_VK_QUERY_PIPELINE_STATISTIC_FRAGMENT_SHADER_INVOCATIONS_BIT)
+
+// pipelineStatisticsStride is the size of the results of a query.
+const pipelineStatisticsStride = 6 * 8
+
+// pipelineStatisticsRequest is a request of the pipeline statistics of the
+// given draws.
+type pipelineStatisticsRequest struct {
+	draws [][]uint64
+}
+
+// pipelineStatisticsResult is the result of the request of the given draws.
+type pipelineStatisticsResult struct {
+	draws [][]uint64
+	res   replay.Result
+}
+
+// pipelineStatistics is a transform injecting pipeline statistics query pools
+// around the requested draws, and reading back the query results after the
+// submissions of the draws. Only the draws recorded in primary command
+// buffers are supported.
+type pipelineStatistics struct {
+	// The requested draws with the indices of the replay, to the draws with
+	// the indices of the capture.
+	draws *api.SubCmdIdxTrie
+	// The submissions of the requested draws.
+	submits map[api.CmdID]struct{}
+	// The statistics or the errors of the draws, by indices of the capture.
+	stats   *api.SubCmdIdxTrie
+	results []pipelineStatisticsResult
+}
+
+func newPipelineStatistics() *pipelineStatistics {
+	return &pipelineStatistics{
+		draws:   &api.SubCmdIdxTrie{},
+		submits: map[api.CmdID]struct{}{},
+		stats:   &api.SubCmdIdxTrie{},
+	}
+}
+
+// add requests the pipeline statistics of the draws. It returns false if the
+// request is rejected, in which case the error is passed to res.
+func (t *pipelineStatistics) add(ctx context.Context, extraCommands uint64, draws [][]uint64, res replay.Result) bool {
+	for _, d := range draws {
+		if len(d) != 4 {
+			res(nil, &service.ErrInvalidArgument{
+				Reason: messages.ErrMessage(fmt.Sprintf(
+					"Pipeline statistics of %v are not supported, only the draws of primary command buffers are", d)),
+			})
+			return false
+		}
+	}
+	for _, d := range draws {
+		idx := append(api.SubCmdIdx{d[0] + extraCommands}, d[1:]...)
+		t.draws.SetValue(idx, api.SubCmdIdx(d))
+		t.submits[api.CmdID(idx[0])] = struct{}{}
+	}
+	t.results = append(t.results, pipelineStatisticsResult{draws, res})
+	return true
+}
+
+// fail records the error as the result of the draws.
+func (t *pipelineStatistics) fail(draws []api.SubCmdIdx, err error) {
+	for _, d := range draws {
+		t.stats.SetValue(d, err)
+	}
+}
+
+func (t *pipelineStatistics) Transform(ctx context.Context, id api.CmdID, cmd api.Cmd, out transform.Writer) {
+	submit, ok := cmd.(*VkQueueSubmit)
+	if _, marked := t.submits[id]; !ok || !marked {
+		out.MutateAndWrite(ctx, id, cmd)
+		return
+	}
+
+	gs := out.State()
+	st := GetState(gs)
+	cb := CommandBuilder{Thread: cmd.Thread(), Arena: gs.Arena}
+
+	var allocated []*api.AllocResult
+	defer func() {
+		for _, d := range allocated {
+			d.Free()
+		}
+	}()
+	mustAllocData := func(v ...interface{}) api.AllocResult {
+		res := gs.AllocDataOrPanic(ctx, v...)
+		allocated = append(allocated, &res)
+		return res
+	}
+
+	l := gs.MemoryLayout
+	submit.Extras().Observations().ApplyReads(gs.Memory.ApplicationPool())
+	submitCount := submit.SubmitCount()
+	submitInfos := submit.PSubmits().Slice(0, uint64(submitCount), l).MustRead(ctx, submit, gs, nil)
+
+	// The draws queried in the submission, in the order of the queries.
+	queried := []api.SubCmdIdx{}
+	type rewrite struct {
+		submitInfo, cmdBuffer uint32
+		draws                 []uint32
+	}
+	rewrites := []rewrite{}
+	for i := uint32(0); i < submitCount; i++ {
+		si := submitInfos[i]
+		cmdBuffers := si.PCommandBuffers().Slice(0, uint64(si.CommandBufferCount()), l).MustRead(ctx, submit, gs, nil)
+		for j, buf := range cmdBuffers {
+			bInfo, ok := st.CommandBuffers().Lookup(buf)
+			if !ok {
+				continue
+			}
+			draws := []uint32{}
+			for k := 0; k < bInfo.CommandReferences().Len(); k++ {
+				d, ok := t.draws.Value(api.SubCmdIdx{uint64(id), uint64(i), uint64(j), uint64(k)}).(api.SubCmdIdx)
+				if !ok {
+					continue
+				}
+				if !isDrawCommand(bInfo.CommandReferences().Get(uint32(k)).Type()) {
+					t.fail([]api.SubCmdIdx{d}, &service.ErrInvalidArgument{
+						Reason: messages.ErrMessage(fmt.Sprintf("Command %v is not a draw", d)),
+					})
+					continue
+				}
+				draws = append(draws, uint32(k))
+				queried = append(queried, d)
+			}
+			if len(draws) > 0 {
+				rewrites = append(rewrites, rewrite{i, uint32(j), draws})
+			}
+		}
+	}
+	if len(queried) == 0 {
+		out.MutateAndWrite(ctx, id, cmd)
+		return
+	}
+
+	queue := st.Queues().Get(submit.Queue())
+	device := queue.Device()
+	if st.Devices().Get(device).EnabledFeatures().PipelineStatisticsQuery() == VkBool32(0) {
+		t.fail(queried, &service.ErrDataUnavailable{
+			Reason: messages.ErrMessage("Pipeline statistics queries are not enabled on the device"),
+		})
+		out.MutateAndWrite(ctx, id, cmd)
+		return
+	}
+
+	queryPool := t.createQueryPool(ctx, cb, out, device, uint32(len(queried)), mustAllocData)
+
+	reads := []api.AllocResult{}
+	allocAndRead := func(v ...interface{}) api.AllocResult {
+		res := mustAllocData(v)
+		reads = append(reads, res)
+		return res
+	}
+	newSubmitInfos := make([]VkSubmitInfo, submitCount)
+	query := uint32(0)
+	for i := uint32(0); i < submitCount; i++ {
+		si := submitInfos[i]
+
+		waitSemPtr := memory.Nullptr
+		waitDstStagePtr := memory.Nullptr
+		if count := uint64(si.WaitSemaphoreCount()); count > 0 {
+			waitSemPtr = allocAndRead(si.PWaitSemaphores().
+				Slice(0, count, l).
+				MustRead(ctx, submit, gs, nil)).Ptr()
+			waitDstStagePtr = allocAndRead(si.PWaitDstStageMask().
+				Slice(0, count, l).
+				MustRead(ctx, submit, gs, nil)).Ptr()
+		}
+
+		signalSemPtr := memory.Nullptr
+		if count := uint64(si.SignalSemaphoreCount()); count > 0 {
+			signalSemPtr = allocAndRead(si.PSignalSemaphores().
+				Slice(0, count, l).
+				MustRead(ctx, submit, gs, nil)).Ptr()
+		}
+
+		cmdBufferPtr := memory.Nullptr
+		if count := uint64(si.CommandBufferCount()); count > 0 {
+			cmdBuffers := si.PCommandBuffers().
+				Slice(0, count, l).
+				MustRead(ctx, submit, gs, nil)
+			for _, r := range rewrites {
+				if r.submitInfo != i {
+					continue
+				}
+				newCmdBuffer, err := t.rewriteCommandBuffer(ctx, cb, gs, st,
+					cmdBuffers[r.cmdBuffer], queryPool, query, r.draws, out)
+				if err != nil {
+					t.fail(queried, log.Err(ctx, err, "Couldn't inject the pipeline statistics queries"))
+					out.MutateAndWrite(ctx, id, cmd)
+					return
+				}
+				cmdBuffers[r.cmdBuffer] = newCmdBuffer
+				query += uint32(len(r.draws))
+			}
+			cmdBufferPtr = allocAndRead(cmdBuffers).Ptr()
+		}
+
+		newSubmitInfos[i] = NewVkSubmitInfo(gs.Arena,
+			VkStructureType_VK_STRUCTURE_TYPE_SUBMIT_INFO,
+			0,                            // pNext
+			si.WaitSemaphoreCount(),      // waitSemaphoreCount
+			NewVkSemaphoreᶜᵖ(waitSemPtr), // pWaitSemaphores
+			NewVkPipelineStageFlagsᶜᵖ(waitDstStagePtr), // pWaitDstStageMask
+			si.CommandBufferCount(),                    // commandBufferCount
+			NewVkCommandBufferᶜᵖ(cmdBufferPtr),         // pCommandBuffers
+			si.SignalSemaphoreCount(),                  // signalSemaphoreCount
+			NewVkSemaphoreᶜᵖ(signalSemPtr),             // pSignalSemaphores
+		)
+	}
+	submitInfoPtr := allocAndRead(newSubmitInfos).Ptr()
+
+	newCmd := cb.VkQueueSubmit(
+		submit.Queue(),
+		submit.SubmitCount(),
+		submitInfoPtr,
+		submit.Fence(),
+		VkResult_VK_SUCCESS,
+	)
+	for _, read := range reads {
+		newCmd.AddRead(read.Data())
+	}
+	out.MutateAndWrite(ctx, id, newCmd)
+
+	t.readResults(ctx, cb, out, submit.Queue(), device, queryPool, queried)
+}
+
+// createQueryPool creates a pipeline statistics query pool of the given size.
+func (t *pipelineStatistics) createQueryPool(ctx context.Context,
+	cb CommandBuilder,
+	out transform.Writer,
+	device VkDevice,
+	size uint32,
+	alloc func(v ...interface{}) api.AllocResult) VkQueryPool {
+	s := out.State()
+
+	queryPool := VkQueryPool(newUnusedID(false, func(id uint64) bool {
+		return GetState(s).QueryPools().Contains(VkQueryPool(id))
+	}))
+	queryPoolHandleData := alloc(queryPool)
+	queryPoolCreateInfo := alloc(NewVkQueryPoolCreateInfo(s.Arena,
+		VkStructureType_VK_STRUCTURE_TYPE_QUERY_POOL_CREATE_INFO, // sType
+		0, // pNext
+		0, // flags
+		VkQueryType_VK_QUERY_TYPE_PIPELINE_STATISTICS, // queryType
+		size,                    // queryCount
+		pipelineStatisticsFlags, // pipelineStatistics
+	))
+
+	out.MutateAndWrite(ctx, api.CmdNoID, cb.VkCreateQueryPool(
+		device,
+		queryPoolCreateInfo.Ptr(),
+		memory.Nullptr,
+		queryPoolHandleData.Ptr(),
+		VkResult_VK_SUCCESS,
+	).AddRead(queryPoolCreateInfo.Data()).AddWrite(queryPoolHandleData.Data()))
+	return queryPool
+}
+
+// rewriteCommandBuffer records a copy of the command buffer, with the
+// commands at the indices draws wrapped in the queries of the pool from
+// firstQuery.
+func (t *pipelineStatistics) rewriteCommandBuffer(ctx context.Context,
+	cb CommandBuilder,
+	gs *api.GlobalState,
+	st *State,
+	cmdBuffer VkCommandBuffer,
+	queryPool VkQueryPool,
+	firstQuery uint32,
+	draws []uint32,
+	out transform.Writer,
+) (VkCommandBuffer, error) {
+	bInfo := st.CommandBuffers().Get(cmdBuffer)
+
+	newCmdBuffer, cmds, cleanup := allocateNewCmdBufFromExistingOneAndBegin(
+		ctx, cb, cmdBuffer, gs)
+	writeEach(ctx, out, cmds...)
+	for _, f := range cleanup {
+		f()
+	}
+
+	// The queries must be reset outside of the render passes.
+	writeEach(ctx, out, cb.VkCmdResetQueryPool(newCmdBuffer, queryPool, firstQuery, uint32(len(draws))))
+
+	query := firstQuery
+	for i := 0; i < bInfo.CommandReferences().Len(); i++ {
+		measured := int(query-firstQuery) < len(draws) && draws[query-firstQuery] == uint32(i)
+		if measured {
+			writeEach(ctx, out, cb.VkCmdBeginQuery(newCmdBuffer, queryPool, query, 0))
+		}
+		cr := bInfo.CommandReferences().Get(uint32(i))
+		cleanup, cmd, err := AddCommand(ctx, cb, newCmdBuffer, gs, gs, GetCommandArgs(ctx, cr, st))
+		if err != nil {
+			return 0, err
+		}
+		writeEach(ctx, out, cmd)
+		cleanup()
+		if measured {
+			writeEach(ctx, out, cb.VkCmdEndQuery(newCmdBuffer, queryPool, query))
+			query++
+		}
+	}
+	writeEach(ctx, out, cb.VkEndCommandBuffer(newCmdBuffer, VkResult_VK_SUCCESS))
+	return newCmdBuffer, nil
+}
+
+// readResults waits for the queue to be idle, then reads back the results of
+// the queries of the draws and destroys the query pool.
+func (t *pipelineStatistics) readResults(ctx context.Context,
+	cb CommandBuilder,
+	out transform.Writer,
+	queue VkQueue,
+	device VkDevice,
+	queryPool VkQueryPool,
+	draws []api.SubCmdIdx) {
+	s := out.State()
+
+	buflen := uint64(len(draws) * pipelineStatisticsStride)
+	tmp := s.AllocOrPanic(ctx, buflen)
+	defer tmp.Free()
+	flags := VkQueryResultFlags(VkQueryResultFlagBits_VK_QUERY_RESULT_64_BIT | VkQueryResultFlagBits_VK_QUERY_RESULT_WAIT_BIT)
+
+	writeEach(ctx, out,
+		cb.VkQueueWaitIdle(queue, VkResult_VK_SUCCESS),
+		cb.VkGetQueryPoolResults(
+			device,
+			queryPool,
+			0,
+			uint32(len(draws)),
+			memory.Size(buflen),
+			tmp.Ptr(),
+			pipelineStatisticsStride,
+			flags,
+			VkResult_VK_SUCCESS),
+		cb.Custom(func(ctx context.Context, s *api.GlobalState, b *builder.Builder) error {
+			b.ReserveMemory(tmp.Range())
+			b.Post(value.ObservedPointer(tmp.Address()), buflen, func(r binary.Reader, err error) {
+				if err != nil {
+					t.fail(draws, log.Err(ctx, err, "Couldn't read the pipeline statistics"))
+					return
+				}
+				for _, d := range draws {
+					t.stats.SetValue(d, &service.DrawPipelineStatistics{
+						InputAssemblyVertices:     r.Uint64(),
+						InputAssemblyPrimitives:   r.Uint64(),
+						VertexShaderInvocations:   r.Uint64(),
+						ClippingInvocations:       r.Uint64(),
+						ClippingPrimitives:        r.Uint64(),
+						FragmentShaderInvocations: r.Uint64(),
+					})
+				}
+			})
+			return nil
+		}),
+		cb.VkDestroyQueryPool(device, queryPool, memory.Nullptr),
+	)
+}
+
+func (t *pipelineStatistics) Flush(ctx context.Context, out transform.Writer) {
+	s := out.State()
+	cb := CommandBuilder{Thread: 0, Arena: s.Arena}
+	out.MutateAndWrite(ctx, api.CmdNoID, cb.Custom(func(ctx context.Context, s *api.GlobalState, b *builder.Builder) error {
+		code := uint32(0xbeefcace)
+		b.Push(value.U32(code))
+		b.Post(b.Buffer(1), 4, func(r binary.Reader, err error) {
+			if err == nil && r.Uint32() != code {
+				err = fmt.Errorf("Unexpected EOS code")
+			}
+			for _, res := range t.results {
+				res.res.Do(func() (interface{}, error) {
+					if err != nil {
+						return nil, log.Err(ctx, err, "Flush did not get expected EOS code")
+					}
+					return t.collect(res.draws)
+				})
+			}
+		})
+		return nil
+	}))
+}
+
+// collect returns the statistics of the draws, or the first error of the
+// draws.
+func (t *pipelineStatistics) collect(draws [][]uint64) ([]*service.DrawPipelineStatistics, error) {
+	out := make([]*service.DrawPipelineStatistics, len(draws))
+	for i, d := range draws {
+		switch v := t.stats.Value(api.SubCmdIdx(d)).(type) {
+		case *service.DrawPipelineStatistics:
+			out[i] = v
+		case error:
+			return nil, v
+		default:
+			return nil, &service.ErrDataUnavailable{
+				Reason: messages.ErrMessage(fmt.Sprintf("No pipeline statistics for %v, it was not replayed", d)),
+			}
+		}
+	}
+	return out, nil
+}
@@ -55,6 +55,11 @@ type queryPoolInfo struct {
 }
 
 type queryTimestamps struct {
+	// If true, the render passes of the submitted command buffers are also
+	// measured.
+	renderPasses bool
+	// If true, the draws of the submitted command buffers are also measured.
+	draws        bool
 	commandPools map[VkDevice]VkCommandPool
 	queryPools   map[VkQueue]*queryPoolInfo
 	replayResult []replay.Result
@@ -62,8 +67,10 @@ type queryTimestamps struct {
 	allocated    []*api.AllocResult
 }
 
-func newQueryTimestamps(ctx context.Context, c *capture.Capture, numInitialCmds int) *queryTimestamps {
+func newQueryTimestamps(ctx context.Context, c *capture.Capture, numInitialCmds int, renderPasses, draws bool) *queryTimestamps {
 	transform := &queryTimestamps{
+		renderPasses: renderPasses,
+		draws:        draws,
 		commandPools: make(map[VkDevice]VkCommandPool),
 		queryPools:   make(map[VkQueue]*queryPoolInfo),
 	}
@@ -270,6 +277,29 @@ func (t *queryTimestamps) rewriteQueueSubmit(ctx context.Context,
 	cmd.Extras().Observations().ApplyReads(s.Memory.ApplicationPool())
 	submitCount := cmd.SubmitCount()
 	submitInfos := cmd.pSubmits.Slice(0, uint64(submitCount), s.MemoryLayout).MustRead(ctx, cmd, s, nil)
+
+	// The render passes and the draws of the submitted command buffers, if
+	// measured.
+	ranges := map[VkCommandBuffer][]measuredRange{}
+	rangesPool, rangesQuery := VkQueryPool(0), uint32(0)
+	rangesRecords := []replay.Timestamp{}
+	if t.renderPasses || t.draws {
+		numRanges := 0
+		for i := uint32(0); i < submitCount; i++ {
+			si := submitInfos[i]
+			cmdBuffers := si.PCommandBuffers().Slice(0, uint64(si.CommandBufferCount()), l).MustRead(ctx, cmd, s, nil)
+			for _, buf := range cmdBuffers {
+				if c, ok := GetState(s).CommandBuffers().Lookup(buf); ok {
+					ranges[buf] = commandBufferRanges(c, t.renderPasses, t.draws)
+					numRanges += len(ranges[buf])
+				}
+			}
+		}
+		if numRanges > 0 {
+			rangesPool = t.createRangesQueryPool(ctx, cb, out, device, uint32(numRanges*2))
+		}
+	}
+
 	newSubmitInfos := make([]VkSubmitInfo, submitCount)
 	for i := uint32(0); i < submitCount; i++ {
 		si := submitInfos[i]
@@ -308,6 +338,23 @@ func (t *queryTimestamps) rewriteQueueSubmit(ctx context.Context,
 		for j := uint32(0); j < cmdCount; j++ {
 			buf := cmdBuffers[j]
 			newCmdBuffers[j*2+1] = buf
+			if rs := ranges[buf]; len(rs) > 0 {
+				newBuf, err := t.rewriteCommandBuffer(ctx, cb, out, buf, rangesPool, rangesQuery, rs)
+				if err != nil {
+					log.E(ctx, "Couldn't measure the render passes or draws of command buffer %v: %v", buf, err)
+				} else {
+					newCmdBuffers[j*2+1] = newBuf
+					rangesQuery += uint32(len(rs) * 2)
+					for _, r := range rs {
+						rangesRecords = append(rangesRecords, replay.Timestamp{
+							Begin:      &path.Command{Indices: []uint64{uint64(id), uint64(i), uint64(j), uint64(r.begin)}},
+							End:        &path.Command{Indices: []uint64{uint64(id), uint64(i), uint64(j), uint64(r.end)}},
+							RenderPass: !r.draw,
+							Draw:       r.draw,
+						})
+					}
+				}
+			}
 
 			commandbuffer = t.generateQueryCommand(ctx,
 				cb,
@@ -331,7 +378,7 @@ func (t *queryTimestamps) rewriteQueueSubmit(ctx context.Context,
 				Indices: []uint64{uint64(id), uint64(i), uint64(j), uint64(n - 1)},
 			}
 			queryPoolInfo.results = append(queryPoolInfo.results,
-				timestampRecord{timestamp: replay.Timestamp{begin, end, 0}, IsEoC: j == cmdCount-1})
+				timestampRecord{timestamp: replay.Timestamp{Begin: begin, End: end}, IsEoC: j == cmdCount-1})
 		}
 
 		cmdBufferPtr := allocAndRead(newCmdBuffers).Ptr()
@@ -362,6 +409,184 @@ func (t *queryTimestamps) rewriteQueueSubmit(ctx context.Context,
 		newCmd.AddRead(read.Data())
 	}
 	out.MutateAndWrite(ctx, id, newCmd)
+
+	if rangesPool != VkQueryPool(0) {
+		t.readRangesResults(ctx, cb, out, cmd.Queue(), device, rangesPool, queryPoolInfo.timestampPeriod, rangesRecords)
+	}
+}
+
+// measuredRange is a range of the commands of a command buffer measured with
+// timestamps: a render pass, from the vkCmdBeginRenderPass or
+// vkCmdBeginRenderPass2 to the vkCmdEndRenderPass or vkCmdEndRenderPass2, or a
+// single draw.
+type measuredRange struct {
+	begin, end uint32
+	draw       bool
+}
+
+// commandBufferRanges returns the render passes and the draws recorded in the
+// command buffer, as requested. The renderpass2 commands are recorded with the
+// command types of their Vulkan 1.0 counterparts, so both begin and end the
+// render passes.
+func commandBufferRanges(c CommandBufferObjectʳ, renderPasses, draws bool) []measuredRange {
+	out := []measuredRange{}
+	begin := uint32(0)
+	for i := 0; i < c.CommandReferences().Len(); i++ {
+		ty := c.CommandReferences().Get(uint32(i)).Type()
+		switch {
+		case ty == CommandType_cmd_vkCmdBeginRenderPass:
+			begin = uint32(i)
+		case ty == CommandType_cmd_vkCmdEndRenderPass && renderPasses:
+			out = append(out, measuredRange{begin, uint32(i), false})
+		case isDrawCommand(ty) && draws:
+			out = append(out, measuredRange{uint32(i), uint32(i), true})
+		}
+	}
+	return out
+}
+
+// createRangesQueryPool creates a timestamp query pool of the given size
+// for the render passes and draws of a submission.
+func (t *queryTimestamps) createRangesQueryPool(ctx context.Context,
+	cb CommandBuilder,
+	out transform.Writer,
+	device VkDevice,
+	size uint32) VkQueryPool {
+	s := out.State()
+
+	queryPool := VkQueryPool(newUnusedID(false, func(id uint64) bool {
+		return GetState(s).QueryPools().Contains(VkQueryPool(id))
+	}))
+	queryPoolHandleData := t.mustAllocData(ctx, s, queryPool)
+	queryPoolCreateInfo := t.mustAllocData(ctx, s, NewVkQueryPoolCreateInfo(s.Arena,
+		VkStructureType_VK_STRUCTURE_TYPE_QUERY_POOL_CREATE_INFO, // sType
+		0, // pNext
+		0, // flags
+		VkQueryType_VK_QUERY_TYPE_TIMESTAMP, // queryType
+		size, // queryCount
+		0,    // pipelineStatistics
+	))
+
+	out.MutateAndWrite(ctx, api.CmdNoID, cb.VkCreateQueryPool(
+		device,
+		queryPoolCreateInfo.Ptr(),
+		memory.Nullptr,
+		queryPoolHandleData.Ptr(),
+		VkResult_VK_SUCCESS,
+	).AddRead(queryPoolCreateInfo.Data()).AddWrite(queryPoolHandleData.Data()))
+	return queryPool
+}
+
+// rewriteCommandBuffer records a copy of the command buffer, with timestamps
+// written before the begin and after the end of each of the ranges, in the
+// queries of the pool from firstQuery. The draws may be nested in the render
+// passes.
+func (t *queryTimestamps) rewriteCommandBuffer(ctx context.Context,
+	cb CommandBuilder,
+	out transform.Writer,
+	cmdBuffer VkCommandBuffer,
+	queryPool VkQueryPool,
+	firstQuery uint32,
+	ranges []measuredRange) (VkCommandBuffer, error) {
+	gs := out.State()
+	st := GetState(gs)
+	bInfo := st.CommandBuffers().Get(cmdBuffer)
+
+	newCmdBuffer, cmds, cleanup := allocateNewCmdBufFromExistingOneAndBegin(
+		ctx, cb, cmdBuffer, gs)
+	writeEach(ctx, out, cmds...)
+	for _, f := range cleanup {
+		f()
+	}
+
+	// The queries must be reset outside of the render passes.
+	writeEach(ctx, out, cb.VkCmdResetQueryPool(newCmdBuffer, queryPool, firstQuery, uint32(len(ranges)*2)))
+
+	// The queries written before and after each command.
+	begins, ends := map[uint32][]uint32{}, map[uint32][]uint32{}
+	for i, r := range ranges {
+		begins[r.begin] = append(begins[r.begin], firstQuery+uint32(i*2))
+		ends[r.end] = append(ends[r.end], firstQuery+uint32(i*2+1))
+	}
+
+	for i := 0; i < bInfo.CommandReferences().Len(); i++ {
+		for _, q := range begins[uint32(i)] {
+			writeEach(ctx, out, cb.VkCmdWriteTimestamp(newCmdBuffer,
+				VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TOP_OF_PIPE_BIT,
+				queryPool,
+				q))
+		}
+		cr := bInfo.CommandReferences().Get(uint32(i))
+		cleanup, cmd, err := AddCommand(ctx, cb, newCmdBuffer, gs, gs, GetCommandArgs(ctx, cr, st))
+		if err != nil {
+			return 0, err
+		}
+		writeEach(ctx, out, cmd)
+		cleanup()
+		for _, q := range ends[uint32(i)] {
+			writeEach(ctx, out, cb.VkCmdWriteTimestamp(newCmdBuffer,
+				VkPipelineStageFlagBits_VK_PIPELINE_STAGE_BOTTOM_OF_PIPE_BIT,
+				queryPool,
+				q))
+		}
+	}
+	writeEach(ctx, out, cb.VkEndCommandBuffer(newCmdBuffer, VkResult_VK_SUCCESS))
+	return newCmdBuffer, nil
+}
+
+// readRangesResults waits for the queue to be idle, then reads back the
+// timestamps of the render passes and draws of the records and destroys the
+// query pool.
+func (t *queryTimestamps) readRangesResults(ctx context.Context,
+	cb CommandBuilder,
+	out transform.Writer,
+	queue VkQueue,
+	device VkDevice,
+	queryPool VkQueryPool,
+	timestampPeriod float32,
+	records []replay.Timestamp) {
+	if len(records) == 0 {
+		out.MutateAndWrite(ctx, api.CmdNoID, cb.VkDestroyQueryPool(device, queryPool, memory.Nullptr))
+		return
+	}
+	s := out.State()
+
+	queryCount := uint32(len(records) * 2)
+	buflen := uint64(queryCount * 8)
+	tmp := s.AllocOrPanic(ctx, buflen)
+	defer tmp.Free()
+	flags := VkQueryResultFlags(VkQueryResultFlagBits_VK_QUERY_RESULT_64_BIT | VkQueryResultFlagBits_VK_QUERY_RESULT_WAIT_BIT)
+
+	writeEach(ctx, out,
+		cb.VkQueueWaitIdle(queue, VkResult_VK_SUCCESS),
+		cb.VkGetQueryPoolResults(
+			device,
+			queryPool,
+			0,
+			queryCount,
+			memory.Size(buflen),
+			tmp.Ptr(),
+			8,
+			flags,
+			VkResult_VK_SUCCESS),
+		cb.Custom(func(ctx context.Context, s *api.GlobalState, b *builder.Builder) error {
+			b.ReserveMemory(tmp.Range())
+			b.Post(value.ObservedPointer(tmp.Address()), buflen, func(r binary.Reader, err error) {
+				if err != nil {
+					log.E(ctx, "Couldn't read the timestamps of the render passes and draws: %v", err)
+					return
+				}
+				for _, record := range records {
+					tBegin, tEnd := r.Uint64(), r.Uint64()
+					record.Time = time.Duration(uint64(float32(tEnd-tBegin)*timestampPeriod)) * time.Nanosecond
+					record.Start = time.Duration(uint64(float64(tBegin)*float64(timestampPeriod))) * time.Nanosecond
+					t.timestamps = append(t.timestamps, record)
+				}
+			})
+			return nil
+		}),
+		cb.VkDestroyQueryPool(device, queryPool, memory.Nullptr),
+	)
 }
 
 func (t *queryTimestamps) GetQueryResults(ctx context.Context,
@@ -410,6 +635,7 @@ func (t *queryTimestamps) GetQueryResults(ctx context.Context,
 				tEnd := r.Uint64()
 				record := queryPoolInfo.results[queryPoolInfo.readIndex]
 				record.timestamp.Time = time.Duration(uint64(float32(tEnd-tStart)*queryPoolInfo.timestampPeriod)) * time.Nanosecond
+				record.timestamp.Start = time.Duration(uint64(float64(tStart)*float64(queryPoolInfo.timestampPeriod))) * time.Nanosecond
 				if record.IsEoC && i < queryCount {
 					tStart = r.Uint64()
 					i++
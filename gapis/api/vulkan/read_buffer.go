@@ -0,0 +1,380 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/data/binary"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/replay/value"
+	"github.com/google/gapid/gapis/service"
+)
+
+// postBufferData copies the given range of the buffer to a host visible
+// staging buffer on the given queue, and posts back the content of the
+// staging buffer as a []byte. The buffer must have been created with the
+// transfer src usage bit.
+func postBufferData(ctx context.Context,
+	cb CommandBuilder,
+	s *api.GlobalState,
+	queue QueueObjectʳ,
+	buffer BufferObjectʳ,
+	offset,
+	size uint64,
+	out transform.Writer,
+	res replay.Result) {
+
+	a := s.Arena // TODO: Use a temporary arena?
+
+	if size == 0 {
+		res([]byte{}, nil)
+		return
+	}
+	if offset+size > uint64(buffer.Info().Size()) {
+		res(nil, &service.ErrDataUnavailable{Reason: messages.ErrMessage("The range to read is out of the buffer")})
+		return
+	}
+
+	vkQueue := queue.VulkanHandle()
+	vkDevice := queue.Device()
+	device := GetState(s).Devices().Get(vkDevice)
+	physicalDevice := GetState(s).PhysicalDevices().Get(device.PhysicalDevice())
+
+	// Wraps the data allocation so the data get freed at the end.
+	var allocated []*api.AllocResult
+	defer func() {
+		for _, d := range allocated {
+			d.Free()
+		}
+	}()
+	MustAllocData := func(ctx context.Context, s *api.GlobalState, v ...interface{}) api.AllocResult {
+		res := s.AllocDataOrPanic(ctx, v...)
+		allocated = append(allocated, &res)
+		return res
+	}
+
+	fenceID := VkFence(newUnusedID(false, func(x uint64) bool { return GetState(s).Fences().Contains(VkFence(x)) }))
+	fenceCreateInfo := NewVkFenceCreateInfo(a,
+		VkStructureType_VK_STRUCTURE_TYPE_FENCE_CREATE_INFO, // sType
+		NewVoidᶜᵖ(memory.Nullptr),                           // pNext
+		VkFenceCreateFlags(0),                               // flags
+	)
+	fenceCreateData := MustAllocData(ctx, s, fenceCreateInfo)
+	fenceData := MustAllocData(ctx, s, fenceID)
+
+	stagingMemoryTypeIndex := uint32(0)
+	for i := uint32(0); i < physicalDevice.MemoryProperties().MemoryTypeCount(); i++ {
+		t := physicalDevice.MemoryProperties().MemoryTypes().Get(int(i))
+		if 0 != (t.PropertyFlags() & VkMemoryPropertyFlags(
+			VkMemoryPropertyFlagBits_VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT|
+				VkMemoryPropertyFlagBits_VK_MEMORY_PROPERTY_HOST_COHERENT_BIT)) {
+			stagingMemoryTypeIndex = i
+			break
+		}
+	}
+
+	// Data and info for staging buffer creation
+	stagingBufferID := VkBuffer(newUnusedID(false, func(x uint64) bool { return GetState(s).Buffers().Contains(VkBuffer(x)) }))
+	stagingMemoryID := VkDeviceMemory(newUnusedID(false, func(x uint64) bool { return GetState(s).DeviceMemories().Contains(VkDeviceMemory(x)) }))
+	stagingMemoryAllocInfo := NewVkMemoryAllocateInfo(a,
+		VkStructureType_VK_STRUCTURE_TYPE_MEMORY_ALLOCATE_INFO, // sType
+		0,                      // pNext
+		VkDeviceSize(size*2),   // allocationSize
+		stagingMemoryTypeIndex, // memoryTypeIndex
+	)
+	stagingMemoryAllocInfoData := MustAllocData(ctx, s, stagingMemoryAllocInfo)
+	stagingMemoryData := MustAllocData(ctx, s, stagingMemoryID)
+	stagingBufferCreateInfo := NewVkBufferCreateInfo(a,
+		VkStructureType_VK_STRUCTURE_TYPE_BUFFER_CREATE_INFO, // sType
+		NewVoidᶜᵖ(memory.Nullptr),                            // pNext
+		VkBufferCreateFlags(0),                               // flags
+		VkDeviceSize(size),                                   // size
+		VkBufferUsageFlags(VkBufferUsageFlagBits_VK_BUFFER_USAGE_TRANSFER_DST_BIT), // usage
+		VkSharingMode_VK_SHARING_MODE_EXCLUSIVE,                                    // sharingMode
+		0,                                                                          // queueFamilyIndexCount
+		NewU32ᶜᵖ(memory.Nullptr),                                                   // pQueueFamilyIndices
+	)
+	stagingBufferCreateInfoData := MustAllocData(ctx, s, stagingBufferCreateInfo)
+	stagingBufferData := MustAllocData(ctx, s, stagingBufferID)
+
+	// Command pool and command buffer
+	commandPoolID := VkCommandPool(newUnusedID(false, func(x uint64) bool { return GetState(s).CommandPools().Contains(VkCommandPool(x)) }))
+	commandPoolCreateInfo := NewVkCommandPoolCreateInfo(a,
+		VkStructureType_VK_STRUCTURE_TYPE_COMMAND_POOL_CREATE_INFO,                                 // sType
+		NewVoidᶜᵖ(memory.Nullptr),                                                                  // pNext
+		VkCommandPoolCreateFlags(VkCommandPoolCreateFlagBits_VK_COMMAND_POOL_CREATE_TRANSIENT_BIT), // flags
+		queue.Family(), // queueFamilyIndex
+	)
+	commandPoolCreateInfoData := MustAllocData(ctx, s, commandPoolCreateInfo)
+	commandPoolData := MustAllocData(ctx, s, commandPoolID)
+	commandBufferAllocateInfo := NewVkCommandBufferAllocateInfo(a,
+		VkStructureType_VK_STRUCTURE_TYPE_COMMAND_BUFFER_ALLOCATE_INFO, // sType
+		NewVoidᶜᵖ(memory.Nullptr),                                      // pNext
+		commandPoolID,                                                  // commandPool
+		VkCommandBufferLevel_VK_COMMAND_BUFFER_LEVEL_PRIMARY,           // level
+		1, // commandBufferCount
+	)
+	commandBufferAllocateInfoData := MustAllocData(ctx, s, commandBufferAllocateInfo)
+	commandBufferID := VkCommandBuffer(newUnusedID(true, func(x uint64) bool { return GetState(s).CommandBuffers().Contains(VkCommandBuffer(x)) }))
+	commandBufferData := MustAllocData(ctx, s, commandBufferID)
+
+	beginCommandBufferInfo := NewVkCommandBufferBeginInfo(a,
+		VkStructureType_VK_STRUCTURE_TYPE_COMMAND_BUFFER_BEGIN_INFO, // sType
+		0, // pNext
+		VkCommandBufferUsageFlags(VkCommandBufferUsageFlagBits_VK_COMMAND_BUFFER_USAGE_ONE_TIME_SUBMIT_BIT), // flags
+		0, // pInheritanceInfo
+	)
+	beginCommandBufferInfoData := MustAllocData(ctx, s, beginCommandBufferInfo)
+
+	// Make the writes to the buffer by the previous submissions, e.g. by
+	// compute shaders, visible to the copy.
+	bufferBarrier := NewVkBufferMemoryBarrier(a,
+		VkStructureType_VK_STRUCTURE_TYPE_BUFFER_MEMORY_BARRIER, // sType
+		0, // pNext
+		VkAccessFlags((VkAccessFlagBits_VK_ACCESS_MEMORY_WRITE_BIT-1)|VkAccessFlagBits_VK_ACCESS_MEMORY_WRITE_BIT), // srcAccessMask
+		VkAccessFlags(VkAccessFlagBits_VK_ACCESS_TRANSFER_READ_BIT),                                                // dstAccessMask
+		queueFamilyIgnore,     // srcQueueFamilyIndex
+		queueFamilyIgnore,     // dstQueueFamilyIndex
+		buffer.VulkanHandle(), // buffer
+		VkDeviceSize(offset),  // offset
+		VkDeviceSize(size),    // size
+	)
+	bufferBarrierData := MustAllocData(ctx, s, bufferBarrier)
+
+	bufferCopy := NewVkBufferCopy(a,
+		VkDeviceSize(offset), // srcOffset
+		0,                    // dstOffset
+		VkDeviceSize(size),   // size
+	)
+	bufferCopyData := MustAllocData(ctx, s, bufferCopy)
+
+	commandBuffers := MustAllocData(ctx, s, commandBufferID)
+	submitInfo := NewVkSubmitInfo(a,
+		VkStructureType_VK_STRUCTURE_TYPE_SUBMIT_INFO, // sType
+		0, // pNext
+		0, // waitSemaphoreCount
+		0, // pWaitSemaphores
+		0, // pWaitDstStageMask
+		1, // commandBufferCount
+		NewVkCommandBufferᶜᵖ(commandBuffers.Ptr()), // pCommandBuffers
+		0, // signalSemaphoreCount
+		0, // pSignalSemaphores
+	)
+	submitInfoData := MustAllocData(ctx, s, submitInfo)
+
+	mappedMemoryRange := NewVkMappedMemoryRange(a,
+		VkStructureType_VK_STRUCTURE_TYPE_MAPPED_MEMORY_RANGE, // sType
+		0,                                // pNext
+		stagingMemoryID,                  // memory
+		VkDeviceSize(0),                  // offset
+		VkDeviceSize(0xFFFFFFFFFFFFFFFF), // size
+	)
+	mappedMemoryRangeData := MustAllocData(ctx, s, mappedMemoryRange)
+	at, err := s.Alloc(ctx, size)
+	if err != nil {
+		res(nil, &service.ErrDataUnavailable{Reason: messages.ErrMessage("Device Memory -> Host mapping failed")})
+		return
+	}
+	allocated = append(allocated, &at)
+	mappedPointer := MustAllocData(ctx, s, at.Address())
+
+	// Create the staging buffer, allocate and bind memory
+	writeEach(ctx, out,
+		cb.VkCreateBuffer(
+			vkDevice,
+			stagingBufferCreateInfoData.Ptr(),
+			memory.Nullptr,
+			stagingBufferData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(
+			stagingBufferCreateInfoData.Data(),
+		).AddWrite(
+			stagingBufferData.Data(),
+		),
+		cb.VkAllocateMemory(
+			vkDevice,
+			stagingMemoryAllocInfoData.Ptr(),
+			memory.Nullptr,
+			stagingMemoryData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(
+			stagingMemoryAllocInfoData.Data(),
+		).AddWrite(
+			stagingMemoryData.Data(),
+		),
+		cb.VkBindBufferMemory(
+			vkDevice,
+			stagingBufferID,
+			stagingMemoryID,
+			VkDeviceSize(0),
+			VkResult_VK_SUCCESS,
+		),
+	)
+
+	// Create command pool, allocate command buffer, and create a fence
+	writeEach(ctx, out,
+		cb.VkCreateCommandPool(
+			vkDevice,
+			commandPoolCreateInfoData.Ptr(),
+			memory.Nullptr,
+			commandPoolData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(
+			commandPoolCreateInfoData.Data(),
+		).AddWrite(
+			commandPoolData.Data(),
+		),
+		cb.VkAllocateCommandBuffers(
+			vkDevice,
+			commandBufferAllocateInfoData.Ptr(),
+			commandBufferData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(
+			commandBufferAllocateInfoData.Data(),
+		).AddWrite(
+			commandBufferData.Data(),
+		),
+		cb.VkCreateFence(
+			vkDevice,
+			fenceCreateData.Ptr(),
+			memory.Nullptr,
+			fenceData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(
+			fenceCreateData.Data(),
+		).AddWrite(
+			fenceData.Data(),
+		),
+	)
+
+	// Record the copy to the staging buffer
+	writeEach(ctx, out,
+		cb.VkBeginCommandBuffer(
+			commandBufferID,
+			beginCommandBufferInfoData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(
+			beginCommandBufferInfoData.Data(),
+		),
+		cb.VkCmdPipelineBarrier(
+			commandBufferID,
+			VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_ALL_COMMANDS_BIT),
+			VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_TRANSFER_BIT),
+			VkDependencyFlags(0),
+			0,
+			memory.Nullptr,
+			1,
+			bufferBarrierData.Ptr(),
+			0,
+			memory.Nullptr,
+		).AddRead(
+			bufferBarrierData.Data(),
+		),
+		cb.VkCmdCopyBuffer(
+			commandBufferID,
+			buffer.VulkanHandle(),
+			stagingBufferID,
+			1,
+			bufferCopyData.Ptr(),
+		).AddRead(
+			bufferCopyData.Data(),
+		),
+		cb.VkEndCommandBuffer(
+			commandBufferID,
+			VkResult_VK_SUCCESS,
+		),
+	)
+
+	// Submit the copy, wait until finish.
+	writeEach(ctx, out,
+		cb.VkDeviceWaitIdle(vkDevice, VkResult_VK_SUCCESS),
+		cb.VkQueueSubmit(
+			vkQueue,
+			1,
+			submitInfoData.Ptr(),
+			fenceID,
+			VkResult_VK_SUCCESS,
+		).AddRead(
+			submitInfoData.Data(),
+		).AddRead(
+			commandBuffers.Data(),
+		),
+		cb.VkWaitForFences(
+			vkDevice,
+			1,
+			fenceData.Ptr(),
+			1,
+			0xFFFFFFFFFFFFFFFF,
+			VkResult_VK_SUCCESS,
+		).AddRead(
+			fenceData.Data(),
+		),
+		cb.VkDeviceWaitIdle(vkDevice, VkResult_VK_SUCCESS),
+	)
+
+	// Dump the staging buffer data to host
+	writeEach(ctx, out,
+		cb.VkMapMemory(
+			vkDevice,
+			stagingMemoryID,
+			VkDeviceSize(0),
+			VkDeviceSize(size),
+			VkMemoryMapFlags(0),
+			mappedPointer.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddWrite(mappedPointer.Data()),
+		cb.VkInvalidateMappedMemoryRanges(
+			vkDevice,
+			1,
+			mappedMemoryRangeData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(mappedMemoryRangeData.Data()),
+	)
+
+	// Add post command
+	writeEach(ctx, out,
+		cb.Custom(func(ctx context.Context, s *api.GlobalState, b *builder.Builder) error {
+			b.Post(value.ObservedPointer(at.Address()), size, func(r binary.Reader, err error) {
+				var bytes []byte
+				if err == nil {
+					bytes = make([]byte, size)
+					r.Data(bytes)
+					err = r.Error()
+				}
+				if err != nil {
+					err = fmt.Errorf("Could not read buffer data (expected length %d bytes): %v", size, err)
+					bytes = nil
+				}
+				res(bytes, err)
+			})
+			return nil
+		}),
+	)
+
+	// Free the device resources used for reading the buffer
+	writeEach(ctx, out,
+		cb.VkUnmapMemory(vkDevice, stagingMemoryID),
+		cb.VkDestroyBuffer(vkDevice, stagingBufferID, memory.Nullptr),
+		cb.VkDestroyCommandPool(vkDevice, commandPoolID, memory.Nullptr),
+		cb.VkFreeMemory(vkDevice, stagingMemoryID, memory.Nullptr),
+		cb.VkDestroyFence(vkDevice, fenceID, memory.Nullptr))
+}
@@ -176,6 +176,28 @@ func (t *readFramebuffer) Color(id api.CmdID, width, height, bufferIdx uint32, r
 	})
 }
 
+// Buffer reads back the given range of the buffer after the command id, e.g.
+// the indirect draw parameters written by the GPU.
+func (t *readFramebuffer) Buffer(id api.CmdID, vkBuf VkBuffer, offset, size uint64, res replay.Result) {
+	t.injections[id] = append(t.injections[id], func(ctx context.Context, cmd api.Cmd, out transform.Writer) {
+		s := out.State()
+		c := GetState(s)
+
+		lastQueue := c.LastBoundQueue()
+		if lastQueue.IsNil() {
+			res(nil, &service.ErrDataUnavailable{Reason: messages.ErrMessage("No previous queue submission")})
+			return
+		}
+		buffer := c.Buffers().Get(vkBuf)
+		if buffer.IsNil() {
+			res(nil, &service.ErrDataUnavailable{Reason: messages.ErrMessage("Invalid buffer, the VkBuffer might have been destroyed")})
+			return
+		}
+		cb := CommandBuilder{Thread: cmd.Thread(), Arena: s.Arena}
+		postBufferData(ctx, cb, s, lastQueue, buffer, offset, size, out, res)
+	})
+}
+
 func writeEach(ctx context.Context, out transform.Writer, cmds ...api.Cmd) {
 	for _, cmd := range cmds {
 		out.MutateAndWrite(ctx, api.CmdNoID, cmd)
@@ -1037,6 +1059,9 @@ func postImageData(ctx context.Context,
 	writeEach(ctx, out,
 		cb.Custom(func(ctx context.Context, s *api.GlobalState, b *builder.Builder) error {
 			b.Post(value.ObservedPointer(at.Address()), uint64(bufferSize), func(r binary.Reader, err error) {
+				// The post data may be decoded by several executions of a
+				// cached payload, so the captured size must not be modified.
+				bufferSize := bufferSize
 				var bytes []byte
 				if err == nil {
 					bytes = make([]byte, bufferSize)
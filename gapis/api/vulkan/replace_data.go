@@ -0,0 +1,426 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// ReplaceData implements the resolve.DataReplacer interface.
+// The data is added to the command as a read observation of the host mapping
+// of the memory bound to the buffer or linear image, as the replay copies the
+// mapped memory to the device memory at the submissions for host coherent
+// memory, and at the flushes of the mapped memory ranges otherwise. The
+// images with optimal tiling are uploaded through a staging buffer instead,
+// see replaceImageData.
+func (API) ReplaceData(
+	ctx context.Context,
+	after *path.Command,
+	handle, offset uint64,
+	data []byte,
+	edits api.ReplaceCallback,
+	r *path.ResolveConfig) (bool, error) {
+
+	gs, err := resolve.GlobalState(ctx, after.GlobalStateAfter(), r)
+	if err != nil {
+		return false, err
+	}
+	s := GetState(gs)
+
+	var mem DeviceMemoryObjectʳ
+	var memOffset, size uint64
+	if buf, ok := s.Buffers().Lookup(VkBuffer(handle)); ok {
+		mem, memOffset, size = buf.Memory(), uint64(buf.MemoryOffset()), uint64(buf.Info().Size())
+	} else if img, ok := s.Images().Lookup(VkImage(handle)); ok {
+		if img.Info().Tiling() != VkImageTiling_VK_IMAGE_TILING_LINEAR {
+			return true, replaceImageData(ctx, after, gs, img, offset, data, edits)
+		}
+		mem, memOffset, size = img.BoundMemory(), uint64(img.BoundMemoryOffset()), uint64(img.MemoryRequirements().Size())
+	} else {
+		return false, nil
+	}
+
+	if offset+uint64(len(data)) > size {
+		return true, fmt.Errorf("The data exceeds the %v bytes of 0x%x", size, handle)
+	}
+	if mem.IsNil() || mem.MappedLocation().Address() == 0 {
+		return true, fmt.Errorf("The memory of 0x%x must be mapped to replace its contents", handle)
+	}
+	start := memOffset + offset
+	mappedStart, mappedEnd := uint64(mem.MappedOffset()), uint64(mem.MappedOffset()+mem.MappedSize())
+	if start < mappedStart || start+uint64(len(data)) > mappedEnd {
+		return true, fmt.Errorf("The replaced range of 0x%x must be within the mapped memory", handle)
+	}
+
+	c, err := capture.ResolveFromPath(ctx, after.Capture)
+	if err != nil {
+		return true, err
+	}
+	idx := after.Indices[0]
+	old := c.Commands[idx]
+	cb := CommandBuilder{Thread: old.Thread(), Arena: c.Arena} // TODO: We probably should have a new arena passed in here!
+
+	var newCmd api.Cmd
+	switch cmd := old.(type) {
+	case *VkQueueSubmit:
+		coherent, _ := subIsMemoryCoherent(ctx, cmd, api.CmdID(idx), nil, gs, s, cmd.Thread(), nil, nil, mem)
+		if !coherent {
+			return true, fmt.Errorf("The memory of 0x%x is not host coherent, its contents can only be replaced at a vkFlushMappedMemoryRanges", handle)
+		}
+		newCmd = cb.VkQueueSubmit(cmd.Queue(), cmd.SubmitCount(), cmd.PSubmits(), cmd.Fence(), cmd.Result())
+	case *VkFlushMappedMemoryRanges:
+		newCmd = cb.VkFlushMappedMemoryRanges(cmd.Device(), cmd.MemoryRangeCount(), cmd.PMemoryRanges(), cmd.Result())
+	default:
+		return true, fmt.Errorf("The contents can only be replaced at a vkQueueSubmit or a vkFlushMappedMemoryRanges, got %v", old.CmdName())
+	}
+
+	dataID, err := database.Store(ctx, data)
+	if err != nil {
+		return true, err
+	}
+
+	// Carry all non-observation extras through.
+	for _, e := range old.Extras().All() {
+		if _, ok := e.(*api.CmdObservations); !ok {
+			newCmd.Extras().Add(e)
+		}
+	}
+
+	// The new data is read after the original observations, so that it
+	// overrides them.
+	observations := newCmd.Extras().GetOrAppendObservations()
+	for _, o := range old.Extras().Observations().Reads {
+		observations.AddRead(o.Range, o.ID)
+	}
+	addr := mem.MappedLocation().Address() + start - mappedStart
+	observations.AddRead(memory.Range{Base: addr, Size: uint64(len(data))}, dataID)
+	for _, o := range old.Extras().Observations().Writes {
+		observations.AddWrite(o.Range, o.ID)
+	}
+
+	edits(idx, newCmd)
+	return true, nil
+}
+
+// replaceImageData replaces the contents of the first mip level of the first
+// array layer of the color image img with data, by inserting the commands
+// which copy the data from a staging buffer to the image after the command
+// after. The data must cover the whole level, as the layout of the images
+// with optimal tiling is opaque.
+func replaceImageData(
+	ctx context.Context,
+	after *path.Command,
+	gs *api.GlobalState,
+	img ImageObjectʳ,
+	offset uint64,
+	data []byte,
+	edits api.ReplaceCallback) error {
+
+	s := GetState(gs)
+	handle := img.VulkanHandle()
+
+	aspect, ok := img.Aspects().Lookup(VkImageAspectFlagBits_VK_IMAGE_ASPECT_COLOR_BIT)
+	if !ok {
+		return fmt.Errorf("Only the contents of the color images can be replaced, 0x%x has no color aspect", handle)
+	}
+	layer, ok := aspect.Layers().Lookup(0)
+	if !ok {
+		return fmt.Errorf("The first array layer of 0x%x is missing", handle)
+	}
+	level, ok := layer.Levels().Lookup(0)
+	if !ok {
+		return fmt.Errorf("The first mip level of 0x%x is missing", handle)
+	}
+	size := level.Data().Size()
+	if offset != 0 || uint64(len(data)) != size {
+		return fmt.Errorf("The data must replace the whole %v bytes of the first mip level of 0x%x", size, handle)
+	}
+	queue := level.LastBoundQueue()
+	if queue.IsNil() {
+		return fmt.Errorf("The image 0x%x has not been used on a queue", handle)
+	}
+
+	vkDevice := queue.Device()
+	vkQueue := queue.VulkanHandle()
+	physicalDevice := s.PhysicalDevices().Get(s.Devices().Get(vkDevice).PhysicalDevice())
+	memoryTypeIndex, found := uint32(0), false
+	for i := uint32(0); i < physicalDevice.MemoryProperties().MemoryTypeCount(); i++ {
+		t := physicalDevice.MemoryProperties().MemoryTypes().Get(int(i))
+		if 0 != (t.PropertyFlags() & VkMemoryPropertyFlags(VkMemoryPropertyFlagBits_VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT)) {
+			memoryTypeIndex, found = i, true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("The device of 0x%x has no host visible memory", handle)
+	}
+
+	c, err := capture.ResolveFromPath(ctx, after.Capture)
+	if err != nil {
+		return err
+	}
+	idx := after.Indices[0]
+	old := c.Commands[idx]
+	a := c.Arena // TODO: We probably should have a new arena passed in here!
+	cb := CommandBuilder{Thread: old.Thread(), Arena: a}
+
+	dataID, err := database.Store(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	// The staging data is allocated in the state after the edited command,
+	// so it does not overlap the memory observed by the capture.
+	alloc := func(v ...interface{}) api.AllocResult {
+		return gs.AllocDataOrPanic(ctx, v...)
+	}
+
+	bufferID := VkBuffer(newUnusedID(false, func(x uint64) bool { return s.Buffers().Contains(VkBuffer(x)) }))
+	memoryID := VkDeviceMemory(newUnusedID(false, func(x uint64) bool { return s.DeviceMemories().Contains(VkDeviceMemory(x)) }))
+	commandPoolID := VkCommandPool(newUnusedID(false, func(x uint64) bool { return s.CommandPools().Contains(VkCommandPool(x)) }))
+	commandBufferID := VkCommandBuffer(newUnusedID(true, func(x uint64) bool { return s.CommandBuffers().Contains(VkCommandBuffer(x)) }))
+
+	bufferCreateInfoData := alloc(NewVkBufferCreateInfo(a,
+		VkStructureType_VK_STRUCTURE_TYPE_BUFFER_CREATE_INFO, // sType
+		NewVoidᶜᵖ(memory.Nullptr),                            // pNext
+		VkBufferCreateFlags(0),                               // flags
+		VkDeviceSize(size),                                   // size
+		VkBufferUsageFlags(VkBufferUsageFlagBits_VK_BUFFER_USAGE_TRANSFER_SRC_BIT), // usage
+		VkSharingMode_VK_SHARING_MODE_EXCLUSIVE,                                    // sharingMode
+		0,                                                                          // queueFamilyIndexCount
+		NewU32ᶜᵖ(memory.Nullptr),                                                   // pQueueFamilyIndices
+	))
+	bufferData := alloc(bufferID)
+	memoryAllocateInfoData := alloc(NewVkMemoryAllocateInfo(a,
+		VkStructureType_VK_STRUCTURE_TYPE_MEMORY_ALLOCATE_INFO, // sType
+		0,                    // pNext
+		VkDeviceSize(size*2), // allocationSize
+		memoryTypeIndex,      // memoryTypeIndex
+	))
+	memoryData := alloc(memoryID)
+	mapped, err := gs.Alloc(ctx, size)
+	if err != nil {
+		return err
+	}
+	mappedPointerData := alloc(mapped.Address())
+	mappedMemoryRangeData := alloc(NewVkMappedMemoryRange(a,
+		VkStructureType_VK_STRUCTURE_TYPE_MAPPED_MEMORY_RANGE, // sType
+		0,                                // pNext
+		memoryID,                         // memory
+		VkDeviceSize(0),                  // offset
+		VkDeviceSize(0xFFFFFFFFFFFFFFFF), // size
+	))
+
+	commandPoolCreateInfoData := alloc(NewVkCommandPoolCreateInfo(a,
+		VkStructureType_VK_STRUCTURE_TYPE_COMMAND_POOL_CREATE_INFO,                                 // sType
+		NewVoidᶜᵖ(memory.Nullptr),                                                                  // pNext
+		VkCommandPoolCreateFlags(VkCommandPoolCreateFlagBits_VK_COMMAND_POOL_CREATE_TRANSIENT_BIT), // flags
+		queue.Family(), // queueFamilyIndex
+	))
+	commandPoolData := alloc(commandPoolID)
+	commandBufferAllocateInfoData := alloc(NewVkCommandBufferAllocateInfo(a,
+		VkStructureType_VK_STRUCTURE_TYPE_COMMAND_BUFFER_ALLOCATE_INFO, // sType
+		NewVoidᶜᵖ(memory.Nullptr),                                      // pNext
+		commandPoolID,                                                  // commandPool
+		VkCommandBufferLevel_VK_COMMAND_BUFFER_LEVEL_PRIMARY,           // level
+		1, // commandBufferCount
+	))
+	commandBufferData := alloc(commandBufferID)
+	beginInfoData := alloc(NewVkCommandBufferBeginInfo(a,
+		VkStructureType_VK_STRUCTURE_TYPE_COMMAND_BUFFER_BEGIN_INFO, // sType
+		0, // pNext
+		VkCommandBufferUsageFlags(VkCommandBufferUsageFlagBits_VK_COMMAND_BUFFER_USAGE_ONE_TIME_SUBMIT_BIT), // flags
+		0, // pInheritanceInfo
+	))
+
+	// The image is transitioned to the transfer destination layout for the
+	// copy, and back to its layout at the edited command afterwards. An
+	// undefined layout cannot be transitioned back to, so the image is then
+	// left in the transfer destination layout.
+	layout := level.Layout()
+	finalLayout := layout
+	if layout == VkImageLayout_VK_IMAGE_LAYOUT_UNDEFINED {
+		finalLayout = VkImageLayout_VK_IMAGE_LAYOUT_TRANSFER_DST_OPTIMAL
+	}
+	subresourceRange := NewVkImageSubresourceRange(a,
+		VkImageAspectFlags(VkImageAspectFlagBits_VK_IMAGE_ASPECT_COLOR_BIT), // aspectMask
+		0, // baseMipLevel
+		1, // levelCount
+		0, // baseArrayLayer
+		1, // layerCount
+	)
+	allAccesses := VkAccessFlags(VkAccessFlagBits_VK_ACCESS_MEMORY_READ_BIT | VkAccessFlagBits_VK_ACCESS_MEMORY_WRITE_BIT)
+	toDstBarrierData := alloc(NewVkImageMemoryBarrier(a,
+		VkStructureType_VK_STRUCTURE_TYPE_IMAGE_MEMORY_BARRIER, // sType
+		0,           // pNext
+		allAccesses, // srcAccessMask
+		VkAccessFlags(VkAccessFlagBits_VK_ACCESS_TRANSFER_WRITE_BIT), // dstAccessMask
+		layout, // oldLayout
+		VkImageLayout_VK_IMAGE_LAYOUT_TRANSFER_DST_OPTIMAL, // newLayout
+		0xFFFFFFFF,       // srcQueueFamilyIndex
+		0xFFFFFFFF,       // dstQueueFamilyIndex
+		handle,           // image
+		subresourceRange, // subresourceRange
+	))
+	toFinalBarrierData := alloc(NewVkImageMemoryBarrier(a,
+		VkStructureType_VK_STRUCTURE_TYPE_IMAGE_MEMORY_BARRIER, // sType
+		0, // pNext
+		VkAccessFlags(VkAccessFlagBits_VK_ACCESS_TRANSFER_WRITE_BIT), // srcAccessMask
+		allAccesses, // dstAccessMask
+		VkImageLayout_VK_IMAGE_LAYOUT_TRANSFER_DST_OPTIMAL, // oldLayout
+		finalLayout,      // newLayout
+		0xFFFFFFFF,       // srcQueueFamilyIndex
+		0xFFFFFFFF,       // dstQueueFamilyIndex
+		handle,           // image
+		subresourceRange, // subresourceRange
+	))
+	bufferImageCopyData := alloc(NewVkBufferImageCopy(a,
+		0, // bufferOffset
+		0, // bufferRowLength
+		0, // bufferImageHeight
+		NewVkImageSubresourceLayers(a, // imageSubresource
+			VkImageAspectFlags(VkImageAspectFlagBits_VK_IMAGE_ASPECT_COLOR_BIT), // aspectMask
+			0, // mipLevel
+			0, // baseArrayLayer
+			1, // layerCount
+		),
+		MakeVkOffset3D(a), // imageOffset
+		NewVkExtent3D(a, level.Width(), level.Height(), level.Depth()), // imageExtent
+	))
+	commandBuffersData := alloc(commandBufferID)
+	submitInfoData := alloc(NewVkSubmitInfo(a,
+		VkStructureType_VK_STRUCTURE_TYPE_SUBMIT_INFO, // sType
+		0, // pNext
+		0, // waitSemaphoreCount
+		0, // pWaitSemaphores
+		0, // pWaitDstStageMask
+		1, // commandBufferCount
+		NewVkCommandBufferᶜᵖ(commandBuffersData.Ptr()), // pCommandBuffers
+		0, // signalSemaphoreCount
+		0, // pSignalSemaphores
+	))
+
+	allStages := VkPipelineStageFlags(VkPipelineStageFlagBits_VK_PIPELINE_STAGE_ALL_COMMANDS_BIT)
+	cmds := []api.Cmd{
+		old,
+		// Create the staging buffer, and fill it with the data.
+		cb.VkCreateBuffer(
+			vkDevice,
+			bufferCreateInfoData.Ptr(),
+			memory.Nullptr,
+			bufferData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(bufferCreateInfoData.Data()).AddWrite(bufferData.Data()),
+		cb.VkAllocateMemory(
+			vkDevice,
+			memoryAllocateInfoData.Ptr(),
+			memory.Nullptr,
+			memoryData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(memoryAllocateInfoData.Data()).AddWrite(memoryData.Data()),
+		cb.VkBindBufferMemory(vkDevice, bufferID, memoryID, VkDeviceSize(0), VkResult_VK_SUCCESS),
+		cb.VkMapMemory(
+			vkDevice,
+			memoryID,
+			VkDeviceSize(0),
+			VkDeviceSize(size),
+			VkMemoryMapFlags(0),
+			mappedPointerData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddWrite(mappedPointerData.Data()),
+		cb.VkFlushMappedMemoryRanges(
+			vkDevice,
+			1,
+			mappedMemoryRangeData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(mappedMemoryRangeData.Data()).AddRead(mapped.Range(), dataID),
+		// Record and submit the copy to the image.
+		cb.VkCreateCommandPool(
+			vkDevice,
+			commandPoolCreateInfoData.Ptr(),
+			memory.Nullptr,
+			commandPoolData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(commandPoolCreateInfoData.Data()).AddWrite(commandPoolData.Data()),
+		cb.VkAllocateCommandBuffers(
+			vkDevice,
+			commandBufferAllocateInfoData.Ptr(),
+			commandBufferData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(commandBufferAllocateInfoData.Data()).AddWrite(commandBufferData.Data()),
+		cb.VkBeginCommandBuffer(
+			commandBufferID,
+			beginInfoData.Ptr(),
+			VkResult_VK_SUCCESS,
+		).AddRead(beginInfoData.Data()),
+		cb.VkCmdPipelineBarrier(
+			commandBufferID,
+			allStages,
+			allStages,
+			VkDependencyFlags(0),
+			0,
+			memory.Nullptr,
+			0,
+			memory.Nullptr,
+			1,
+			toDstBarrierData.Ptr(),
+		).AddRead(toDstBarrierData.Data()),
+		cb.VkCmdCopyBufferToImage(
+			commandBufferID,
+			bufferID,
+			handle,
+			VkImageLayout_VK_IMAGE_LAYOUT_TRANSFER_DST_OPTIMAL,
+			1,
+			bufferImageCopyData.Ptr(),
+		).AddRead(bufferImageCopyData.Data()),
+		cb.VkCmdPipelineBarrier(
+			commandBufferID,
+			allStages,
+			allStages,
+			VkDependencyFlags(0),
+			0,
+			memory.Nullptr,
+			0,
+			memory.Nullptr,
+			1,
+			toFinalBarrierData.Ptr(),
+		).AddRead(toFinalBarrierData.Data()),
+		cb.VkEndCommandBuffer(commandBufferID, VkResult_VK_SUCCESS),
+		cb.VkQueueSubmit(
+			vkQueue,
+			1,
+			submitInfoData.Ptr(),
+			VkFence(0),
+			VkResult_VK_SUCCESS,
+		).AddRead(submitInfoData.Data()).AddRead(commandBuffersData.Data()),
+		cb.VkQueueWaitIdle(vkQueue, VkResult_VK_SUCCESS),
+		// Release the staging resources.
+		cb.VkDestroyCommandPool(vkDevice, commandPoolID, memory.Nullptr),
+		cb.VkUnmapMemory(vkDevice, memoryID),
+		cb.VkDestroyBuffer(vkDevice, bufferID, memory.Nullptr),
+		cb.VkFreeMemory(vkDevice, memoryID, memory.Nullptr),
+	}
+
+	edits(idx, cmds)
+	return nil
+}
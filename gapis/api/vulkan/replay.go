@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/google/gapid/core/data/id"
 	"github.com/google/gapid/core/image"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/os/device"
@@ -39,8 +40,12 @@ var (
 	// Interface compliance tests
 	_ = replay.QueryIssues(API{})
 	_ = replay.QueryFramebufferAttachment(API{})
+	_ = replay.QueryOverdraw(API{})
+	_ = replay.QueryPipelineStatistics(API{})
+	_ = replay.QueryDispatchBuffers(API{})
 	_ = replay.Support(API{})
 	_ = replay.QueryTimestamps(API{})
+	_ = replay.QueryCommandTimings(API{})
 )
 
 // GetReplayPriority returns a uint32 representing the preference for
@@ -95,8 +100,9 @@ func (a API) GetReplayPriority(ctx context.Context, i *device.Instance, h *captu
 }
 
 // makeAttachementReadable is a transformation marking all color/depth/stencil
-// attachment images created via vkCreateImage commands as readable (by patching
-// the transfer src bit).
+// attachment images created via vkCreateImage commands, and all indirect draw
+// buffers created via vkCreateBuffer commands, as readable (by patching the
+// transfer src bit).
 type makeAttachementReadable struct{}
 
 // drawConfig is a replay.Config used by colorBufferRequest and
@@ -109,9 +115,11 @@ type drawConfig struct {
 	disableReplayOptimization bool
 }
 
-type imgRes struct {
-	img *image.Data // The image data.
-	err error       // The error that occurred generating the image.
+// payloadKey returns the fields of the config, to be hashed in the payload keys
+// of the requests.
+func (c drawConfig) payloadKey() string {
+	return fmt.Sprintf("%d %d %q %d %t", c.startScope, c.endScope, c.subindices,
+		c.drawMode, c.disableReplayOptimization)
 }
 
 // framebufferRequest requests a postback of a framebuffer's attachment.
@@ -120,11 +128,48 @@ type framebufferRequest struct {
 	width, height    uint32
 	attachment       api.FramebufferAttachment
 	framebufferIndex uint32
-	out              chan imgRes
 	wireframeOverlay bool
 	displayToSurface bool
 }
 
+// PayloadKey implements the replay.CacheableRequest interface. The postbacks
+// of the overdraw counts are decoded by the overdraw transform, shared by the
+// requests of the replay, so they are not cacheable.
+func (r framebufferRequest) PayloadKey(cfg replay.Config) (id.ID, bool) {
+	c, ok := cfg.(drawConfig)
+	if !ok || c.drawMode == service.DrawMode_OVERDRAW {
+		return id.ID{}, false
+	}
+	return id.OfString("framebufferRequest", c.payloadKey(),
+		fmt.Sprintf("%v %d %d %d %d %t %t", r.after, r.width, r.height, r.attachment,
+			r.framebufferIndex, r.wireframeOverlay, r.displayToSurface)), true
+}
+
+// overdrawRequest requests a postback of the overdraw counts of the draws in
+// the given range of commands, in the last render pass of the range.
+type overdrawRequest struct {
+	first []uint64
+	after []uint64
+}
+
+// bufferDataRequest requests a postback of a range of a buffer.
+type bufferDataRequest struct {
+	after  []uint64
+	buffer VkBuffer
+	offset uint64
+	size   uint64
+}
+
+// PayloadKey implements the replay.CacheableRequest interface.
+func (r bufferDataRequest) PayloadKey(cfg replay.Config) (id.ID, bool) {
+	c, ok := cfg.(drawConfig)
+	if !ok {
+		return id.ID{}, false
+	}
+	return id.OfString("bufferDataRequest", c.payloadKey(),
+		fmt.Sprintf("%v %d %d %d", r.after, r.buffer, r.offset, r.size)), true
+}
+
 type deadCodeEliminationInfo struct {
 	dependencyGraph     *dependencygraph.DependencyGraph
 	deadCodeElimination *dependencygraph.DeadCodeElimination
@@ -149,6 +194,20 @@ func patchImageUsage(usage VkImageUsageFlags) (VkImageUsageFlags, bool) {
 	return usage, false
 }
 
+// patchBufferUsage returns the buffer usage with the transfer src bit set if
+// the buffer can be used for indirect draws or as a storage buffer, so that
+// the draw parameters and the storage buffers of the dispatches can be read
+// back.
+func patchBufferUsage(usage VkBufferUsageFlags) (VkBufferUsageFlags, bool) {
+	readable := VkBufferUsageFlags(VkBufferUsageFlagBits_VK_BUFFER_USAGE_INDIRECT_BUFFER_BIT |
+		VkBufferUsageFlagBits_VK_BUFFER_USAGE_STORAGE_BUFFER_BIT)
+	transferSrc := VkBufferUsageFlags(VkBufferUsageFlagBits_VK_BUFFER_USAGE_TRANSFER_SRC_BIT)
+	if usage&readable != 0 && usage&transferSrc == 0 {
+		return usage | transferSrc, true
+	}
+	return usage, false
+}
+
 func (t *makeAttachementReadable) Transform(ctx context.Context, id api.CmdID, cmd api.Cmd, out transform.Writer) {
 	s := out.State()
 	l := s.MemoryLayout
@@ -191,6 +250,35 @@ func (t *makeAttachementReadable) Transform(ctx context.Context, id api.CmdID, c
 			out.MutateAndWrite(ctx, id, newCmd)
 			return
 		}
+	} else if buffer, ok := cmd.(*VkCreateBuffer); ok {
+		pinfo := buffer.PCreateInfo()
+		info := pinfo.MustRead(ctx, buffer, s, nil)
+
+		if newUsage, changed := patchBufferUsage(info.Usage()); changed {
+			device := buffer.Device()
+			palloc := memory.Pointer(buffer.PAllocator())
+			pbuffer := memory.Pointer(buffer.PBuffer())
+			result := buffer.Result()
+
+			info.SetUsage(newUsage)
+			newInfo := s.AllocDataOrPanic(ctx, info)
+			newCmd := cb.VkCreateBuffer(device, newInfo.Ptr(), palloc, pbuffer, result)
+			for _, e := range buffer.Extras().All() {
+				if _, ok := e.(*api.CmdObservations); !ok {
+					newCmd.Extras().Add(e)
+				}
+			}
+			observations := buffer.Extras().Observations()
+			for _, r := range observations.Reads {
+				newCmd.AddRead(r.Range, r.ID)
+			}
+			newCmd.AddRead(newInfo.Data())
+			for _, w := range observations.Writes {
+				newCmd.AddWrite(w.Range, w.ID)
+			}
+			out.MutateAndWrite(ctx, id, newCmd)
+			return
+		}
 	} else if swapchain, ok := cmd.(*VkCreateSwapchainKHR); ok {
 		pinfo := swapchain.PCreateInfo()
 		info := pinfo.MustRead(ctx, swapchain, s, nil)
@@ -263,6 +351,47 @@ func (t *makeAttachementReadable) Transform(ctx context.Context, id api.CmdID, c
 		}
 		out.MutateAndWrite(ctx, id, newCmd)
 		return
+	} else if createRenderPass, ok := cmd.(*VkCreateRenderPass2); ok {
+		pInfo := createRenderPass.PCreateInfo()
+		info := pInfo.MustRead(ctx, createRenderPass, s, nil)
+		pAttachments := info.PAttachments()
+		attachments := pAttachments.Slice(0, uint64(info.AttachmentCount()), l).MustRead(ctx, createRenderPass, s, nil)
+		changed := false
+		for i := range attachments {
+			if attachments[i].StoreOp() == VkAttachmentStoreOp_VK_ATTACHMENT_STORE_OP_DONT_CARE {
+				changed = true
+				attachments[i].SetStoreOp(VkAttachmentStoreOp_VK_ATTACHMENT_STORE_OP_STORE)
+			}
+		}
+		// Returns if no attachment description needs to be changed
+		if !changed {
+			out.MutateAndWrite(ctx, id, cmd)
+			return
+		}
+		// Build new attachments data, new create info and new command
+		newAttachments := s.AllocDataOrPanic(ctx, attachments)
+		info.SetPAttachments(NewVkAttachmentDescription2ᶜᵖ(newAttachments.Ptr()))
+		newInfo := s.AllocDataOrPanic(ctx, info)
+		newCmd := cb.VkCreateRenderPass2(createRenderPass.Device(),
+			newInfo.Ptr(),
+			memory.Pointer(createRenderPass.PAllocator()),
+			memory.Pointer(createRenderPass.PRenderPass()),
+			createRenderPass.Result())
+		// Add back the extras and read/write observations
+		for _, e := range createRenderPass.Extras().All() {
+			if _, ok := e.(*api.CmdObservations); !ok {
+				newCmd.Extras().Add(e)
+			}
+		}
+		for _, r := range createRenderPass.Extras().Observations().Reads {
+			newCmd.AddRead(r.Range, r.ID)
+		}
+		newCmd.AddRead(newInfo.Data()).AddRead(newAttachments.Data())
+		for _, w := range createRenderPass.Extras().Observations().Writes {
+			newCmd.AddWrite(w.Range, w.ID)
+		}
+		out.MutateAndWrite(ctx, id, newCmd)
+		return
 	} else if e, ok := cmd.(*VkEnumeratePhysicalDevices); ok {
 		if e.PPhysicalDevices() == 0 {
 			// Querying for the number of devices.
@@ -513,6 +642,11 @@ func (t *dropInvalidDestroy) Transform(ctx context.Context, id api.CmdID, cmd ap
 			warnDropCmd(cmd.Callback())
 			return
 		}
+	case *VkDestroyDebugUtilsMessengerEXT:
+		if !GetState(s).DebugUtilsMessengers().Contains(cmd.Messenger()) {
+			warnDropCmd(cmd.Messenger())
+			return
+		}
 	}
 	out.MutateAndWrite(ctx, id, cmd)
 	return
@@ -647,6 +781,11 @@ func (t *destroyResourcesAtEOS) Flush(ctx context.Context, out transform.Writer)
 		out.MutateAndWrite(ctx, id, cb.VkDestroyDebugReportCallbackEXT(object.Instance(), handle, p))
 	}
 
+	// Debug utils messengers
+	for handle, object := range so.DebugUtilsMessengers().All() {
+		out.MutateAndWrite(ctx, id, cb.VkDestroyDebugUtilsMessengerEXT(object.Instance(), handle, p))
+	}
+
 	// Instances.
 	for handle := range so.Instances().All() {
 		out.MutateAndWrite(ctx, id, cb.VkDestroyInstance(handle, p))
@@ -713,11 +852,22 @@ type issuesRequest struct {
 }
 
 type timestampsConfig struct {
+	renderPasses bool
+	draws        bool
 }
 
 type timestampsRequest struct {
 }
 
+// pipelineStatisticsConfig is a replay.Config used by
+// pipelineStatisticsRequests.
+type pipelineStatisticsConfig struct {
+}
+
+// dispatchBuffersConfig is a replay.Config used by dispatchBuffersRequests.
+type dispatchBuffersConfig struct {
+}
+
 func (a API) Replay(
 	ctx context.Context,
 	intent replay.Intent,
@@ -745,6 +895,8 @@ func (a API) Replay(
 
 	var timestamps *queryTimestamps
 
+	var timings *commandTimings
+
 	earlyTerminator, err := NewVulkanTerminator(ctx, intent.Capture)
 	if err != nil {
 		return err
@@ -807,9 +959,30 @@ func (a API) Replay(
 		return numInitialCmdWithoutOpt, nil
 	}
 
+	// requestSubcommandAlive makes the dead code elimination keep the command
+	// or subcommand of the given full command index, and the commands it
+	// transitively depends on, so that the replay only contains the commands
+	// needed for the requests. The behaviors of the subcommands are rolled out
+	// after the behavior of their submission, so subcommands must be requested
+	// with their full index.
+	requestSubcommandAlive := func(fci api.SubCmdIdx) {
+		if config.NewDeadCodeElimination {
+			// The subcommand nodes are merged into their submission.
+			dceInfo.newDce.Request(ctx, api.SubCmdIdx{fci[0]})
+		} else {
+			dceInfo.dce.Request(ctx, fci)
+		}
+	}
+	// requestAlive is the same as requestSubcommandAlive, for a command.
+	requestAlive := func(cmdid uint64) {
+		requestSubcommandAlive(api.SubCmdIdx{cmdid})
+	}
+
 	wire := false
 	doDisplayToSurface := false
 	var overdraw *stencilOverdraw
+	var statistics *pipelineStatistics
+	var storageBuffers *dispatchBuffers
 
 	for _, rr := range rrs {
 		switch req := rr.Request.(type) {
@@ -819,7 +992,7 @@ func (a API) Replay(
 				if err != nil {
 					return err
 				}
-				issues = newFindIssues(ctx, c, n)
+				issues = newFindIssues(ctx, c, n, replayValidationLayers(device))
 			}
 			issues.reportTo(rr.Result)
 			optimize = false
@@ -832,10 +1005,104 @@ func (a API) Replay(
 				if err != nil {
 					return err
 				}
-				timestamps = newQueryTimestamps(ctx, c, n)
+				cfg := cfg.(timestampsConfig)
+				timestamps = newQueryTimestamps(ctx, c, n, cfg.renderPasses, cfg.draws)
 			}
 			timestamps.reportTo(rr.Result)
 			optimize = false
+		case commandTimingsRequest:
+			if timings == nil {
+				n, err := expandCommands(false)
+				if err != nil {
+					return err
+				}
+				timings = newCommandTimings(n, len(c.Commands))
+			}
+			timings.reportTo(rr.Result)
+			optimize = false
+		case pipelineStatisticsRequest:
+			// The draws themselves are requested, so the dead code elimination
+			// keeps them and the commands they depend on.
+			extraCommands, err := expandCommands(optimize)
+			if err != nil {
+				return err
+			}
+			if statistics == nil {
+				statistics = newPipelineStatistics()
+			}
+			if !statistics.add(ctx, uint64(extraCommands), req.draws, rr.Result) {
+				continue
+			}
+			for _, draw := range req.draws {
+				cmdid := draw[0] + uint64(extraCommands)
+				if err := earlyTerminator.Add(ctx, extraCommands, api.CmdID(cmdid), nil); err != nil {
+					return err
+				}
+				if optimize {
+					requestSubcommandAlive(append(api.SubCmdIdx{cmdid}, draw[1:]...))
+				}
+			}
+		case dispatchBuffersRequest:
+			// The dispatch itself is requested, so the dead code elimination
+			// keeps it and the commands it depends on.
+			extraCommands, err := expandCommands(optimize)
+			if err != nil {
+				return err
+			}
+			if storageBuffers == nil {
+				storageBuffers = newDispatchBuffers()
+			}
+			if !storageBuffers.add(ctx, uint64(extraCommands), req, rr.Result) {
+				continue
+			}
+			cmdid := req.dispatch[0] + uint64(extraCommands)
+			if err := earlyTerminator.Add(ctx, extraCommands, api.CmdID(cmdid), nil); err != nil {
+				return err
+			}
+			if optimize {
+				requestSubcommandAlive(append(api.SubCmdIdx{cmdid}, req.dispatch[1:]...))
+			}
+		case bufferDataRequest:
+			cfg := cfg.(drawConfig)
+			if cfg.disableReplayOptimization {
+				optimize = false
+			}
+			extraCommands, err := expandCommands(optimize)
+			if err != nil {
+				return err
+			}
+			cmdid := req.after[0] + uint64(extraCommands)
+			if err := earlyTerminator.Add(ctx, extraCommands, api.CmdID(cmdid), req.after[1:]); err != nil {
+				return err
+			}
+			after := api.CmdID(cmdid)
+			if len(req.after) > 1 {
+				after = earlyTerminator.lastRequest
+			}
+			if optimize {
+				requestAlive(cmdid)
+			}
+			readFramebuffer.Buffer(after, req.buffer, req.offset, req.size, rr.Result)
+		case overdrawRequest:
+			cfg := cfg.(drawConfig)
+			if cfg.disableReplayOptimization {
+				optimize = false
+			}
+			extraCommands, err := expandCommands(optimize)
+			if err != nil {
+				return err
+			}
+			cmdid := req.after[0] + uint64(extraCommands)
+			if err := earlyTerminator.Add(ctx, extraCommands, api.CmdID(cmdid), req.after[1:]); err != nil {
+				return err
+			}
+			if optimize {
+				requestAlive(cmdid)
+			}
+			if overdraw == nil {
+				overdraw = newStencilOverdraw()
+			}
+			overdraw.add(ctx, uint64(extraCommands), req.first, req.after, intent.Capture, rr.Result)
 		case framebufferRequest:
 
 			cfg := cfg.(drawConfig)
@@ -861,11 +1128,7 @@ func (a API) Replay(
 			}
 
 			if optimize {
-				if config.NewDeadCodeElimination {
-					dceInfo.newDce.Request(ctx, api.SubCmdIdx{cmdid})
-				} else {
-					dceInfo.dce.Request(ctx, api.SubCmdIdx{cmdid})
-				}
+				requestAlive(cmdid)
 			}
 
 			switch cfg.drawMode {
@@ -877,7 +1140,7 @@ func (a API) Replay(
 				if overdraw == nil {
 					overdraw = newStencilOverdraw()
 				}
-				overdraw.add(ctx, uint64(extraCommands), req.after, intent.Capture, rr.Result)
+				overdraw.add(ctx, uint64(extraCommands), nil, req.after, intent.Capture, rr.Result)
 			}
 
 			if cfg.drawMode != service.DrawMode_OVERDRAW {
@@ -923,16 +1186,29 @@ func (a API) Replay(
 	} else {
 		if timestamps != nil {
 			transforms.Add(timestamps)
-		} else {
+		} else if timings == nil {
+			// The timings are measured over the whole capture.
 			transforms.Add(earlyTerminator)
 		}
 
 	}
 
+	if timings != nil {
+		transforms.Add(timings)
+	}
+
 	if overdraw != nil {
 		transforms.Add(overdraw)
 	}
 
+	if statistics != nil {
+		transforms.Add(statistics)
+	}
+
+	if storageBuffers != nil {
+		transforms.Add(storageBuffers)
+	}
+
 	if issues == nil {
 		transforms.Add(readFramebuffer, injector)
 	}
@@ -974,22 +1250,14 @@ func (a API) Replay(
 	return nil
 }
 
-func (a API) QueryFramebufferAttachment(
-	ctx context.Context,
-	intent replay.Intent,
-	mgr replay.Manager,
-	after []uint64,
-	width, height uint32,
-	attachment api.FramebufferAttachment,
-	framebufferIndex uint32,
-	drawMode service.DrawMode,
-	disableReplayOptimization bool,
-	displayToSurface bool,
-	hints *service.UsageHints) (*image.Data, error) {
-
+// newDrawConfig returns the drawConfig to read back data after the given
+// command or subcommand. The replays of the reads after commands in the same
+// range of synchronized commands are batched.
+func newDrawConfig(ctx context.Context, intent replay.Intent, after []uint64,
+	drawMode service.DrawMode, disableReplayOptimization bool) (drawConfig, error) {
 	s, err := resolve.SyncData(ctx, intent.Capture)
 	if err != nil {
-		return nil, err
+		return drawConfig{}, err
 	}
 	beginIndex := api.CmdID(0)
 	endIndex := api.CmdID(0)
@@ -1009,6 +1277,11 @@ func (a API) QueryFramebufferAttachment(
 			}
 		}
 	} else { // If we are replaying subcommands, then we can't batch at all
+		// The submissions can only be cut at the commands of the primary
+		// command buffers, and of the secondary command buffers they execute.
+		if len(after) > 6 {
+			return drawConfig{}, fmt.Errorf("Reads after the subcommand %v are not currently supported", after)
+		}
 		beginIndex = api.CmdID(after[0])
 		endIndex = api.CmdID(after[0])
 		for i, j := range after[1:] {
@@ -1019,9 +1292,52 @@ func (a API) QueryFramebufferAttachment(
 		}
 	}
 
-	c := drawConfig{beginIndex, endIndex, subcommand, drawMode, disableReplayOptimization}
-	out := make(chan imgRes, 1)
-	r := framebufferRequest{after: after, width: width, height: height, framebufferIndex: framebufferIndex, attachment: attachment, out: out, displayToSurface: displayToSurface}
+	return drawConfig{beginIndex, endIndex, subcommand, drawMode, disableReplayOptimization}, nil
+}
+
+func (a API) QueryFramebufferAttachment(
+	ctx context.Context,
+	intent replay.Intent,
+	mgr replay.Manager,
+	after []uint64,
+	width, height uint32,
+	attachment api.FramebufferAttachment,
+	framebufferIndex uint32,
+	drawMode service.DrawMode,
+	disableReplayOptimization bool,
+	displayToSurface bool,
+	hints *service.UsageHints) (*image.Data, error) {
+
+	c, err := newDrawConfig(ctx, intent, after, drawMode, disableReplayOptimization)
+	if err != nil {
+		return nil, err
+	}
+	r := framebufferRequest{after: after, width: width, height: height, framebufferIndex: framebufferIndex, attachment: attachment, displayToSurface: displayToSurface}
+	res, err := mgr.Replay(ctx, intent, c, r, a, hints)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := mgr.(replay.Exporter); ok {
+		return nil, nil
+	}
+	return res.(*image.Data), nil
+}
+
+// QueryOverdraw returns the overdraw counts of the draws from the command
+// first to the command after, read back from the replay.
+func (a API) QueryOverdraw(
+	ctx context.Context,
+	intent replay.Intent,
+	mgr replay.Manager,
+	first, after []uint64,
+	disableReplayOptimization bool,
+	hints *service.UsageHints) (*image.Data, error) {
+
+	c, err := newDrawConfig(ctx, intent, after, service.DrawMode_OVERDRAW, disableReplayOptimization)
+	if err != nil {
+		return nil, err
+	}
+	r := overdrawRequest{first: first, after: after}
 	res, err := mgr.Replay(ctx, intent, c, r, a, hints)
 	if err != nil {
 		return nil, err
@@ -1032,6 +1348,32 @@ func (a API) QueryFramebufferAttachment(
 	return res.(*image.Data), nil
 }
 
+// QueryBufferData returns the content of the given range of the buffer
+// after the given command or subcommand, read back from the replay.
+func (a API) QueryBufferData(
+	ctx context.Context,
+	intent replay.Intent,
+	mgr replay.Manager,
+	after []uint64,
+	buffer VkBuffer,
+	offset, size uint64,
+	hints *service.UsageHints) ([]byte, error) {
+
+	c, err := newDrawConfig(ctx, intent, after, service.DrawMode_NORMAL, false)
+	if err != nil {
+		return nil, err
+	}
+	r := bufferDataRequest{after: after, buffer: buffer, offset: offset, size: size}
+	res, err := mgr.Replay(ctx, intent, c, r, a, hints)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := mgr.(replay.Exporter); ok {
+		return nil, nil
+	}
+	return res.([]byte), nil
+}
+
 func (a API) QueryIssues(
 	ctx context.Context,
 	intent replay.Intent,
@@ -1050,13 +1392,34 @@ func (a API) QueryIssues(
 	return res.([]replay.Issue), nil
 }
 
+// QueryPipelineStatistics returns the pipeline statistics of the draws,
+// queried during the replay.
+func (a API) QueryPipelineStatistics(
+	ctx context.Context,
+	intent replay.Intent,
+	mgr replay.Manager,
+	draws [][]uint64,
+	hints *service.UsageHints) ([]*service.DrawPipelineStatistics, error) {
+
+	c, r := pipelineStatisticsConfig{}, pipelineStatisticsRequest{draws: draws}
+	res, err := mgr.Replay(ctx, intent, c, r, a, hints)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := mgr.(replay.Exporter); ok {
+		return nil, nil
+	}
+	return res.([]*service.DrawPipelineStatistics), nil
+}
+
 func (a API) QueryTimestamps(
 	ctx context.Context,
 	intent replay.Intent,
 	mgr replay.Manager,
+	opts *service.TimestampsOptions,
 	hints *service.UsageHints) ([]replay.Timestamp, error) {
 
-	c, r := timestampsConfig{}, timestampsRequest{}
+	c, r := timestampsConfig{opts.GetRenderPasses(), opts.GetDraws()}, timestampsRequest{}
 	res, err := mgr.Replay(ctx, intent, c, r, a, hints)
 	if err != nil {
 		return nil, err
@@ -1066,3 +1429,20 @@ func (a API) QueryTimestamps(
 	}
 	return res.([]replay.Timestamp), nil
 }
+
+func (a API) QueryCommandTimings(
+	ctx context.Context,
+	intent replay.Intent,
+	mgr replay.Manager,
+	hints *service.UsageHints) ([]replay.CommandTiming, error) {
+
+	c, r := commandTimingsConfig{}, commandTimingsRequest{}
+	res, err := mgr.Replay(ctx, intent, c, r, a, hints)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := mgr.(replay.Exporter); ok {
+		return nil, nil
+	}
+	return res.([]replay.CommandTiming), nil
+}
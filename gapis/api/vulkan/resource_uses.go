@@ -0,0 +1,157 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/resolve/dependencygraph"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// resourceUse is a behavior of a command or subcommand that uses a resource.
+type resourceUse struct {
+	owner      api.SubCmdIdx
+	read       bool
+	write      bool
+	transition bool
+}
+
+// resourceUseRecorder records the commands and subcommands that read or
+// write the handles, the bound data or the image layouts of the buffers and
+// images, while the FootprintBuilder builds the footprint.
+type resourceUseRecorder struct {
+	// The data and layout labels of the resources, tagged by the
+	// FootprintBuilder when it looks them up, by the handles of the resources
+	// they belong to. The value is true for the layouts. The data of aliased
+	// resources belongs to all of them.
+	vars map[dependencygraph.DefUseVariable]map[uint64]bool
+	// The uses of each resource in the order the behaviors are built.
+	// Consecutive uses by the same command are merged.
+	uses map[uint64][]resourceUse
+}
+
+func newResourceUseRecorder() *resourceUseRecorder {
+	return &resourceUseRecorder{
+		vars: map[dependencygraph.DefUseVariable]map[uint64]bool{},
+		uses: map[uint64][]resourceUse{},
+	}
+}
+
+// tag marks the given data or layout labels as the ones of the resource
+// with the given handle. It is a no-op on a nil recorder.
+func (r *resourceUseRecorder) tag(handle uint64, layouts bool,
+	vs ...dependencygraph.DefUseVariable) {
+	if r == nil {
+		return
+	}
+	for _, v := range vs {
+		owners, ok := r.vars[v]
+		if !ok {
+			owners = map[uint64]bool{}
+			r.vars[v] = owners
+		}
+		owners[handle] = layouts
+	}
+}
+
+// access implements the footprintObserver interface. It records the read or
+// write of the variable by the behavior, if the variable is a handle or a
+// tagged label of a resource.
+func (r *resourceUseRecorder) access(bh *dependencygraph.Behavior, write bool,
+	c dependencygraph.DefUseVariable) {
+	if bh == nil {
+		return
+	}
+	if h, ok := c.(*vkHandle); ok {
+		r.use(bh, h.handle, write, false)
+		return
+	}
+	for handle, layout := range r.vars[c] {
+		r.use(bh, handle, write, layout)
+	}
+}
+
+func (r *resourceUseRecorder) use(bh *dependencygraph.Behavior, handle uint64,
+	write, layout bool) {
+	uses := r.uses[handle]
+	if n := len(uses); n == 0 || !uses[n-1].owner.Equals(bh.Owner) {
+		uses = append(uses, resourceUse{owner: bh.Owner})
+		r.uses[handle] = uses
+	}
+	u := &uses[len(uses)-1]
+	switch {
+	case layout && write:
+		u.transition = true
+	case write:
+		u.write = true
+	default:
+		u.read = true
+	}
+}
+
+// resourceUses returns the uses of the resource with the given handle by the
+// commands and subcommands of the capture, sorted by the command indices.
+// The uses by the commands that build the initial state are dropped.
+func (r *resourceUseRecorder) resourceUses(p *path.Capture, handle uint64, numInitialCmds int) []*service.ResourceUse {
+	uses := append([]resourceUse{}, r.uses[handle]...)
+	sort.SliceStable(uses, func(i, j int) bool { return commandFirst(uses[i].owner, uses[j].owner) })
+	out := []*service.ResourceUse{}
+	for i, u := range uses {
+		if len(u.owner) == 0 || u.owner[0] < uint64(numInitialCmds) {
+			continue
+		}
+		if i > 0 && uses[i-1].owner.Equals(u.owner) && len(out) > 0 {
+			last := out[len(out)-1]
+			last.Read = last.Read || u.read
+			last.Write = last.Write || u.write
+			last.Transition = last.Transition || u.transition
+			continue
+		}
+		out = append(out, &service.ResourceUse{
+			Command:    p.Command(u.owner[0]-uint64(numInitialCmds), u.owner[1:]...),
+			Read:       u.read,
+			Write:      u.write,
+			Transition: u.transition,
+		})
+	}
+	return out
+}
+
+// commandFirst returns true if a comes before b, where a command comes before
+// its subcommands.
+func commandFirst(a, b api.SubCmdIdx) bool {
+	for i := range a {
+		if i >= len(b) || a[i] != b[i] {
+			return i < len(b) && a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// ResolveResourceUses implements the resolve.ResourceUsesResolver interface.
+// It returns the commands and subcommands of the given capture that read,
+// write or transition the layout of the buffer or image with the given
+// handle, from the analysis of the capture.
+func (API) ResolveResourceUses(ctx context.Context, p *path.Capture, handle uint64) ([]*service.ResourceUse, error) {
+	a, err := analyzeCapture(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return a.resourceUses.resourceUses(p, handle, a.numInitialCmds), nil
+}
@@ -16,6 +16,7 @@ package vulkan
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
 	"sort"
 
@@ -354,13 +355,13 @@ func getImageFormatFromVulkanFormat(vkfmt VkFormat) (*image.Format, error) {
 	case VkFormat_VK_FORMAT_BC5_SNORM_BLOCK:
 		return image.NewRGTC2_BC5_RG_S8_NORM("VK_FORMAT_BC5_SNORM_BLOCK"), nil
 	case VkFormat_VK_FORMAT_BC6H_UFLOAT_BLOCK:
-		return nil, &unsupportedVulkanFormatError{Format: vkfmt}
+		return image.NewBC6H_RGB_UFLOAT("VK_FORMAT_BC6H_UFLOAT_BLOCK"), nil
 	case VkFormat_VK_FORMAT_BC6H_SFLOAT_BLOCK:
-		return nil, &unsupportedVulkanFormatError{Format: vkfmt}
+		return image.NewBC6H_RGB_SFLOAT("VK_FORMAT_BC6H_SFLOAT_BLOCK"), nil
 	case VkFormat_VK_FORMAT_BC7_UNORM_BLOCK:
-		return nil, &unsupportedVulkanFormatError{Format: vkfmt}
+		return image.NewBC7_RGBA_U8_NORM("VK_FORMAT_BC7_UNORM_BLOCK"), nil
 	case VkFormat_VK_FORMAT_BC7_SRGB_BLOCK:
-		return nil, &unsupportedVulkanFormatError{Format: vkfmt}
+		return image.NewBC7_SRGBA_U8_NORM("VK_FORMAT_BC7_SRGB_BLOCK"), nil
 	case VkFormat_VK_FORMAT_ETC2_R8G8B8_UNORM_BLOCK:
 		return image.NewETC2_RGB_U8_NORM("VK_FORMAT_ETC2_R8G8B8_UNORM_BLOCK"), nil
 	case VkFormat_VK_FORMAT_ETC2_R8G8B8_SRGB_BLOCK:
@@ -788,7 +789,11 @@ func (s ShaderModuleObjectʳ) ResourceData(ctx context.Context, t *api.GlobalSta
 	ctx = log.Enter(ctx, "ShaderModuleObject.ResourceData()")
 	words := s.Words().MustRead(ctx, nil, t, nil)
 	source := shadertools.DisassembleSpirvBinary(words)
-	return api.NewResourceData(&api.Shader{Type: api.ShaderType_Spirv, Source: source}), nil
+	code := make([]byte, len(words)*4)
+	for i, w := range words {
+		binary.LittleEndian.PutUint32(code[i*4:], w)
+	}
+	return api.NewResourceData(&api.Shader{Type: api.ShaderType_Spirv, Source: source, Binary: code}), nil
 }
 
 func (shader ShaderModuleObjectʳ) SetResourceData(
@@ -0,0 +1,101 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/shadertools"
+)
+
+// ResolveShaderReflection implements the resolve.ShaderReflectionResolver
+// interface. It parses the SPIR-V code of the shader module with the given
+// handle with SPIRV-Reflect.
+func (API) ResolveShaderReflection(ctx context.Context, after *path.Command, handle uint64) (*service.ShaderReflection, error) {
+	s, err := resolve.GlobalState(ctx, after.GlobalStateAfter(), nil)
+	if err != nil {
+		return nil, err
+	}
+	module := GetState(s).ShaderModules().Get(VkShaderModule(handle))
+	if module.IsNil() {
+		return nil, fmt.Errorf("Shader module %v does not exist after command %v", handle, after.Indices)
+	}
+	words := module.Words().MustRead(ctx, nil, s, nil)
+	reflection, err := shadertools.ReflectShader(words)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &service.ShaderReflection{
+		EntryPoints:   make([]*service.ShaderEntryPoint, len(reflection.EntryPoints)),
+		PushConstants: make([]*service.ShaderPushConstantBlock, len(reflection.PushConstants)),
+	}
+	for i, e := range reflection.EntryPoints {
+		stage, err := stageType(VkShaderStageFlagBits(e.ShaderStage))
+		if err != nil {
+			return nil, err
+		}
+		bindings := []*service.ShaderDescriptorBinding{}
+		for _, set := range e.DescriptorSets {
+			for _, b := range set {
+				bindings = append(bindings, &service.ShaderDescriptorBinding{
+					Set:     b.Set,
+					Binding: b.Binding,
+					Type:    b.DescriptorType,
+					Count:   b.DescriptorCount,
+				})
+			}
+		}
+		sort.Slice(bindings, func(i, j int) bool {
+			if bindings[i].Set != bindings[j].Set {
+				return bindings[i].Set < bindings[j].Set
+			}
+			return bindings[i].Binding < bindings[j].Binding
+		})
+		out.EntryPoints[i] = &service.ShaderEntryPoint{
+			Name:     e.Name,
+			Stage:    stage,
+			Bindings: bindings,
+			Inputs:   shaderInterfaceVariables(e.Inputs),
+			Outputs:  shaderInterfaceVariables(e.Outputs),
+		}
+	}
+	for i, p := range reflection.PushConstants {
+		out.PushConstants[i] = &service.ShaderPushConstantBlock{
+			Name:   p.Name,
+			Offset: p.Offset,
+			Size:   p.Size,
+		}
+	}
+	return out, nil
+}
+
+func shaderInterfaceVariables(vars []shadertools.InterfaceVariable) []*service.ShaderInterfaceVariable {
+	out := make([]*service.ShaderInterfaceVariable, len(vars))
+	for i, v := range vars {
+		out[i] = &service.ShaderInterfaceVariable{
+			Name:     v.Name,
+			Location: v.Location,
+			Format:   v.Format,
+			BuiltIn:  v.BuiltIn,
+		}
+	}
+	return out
+}
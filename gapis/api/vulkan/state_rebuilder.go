@@ -2020,6 +2020,16 @@ func (sb *stateBuilder) createPipelineLayout(pl PipelineLayoutObjectʳ) {
 }
 
 func (sb *stateBuilder) createRenderPass(rp RenderPassObjectʳ) {
+	for _, sd := range rp.SubpassDescriptions().All() {
+		if !sd.DepthStencilResolveAttachment().IsNil() ||
+			!sd.FragmentShadingRateAttachment().IsNil() {
+			// The attachments chained to VkSubpassDescription2 cannot be
+			// described with VkRenderPassCreateInfo.
+			sb.createRenderPass2(rp)
+			return
+		}
+	}
+
 	subpassDescriptions := []VkSubpassDescription{}
 	for _, k := range rp.SubpassDescriptions().Keys() {
 		sd := rp.SubpassDescriptions().Get(k)
@@ -2065,6 +2075,132 @@ func (sb *stateBuilder) createRenderPass(rp RenderPassObjectʳ) {
 	))
 }
 
+func (sb *stateBuilder) createRenderPass2(rp RenderPassObjectʳ) {
+	attachmentReference2 := func(ref VkAttachmentReference, aspectMask VkImageAspectFlags) VkAttachmentReference2 {
+		return NewVkAttachmentReference2(sb.ta,
+			VkStructureType_VK_STRUCTURE_TYPE_ATTACHMENT_REFERENCE_2, // sType
+			0,                // pNext
+			ref.Attachment(), // attachment
+			ref.Layout(),     // layout
+			aspectMask,       // aspectMask
+		)
+	}
+	attachmentReferences2 := func(refs U32ːVkAttachmentReferenceᵐ, aspectMasks U32ːVkImageAspectFlagsᵐ) VkAttachmentReference2ᶜᵖ {
+		refs2 := make([]VkAttachmentReference2, 0, refs.Len())
+		for _, k := range refs.Keys() {
+			refs2 = append(refs2, attachmentReference2(refs.Get(k), aspectMasks.Get(k)))
+		}
+		return NewVkAttachmentReference2ᶜᵖ(sb.MustAllocReadData(refs2).Ptr())
+	}
+
+	attachmentDescriptions := []VkAttachmentDescription2{}
+	for _, ad := range rp.AttachmentDescriptions().All() {
+		attachmentDescriptions = append(attachmentDescriptions, NewVkAttachmentDescription2(sb.ta,
+			VkStructureType_VK_STRUCTURE_TYPE_ATTACHMENT_DESCRIPTION_2, // sType
+			0,                   // pNext
+			ad.Flags(),          // flags
+			ad.Format(),         // format
+			ad.Samples(),        // samples
+			ad.LoadOp(),         // loadOp
+			ad.StoreOp(),        // storeOp
+			ad.StencilLoadOp(),  // stencilLoadOp
+			ad.StencilStoreOp(), // stencilStoreOp
+			ad.InitialLayout(),  // initialLayout
+			ad.FinalLayout(),    // finalLayout
+		))
+	}
+
+	subpassDescriptions := []VkSubpassDescription2{}
+	for _, k := range rp.SubpassDescriptions().Keys() {
+		sd := rp.SubpassDescriptions().Get(k)
+		pNext := NewVoidᶜᵖ(memory.Nullptr)
+		if !sd.FragmentShadingRateAttachment().IsNil() {
+			pNext = NewVoidᶜᵖ(sb.MustAllocReadData(
+				NewVkFragmentShadingRateAttachmentInfoKHR(sb.ta,
+					VkStructureType_VK_STRUCTURE_TYPE_FRAGMENT_SHADING_RATE_ATTACHMENT_INFO_KHR, // sType
+					pNext, // pNext
+					NewVkAttachmentReference2ᶜᵖ(sb.MustAllocReadData(
+						attachmentReference2(sd.FragmentShadingRateAttachment().Get(), 0)).Ptr()), // pFragmentShadingRateAttachment
+					sd.FragmentShadingRateAttachmentTexelSize(), // shadingRateAttachmentTexelSize
+				),
+			).Ptr())
+		}
+		if !sd.DepthStencilResolveAttachment().IsNil() {
+			pNext = NewVoidᶜᵖ(sb.MustAllocReadData(
+				NewVkSubpassDescriptionDepthStencilResolve(sb.ta,
+					VkStructureType_VK_STRUCTURE_TYPE_SUBPASS_DESCRIPTION_DEPTH_STENCIL_RESOLVE, // sType
+					pNext,                   // pNext
+					sd.DepthResolveMode(),   // depthResolveMode
+					sd.StencilResolveMode(), // stencilResolveMode
+					NewVkAttachmentReference2ᶜᵖ(sb.MustAllocReadData(
+						attachmentReference2(sd.DepthStencilResolveAttachment().Get(), 0)).Ptr()), // pDepthStencilResolveAttachment
+				),
+			).Ptr())
+		}
+		depthStencil := NewVkAttachmentReference2ᶜᵖ(memory.Nullptr)
+		if !sd.DepthStencilAttachment().IsNil() {
+			depthStencil = NewVkAttachmentReference2ᶜᵖ(sb.MustAllocReadData(
+				attachmentReference2(sd.DepthStencilAttachment().Get(), 0)).Ptr())
+		}
+		resolveAttachments := NewVkAttachmentReference2ᶜᵖ(memory.Nullptr)
+		if sd.ResolveAttachments().Len() > 0 {
+			resolveAttachments = attachmentReferences2(sd.ResolveAttachments(), NewU32ːVkImageAspectFlagsᵐ(sb.ta))
+		}
+
+		subpassDescriptions = append(subpassDescriptions, NewVkSubpassDescription2(sb.ta,
+			VkStructureType_VK_STRUCTURE_TYPE_SUBPASS_DESCRIPTION_2, // sType
+			pNext,                               // pNext
+			sd.Flags(),                          // flags
+			sd.PipelineBindPoint(),              // pipelineBindPoint
+			0,                                   // viewMask
+			uint32(sd.InputAttachments().Len()), // inputAttachmentCount
+			attachmentReferences2(sd.InputAttachments(), sd.InputAttachmentAspectMasks()),   // pInputAttachments
+			uint32(sd.ColorAttachments().Len()),                                             // colorAttachmentCount
+			attachmentReferences2(sd.ColorAttachments(), NewU32ːVkImageAspectFlagsᵐ(sb.ta)), // pColorAttachments
+			resolveAttachments,                     // pResolveAttachments
+			depthStencil,                           // pDepthStencilAttachment
+			uint32(sd.PreserveAttachments().Len()), // preserveAttachmentCount
+			NewU32ᶜᵖ(sb.MustUnpackReadMap(sd.PreserveAttachments().All()).Ptr()), // pPreserveAttachments
+		))
+	}
+
+	dependencies := []VkSubpassDependency2{}
+	for _, dep := range rp.SubpassDependencies().All() {
+		dependencies = append(dependencies, NewVkSubpassDependency2(sb.ta,
+			VkStructureType_VK_STRUCTURE_TYPE_SUBPASS_DEPENDENCY_2, // sType
+			0,                     // pNext
+			dep.SrcSubpass(),      // srcSubpass
+			dep.DstSubpass(),      // dstSubpass
+			dep.SrcStageMask(),    // srcStageMask
+			dep.DstStageMask(),    // dstStageMask
+			dep.SrcAccessMask(),   // srcAccessMask
+			dep.DstAccessMask(),   // dstAccessMask
+			dep.DependencyFlags(), // dependencyFlags
+			0,                     // viewOffset
+		))
+	}
+
+	sb.write(sb.cb.VkCreateRenderPass2(
+		rp.Device(),
+		sb.MustAllocReadData(NewVkRenderPassCreateInfo2(sb.ta,
+			VkStructureType_VK_STRUCTURE_TYPE_RENDER_PASS_CREATE_INFO_2, // sType
+			0,                                   // pNext
+			0,                                   // flags
+			uint32(len(attachmentDescriptions)), // attachmentCount
+			NewVkAttachmentDescription2ᶜᵖ(sb.MustAllocReadData(attachmentDescriptions).Ptr()), // pAttachments
+			uint32(len(subpassDescriptions)),                                            // subpassCount
+			NewVkSubpassDescription2ᶜᵖ(sb.MustAllocReadData(subpassDescriptions).Ptr()), // pSubpasses
+			uint32(len(dependencies)),                                                   // dependencyCount
+			NewVkSubpassDependency2ᶜᵖ(sb.MustAllocReadData(dependencies).Ptr()),         // pDependencies
+			0, // correlatedViewMaskCount
+			0, // pCorrelatedViewMasks
+		)).Ptr(),
+		memory.Nullptr,
+		sb.MustAllocWriteData(rp.VulkanHandle()).Ptr(),
+		VkResult_VK_SUCCESS,
+	))
+}
+
 func (sb *stateBuilder) createShaderModule(sm ShaderModuleObjectʳ) {
 	sb.write(sb.cb.VkCreateShaderModule(
 		sm.Device(),
@@ -689,6 +689,18 @@ func (API) RecoverMidExecutionCommand(ctx context.Context, c *path.Capture, dat
 
 // Interface check
 var _ sync.SynchronizedAPI = &API{}
+var _ resolve.DeadCodeEliminationExplainer = &API{}
+var _ resolve.FrameBoundaryInferrer = &API{}
+var _ resolve.ResourceUsesResolver = &API{}
+var _ resolve.MemoryHeapsResolver = &API{}
+var _ resolve.ImageLayoutsResolver = &API{}
+var _ resolve.CaptureEnvironmentResolver = &API{}
+var _ resolve.ObjectLifetimesResolver = &API{}
+var _ resolve.BarrierAnalyzer = &API{}
+var _ resolve.Linter = &API{}
+var _ resolve.ShaderReflectionResolver = &API{}
+var _ resolve.CaptureBreakdownResolver = &API{}
+var _ resolve.DataReplacer = &API{}
 
 func (API) GetTerminator(ctx context.Context, c *path.Capture) (transform.Terminator, error) {
 	return NewVulkanTerminator(ctx, c)
@@ -716,5 +728,17 @@ func (API) MutateSubcommands(ctx context.Context, id api.CmdID, cmd api.Cmd,
 
 // FootprintBuilder implements dependencygraph.FootprintBuilderProvider interface
 func (API) FootprintBuilder(ctx context.Context) dependencygraph.FootprintBuilder {
-	return newFootprintBuilder()
+	vb := newFootprintBuilder()
+	vb.behaviors.Explain = dependencygraph.Explains(ctx)
+	if dependencygraph.Analyzes(ctx) {
+		vb.analyze()
+	}
+	return vb
+}
+
+// ExplainDeadCodeElimination implements the
+// resolve.DeadCodeEliminationExplainer interface.
+func (API) ExplainDeadCodeElimination(ctx context.Context, c *path.Capture,
+	request *path.Command) (map[api.CmdID]resolve.KeptReason, error) {
+	return dependencygraph.ExplainDeadCodeElimination(ctx, c, request)
 }
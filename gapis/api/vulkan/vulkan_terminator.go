@@ -198,7 +198,7 @@ func resolveCurrentRenderPass(ctx context.Context, s *api.GlobalState, submit *V
 		}
 		lastsubBuffer := executeSubcommand.CommandBuffers().Get(uint32(idx[3]))
 		lastSubBufferObject := c.CommandBuffers().Get(lastsubBuffer)
-		for subcmd := 0; subcmd < int(idx[4]); subcmd++ {
+		for subcmd := 0; subcmd < int(idx[4])+getExtra(idx, loopLevel); subcmd++ {
 			f(lastSubBufferObject.CommandReferences().Get(uint32(subcmd)))
 		}
 	}
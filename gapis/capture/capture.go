@@ -485,6 +485,9 @@ func (b *builder) build(name string, header *Header) *Capture {
 	for _, api := range b.apis {
 		analytics.SendEvent("capture", "uses-api", api.Name())
 	}
+	for _, r := range header.GetReservedMemory() {
+		interval.Merge(&b.observed, interval.U64Span{Start: r.Base, End: r.Base + r.Size}, true)
+	}
 	// TODO: Mark the arena as read-only.
 	return &Capture{
 		Name:         name,
@@ -99,6 +99,20 @@ func (c *client) Get(ctx context.Context, p *path.Any, r *path.ResolveConfig) (i
 	return res.GetValue().Get(), nil
 }
 
+func (c *client) GetStream(ctx context.Context, req *service.GetStreamRequest, handler service.DataChunkHandler) error {
+	stream, err := c.client.GetStream(ctx, req)
+	if err != nil {
+		return err
+	}
+	h := func(ctx context.Context, m *service.GetStreamResponse) error {
+		if err := m.GetError(); err != nil {
+			return err.Get()
+		}
+		return handler(m.GetChunk())
+	}
+	return event.Feed(ctx, event.AsHandler(ctx, h), grpcutil.ToProducer(stream))
+}
+
 func (c *client) Set(ctx context.Context, p *path.Any, v interface{}, r *path.ResolveConfig) (*path.Any, error) {
 	res, err := c.client.Set(ctx, &service.SetRequest{
 		Path:   p,
@@ -271,7 +285,7 @@ func (c *client) LoadCapture(ctx context.Context, path string) (*path.Capture, e
 
 func (c *client) SaveCapture(ctx context.Context, capture *path.Capture, path string) error {
 	res, err := c.client.SaveCapture(ctx, &service.SaveCaptureRequest{
-		Capture: capture,
+		Capture: p,
 		Path:    path,
 	})
 	if err != nil {
@@ -285,7 +299,7 @@ func (c *client) SaveCapture(ctx context.Context, capture *path.Capture, path st
 
 func (c *client) ExportReplay(ctx context.Context, capture *path.Capture, device *path.Device, path string, opts *service.ExportReplayOptions) error {
 	res, err := c.client.ExportReplay(ctx, &service.ExportReplayRequest{
-		Capture: capture,
+		Capture: p,
 		Path:    path,
 		Device:  device,
 		Options: opts,
@@ -348,6 +362,149 @@ func (c *client) GetFramebufferAttachment(
 	return res.GetImage(), nil
 }
 
+func (c *client) GetFramebufferAttachments(
+	ctx context.Context,
+	repS *service.ReplaySettings,
+	atts []*service.FramebufferAttachmentQuery,
+	hints *service.UsageHints,
+) ([]*service.FramebufferAttachmentImage, error) {
+
+	res, err := c.client.GetFramebufferAttachments(ctx, &service.GetFramebufferAttachmentsRequest{
+		ReplaySettings: repS,
+		Attachments:    atts,
+		Hints:          hints,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetImages().Images, nil
+}
+
+func (c *client) GetOverdraw(
+	ctx context.Context,
+	repS *service.ReplaySettings,
+	first, after *path.Command,
+	hints *service.UsageHints,
+) (*path.ImageInfo, error) {
+
+	res, err := c.client.GetOverdraw(ctx, &service.GetOverdrawRequest{
+		ReplaySettings: repS,
+		First:          first,
+		After:          after,
+		Hints:          hints,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetImage(), nil
+}
+
+func (c *client) GetPipelineStatistics(
+	ctx context.Context,
+	repS *service.ReplaySettings,
+	draws []*path.Command,
+	hints *service.UsageHints,
+) (*service.PipelineStatistics, error) {
+
+	res, err := c.client.GetPipelineStatistics(ctx, &service.GetPipelineStatisticsRequest{
+		ReplaySettings: repS,
+		Draws:          draws,
+		Hints:          hints,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetStatistics(), nil
+}
+
+func (c *client) GetDispatchBuffers(
+	ctx context.Context,
+	repS *service.ReplaySettings,
+	dispatch *path.Command,
+	hints *service.UsageHints,
+) (*service.DispatchBuffers, error) {
+
+	res, err := c.client.GetDispatchBuffers(ctx, &service.GetDispatchBuffersRequest{
+		ReplaySettings: repS,
+		Dispatch:       dispatch,
+		Hints:          hints,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetBuffers(), nil
+}
+
+func (c *client) GetCaptureEnvironment(ctx context.Context, p *path.Capture, d *path.Device) (*service.CaptureEnvironment, error) {
+	res, err := c.client.GetCaptureEnvironment(ctx, &service.GetCaptureEnvironmentRequest{
+		Capture: p,
+		Device:  d,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetEnvironment(), nil
+}
+
+func (c *client) GetObjectLifetimes(ctx context.Context, p *path.Capture) (*service.ObjectLifetimes, error) {
+	res, err := c.client.GetObjectLifetimes(ctx, &service.GetObjectLifetimesRequest{
+		Capture: p,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetLifetimes(), nil
+}
+
+func (c *client) GetCaptureDiff(ctx context.Context, before, after *path.Capture, r *path.ResolveConfig) (*service.CaptureDiff, error) {
+	res, err := c.client.GetCaptureDiff(ctx, &service.GetCaptureDiffRequest{
+		Before: before,
+		After:  after,
+		Config: r,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetDiff(), nil
+}
+
+func (c *client) CallExtension(ctx context.Context, p *path.Capture, extension, endpoint string, args []byte) ([]byte, error) {
+	res, err := c.client.CallExtension(ctx, &service.CallExtensionRequest{
+		Extension: extension,
+		Endpoint:  endpoint,
+		Capture:   p,
+		Arguments: args,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetResult(), nil
+}
+
 func (c *client) GetLogStream(ctx context.Context, handler log.Handler) error {
 	stream, err := c.client.GetLogStream(ctx, &service.GetLogStreamRequest{})
 	if err != nil {
@@ -449,6 +606,22 @@ func (t *traceHandler) Dispose() {
 	t.conn.CloseSend()
 }
 
+func (c *client) ReplaceData(ctx context.Context, after *path.Command, handle, offset uint64, data []byte) (*path.Capture, error) {
+	res, err := c.client.ReplaceData(ctx, &service.ReplaceDataRequest{
+		After:  after,
+		Handle: handle,
+		Offset: offset,
+		Data:   data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetCapture(), nil
+}
+
 func (c *client) DCECapture(ctx context.Context, capture *path.Capture, commands []*path.Command) (*path.Capture, error) {
 	res, err := c.client.DCECapture(ctx, &service.DCECaptureRequest{
 		Capture:  capture,
@@ -463,6 +636,246 @@ func (c *client) DCECapture(ctx context.Context, capture *path.Capture, commands
 	return res.GetCapture(), nil
 }
 
+func (c *client) TrimCapture(ctx context.Context, capture *path.Capture, from, to *path.Command, commands []*path.Command) (*path.Capture, error) {
+	res, err := c.client.TrimCapture(ctx, &service.TrimCaptureRequest{
+		Capture:  capture,
+		From:     from,
+		To:       to,
+		Commands: commands,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetCapture(), nil
+}
+
+func (c *client) GetDependencies(ctx context.Context, command *path.Command) ([]*path.Command, error) {
+	res, err := c.client.GetDependencies(ctx, &service.GetDependenciesRequest{
+		Command: command,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetDependencies().Commands, nil
+}
+
+func (c *client) GetDependents(ctx context.Context, command *path.Command) ([]*path.Command, error) {
+	res, err := c.client.GetDependents(ctx, &service.GetDependentsRequest{
+		Command: command,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetDependents().Commands, nil
+}
+
+func (c *client) GetResourceUses(ctx context.Context, p *path.Capture, handle uint64) ([]*service.ResourceUse, error) {
+	res, err := c.client.GetResourceUses(ctx, &service.GetResourceUsesRequest{
+		Capture: p,
+		Handle:  handle,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetUses().Uses, nil
+}
+
+func (c *client) GetShaderReflection(ctx context.Context, after *path.Command, handle uint64) (*service.ShaderReflection, error) {
+	res, err := c.client.GetShaderReflection(ctx, &service.GetShaderReflectionRequest{
+		After:  after,
+		Handle: handle,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetReflection(), nil
+}
+
+func (c *client) FilterCommands(ctx context.Context, p *path.Capture, expr string) ([]uint64, error) {
+	res, err := c.client.FilterCommands(ctx, &service.FilterCommandsRequest{
+		Capture:    p,
+		Expression: expr,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetCommands().Indices, nil
+}
+
+type commandTreeFilterHandler struct {
+	conn service.Gapid_FilterCommandTreeClient
+	tree *path.ID
+}
+
+func (c *client) FilterCommandTree(ctx context.Context, tree *path.ID) (service.CommandTreeFilterHandler, error) {
+	res, err := c.client.FilterCommandTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &commandTreeFilterHandler{res, tree}, nil
+}
+
+// Filter sends the expression and waits for its delta. As the server may skip
+// the expressions sent while it matches a previous one, the calls must not be
+// concurrent.
+func (f *commandTreeFilterHandler) Filter(ctx context.Context, expr string) (*service.CommandTreeDelta, error) {
+	err := f.conn.Send(&service.FilterCommandTreeRequest{
+		Tree:       f.tree,
+		Expression: expr,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := f.conn.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetDelta(), nil
+}
+
+func (f *commandTreeFilterHandler) Dispose() {
+	f.conn.CloseSend()
+}
+
+func (c *client) GetMemoryHeaps(ctx context.Context, after *path.Command) (*service.MemoryHeaps, error) {
+	res, err := c.client.GetMemoryHeaps(ctx, &service.GetMemoryHeapsRequest{
+		After: after,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetHeaps(), nil
+}
+
+func (c *client) GetImageLayouts(ctx context.Context, after *path.Command, image uint64) ([]*service.ImageSubresourceLayout, error) {
+	res, err := c.client.GetImageLayouts(ctx, &service.GetImageLayoutsRequest{
+		After: after,
+		Image: image,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetLayouts().Subresources, nil
+}
+
+func (c *client) GetStateDiff(ctx context.Context, from, to *path.Command, r *path.ResolveConfig) (*service.StateDiff, error) {
+	res, err := c.client.GetStateDiff(ctx, &service.GetStateDiffRequest{
+		From:   from,
+		To:     to,
+		Config: r,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetDiff(), nil
+}
+
+func (c *client) SetAnnotation(ctx context.Context, p *path.Capture, a *service.Annotation) error {
+	res, err := c.client.SetAnnotation(ctx, &service.SetAnnotationRequest{
+		Capture:    p,
+		Annotation: a,
+	})
+	if err != nil {
+		return err
+	}
+	if err := res.GetError(); err != nil {
+		return err.Get()
+	}
+	return nil
+}
+
+func (c *client) GetAnnotations(ctx context.Context, p *path.Capture) (*service.Annotations, error) {
+	res, err := c.client.GetAnnotations(ctx, &service.GetAnnotationsRequest{
+		Capture: p,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetAnnotations(), nil
+}
+
+func (c *client) SetReportConfig(ctx context.Context, p *path.Capture, cfg *service.ReportConfig) error {
+	res, err := c.client.SetReportConfig(ctx, &service.SetReportConfigRequest{
+		Capture: p,
+		Config:  cfg,
+	})
+	if err != nil {
+		return err
+	}
+	if err := res.GetError(); err != nil {
+		return err.Get()
+	}
+	return nil
+}
+
+func (c *client) GetReportConfig(ctx context.Context, p *path.Capture) (*service.ReportConfig, error) {
+	res, err := c.client.GetReportConfig(ctx, &service.GetReportConfigRequest{
+		Capture: p,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetConfig(), nil
+}
+
+func (c *client) GetFilmstrip(ctx context.Context, req *service.GetFilmstripRequest) (*service.Filmstrip, error) {
+	res, err := c.client.GetFilmstrip(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetFilmstrip(), nil
+}
+
+func (c *client) CompareReplays(ctx context.Context, req *service.CompareReplaysRequest) (*service.ReplayComparison, error) {
+	res, err := c.client.CompareReplays(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetComparison(), nil
+}
+
 func (c *client) UpdateSettings(ctx context.Context, req *service.UpdateSettingsRequest) error {
 	res, err := c.client.UpdateSettings(ctx, req)
 	if err != nil {
@@ -474,10 +887,24 @@ func (c *client) UpdateSettings(ctx context.Context, req *service.UpdateSettings
 	return nil
 }
 
-func (c *client) GetTimestamps(ctx context.Context, capture *path.Capture, device *path.Device) (interface{}, error) {
+func (c *client) GetCacheUsage(ctx context.Context, clear bool) (*service.CacheUsage, error) {
+	res, err := c.client.GetCacheUsage(ctx, &service.GetCacheUsageRequest{
+		Clear: clear,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetUsage(), nil
+}
+
+func (c *client) GetTimestamps(ctx context.Context, capture *path.Capture, device *path.Device, opts *service.TimestampsOptions) (interface{}, error) {
 	res, err := c.client.GetTimestamps(ctx, &service.GetTimestampsRequest{
 		Capture: capture,
 		Device:  device,
+		Options: opts,
 	})
 	if err != nil {
 		return "", err
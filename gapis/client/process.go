@@ -16,6 +16,7 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 
 	"github.com/google/gapid/core/app/auth"
@@ -26,6 +27,7 @@ import (
 	"github.com/google/gapid/core/os/file"
 	"github.com/google/gapid/core/os/process"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 const (
@@ -37,20 +39,26 @@ type Config struct {
 	Port  int
 	Args  []string
 	Token auth.Token
+	// Addr is the host:port of a GAPIS server, possibly running on another
+	// machine, to connect to. If set, Port is ignored.
+	Addr string
+	// TLS is the configuration of the TLS connection to the GAPIS server, or
+	// nil for an insecure connection.
+	TLS *tls.Config
 }
 
 // Connect attempts to connect to a GAPIS process.
-// If port is zero, a new GAPIS server will be started, otherwise a connection
-// will be made to the specified port.
+// If the address and the port are empty, a new GAPIS server will be started,
+// otherwise a connection will be made to the specified address or port.
 func Connect(ctx context.Context, cfg Config) (Client, error) {
 	var err error
-	if cfg.Path == nil {
-		if cfg.Path, err = findGapis(ctx); err != nil {
-			return nil, err
+	if cfg.Port == 0 && cfg.Addr == "" {
+		if cfg.Path == nil {
+			if cfg.Path, err = findGapis(ctx); err != nil {
+				return nil, err
+			}
 		}
-	}
 
-	if cfg.Port == 0 {
 		cfg.Args = append(cfg.Args,
 			"--log-level", logLevel(ctx).String(),
 			"--log-style", log.Brief.String(),
@@ -69,11 +77,20 @@ func Connect(ctx context.Context, cfg Config) (Client, error) {
 		}
 	}
 
-	target := fmt.Sprintf("localhost:%d", cfg.Port)
+	target := cfg.Addr
+	if target == "" {
+		target = fmt.Sprintf("localhost:%d", cfg.Port)
+	}
+
+	transport := grpc.WithInsecure()
+	if cfg.TLS != nil {
+		transport = grpc.WithTransportCredentials(credentials.NewTLS(cfg.TLS))
+	}
 
 	conn, err := grpcutil.Dial(ctx, target,
-		grpc.WithInsecure(),
-		grpc.WithUnaryInterceptor(auth.ClientInterceptor(cfg.Token)))
+		transport,
+		grpc.WithUnaryInterceptor(auth.ClientInterceptor(cfg.Token)),
+		grpc.WithStreamInterceptor(auth.StreamClientInterceptor(cfg.Token)))
 	if err != nil {
 		return nil, log.Err(ctx, err, "Dialing GAPIS")
 	}
@@ -0,0 +1,66 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// GetChunked resolves and returns the object, value or memory at the path p,
+// like Get, but streams it with GetStream so that it is not limited by the
+// size of a message. If the stream is interrupted after some chunks were
+// received, the transfer is resumed from the last received chunk.
+func GetChunked(ctx context.Context, s service.Service, p *path.Any, r *path.ResolveConfig) (interface{}, error) {
+	var valueID *path.ID
+	var data []byte
+	for {
+		received := false
+		req := &service.GetStreamRequest{Path: p, Config: r, Offset: uint64(len(data))}
+		err := s.GetStream(ctx, req, func(c *service.DataChunk) error {
+			switch {
+			case valueID == nil:
+				valueID, data = c.ID, make([]byte, 0, c.Size)
+			case !proto.Equal(c.ID, valueID):
+				return fmt.Errorf("Value changed while resuming its transfer")
+			}
+			if c.Offset != uint64(len(data)) {
+				return fmt.Errorf("Chunk at offset %v received at offset %v", c.Offset, len(data))
+			}
+			data = append(data, c.Data...)
+			received = true
+			return nil
+		})
+		if err == nil {
+			break
+		}
+		if !received || task.Stopped(ctx) {
+			return nil, err
+		}
+		log.W(ctx, "Transfer of %v interrupted after %v bytes. Resuming. Error: %v", p, len(data), err)
+	}
+
+	val := &service.Value{}
+	if err := proto.Unmarshal(data, val); err != nil {
+		return nil, err
+	}
+	return val.Get(), nil
+}
@@ -31,4 +31,18 @@ const (
 	LogTransformsToFile    = false
 	LogTransformsToCapture = false
 	SeparateMutateStates   = false
+	// Reads back the index buffers while building the dead code elimination
+	// footprint, so that indexed draws only read the referenced vertices.
+	// Only works for Vulkan.
+	IndexedVertexRangesInDeadCodeElimination = false
+	// Granularity of the memory data tracked while building the dead code
+	// elimination footprint: 0 tracks the byte ranges accessed by each
+	// command, 1 tracks the whole memory ranges bound to buffers and images,
+	// 2 tracks each device memory as a whole. Coarser levels build faster and
+	// use less memory, but keep more commands alive. Only works for Vulkan.
+	FootprintGranularity = 0
+	// Detects the cycles of dependencies after building the dead code
+	// elimination footprint, logs the commands involved and breaks the cycles
+	// by keeping their commands alive.
+	DetectFootprintCycles = false
 )
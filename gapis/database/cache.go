@@ -0,0 +1,81 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/log"
+)
+
+// CacheUsage describes the resolved values held by a database.
+type CacheUsage struct {
+	// Number of resolved values held.
+	Entries uint64
+	// Estimated size in bytes of the resolved values held.
+	Size uint64
+	// Estimated size in bytes above which the least recently used resolved
+	// values are evicted, or 0 if there is no limit.
+	Limit uint64
+	// Number of resolved values evicted so far.
+	Evictions uint64
+}
+
+// Cache is the interface implemented by the databases that hold on to the
+// values of the resolvables, so that they are only resolved once. Evicted
+// values are resolved again the next time they are requested.
+type Cache interface {
+	// CacheUsage returns the current usage of the cache.
+	CacheUsage() CacheUsage
+	// SetCacheLimit sets the estimated size in bytes above which the least
+	// recently used resolved values are evicted. 0 means no limit.
+	SetCacheLimit(ctx context.Context, limit uint64)
+	// TrimCache evicts the least recently used resolved values until their
+	// estimated size is at most size.
+	TrimCache(ctx context.Context, size uint64)
+}
+
+// GetCache returns the Cache of the database attached to the given context,
+// or nil if the database does not hold on to resolved values.
+func GetCache(ctx context.Context) Cache {
+	c, _ := Get(ctx).(Cache)
+	return c
+}
+
+// MonitorMemoryPressure checks the heap size of the process every interval,
+// until the context is cancelled. Whenever the heap is larger than heapLimit,
+// the least recently used half of the resolved values of c are evicted.
+func MonitorMemoryPressure(ctx context.Context, c Cache, heapLimit uint64, interval time.Duration) {
+	stats := runtime.MemStats{}
+	for !task.Stopped(ctx) {
+		runtime.ReadMemStats(&stats)
+		if stats.HeapAlloc > heapLimit {
+			usage := c.CacheUsage()
+			log.W(ctx, "Heap size of %v bytes exceeds %v bytes. Evicting resolved values of %v bytes",
+				stats.HeapAlloc, heapLimit, usage.Size-usage.Size/2)
+			c.TrimCache(ctx, usage.Size/2)
+			// Collect the evicted values now, so the next check does not see
+			// them.
+			runtime.GC()
+		}
+		select {
+		case <-task.ShouldStop(ctx):
+		case <-time.After(interval):
+		}
+	}
+}
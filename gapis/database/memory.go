@@ -15,6 +15,7 @@
 package database
 
 import (
+	"container/list"
 	"context"
 	"crypto/sha1"
 	"fmt"
@@ -28,12 +29,14 @@ import (
 	"github.com/google/gapid/core/data/id"
 	"github.com/google/gapid/core/data/protoconv"
 	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/log"
 )
 
 // NewInMemory builds a new in memory database.
 func NewInMemory(ctx context.Context) Database {
 	m := &memory{}
 	m.records = map[id.ID]*record{}
+	m.lru = list.New()
 	m.resolveCtx = Put(ctx, m)
 	return m
 }
@@ -69,6 +72,8 @@ type record struct {
 	object       interface{} // object is the deserialized object
 	resolveState *resolveState
 	created      callstack
+	size         uint64        // size is the estimated size of the resolved object
+	lru          *list.Element // lru is the element of the record in the LRU list, if evictable
 }
 
 type resolveState struct {
@@ -94,12 +99,14 @@ func (r *record) decode(ctx context.Context) (interface{}, error) {
 	}
 }
 
-func (r *record) resolve(ctx context.Context) error {
+// resolve resolves the object of the record, returning true if the object was
+// a Resolvable.
+func (r *record) resolve(ctx context.Context) (bool, error) {
 	// Decode the object if we don't have the object already.
 	if r.object == nil {
 		obj, err := r.decode(ctx)
 		if err != nil {
-			return err
+			return false, err
 		}
 		r.object = obj
 	}
@@ -114,28 +121,28 @@ func (r *record) resolve(ctx context.Context) error {
 			if err.Object != msg {
 				// We got a ErrNoConverterRegistered error, but it wasn't for
 				// the outermost object!
-				return err
+				return false, err
 			}
 		default:
-			return err
+			return false, err
 		}
 	}
 
 	// Keep on resolving until the type no longer implements Resolvable.
-	for {
+	for resolved := false; ; resolved = true {
 		// If the object implements resolvable, then we need to resolve it.
 		// Is the database value resolvable?
 		resolvable, isResolvable := r.object.(Resolvable)
 		if !isResolvable {
-			return nil
+			return resolved, nil
 		}
 		ctx = status.Start(ctx, "DB Resolve<%T> %p", resolvable, r.resolveState)
 		defer status.Finish(ctx)
-		resolved, err := resolvable.Resolve(ctx)
+		obj, err := resolvable.Resolve(ctx)
 		if err != nil {
-			return err
+			return false, err
 		}
-		r.object = resolved
+		r.object = obj
 	}
 }
 
@@ -143,8 +150,18 @@ type memory struct {
 	mutex      sync.Mutex
 	records    map[id.ID]*record
 	resolveCtx context.Context
+	// The records holding resolved objects, from the most to the least
+	// recently used. Evicted records are resolved again on their next use.
+	lru       *list.List
+	size      uint64 // Estimated size of the resolved objects in lru
+	limit     uint64 // Size above which records are evicted, 0 if unlimited
+	evictions uint64
+	dir       string // Directory of the persistent records, empty if not kept
 }
 
+var _ Cache = &memory{}
+var _ Persistent = &memory{}
+
 // Implements Database
 func (d *memory) Store(ctx context.Context, val interface{}) (id.ID, error) {
 	var data []byte
@@ -235,12 +252,25 @@ func (d *memory) resolveLocked(ctx context.Context, id id.ID) (interface{}, erro
 			ctx := status.PutTask(rs.ctx, status.GetTask(ctx))
 
 			defer d.resolvePanicHandler(ctx)
-			err := r.resolve(ctx)
+			resolved, err := r.resolve(ctx)
+			size, evictable := uint64(0), false
+			if resolved && err == nil {
+				size, evictable = sizeOf(r.object)
+			}
 
 			// Signal that the resolvable has finished.
 			d.mutex.Lock()
 			close(rs.finished)
 			rs.err, rs.finished = err, nil
+			if evictable && err == nil && r.resolveState == rs {
+				// The resolve was not cancelled. The resolved object can be
+				// evicted, as it can be resolved again.
+				r.size, r.lru = size, d.lru.PushFront(r)
+				d.size += size
+				if d.limit > 0 {
+					d.trimLocked(ctx, d.limit)
+				}
+			}
 			d.mutex.Unlock()
 		})
 	}
@@ -292,6 +322,9 @@ func (d *memory) resolveLocked(ctx context.Context, id id.ID) (interface{}, erro
 		}
 		return nil, fmt.Errorf("Resource '%v' of incorrect type", id)
 	}
+	if r.lru != nil {
+		d.lru.MoveToFront(r.lru)
+	}
 	return r.object, nil // Done.
 }
 
@@ -302,3 +335,55 @@ func (d *memory) Contains(ctx context.Context, id id.ID) (res bool) {
 	_, got := d.records[id]
 	return got
 }
+
+// Implements Cache
+func (d *memory) CacheUsage() CacheUsage {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return CacheUsage{
+		Entries:   uint64(d.lru.Len()),
+		Size:      d.size,
+		Limit:     d.limit,
+		Evictions: d.evictions,
+	}
+}
+
+// Implements Cache
+func (d *memory) SetCacheLimit(ctx context.Context, limit uint64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.limit = limit
+	if limit > 0 {
+		d.trimLocked(ctx, limit)
+	}
+}
+
+// Implements Cache
+func (d *memory) TrimCache(ctx context.Context, size uint64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.trimLocked(ctx, size)
+}
+
+// trimLocked evicts the least recently used resolved objects until their size
+// is at most size. The objects that are about to be returned to go-routines
+// waiting for their resolve are not evicted.
+// trimLocked must be called with a locked mutex.
+func (d *memory) trimLocked(ctx context.Context, size uint64) {
+	count := 0
+	for e := d.lru.Back(); e != nil && d.size > size; {
+		r := e.Value.(*record)
+		e = e.Prev()
+		if r.resolveState.waiting > 0 {
+			continue
+		}
+		d.lru.Remove(r.lru)
+		d.size -= r.size
+		r.object, r.resolveState, r.size, r.lru = nil, nil, 0, nil
+		count++
+	}
+	if count > 0 {
+		d.evictions += uint64(count)
+		log.D(ctx, "Evicted %v resolved objects. %v bytes remaining", count, d.size)
+	}
+}
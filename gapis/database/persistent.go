@@ -0,0 +1,123 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Persistent is the interface implemented by the databases that keep named
+// records across the sessions of the server. Unlike the values stored by
+// ID, the records are mutable, and are typically keyed by the ID of the
+// capture they belong to.
+type Persistent interface {
+	// SetPersistentDirectory sets the directory the records are kept in. The
+	// records are not kept across the sessions if dir is empty.
+	SetPersistentDirectory(dir string)
+	// LoadRecord returns the data of the record with the given name, or nil
+	// if there is no such record.
+	LoadRecord(ctx context.Context, name string) ([]byte, error)
+	// StoreRecord replaces the data of the record with the given name.
+	StoreRecord(ctx context.Context, name string, data []byte) error
+}
+
+// GetPersistent returns the Persistent of the database attached to the given
+// context, or nil if the database does not keep records across the sessions.
+func GetPersistent(ctx context.Context) Persistent {
+	p, _ := Get(ctx).(Persistent)
+	return p
+}
+
+// LoadRecord loads the record with the given name from the database held by
+// the context. It returns nil if there is no such record, or if the database
+// does not keep records.
+func LoadRecord(ctx context.Context, name string) ([]byte, error) {
+	if p := GetPersistent(ctx); p != nil {
+		return p.LoadRecord(ctx, name)
+	}
+	return nil, nil
+}
+
+// StoreRecord stores the record with the given name to the database held by
+// the context. It does nothing if the database does not keep records.
+func StoreRecord(ctx context.Context, name string, data []byte) error {
+	if p := GetPersistent(ctx); p != nil {
+		return p.StoreRecord(ctx, name, data)
+	}
+	return nil
+}
+
+// recordFile returns the path of the file of the record with the given name
+// in the persistent directory, or an empty string if the records are not kept.
+// The slashes in the name separate directories.
+func (d *memory) recordFile(name string) string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.dir == "" || name == "" || strings.Contains(name, "..") {
+		return ""
+	}
+	return filepath.Join(d.dir, filepath.FromSlash(name))
+}
+
+// Implements Persistent
+func (d *memory) SetPersistentDirectory(dir string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.dir = dir
+}
+
+// Implements Persistent
+func (d *memory) LoadRecord(ctx context.Context, name string) ([]byte, error) {
+	file := d.recordFile(name)
+	if file == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Implements Persistent
+func (d *memory) StoreRecord(ctx context.Context, name string, data []byte) error {
+	file := d.recordFile(name)
+	if file == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so partially written records are never
+	// loaded.
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,38 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+// Sizer is the interface implemented by the resolved values which can be
+// evicted from the database, to be resolved again on their next use. Other
+// resolved values are never evicted, as their size cannot be estimated
+// reliably when they share memory with other values, and some of them, such
+// as captures, must not be resolved again.
+type Sizer interface {
+	// ResolvedSize returns an estimate of the number of bytes of memory held
+	// by the value, not including the memory shared with other values.
+	ResolvedSize() uint64
+}
+
+// sizeOf returns an estimate of the number of bytes of memory held by the
+// resolved value v, and whether v can be evicted.
+func sizeOf(v interface{}) (uint64, bool) {
+	switch v := v.(type) {
+	case []byte:
+		return uint64(len(v)), true
+	case Sizer:
+		return v.ResolvedSize(), true
+	}
+	return 0, false
+}
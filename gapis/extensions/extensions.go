@@ -14,18 +14,21 @@
 
 // Package extensions provides extension functionality to GAPIS.
 //
-// Extensions would ideally be plugins, but golang still doesn't have
-// cross platform support. See: https://github.com/golang/go/issues/19282
+// Extensions are registered at application initialization, either by packages
+// linked into GAPIS or by Go plugins loaded with LoadPlugins. Go plugins are
+// not supported on all platforms. See: https://github.com/golang/go/issues/19282
 package extensions
 
 import (
 	"context"
 	"sync"
 
+	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/resolve/cmdgrouper"
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/stringtable"
 )
 
 var (
@@ -42,6 +45,22 @@ type EventProvider func(ctx context.Context, id api.CmdID, cmd api.Cmd, s *api.G
 // generation, otherwise it is ignored.
 type EventFilter func(api.CmdID, api.Cmd, *api.GlobalState) bool
 
+// ReportItem is an item contributed by an extension to the report of a
+// capture.
+type ReportItem struct {
+	Severity log.Severity
+	Message  *stringtable.Msg
+}
+
+// ReportItems is a function that produces the report items of the capture, by
+// command. The items not related to a command use the api.CmdNoID key.
+type ReportItems func(ctx context.Context, p *path.Capture) (map[api.CmdID][]ReportItem, error)
+
+// Endpoint is a custom service endpoint of an extension, called with the
+// capture and the arguments of the client. The encoding of the arguments and
+// of the result is defined by the extension.
+type Endpoint func(ctx context.Context, p *path.Capture, args []byte) ([]byte, error)
+
 // Extension is a GAPIS extension.
 // It should be registered at application initialization with Register.
 type Extension struct {
@@ -56,6 +75,10 @@ type Extension struct {
 	Events func(ctx context.Context, p *path.Events, r *path.ResolveConfig) EventProvider
 	// Custom events filters.
 	EventFilter func(ctx context.Context, p *path.Events, r *path.ResolveConfig) EventFilter
+	// Custom report items.
+	ReportItems ReportItems
+	// Custom service endpoints, by name.
+	Endpoints map[string]Endpoint
 }
 
 // Register registers the extension e.
@@ -0,0 +1,43 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extensions
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/google/gapid/core/log"
+)
+
+// LoadPlugins loads all the Go plugins of the directory dir. The plugins
+// register their extensions from their init functions.
+func LoadPlugins(ctx context.Context, dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return log.Errf(ctx, err, "Couldn't read the plugin directory %v", dir)
+	}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".so" {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		if err := loadPlugin(path); err != nil {
+			return log.Errf(ctx, err, "Couldn't load the plugin %v", path)
+		}
+		log.I(ctx, "Loaded plugin %v", path)
+	}
+	return nil
+}
@@ -351,3 +351,54 @@ type SwitchThread struct {
 func (a SwitchThread) Encode(r value.PointerResolver, w binary.Writer) error {
 	return opcode.SwitchThread{Index: a.Index}.Encode(w)
 }
+
+// Mul is an Instruction that pops and multiplies the top N stack values,
+// pushing the result to the top of the stack. Each multiplied value must have
+// the same type.
+type Mul struct {
+	Count uint32
+}
+
+func (a Mul) Encode(r value.PointerResolver, w binary.Writer) error {
+	return opcode.Mul{Count: a.Count}.Encode(w)
+}
+
+// LoadOffset is an Instruction that pops the integer offset and then the
+// address from the top of the VM stack, and pushes the value of type DataType
+// loaded from the address offset by that many bytes.
+type LoadOffset struct {
+	DataType protocol.Type
+}
+
+func (a LoadOffset) Encode(r value.PointerResolver, w binary.Writer) error {
+	return opcode.LoadOffset{DataType: a.DataType}.Encode(w)
+}
+
+// StoreOffset is an Instruction that pops the integer offset, the address and
+// then the value from the top of the VM stack, and writes the value to the
+// address offset by that many bytes.
+type StoreOffset struct{}
+
+func (a StoreOffset) Encode(r value.PointerResolver, w binary.Writer) error {
+	return opcode.StoreOffset{}.Encode(w)
+}
+
+// JumpZ is an Instruction that pops the value from the top of the VM stack,
+// and skips the Count following opcodes if the value is zero.
+type JumpZ struct {
+	Count uint32
+}
+
+func (a JumpZ) Encode(r value.PointerResolver, w binary.Writer) error {
+	return opcode.JumpZ{Count: a.Count}.Encode(w)
+}
+
+// JumpNZ is an Instruction that pops the value from the top of the VM stack,
+// and skips the Count following opcodes if the value is not zero.
+type JumpNZ struct {
+	Count uint32
+}
+
+func (a JumpNZ) Encode(r value.PointerResolver, w binary.Writer) error {
+	return opcode.JumpNZ{Count: a.Count}.Encode(w)
+}
@@ -390,3 +390,45 @@ func TestPost(t *testing.T) {
 		opcode.Post{},
 	)
 }
+
+func TestMul(t *testing.T) {
+	ctx := log.Testing(t)
+	test(ctx,
+		[]Instruction{
+			Mul{2},
+		},
+		opcode.Mul{Count: 2},
+	)
+}
+
+func TestLoadOffset(t *testing.T) {
+	ctx := log.Testing(t)
+	test(ctx,
+		[]Instruction{
+			LoadOffset{protocol.Type_Uint64},
+		},
+		opcode.LoadOffset{DataType: protocol.Type_Uint64},
+	)
+}
+
+func TestStoreOffset(t *testing.T) {
+	ctx := log.Testing(t)
+	test(ctx,
+		[]Instruction{
+			StoreOffset{},
+		},
+		opcode.StoreOffset{},
+	)
+}
+
+func TestJump(t *testing.T) {
+	ctx := log.Testing(t)
+	test(ctx,
+		[]Instruction{
+			JumpZ{3},
+			JumpNZ{0x3ffffff},
+		},
+		opcode.JumpZ{Count: 3},
+		opcode.JumpNZ{Count: 0x3ffffff},
+	)
+}
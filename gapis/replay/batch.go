@@ -142,6 +142,21 @@ func (m *manager) execute(
 	}
 	ctx = log.V{"replay target ABI": replayABI}.Bind(ctx)
 
+	key, cacheable := payloadKey(captureID, deviceID, replayABI, cfg, generator, requests)
+	var cached *cachedPayload
+	if cacheable {
+		if cached = m.payloads.get(key); cached != nil {
+			log.D(ctx, "Using cached payload")
+			cached.bind(requests)
+			err := m.executePayload(ctx, d, intent, cfg, replayABI,
+				cached.payload, cached.handlePost, cached.handleNotification, cached.handleCommandTimings)
+			m.payloads.update(key, cached, err)
+			return err
+		}
+		cached = &cachedPayload{}
+		requests = cached.bind(requests)
+	}
+
 	b := builder.New(replayABI.MemoryLayout)
 
 	_, ranges, err := initialcmds.InitialCommands(ctx, capturePath)
@@ -167,6 +182,11 @@ func (m *manager) execute(
 	if err != nil {
 		return log.Err(ctx, err, "Replay returned error")
 	}
+	if cached != nil && cached.pending() != len(requests) {
+		// Some results were called while generating the payload, they would
+		// not be called again by an execution of the cached payload.
+		cached = nil
+	}
 
 	if config.DebugReplay {
 		log.I(ctx, "Building payload...")
@@ -175,13 +195,35 @@ func (m *manager) execute(
 	var payload gapir.Payload
 	var handlePost builder.PostDataHandler
 	var handleNotification builder.NotificationHandler
+	var handleCommandTimings builder.CommandTimingsHandler
 	builderBuildTimer.Time(func() {
-		payload, handlePost, handleNotification, err = b.Build(ctx)
+		payload, handlePost, handleNotification, handleCommandTimings, err = b.Build(ctx)
 	})
 	if err != nil {
 		return log.Err(ctx, err, "Failed to build replay payload")
 	}
 
+	err = m.executePayload(ctx, d, intent, cfg, replayABI, payload, handlePost, handleNotification, handleCommandTimings)
+	if cached != nil {
+		cached.payload, cached.handlePost, cached.handleNotification, cached.handleCommandTimings =
+			payload, handlePost, handleNotification, handleCommandTimings
+		m.payloads.update(key, cached, err)
+	}
+	return err
+}
+
+// executePayload sends the payload to the device and executes it.
+func (m *manager) executePayload(
+	ctx context.Context,
+	d bind.Device,
+	intent Intent,
+	cfg Config,
+	replayABI *device.ABI,
+	payload gapir.Payload,
+	handlePost builder.PostDataHandler,
+	handleNotification builder.NotificationHandler,
+	handleCommandTimings builder.CommandTimingsHandler) error {
+
 	connection, err := m.gapir.Connect(ctx, d, replayABI)
 	if err != nil {
 		return log.Err(ctx, err, "Failed to connect to device")
@@ -202,6 +244,7 @@ func (m *manager) execute(
 			payload,
 			handlePost,
 			handleNotification,
+			handleCommandTimings,
 			connection,
 			replayABI.MemoryLayout,
 			d.Instance().GetConfiguration().GetOS(),
@@ -47,6 +47,12 @@ type stackItem struct {
 	idx int           // Index of the op that generated this.
 }
 
+// jump is a conditional jump instruction at the index at, skipping the
+// instructions up to the index end.
+type jump struct {
+	at, end int
+}
+
 type marker struct {
 	instruction int    // first instruction index for this marker
 	cmd         uint64 // the command identifier
@@ -56,6 +62,10 @@ type marker struct {
 // the replay virtual machine.
 type NotificationReader func(p gapir.Notification)
 
+// CommandTimingsReader reads the CPU time spent by the replay virtual machine
+// on each command label, received once the replay has been executed.
+type CommandTimingsReader func(t gapir.CommandTimings)
+
 // NotificationHandler handles the original Notification messages from the
 // replay virtual machine.
 type NotificationHandler func(p *gapir.Notification)
@@ -65,6 +75,10 @@ type NotificationHandler func(p *gapir.Notification)
 // the replay virual machine.
 type PostDataHandler func(p *gapir.PostData)
 
+// CommandTimingsHandler handles the original CommandTimings message from the
+// replay virtual machine.
+type CommandTimingsHandler func(t *gapir.CommandTimings)
+
 type postBackDecoder struct {
 	expectedSize int
 	decode       Postback
@@ -79,25 +93,27 @@ type Postback func(d binary.Reader, err error)
 // The builder has a number of methods for mutating the virtual machine stack,
 // invoking functions and posting back data.
 type Builder struct {
-	constantMemory      *constantEncoder
-	heap, temp          allocator
-	resourceIDToIdx     map[id.ID]uint32
-	threadIDToIdx       map[uint64]uint32
-	currentThreadID     uint64
-	pendingThreadID     uint64
-	resources           []*gapir.ResourceInfo
-	reservedMemory      memory.RangeList // Reserved memory ranges for regular data.
-	pointerMemory       memory.RangeList // Reserved memory ranges for the pointer table.
-	mappedMemory        mappedMemoryRangeList
-	instructions        []asm.Instruction
-	decoders            []postBackDecoder
-	notificationReaders []NotificationReader
-	stack               []stackItem
-	memoryLayout        *device.MemoryLayout
-	inCmd               bool   // true if between BeginCommand and CommitCommand/RevertCommand
-	cmdStart            int    // index of current commands's first instruction
-	pendingLabel        uint64 // label passed to BeginCommand written
-	lastLabel           uint64 // label of last CommitCommand written
+	constantMemory        *constantEncoder
+	heap, temp            allocator
+	resourceIDToIdx       map[id.ID]uint32
+	threadIDToIdx         map[uint64]uint32
+	currentThreadID       uint64
+	pendingThreadID       uint64
+	resources             []*gapir.ResourceInfo
+	reservedMemory        memory.RangeList // Reserved memory ranges for regular data.
+	pointerMemory         memory.RangeList // Reserved memory ranges for the pointer table.
+	mappedMemory          mappedMemoryRangeList
+	instructions          []asm.Instruction
+	jumps                 []jump
+	decoders              []postBackDecoder
+	notificationReaders   []NotificationReader
+	commandTimingsReaders []CommandTimingsReader
+	stack                 []stackItem
+	memoryLayout          *device.MemoryLayout
+	inCmd                 bool   // true if between BeginCommand and CommitCommand/RevertCommand
+	cmdStart              int    // index of current commands's first instruction
+	pendingLabel          uint64 // label passed to BeginCommand written
+	lastLabel             uint64 // label of last CommitCommand written
 
 	// Remappings is a map of a arbitrary keys to pointers. Typically, this is
 	// used as a map of observed values to values that are only known at replay
@@ -267,6 +283,12 @@ func (b *Builder) CommitCommand() {
 			break
 		}
 	}
+	// The trimmed no-ops may have been the last instructions skipped by jumps.
+	for i := len(b.jumps) - 1; i >= 0 && b.jumps[i].at >= b.cmdStart; i-- {
+		if b.jumps[i].end > len(b.instructions) {
+			b.jumps[i].end = len(b.instructions)
+		}
+	}
 	// Pop any remaining stack values
 	if pop > 0 {
 		b.instructions = append(b.instructions, asm.Pop{Count: pop})
@@ -298,6 +320,9 @@ func (b *Builder) RevertCommand(err error) {
 		}
 		b.instructions = b.instructions[:b.cmdStart]
 	}
+	for len(b.jumps) > 0 && b.jumps[len(b.jumps)-1].at >= b.cmdStart {
+		b.jumps = b.jumps[:len(b.jumps)-1]
+	}
 }
 
 // Buffer returns a pointer to a block of memory in holding the count number of
@@ -465,6 +490,100 @@ func (b *Builder) Post(addr value.Pointer, size uint64, p Postback) {
 	})
 }
 
+// Add pops and sums the top count values of the stack, which must all have the
+// same type, and then pushes the sum to the top of the stack.
+func (b *Builder) Add(count uint32) {
+	if count < 2 {
+		return
+	}
+	ty := b.peekStack().ty
+	b.popStackMulti(int(count))
+	b.pushStack(ty)
+	b.instructions = append(b.instructions, asm.Add{
+		Count: count,
+	})
+}
+
+// Mul pops and multiplies the top count values of the stack, which must all
+// have the same type, and then pushes the product to the top of the stack.
+func (b *Builder) Mul(count uint32) {
+	if count < 2 {
+		return
+	}
+	ty := b.peekStack().ty
+	b.popStackMulti(int(count))
+	b.pushStack(ty)
+	b.instructions = append(b.instructions, asm.Mul{
+		Count: count,
+	})
+}
+
+// LoadOffset pops the integer offset and then the address from the top of the
+// stack, and then pushes the value of type ty loaded from the address offset
+// by that many bytes.
+func (b *Builder) LoadOffset(ty protocol.Type) {
+	b.popStackMulti(2)
+	b.pushStack(ty)
+	b.instructions = append(b.instructions, asm.LoadOffset{
+		DataType: ty,
+	})
+}
+
+// StoreOffset pops the integer offset, the address and then the value from the
+// top of the stack, and then writes the value to the address offset by that
+// many bytes.
+func (b *Builder) StoreOffset() {
+	b.popStackMulti(3)
+	b.instructions = append(b.instructions, asm.StoreOffset{})
+}
+
+// If pops the value from the top of the stack, and then calls f to build the
+// instructions that are only replayed if the value is not zero. f must leave
+// the values pushed before the call to If on the stack, and must not push
+// values it does not pop. f must not post data, write resources or register
+// notification readers, as the replay would then skip the posts, resources
+// and notifications expected by the builder.
+func (b *Builder) If(f func()) {
+	b.jumpOver(asm.JumpZ{}, f)
+}
+
+// IfZero is like If, except that the instructions built by f are only
+// replayed if the value is zero.
+func (b *Builder) IfZero(f func()) {
+	b.jumpOver(asm.JumpNZ{}, f)
+}
+
+func (b *Builder) jumpOver(i asm.Instruction, f func()) {
+	if !b.inCmd {
+		panic("Conditional instructions built without a call to BeginCommand")
+	}
+	b.popStack()
+	depth := len(b.stack)
+	decoders, readers, resources := len(b.decoders), len(b.notificationReaders), len(b.resources)
+	idx := len(b.jumps)
+	b.jumps = append(b.jumps, jump{at: len(b.instructions)})
+	b.instructions = append(b.instructions, i)
+	f()
+	if !b.inCmd {
+		panic("Conditional instructions ended the command")
+	}
+	if len(b.stack) != depth {
+		panic(fmt.Errorf("Conditional instructions changed the stack size from %d to %d", depth, len(b.stack)))
+	}
+	if len(b.decoders) != decoders {
+		panic("Conditional instructions posted data")
+	}
+	if len(b.notificationReaders) != readers {
+		panic("Conditional instructions registered a notification reader")
+	}
+	if len(b.resources) != resources {
+		panic("Conditional instructions wrote a resource")
+	}
+	// The number of skipped opcodes is only known once the instructions are
+	// encoded by Build.
+	b.jumps[idx].end = len(b.instructions)
+}
+
 // Push pushes val to the top of the stack.
 func (b *Builder) Push(val value.Value) {
 	if p, ok := val.(value.Pointer); ok {
@@ -560,6 +679,13 @@ func (b *Builder) RegisterNotificationReader(reader NotificationReader) {
 	b.notificationReaders = append(b.notificationReaders, reader)
 }
 
+// RegisterCommandTimingsReader makes the replay virtual machine measure the
+// CPU time spent on each command label, and registers the reader of these
+// timings.
+func (b *Builder) RegisterCommandTimingsReader(reader CommandTimingsReader) {
+	b.commandTimingsReaders = append(b.commandTimingsReaders, reader)
+}
+
 // Export compiles the replay instructions, returning a Payload that can be
 // sent to the replay virtual-machine.
 func (b *Builder) Export(ctx context.Context) (gapir.Payload, error) {
@@ -567,7 +693,7 @@ func (b *Builder) Export(ctx context.Context) (gapir.Payload, error) {
 	defer status.Finish(ctx)
 	ctx = log.Enter(ctx, "Export")
 
-	payload, _, _, err := b.Build(ctx)
+	payload, _, _, _, err := b.Build(ctx)
 	if err != nil {
 		return payload, err
 	}
@@ -581,9 +707,10 @@ func (b *Builder) Export(ctx context.Context) (gapir.Payload, error) {
 }
 
 // Build compiles the replay instructions, returning a Payload that can be
-// sent to the replay virtual-machine and a PostDataHandler for interpreting
-// the responses.
-func (b *Builder) Build(ctx context.Context) (gapir.Payload, PostDataHandler, NotificationHandler, error) {
+// sent to the replay virtual-machine and the PostDataHandler,
+// NotificationHandler and CommandTimingsHandler for interpreting the
+// responses.
+func (b *Builder) Build(ctx context.Context) (gapir.Payload, PostDataHandler, NotificationHandler, CommandTimingsHandler, error) {
 	ctx = status.Start(ctx, "Build")
 	defer status.Finish(ctx)
 	ctx = log.Enter(ctx, "Build")
@@ -601,15 +728,63 @@ func (b *Builder) Build(ctx context.Context) (gapir.Payload, PostDataHandler, No
 
 	vml := b.layoutVolatileMemory(ctx, w)
 
-	for _, i := range b.instructions {
+	// The jumps are encoded with the number of skipped opcodes once the last
+	// skipped instruction is encoded. Jumps are nested, so the pending jumps
+	// end in the reverse order.
+	type pendingJump struct {
+		jump
+		offset int // The offset of the jump opcode in opcodes.
+	}
+	jumps, pending := b.jumps, []pendingJump{}
+	resolveJumps := func(idx int) error {
+		for len(pending) > 0 && pending[len(pending)-1].end <= idx {
+			j := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			count := (opcodes.Len()-j.offset)/4 - 1
+			if count > 0x3ffffff {
+				return fmt.Errorf("Jump over %d opcodes exceeds 26 bits", count)
+			}
+			var i asm.Instruction
+			switch ji := b.instructions[j.at].(type) {
+			case asm.JumpZ:
+				ji.Count = uint32(count)
+				i = ji
+			case asm.JumpNZ:
+				ji.Count = uint32(count)
+				i = ji
+			default:
+				return fmt.Errorf("Instruction %T is not a jump", ji)
+			}
+			buf := &bytes.Buffer{}
+			if err := i.Encode(vml, endian.Writer(buf, byteOrder)); err != nil {
+				return err
+			}
+			copy(opcodes.Bytes()[j.offset:], buf.Bytes())
+		}
+		return nil
+	}
+
+	for idx, i := range b.instructions {
 		if label, ok := i.(asm.Label); ok {
 			id = label.Value
 		}
+		if err := resolveJumps(idx); err != nil {
+			err = fmt.Errorf("Encode jump failed for command with id %v: %v", id, err)
+			return gapir.Payload{}, nil, nil, nil, err
+		}
+		if len(jumps) > 0 && jumps[0].at == idx {
+			pending = append(pending, pendingJump{jumps[0], opcodes.Len()})
+			jumps = jumps[1:]
+		}
 		if err := i.Encode(vml, w); err != nil {
 			err = fmt.Errorf("Encode %T failed for command with id %v: %v", i, id, err)
-			return gapir.Payload{}, nil, nil, err
+			return gapir.Payload{}, nil, nil, nil, err
 		}
 	}
+	if err := resolveJumps(len(b.instructions)); err != nil {
+		err = fmt.Errorf("Encode jump failed for command with id %v: %v", id, err)
+		return gapir.Payload{}, nil, nil, nil, err
+	}
 
 	payload := gapir.Payload{
 		StackSize:          uint32(512), // TODO: Calculate stack size
@@ -617,6 +792,7 @@ func (b *Builder) Build(ctx context.Context) (gapir.Payload, PostDataHandler, No
 		Constants:          b.constantMemory.data,
 		Resources:          b.resources,
 		Opcodes:            opcodes.Bytes(),
+		TimeCommands:       len(b.commandTimingsReaders) > 0,
 	}
 
 	if config.DebugReplayBuilder {
@@ -672,7 +848,20 @@ func (b *Builder) Build(ctx context.Context) (gapir.Payload, PostDataHandler, No
 		})
 	}
 
-	return payload, handlePost, handleNotification, nil
+	// The command timings are read synchronously, as they are the last
+	// response of the replay.
+	timingsReaders := b.commandTimingsReaders
+	handleCommandTimings := func(t *gapir.CommandTimings) {
+		if t == nil {
+			log.E(ctx, "Cannot handle nil CommandTimings")
+			return
+		}
+		for _, r := range timingsReaders {
+			r(*t)
+		}
+	}
+
+	return payload, handlePost, handleNotification, handleCommandTimings, nil
 }
 
 const ErrInvalidResource = fault.Const("Invaid resource")
@@ -15,6 +15,7 @@
 package builder
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/google/gapid/core/assert"
@@ -24,6 +25,7 @@ import (
 	"github.com/google/gapid/core/os/device"
 	"github.com/google/gapid/gapis/memory"
 	"github.com/google/gapid/gapis/replay/asm"
+	"github.com/google/gapid/gapis/replay/opcode"
 	"github.com/google/gapid/gapis/replay/protocol"
 	"github.com/google/gapid/gapis/replay/value"
 )
@@ -322,3 +324,50 @@ func TestMapMemory(t *testing.T) {
 		assert.For(ctx, "inst").ThatSlice(b.instructions).Equals(test.expected)
 	}
 }
+
+func TestIf(t *testing.T) {
+	ctx := log.Testing(t)
+	b := New(device.Little32)
+	b.BeginCommand(10, 0)
+	b.Load(protocol.Type_Uint32, value.VolatilePointer(0x10))
+	b.If(func() {
+		b.Push(value.U32(0x123456))
+		b.Store(value.VolatilePointer(0x20))
+		b.Push(value.Bool(true))
+		b.IfZero(func() {
+			b.Call(FunctionInfo{0, 123, protocol.Type_Void, 0})
+		})
+	})
+	b.CommitCommand()
+
+	payload, _, _, _, err := b.Build(ctx)
+	if !assert.For(ctx, "Build").ThatError(err).Succeeded() {
+		return
+	}
+	got, err := opcode.Disassemble(bytes.NewReader(payload.Opcodes), device.LittleEndian)
+	assert.For(ctx, "Disassemble").ThatError(err).Succeeded()
+	assert.For(ctx, "opcodes").ThatSlice(got).Equals([]opcode.Opcode{
+		opcode.Label{Value: 10},
+		opcode.LoadV{DataType: protocol.Type_Uint32, Address: 0x10},
+		opcode.JumpZ{Count: 6},
+		opcode.PushI{DataType: protocol.Type_Uint32, Value: 0},
+		opcode.Extend{Value: 0x123456},
+		opcode.StoreV{Address: 0x20},
+		opcode.PushI{DataType: protocol.Type_Bool, Value: 1},
+		opcode.JumpNZ{Count: 1},
+		opcode.Call{FunctionID: 123},
+	})
+}
+
+func TestIfPostPanics(t *testing.T) {
+	ctx := log.Testing(t)
+	b := New(device.Little32)
+	b.BeginCommand(10, 0)
+	b.Load(protocol.Type_Uint32, value.VolatilePointer(0x10))
+	defer func() {
+		assert.For(ctx, "recover").That(recover()).Equals("Conditional instructions posted data")
+	}()
+	b.If(func() {
+		b.Post(value.VolatilePointer(0x20), 4, func(binary.Reader, error) {})
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// GetCommandTimings replays the trace on the device and returns the CPU time
+// spent by the replay device on each command, in the order of the commands.
+// It returns no timings if none of the APIs of the capture can measure them.
+func GetCommandTimings(ctx context.Context, capturePath *path.Capture, device *path.Device) ([]CommandTiming, error) {
+	c, err := capture.ResolveFromPath(ctx, capturePath)
+	if err != nil {
+		return nil, err
+	}
+
+	intent := Intent{
+		Capture: capturePath,
+		Device:  device,
+	}
+	mgr := GetManager(ctx)
+	hints := &service.UsageHints{Background: true}
+	for _, a := range c.APIs {
+		if qi, ok := a.(QueryCommandTimings); ok {
+			return qi.QueryCommandTimings(ctx, intent, mgr, hints)
+		}
+	}
+	return nil, nil
+}
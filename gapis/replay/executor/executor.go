@@ -32,11 +32,12 @@ import (
 )
 
 type executor struct {
-	payload            gapir.Payload
-	handlePost         builder.PostDataHandler
-	handleNotification builder.NotificationHandler
-	memoryLayout       *device.MemoryLayout
-	OS                 *device.OS
+	payload              gapir.Payload
+	handlePost           builder.PostDataHandler
+	handleNotification   builder.NotificationHandler
+	handleCommandTimings builder.CommandTimingsHandler
+	memoryLayout         *device.MemoryLayout
+	OS                   *device.OS
 }
 
 // Execute sends the replay payload for execution on the target replay device
@@ -49,6 +50,7 @@ func Execute(
 	payload gapir.Payload,
 	handlePost builder.PostDataHandler,
 	handleNotification builder.NotificationHandler,
+	handleCommandTimings builder.CommandTimingsHandler,
 	connection *gapir.Connection,
 	memoryLayout *device.MemoryLayout,
 	os *device.OS) error {
@@ -59,11 +61,12 @@ func Execute(
 	// The memoryLayout is specific to the ABI of the requested capture,
 	// while the OS is not. Thus a device.Configuration is not applicable here.
 	return executor{
-		payload:            payload,
-		handlePost:         handlePost,
-		handleNotification: handleNotification,
-		memoryLayout:       memoryLayout,
-		OS:                 os,
+		payload:              payload,
+		handlePost:           handlePost,
+		handleNotification:   handleNotification,
+		handleCommandTimings: handleCommandTimings,
+		memoryLayout:         memoryLayout,
+		OS:                   os,
 	}.execute(ctx, connection)
 }
 
@@ -106,6 +109,15 @@ func (e executor) HandleNotification(ctx context.Context, notification *gapir.No
 	return nil
 }
 
+// HandleCommandTimings implements gapir.ReplayResponseHandler interface.
+func (e executor) HandleCommandTimings(ctx context.Context, timings *gapir.CommandTimings, conn *gapir.Connection) error {
+	ctx = status.Start(ctx, "Command Timings (count: %d)", len(timings.GetTimings()))
+	defer status.Finish(ctx)
+
+	e.handleCommandTimings(timings)
+	return nil
+}
+
 // HandleCrashDump implements gapir.ReplayResponseHandler interface.
 func (e executor) HandleCrashDump(ctx context.Context, dump *gapir.CrashDump, conn *gapir.Connection) error {
 	if dump == nil {
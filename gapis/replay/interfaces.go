@@ -51,12 +51,14 @@ type QueryIssues interface {
 }
 
 // QueryTimestamps is the interface implemented by types that can
-// return the timestamps of the execution of commands
+// return the timestamps of the execution of commands, and optionally of
+// the render passes and the draws.
 type QueryTimestamps interface {
 	QueryTimestamps(
 		ctx context.Context,
 		intent Intent,
 		mgr Manager,
+		opts *service.TimestampsOptions,
 		hints *service.UsageHints) ([]Timestamp, error)
 }
 
@@ -78,6 +80,52 @@ type QueryFramebufferAttachment interface {
 		hints *service.UsageHints) (*image.Data, error)
 }
 
+// QueryOverdraw is the interface implemented by types that can return the
+// per-pixel overdraw counts of the draws in a range of commands of a capture.
+type QueryOverdraw interface {
+	QueryOverdraw(
+		ctx context.Context,
+		intent Intent,
+		mgr Manager,
+		first, after []uint64,
+		disableReplayOptimization bool,
+		hints *service.UsageHints) (*image.Data, error)
+}
+
+// QueryPipelineStatistics is the interface implemented by types that can
+// return the pipeline statistics of draws of a capture, in the order of the
+// draws.
+type QueryPipelineStatistics interface {
+	QueryPipelineStatistics(
+		ctx context.Context,
+		intent Intent,
+		mgr Manager,
+		draws [][]uint64,
+		hints *service.UsageHints) ([]*service.DrawPipelineStatistics, error)
+}
+
+// QueryDispatchBuffers is the interface implemented by types that can return
+// the contents of the storage buffers bound to a dispatch of a capture, right
+// before and right after the dispatch.
+type QueryDispatchBuffers interface {
+	QueryDispatchBuffers(
+		ctx context.Context,
+		intent Intent,
+		mgr Manager,
+		dispatch []uint64,
+		hints *service.UsageHints) ([]*service.DispatchBuffer, error)
+}
+
+// QueryCommandTimings is the interface implemented by types that can return
+// the CPU time spent by the replay device on each command of a capture.
+type QueryCommandTimings interface {
+	QueryCommandTimings(
+		ctx context.Context,
+		intent Intent,
+		mgr Manager,
+		hints *service.UsageHints) ([]CommandTiming, error)
+}
+
 // Issue represents a single replay issue reported by QueryIssues.
 type Issue struct {
 	Command  api.CmdID        // The command that reported the issue.
@@ -93,4 +141,20 @@ type Timestamp struct {
 	End *path.Command
 	// The duration in nanoseconds between the two commands specified.
 	Time time.Duration
+	// The GPU time at which the measurement begins. Only comparable to the
+	// start of the other measurements of the same replay.
+	Start time.Duration
+	// True if the commands are the begin and the end of a render pass.
+	RenderPass bool
+	// True if the commands are both the same draw.
+	Draw bool
+}
+
+// CommandTiming represents the CPU time spent by the replay device on a
+// command, from reaching the command to reaching the next one.
+type CommandTiming struct {
+	// The command that was measured.
+	Command api.CmdID
+	// The CPU time spent on the command.
+	Time time.Duration
 }
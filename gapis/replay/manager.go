@@ -56,6 +56,7 @@ type manager struct {
 	gapir      *gapir.Client
 	schedulers map[id.ID]*scheduler.Scheduler
 	mutex      sync.Mutex // guards schedulers
+	payloads   payloadCache
 }
 
 // batchKey is used as a key for the batch that's being formed.
@@ -310,6 +310,64 @@ func (c SwitchThread) Encode(w binary.Writer) error {
 	return w.Error()
 }
 
+// Mul represents the MUL virtual machine opcode.
+type Mul struct {
+	Count uint32 // Number of top value stack elements to pop and multiply.
+}
+
+func (c Mul) String() string { return fmt.Sprintf("Mul(Count: 0x%x)", c.Count) }
+
+func (c Mul) Encode(w binary.Writer) error {
+	w.Uint32(packCX(protocol.OpMul, c.Count))
+	return w.Error()
+}
+
+// LoadOffset represents the LOAD_OFFSET virtual machine opcode.
+type LoadOffset struct {
+	DataType protocol.Type // The value type to load.
+}
+
+func (c LoadOffset) String() string { return fmt.Sprintf("LoadOffset(Type: %v)", c.DataType) }
+
+func (c LoadOffset) Encode(w binary.Writer) error {
+	w.Uint32(packCYZ(protocol.OpLoadOffset, uint32(c.DataType), 0))
+	return w.Error()
+}
+
+// StoreOffset represents the STORE_OFFSET virtual machine opcode.
+type StoreOffset struct{}
+
+func (c StoreOffset) String() string { return "StoreOffset" }
+
+func (c StoreOffset) Encode(w binary.Writer) error {
+	w.Uint32(packC(protocol.OpStoreOffset))
+	return w.Error()
+}
+
+// JumpZ represents the JUMP_Z virtual machine opcode.
+type JumpZ struct {
+	Count uint32 // Number of following opcodes to skip if the value is zero.
+}
+
+func (c JumpZ) String() string { return fmt.Sprintf("JumpZ(Count: %d)", c.Count) }
+
+func (c JumpZ) Encode(w binary.Writer) error {
+	w.Uint32(packCX(protocol.OpJumpZ, c.Count))
+	return w.Error()
+}
+
+// JumpNZ represents the JUMP_NZ virtual machine opcode.
+type JumpNZ struct {
+	Count uint32 // Number of following opcodes to skip if the value is not zero.
+}
+
+func (c JumpNZ) String() string { return fmt.Sprintf("JumpNZ(Count: %d)", c.Count) }
+
+func (c JumpNZ) Encode(w binary.Writer) error {
+	w.Uint32(packCX(protocol.OpJumpNZ, c.Count))
+	return w.Error()
+}
+
 // Decode returns the opcode decoded from decoder d.
 func Decode(r binary.Reader) (Opcode, error) {
 	i := r.Uint32()
@@ -352,6 +410,16 @@ func Decode(r binary.Reader) (Opcode, error) {
 		return Label{Value: unpackX(i)}, nil
 	case protocol.OpSwitchThread:
 		return SwitchThread{Index: unpackX(i)}, nil
+	case protocol.OpMul:
+		return Mul{Count: unpackX(i)}, nil
+	case protocol.OpLoadOffset:
+		return LoadOffset{DataType: protocol.Type(unpackY(i))}, nil
+	case protocol.OpStoreOffset:
+		return StoreOffset{}, nil
+	case protocol.OpJumpZ:
+		return JumpZ{Count: unpackX(i)}, nil
+	case protocol.OpJumpNZ:
+		return JumpNZ{Count: unpackX(i)}, nil
 	default:
 		return nil, fmt.Errorf("Unknown opcode with code %v", int(code))
 	}
@@ -374,3 +442,8 @@ func (Extend) isOpcode()       {}
 func (Add) isOpcode()          {}
 func (Label) isOpcode()        {}
 func (SwitchThread) isOpcode() {}
+func (Mul) isOpcode()          {}
+func (LoadOffset) isOpcode()   {}
+func (StoreOffset) isOpcode()  {}
+func (JumpZ) isOpcode()        {}
+func (JumpNZ) isOpcode()       {}
@@ -0,0 +1,193 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/os/device"
+	gapir "github.com/google/gapid/gapir/client"
+	"github.com/google/gapid/gapis/replay/builder"
+)
+
+const (
+	// maxCachedPayloads is the number of payloads kept by the payload cache.
+	maxCachedPayloads = 32
+	// payloadResultsTimeout is how long the results of an execution of a
+	// cached payload are waited for, before the payload is evicted.
+	payloadResultsTimeout = 10 * time.Second
+)
+
+// payloadCache holds the payloads built for the replay passes of cacheable
+// requests, keyed by the capture, the device, the config and the requests.
+type payloadCache struct {
+	mutex   sync.Mutex
+	entries map[id.ID]*cachedPayload
+	order   []id.ID // The keys of the entries, oldest first.
+}
+
+// cachedPayload is a payload with its post data, notification and command
+// timings handlers.
+// The handlers call the results of the requests through the payload, which
+// forwards them to the results of the requests of the current execution.
+type cachedPayload struct {
+	payload              gapir.Payload
+	handlePost           builder.PostDataHandler
+	handleNotification   builder.NotificationHandler
+	handleCommandTimings builder.CommandTimingsHandler
+
+	mutex     sync.Mutex // guards the fields below
+	results   []Result
+	remaining int
+	done      chan struct{}
+}
+
+// payloadKey returns the key of the payload of the requests, and true if all
+// the requests are cacheable. The config is part of the keys of the requests,
+// so there must be at least one request.
+func payloadKey(captureID, deviceID id.ID, abi *device.ABI, cfg Config, generator Generator, requests []RequestAndResult) (id.ID, bool) {
+	if len(requests) == 0 {
+		return id.ID{}, false
+	}
+	keys := [][]byte{[]byte(fmt.Sprintf("%v %v %q %T", captureID, deviceID, abi.Name, generator))}
+	for _, r := range requests {
+		c, ok := r.Request.(CacheableRequest)
+		if !ok {
+			return id.ID{}, false
+		}
+		key, ok := c.PayloadKey(cfg)
+		if !ok {
+			return id.ID{}, false
+		}
+		keys = append(keys, key[:])
+	}
+	return id.OfBytes(keys...), true
+}
+
+func (c *payloadCache) get(key id.ID) *cachedPayload {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.entries[key]
+}
+
+// update adds the payload to the cache once all the results of the requests
+// of its execution have been called, or evicts it from the cache if the
+// execution failed.
+func (c *payloadCache) update(key id.ID, p *cachedPayload, err error) {
+	if err == nil && p.wait(payloadResultsTimeout) {
+		c.add(key, p)
+	} else {
+		c.remove(key)
+	}
+}
+
+func (c *payloadCache) add(key id.ID, p *cachedPayload) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries == nil {
+		c.entries = map[id.ID]*cachedPayload{}
+	}
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = p
+	for len(c.order) > maxCachedPayloads {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+func (c *payloadCache) remove(key id.ID) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		return
+	}
+	delete(c.entries, key)
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// bind makes the results of the requests the ones called by the handlers of
+// the payload, and returns the requests with results calling through the
+// payload, to generate the payload with.
+func (p *cachedPayload) bind(requests []RequestAndResult) []RequestAndResult {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.results = make([]Result, len(requests))
+	p.remaining = len(requests)
+	p.done = make(chan struct{})
+	out := make([]RequestAndResult, len(requests))
+	for i, r := range requests {
+		i := i
+		p.results[i] = r.Result
+		out[i] = RequestAndResult{
+			Request: r.Request,
+			Result:  func(val interface{}, err error) { p.result(i, val, err) },
+		}
+	}
+	if len(requests) == 0 {
+		close(p.done)
+	}
+	return out
+}
+
+// result forwards the result of the i'th request to the result of the
+// current execution, once.
+func (p *cachedPayload) result(i int, val interface{}, err error) {
+	p.mutex.Lock()
+	res := p.results[i]
+	p.results[i] = nil
+	if res != nil {
+		p.remaining--
+		if p.remaining == 0 {
+			close(p.done)
+		}
+	}
+	p.mutex.Unlock()
+	if res != nil {
+		res(val, err)
+	}
+}
+
+// pending returns the number of results of the current execution that have
+// not been called yet.
+func (p *cachedPayload) pending() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.remaining
+}
+
+// wait returns true once all the results of the current execution have been
+// called, or false if they have not after the timeout. The handlers decode the
+// post data asynchronously, so the results may be called after the execution.
+func (p *cachedPayload) wait(timeout time.Duration) bool {
+	p.mutex.Lock()
+	done := p.done
+	p.mutex.Unlock()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
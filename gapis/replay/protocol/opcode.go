@@ -37,6 +37,11 @@ const (
 	OpAdd          = Opcode(14)
 	OpLabel        = Opcode(15)
 	OpSwitchThread = Opcode(16)
+	OpMul          = Opcode(17)
+	OpLoadOffset   = Opcode(18)
+	OpStoreOffset  = Opcode(19)
+	OpJumpZ        = Opcode(20)
+	OpJumpNZ       = Opcode(21)
 )
 
 // String returns the human-readable name of the opcode.
@@ -76,6 +81,16 @@ func (t Opcode) String() string {
 		return "Label"
 	case OpSwitchThread:
 		return "SwitchThread"
+	case OpMul:
+		return "Mul"
+	case OpLoadOffset:
+		return "LoadOffset"
+	case OpStoreOffset:
+		return "StoreOffset"
+	case OpJumpZ:
+		return "JumpZ"
+	case OpJumpNZ:
+		return "JumpNZ"
 	default:
 		panic(fmt.Errorf("Unknown Opcode %d", uint32(t)))
 	}
@@ -17,6 +17,7 @@ package replay
 import (
 	"context"
 
+	"github.com/google/gapid/core/data/id"
 	"github.com/google/gapid/core/os/device"
 	"github.com/google/gapid/gapis/api/transform"
 	"github.com/google/gapid/gapis/capture"
@@ -60,6 +61,19 @@ type Config interface{}
 // specific command.
 type Request interface{}
 
+// CacheableRequest is the optional interface implemented by the requests of
+// which the postbacks are decoded without any state other than the request.
+// The payload of a replay pass of which all the requests are cacheable is kept
+// and executed again for the same requests, skipping the generation of the
+// payload.
+type CacheableRequest interface {
+	Request
+	// PayloadKey returns the key of the payload of the request with the
+	// config, hashed from the fields of both, and true if the payload can be
+	// cached. Equal requests with equal configs must return the same key.
+	PayloadKey(cfg Config) (id.ID, bool)
+}
+
 // Result is the function called for the result of a request.
 // One of val and err must be nil.
 type Result func(val interface{}, err error)
@@ -23,8 +23,9 @@ import (
 	"github.com/google/gapid/gapis/service/path"
 )
 
-// GetTimestamps replays the trace and return the start and end timestamps for each commandbuffers
-func GetTimestamps(ctx context.Context, capturePath *path.Capture, device *path.Device) (*service.GetTimestampsResponse, error) {
+// GetTimestamps replays the trace and return the start and end timestamps for each commandbuffers,
+// and for each render pass and draw if requested by the options.
+func GetTimestamps(ctx context.Context, capturePath *path.Capture, device *path.Device, opts *service.TimestampsOptions) (*service.GetTimestampsResponse, error) {
 	c, err := capture.ResolveFromPath(ctx, capturePath)
 	if err != nil {
 		return nil, err
@@ -41,7 +42,7 @@ func GetTimestamps(ctx context.Context, capturePath *path.Capture, device *path.
 		hints := &service.UsageHints{Background: true}
 		for _, a := range c.APIs {
 			if qi, ok := a.(QueryTimestamps); ok {
-				ts, err = qi.QueryTimestamps(ctx, intent, mgr, hints)
+				ts, err = qi.QueryTimestamps(ctx, intent, mgr, opts, hints)
 				if err != nil {
 					log.E(ctx, "Query timestamps failed.")
 					continue
@@ -57,9 +58,12 @@ func GetTimestamps(ctx context.Context, capturePath *path.Capture, device *path.
 	var timestamps service.Timestamps
 	for _, t := range ts {
 		item := &service.TimestampsItem{
-			Begin:             t.Begin,
-			End:               t.End,
-			TimeInNanoseconds: uint64(t.Time),
+			Begin:              t.Begin,
+			End:                t.End,
+			TimeInNanoseconds:  uint64(t.Time),
+			StartInNanoseconds: uint64(t.Start),
+			RenderPass:         t.RenderPass,
+			Draw:               t.Draw,
 		}
 		timestamps.Timestamps = append(timestamps.Timestamps, item)
 	}
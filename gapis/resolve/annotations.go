@@ -0,0 +1,235 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type annotationStoreKeyTy string
+
+const annotationStoreKey = annotationStoreKeyTy("annotationStore")
+
+// AnnotationStore holds the user annotations and report configurations of the
+// captures, by capture ID. The annotations and report configuration of each
+// capture are saved to the database records named after the capture ID, so
+// they are kept across the sessions if the database keeps records.
+type AnnotationStore struct {
+	mutex sync.Mutex
+	// The annotations and report configurations are never modified once
+	// stored, they are replaced.
+	captures map[id.ID]*service.Annotations
+	reports  map[id.ID]*service.ReportConfig
+}
+
+// NewAnnotationStore returns a new, empty AnnotationStore.
+func NewAnnotationStore() *AnnotationStore {
+	return &AnnotationStore{
+		captures: map[id.ID]*service.Annotations{},
+		reports:  map[id.ID]*service.ReportConfig{},
+	}
+}
+
+// PutAnnotationStore amends a Context by attaching the annotation store.
+func PutAnnotationStore(ctx context.Context, s *AnnotationStore) context.Context {
+	return keys.WithValue(ctx, annotationStoreKey, s)
+}
+
+// getAnnotationStore returns the annotation store attached to the Context, or
+// nil if there is none.
+func getAnnotationStore(ctx context.Context) *AnnotationStore {
+	s, _ := ctx.Value(annotationStoreKey).(*AnnotationStore)
+	return s
+}
+
+// annotationRecord returns the name of the database record of the given capture of the
+// given kind.
+func annotationRecord(c id.ID, kind string) string {
+	return kind + "/" + c.String()
+}
+
+// load decodes the database record of the given capture of the given kind
+// into out, if the record exists. out is reset if the record cannot be
+// decoded.
+func (s *AnnotationStore) load(ctx context.Context, c id.ID, kind string, out proto.Message) {
+	data, err := database.LoadRecord(ctx, annotationRecord(c, kind))
+	switch {
+	case err != nil:
+		log.W(ctx, "Could not read the %v of capture %v: %v", kind, c, err)
+	case data != nil:
+		if err := proto.Unmarshal(data, out); err != nil {
+			log.W(ctx, "Could not decode the %v of capture %v: %v", kind, c, err)
+			out.Reset()
+		}
+	}
+}
+
+// save encodes msg to the database record of the given capture of the given
+// kind.
+func (s *AnnotationStore) save(ctx context.Context, c id.ID, kind string, msg proto.Message) error {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return database.StoreRecord(ctx, annotationRecord(c, kind), data)
+}
+
+// get returns the annotations of the given capture, loading them from the
+// database the first time. It must be called with the mutex locked.
+func (s *AnnotationStore) get(ctx context.Context, c id.ID) *service.Annotations {
+	if a, ok := s.captures[c]; ok {
+		return a
+	}
+	a := &service.Annotations{}
+	s.load(ctx, c, "annotations", a)
+	s.captures[c] = a
+	return a
+}
+
+// set replaces the annotations of the given capture, and saves them to the
+// database. It must be called with the mutex locked.
+func (s *AnnotationStore) set(ctx context.Context, c id.ID, a *service.Annotations) error {
+	s.captures[c] = a
+	return s.save(ctx, c, "annotations", a)
+}
+
+// getReportConfig returns the report configuration of the given capture,
+// loading it from the database the first time. It must be called with
+// the mutex locked.
+func (s *AnnotationStore) getReportConfig(ctx context.Context, c id.ID) *service.ReportConfig {
+	if r, ok := s.reports[c]; ok {
+		return r
+	}
+	r := &service.ReportConfig{}
+	s.load(ctx, c, "reports", r)
+	s.reports[c] = r
+	return r
+}
+
+// setReportConfig replaces the report configuration of the given capture, and
+// saves it to the database. It must be called with the mutex locked.
+func (s *AnnotationStore) setReportConfig(ctx context.Context, c id.ID, r *service.ReportConfig) error {
+	s.reports[c] = r
+	return s.save(ctx, c, "reports", r)
+}
+
+// sameTarget returns true if the two annotations are attached to the same
+// command or resource.
+func sameTarget(a, b *service.Annotation) bool {
+	if len(a.Command) > 0 || len(b.Command) > 0 {
+		return api.SubCmdIdx(a.Command).Equals(api.SubCmdIdx(b.Command))
+	}
+	return a.Handle == b.Handle
+}
+
+// SetAnnotation attaches the annotation to its command or resource of the
+// given capture, replacing the previous one. An annotation without name,
+// notes and tags removes the previous one.
+func SetAnnotation(ctx context.Context, c *path.Capture, a *service.Annotation) error {
+	s := getAnnotationStore(ctx)
+	if s == nil {
+		return &service.ErrDataUnavailable{
+			Reason: messages.ErrMessage("Annotations are not supported by the server"),
+		}
+	}
+	switch {
+	case len(a.Command) > 0 && a.Handle != "":
+		return &service.ErrInvalidArgument{
+			Reason: messages.ErrMessage("The annotation is attached to both a command and a resource"),
+		}
+	case len(a.Command) > 0:
+		if _, err := Cmd(ctx, c.Command(a.Command[0], a.Command[1:]...), nil); err != nil {
+			return err
+		}
+	case a.Handle == "":
+		return &service.ErrInvalidArgument{
+			Reason: messages.ErrMessage("The annotation is not attached to a command nor a resource"),
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old := s.get(ctx, c.ID.ID())
+	out := &service.Annotations{List: make([]*service.Annotation, 0, len(old.List)+1)}
+	for _, o := range old.List {
+		if !sameTarget(o, a) {
+			out.List = append(out.List, o)
+		}
+	}
+	if a.Name != "" || a.Notes != "" || len(a.Tags) > 0 {
+		out.List = append(out.List, proto.Clone(a).(*service.Annotation))
+	}
+	if err := s.set(ctx, c.ID.ID(), out); err != nil {
+		return log.Err(ctx, err, "Couldn't save the annotations")
+	}
+	return nil
+}
+
+// Annotations returns all the annotations of the given capture.
+func Annotations(ctx context.Context, c *path.Capture) (*service.Annotations, error) {
+	s := getAnnotationStore(ctx)
+	if s == nil {
+		return &service.Annotations{}, nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.get(ctx, c.ID.ID()), nil
+}
+
+// commandAnnotation returns the annotation of the given command, or nil if
+// there is none.
+func commandAnnotation(ctx context.Context, c *path.Capture, indices []uint64) *service.Annotation {
+	all, _ := Annotations(ctx, c)
+	for _, a := range all.List {
+		if len(a.Command) > 0 && api.SubCmdIdx(a.Command).Equals(api.SubCmdIdx(indices)) {
+			return a
+		}
+	}
+	return nil
+}
+
+// annotateResources returns the resources with their annotations. The given
+// resources are not modified, as they are shared by the database.
+func annotateResources(ctx context.Context, c *path.Capture, res *service.Resources) *service.Resources {
+	all, _ := Annotations(ctx, c)
+	byHandle := map[string]*service.Annotation{}
+	for _, a := range all.List {
+		if len(a.Command) == 0 {
+			byHandle[a.Handle] = a
+		}
+	}
+	if len(byHandle) == 0 {
+		return res
+	}
+	out := proto.Clone(res).(*service.Resources)
+	for _, t := range out.Types {
+		for _, r := range t.Resources {
+			r.Annotation = byHandle[r.Handle]
+		}
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestAnnotations(t *testing.T) {
+	ctx := log.Testing(t)
+	dir, err := ioutil.TempDir("", "annotations")
+	if !assert.For(ctx, "TempDir").ThatError(err).Succeeded() {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	database.GetPersistent(ctx).SetPersistentDirectory(dir)
+	c := path.NewCapture(id.OfString("capture"))
+	ctx = PutAnnotationStore(ctx, NewAnnotationStore())
+	for _, a := range []*service.Annotation{
+		{Handle: "Buffer<1>", Name: "vertices"},
+		{Handle: "Image<2>", Tags: []string{"shadow"}},
+		{Handle: "Buffer<1>", Name: "indices", Notes: "renamed"},
+		{Handle: "Image<2>"},
+	} {
+		assert.For(ctx, "SetAnnotation").ThatError(SetAnnotation(ctx, c, a)).Succeeded()
+	}
+	err = SetAnnotation(ctx, c, &service.Annotation{Name: "nothing"})
+	assert.For(ctx, "Unattached annotation").ThatError(err).Failed()
+
+	// A new store loads the annotations saved by the previous one.
+	ctx = PutAnnotationStore(ctx, NewAnnotationStore())
+	got, err := Annotations(ctx, c)
+	assert.For(ctx, "Annotations").ThatError(err).Succeeded()
+	if !assert.For(ctx, "Annotations").That(len(got.List)).Equals(1) {
+		return
+	}
+	assert.For(ctx, "Handle").That(got.List[0].Handle).Equals("Buffer<1>")
+	assert.For(ctx, "Name").That(got.List[0].Name).Equals("indices")
+	assert.For(ctx, "Notes").That(got.List[0].Notes).Equals("renamed")
+
+	res := &service.Resources{Types: []*service.ResourcesByType{{
+		Resources: []*service.Resource{{Handle: "Buffer<1>"}, {Handle: "Image<2>"}},
+	}}}
+	annotated := annotateResources(ctx, c, res)
+	assert.For(ctx, "Annotated").That(annotated.Types[0].Resources[0].Annotation == got.List[0]).Equals(true)
+	assert.For(ctx, "Not annotated").That(annotated.Types[0].Resources[1].Annotation == nil).Equals(true)
+	assert.For(ctx, "Shared resources").That(res.Types[0].Resources[0].Annotation == nil).Equals(true)
+}
@@ -0,0 +1,88 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// CaptureEnvironmentResolver is the interface implemented by APIs which can
+// describe the instances and devices created by the captured application.
+type CaptureEnvironmentResolver interface {
+	// ResolveCaptureEnvironment adds the instances and devices of the given
+	// capture to the environment.
+	ResolveCaptureEnvironment(ctx context.Context, c *path.Capture, out *service.CaptureEnvironment) error
+	// CaptureEnvironmentMismatches returns the capabilities used by the
+	// instances and devices of the API in the environment that the replay
+	// device d lacks.
+	CaptureEnvironmentMismatches(ctx context.Context, env *service.CaptureEnvironment, d *device.Instance) []string
+}
+
+// CaptureEnvironment returns the environment the given capture was taken in:
+// the capturing device, and the instances and devices created by the
+// application, with their enabled layers, extensions and features. If the
+// replay device is not nil, the capabilities used by the capture that the
+// replay device lacks are listed in the mismatches.
+func CaptureEnvironment(ctx context.Context, p *path.Capture, replayDevice *path.Device) (*service.CaptureEnvironment, error) {
+	obj, err := database.Build(ctx, &CaptureEnvironmentResolvable{Capture: p})
+	if err != nil {
+		return nil, err
+	}
+	env := obj.(*service.CaptureEnvironment)
+	if replayDevice == nil {
+		return env, nil
+	}
+	d, err := Device(ctx, replayDevice, nil)
+	if err != nil {
+		return nil, err
+	}
+	c, err := capture.ResolveFromPath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	// The resolved environment is shared, so the mismatches go in a copy.
+	out := proto.Clone(env).(*service.CaptureEnvironment)
+	for _, a := range c.APIs {
+		if r, ok := a.(CaptureEnvironmentResolver); ok {
+			out.Mismatches = append(out.Mismatches, r.CaptureEnvironmentMismatches(ctx, env, d)...)
+		}
+	}
+	return out, nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *CaptureEnvironmentResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	c, err := capture.ResolveFromPath(ctx, r.Capture)
+	if err != nil {
+		return nil, err
+	}
+	out := &service.CaptureEnvironment{Device: c.Header.Device}
+	for _, a := range c.APIs {
+		if res, ok := a.(CaptureEnvironmentResolver); ok {
+			if err := res.ResolveCaptureEnvironment(ctx, r.Capture, out); err != nil {
+				log.W(ctx, "Couldn't resolve the environment of %v: %v", a.Name(), err)
+			}
+		}
+	}
+	return out, nil
+}
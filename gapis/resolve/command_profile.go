@@ -0,0 +1,183 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/devices"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// profileDevice returns the replay device of the config, or the first
+// compatible device if there is none.
+func profileDevice(ctx context.Context, c *path.Capture, r *path.ResolveConfig) (*path.Device, error) {
+	if device := r.GetReplayDevice(); device != nil {
+		return device, nil
+	}
+	devices, err := devices.ForReplay(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, &service.ErrDataUnavailable{
+			Reason: messages.ErrMessage("No compatible replay devices found"),
+		}
+	}
+	return devices[0], nil
+}
+
+// commandProfile returns the GPU time samples of the commands of the capture,
+// measured by a profiling replay on the replay device of the config, or the
+// first compatible device if there is none.
+func commandProfile(ctx context.Context, c *path.Capture, r *path.ResolveConfig) ([]*service.TimestampsItem, error) {
+	device, err := profileDevice(ctx, c, r)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := database.Build(ctx, &CommandProfileResolvable{Capture: c, Device: device})
+	if err != nil {
+		return nil, err
+	}
+	return obj.([]*service.TimestampsItem), nil
+}
+
+// commandTimings returns the CPU time spent on each command of the capture,
+// measured by a replay on the same device as commandProfile.
+func commandTimings(ctx context.Context, c *path.Capture, r *path.ResolveConfig) ([]replay.CommandTiming, error) {
+	device, err := profileDevice(ctx, c, r)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := database.Build(ctx, &CommandTimingsResolvable{Capture: c, Device: device})
+	if err != nil {
+		return nil, err
+	}
+	return obj.([]replay.CommandTiming), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *CommandProfileResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	res, err := replay.GetTimestamps(ctx, r.Capture, r.Device, &service.TimestampsOptions{
+		RenderPasses: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.GetTimestamps().GetTimestamps(), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *CommandTimingsResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	return replay.GetCommandTimings(ctx, r.Capture, r.Device)
+}
+
+// TimestampsCPUTimes measures the CPU time spent by the replay device on each
+// command of the capture, and adds it to the timestamps. The CPU time of each
+// measured range of subcommands is the time spent on the commands recording
+// them. The commands are measured by another replay on each call, unlike the
+// cached timings of the command profiles.
+func TimestampsCPUTimes(ctx context.Context, c *path.Capture, d *path.Device, ts *service.Timestamps) error {
+	timings, err := replay.GetCommandTimings(ctx, c, d)
+	if err != nil {
+		return err
+	}
+	times := make(map[api.CmdID]uint64, len(timings))
+	for _, t := range timings {
+		times[t.Command] = uint64(t.Time)
+		ts.CpuTimes = append(ts.CpuTimes, &service.CommandCpuTime{
+			Command:           uint64(t.Command),
+			TimeInNanoseconds: uint64(t.Time),
+		})
+	}
+	if len(ts.Timestamps) == 0 {
+		return nil
+	}
+	s, err := SyncData(ctx, c)
+	if err != nil {
+		return err
+	}
+	for _, t := range ts.Timestamps {
+		begin, end := api.SubCmdIdx(t.Begin.Indices), api.SubCmdIdx(t.End.Indices)
+		if len(begin) < 2 || begin[0] != end[0] {
+			continue
+		}
+		for _, ref := range s.SubcommandReferences[api.CmdID(begin[0])] {
+			if ref.IsCallerGroup || ref.GeneratingCmd == api.CmdNoID {
+				continue
+			}
+			if !ref.Index.LessThan(begin[1:]) && !end[1:].LessThan(ref.Index) {
+				t.CpuTimeInNanoseconds += times[ref.GeneratingCmd]
+			}
+		}
+	}
+	return nil
+}
+
+// inSubCmdRange returns true if the command idx is within the range of
+// commands from first to last, including their subcommands.
+func inSubCmdRange(idx, first, last api.SubCmdIdx) bool {
+	return (first.Contains(idx) || !idx.LessThan(first)) && !last.LessThan(idx)
+}
+
+// profileNode returns the GPU time of the samples fully within the given
+// commands and the CPU time of the commands, or nil if there is none. The
+// samples are measured per command buffer and per render pass, so the render
+// passes are only counted if their command buffer is not. The timings are in
+// the order of their commands.
+func profileNode(samples []*service.TimestampsItem, timings []replay.CommandTiming, cmds *path.Commands) *service.CommandTreeNodeProfile {
+	first, last := api.SubCmdIdx(cmds.From), api.SubCmdIdx(cmds.To)
+	within := func(s *service.TimestampsItem) bool {
+		return inSubCmdRange(s.Begin.Indices, first, last) && inSubCmdRange(s.End.Indices, first, last)
+	}
+	out := &service.CommandTreeNodeProfile{}
+	counted := []*service.TimestampsItem{}
+	for _, s := range samples {
+		if !s.RenderPass && !s.Draw && within(s) {
+			out.GpuTimeNs += s.TimeInNanoseconds
+			out.NumSamples++
+			counted = append(counted, s)
+		}
+	}
+samples:
+	for _, s := range samples {
+		if !s.RenderPass || !within(s) {
+			continue
+		}
+		for _, cb := range counted {
+			if inSubCmdRange(s.Begin.Indices, cb.Begin.Indices, cb.End.Indices) {
+				continue samples
+			}
+		}
+		out.GpuTimeNs += s.TimeInNanoseconds
+		out.NumSamples++
+	}
+	if len(first) == 1 && len(last) == 1 {
+		i := sort.Search(len(timings), func(i int) bool { return uint64(timings[i].Command) >= first[0] })
+		for ; i < len(timings) && uint64(timings[i].Command) <= last[0]; i++ {
+			out.CpuTimeNs += uint64(timings[i].Time)
+		}
+	}
+	if out.NumSamples == 0 && out.CpuTimeNs == 0 {
+		return nil
+	}
+	return out
+}
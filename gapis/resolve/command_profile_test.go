@@ -0,0 +1,87 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestProfileNode(t *testing.T) {
+	ctx := log.Testing(t)
+	c := path.NewCapture(id.ID{})
+	sample := func(submit, cb, last uint64, ns uint64) *service.TimestampsItem {
+		return &service.TimestampsItem{
+			Begin:             c.Command(submit, 0, cb, 0),
+			End:               c.Command(submit, 0, cb, last),
+			TimeInNanoseconds: ns,
+		}
+	}
+	renderPass := func(submit, cb, begin, end uint64, ns uint64) *service.TimestampsItem {
+		return &service.TimestampsItem{
+			Begin:             c.Command(submit, 0, cb, begin),
+			End:               c.Command(submit, 0, cb, end),
+			TimeInNanoseconds: ns,
+			RenderPass:        true,
+		}
+	}
+	samples := []*service.TimestampsItem{
+		sample(3, 0, 4, 100),
+		renderPass(3, 0, 1, 3, 60),
+		sample(3, 1, 2, 20),
+		sample(7, 0, 9, 5),
+	}
+	timings := []replay.CommandTiming{
+		{Command: 3, Time: 1000 * time.Nanosecond},
+		{Command: 5, Time: 7 * time.Nanosecond},
+		{Command: 7, Time: 30 * time.Nanosecond},
+	}
+
+	for _, test := range []struct {
+		name    string
+		cmds    *path.Commands
+		time    uint64
+		samples uint32
+		cpuTime uint64
+	}{
+		{"frame", c.CommandRange(0, 10), 125, 3, 1037},
+		{"submit", c.CommandRange(3, 3), 120, 2, 1000},
+		{"command buffer", c.SubCommandRange([]uint64{3, 0, 1}, []uint64{3, 0, 1}), 20, 1, 0},
+		{"render pass", c.SubCommandRange([]uint64{3, 0, 0, 1}, []uint64{3, 0, 0, 3}), 60, 1, 0},
+		{"render pass group", c.SubCommandRange([]uint64{3, 0, 0, 0}, []uint64{3, 0, 0, 3}), 60, 1, 0},
+		{"part of render pass", c.SubCommandRange([]uint64{3, 0, 0, 2}, []uint64{3, 0, 0, 3}), 0, 0, 0},
+		{"no samples", c.CommandRange(4, 6), 0, 0, 7},
+		{"no timings", c.CommandRange(8, 9), 0, 0, 0},
+	} {
+		p := profileNode(samples, timings, test.cmds)
+		if test.samples == 0 && test.cpuTime == 0 {
+			assert.For(ctx, "%v profile", test.name).That(p == nil).Equals(true)
+			continue
+		}
+		if !assert.For(ctx, "%v profile", test.name).That(p != nil).Equals(true) {
+			continue
+		}
+		assert.For(ctx, "%v time", test.name).That(p.GpuTimeNs).Equals(test.time)
+		assert.For(ctx, "%v samples", test.name).That(p.NumSamples).Equals(test.samples)
+		assert.For(ctx, "%v CPU time", test.name).That(p.CpuTimeNs).Equals(test.cpuTime)
+	}
+}
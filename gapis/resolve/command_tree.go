@@ -99,18 +99,36 @@ func CommandTreeNode(ctx context.Context, c *path.CommandTreeNode, r *path.Resol
 
 	cmdTree := boxed.(*commandTree)
 
-	rawItem, absID := cmdTree.index(c.Indices)
+	node := cmdTree.node(ctx, c.Indices)
+	if cmdTree.path.Profile {
+		samples, err := commandProfile(ctx, cmdTree.path.Capture, r)
+		if err != nil {
+			return nil, err
+		}
+		timings, err := commandTimings(ctx, cmdTree.path.Capture, r)
+		if err != nil {
+			return nil, err
+		}
+		node.Profile = profileNode(samples, timings, node.Commands)
+	}
+	return node, nil
+}
+
+// node returns the command tree node at the given indices.
+func (t *commandTree) node(ctx context.Context, indices []uint64) *service.CommandTreeNode {
+	rawItem, absID := t.index(indices)
 	switch item := rawItem.(type) {
 	case api.SubCmdIdx:
 		return &service.CommandTreeNode{
-			Representation: cmdTree.path.Capture.Command(item[0], item[1:]...),
+			Representation: t.path.Capture.Command(item[0], item[1:]...),
 			NumChildren:    0, // TODO: Subcommands
-			Commands:       cmdTree.path.Capture.SubCommandRange(item, item),
-		}, nil
+			Commands:       t.path.Capture.SubCommandRange(item, item),
+			Annotation:     commandAnnotation(ctx, t.path.Capture, item),
+		}
 	case api.CmdIDGroup:
-		representation := cmdTree.path.Capture.Command(uint64(item.Range.Last()))
+		representation := t.path.Capture.Command(uint64(item.Range.Last()))
 		if data, ok := item.UserData.(*CmdGroupData); ok {
-			representation = cmdTree.path.Capture.Command(uint64(data.Representation))
+			representation = t.path.Capture.Command(uint64(data.Representation))
 		}
 
 		if len(absID) == 0 {
@@ -118,40 +136,44 @@ func CommandTreeNode(ctx context.Context, c *path.CommandTreeNode, r *path.Resol
 			return &service.CommandTreeNode{
 				Representation: representation,
 				NumChildren:    item.Count(),
-				Commands:       cmdTree.path.Capture.CommandRange(uint64(item.Range.First()), uint64(item.Range.Last())),
+				Commands:       t.path.Capture.CommandRange(uint64(item.Range.First()), uint64(item.Range.Last())),
 				Group:          item.Name,
 				NumCommands:    item.DeepCount(func(g api.CmdIDGroup) bool { return true /* TODO: Subcommands */ }),
-			}, nil
+			}
 		}
 		// Is a CmdIDGroup under SubCmdRoot, contains only Subcommands
 		startID := append(absID, uint64(item.Range.First()))
 		endID := append(absID, uint64(item.Range.Last()))
-		representation = cmdTree.path.Capture.Command(endID[0], endID[1:]...)
+		representation = t.path.Capture.Command(endID[0], endID[1:]...)
 		return &service.CommandTreeNode{
 			Representation: representation,
 			NumChildren:    item.Count(),
-			Commands:       cmdTree.path.Capture.SubCommandRange(startID, endID),
+			Commands:       t.path.Capture.SubCommandRange(startID, endID),
 			Group:          item.Name,
 			NumCommands:    item.DeepCount(func(g api.CmdIDGroup) bool { return true /* TODO: Subcommands */ }),
-		}, nil
+		}
 
 	case api.SubCmdRoot:
 		count := uint64(1)
 		g := ""
+		var annotation *service.Annotation
 		if len(item.Id) > 1 {
 			g = fmt.Sprintf("%v", item.Id)
 			count = uint64(item.SubGroup.Count())
+		} else {
+			annotation = commandAnnotation(ctx, t.path.Capture, item.Id)
 		}
 		return &service.CommandTreeNode{
-			Representation: cmdTree.path.Capture.Command(item.Id[0], item.Id[1:]...),
+			Representation: t.path.Capture.Command(item.Id[0], item.Id[1:]...),
 			NumChildren:    item.SubGroup.Count(),
-			Commands:       cmdTree.path.Capture.SubCommandRange(item.Id, item.Id),
+			Commands:       t.path.Capture.SubCommandRange(item.Id, item.Id),
 			Group:          g,
 			NumCommands:    count,
-		}, nil
+			Annotation:     annotation,
+		}
 	default:
-		panic(fmt.Errorf("Unexpected type: %T, cmdTree.index(c.Indices): (%v, %v), indices: %v",
-			item, rawItem, absID, c.Indices))
+		panic(fmt.Errorf("Unexpected type: %T, t.index(indices): (%v, %v), indices: %v",
+			item, rawItem, absID, indices))
 	}
 }
 
@@ -288,6 +310,11 @@ func (r *CommandTreeResolvable) Resolve(ctx context.Context) (interface{}, error
 			return nil, log.Errf(ctx, err, "Couldn't get events")
 		}
 		if p.GroupByFrame {
+			if p.InferFrameBoundaries {
+				if inferred := inferredFrameEvents(ctx, p, c); inferred != nil {
+					events = inferred
+				}
+			}
 			addFrameGroups(ctx, events, p, out, api.CmdID(len(c.Commands)))
 		}
 		if p.GroupByTransformFeedback {
@@ -395,6 +422,56 @@ func addFrameEventGroups(
 	}
 }
 
+// FrameBoundaryInferrer is the interface implemented by APIs which can infer
+// the frame boundaries of a capture from the dependencies between the
+// commands, rather than relying on the commands flagged as end of frame.
+type FrameBoundaryInferrer interface {
+	// InferFrameBoundaries returns the IDs of the last command of each frame
+	// of the capture, in ascending order.
+	InferFrameBoundaries(ctx context.Context, c *path.Capture) ([]api.CmdID, error)
+}
+
+// inferredFrameEvents returns the FirstInFrame and LastInFrame events of the
+// frames inferred by the APIs of the capture, or nil if no API of the capture
+// infers the frame boundaries.
+func inferredFrameEvents(ctx context.Context, p *path.CommandTree, c *capture.Capture) *service.Events {
+	ends := []api.CmdID{}
+	inferred := false
+	for _, a := range c.APIs {
+		if fi, ok := a.(FrameBoundaryInferrer); ok {
+			apiEnds, err := fi.InferFrameBoundaries(ctx, p.Capture)
+			if err != nil {
+				log.W(ctx, "Couldn't infer the frame boundaries of %v: %v", a.Name(), err)
+				continue
+			}
+			ends = append(ends, apiEnds...)
+			inferred = true
+		}
+	}
+	if !inferred {
+		return nil
+	}
+	sort.Slice(ends, func(i, j int) bool { return ends[i] < ends[j] })
+
+	events := &service.Events{}
+	start := api.CmdID(0)
+	for _, end := range ends {
+		if end < start {
+			// Duplicated boundary.
+			continue
+		}
+		events.List = append(events.List,
+			&service.Event{Kind: service.EventKind_FirstInFrame, Command: p.Capture.Command(uint64(start))},
+			&service.Event{Kind: service.EventKind_LastInFrame, Command: p.Capture.Command(uint64(end))})
+		start = end + 1
+	}
+	if uint64(start) < uint64(len(c.Commands)) {
+		events.List = append(events.List,
+			&service.Event{Kind: service.EventKind_FirstInFrame, Command: p.Capture.Command(uint64(start))})
+	}
+	return events
+}
+
 func addFrameGroups(ctx context.Context, events *service.Events, p *path.CommandTree, t *commandTree, last api.CmdID) {
 	frameCount, frameStart, frameEnd := 0, api.CmdID(0), api.CmdID(0)
 	for _, e := range events.List {
@@ -0,0 +1,120 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// The number of commands matched between two checks for cancellation.
+const filterCancelCheckInterval = 4096
+
+// CommandTreeFilter filters the commands of a command tree with a sequence of
+// filter expressions, such as the ones typed in a search box. The commands,
+// their user markers and their nodes in the tree are collected once, so each
+// new expression is only matched against them, and only the nodes of the
+// changes to the filtered commands are returned.
+type CommandTreeFilter struct {
+	capture *path.Capture
+	tree    *path.ID
+	cmds    []*filterCmd
+	// The indices of the node of each of the commands in the tree.
+	nodes [][]uint64
+	// Whether each of the commands matched the last expression.
+	matched []bool
+}
+
+// NewCommandTreeFilter returns a new CommandTreeFilter for the command tree
+// with the given identifier, matching no command. The commands that are not
+// in the tree are never matched.
+func NewCommandTreeFilter(ctx context.Context, tree *path.ID) (*CommandTreeFilter, error) {
+	boxed, err := database.Resolve(ctx, tree.ID())
+	if err != nil {
+		return nil, err
+	}
+	t, ok := boxed.(*commandTree)
+	if !ok {
+		return nil, &service.ErrInvalidArgument{Reason: messages.ErrMessage("The identifier is not a command tree")}
+	}
+	all, err := filterCmds(ctx, t.path.Capture)
+	if err != nil {
+		return nil, err
+	}
+	f := &CommandTreeFilter{capture: t.path.Capture, tree: tree}
+	for i, c := range all {
+		if i%filterCancelCheckInterval == 0 && task.Stopped(ctx) {
+			return nil, task.StopReason(ctx)
+		}
+		if node, ok := t.cmdNode(c.id); ok {
+			f.cmds = append(f.cmds, c)
+			f.nodes = append(f.nodes, node)
+		}
+	}
+	f.matched = make([]bool, len(f.cmds))
+	return f, nil
+}
+
+// cmdNode returns the indices of the node of the command in the tree, or false
+// if the tree doesn't contain the command.
+func (t *commandTree) cmdNode(id api.CmdID) ([]uint64, bool) {
+	indices := t.indices(id)
+	if _, sub := t.index(indices); !sub.Equals(api.SubCmdIdx{uint64(id)}) {
+		return nil, false
+	}
+	return indices, true
+}
+
+// Filter matches the commands against the given filter expression, and
+// returns the nodes of the commands added to and removed from the commands
+// matching the previous one. An empty expression matches all the commands. If
+// the expression is invalid, or the context is cancelled, the filtered
+// commands are left unchanged.
+func (f *CommandTreeFilter) Filter(ctx context.Context, expr string) (*service.CommandTreeDelta, error) {
+	var e filterExpr
+	if strings.TrimSpace(expr) != "" {
+		var err error
+		if e, err = parseFilter(ctx, f.capture, expr); err != nil {
+			return nil, err
+		}
+	}
+
+	out := &service.CommandTreeDelta{Expression: expr}
+	matched := make([]bool, len(f.cmds))
+	for i, c := range f.cmds {
+		if i%filterCancelCheckInterval == 0 && task.Stopped(ctx) {
+			return nil, task.StopReason(ctx)
+		}
+		matched[i] = e == nil || e.match(c)
+		switch {
+		case matched[i] && !f.matched[i]:
+			out.Added = append(out.Added, &path.CommandTreeNode{Tree: f.tree, Indices: f.nodes[i]})
+		case !matched[i] && f.matched[i]:
+			out.Removed = append(out.Removed, &path.CommandTreeNode{Tree: f.tree, Indices: f.nodes[i]})
+		}
+		if matched[i] {
+			out.Count++
+		}
+	}
+	f.matched = matched
+	return out, nil
+}
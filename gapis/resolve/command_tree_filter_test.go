@@ -0,0 +1,112 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/memory/arena"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/test"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestCommandTreeFilter(t *testing.T) {
+	ctx := log.Testing(t)
+	cb := test.CommandBuilder{Arena: arena.New()}
+	// The command 3 is hidden.
+	cmds := []*filterCmd{
+		{0, cb.CmdVoid(), nil},
+		{1, cb.CmdVoid(), []string{"Shadows"}},
+		{2, cb.CmdVoid(), []string{"Shadows"}},
+		{4, cb.CmdVoid(), []string{"Shadows"}},
+	}
+	// The commands in the marker are grouped in the tree.
+	nodes := [][]uint64{{0}, {1, 0}, {1, 1}, {1, 2}}
+	tree := path.NewID(id.ID{1})
+	f := &CommandTreeFilter{tree: tree, cmds: cmds, nodes: nodes, matched: make([]bool, len(cmds))}
+
+	indices := func(ns []*path.CommandTreeNode) [][]uint64 {
+		out := [][]uint64{}
+		for _, n := range ns {
+			assert.For(ctx, "tree").That(n.Tree).DeepEquals(tree)
+			out = append(out, n.Indices)
+		}
+		return out
+	}
+	for _, test := range []struct {
+		expr    string
+		added   [][]uint64
+		removed [][]uint64
+		count   uint64
+	}{
+		{``, nodes, [][]uint64{}, 4},
+		{`marker == Shadows`, [][]uint64{}, [][]uint64{{0}}, 3},
+		{`marker == Shadows && name == nothing`, [][]uint64{}, [][]uint64{{1, 0}, {1, 1}, {1, 2}}, 0},
+		{`!(marker == Shadows)`, [][]uint64{{0}}, [][]uint64{}, 1},
+	} {
+		delta, err := f.Filter(ctx, test.expr)
+		if !assert.For(ctx, "filter %v", test.expr).ThatError(err).Succeeded() {
+			continue
+		}
+		assert.For(ctx, "expression").That(delta.Expression).Equals(test.expr)
+		assert.For(ctx, "added by %v", test.expr).ThatSlice(indices(delta.Added)).DeepEquals(test.added)
+		assert.For(ctx, "removed by %v", test.expr).ThatSlice(indices(delta.Removed)).DeepEquals(test.removed)
+		assert.For(ctx, "count of %v", test.expr).That(delta.Count).Equals(test.count)
+	}
+
+	_, err := f.Filter(ctx, `marker ==`)
+	assert.For(ctx, "invalid expression").ThatError(err).Failed()
+	delta, err := f.Filter(ctx, `!(marker == Shadows)`)
+	assert.For(ctx, "filter").ThatError(err).Succeeded()
+	assert.For(ctx, "unchanged").That(len(delta.Added) + len(delta.Removed)).Equals(0)
+}
+
+func TestCommandTreeNodeOfCommand(t *testing.T) {
+	ctx := log.Testing(t)
+	// The command 3 is not in the tree.
+	tree := &commandTree{root: api.CmdIDGroup{
+		Range: api.CmdIDRange{Start: 0, End: 5},
+		Spans: api.Spans{
+			&api.CmdIDRange{Start: 0, End: 1},
+			&api.CmdIDGroup{
+				Name:  "Shadows",
+				Range: api.CmdIDRange{Start: 1, End: 5},
+				Spans: api.Spans{
+					&api.CmdIDRange{Start: 1, End: 3},
+					&api.CmdIDRange{Start: 4, End: 5},
+				},
+			},
+		},
+	}}
+	for _, test := range []struct {
+		id    api.CmdID
+		node  []uint64
+		found bool
+	}{
+		{0, []uint64{0}, true},
+		{1, []uint64{1, 0}, true},
+		{2, []uint64{1, 1}, true},
+		{3, nil, false},
+		{4, []uint64{1, 2}, true},
+	} {
+		node, found := tree.cmdNode(test.id)
+		assert.For(ctx, "found %v", test.id).That(found).Equals(test.found)
+		assert.For(ctx, "node of %v", test.id).ThatSlice(node).Equals(test.node)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/gapid/core/app/crash"
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/replay/devices"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// CompareReplays resolves the framebuffers after the last command of every
+// step-th frame of the capture on each of the devices, and compares them to
+// the ones of the first device. The framebuffers are all requested at once,
+// so the replays on the different devices run concurrently, and the replay
+// manager batches the frames of each device into the same replay passes.
+func CompareReplays(
+	ctx context.Context,
+	c *path.Capture,
+	replayDevices []*path.Device,
+	step uint32,
+	threshold float32,
+	r *path.ResolveConfig) (*service.ReplayComparison, error) {
+
+	if len(replayDevices) == 0 {
+		var err error
+		if replayDevices, err = devices.ForReplay(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	if len(replayDevices) < 2 {
+		return nil, fmt.Errorf("At least two replay devices are required, got %d", len(replayDevices))
+	}
+
+	events, err := Events(ctx, &path.Events{
+		Capture:     c,
+		LastInFrame: true,
+	}, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if step == 0 {
+		step = 1
+	}
+	out := &service.ReplayComparison{Devices: replayDevices}
+	for i := 0; i < len(events.List); i += int(step) {
+		out.Frames = append(out.Frames, &service.ReplayComparisonFrame{
+			Frame:   uint32(i),
+			Command: events.List[i].Command,
+			Results: make([]*service.ReplayComparisonResult, len(replayDevices)),
+		})
+	}
+
+	wg := sync.WaitGroup{}
+	for _, frame := range out.Frames {
+		for i, device := range replayDevices {
+			frame, i, device := frame, i, device
+			wg.Add(1)
+			crash.Go(func() {
+				defer wg.Done()
+				res := &service.ReplayComparisonResult{}
+				info, err := replayFramebuffer(ctx, device, frame.Command, r)
+				if err != nil {
+					res.Error = service.NewError(err)
+				} else {
+					res.Framebuffer = info
+				}
+				frame.Results[i] = res
+			})
+		}
+	}
+	wg.Wait()
+
+	for _, frame := range out.Frames {
+		compareFramebuffers(ctx, frame, threshold)
+	}
+
+	return out, nil
+}
+
+// replayFramebuffer resolves the color framebuffer after the command replayed
+// on the device.
+func replayFramebuffer(ctx context.Context, device *path.Device, p *path.Command, r *path.ResolveConfig) (*image.Info, error) {
+	imageInfoPath, err := FramebufferAttachment(ctx,
+		&service.ReplaySettings{Device: device},
+		p,
+		api.FramebufferAttachment_Color0,
+		&service.RenderSettings{
+			MaxWidth:  0xffffffff,
+			MaxHeight: 0xffffffff,
+			DrawMode:  service.DrawMode_NORMAL,
+		},
+		&service.UsageHints{Background: true},
+		r,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	boxedImageInfo, err := Get(ctx, imageInfoPath.Path(), r)
+	if err != nil {
+		return nil, err
+	}
+	return boxedImageInfo.(*image.Info), nil
+}
+
+// compareFramebuffers compares the framebuffers of the frame to the one of
+// the reference device, the first one. The frame is divergent if a difference
+// is above the threshold, or if the framebuffer could be resolved on some of
+// the devices only.
+func compareFramebuffers(ctx context.Context, frame *service.ReplayComparisonFrame, threshold float32) {
+	reference := frame.Results[0]
+	var referenceData *image.Data
+	if reference.Framebuffer != nil {
+		data, err := reference.Framebuffer.Data(ctx)
+		if err != nil {
+			reference.Error, reference.Framebuffer = service.NewError(err), nil
+		} else {
+			referenceData = data
+		}
+	}
+
+	for _, res := range frame.Results[1:] {
+		if (res.Framebuffer == nil) != (referenceData == nil) {
+			frame.Divergent = true
+			continue
+		}
+		if referenceData == nil {
+			continue
+		}
+		data, err := res.Framebuffer.Data(ctx)
+		if err != nil {
+			res.Error = service.NewError(err)
+			frame.Divergent = true
+			continue
+		}
+		diff, err := image.PerceptualDifference(referenceData, data)
+		if err != nil {
+			res.Error = service.NewError(err)
+		}
+		res.Difference = diff
+		if diff > threshold {
+			frame.Divergent = true
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dependencygraph
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// DiffCaptures returns the structural difference between the before and
+// after captures: the commands removed and added by the after capture, the
+// aligned commands whose parameters or dependencies changed, and the
+// resources whose contents differ at the end of the captures.
+func DiffCaptures(ctx context.Context, before, after *path.Capture, r *path.ResolveConfig) (*service.CaptureDiff, error) {
+	fd, err := DiffFootprints(ctx, before, after)
+	if err != nil {
+		return nil, err
+	}
+	beforeCmds, err := resolve.Cmds(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+	afterCmds, err := resolve.Cmds(ctx, after)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &service.CaptureDiff{
+		Removed:   make([]uint64, len(fd.Removed)),
+		Added:     make([]uint64, len(fd.Added)),
+		Changed:   []*service.ChangedCommand{},
+		Resources: []*service.ResourceDiff{},
+	}
+	for i, cmd := range fd.Removed {
+		out.Removed[i] = uint64(cmd)
+	}
+	for i, cmd := range fd.Added {
+		out.Added[i] = uint64(cmd)
+	}
+
+	// The aligned commands are compared in order, so that the handles are
+	// matched by the first commands using them.
+	aligned := make([]api.CmdID, 0, len(fd.Aligned))
+	for b := range fd.Aligned {
+		aligned = append(aligned, b)
+	}
+	sort.Slice(aligned, func(i, j int) bool { return aligned[i] < aligned[j] })
+
+	handles := handleMatcher{}
+	changed := map[api.CmdID]*service.ChangedCommand{}
+	for _, b := range aligned {
+		a := fd.Aligned[b]
+		params := changedParameters(beforeCmds[b], afterCmds[a], handles)
+		if len(params) > 0 {
+			changed[b] = &service.ChangedCommand{
+				Before:     uint64(b),
+				After:      uint64(a),
+				Name:       beforeCmds[b].CmdName(),
+				Parameters: params,
+			}
+		}
+	}
+	for _, d := range fd.Changed {
+		c, ok := changed[d.Before]
+		if !ok {
+			c = &service.ChangedCommand{
+				Before: uint64(d.Before),
+				After:  uint64(d.After),
+				Name:   beforeCmds[d.Before].CmdName(),
+			}
+			changed[d.Before] = c
+		}
+		for _, cmd := range d.Lost {
+			c.LostDependencies = append(c.LostDependencies, uint64(cmd))
+		}
+		for _, cmd := range d.Gained {
+			c.GainedDependencies = append(c.GainedDependencies, uint64(cmd))
+		}
+	}
+	for _, c := range changed {
+		out.Changed = append(out.Changed, c)
+	}
+	sort.Slice(out.Changed, func(i, j int) bool { return out.Changed[i].Before < out.Changed[j].Before })
+
+	out.Resources, err = diffResources(ctx, before, after, len(beforeCmds), len(afterCmds), r)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// handleMatcher matches the handles of the before capture with the handles of
+// the after capture, by the type of the handles.
+type handleMatcher map[reflect.Type]*handlePairs
+
+type handlePairs struct {
+	after  map[uint64]uint64 // before handle -> after handle
+	before map[uint64]uint64 // after handle -> before handle
+}
+
+// same returns true if the before and after handles are the same object: the
+// handles are matched if neither was seen before, and the null handles only
+// match each other.
+func (m handleMatcher) same(before, after api.Handle) bool {
+	ty := reflect.TypeOf(before)
+	if ty != reflect.TypeOf(after) {
+		return false
+	}
+	b, a := before.Handle(), after.Handle()
+	if b == 0 || a == 0 {
+		return b == a
+	}
+	pairs, ok := m[ty]
+	if !ok {
+		pairs = &handlePairs{after: map[uint64]uint64{}, before: map[uint64]uint64{}}
+		m[ty] = pairs
+	}
+	if matched, ok := pairs.after[b]; ok {
+		return matched == a
+	}
+	if _, ok := pairs.before[a]; ok {
+		return false
+	}
+	pairs.after[b], pairs.before[a] = a, b
+	return true
+}
+
+// changedParameters returns the names of the parameters and the result of
+// the aligned commands whose values are different. Pointers are skipped, as
+// the addresses of the observed memory differ between captures, and handles
+// are compared through the handles matched by the previous commands.
+func changedParameters(before, after api.Cmd, handles handleMatcher) []string {
+	changed := []string{}
+	beforeParams, afterParams := before.CmdParams(), after.CmdParams()
+	if br, ar := before.CmdResult(), after.CmdResult(); br != nil && ar != nil {
+		beforeParams = append(beforeParams, br)
+		afterParams = append(afterParams, ar)
+	}
+	for i, p := range beforeParams {
+		if i >= len(afterParams) {
+			break
+		}
+		b, a := p.Get(), afterParams[i].Get()
+		if _, ok := b.(memory.ReflectPointer); ok {
+			continue
+		}
+		if bh, ok := b.(api.Handle); ok {
+			if ah, ok := a.(api.Handle); !ok || !handles.same(bh, ah) {
+				changed = append(changed, p.Name)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(b, a) {
+			changed = append(changed, p.Name)
+		}
+	}
+	return changed
+}
+
+// diffResources matches the resources of the same type of the two captures by
+// their creation order, and returns the pairs whose contents at the end of the
+// captures have different hashes.
+func diffResources(ctx context.Context, before, after *path.Capture,
+	numBefore, numAfter int, r *path.ResolveConfig) ([]*service.ResourceDiff, error) {
+	beforeRes, err := resolve.Resources(ctx, before, r)
+	if err != nil {
+		return nil, err
+	}
+	afterRes, err := resolve.Resources(ctx, after, r)
+	if err != nil {
+		return nil, err
+	}
+	afterByType := map[api.ResourceType][]*service.Resource{}
+	for _, t := range afterRes.Types {
+		afterByType[t.Type] = t.Resources
+	}
+
+	diffs := []*service.ResourceDiff{}
+	for _, t := range beforeRes.Types {
+		b, a := t.Resources, afterByType[t.Type]
+		delete(afterByType, t.Type)
+		for i := 0; i < len(b) || i < len(a); i++ {
+			d := &service.ResourceDiff{Type: t.Type}
+			if i < len(b) {
+				d.Before = b[i]
+				d.BeforeHash = resourceHash(ctx, before, numBefore, b[i], r)
+				d.Unknown = d.Unknown || d.BeforeHash == nil
+			}
+			if i < len(a) {
+				d.After = a[i]
+				d.AfterHash = resourceHash(ctx, after, numAfter, a[i], r)
+				d.Unknown = d.Unknown || d.AfterHash == nil
+			}
+			if d.Before == nil || d.After == nil || d.Unknown || d.BeforeHash.ID() != d.AfterHash.ID() {
+				diffs = append(diffs, d)
+			}
+		}
+	}
+	for ty, a := range afterByType {
+		for _, res := range a {
+			d := &service.ResourceDiff{
+				Type:      ty,
+				After:     res,
+				AfterHash: resourceHash(ctx, after, numAfter, res, r),
+			}
+			d.Unknown = d.AfterHash == nil
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs, nil
+}
+
+// resourceHash returns the hash of the data of the resource after the last
+// command of the capture, or nil if the data cannot be resolved, e.g. if the
+// resource is deleted.
+func resourceHash(ctx context.Context, c *path.Capture, numCmds int,
+	res *service.Resource, r *path.ResolveConfig) *path.ID {
+	if numCmds == 0 {
+		return nil
+	}
+	data, err := resolve.ResourceData(ctx, c.Command(uint64(numCmds-1)).ResourceAfter(res.ID), r)
+	if err != nil {
+		log.W(ctx, "Couldn't resolve the data of resource %v: %v", res.Handle, err)
+		return nil
+	}
+	msg, ok := data.(proto.Message)
+	if !ok {
+		return nil
+	}
+	encoded, err := proto.Marshal(msg)
+	if err != nil {
+		log.W(ctx, "Couldn't encode the data of resource %v: %v", res.Handle, err)
+		return nil
+	}
+	return path.NewID(id.OfBytes(encoded))
+}
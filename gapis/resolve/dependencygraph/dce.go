@@ -22,6 +22,9 @@ import (
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service/path"
 )
 
 var (
@@ -65,10 +68,16 @@ func (s *CommandIndicesSet) Contains(fci api.SubCmdIdx) bool {
 // commands which are not contributing to the final state at the requested
 // commands.
 type DCE struct {
+	// Explain makes the back propagation record the behavior which makes each
+	// of the alive behaviors alive, so that LivenessChain can tell why a
+	// command is kept.
+	Explain          bool
 	footprint        *Footprint
 	endBehaviorIndex uint64
 	endCmdIndex      api.CmdID
 	requests         *CommandIndicesSet
+	livenessBoard    []bool
+	keptBy           []uint64
 }
 
 // NewDCE constructs a new DCE instance and returns a pointer to the created
@@ -185,6 +194,13 @@ func (t *DCE) Flush(ctx context.Context, out transform.Writer) {
 func (t *DCE) BackPropagate(ctx context.Context) ([]bool, *CommandIndicesSet) {
 	livenessBoard := make([]bool, t.endBehaviorIndex+1)
 	aliveCommands := &CommandIndicesSet{}
+	if t.Explain {
+		t.livenessBoard = livenessBoard
+		t.keptBy = make([]uint64, len(livenessBoard))
+		for i := range t.keptBy {
+			t.keptBy[i] = NotInFootprint
+		}
+	}
 	for bi := int64(t.endBehaviorIndex); bi >= 0; bi-- {
 		bh := t.footprint.Behaviors[bi]
 		fci := bh.Owner
@@ -196,9 +212,94 @@ func (t *DCE) BackPropagate(ctx context.Context) ([]bool, *CommandIndicesSet) {
 			livenessBoard[bi] = true
 			aliveCommands.Insert(fci)
 			for d := range bh.DependsOn {
+				if t.Explain && !livenessBoard[d.Index] {
+					t.keptBy[d.Index] = uint64(bi)
+				}
 				livenessBoard[d.Index] = true
 			}
 		}
 	}
 	return livenessBoard, aliveCommands
 }
+
+// LivenessChain returns the chain of behaviors which keeps the behavior at the
+// given index alive. The chain starts with the given behavior, each following
+// behavior depends on the previous one, and the last one is alive by itself,
+// i.e. it is requested or always kept alive. Returns nil if the behavior is
+// dead, or if Explain was not set when back propagating.
+func (t *DCE) LivenessChain(bi uint64) []*Behavior {
+	if bi >= uint64(len(t.livenessBoard)) || !t.livenessBoard[bi] {
+		return nil
+	}
+	chain := []*Behavior{}
+	for bi != NotInFootprint && len(chain) < len(t.keptBy) {
+		chain = append(chain, t.footprint.Behaviors[bi])
+		bi = t.keptBy[bi]
+	}
+	return chain
+}
+
+// ExplainDeadCodeElimination runs the dead code elimination over all the
+// commands of the given capture, requesting the given command, or the last
+// one if request is nil, and returns the reason for every kept command of the
+// capture. Initial commands are not reported.
+func ExplainDeadCodeElimination(ctx context.Context, c *path.Capture,
+	request *path.Command) (map[api.CmdID]resolve.KeptReason, error) {
+	r, err := database.Build(ctx, &FootprintResolvable{Capture: c, Explain: true})
+	if err != nil {
+		return nil, fmt.Errorf("Could not get the execution footprint: %v", err)
+	}
+	ft := r.(*Footprint)
+	reasons := map[api.CmdID]resolve.KeptReason{}
+	if len(ft.Behaviors) == 0 || len(ft.Commands) <= ft.NumInitialCommands {
+		return reasons, nil
+	}
+
+	numInitialCmds := uint64(ft.NumInitialCommands)
+	requested := api.SubCmdIdx{uint64(len(ft.Commands) - 1)}
+	if request != nil {
+		if len(request.Indices) == 0 ||
+			request.Indices[0] >= uint64(len(ft.Commands))-numInitialCmds {
+			return nil, fmt.Errorf("Invalid requested command %v", request.Indices)
+		}
+		requested = append(api.SubCmdIdx{request.Indices[0] + numInitialCmds}, request.Indices[1:]...)
+	}
+	dce := NewDCE(ctx, ft)
+	dce.Explain = true
+	dce.Request(ctx, requested)
+	dce.BackPropagate(ctx)
+
+	for bi := uint64(0); bi <= dce.endBehaviorIndex; bi++ {
+		fci := ft.Behaviors[bi].Owner
+		if len(fci) != 1 || fci[0] < numInitialCmds {
+			continue
+		}
+		id := api.CmdID(fci[0] - numInitialCmds)
+		if _, ok := reasons[id]; ok {
+			continue
+		}
+		chain := dce.LivenessChain(bi)
+		if chain == nil {
+			continue
+		}
+		reason := resolve.KeptReason{}
+		for i, b := range chain {
+			if b.Owner[0] < numInitialCmds {
+				continue
+			}
+			cmd := api.CmdID(b.Owner[0] - numInitialCmds)
+			if len(reason.Chain) == 0 || reason.Chain[len(reason.Chain)-1] != cmd {
+				reason.Chain = append(reason.Chain, cmd)
+			}
+			// The variable blocking the elimination is the one through which
+			// the first behavior of another command depends on the kept one.
+			if len(reason.Chain) == 1 && i+1 < len(chain) && chain[i+1].Owner[0] != b.Owner[0] {
+				if v, ok := chain[i+1].Via[b]; ok {
+					reason.Variable = fmt.Sprint(v)
+				}
+			}
+		}
+		reasons[id] = reason
+	}
+	return reasons, nil
+}
@@ -115,3 +115,61 @@ func TestDCE(t *testing.T) {
 	expectedLiveness(alived, []uint64{3, 0, 1, 0}, false)
 	expectedLiveness(alived, []uint64{4}, false)
 }
+
+func TestDCELivenessChain(t *testing.T) {
+	ctx := log.Testing(t)
+	ft := dependencygraph.NewEmptyFootprint(ctx)
+	nodes := map[int]*dummyDefUseVar{}
+
+	behave := func(fci api.SubCmdIdx,
+		reads, writes []int) {
+		b := dependencygraph.NewBehavior(fci)
+		for _, r := range reads {
+			if rv, ok := nodes[r]; ok {
+				b.Read(rv)
+			}
+		}
+		for _, w := range writes {
+			if _, ok := nodes[w]; !ok {
+				nodes[w] = &dummyDefUseVar{}
+			}
+			b.Write(nodes[w])
+		}
+		ft.AddBehavior(ctx, b)
+	}
+
+	// Same footprint as in TestDCE.
+	behave([]uint64{0}, []int{}, []int{1, 2, 3})
+	behave([]uint64{1}, []int{}, []int{2, 3})
+	behave([]uint64{2}, []int{}, []int{4})
+	behave([]uint64{3, 0, 0, 0}, []int{2}, []int{5})
+	behave([]uint64{3, 0, 0, 1}, []int{3}, []int{6})
+	behave([]uint64{3, 0, 0, 2}, []int{4}, []int{7})
+	behave([]uint64{3, 0, 0, 3}, []int{5, 6, 7}, []int{8})
+	behave([]uint64{3, 0, 0, 4}, []int{8}, []int{9})
+	behave([]uint64{3, 0, 1, 0}, []int{8, 9}, []int{10})
+	behave([]uint64{4}, []int{10}, []int{})
+
+	owners := func(chain []*dependencygraph.Behavior) []api.SubCmdIdx {
+		r := []api.SubCmdIdx{}
+		for _, b := range chain {
+			r = append(r, b.Owner)
+		}
+		return r
+	}
+
+	dce := dependencygraph.NewDCE(ctx, ft)
+	dce.Request(ctx, []uint64{4})
+	dce.BackPropagate(ctx)
+	assert.For(ctx, "Chain without Explain").That(dce.LivenessChain(1)).IsNil()
+
+	dce = dependencygraph.NewDCE(ctx, ft)
+	dce.Explain = true
+	dce.Request(ctx, []uint64{4})
+	dce.BackPropagate(ctx)
+	assert.For(ctx, "Chain of dead command").That(dce.LivenessChain(0)).IsNil()
+	assert.For(ctx, "Chain of requested command").That(owners(dce.LivenessChain(9))).DeepEquals(
+		[]api.SubCmdIdx{{4}})
+	assert.For(ctx, "Chain of command 1").That(owners(dce.LivenessChain(1))).DeepEquals(
+		[]api.SubCmdIdx{{1}, {3, 0, 0, 1}, {3, 0, 0, 3}, {3, 0, 1, 0}, {4}})
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dependencygraph
+
+import (
+	"context"
+)
+
+// VariableKind intercepts the reads and writes of the DefUseVariables of one
+// concrete type, e.g. to ignore null handles, or to split a read of a memory
+// range into reads of the ranges written before.
+// It is returned by the variables implementing KindedVariable.
+type VariableKind struct {
+	// Name of the kind of variables.
+	Name string
+	// Read records the read of the variable v by the behavior b. Returns false
+	// if the read cannot be recorded. If nil, b.Read(v) is used.
+	Read func(ctx context.Context, b *Behavior, v DefUseVariable) bool
+	// Write records the write of the variable v by the behavior b. Returns
+	// false if the write cannot be recorded. If nil, b.Write(v) is used.
+	Write func(ctx context.Context, b *Behavior, v DefUseVariable) bool
+}
+
+// KindedVariable is a DefUseVariable whose reads and writes are intercepted
+// by a VariableKind.
+type KindedVariable interface {
+	DefUseVariable
+	// VariableKind returns the kind of the variable, the same for all the
+	// variables of the same concrete type.
+	VariableKind() VariableKind
+}
+
+// ReadVariable records the read of the variable v by the behavior b, through
+// the VariableKind of v, if any. Returns false if the read cannot be
+// recorded.
+func ReadVariable(ctx context.Context, b *Behavior, v DefUseVariable) bool {
+	if k, ok := v.(KindedVariable); ok {
+		if read := k.VariableKind().Read; read != nil {
+			return read(ctx, b, v)
+		}
+	}
+	b.Read(v)
+	return true
+}
+
+// WriteVariable records the write of the variable v by the behavior b,
+// through the VariableKind of v, if any. Returns false if the write cannot
+// be recorded.
+func WriteVariable(ctx context.Context, b *Behavior, v DefUseVariable) bool {
+	if k, ok := v.(KindedVariable); ok {
+		if write := k.VariableKind().Write; write != nil {
+			return write(ctx, b, v)
+		}
+	}
+	b.Write(v)
+	return true
+}
@@ -16,12 +16,18 @@ package dependencygraph
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"sort"
+	"sync"
 
 	"github.com/google/gapid/core/app/benchmark"
+	"github.com/google/gapid/core/context/keys"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/config"
 	"github.com/google/gapid/gapis/database"
 	"github.com/google/gapid/gapis/resolve"
 	"github.com/google/gapid/gapis/resolve/initialcmds"
@@ -37,6 +43,15 @@ type Footprint struct {
 	NumInitialCommands int
 	Behaviors          []*Behavior
 	cmdIdxToBehavior   api.SubCmdIdxTrie
+	// The behaviors that depend on each behavior, in the order they are added.
+	dependents map[*Behavior][]*Behavior
+	// The variables shared by the FootprintBuilders of all the APIs.
+	shared map[SharedVariableKey]*sharedVariable
+	// The dependency sets of the added behaviors.
+	dependencySets dependencySets
+	// The analyses of the capture by the FootprintBuilders, by API, only
+	// recorded when the footprint is resolved with Analyze set.
+	analyses map[api.ID]interface{}
 }
 
 // NewEmptyFootprint creates a new Footprint with an empty command list, and
@@ -46,6 +61,9 @@ func NewEmptyFootprint(ctx context.Context) *Footprint {
 		Commands:         []api.Cmd{},
 		Behaviors:        []*Behavior{},
 		cmdIdxToBehavior: api.SubCmdIdxTrie{},
+		dependents:       map[*Behavior][]*Behavior{},
+		shared:           map[SharedVariableKey]*sharedVariable{},
+		dependencySets:   dependencySets{},
 	}
 }
 
@@ -57,6 +75,9 @@ func NewFootprint(ctx context.Context, cmds []api.Cmd, numInitialCommands int) *
 		NumInitialCommands: numInitialCommands,
 		Behaviors:          make([]*Behavior, 0, len(cmds)),
 		cmdIdxToBehavior:   api.SubCmdIdxTrie{},
+		dependents:         map[*Behavior][]*Behavior{},
+		shared:             map[SharedVariableKey]*sharedVariable{},
+		dependencySets:     dependencySets{},
 	}
 }
 
@@ -67,11 +88,54 @@ const NotInFootprint = uint64(0xFFFFFFFFFFFFFFFF)
 // reference to the back-propagation machine which should be used to process
 // the Behavior to determine its liveness for dead code elimination.
 type Behavior struct {
-	Index     uint64
+	Index uint64
+	// The behaviors this Behavior depends on. Once the Behavior is added to a
+	// Footprint, the set may be shared with the behaviors that depend on the
+	// same behaviors, so it must not be modified directly.
 	DependsOn map[*Behavior]struct{}
 	Owner     api.SubCmdIdx
 	Alive     bool
 	Aborted   bool
+	// The provenance of the reads and writes of the Behavior, only recorded
+	// when config.DebugDeadCodeElimination is set.
+	Provenance []Provenance
+	// The variable through which the Behavior first depended on each of the
+	// behaviors it depends on, only recorded by the behaviors allocated for
+	// the footprints explaining the dead code elimination.
+	Via map[*Behavior]DefUseVariable
+	// Whether DependsOn is shared, and must be copied before being modified.
+	sharedDependsOn bool
+}
+
+// Provenance describes where a read or a write of a DefUseVariable by a
+// Behavior was emitted, to help diagnosing incorrect dependencies in the
+// footprint.
+type Provenance struct {
+	// Write is true if the variable is written, false if it is read.
+	Write bool
+	// Variable is the description of the DefUseVariable.
+	Variable string
+	// Source is the function and the source line of the FootprintBuilder that
+	// emitted the read or write.
+	Source string
+}
+
+func (p Provenance) String() string {
+	access := "Read"
+	if p.Write {
+		access = "Write"
+	}
+	return fmt.Sprintf("%v %v at %v", access, p.Variable, p.Source)
+}
+
+// Annotate records the provenance of a read or a write of the given
+// DefUseVariable by the Behavior.
+func (b *Behavior) Annotate(write bool, c DefUseVariable, source string) {
+	b.Provenance = append(b.Provenance, Provenance{
+		Write:    write,
+		Variable: fmt.Sprint(c),
+		Source:   source,
+	})
 }
 
 // NewBehavior creates a new Behavior which belongs to the command indexed by
@@ -84,14 +148,114 @@ func NewBehavior(fullCommandIndex api.SubCmdIdx) *Behavior {
 	}
 }
 
+// behaviorChunkSize is the number of Behaviors allocated at a time by a
+// BehaviorAllocator.
+const behaviorChunkSize = 4096
+
+// BehaviorAllocator hands out Behaviors from chunks, so that building the
+// footprint of a large capture does not need one heap allocation for each
+// Behavior. A chunk is kept alive as long as any of its Behaviors is
+// referenced, so each FootprintBuilder has its own allocator, and the chunks
+// live as long as the Footprint the Behaviors are added to. It is safe to be
+// used from multiple goroutines.
+type BehaviorAllocator struct {
+	sync.Mutex
+	// Explain makes the allocated behaviors record the variables they depend
+	// on each other through.
+	Explain bool
+	free    []Behavior
+}
+
+// NewBehavior creates a new Behavior which belongs to the command indexed by
+// the given SubCmdIdx, allocated from the chunks of the allocator. The set of
+// its dependencies is only allocated once it depends on a behavior.
+func (a *BehaviorAllocator) NewBehavior(fullCommandIndex api.SubCmdIdx) *Behavior {
+	a.Lock()
+	defer a.Unlock()
+	if len(a.free) == 0 {
+		a.free = make([]Behavior, behaviorChunkSize)
+	}
+	b := &a.free[0]
+	a.free = a.free[1:]
+	b.Index = NotInFootprint
+	b.Owner = fullCommandIndex
+	if a.Explain {
+		b.Via = map[*Behavior]DefUseVariable{}
+	}
+	return b
+}
+
+// dependOn records that the Behavior depends on the Behavior d. Returns false
+// if the dependency is already recorded.
+func (b *Behavior) dependOn(d *Behavior) bool {
+	if _, ok := b.DependsOn[d]; ok {
+		return false
+	}
+	if b.DependsOn == nil || b.sharedDependsOn {
+		deps := make(map[*Behavior]struct{}, len(b.DependsOn)+1)
+		for dep := range b.DependsOn {
+			deps[dep] = struct{}{}
+		}
+		b.DependsOn, b.sharedDependsOn = deps, false
+	}
+	b.DependsOn[d] = struct{}{}
+	return true
+}
+
+// removeDependency removes the dependency of the Behavior on the Behavior d.
+func (b *Behavior) removeDependency(d *Behavior) {
+	if _, ok := b.DependsOn[d]; !ok {
+		return
+	}
+	if b.sharedDependsOn {
+		deps := make(map[*Behavior]struct{}, len(b.DependsOn))
+		for dep := range b.DependsOn {
+			deps[dep] = struct{}{}
+		}
+		b.DependsOn, b.sharedDependsOn = deps, false
+	}
+	delete(b.DependsOn, d)
+}
+
+// dependencySets interns the dependency sets of the behaviors of a Footprint,
+// keyed by the sorted indices of the behaviors in the set. Many behaviors,
+// such as the ones of the commands of a command buffer, depend on the same
+// behaviors, so they can share a single set.
+type dependencySets map[string]map[*Behavior]struct{}
+
+// intern returns the set shared by the behaviors depending on the given
+// behaviors, and whether it is shared. The sets with behaviors not added to
+// the Footprint are not interned, as they have no index.
+func (s dependencySets) intern(deps map[*Behavior]struct{}) (map[*Behavior]struct{}, bool) {
+	if len(deps) == 0 {
+		return nil, false
+	}
+	indices := make([]uint64, 0, len(deps))
+	for d := range deps {
+		if d.Index == NotInFootprint {
+			return deps, false
+		}
+		indices = append(indices, d.Index)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	key := make([]byte, 8*len(indices))
+	for i, idx := range indices {
+		binary.LittleEndian.PutUint64(key[8*i:], idx)
+	}
+	if shared, ok := s[string(key)]; ok {
+		return shared, true
+	}
+	s[string(key)] = deps
+	return deps, true
+}
+
 // Read records a dependency that the current Behavior depends on the behavior
 // which writes to the given DefUseVariable fore.
 func (b *Behavior) Read(c DefUseVariable) {
-	if c.GetDefBehavior() == nil {
-		return
-	}
-	if _, ok := b.DependsOn[c.GetDefBehavior()]; !ok {
-		b.DependsOn[c.GetDefBehavior()] = struct{}{}
+	if d := c.GetDefBehavior(); d != nil {
+		if b.dependOn(d) && b.Via != nil {
+			b.Via[d] = c
+		}
 	}
 }
 
@@ -122,6 +286,46 @@ type DefUseVariable interface {
 	SetDefBehavior(*Behavior)
 }
 
+// SharedVariableKey identifies a DefUseVariable shared by the
+// FootprintBuilders of different APIs.
+type SharedVariableKey string
+
+// ExternalMemory returns the key of the shared variable that stands for the
+// given memory object shared between the APIs of a capture, e.g. through
+// AHardwareBuffers, EGLImages or external memory handles. The memory is
+// identified by its handle in the API that shares it.
+func ExternalMemory(handle uint64) SharedVariableKey {
+	return SharedVariableKey(fmt.Sprintf("ExternalMemory %v", handle))
+}
+
+type sharedVariable struct {
+	b *Behavior
+}
+
+func (v *sharedVariable) GetDefBehavior() *Behavior  { return v.b }
+func (v *sharedVariable) SetDefBehavior(b *Behavior) { v.b = b }
+
+// SharedVariable returns the DefUseVariable identified by the given key, which
+// bridges the def-use chains of the APIs that access the same resource. The
+// commands of the APIs that do not provide a FootprintBuilder modify all the
+// shared variables, so the commands that access a shared resource depend on
+// them, and keep alive the commands they depend on.
+func (f *Footprint) SharedVariable(key SharedVariableKey) DefUseVariable {
+	v, ok := f.shared[key]
+	if !ok {
+		v = &sharedVariable{}
+		f.shared[key] = v
+	}
+	return v
+}
+
+// RemoveSharedVariable removes the DefUseVariable identified by the given
+// key, once the resource it stands for is released. The commands of the APIs
+// that do not provide a FootprintBuilder no longer modify it.
+func (f *Footprint) RemoveSharedVariable(key SharedVariableKey) {
+	delete(f.shared, key)
+}
+
 // BehaviorIndex returns the index of the last Behavior in the Footprint
 // which belongs to the command or subcomand indexed by the given SubCmdIdx. In
 // case the SubCmdIdx is invalid or a valid Behavior index is not found, error
@@ -142,16 +346,63 @@ func (f *Footprint) BehaviorIndex(ctx context.Context,
 
 // AddBehavior adds the given Behavior to the Footprint and updates the
 // internal mapping from SubCmdIdx to the last Behavior that belongs to that
-// command or subcommand.
+// command or subcommand, and the reverse index of the dependencies. Only the
+// dependencies recorded before the Behavior is added are indexed.
 func (f *Footprint) AddBehavior(ctx context.Context, b *Behavior) bool {
 	bi := uint64(len(f.Behaviors))
 	fci := b.Owner
 	f.cmdIdxToBehavior.SetValue(fci, bi)
 	f.Behaviors = append(f.Behaviors, b)
 	b.Index = bi
+	for d := range b.DependsOn {
+		f.dependents[d] = append(f.dependents[d], b)
+	}
+	b.DependsOn, b.sharedDependsOn = f.dependencySets.intern(b.DependsOn)
 	return true
 }
 
+// addDependency records that the Behavior b, which is already added to the
+// Footprint, depends on the Behavior d.
+func (f *Footprint) addDependency(b, d *Behavior) {
+	if b.dependOn(d) {
+		f.dependents[d] = append(f.dependents[d], b)
+	}
+}
+
+// Dependents returns the behaviors in the Footprint which directly depend on
+// the given Behavior.
+func (f *Footprint) Dependents(b *Behavior) []*Behavior {
+	return f.dependents[b]
+}
+
+// DumpProvenance writes to w the behaviors of the Footprint, with the command
+// they belong to, their dependencies and the provenance of their reads and
+// writes. The provenance is only recorded when config.DebugDeadCodeElimination
+// is set.
+func (f *Footprint) DumpProvenance(w io.Writer) error {
+	for _, b := range f.Behaviors {
+		name := "<unknown>"
+		if len(b.Owner) > 0 && b.Owner[0] < uint64(len(f.Commands)) {
+			name = f.Commands[b.Owner[0]].CmdName()
+		}
+		deps := make([]uint64, 0, len(b.DependsOn))
+		for d := range b.DependsOn {
+			deps = append(deps, d.Index)
+		}
+		sort.Slice(deps, func(i, j int) bool { return deps[i] < deps[j] })
+		if _, err := fmt.Fprintf(w, "Behavior %v: %v %v alive: %v aborted: %v depends on: %v\n",
+			b.Index, b.Owner, name, b.Alive, b.Aborted, deps); err != nil {
+			return err
+		}
+		for _, p := range b.Provenance {
+			if _, err := fmt.Fprintf(w, "    %v\n", p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // FootprintBuilderProvider provides FootprintBuilder
 type FootprintBuilderProvider interface {
 	FootprintBuilder(context.Context) FootprintBuilder
@@ -162,6 +413,34 @@ type FootprintBuilder interface {
 	BuildFootprint(context.Context, *api.GlobalState, *Footprint, api.CmdID, api.Cmd)
 }
 
+// FootprintAnalyzer is implemented by the FootprintBuilders that analyze the
+// capture while they build its footprint, so that the analyses do not need
+// another pass over the commands. The builders only analyze the capture if
+// Analyzes returns true for the context they are created with.
+type FootprintAnalyzer interface {
+	// Analysis returns the analysis of the commands, once the footprint of
+	// all of them is built.
+	Analysis(context.Context, *Footprint) interface{}
+}
+
+// GetFootprintAnalysis returns the analysis of the given capture by the
+// FootprintBuilder of the given API, built along with the footprint of the
+// capture.
+func GetFootprintAnalysis(ctx context.Context, c *path.Capture, a api.API) (interface{}, error) {
+	r, err := database.Build(ctx, &FootprintResolvable{
+		Capture: c,
+		Analyze: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	analysis, ok := r.(*Footprint).analyses[a.ID()]
+	if !ok {
+		return nil, fmt.Errorf("Capture is not analyzed by the footprint builder of %v", a.Name())
+	}
+	return analysis, nil
+}
+
 // GetFootprint returns a pointer to the resolved Footprint.
 func GetFootprint(ctx context.Context, c *path.Capture) (*Footprint, error) {
 	r, err := database.Build(ctx, &FootprintResolvable{
@@ -173,9 +452,127 @@ func GetFootprint(ctx context.Context, c *path.Capture) (*Footprint, error) {
 	return r.(*Footprint), nil
 }
 
+// GetDependencies returns the commands and subcommands that the given
+// command or subcommand directly depends on, according to the Footprint of
+// the capture. The dependencies of a command include the dependencies of all
+// its subcommands, but not the command itself or its subcommands. Commands
+// that build the initial state of the capture are not returned.
+func GetDependencies(ctx context.Context, p *path.Command) ([]*path.Command, error) {
+	ft, cmd, err := resolveFootprintCommand(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	deps := []api.SubCmdIdx{}
+	seen := map[*Behavior]struct{}{}
+	for _, b := range ft.Behaviors {
+		if !cmd.Contains(b.Owner) {
+			continue
+		}
+		for d := range b.DependsOn {
+			if _, ok := seen[d]; ok {
+				continue
+			}
+			seen[d] = struct{}{}
+			if !cmd.Contains(d.Owner) {
+				deps = append(deps, d.Owner)
+			}
+		}
+	}
+	return ft.commandPaths(p.Capture, deps), nil
+}
+
+// GetDependents returns the commands and subcommands that directly depend on
+// the given command or subcommand, i.e. the ones that read the data written by
+// the given command, according to the Footprint of the capture. The dependents
+// of a command include the dependents of all its subcommands, but not the
+// command itself or its subcommands.
+func GetDependents(ctx context.Context, p *path.Command) ([]*path.Command, error) {
+	ft, cmd, err := resolveFootprintCommand(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	deps := []api.SubCmdIdx{}
+	seen := map[*Behavior]struct{}{}
+	for _, b := range ft.Behaviors {
+		if !cmd.Contains(b.Owner) {
+			continue
+		}
+		for _, d := range ft.Dependents(b) {
+			if _, ok := seen[d]; ok {
+				continue
+			}
+			seen[d] = struct{}{}
+			if !cmd.Contains(d.Owner) {
+				deps = append(deps, d.Owner)
+			}
+		}
+	}
+	return ft.commandPaths(p.Capture, deps), nil
+}
+
+// resolveFootprintCommand returns the Footprint of the capture of the given
+// command, and the index of the command in the Footprint, which is shifted by
+// the number of the initial commands.
+func resolveFootprintCommand(ctx context.Context, p *path.Command) (*Footprint, api.SubCmdIdx, error) {
+	ft, err := GetFootprint(ctx, p.Capture)
+	if err != nil {
+		return nil, nil, err
+	}
+	numInitialCmds := uint64(ft.NumInitialCommands)
+	if len(p.Indices) == 0 || p.Indices[0] >= uint64(len(ft.Commands))-numInitialCmds {
+		return nil, nil, fmt.Errorf("Invalid command: %v", p.Indices)
+	}
+	return ft, append(api.SubCmdIdx{p.Indices[0] + numInitialCmds}, p.Indices[1:]...), nil
+}
+
+// commandPaths returns the sorted and deduplicated paths of the given command
+// indices of the Footprint. Initial commands are dropped.
+func (f *Footprint) commandPaths(c *path.Capture, cmds []api.SubCmdIdx) []*path.Command {
+	numInitialCmds := uint64(f.NumInitialCommands)
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].LessThan(cmds[j]) })
+	out := []*path.Command{}
+	for i, cmd := range cmds {
+		if len(cmd) == 0 || cmd[0] < numInitialCmds || (i > 0 && cmd.Equals(cmds[i-1])) {
+			continue
+		}
+		out = append(out, c.Command(cmd[0]-numInitialCmds, cmd[1:]...))
+	}
+	return out
+}
+
+type explainKeyTy string
+
+const explainKey = explainKeyTy("explainDeadCodeElimination")
+
+// Explains returns true if the footprint built with the given context
+// explains the dead code elimination, in which case the FootprintBuilders
+// should allocate their behaviors with BehaviorAllocator.Explain set.
+func Explains(ctx context.Context) bool {
+	explain, _ := ctx.Value(explainKey).(bool)
+	return explain
+}
+
+type analyzeKeyTy string
+
+const analyzeKey = analyzeKeyTy("analyzeCapture")
+
+// Analyzes returns true if the footprint built with the given context is
+// resolved with Analyze set, in which case the FootprintBuilders implementing
+// FootprintAnalyzer should analyze the capture.
+func Analyzes(ctx context.Context) bool {
+	analyze, _ := ctx.Value(analyzeKey).(bool)
+	return analyze
+}
+
 // Resolve implements the database.Resolver interface.
 func (r *FootprintResolvable) Resolve(ctx context.Context) (interface{}, error) {
 	ctx = resolve.SetupContext(ctx, r.Capture, r.Config)
+	if r.Explain {
+		ctx = keys.WithValue(ctx, explainKey, true)
+	}
+	if r.Analyze {
+		ctx = keys.WithValue(ctx, analyzeKey, true)
+	}
 
 	c, err := capture.Resolve(ctx)
 	if err != nil {
@@ -193,6 +590,13 @@ func (r *FootprintResolvable) Resolve(ctx context.Context) (interface{}, error)
 		cmds = append(initialCmds, cmds...)
 	}
 
+	if !r.Explain && !r.Analyze {
+		// The variables of the dependencies and the analyses are not cached.
+		if ft := loadFootprint(ctx, r.Capture, cmds, numInitialCmds); ft != nil {
+			return ft, nil
+		}
+	}
+
 	builders := map[api.API]FootprintBuilder{}
 
 	ft := NewFootprint(ctx, cmds, numInitialCmds)
@@ -200,7 +604,7 @@ func (r *FootprintResolvable) Resolve(ctx context.Context) (interface{}, error)
 	s := c.NewUninitializedState(ctx).ReserveMemory(ranges)
 	t0 := footprintBuildCounter.Start()
 	defer footprintBuildCounter.Stop(t0)
-	api.ForeachCmd(ctx, cmds, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
+	err = api.ForeachCmd(ctx, cmds, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
 		a := cmd.API()
 		if _, ok := builders[cmd.API()]; !ok {
 			if bp, ok := cmd.API().(FootprintBuilderProvider); ok {
@@ -220,6 +624,11 @@ func (r *FootprintResolvable) Resolve(ctx context.Context) (interface{}, error)
 					// following mutate calls, which are to build the replay
 					// instructions, that are responsible to catch the error.
 					// TODO: This error should be moved to report view.
+				} else {
+					// The command may access any resource shared with other APIs.
+					for _, v := range ft.shared {
+						bh.Modify(v)
+					}
 				}
 				ft.AddBehavior(ctx, bh)
 				return nil
@@ -228,5 +637,22 @@ func (r *FootprintResolvable) Resolve(ctx context.Context) (interface{}, error)
 		builders[a].BuildFootprint(ctx, s, ft, id, cmd)
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	if config.DetectFootprintCycles {
+		ft.BreakCycles(ctx)
+	}
+	if r.Analyze {
+		ft.analyses = map[api.ID]interface{}{}
+		for a, b := range builders {
+			if fa, ok := b.(FootprintAnalyzer); ok {
+				ft.analyses[a.ID()] = fa.Analysis(ctx, ft)
+			}
+		}
+	}
+	if !r.Explain {
+		storeFootprint(ctx, r.Capture, ft)
+	}
 	return ft, nil
 }
@@ -0,0 +1,156 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dependencygraph
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/config"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// footprintCacheVersion is the version of the footprint builders. It must be
+// bumped whenever a change to the footprint builders changes the built
+// footprints, so the footprints cached by the older versions are discarded.
+// Version 2 tracks memory aliasing, external memory, image layouts,
+// descriptors, indirect commands and vertex and index ranges.
+const footprintCacheVersion = 2
+
+// footprintRecord returns the name of the database record to cache the
+// footprint of the given capture, or an empty string if the capture has no ID.
+func footprintRecord(c *path.Capture) string {
+	if c.GetID() == nil {
+		return ""
+	}
+	return "footprints/" + c.GetID().ID().String()
+}
+
+// loadFootprint loads the footprint of the given capture from the database
+// records kept across the sessions. Returns nil if the footprint is not
+// cached, or the cached one does not match the given commands.
+func loadFootprint(ctx context.Context, c *path.Capture, cmds []api.Cmd,
+	numInitialCmds int) *Footprint {
+	if config.DebugDeadCodeElimination {
+		// The provenance of the behaviors is not cached.
+		return nil
+	}
+	name := footprintRecord(c)
+	if name == "" {
+		return nil
+	}
+	data, err := database.LoadRecord(ctx, name)
+	if err != nil {
+		log.W(ctx, "Could not read cached footprint: %v", err)
+		return nil
+	}
+	if data == nil {
+		return nil
+	}
+	cache := &FootprintCache{}
+	if err := proto.Unmarshal(data, cache); err != nil {
+		log.W(ctx, "Could not decode cached footprint: %v", err)
+		return nil
+	}
+	if cache.Version != footprintCacheVersion ||
+		cache.Granularity != config.FootprintGranularity ||
+		cache.NumCommands != uint64(len(cmds)) ||
+		cache.NumInitialCommands != uint64(numInitialCmds) {
+		return nil
+	}
+	ft, err := footprintFromCache(ctx, cache, cmds, numInitialCmds)
+	if err != nil {
+		log.W(ctx, "Invalid cached footprint: %v", err)
+		return nil
+	}
+	return ft
+}
+
+// storeFootprint stores the given footprint of the given capture in the
+// database records kept across the sessions.
+func storeFootprint(ctx context.Context, c *path.Capture, ft *Footprint) {
+	name := footprintRecord(c)
+	if name == "" || database.GetPersistent(ctx) == nil {
+		return
+	}
+	data, err := proto.Marshal(ft.toCache())
+	if err != nil {
+		log.W(ctx, "Could not encode footprint: %v", err)
+		return
+	}
+	if err := database.StoreRecord(ctx, name, data); err != nil {
+		log.W(ctx, "Could not write footprint cache: %v", err)
+	}
+}
+
+// toCache returns the serialized form of the Footprint. The commands are not
+// serialized, as they are resolved from the capture.
+func (f *Footprint) toCache() *FootprintCache {
+	cache := &FootprintCache{
+		Version:            footprintCacheVersion,
+		Granularity:        config.FootprintGranularity,
+		NumCommands:        uint64(len(f.Commands)),
+		NumInitialCommands: uint64(f.NumInitialCommands),
+		Behaviors:          make([]*CachedBehavior, len(f.Behaviors)),
+	}
+	for i, b := range f.Behaviors {
+		cb := &CachedBehavior{
+			Owner:     []uint64(b.Owner),
+			DependsOn: make([]uint64, 0, len(b.DependsOn)),
+			Alive:     b.Alive,
+			Aborted:   b.Aborted,
+		}
+		for d := range b.DependsOn {
+			// Behaviors not added to the Footprint are not serialized.
+			if d.Index != NotInFootprint {
+				cb.DependsOn = append(cb.DependsOn, d.Index)
+			}
+		}
+		// The dependencies are sorted, so the same footprint is always
+		// serialized the same way.
+		sort.Slice(cb.DependsOn, func(i, j int) bool { return cb.DependsOn[i] < cb.DependsOn[j] })
+		cache.Behaviors[i] = cb
+	}
+	return cache
+}
+
+// footprintFromCache rebuilds the Footprint of the given commands from its
+// serialized form.
+func footprintFromCache(ctx context.Context, cache *FootprintCache,
+	cmds []api.Cmd, numInitialCmds int) (*Footprint, error) {
+	ft := NewFootprint(ctx, cmds, numInitialCmds)
+	for _, cb := range cache.Behaviors {
+		b := NewBehavior(api.SubCmdIdx(cb.Owner))
+		b.Alive = cb.Alive
+		b.Aborted = cb.Aborted
+		ft.AddBehavior(ctx, b)
+	}
+	// A behavior may depend on a behavior added after it, so the dependencies
+	// are restored after all the behaviors are added.
+	for i, cb := range cache.Behaviors {
+		for _, d := range cb.DependsOn {
+			if d >= uint64(len(ft.Behaviors)) {
+				return nil, fmt.Errorf("Behavior %v depends on an invalid behavior %v", i, d)
+			}
+			ft.addDependency(ft.Behaviors[i], ft.Behaviors[d])
+		}
+	}
+	return ft, nil
+}
@@ -0,0 +1,139 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dependencygraph
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+)
+
+// FindCycles returns the cycles of dependencies between the behaviors of the
+// Footprint, as the strongly connected components of the dependency graph
+// which contain more than one behavior, or a behavior depending on itself.
+// The behaviors of each cycle are sorted by index, and the cycles are sorted
+// by the index of their first behavior.
+func (f *Footprint) FindCycles() [][]*Behavior {
+	// Tarjan's strongly connected components algorithm, with an explicit stack
+	// as the dependency chains can be as long as the capture.
+	type frame struct {
+		b    *Behavior
+		deps []*Behavior
+	}
+	index := map[*Behavior]int{}
+	lowLink := map[*Behavior]int{}
+	onStack := map[*Behavior]bool{}
+	stack := []*Behavior{}
+	cycles := [][]*Behavior{}
+
+	for _, root := range f.Behaviors {
+		if _, ok := index[root]; ok {
+			continue
+		}
+		visit := func(b *Behavior) frame {
+			index[b] = len(index)
+			lowLink[b] = index[b]
+			stack = append(stack, b)
+			onStack[b] = true
+			deps := make([]*Behavior, 0, len(b.DependsOn))
+			for d := range b.DependsOn {
+				deps = append(deps, d)
+			}
+			return frame{b, deps}
+		}
+		frames := []frame{visit(root)}
+		for len(frames) > 0 {
+			top := &frames[len(frames)-1]
+			if len(top.deps) > 0 {
+				d := top.deps[0]
+				top.deps = top.deps[1:]
+				if _, ok := index[d]; !ok {
+					frames = append(frames, visit(d))
+				} else if onStack[d] && index[d] < lowLink[top.b] {
+					lowLink[top.b] = index[d]
+				}
+				continue
+			}
+			b := top.b
+			frames = frames[:len(frames)-1]
+			if len(frames) > 0 {
+				if parent := frames[len(frames)-1].b; lowLink[b] < lowLink[parent] {
+					lowLink[parent] = lowLink[b]
+				}
+			}
+			if lowLink[b] != index[b] {
+				continue
+			}
+			scc := []*Behavior{}
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				scc = append(scc, top)
+				if top == b {
+					break
+				}
+			}
+			if _, self := b.DependsOn[b]; len(scc) > 1 || self {
+				sort.Slice(scc, func(i, j int) bool { return scc[i].Index < scc[j].Index })
+				cycles = append(cycles, scc)
+			}
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0].Index < cycles[j][0].Index })
+	return cycles
+}
+
+// BreakCycles finds the cycles of dependencies between the behaviors of the
+// Footprint, reports the commands involved in each cycle, and breaks the
+// cycles conservatively: the behaviors of a cycle are kept alive, so no
+// command of the cycle can be trimmed, and their dependencies on the
+// behaviors of the same cycle that are added later are dropped. Returns the
+// broken cycles.
+func (f *Footprint) BreakCycles(ctx context.Context) [][]*Behavior {
+	cycles := f.FindCycles()
+	for _, cycle := range cycles {
+		cmds := make([]api.SubCmdIdx, len(cycle))
+		inCycle := make(map[*Behavior]struct{}, len(cycle))
+		for i, b := range cycle {
+			cmds[i] = b.Owner
+			inCycle[b] = struct{}{}
+		}
+		log.W(ctx, "Dependency cycle between %v behaviors of commands: %v", len(cycle), cmds)
+		for _, b := range cycle {
+			b.Alive = true
+			for d := range b.DependsOn {
+				if _, ok := inCycle[d]; ok && d.Index >= b.Index {
+					b.removeDependency(d)
+					f.removeDependent(d, b)
+				}
+			}
+		}
+	}
+	return cycles
+}
+
+// removeDependent removes b from the indexed dependents of d.
+func (f *Footprint) removeDependent(d, b *Behavior) {
+	dependents := f.dependents[d]
+	for i, dependent := range dependents {
+		if dependent == b {
+			f.dependents[d] = append(dependents[:i:i], dependents[i+1:]...)
+			return
+		}
+	}
+}
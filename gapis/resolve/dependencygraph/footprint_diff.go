@@ -0,0 +1,243 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dependencygraph
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// FootprintDiff is the difference between the footprints of two captures,
+// e.g. captured before and after a change of the application, whose commands
+// are aligned by their names. The commands are identified by their IDs in
+// their captures, and the commands that build the initial state are ignored.
+type FootprintDiff struct {
+	// The commands of the before capture that are not aligned with any command
+	// of the after capture.
+	Removed []api.CmdID
+	// The commands of the after capture that are not aligned with any command
+	// of the before capture.
+	Added []api.CmdID
+	// The aligned commands whose dependencies are different.
+	Changed []CommandDependencyDiff
+	// The commands of the after capture aligned with each command of the
+	// before capture.
+	Aligned map[api.CmdID]api.CmdID
+}
+
+// CommandDependencyDiff is the difference between the dependencies of two
+// aligned commands.
+type CommandDependencyDiff struct {
+	Before api.CmdID
+	After  api.CmdID
+	// The dependencies of the before command that are not aligned with any
+	// dependency of the after command, in the before capture.
+	Lost []api.CmdID
+	// The dependencies of the after command that are not aligned with any
+	// dependency of the before command, in the after capture.
+	Gained []api.CmdID
+}
+
+func (d CommandDependencyDiff) String() string {
+	return fmt.Sprintf("%v -> %v: lost: %v gained: %v", d.Before, d.After, d.Lost, d.Gained)
+}
+
+// DiffFootprints returns the difference between the footprints of the before
+// and after captures.
+func DiffFootprints(ctx context.Context, before, after *path.Capture) (*FootprintDiff, error) {
+	r, err := database.Build(ctx, &FootprintDiffResolvable{
+		Before: before,
+		After:  after,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not diff execution footprints: %v", err)
+	}
+	return r.(*FootprintDiff), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *FootprintDiffResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	before, err := GetFootprint(ctx, r.Before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := GetFootprint(ctx, r.After)
+	if err != nil {
+		return nil, err
+	}
+	return before.Diff(after), nil
+}
+
+// Diff aligns the commands of the Footprint with the commands of the after
+// Footprint, as the longest common subsequence of their names, and returns
+// the aligned commands whose dependencies are not aligned with each other, as
+// well as the commands that are not aligned.
+func (f *Footprint) Diff(after *Footprint) *FootprintDiff {
+	beforeCmds := f.Commands[f.NumInitialCommands:]
+	afterCmds := after.Commands[after.NumInitialCommands:]
+	toAfter := make(map[api.CmdID]api.CmdID, len(beforeCmds))
+	toBefore := make(map[api.CmdID]api.CmdID, len(afterCmds))
+	for _, p := range alignCommands(commandNames(beforeCmds), commandNames(afterCmds)) {
+		toAfter[api.CmdID(p[0])] = api.CmdID(p[1])
+		toBefore[api.CmdID(p[1])] = api.CmdID(p[0])
+	}
+
+	diff := &FootprintDiff{
+		Removed: []api.CmdID{},
+		Added:   []api.CmdID{},
+		Changed: []CommandDependencyDiff{},
+		Aligned: toAfter,
+	}
+	for i := range beforeCmds {
+		if _, ok := toAfter[api.CmdID(i)]; !ok {
+			diff.Removed = append(diff.Removed, api.CmdID(i))
+		}
+	}
+	for i := range afterCmds {
+		if _, ok := toBefore[api.CmdID(i)]; !ok {
+			diff.Added = append(diff.Added, api.CmdID(i))
+		}
+	}
+
+	beforeDeps := f.commandDependencies()
+	afterDeps := after.commandDependencies()
+	for i := range beforeCmds {
+		b := api.CmdID(i)
+		a, ok := toAfter[b]
+		if !ok {
+			continue
+		}
+		lost := unalignedDependencies(beforeDeps[b], afterDeps[a], toAfter)
+		gained := unalignedDependencies(afterDeps[a], beforeDeps[b], toBefore)
+		if len(lost) > 0 || len(gained) > 0 {
+			diff.Changed = append(diff.Changed, CommandDependencyDiff{b, a, lost, gained})
+		}
+	}
+	return diff
+}
+
+// commandDependencies returns the commands each command of the capture
+// depends on, including the dependencies of its subcommands. The commands are
+// identified by their IDs in the capture, and the dependencies on the commands
+// that build the initial state are dropped.
+func (f *Footprint) commandDependencies() []map[api.CmdID]struct{} {
+	numInitialCmds := uint64(f.NumInitialCommands)
+	deps := make([]map[api.CmdID]struct{}, uint64(len(f.Commands))-numInitialCmds)
+	for _, b := range f.Behaviors {
+		if len(b.Owner) == 0 || b.Owner[0] < numInitialCmds {
+			continue
+		}
+		owner := b.Owner[0] - numInitialCmds
+		for d := range b.DependsOn {
+			if len(d.Owner) == 0 || d.Owner[0] < numInitialCmds || d.Owner[0]-numInitialCmds == owner {
+				continue
+			}
+			if deps[owner] == nil {
+				deps[owner] = map[api.CmdID]struct{}{}
+			}
+			deps[owner][api.CmdID(d.Owner[0]-numInitialCmds)] = struct{}{}
+		}
+	}
+	return deps
+}
+
+// unalignedDependencies returns the sorted dependencies in deps that are not
+// aligned by align with any dependency in others.
+func unalignedDependencies(deps, others map[api.CmdID]struct{}, align map[api.CmdID]api.CmdID) []api.CmdID {
+	out := []api.CmdID{}
+	for d := range deps {
+		if o, ok := align[d]; ok {
+			if _, ok := others[o]; ok {
+				continue
+			}
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func commandNames(cmds []api.Cmd) []string {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.CmdName()
+	}
+	return names
+}
+
+// alignCommands returns the pairs of indices of the aligned elements of a and
+// b, in ascending order, which form the longest common subsequence of a and b
+// found by the Myers diff algorithm. The time and memory taken are quadratic in
+// the number of the unaligned elements, rather than in the lengths of a and b.
+func alignCommands(a, b []string) [][2]int {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*(n+m)+2)
+	// The furthest reaching x of each diagonal k in [-d, d] after each step d,
+	// to backtrack the path.
+	trace := [][]int{}
+	found := false
+	for d := 0; d <= n+m && !found; d++ {
+		for k := -d; k <= d; k += 2 {
+			x := 0
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+			}
+		}
+		trace = append(trace, append([]int{}, v[offset-d:offset+d+1]...))
+	}
+
+	pairs := [][2]int{}
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			pairs = append(pairs, [2]int{x, y})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		x, y = x-1, y-1
+		pairs = append(pairs, [2]int{x, y})
+	}
+	for i, j := 0, len(pairs)-1; i < j; i, j = i+1, j-1 {
+		pairs[i], pairs[j] = pairs[j], pairs[i]
+	}
+	return pairs
+}
@@ -15,6 +15,9 @@
 package dependencygraph_test
 
 import (
+	"bytes"
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/google/gapid/core/assert"
@@ -57,3 +60,275 @@ func TestFootprintAddAndGetBehavior(t *testing.T) {
 		}
 	}
 }
+
+func TestNewBehaviorDistinct(t *testing.T) {
+	ctx := log.Testing(t)
+	seen := map[*dependencygraph.Behavior]struct{}{}
+	a := &dependencygraph.BehaviorAllocator{}
+	for i := 0; i < 10000; i++ {
+		b := a.NewBehavior(api.SubCmdIdx{uint64(i)})
+		_, reused := seen[b]
+		assert.For(ctx, "Reused").That(reused).Equals(false)
+		seen[b] = struct{}{}
+		assert.For(ctx, "Index").That(b.Index).Equals(dependencygraph.NotInFootprint)
+		assert.For(ctx, "Owner").That(b.Owner[0]).Equals(uint64(i))
+	}
+}
+
+func TestFootprintInternedDependencies(t *testing.T) {
+	ctx := log.Testing(t)
+	ft := dependencygraph.NewEmptyFootprint(ctx)
+	a := &dependencygraph.BehaviorAllocator{}
+	v := ft.SharedVariable(dependencygraph.ExternalMemory(1))
+	writer := a.NewBehavior(api.SubCmdIdx{0})
+	writer.Write(v)
+	ft.AddBehavior(ctx, writer)
+	x, y := a.NewBehavior(api.SubCmdIdx{1}), a.NewBehavior(api.SubCmdIdx{2})
+	x.Read(v)
+	y.Read(v)
+	ft.AddBehavior(ctx, x)
+	ft.AddBehavior(ctx, y)
+
+	// Adding a dependency to x must not add it to y, which shares its set.
+	x.Read(&testVariable{y})
+	_, xDependsOnY := x.DependsOn[y]
+	_, yDependsOnY := y.DependsOn[y]
+	assert.For(ctx, "x depends on y").That(xDependsOnY).Equals(true)
+	assert.For(ctx, "y depends on y").That(yDependsOnY).Equals(false)
+	assert.For(ctx, "Dependencies of y").That(len(y.DependsOn)).Equals(1)
+	assert.For(ctx, "Dependencies of writer").That(len(writer.DependsOn)).Equals(0)
+}
+
+// testVariable is a DefUseVariable defined by a given behavior.
+type testVariable struct{ b *dependencygraph.Behavior }
+
+func (v *testVariable) GetDefBehavior() *dependencygraph.Behavior  { return v.b }
+func (v *testVariable) SetDefBehavior(b *dependencygraph.Behavior) { v.b = b }
+
+// BenchmarkFootprintBehaviors measures the memory used by the behaviors of a
+// footprint where groups of behaviors depend on the same behaviors, as the
+// commands of a command buffer do.
+func BenchmarkFootprintBehaviors(b *testing.B) {
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ft := dependencygraph.NewEmptyFootprint(ctx)
+		a := &dependencygraph.BehaviorAllocator{}
+		vars := make([]*testVariable, 16)
+		for j := range vars {
+			vars[j] = &testVariable{}
+		}
+		for j := 0; j < 100000; j++ {
+			bh := a.NewBehavior(api.SubCmdIdx{uint64(j)})
+			bh.Read(vars[j%len(vars)])
+			bh.Read(vars[(j+1)%len(vars)])
+			if j%100 == 0 {
+				bh.Write(vars[j%len(vars)])
+			}
+			ft.AddBehavior(ctx, bh)
+		}
+	}
+}
+
+func TestFootprintDependents(t *testing.T) {
+	ctx := log.Testing(t)
+	ft := dependencygraph.NewEmptyFootprint(ctx)
+	behaviors := []*dependencygraph.Behavior{
+		dependencygraph.NewBehavior(api.SubCmdIdx{0}),
+		dependencygraph.NewBehavior(api.SubCmdIdx{1}),
+		dependencygraph.NewBehavior(api.SubCmdIdx{2}),
+	}
+	// 1 and 2 depend on 0, 2 depends on 1.
+	behaviors[1].DependsOn[behaviors[0]] = struct{}{}
+	behaviors[2].DependsOn[behaviors[0]] = struct{}{}
+	behaviors[2].DependsOn[behaviors[1]] = struct{}{}
+	for _, b := range behaviors {
+		ft.AddBehavior(ctx, b)
+	}
+	assert.For(ctx, "Dependents of 0").That(ft.Dependents(behaviors[0])).DeepEquals(
+		[]*dependencygraph.Behavior{behaviors[1], behaviors[2]})
+	assert.For(ctx, "Dependents of 1").That(ft.Dependents(behaviors[1])).DeepEquals(
+		[]*dependencygraph.Behavior{behaviors[2]})
+	assert.For(ctx, "Dependents of 2").That(len(ft.Dependents(behaviors[2]))).Equals(0)
+}
+
+func TestFootprintSharedVariable(t *testing.T) {
+	ctx := log.Testing(t)
+	ft := dependencygraph.NewEmptyFootprint(ctx)
+	v := ft.SharedVariable(dependencygraph.ExternalMemory(1))
+	assert.For(ctx, "Same key").That(ft.SharedVariable(dependencygraph.ExternalMemory(1))).Equals(v)
+	assert.For(ctx, "Other memory").That(ft.SharedVariable(dependencygraph.ExternalMemory(2))).NotEquals(v)
+
+	// 0 writes the shared variable in one API, 1 reads it in another API.
+	writer := dependencygraph.NewBehavior(api.SubCmdIdx{0})
+	writer.Write(v)
+	ft.AddBehavior(ctx, writer)
+	reader := dependencygraph.NewBehavior(api.SubCmdIdx{1})
+	reader.Read(ft.SharedVariable(dependencygraph.ExternalMemory(1)))
+	ft.AddBehavior(ctx, reader)
+	assert.For(ctx, "Dependents of writer").That(ft.Dependents(writer)).DeepEquals(
+		[]*dependencygraph.Behavior{reader})
+}
+
+func TestBehaviorProvenance(t *testing.T) {
+	ctx := log.Testing(t)
+	ft := dependencygraph.NewEmptyFootprint(ctx)
+	v := ft.SharedVariable(dependencygraph.ExternalMemory(1))
+	writer := dependencygraph.NewBehavior(api.SubCmdIdx{0})
+	writer.Write(v)
+	writer.Annotate(true, v, "writer")
+	ft.AddBehavior(ctx, writer)
+	reader := dependencygraph.NewBehavior(api.SubCmdIdx{1})
+	reader.Read(v)
+	reader.Annotate(false, v, "reader")
+	ft.AddBehavior(ctx, reader)
+
+	buf := &bytes.Buffer{}
+	assert.For(ctx, "err").ThatError(ft.DumpProvenance(buf)).Succeeded()
+	dump := buf.String()
+	assert.For(ctx, "Dump writer").That(strings.Contains(dump, " at writer")).Equals(true)
+	assert.For(ctx, "Dump reader deps").That(strings.Contains(dump,
+		"Behavior 1: [1] <unknown> alive: false aborted: false depends on: [0]")).Equals(true)
+	assert.For(ctx, "Dump reader").That(strings.Contains(dump, " at reader")).Equals(true)
+}
+
+func TestBehaviorVia(t *testing.T) {
+	ctx := log.Testing(t)
+	ft := dependencygraph.NewEmptyFootprint(ctx)
+	v := ft.SharedVariable(dependencygraph.ExternalMemory(1))
+	a := &dependencygraph.BehaviorAllocator{}
+	writer := a.NewBehavior(api.SubCmdIdx{0})
+	writer.Write(v)
+	ft.AddBehavior(ctx, writer)
+	reader := a.NewBehavior(api.SubCmdIdx{1})
+	reader.Read(v)
+	ft.AddBehavior(ctx, reader)
+	assert.For(ctx, "Not explained").That(reader.Via).IsNil()
+
+	a.Explain = true
+	explained := a.NewBehavior(api.SubCmdIdx{2})
+	explained.Read(v)
+	explained.Read(v)
+	ft.AddBehavior(ctx, explained)
+	assert.For(ctx, "Explained").That(explained.Via).DeepEquals(
+		map[*dependencygraph.Behavior]dependencygraph.DefUseVariable{writer: v})
+}
+
+func TestFootprintBreakCycles(t *testing.T) {
+	ctx := log.Testing(t)
+	ft := dependencygraph.NewEmptyFootprint(ctx)
+	behaviors := []*dependencygraph.Behavior{
+		dependencygraph.NewBehavior(api.SubCmdIdx{0}),
+		dependencygraph.NewBehavior(api.SubCmdIdx{1}),
+		dependencygraph.NewBehavior(api.SubCmdIdx{2}),
+		dependencygraph.NewBehavior(api.SubCmdIdx{3}),
+	}
+	// 1 depends on 0, 2 and 3 depend on each other.
+	behaviors[1].DependsOn[behaviors[0]] = struct{}{}
+	behaviors[2].DependsOn[behaviors[3]] = struct{}{}
+	behaviors[3].DependsOn[behaviors[2]] = struct{}{}
+	for _, b := range behaviors {
+		ft.AddBehavior(ctx, b)
+	}
+	assert.For(ctx, "Cycles").That(ft.FindCycles()).DeepEquals(
+		[][]*dependencygraph.Behavior{{behaviors[2], behaviors[3]}})
+
+	assert.For(ctx, "Broken cycles").That(len(ft.BreakCycles(ctx))).Equals(1)
+	assert.For(ctx, "Cycles after break").That(len(ft.FindCycles())).Equals(0)
+	assert.For(ctx, "Alive 2").That(behaviors[2].Alive).Equals(true)
+	assert.For(ctx, "Alive 3").That(behaviors[3].Alive).Equals(true)
+	assert.For(ctx, "Alive 1").That(behaviors[1].Alive).Equals(false)
+	assert.For(ctx, "Dependents of 3").That(len(ft.Dependents(behaviors[3]))).Equals(0)
+	assert.For(ctx, "Dependents of 2").That(ft.Dependents(behaviors[2])).DeepEquals(
+		[]*dependencygraph.Behavior{behaviors[3]})
+}
+
+// guardedVariable is a DefUseVariable whose reads and writes are ignored while
+// it is disabled.
+type guardedVariable struct {
+	b        *dependencygraph.Behavior
+	disabled bool
+}
+
+func (v *guardedVariable) GetDefBehavior() *dependencygraph.Behavior  { return v.b }
+func (v *guardedVariable) SetDefBehavior(b *dependencygraph.Behavior) { v.b = b }
+func (v *guardedVariable) VariableKind() dependencygraph.VariableKind {
+	return dependencygraph.VariableKind{
+		Name: "guardedVariable",
+		Read: func(ctx context.Context, b *dependencygraph.Behavior, v dependencygraph.DefUseVariable) bool {
+			if v.(*guardedVariable).disabled {
+				return false
+			}
+			b.Read(v)
+			return true
+		},
+	}
+}
+
+func TestVariableKind(t *testing.T) {
+	ctx := log.Testing(t)
+
+	v := &guardedVariable{}
+	writer := dependencygraph.NewBehavior(api.SubCmdIdx{0})
+	assert.For(ctx, "Write").That(dependencygraph.WriteVariable(ctx, writer, v)).Equals(true)
+	assert.For(ctx, "Defined by writer").That(v.GetDefBehavior()).Equals(writer)
+
+	v.disabled = true
+	ignored := dependencygraph.NewBehavior(api.SubCmdIdx{1})
+	assert.For(ctx, "Read disabled").That(dependencygraph.ReadVariable(ctx, ignored, v)).Equals(false)
+	assert.For(ctx, "Ignored deps").That(len(ignored.DependsOn)).Equals(0)
+
+	v.disabled = false
+	reader := dependencygraph.NewBehavior(api.SubCmdIdx{2})
+	assert.For(ctx, "Read").That(dependencygraph.ReadVariable(ctx, reader, v)).Equals(true)
+	_, ok := reader.DependsOn[writer]
+	assert.For(ctx, "Reader depends on writer").That(ok).Equals(true)
+}
+
+// namedCmd is a command which only has a name.
+type namedCmd struct {
+	api.Cmd
+	name string
+}
+
+func (c namedCmd) CmdName() string { return c.name }
+
+// newNamedFootprint returns a Footprint of commands with the given names, with
+// one behavior per command, which depends on the behaviors of the commands at
+// the given indices.
+func newNamedFootprint(ctx context.Context, numInitialCmds int, names []string,
+	deps map[int][]int) *dependencygraph.Footprint {
+	cmds := make([]api.Cmd, len(names))
+	for i, name := range names {
+		cmds[i] = namedCmd{name: name}
+	}
+	ft := dependencygraph.NewFootprint(ctx, cmds, numInitialCmds)
+	for i := range cmds {
+		b := dependencygraph.NewBehavior(api.SubCmdIdx{uint64(i)})
+		for _, d := range deps[i] {
+			b.DependsOn[ft.Behaviors[d]] = struct{}{}
+		}
+		ft.AddBehavior(ctx, b)
+	}
+	return ft
+}
+
+func TestFootprintDiff(t *testing.T) {
+	ctx := log.Testing(t)
+	// The initial command is ignored, so C depends on A and D on B.
+	before := newNamedFootprint(ctx, 1, []string{"Init", "A", "B", "C", "D"},
+		map[int][]int{3: {0, 1}, 4: {2}})
+	// X is inserted, C still depends on A, but D now depends on X.
+	after := newNamedFootprint(ctx, 0, []string{"A", "X", "B", "C", "D"},
+		map[int][]int{3: {0}, 4: {1}})
+
+	diff := before.Diff(after)
+	assert.For(ctx, "Removed").That(diff.Removed).DeepEquals([]api.CmdID{})
+	assert.For(ctx, "Added").That(diff.Added).DeepEquals([]api.CmdID{1})
+	assert.For(ctx, "Aligned").That(diff.Aligned).DeepEquals(map[api.CmdID]api.CmdID{
+		0: 0, 1: 2, 2: 3, 3: 4,
+	})
+	assert.For(ctx, "Changed").That(diff.Changed).DeepEquals([]dependencygraph.CommandDependencyDiff{
+		{Before: 3, After: 4, Lost: []api.CmdID{1}, Gained: []api.CmdID{1}},
+	})
+}
@@ -0,0 +1,118 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dependencygraph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/math/interval"
+	"github.com/google/gapid/core/memory/arena"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// TrimCapture creates a new capture with the given name, containing only the
+// commands in the range [start, end] of the given capture that are needed to
+// reproduce the requested commands or subcommands of the range, or the command
+// end if none are requested, as found by the dead code elimination on the
+// footprint of the capture. If the range does not begin with the first
+// command, the new capture begins with the commands synthesized by
+// api.RebuildState to restore the state built by the commands before the
+// range. Returns the path to the new capture.
+func TrimCapture(ctx context.Context, name string, p *path.Capture, start, end api.CmdID, requested []api.SubCmdIdx) (*path.Capture, error) {
+	ctx = log.Enter(ctx, "TrimCapture")
+	c, err := capture.ResolveFromPath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if start > end || uint64(end) >= uint64(len(c.Commands)) {
+		return nil, fmt.Errorf("Invalid command range [%v, %v] for a capture of %v commands",
+			start, end, len(c.Commands))
+	}
+
+	ft, err := GetFootprint(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(requested) == 0 {
+		requested = []api.SubCmdIdx{{uint64(end)}}
+	}
+	numInitialCmds := uint64(ft.NumInitialCommands)
+	dce := NewDCE(ctx, ft)
+	for _, r := range requested {
+		if id := api.CmdID(r[0]); id < start || id > end {
+			return nil, fmt.Errorf("The requested command %v is not in the range [%v, %v]", r, start, end)
+		}
+		fci := append(api.SubCmdIdx{r[0] + numInitialCmds}, r[1:]...)
+		dce.Request(ctx, fci)
+	}
+	livenessBoard, _ := dce.BackPropagate(ctx)
+
+	// Only the liveness of the commands is used, subcommands cannot be
+	// trimmed from their command buffers.
+	live := make([]bool, end-start+1)
+	for bi, alive := range livenessBoard {
+		fci := ft.Behaviors[bi].Owner
+		if !alive || len(fci) != 1 || fci[0] < numInitialCmds {
+			continue
+		}
+		if id := api.CmdID(fci[0] - numInitialCmds); id >= start && id <= end {
+			live[id-start] = true
+		}
+	}
+
+	cmds := []api.Cmd{}
+	reserved := interval.U64RangeList{}
+	initialState := c.InitialState
+	if start > 0 {
+		// The state at the beginning of the range replaces the initial state.
+		s := c.NewState(ctx)
+		err := api.ForeachCmd(ctx, c.Commands[:start], func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
+			if err := cmd.Mutate(ctx, id, s, nil, nil); err != nil && err == context.Canceled {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range c.APIs {
+			rebuilt, ranges := a.RebuildState(ctx, s)
+			cmds = append(cmds, rebuilt...)
+			reserved = append(reserved, ranges...)
+		}
+		initialState = nil
+	}
+	numRebuilt := len(cmds)
+	for i, cmd := range c.Commands[start : end+1] {
+		if live[i] {
+			cmds = append(cmds, cmd)
+		}
+	}
+	log.I(ctx, "Trimmed commands [%v, %v] to %v commands and %v state rebuilding commands",
+		start, end, len(cmds)-numRebuilt, numRebuilt)
+
+	// The memory used by the state rebuilding commands is not all observed,
+	// keep it out of the allocations of the replay.
+	header := *c.Header
+	header.ReservedMemory = nil
+	for _, r := range reserved {
+		header.ReservedMemory = append(header.ReservedMemory, &capture.MemoryRange{Base: r.First, Size: r.Count})
+	}
+	return capture.New(ctx, arena.New(), name, &header, initialState, cmds)
+}
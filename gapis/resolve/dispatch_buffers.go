@@ -0,0 +1,106 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/devices"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// DispatchBuffers resolves the contents of the storage buffers bound to the
+// dispatch, read back right before and right after the dispatch while
+// replaying the capture.
+func DispatchBuffers(
+	ctx context.Context,
+	replaySettings *service.ReplaySettings,
+	dispatch *path.Command,
+	hints *service.UsageHints,
+	config *path.ResolveConfig,
+) (*service.DispatchBuffers, error) {
+
+	if _, err := Cmd(ctx, dispatch, config); err != nil {
+		return nil, err
+	}
+
+	if replaySettings.Device == nil {
+		devices, err := devices.ForReplay(ctx, dispatch.Capture)
+		if err != nil {
+			return nil, err
+		}
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("No compatible replay devices found")
+		}
+		replaySettings.Device = devices[0]
+	}
+
+	obj, err := database.Build(ctx, &DispatchBuffersResolvable{
+		ReplaySettings: replaySettings,
+		Dispatch:       dispatch,
+		Hints:          hints,
+		Config:         config,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*service.DispatchBuffers), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *DispatchBuffersResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	ctx = SetupContext(ctx, r.Dispatch.Capture, r.Config)
+
+	intent := replay.Intent{
+		Device:  r.ReplaySettings.Device,
+		Capture: r.Dispatch.Capture,
+	}
+
+	cmd, err := Cmd(ctx, r.Dispatch, r.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	a := cmd.API()
+	if a == nil {
+		return nil, &service.ErrDataUnavailable{
+			Reason: messages.ErrMessage("Storage buffers are not supported for the command"),
+		}
+	}
+
+	query, ok := a.(replay.QueryDispatchBuffers)
+	if !ok {
+		return nil, &service.ErrDataUnavailable{
+			Reason: messages.ErrMessage(fmt.Sprintf("Storage buffers of dispatches are not supported for %v", a.Name())),
+		}
+	}
+
+	res, err := query.QueryDispatchBuffers(ctx, intent, replay.GetManager(ctx), r.Dispatch.Indices, r.Hints)
+	if err != nil {
+		switch err.(type) {
+		case *service.ErrDataUnavailable, *service.ErrInvalidArgument:
+			return nil, err
+		}
+		return nil, log.Err(ctx, err, "Couldn't get the storage buffers of the dispatch")
+	}
+
+	return &service.DispatchBuffers{Command: r.Dispatch, Buffers: res}, nil
+}
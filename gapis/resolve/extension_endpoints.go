@@ -0,0 +1,41 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/gapis/extensions"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// CallExtension calls the endpoint of the registered extension with the given
+// capture and arguments, and returns its result.
+func CallExtension(ctx context.Context, p *path.Capture, extension, endpoint string, args []byte) ([]byte, error) {
+	for _, e := range extensions.Get() {
+		if e.Name != extension {
+			continue
+		}
+		if f, ok := e.Endpoints[endpoint]; ok {
+			return f(SetupContext(ctx, p, nil), p, args)
+		}
+	}
+	return nil, &service.ErrInvalidArgument{
+		Reason: messages.ErrMessage(fmt.Sprintf("No endpoint %v registered by the extension %v", endpoint, extension)),
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/gapid/core/app/crash"
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// Filmstrip resolves the thumbnails of the framebuffer after the last command
+// of every step-th frame of the capture. The thumbnails are all requested at
+// once, so the replay manager batches them into the same replay passes.
+func Filmstrip(
+	ctx context.Context,
+	c *path.Capture,
+	step uint32,
+	w, h uint32,
+	f *image.Format,
+	noOpt bool,
+	r *path.ResolveConfig) (*service.Filmstrip, error) {
+
+	events, err := Events(ctx, &path.Events{
+		Capture:     c,
+		LastInFrame: true,
+	}, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if step == 0 {
+		step = 1
+	}
+	out := &service.Filmstrip{}
+	for i := 0; i < len(events.List); i += int(step) {
+		out.Frames = append(out.Frames, &service.FilmstripFrame{
+			Frame:   uint32(i),
+			Command: events.List[i].Command,
+		})
+	}
+
+	wg := sync.WaitGroup{}
+	for _, frame := range out.Frames {
+		frame := frame
+		wg.Add(1)
+		crash.Go(func() {
+			defer wg.Done()
+			info, err := CommandThumbnail(ctx, w, h, f, noOpt, frame.Command, r)
+			if err != nil {
+				frame.Error = service.NewError(err)
+				return
+			}
+			frame.Thumbnail = info
+		})
+	}
+	wg.Wait()
+
+	return out, nil
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// FilterCommands returns the indices of the commands of the capture matching
+// the given filter expression, in ascending order. Hidden commands are never
+// returned. See filter_expr.go for the syntax of the expressions.
+func FilterCommands(ctx context.Context, p *path.Capture, expr string) ([]uint64, error) {
+	e, err := parseFilter(ctx, p, expr)
+	if err != nil {
+		return nil, err
+	}
+	cmds, err := filterCmds(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	out := []uint64{}
+	for _, c := range cmds {
+		if e.match(c) {
+			out = append(out, uint64(c.id))
+		}
+	}
+	return out, nil
+}
+
+// parseFilter parses the filter expression, and resolves the commands of the
+// capture using the resources of its uses(<handle>) terms. The uses are looked
+// up in the resource-use index built once per capture.
+func parseFilter(ctx context.Context, p *path.Capture, expr string) (filterExpr, error) {
+	e, uses, err := parseFilterExpr(expr)
+	if err != nil {
+		return nil, &service.ErrInvalidArgument{Reason: messages.ErrMessage(err.Error())}
+	}
+	for _, u := range uses {
+		resUses, err := ResourceUses(ctx, p, u.handle)
+		if err != nil {
+			return nil, err
+		}
+		u.cmds = map[api.CmdID]bool{}
+		for _, r := range resUses {
+			u.cmds[api.CmdID(r.Command.Indices[0])] = true
+		}
+	}
+	return e, nil
+}
+
+// filterCmds returns the commands of the capture that are not hidden, in
+// ascending order, with the user markers they are in. The commands are
+// collected once per capture, and shared by all the filter expressions.
+func filterCmds(ctx context.Context, p *path.Capture) ([]*filterCmd, error) {
+	obj, err := database.Build(ctx, &FilterCommandsResolvable{Capture: p})
+	if err != nil {
+		return nil, err
+	}
+	return obj.([]*filterCmd), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *FilterCommandsResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	c, err := capture.ResolveFromPath(ctx, r.Capture)
+	if err != nil {
+		return nil, err
+	}
+	snc, err := SyncData(ctx, r.Capture)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []*filterCmd{}
+	// The markers slice is never modified in place, as it is shared by the
+	// commands in the same marker groups.
+	markers := []string{}
+	s := c.NewState(ctx)
+	err = api.ForeachCmd(ctx, c.Commands, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
+		if err := cmd.Mutate(ctx, id, s, nil, nil); err != nil && !api.IsErrCmdAborted(err) {
+			return err
+		}
+		flags := cmd.CmdFlags(ctx, id, s)
+		if flags.IsPushUserMarker() {
+			name := ""
+			if l, ok := cmd.(api.Labeled); ok {
+				name = l.Label(ctx, s)
+			}
+			markers = append(markers[:len(markers):len(markers)], name)
+		}
+		if !snc.Hidden.Contains(id) {
+			out = append(out, &filterCmd{id, cmd, markers})
+		}
+		// The push and pop commands are in the marker group.
+		if flags.IsPopUserMarker() && len(markers) > 0 {
+			n := len(markers) - 1
+			markers = markers[:n:n]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,442 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/memory"
+)
+
+// The command filter expressions are built from comparisons of a field of
+// the command with a value, combined with the !, && and || operators and
+// parentheses:
+//
+//   name ~ "Draw" && !(marker == "UI" || uses(0x1234))
+//
+// The fields are:
+//   name         the name of the command.
+//   thread       the thread the command was executed on.
+//   result       the result value of the command.
+//   param.<p>    the value of the parameter <p> of the command.
+//   marker       the names of the user markers the command is in. The
+//                comparison holds if it holds for any of them.
+//
+// The comparison operators are ==, !=, <, <=, >, >= and ~, which matches the
+// value against a regular expression. The values are numbers, quoted strings
+// or bare words such as enum names, and are compared numerically to the
+// numeric fields and textually to the others. A comparison of a missing
+// field, such as a parameter the command doesn't have, never holds.
+//
+// uses(<handle>) holds for the commands which read, write or transition the
+// layout of the resource with the given handle.
+
+// filterCmd is a command the filter expressions are evaluated against.
+type filterCmd struct {
+	id      api.CmdID
+	cmd     api.Cmd
+	markers []string
+}
+
+// filterExpr is a node of a parsed command filter expression.
+type filterExpr interface {
+	match(c *filterCmd) bool
+}
+
+type filterNot struct{ expr filterExpr }
+
+func (e filterNot) match(c *filterCmd) bool { return !e.expr.match(c) }
+
+type filterAnd struct{ lhs, rhs filterExpr }
+
+func (e filterAnd) match(c *filterCmd) bool { return e.lhs.match(c) && e.rhs.match(c) }
+
+type filterOr struct{ lhs, rhs filterExpr }
+
+func (e filterOr) match(c *filterCmd) bool { return e.lhs.match(c) || e.rhs.match(c) }
+
+// filterUses is the uses(<handle>) term. The commands using the resource are
+// resolved after the expression is parsed.
+type filterUses struct {
+	handle uint64
+	cmds   map[api.CmdID]bool
+}
+
+func (e *filterUses) match(c *filterCmd) bool { return e.cmds[c.id] }
+
+// filterField returns the values of a field of a command.
+type filterField func(c *filterCmd) []interface{}
+
+// filterCompare is the comparison of a field of the commands with a value.
+type filterCompare struct {
+	field filterField
+	op    string
+	text  string
+	num   *big.Float // nil if the value is not a number.
+	re    *regexp.Regexp
+}
+
+func (e *filterCompare) match(c *filterCmd) bool {
+	vals := e.field(c)
+	if len(vals) == 0 {
+		return false
+	}
+	if e.op == "!=" {
+		for _, v := range vals {
+			if e.compare(v) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range vals {
+		if e.test(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *filterCompare) test(v interface{}) bool {
+	if e.op == "~" {
+		return e.re.MatchString(filterString(v))
+	}
+	switch cmp := e.compare(v); e.op {
+	case "==":
+		return cmp == 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// compare returns -1, 0 or 1 if v is less than, equal or greater than the
+// value of the comparison. Numbers are compared numerically, everything else
+// textually.
+func (e *filterCompare) compare(v interface{}) int {
+	if e.num != nil {
+		if n, ok := filterNumber(v); ok {
+			return n.Cmp(e.num)
+		}
+	}
+	return strings.Compare(filterString(v), e.text)
+}
+
+// filterNumber returns v as a number, if it is an integer, a float or a
+// pointer.
+func filterNumber(v interface{}) (*big.Float, bool) {
+	n := new(big.Float).SetPrec(128)
+	if p, ok := v.(memory.Pointer); ok {
+		return n.SetUint64(p.Address()), true
+	}
+	switch r := reflect.ValueOf(v); r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return n.SetInt64(r.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return n.SetUint64(r.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		if f := r.Float(); !math.IsNaN(f) {
+			return n.SetFloat64(f), true
+		}
+	}
+	return nil, false
+}
+
+// filterString returns v as text. Enums are formatted with their names.
+func filterString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// filterFields are the fields of the commands, except the parameters.
+var filterFields = map[string]filterField{
+	"name": func(c *filterCmd) []interface{} {
+		return []interface{}{c.cmd.CmdName()}
+	},
+	"thread": func(c *filterCmd) []interface{} {
+		return []interface{}{c.cmd.Thread()}
+	},
+	"result": func(c *filterCmd) []interface{} {
+		if p := c.cmd.CmdResult(); p != nil {
+			return []interface{}{p.Get()}
+		}
+		return nil
+	},
+	"marker": func(c *filterCmd) []interface{} {
+		out := make([]interface{}, len(c.markers))
+		for i, m := range c.markers {
+			out[i] = m
+		}
+		return out
+	},
+}
+
+func filterParam(name string) filterField {
+	return func(c *filterCmd) []interface{} {
+		if p := c.cmd.CmdParams().Find(name); p != nil {
+			return []interface{}{p.Get()}
+		}
+		return nil
+	}
+}
+
+var filterCompareOps = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "~": true,
+}
+
+type filterTokenKind int
+
+const (
+	filterEOF filterTokenKind = iota
+	filterIdent
+	filterNumberLit
+	filterStringLit
+	filterOp
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	pos  int
+}
+
+// lexFilterExpr splits the filter expression into tokens.
+func lexFilterExpr(s string) ([]filterToken, error) {
+	isIdent := func(r byte) bool {
+		return r == '_' || r == '.' || unicode.IsLetter(rune(r)) || unicode.IsDigit(rune(r))
+	}
+	isDigit := func(i int) bool { return i < len(s) && s[i] >= '0' && s[i] <= '9' }
+	isExponent := func(i int) bool {
+		return (s[i] == '+' || s[i] == '-') && strings.IndexByte("eEpP", s[i-1]) >= 0
+	}
+	toks := []filterToken{}
+	for i := 0; i < len(s); {
+		start := i
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case isDigit(i) || (c == '-' && isDigit(i+1)):
+			for i++; i < len(s) && (isIdent(s[i]) || isExponent(i)); i++ {
+			}
+			toks = append(toks, filterToken{filterNumberLit, s[start:i], start})
+		case isIdent(c):
+			for i++; i < len(s) && isIdent(s[i]); i++ {
+			}
+			toks = append(toks, filterToken{filterIdent, s[start:i], start})
+		case c == '"' || c == '`':
+			for i++; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' && c == '"' {
+					i++
+				}
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("Unterminated string at %d", start)
+			}
+			i++
+			str, err := strconv.Unquote(s[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid string at %d: %v", start, err)
+			}
+			toks = append(toks, filterToken{filterStringLit, str, start})
+		default:
+			op := ""
+			for _, o := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "~", "!", "(", ")"} {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("Unexpected '%c' at %d", c, start)
+			}
+			i += len(op)
+			toks = append(toks, filterToken{filterOp, op, start})
+		}
+	}
+	return append(toks, filterToken{filterEOF, "", len(s)}), nil
+}
+
+// filterParser is a recursive descent parser of the filter expressions.
+type filterParser struct {
+	toks []filterToken
+	uses []*filterUses
+}
+
+func (p *filterParser) peek() filterToken { return p.toks[0] }
+
+func (p *filterParser) next() filterToken {
+	t := p.toks[0]
+	if t.kind != filterEOF {
+		p.toks = p.toks[1:]
+	}
+	return t
+}
+
+func (p *filterParser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == filterOp && t.text == op
+}
+
+func (p *filterParser) expectOp(op string) error {
+	if !p.isOp(op) {
+		return p.unexpected(fmt.Sprintf("'%s'", op))
+	}
+	p.next()
+	return nil
+}
+
+func (p *filterParser) unexpected(expected string) error {
+	t := p.peek()
+	if t.kind == filterEOF {
+		return fmt.Errorf("Expected %s at the end of the expression", expected)
+	}
+	return fmt.Errorf("Expected %s at %d, got '%s'", expected, t.pos, t.text)
+}
+
+// parseFilterExpr parses the filter expression. The uses(<handle>) terms are
+// returned so the caller can resolve the commands using the resources.
+func parseFilterExpr(s string) (filterExpr, []*filterUses, error) {
+	toks, err := lexFilterExpr(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := &filterParser{toks: toks}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.peek().kind != filterEOF {
+		return nil, nil, p.unexpected("'&&' or '||'")
+	}
+	return e, p.uses, nil
+}
+
+func (p *filterParser) parseOr() (filterExpr, error) {
+	lhs, err := p.parseAnd()
+	for err == nil && p.isOp("||") {
+		p.next()
+		var rhs filterExpr
+		if rhs, err = p.parseAnd(); err == nil {
+			lhs = filterOr{lhs, rhs}
+		}
+	}
+	return lhs, err
+}
+
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	lhs, err := p.parseUnary()
+	for err == nil && p.isOp("&&") {
+		p.next()
+		var rhs filterExpr
+		if rhs, err = p.parseUnary(); err == nil {
+			lhs = filterAnd{lhs, rhs}
+		}
+	}
+	return lhs, err
+}
+
+func (p *filterParser) parseUnary() (filterExpr, error) {
+	switch {
+	case p.isOp("!"):
+		p.next()
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{e}, nil
+	case p.isOp("("):
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expectOp(")")
+	}
+	return p.parseTerm()
+}
+
+func (p *filterParser) parseTerm() (filterExpr, error) {
+	t := p.peek()
+	if t.kind != filterIdent {
+		return nil, p.unexpected("a field")
+	}
+	p.next()
+
+	if t.text == "uses" && p.isOp("(") {
+		p.next()
+		h := p.next()
+		handle, err := strconv.ParseUint(h.text, 0, 64)
+		if h.kind != filterNumberLit || err != nil {
+			return nil, fmt.Errorf("Expected a resource handle at %d", h.pos)
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		u := &filterUses{handle: handle}
+		p.uses = append(p.uses, u)
+		return u, nil
+	}
+
+	field, ok := filterFields[t.text]
+	if name := strings.TrimPrefix(t.text, "param."); name != t.text && name != "" {
+		field, ok = filterParam(name), true
+	}
+	if !ok {
+		return nil, fmt.Errorf("Unknown field '%s' at %d", t.text, t.pos)
+	}
+
+	op := p.next()
+	if op.kind != filterOp || !filterCompareOps[op.text] {
+		return nil, fmt.Errorf("Expected a comparison operator at %d", op.pos)
+	}
+
+	v := p.next()
+	if v.kind != filterIdent && v.kind != filterNumberLit && v.kind != filterStringLit {
+		return nil, fmt.Errorf("Expected a value at %d", v.pos)
+	}
+	e := &filterCompare{field: field, op: op.text, text: v.text}
+	if v.kind == filterNumberLit {
+		n, _, err := new(big.Float).SetPrec(128).Parse(v.text, 0)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid number '%s' at %d", v.text, v.pos)
+		}
+		e.num = n
+	}
+	if op.text == "~" {
+		re, err := regexp.Compile(v.text)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regular expression at %d: %v", v.pos, err)
+		}
+		e.re = re
+	}
+	return e, nil
+}
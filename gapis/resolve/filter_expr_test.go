@@ -0,0 +1,104 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/memory/arena"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/test"
+)
+
+func TestFilterExpr(t *testing.T) {
+	ctx := log.Testing(t)
+	cb := test.CommandBuilder{Arena: arena.New()}
+	cmds := []*filterCmd{
+		{0, cb.CmdTypeMix(0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100, true, test.Voidᵖ(0x12345678), 2), nil},
+		{1, cb.CmdTypeMix(1, 15, -25, 35, 45, 55, 65, 75, 85, 95, 105, false, test.Voidᵖ(0x87654321), 3), []string{"Frame", "Shadows"}},
+		{2, cb.CmdVoid(), []string{"Frame"}},
+	}
+
+	for _, test := range []struct {
+		expr     string
+		expected []api.CmdID
+	}{
+		{`name == cmdTypeMix`, []api.CmdID{0, 1}},
+		{`name == "cmdVoid"`, []api.CmdID{2}},
+		{`name != cmdVoid`, []api.CmdID{0, 1}},
+		{`name ~ "^cmd(Type|V)"`, []api.CmdID{0, 1, 2}},
+		{`param.U32 == 55`, []api.CmdID{1}},
+		{`param.U32 != 55`, []api.CmdID{0}},
+		{`param.S8 < 0`, []api.CmdID{1}},
+		{`param.S8 >= -25 && param.S8 <= 20`, []api.CmdID{0, 1}},
+		{`param.F32 > 92.5`, []api.CmdID{1}},
+		{`param.Bool == true`, []api.CmdID{0}},
+		{`param.Ptr == 0x12345678`, []api.CmdID{0}},
+		{`param.Missing == 0`, []api.CmdID{}},
+		{`result == 3`, []api.CmdID{1}},
+		{`marker == Shadows`, []api.CmdID{1}},
+		{`marker ~ "^Fr"`, []api.CmdID{1, 2}},
+		{`marker != Shadows`, []api.CmdID{2}},
+		{`!(marker == Frame)`, []api.CmdID{0}},
+		{`name == cmdVoid || param.ID == 0`, []api.CmdID{0, 2}},
+		{`(name == cmdVoid || param.ID == 0) && marker == Frame`, []api.CmdID{2}},
+		{`!name == cmdVoid && param.U8 == 10`, []api.CmdID{0}},
+	} {
+		e, uses, err := parseFilterExpr(test.expr)
+		if !assert.For(ctx, "parse %v", test.expr).ThatError(err).Succeeded() {
+			continue
+		}
+		assert.For(ctx, "uses of %v", test.expr).That(len(uses)).Equals(0)
+		got := []api.CmdID{}
+		for _, c := range cmds {
+			if e.match(c) {
+				got = append(got, c.id)
+			}
+		}
+		assert.For(ctx, "match %v", test.expr).ThatSlice(got).Equals(test.expected)
+	}
+
+	e, uses, err := parseFilterExpr(`uses(0x10) || uses(32)`)
+	assert.For(ctx, "parse uses").ThatError(err).Succeeded()
+	if assert.For(ctx, "uses").That(len(uses)).Equals(2) {
+		assert.For(ctx, "uses[0]").That(uses[0].handle).Equals(uint64(0x10))
+		assert.For(ctx, "uses[1]").That(uses[1].handle).Equals(uint64(32))
+		uses[0].cmds = map[api.CmdID]bool{2: true}
+		uses[1].cmds = map[api.CmdID]bool{}
+		assert.For(ctx, "match uses").That(e.match(cmds[2])).Equals(true)
+		assert.For(ctx, "match uses").That(e.match(cmds[1])).Equals(false)
+	}
+
+	for _, expr := range []string{
+		``,
+		`name`,
+		`name ==`,
+		`name = cmdVoid`,
+		`size == 1`,
+		`param. == 1`,
+		`name == "cmdVoid`,
+		`name ~ "("`,
+		`(name == cmdVoid`,
+		`name == cmdVoid)`,
+		`name == cmdVoid name == cmdVoid`,
+		`uses(buffer)`,
+		`param.U8 == 12abc`,
+	} {
+		_, _, err := parseFilterExpr(expr)
+		assert.For(ctx, "parse %v", expr).ThatError(err).Failed()
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/app/crash"
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay/devices"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// FramebufferAttachments resolves the data of all the given framebuffer
+// attachments of a capture. The attachments are all requested at once, so the
+// replay manager batches their readbacks into the same replay. The errors of
+// the individual attachments are returned in their images.
+func FramebufferAttachments(
+	ctx context.Context,
+	replaySettings *service.ReplaySettings,
+	queries []*service.FramebufferAttachmentQuery,
+	hints *service.UsageHints,
+	config *path.ResolveConfig,
+) ([]*service.FramebufferAttachmentImage, error) {
+
+	if len(queries) == 0 {
+		return []*service.FramebufferAttachmentImage{}, nil
+	}
+	c := queries[0].After.Capture
+	for _, q := range queries[1:] {
+		if !proto.Equal(q.After.Capture, c) {
+			return nil, &service.ErrInvalidArgument{
+				Reason: messages.ErrMessage("The framebuffer attachments are not of the same capture"),
+			}
+		}
+	}
+
+	// Pick the replay device once, as FramebufferAttachment would pick it
+	// for each attachment.
+	replaySettings = proto.Clone(replaySettings).(*service.ReplaySettings)
+	if replaySettings.Device == nil {
+		devices, err := devices.ForReplay(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("No compatible replay devices found")
+		}
+		replaySettings.Device = devices[0]
+	}
+
+	out := make([]*service.FramebufferAttachmentImage, len(queries))
+	wg := sync.WaitGroup{}
+	for i, q := range queries {
+		i, q := i, q
+		out[i] = &service.FramebufferAttachmentImage{}
+		wg.Add(1)
+		crash.Go(func() {
+			defer wg.Done()
+			data, err := framebufferAttachmentData(ctx, replaySettings, q, hints, config)
+			if err != nil {
+				out[i].Error = service.NewError(err)
+				return
+			}
+			out[i].Image = data
+		})
+	}
+	wg.Wait()
+
+	return out, nil
+}
+
+// framebufferAttachmentData resolves the framebuffer attachment of the query,
+// along with its data.
+func framebufferAttachmentData(
+	ctx context.Context,
+	replaySettings *service.ReplaySettings,
+	q *service.FramebufferAttachmentQuery,
+	hints *service.UsageHints,
+	config *path.ResolveConfig,
+) (*image.Data, error) {
+
+	p, err := FramebufferAttachment(ctx, replaySettings, q.After, q.Attachment, q.Settings, hints, config)
+	if err != nil {
+		return nil, err
+	}
+	info, err := ImageInfo(ctx, p, config)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := Blob(ctx, path.NewBlob(info.Bytes.ID()), config)
+	if err != nil {
+		return nil, err
+	}
+	return &image.Data{
+		Format: info.Format,
+		Width:  info.Width,
+		Height: info.Height,
+		Depth:  info.Depth,
+		Bytes:  bytes,
+	}, nil
+}
@@ -0,0 +1,60 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// ImageLayoutsResolver is the interface implemented by APIs which track the
+// layouts of the subresources of their images.
+type ImageLayoutsResolver interface {
+	// ResolveImageLayouts returns the layouts of the subresources of the
+	// image after the given command, with the commands which last set them.
+	ResolveImageLayouts(ctx context.Context, after *path.Command, image uint64) ([]*service.ImageSubresourceLayout, error)
+}
+
+// ImageLayouts returns the layouts of the subresources of the image with the
+// given handle after the given command.
+func ImageLayouts(ctx context.Context, after *path.Command, image uint64) ([]*service.ImageSubresourceLayout, error) {
+	c, err := capture.ResolveFromPath(ctx, after.Capture)
+	if err != nil {
+		return nil, err
+	}
+	// The image belongs to one of the APIs, the errors of the others are
+	// only reported if none of them knows the image.
+	err = &service.ErrDataUnavailable{
+		Reason: messages.ErrMessage(fmt.Sprintf("No layouts of the image %v after the command", image)),
+	}
+	for _, a := range c.APIs {
+		if r, ok := a.(ImageLayoutsResolver); ok {
+			layouts, apiErr := r.ResolveImageLayouts(ctx, after, image)
+			if apiErr != nil {
+				log.D(ctx, "Couldn't resolve the image layouts of %v: %v", a.Name(), apiErr)
+				err = apiErr
+				continue
+			}
+			return layouts, nil
+		}
+	}
+	return nil, err
+}
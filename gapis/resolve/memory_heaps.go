@@ -0,0 +1,53 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// MemoryHeapsResolver is the interface implemented by APIs which can break
+// down their live device memory allocations by the memory heaps of the
+// devices.
+type MemoryHeapsResolver interface {
+	// ResolveMemoryHeaps adds to out the memory heaps of the devices alive
+	// after the given command, with the live allocations of each memory type
+	// of the heaps, and the allocations and frees up to the command.
+	ResolveMemoryHeaps(ctx context.Context, after *path.Command, out *service.MemoryHeaps) error
+}
+
+// MemoryHeaps returns the live device memory allocations after the given
+// command, grouped by their memory heaps and memory types, and the timeline
+// of the allocations up to the command.
+func MemoryHeaps(ctx context.Context, after *path.Command) (*service.MemoryHeaps, error) {
+	c, err := capture.ResolveFromPath(ctx, after.Capture)
+	if err != nil {
+		return nil, err
+	}
+	out := &service.MemoryHeaps{}
+	for _, a := range c.APIs {
+		if r, ok := a.(MemoryHeapsResolver); ok {
+			if err := r.ResolveMemoryHeaps(ctx, after, out); err != nil {
+				log.W(ctx, "Couldn't resolve the memory heaps of %v: %v", a.Name(), err)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,60 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// ObjectLifetimesResolver is the interface implemented by APIs which can
+// track the lifetimes of the objects referred by their handles.
+type ObjectLifetimesResolver interface {
+	// ResolveObjectLifetimes adds the lifetimes of the objects of all the
+	// handle types of the API to out, in creation order.
+	ResolveObjectLifetimes(ctx context.Context, c *path.Capture, out *service.ObjectLifetimes) error
+}
+
+// ObjectLifetimes resolves the commands creating and destroying the objects of
+// the given capture.
+func ObjectLifetimes(ctx context.Context, p *path.Capture) (*service.ObjectLifetimes, error) {
+	obj, err := database.Build(ctx, &ObjectLifetimesResolvable{Capture: p})
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*service.ObjectLifetimes), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *ObjectLifetimesResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	c, err := capture.ResolveFromPath(ctx, r.Capture)
+	if err != nil {
+		return nil, err
+	}
+	out := &service.ObjectLifetimes{}
+	for _, a := range c.APIs {
+		if l, ok := a.(ObjectLifetimesResolver); ok {
+			if err := l.ResolveObjectLifetimes(ctx, r.Capture, out); err != nil {
+				log.W(ctx, "Couldn't resolve the object lifetimes of %v: %v", a.Name(), err)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,174 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/stream/fmts"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/devices"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// Overdraw resolves the image of the per-pixel overdraw counts of the draws
+// from the command first to the command after, in the last render pass of the
+// range. If first is nil, all the draws of the render pass up to the command
+// after are counted.
+func Overdraw(
+	ctx context.Context,
+	replaySettings *service.ReplaySettings,
+	first, after *path.Command,
+	hints *service.UsageHints,
+	config *path.ResolveConfig,
+) (*path.ImageInfo, error) {
+
+	if first != nil {
+		if first.Capture.ID.ID() != after.Capture.ID.ID() {
+			return nil, &service.ErrInvalidArgument{
+				Reason: messages.ErrMessage("The commands of the overdraw range are not in the same capture"),
+			}
+		}
+		if api.SubCmdIdx(after.Indices).LessThan(api.SubCmdIdx(first.Indices)) {
+			return nil, &service.ErrInvalidArgument{
+				Reason: messages.ErrMessage(fmt.Sprintf("Overdraw range %v to %v is empty", first.Indices, after.Indices)),
+			}
+		}
+	}
+
+	if replaySettings.Device == nil {
+		devices, err := devices.ForReplay(ctx, after.Capture)
+		if err != nil {
+			return nil, err
+		}
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("No compatible replay devices found")
+		}
+		replaySettings.Device = devices[0]
+	}
+
+	if _, err := Cmd(ctx, after, config); err != nil {
+		return nil, err
+	}
+
+	id, err := database.Store(ctx, &OverdrawResolvable{
+		ReplaySettings: replaySettings,
+		First:          first,
+		After:          after,
+		Hints:          hints,
+		Config:         config,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return path.NewImageInfo(id), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *OverdrawResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	changes, err := FramebufferChanges(ctx, r.After.Capture, r.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// The counts are rendered to a stencil image the size of the framebuffer.
+	fbInfo, err := changes.Get(ctx, r.After, api.FramebufferAttachment_Color0)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := database.Store(ctx, &OverdrawBytesResolvable{
+		ReplaySettings: r.ReplaySettings,
+		First:          r.First,
+		After:          r.After,
+		Width:          fbInfo.Width,
+		Height:         fbInfo.Height,
+		Hints:          r.Hints,
+		Config:         r.Config,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &image.Info{
+		Width:  fbInfo.Width,
+		Height: fbInfo.Height,
+		Depth:  1,
+		Format: image.NewUncompressed("Count_U8", fmts.Count_U8),
+		Bytes:  image.NewID(id),
+	}, nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *OverdrawBytesResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	c := path.FindCapture(r.After)
+	ctx = SetupContext(ctx, c, r.Config)
+
+	intent := replay.Intent{
+		Device:  r.ReplaySettings.Device,
+		Capture: c,
+	}
+
+	after, err := Cmd(ctx, r.After, r.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	a := after.API()
+	if a == nil {
+		return nil, &service.ErrDataUnavailable{Reason: messages.ErrFramebufferUnavailable()}
+	}
+
+	query, ok := a.(replay.QueryOverdraw)
+	if !ok {
+		return nil, &service.ErrDataUnavailable{
+			Reason: messages.ErrMessage(fmt.Sprintf("Overdraw is not supported for %v", a.Name())),
+		}
+	}
+
+	var first []uint64
+	if r.First != nil {
+		first = r.First.Indices
+	}
+
+	res, err := query.QueryOverdraw(
+		ctx,
+		intent,
+		replay.GetManager(ctx),
+		first,
+		r.After.Indices,
+		r.ReplaySettings.DisableReplayOptimization,
+		r.Hints,
+	)
+	if err != nil {
+		if _, ok := err.(*service.ErrDataUnavailable); ok {
+			return nil, err
+		}
+		return nil, log.Err(ctx, err, "Couldn't get overdraw")
+	}
+	if res.Width != r.Width || res.Height != r.Height {
+		return nil, log.Errf(ctx, nil, "Overdraw image is %vx%v, expected %vx%v",
+			res.Width, res.Height, r.Width, r.Height)
+	}
+
+	return res.Bytes, nil
+}
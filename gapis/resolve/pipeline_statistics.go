@@ -0,0 +1,131 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/devices"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// PipelineStatistics resolves the pipeline statistics of the draws, queried
+// around each draw while replaying the capture.
+func PipelineStatistics(
+	ctx context.Context,
+	replaySettings *service.ReplaySettings,
+	draws []*path.Command,
+	hints *service.UsageHints,
+	config *path.ResolveConfig,
+) (*service.PipelineStatistics, error) {
+
+	if len(draws) == 0 {
+		return nil, &service.ErrInvalidArgument{
+			Reason: messages.ErrMessage("No draws to query the pipeline statistics of"),
+		}
+	}
+	c := draws[0].Capture
+	for _, d := range draws {
+		if d.Capture.ID.ID() != c.ID.ID() {
+			return nil, &service.ErrInvalidArgument{
+				Reason: messages.ErrMessage("The draws are not in the same capture"),
+			}
+		}
+		if _, err := Cmd(ctx, d, config); err != nil {
+			return nil, err
+		}
+	}
+
+	if replaySettings.Device == nil {
+		devices, err := devices.ForReplay(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("No compatible replay devices found")
+		}
+		replaySettings.Device = devices[0]
+	}
+
+	obj, err := database.Build(ctx, &PipelineStatisticsResolvable{
+		ReplaySettings: replaySettings,
+		Draws:          draws,
+		Hints:          hints,
+		Config:         config,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*service.PipelineStatistics), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *PipelineStatisticsResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	c := r.Draws[0].Capture
+	ctx = SetupContext(ctx, c, r.Config)
+
+	intent := replay.Intent{
+		Device:  r.ReplaySettings.Device,
+		Capture: c,
+	}
+
+	cmd, err := Cmd(ctx, r.Draws[0], r.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	a := cmd.API()
+	if a == nil {
+		return nil, &service.ErrDataUnavailable{
+			Reason: messages.ErrMessage("Pipeline statistics are not supported for the command"),
+		}
+	}
+
+	query, ok := a.(replay.QueryPipelineStatistics)
+	if !ok {
+		return nil, &service.ErrDataUnavailable{
+			Reason: messages.ErrMessage(fmt.Sprintf("Pipeline statistics are not supported for %v", a.Name())),
+		}
+	}
+
+	draws := make([][]uint64, len(r.Draws))
+	for i, d := range r.Draws {
+		draws[i] = d.Indices
+	}
+
+	res, err := query.QueryPipelineStatistics(ctx, intent, replay.GetManager(ctx), draws, r.Hints)
+	if err != nil {
+		switch err.(type) {
+		case *service.ErrDataUnavailable, *service.ErrInvalidArgument:
+			return nil, err
+		}
+		return nil, log.Err(ctx, err, "Couldn't get the pipeline statistics")
+	}
+
+	out := &service.PipelineStatistics{}
+	for i, s := range res {
+		s = proto.Clone(s).(*service.DrawPipelineStatistics)
+		s.Command = r.Draws[i]
+		out.Draws = append(out.Draws, s)
+	}
+	return out, nil
+}
@@ -0,0 +1,94 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/memory/arena"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// DataReplacer is the interface implemented by the APIs which can replace the
+// contents of their buffers and images in a capture.
+type DataReplacer interface {
+	// ReplaceData replaces the bytes at offset of the buffer or image with
+	// the given handle from the command after on, calling edits with the
+	// commands to replace. The replacement is either a single api.Cmd, or a
+	// []api.Cmd which is spliced in place of the replaced command. It returns
+	// false if the API has no buffer or image with the handle.
+	ReplaceData(
+		ctx context.Context,
+		after *path.Command,
+		handle, offset uint64,
+		data []byte,
+		edits api.ReplaceCallback,
+		r *path.ResolveConfig) (bool, error)
+}
+
+// ReplaceData returns a new capture in which the bytes at offset of the buffer
+// or image with the given handle are replaced with data from the command after
+// on.
+func ReplaceData(ctx context.Context, after *path.Command, handle, offset uint64, data []byte, r *path.ResolveConfig) (*path.Capture, error) {
+	if len(after.Indices) > 1 {
+		return nil, fmt.Errorf("Cannot modify subcommands") // TODO: Subcommands
+	}
+
+	c, err := capture.ResolveFromPath(ctx, after.Capture)
+	if err != nil {
+		return nil, err
+	}
+
+	// All the commands are kept, the ones after the edited command still
+	// consume the replaced data.
+	oldCmds, err := NCmds(ctx, after.Capture, after.Indices[0]+1)
+	if err != nil {
+		return nil, err
+	}
+
+	replacements := map[uint64][]api.Cmd{}
+	replaceCommands := func(where uint64, with interface{}) {
+		switch with := with.(type) {
+		case api.Cmd:
+			replacements[where] = []api.Cmd{with}
+		case []api.Cmd:
+			replacements[where] = with
+		}
+	}
+
+	for _, a := range c.APIs {
+		if dr, ok := a.(DataReplacer); ok {
+			found, err := dr.ReplaceData(ctx, after, handle, offset, data, replaceCommands, r)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				cmds := make([]api.Cmd, 0, len(oldCmds))
+				for i, cmd := range oldCmds {
+					if with, ok := replacements[uint64(i)]; ok {
+						cmds = append(cmds, with...)
+					} else {
+						cmds = append(cmds, cmd)
+					}
+				}
+				return changeCommands(ctx, arena.New(), after.Capture, cmds)
+			}
+		}
+	}
+	return nil, fmt.Errorf("No buffer or image with handle 0x%x", handle)
+}
@@ -16,12 +16,15 @@ package resolve
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/google/gapid/core/app/analytics"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/capture"
 	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/extensions"
 	"github.com/google/gapid/gapis/messages"
 	"github.com/google/gapid/gapis/replay"
 	"github.com/google/gapid/gapis/service"
@@ -29,13 +32,72 @@ import (
 	"github.com/google/gapid/gapis/stringtable"
 )
 
-// Report resolves the report for the given path.
+// Report resolves the report for the given path, with the report
+// configuration of the capture applied.
 func Report(ctx context.Context, p *path.Report, r *path.ResolveConfig) (*service.Report, error) {
 	obj, err := database.Build(ctx, &ReportResolvable{Path: p, Config: r})
 	if err != nil {
 		return nil, err
 	}
-	return obj.(*service.Report), nil
+	cfg, err := ReportConfig(ctx, p.Capture)
+	if err != nil {
+		return nil, err
+	}
+	return applyReportConfig(obj.(*service.Report), cfg), nil
+}
+
+// KeptReason tells why a command is kept by the dead code elimination.
+type KeptReason struct {
+	// Chain is the list of commands, starting with the kept command, in which
+	// each command depends on the previous one, and the last command is
+	// requested or always kept alive.
+	Chain []api.CmdID
+	// Variable is the description of the variable written by the kept command
+	// and read by the next command of the chain, if known.
+	Variable string
+}
+
+// DeadCodeEliminationExplainer is the interface implemented by APIs which can
+// explain why commands are kept by the dead code elimination.
+type DeadCodeEliminationExplainer interface {
+	// ExplainDeadCodeElimination returns the reason for every command of the
+	// capture that is kept by the dead code elimination, when the given
+	// command, or the last one if request is nil, is requested.
+	ExplainDeadCodeElimination(ctx context.Context, c *path.Capture, request *path.Command) (map[api.CmdID]KeptReason, error)
+}
+
+// BarrierAnalyzer is the interface implemented by APIs which can find the
+// pipeline barriers whose stage masks are broader than the data flow through
+// them requires.
+type BarrierAnalyzer interface {
+	// AnalyzeBarriers returns the message suggesting narrower stage masks for
+	// every such barrier command of the capture.
+	AnalyzeBarriers(ctx context.Context, c *path.Capture) (map[api.CmdID]*stringtable.Msg, error)
+}
+
+// Linter is the interface implemented by APIs which can find the commands
+// matching the API specific lint rules.
+type Linter interface {
+	// Lint returns the messages of the rules matched by every command of the
+	// capture.
+	Lint(ctx context.Context, c *path.Capture) (map[api.CmdID][]*stringtable.Msg, error)
+}
+
+// deadCodeEliminationReason returns the message explaining why a command is
+// kept.
+func deadCodeEliminationReason(reason KeptReason) *stringtable.Msg {
+	if len(reason.Chain) < 2 {
+		return messages.InfoKeptAlive()
+	}
+	ids := make([]string, len(reason.Chain))
+	for i, id := range reason.Chain {
+		ids[i] = fmt.Sprint(uint64(id))
+	}
+	variable := reason.Variable
+	if variable == "" {
+		variable = "data"
+	}
+	return messages.InfoKeptByDependent(uint64(reason.Chain[1]), variable, strings.Join(ids, " -> "))
 }
 
 func (r *ReportResolvable) newReportItem(s log.Severity, c uint64, m *stringtable.Msg) *service.ReportItemRaw {
@@ -117,11 +179,101 @@ func (r *ReportResolvable) Resolve(ctx context.Context) (interface{}, error) {
 		}
 	}
 
+	keptReasons := map[api.CmdID]KeptReason{}
+	if r.Path.ExplainDeadCodeElimination {
+		for _, a := range c.APIs {
+			if e, ok := a.(DeadCodeEliminationExplainer); ok {
+				reasons, err := e.ExplainDeadCodeElimination(ctx, r.Path.Capture,
+					r.Path.DeadCodeEliminationRequest)
+				if err != nil {
+					builder.Add(ctx, r.newReportItem(log.Error, uint64(api.CmdNoID),
+						messages.ErrInternalError(err.Error())))
+					continue
+				}
+				for id, reason := range reasons {
+					keptReasons[id] = reason
+				}
+			}
+		}
+	}
+
+	broadBarriers := map[api.CmdID]*stringtable.Msg{}
+	if r.Path.AnalyzeBarriers {
+		for _, a := range c.APIs {
+			if b, ok := a.(BarrierAnalyzer); ok {
+				barriers, err := b.AnalyzeBarriers(ctx, r.Path.Capture)
+				if err != nil {
+					builder.Add(ctx, r.newReportItem(log.Error, uint64(api.CmdNoID),
+						messages.ErrInternalError(err.Error())))
+					continue
+				}
+				for id, msg := range barriers {
+					broadBarriers[id] = msg
+				}
+			}
+		}
+	}
+
+	lints := map[api.CmdID][]*stringtable.Msg{}
+	if r.Path.Lint {
+		for _, a := range c.APIs {
+			if l, ok := a.(Linter); ok {
+				found, err := l.Lint(ctx, r.Path.Capture)
+				if err != nil {
+					builder.Add(ctx, r.newReportItem(log.Error, uint64(api.CmdNoID),
+						messages.ErrInternalError(err.Error())))
+					continue
+				}
+				for id, msgs := range found {
+					lints[id] = append(lints[id], msgs...)
+				}
+			}
+		}
+	}
+
+	extensionItems := map[api.CmdID][]extensions.ReportItem{}
+	if r.Path.Analyses {
+		for _, e := range extensions.Get() {
+			if e.ReportItems == nil {
+				continue
+			}
+			found, err := e.ReportItems(ctx, r.Path.Capture)
+			if err != nil {
+				builder.Add(ctx, r.newReportItem(log.Error, uint64(api.CmdNoID),
+					messages.ErrInternalError(fmt.Sprintf("%v: %v", e.Name, err))))
+				continue
+			}
+			for id, items := range found {
+				extensionItems[id] = append(extensionItems[id], items...)
+			}
+		}
+		for _, item := range extensionItems[api.CmdNoID] {
+			builder.Add(ctx, r.newReportItem(item.Severity, uint64(api.CmdNoID), item.Message))
+		}
+	}
+
 	// Gather report items from the state mutator, and collect together all the
 	// APIs in use.
 	api.ForeachCmd(ctx, c.Commands, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
 		items, currentCmd = items[:0], uint64(id)
 
+		if reason, ok := keptReasons[id]; ok {
+			items = append(items, r.newReportItem(log.Info, uint64(id),
+				deadCodeEliminationReason(reason)))
+		}
+
+		if msg, ok := broadBarriers[id]; ok {
+			items = append(items, r.newReportItem(log.Warning, uint64(id), msg))
+		}
+
+		for _, msg := range lints[id] {
+			items = append(items, r.newReportItem(log.Warning, uint64(id), msg))
+		}
+
+		for _, item := range extensionItems[id] {
+			items = append(items, r.newReportItem(item.Severity, uint64(id), item.Message))
+		}
+
 		if as := cmd.Extras().Aborted(); as != nil && as.IsAssert {
 			items = append(items, r.newReportItem(log.Fatal, uint64(id),
 				messages.ErrTraceAssert(as.Reason)))
@@ -0,0 +1,122 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// SetReportConfig replaces the report configuration of the given capture. The
+// configuration is kept by the annotation store, along with the annotations,
+// so it is kept across the sessions if the database keeps records.
+func SetReportConfig(ctx context.Context, c *path.Capture, cfg *service.ReportConfig) error {
+	s := getAnnotationStore(ctx)
+	if s == nil {
+		return &service.ErrDataUnavailable{
+			Reason: messages.ErrMessage("Report configurations are not supported by the server"),
+		}
+	}
+	for _, sup := range cfg.Suppressions {
+		if sup.Rule == "" {
+			return &service.ErrInvalidArgument{
+				Reason: messages.ErrMessage("The suppression has no rule"),
+			}
+		}
+		if len(sup.Command) > 0 {
+			if _, err := Cmd(ctx, c.Command(sup.Command[0], sup.Command[1:]...), nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.setReportConfig(ctx, c.ID.ID(), proto.Clone(cfg).(*service.ReportConfig)); err != nil {
+		return log.Err(ctx, err, "Couldn't save the report configuration")
+	}
+	return nil
+}
+
+// ReportConfig returns the report configuration of the given capture.
+func ReportConfig(ctx context.Context, c *path.Capture) (*service.ReportConfig, error) {
+	s := getAnnotationStore(ctx)
+	if s == nil {
+		return &service.ReportConfig{}, nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.getReportConfig(ctx, c.ID.ID()), nil
+}
+
+// suppressed returns true if the report items of the rule raised by the
+// command are suppressed by the configuration.
+func suppressed(cfg *service.ReportConfig, rule string, cmd *path.Command) bool {
+	for _, s := range cfg.Suppressions {
+		switch {
+		case s.Rule != rule:
+		case len(s.Command) == 0:
+			return true
+		case cmd != nil && api.SubCmdIdx(s.Command).Equals(api.SubCmdIdx(cmd.Indices)):
+			return true
+		}
+	}
+	return false
+}
+
+// applyReportConfig returns the report without the suppressed items, and with
+// the severities of the items overridden by the configuration. The rule of an
+// item is the identifier of its message. The given report is not modified,
+// as it is shared by the database.
+func applyReportConfig(report *service.Report, cfg *service.ReportConfig) *service.Report {
+	if len(cfg.Severities) == 0 && len(cfg.Suppressions) == 0 {
+		return report
+	}
+	out := &service.Report{Strings: report.Strings, Values: report.Values}
+	// The indices of the items in the returned report, -1 if suppressed.
+	indices := make([]int, len(report.Items))
+	for i, item := range report.Items {
+		rule := report.Strings[item.Message.Identifier]
+		if suppressed(cfg, rule, item.Command) {
+			indices[i] = -1
+			continue
+		}
+		if s, ok := cfg.Severities[rule]; ok && s != item.Severity {
+			item = proto.Clone(item).(*service.ReportItem)
+			item.Severity = s
+		}
+		indices[i] = len(out.Items)
+		out.Items = append(out.Items, item)
+	}
+	for _, g := range report.Groups {
+		items := []uint32{}
+		for _, i := range g.Items {
+			if n := indices[i]; n >= 0 {
+				items = append(items, uint32(n))
+			}
+		}
+		if len(items) > 0 {
+			out.Groups = append(out.Groups, &service.ReportGroup{Name: g.Name, Items: items, Tags: g.Tags})
+		}
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestApplyReportConfig(t *testing.T) {
+	ctx := log.Testing(t)
+	c := path.NewCapture(id.OfString("capture"))
+	item := func(s service.Severity, rule uint32, cmd uint64) *service.ReportItem {
+		return &service.ReportItem{
+			Severity: s,
+			Message:  &service.MsgRef{Identifier: rule},
+			Command:  c.Command(cmd),
+		}
+	}
+	report := &service.Report{
+		Strings: []string{"ERR_A", "ERR_B"},
+		Items: []*service.ReportItem{
+			item(service.Severity_ErrorLevel, 0, 1),
+			item(service.Severity_ErrorLevel, 1, 2),
+			item(service.Severity_WarningLevel, 0, 3),
+			item(service.Severity_ErrorLevel, 1, 4),
+		},
+		Groups: []*service.ReportGroup{
+			{Items: []uint32{0, 2}},
+			{Items: []uint32{1, 3}},
+		},
+	}
+
+	got := applyReportConfig(report, &service.ReportConfig{})
+	assert.For(ctx, "Empty config").That(got == report).Equals(true)
+
+	got = applyReportConfig(report, &service.ReportConfig{
+		Severities: map[string]service.Severity{"ERR_A": service.Severity_InfoLevel},
+		Suppressions: []*service.ReportSuppression{
+			{Rule: "ERR_B", Command: []uint64{2}},
+			{Rule: "ERR_A", Command: []uint64{3}},
+		},
+	})
+	if !assert.For(ctx, "Items").That(len(got.Items)).Equals(2) {
+		return
+	}
+	assert.For(ctx, "Overridden").That(got.Items[0].Severity).Equals(service.Severity_InfoLevel)
+	assert.For(ctx, "Kept").That(got.Items[1].Severity).Equals(service.Severity_ErrorLevel)
+	assert.For(ctx, "Command").That(got.Items[1].Command.Indices).DeepEquals([]uint64{4})
+	assert.For(ctx, "Groups").That(len(got.Groups)).Equals(2)
+	assert.For(ctx, "Group 0").That(got.Groups[0].Items).DeepEquals([]uint32{0})
+	assert.For(ctx, "Group 1").That(got.Groups[1].Items).DeepEquals([]uint32{1})
+	assert.For(ctx, "Shared report").That(report.Items[0].Severity).Equals(service.Severity_ErrorLevel)
+
+	got = applyReportConfig(report, &service.ReportConfig{
+		Suppressions: []*service.ReportSuppression{{Rule: "ERR_A"}},
+	})
+	assert.For(ctx, "Rule suppressed").That(len(got.Items)).Equals(2)
+	assert.For(ctx, "Groups").That(len(got.Groups)).Equals(1)
+}
+
+func TestReportConfigKeptAcrossSessions(t *testing.T) {
+	ctx := log.Testing(t)
+	dir, err := ioutil.TempDir("", "report_config")
+	if !assert.For(ctx, "TempDir").ThatError(err).Succeeded() {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	c := path.NewCapture(id.OfString("capture"))
+	cfg := &service.ReportConfig{
+		Severities:   map[string]service.Severity{"ERR_A": service.Severity_InfoLevel},
+		Suppressions: []*service.ReportSuppression{{Rule: "ERR_B"}},
+	}
+	session := func() context.Context {
+		ctx := database.Put(ctx, database.NewInMemory(ctx))
+		database.GetPersistent(ctx).SetPersistentDirectory(dir)
+		return PutAnnotationStore(ctx, NewAnnotationStore())
+	}
+	assert.For(ctx, "SetReportConfig").ThatError(SetReportConfig(session(), c, cfg)).Succeeded()
+	err = SetReportConfig(session(), c, &service.ReportConfig{
+		Suppressions: []*service.ReportSuppression{{}},
+	})
+	assert.For(ctx, "Suppression without rule").ThatError(err).Failed()
+
+	// The configuration is loaded by the server of a new session.
+	got, err := ReportConfig(session(), c)
+	assert.For(ctx, "ReportConfig").ThatError(err).Succeeded()
+	assert.For(ctx, "Severities").That(got.Severities).DeepEquals(cfg.Severities)
+	if assert.For(ctx, "Suppressions").That(len(got.Suppressions)).Equals(1) {
+		assert.For(ctx, "Rule").That(got.Suppressions[0].Rule).Equals("ERR_B")
+	}
+}
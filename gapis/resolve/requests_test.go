@@ -20,6 +20,8 @@ import "github.com/google/gapid/gapis/database"
 var _ = []database.Resolvable{
 	(*CommandTreeResolvable)(nil),
 	(*ContextListResolvable)(nil),
+	(*DispatchBuffersResolvable)(nil),
+	(*FilterCommandsResolvable)(nil),
 	(*FollowResolvable)(nil),
 	(*FramebufferAttachmentBytesResolvable)(nil),
 	(*FramebufferAttachmentResolvable)(nil),
@@ -27,6 +29,10 @@ var _ = []database.Resolvable{
 	(*GetResolvable)(nil),
 	(*GlobalStateResolvable)(nil),
 	(*IndexLimitsResolvable)(nil),
+	(*ObjectLifetimesResolvable)(nil),
+	(*OverdrawBytesResolvable)(nil),
+	(*OverdrawResolvable)(nil),
+	(*PipelineStatisticsResolvable)(nil),
 	(*ReportResolvable)(nil),
 	(*ResourceDataResolvable)(nil),
 	(*ResourceMetaResolvable)(nil),
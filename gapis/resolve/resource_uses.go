@@ -0,0 +1,54 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// ResourceUsesResolver is the interface implemented by APIs which can find
+// the commands using a resource from the footprint of a capture.
+type ResourceUsesResolver interface {
+	// ResolveResourceUses returns the commands and subcommands of the capture
+	// that read, write or transition the layout of the resource with the
+	// given handle, in ascending order.
+	ResolveResourceUses(ctx context.Context, c *path.Capture, handle uint64) ([]*service.ResourceUse, error)
+}
+
+// ResourceUses returns the commands and subcommands of the capture that read,
+// write or transition the layout of the resource with the given handle.
+func ResourceUses(ctx context.Context, p *path.Capture, handle uint64) ([]*service.ResourceUse, error) {
+	c, err := capture.ResolveFromPath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	uses := []*service.ResourceUse{}
+	for _, a := range c.APIs {
+		if r, ok := a.(ResourceUsesResolver); ok {
+			apiUses, err := r.ResolveResourceUses(ctx, p, handle)
+			if err != nil {
+				log.W(ctx, "Couldn't resolve the uses of resource %v by %v: %v", handle, a.Name(), err)
+				continue
+			}
+			uses = append(uses, apiUses...)
+		}
+	}
+	return uses, nil
+}
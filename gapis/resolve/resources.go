@@ -34,7 +34,7 @@ func Resources(ctx context.Context, c *path.Capture, r *path.ResolveConfig) (*se
 	if err != nil {
 		return nil, err
 	}
-	return obj.(*service.Resources), nil
+	return annotateResources(ctx, c, obj.(*service.Resources)), nil
 }
 
 // Resolve implements the database.Resolver interface.
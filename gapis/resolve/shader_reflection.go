@@ -0,0 +1,49 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// ShaderReflectionResolver is the interface implemented by APIs which can
+// reflect the interfaces of their shader modules.
+type ShaderReflectionResolver interface {
+	// ResolveShaderReflection returns the entry points and push constant
+	// blocks of the shader module with the given handle, as it is after the
+	// given command.
+	ResolveShaderReflection(ctx context.Context, after *path.Command, handle uint64) (*service.ShaderReflection, error)
+}
+
+// ShaderReflection returns the entry points, with their descriptor bindings
+// and input and output interfaces, and the push constant blocks of the shader
+// module with the given handle.
+func ShaderReflection(ctx context.Context, after *path.Command, handle uint64) (*service.ShaderReflection, error) {
+	c, err := capture.ResolveFromPath(ctx, after.Capture)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range c.APIs {
+		if r, ok := a.(ShaderReflectionResolver); ok {
+			return r.ResolveShaderReflection(ctx, after, handle)
+		}
+	}
+	return nil, &service.ErrDataUnavailable{Reason: messages.ErrMessage("No API of the capture has shader modules")}
+}
@@ -0,0 +1,254 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/google/gapid/core/data/dictionary"
+	"github.com/google/gapid/core/math/interval"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/box"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// StateDiff returns the changes to the API state of the command to, from the
+// state after the command from to the state after the command to, and the
+// memory ranges written in between.
+func StateDiff(ctx context.Context, from, to *path.Command, r *path.ResolveConfig) (*service.StateDiff, error) {
+	if from.Capture.ID.ID() != to.Capture.ID.ID() {
+		return nil, &service.ErrInvalidArgument{
+			Reason: messages.ErrMessage("The commands of the state diff are not in the same capture"),
+		}
+	}
+	if api.SubCmdIdx(to.Indices).LessThan(api.SubCmdIdx(from.Indices)) {
+		return nil, &service.ErrInvalidArgument{
+			Reason: messages.ErrMessage(fmt.Sprintf("Command %v is after command %v", from.Indices, to.Indices)),
+		}
+	}
+
+	ctx = SetupContext(ctx, to.Capture, r)
+
+	fromObj, fromPath, fromAPI, err := state(ctx, from.StateAfter(), r)
+	if err != nil {
+		return nil, err
+	}
+	toObj, toPath, toAPI, err := state(ctx, to.StateAfter(), r)
+	if err != nil {
+		return nil, err
+	}
+	if fromAPI != toAPI {
+		return nil, &service.ErrInvalidArgument{
+			Reason: messages.ErrMessage("The commands of the state diff are not of the same API"),
+		}
+	}
+
+	d := stateDiffer{seen: map[[2]api.RefID]bool{}}
+	d.diff(deref(reflect.ValueOf(fromObj)), deref(reflect.ValueOf(toObj)), fromPath, toPath)
+
+	writes, err := stateDiffWrites(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &service.StateDiff{Changes: d.changes, Memory: writes}, nil
+}
+
+// stateDiffer walks two API states in step, following the same rules as the
+// state tree, and lists the values which differ.
+type stateDiffer struct {
+	// seen holds the pairs of references already compared, as the state
+	// objects can refer to each other.
+	seen    map[[2]api.RefID]bool
+	changes []*service.StateChange
+}
+
+func (d *stateDiffer) change(kind service.StateChange_Kind, p path.Node, before, after reflect.Value) {
+	c := &service.StateChange{Kind: kind, Path: p.Path()}
+	if before.IsValid() {
+		c.Before, _ = stateValuePreview(before)
+	}
+	if after.IsValid() {
+		c.After, _ = stateValuePreview(after)
+	}
+	d.changes = append(d.changes, c)
+}
+
+// diff compares the value a at the path pa of the old state with the value b
+// at the path pb of the new state.
+func (d *stateDiffer) diff(a, b reflect.Value, pa, pb path.Node) {
+	switch {
+	case !a.IsValid() && !b.IsValid():
+		return
+	case !a.IsValid():
+		d.change(service.StateChange_Added, pb, a, b)
+		return
+	case !b.IsValid():
+		d.change(service.StateChange_Removed, pa, a, b)
+		return
+	}
+
+	switch aNil, bNil := isNil(a), isNil(b); {
+	case aNil && bNil:
+		return
+	case aNil:
+		d.change(service.StateChange_Added, pb, reflect.Value{}, b)
+		return
+	case bNil:
+		d.change(service.StateChange_Removed, pa, a, reflect.Value{})
+		return
+	}
+
+	if a.Type() != b.Type() {
+		d.change(service.StateChange_Modified, pb, a, b)
+		return
+	}
+
+	if ra, ok := a.Interface().(api.Reference); ok {
+		key := [2]api.RefID{ra.RefID(), b.Interface().(api.Reference).RefID()}
+		if key[0] != api.NilRefID && key[1] != api.NilRefID {
+			if d.seen[key] {
+				return
+			}
+			d.seen[key] = true
+		}
+	}
+
+	if da, db := dictionary.From(a.Interface()), dictionary.From(b.Interface()); da != nil && db != nil {
+		for _, key := range da.Keys() {
+			if !db.Contains(key) {
+				d.change(service.StateChange_Removed, path.NewMapIndex(key, pa),
+					deref(reflect.ValueOf(da.Get(key))), reflect.Value{})
+			}
+		}
+		for _, key := range db.Keys() {
+			if !da.Contains(key) {
+				d.change(service.StateChange_Added, path.NewMapIndex(key, pb),
+					reflect.Value{}, deref(reflect.ValueOf(db.Get(key))))
+				continue
+			}
+			d.diff(deref(reflect.ValueOf(da.Get(key))), deref(reflect.ValueOf(db.Get(key))),
+				path.NewMapIndex(key, pa), path.NewMapIndex(key, pb))
+		}
+		return
+	}
+
+	// The memory slices are compared by their ranges, the changes to their
+	// contents are reported as memory writes.
+	if box.IsMemorySlice(a.Type()) {
+		d.leaf(a, b, pb)
+		return
+	}
+
+	switch a.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < a.Len() || i < b.Len(); i++ {
+			switch {
+			case i >= b.Len():
+				d.change(service.StateChange_Removed, path.NewArrayIndex(uint64(i), pa),
+					deref(a.Index(i)), reflect.Value{})
+			case i >= a.Len():
+				d.change(service.StateChange_Added, path.NewArrayIndex(uint64(i), pb),
+					reflect.Value{}, deref(b.Index(i)))
+			default:
+				d.diff(deref(a.Index(i)), deref(b.Index(i)),
+					path.NewArrayIndex(uint64(i), pa), path.NewArrayIndex(uint64(i), pb))
+			}
+		}
+		return
+	}
+
+	ppa, ok := a.Interface().(api.PropertyProvider)
+	if !ok {
+		d.leaf(a, b, pb)
+		return
+	}
+	props := b.Interface().(api.PropertyProvider).Properties()
+	for _, p := range ppa.Properties() {
+		q := props.Find(p.Name)
+		if q == nil {
+			continue
+		}
+		d.diff(deref(reflect.ValueOf(p.Get())), deref(reflect.ValueOf(q.Get())),
+			path.NewField(p.Name, pa), path.NewField(p.Name, pb))
+	}
+}
+
+func (d *stateDiffer) leaf(a, b reflect.Value, pb path.Node) {
+	if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+		d.change(service.StateChange_Modified, pb, a, b)
+	}
+}
+
+// stateDiffWrites returns the memory ranges written by the commands after the
+// top-level command of from, up to the command to.
+func stateDiffWrites(ctx context.Context, from, to *path.Command) ([]*service.StateMemoryChange, error) {
+	allCmds, err := Cmds(ctx, to.Capture)
+	if err != nil {
+		return nil, err
+	}
+	sd, err := SyncData(ctx, to.Capture)
+	if err != nil {
+		return nil, err
+	}
+	cmds, err := sync.MutationCmdsFor(ctx, to.Capture, sd, allCmds, api.CmdID(to.Indices[0]), to.Indices[1:], false)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := capture.NewState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	writes := map[memory.PoolID]*memory.RangeList{}
+	err = api.ForeachCmd(ctx, cmds, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
+		cmd.Mutate(ctx, id, s, nil, nil)
+		if id == api.CmdID(from.Indices[0]) {
+			s.Memory.SetOnCreate(func(id memory.PoolID, pool *memory.Pool) {
+				pool.OnWrite = func(rng memory.Range) {
+					l, ok := writes[id]
+					if !ok {
+						l = &memory.RangeList{}
+						writes[id] = l
+					}
+					interval.Merge(l, rng.Span(), true)
+				}
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*service.StateMemoryChange, 0, len(writes))
+	for id, l := range writes {
+		out = append(out, &service.StateMemoryChange{
+			Pool:   uint32(id),
+			Writes: service.NewMemoryRanges(*l),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Pool < out[j].Pool })
+	return out, nil
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/box"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestStateDiff(t *testing.T) {
+	ctx := log.Testing(t)
+	c := path.NewCapture(id.ID{})
+	fromPath, toPath := c.Command(0).StateAfter(), c.Command(1).StateAfter()
+
+	refA := *testState.ReferenceA
+	refA.Map = map[int]string{1: "one", 7: "seven", 9: "NINE"}
+	refA.Array = []int{0, 10, 20, 30, 40, 50}
+	to := testState
+	to.Int = 43
+	to.ReferenceA = &refA
+	to.ReferenceB = nil
+	to.ReferenceC = &TestStruct{}
+
+	d := stateDiffer{seen: map[[2]api.RefID]bool{}}
+	d.diff(reflect.ValueOf(testState), reflect.ValueOf(to), fromPath, toPath)
+
+	assert.For(ctx, "changes").That(d.changes).DeepEquals([]*service.StateChange{
+		{
+			Kind:   service.StateChange_Modified,
+			Path:   toPath.Field("Int").Path(),
+			Before: box.NewValue(42),
+			After:  box.NewValue(43),
+		}, {
+			Kind:   service.StateChange_Removed,
+			Path:   fromPath.Field("ReferenceA").Field("Map").MapIndex(5).Path(),
+			Before: box.NewValue("five"),
+		}, {
+			Kind:  service.StateChange_Added,
+			Path:  toPath.Field("ReferenceA").Field("Map").MapIndex(7).Path(),
+			After: box.NewValue("seven"),
+		}, {
+			Kind:   service.StateChange_Modified,
+			Path:   toPath.Field("ReferenceA").Field("Map").MapIndex(9).Path(),
+			Before: box.NewValue("nine"),
+			After:  box.NewValue("NINE"),
+		}, {
+			Kind:  service.StateChange_Added,
+			Path:  toPath.Field("ReferenceA").Field("Array").ArrayIndex(5).Path(),
+			After: box.NewValue(50),
+		}, {
+			Kind: service.StateChange_Removed,
+			Path: fromPath.Field("ReferenceB").Path(),
+		}, {
+			Kind: service.StateChange_Added,
+			Path: toPath.Field("ReferenceC").Path(),
+		},
+	})
+
+	d = stateDiffer{seen: map[[2]api.RefID]bool{}}
+	d.diff(reflect.ValueOf(testState), reflect.ValueOf(testState), fromPath, toPath)
+	assert.For(ctx, "no changes").That(len(d.changes)).Equals(0)
+}
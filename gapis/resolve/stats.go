@@ -16,7 +16,9 @@ package resolve
 
 import (
 	"context"
+	"sort"
 
+	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/api/sync"
 	"github.com/google/gapid/gapis/capture"
@@ -24,6 +26,14 @@ import (
 	"github.com/google/gapid/gapis/service/path"
 )
 
+// CaptureBreakdownResolver is the interface implemented by APIs which can
+// break down the API specific objects of a capture.
+type CaptureBreakdownResolver interface {
+	// ResolveCaptureBreakdown adds the render passes, shader modules,
+	// pipelines and command buffers of the given capture to the breakdown.
+	ResolveCaptureBreakdown(ctx context.Context, c *path.Capture, out *service.CaptureBreakdown) error
+}
+
 // Stats resolves and returns the stats list from the path p.
 func Stats(ctx context.Context, p *path.Stats, r *path.ResolveConfig) (*service.Stats, error) {
 	stats := &service.Stats{}
@@ -33,6 +43,13 @@ func Stats(ctx context.Context, p *path.Stats, r *path.ResolveConfig) (*service.
 			return nil, err
 		}
 	}
+	if p.Breakdown {
+		breakdown, err := captureBreakdown(ctx, p.Capture)
+		if err != nil {
+			return nil, err
+		}
+		stats.Breakdown = breakdown
+	}
 	c, err := capture.ResolveFromPath(ctx, p.Capture)
 	if err != nil {
 		return nil, err
@@ -69,6 +86,8 @@ func drawCallStats(ctx context.Context, capt *path.Capture, stats *service.Stats
 
 	drawsPerFrame := make([]uint64, len(events.List))
 	drawsSinceLastFrame := uint64(0)
+	dispatchesPerFrame := make([]uint64, len(events.List))
+	dispatchesSinceLastFrame := uint64(0)
 
 	processed := map[sync.SyncNodeIdx]struct{}{}
 
@@ -108,6 +127,9 @@ func drawCallStats(ctx context.Context, capt *path.Capture, stats *service.Stats
 
 					drawsSinceLastFrame += 1
 				}
+				if len(idx) > 1 && cmdflags.IsExecutedDispatch() {
+					dispatchesSinceLastFrame += 1
+				}
 			}
 		}
 
@@ -168,8 +190,53 @@ func drawCallStats(ctx context.Context, capt *path.Capture, stats *service.Stats
 		}
 		drawsPerFrame[i] = drawsSinceLastFrame
 		drawsSinceLastFrame = 0
+		dispatchesPerFrame[i] = dispatchesSinceLastFrame
+		dispatchesSinceLastFrame = 0
 	}
 
 	stats.DrawCalls = drawsPerFrame
+	stats.DispatchCalls = dispatchesPerFrame
 	return nil
 }
+
+// captureBreakdown returns the breakdown of the given capture. The command
+// counts and the observed memory are computed for all the APIs, the other
+// statistics are added by the APIs implementing CaptureBreakdownResolver.
+func captureBreakdown(ctx context.Context, p *path.Capture) (*service.CaptureBreakdown, error) {
+	c, err := capture.ResolveFromPath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	out := &service.CaptureBreakdown{}
+	counts := map[string]uint64{}
+	for _, cmd := range c.Commands {
+		counts[cmd.CmdName()]++
+		if o := cmd.Extras().Observations(); o != nil {
+			for _, r := range o.Reads {
+				out.ObservedMemory += r.Range.Size
+			}
+			for _, w := range o.Writes {
+				out.ObservedMemory += w.Range.Size
+			}
+			out.Observations += uint64(len(o.Reads) + len(o.Writes))
+		}
+	}
+	if c.InitialState != nil {
+		for _, o := range c.InitialState.Memory {
+			out.InitialStateMemory += o.Range.Size
+		}
+	}
+	for name, count := range counts {
+		out.Commands = append(out.Commands, &service.CommandTypeCount{Name: name, Count: count})
+	}
+	sort.Slice(out.Commands, func(i, j int) bool { return out.Commands[i].Name < out.Commands[j].Name })
+
+	for _, a := range c.APIs {
+		if r, ok := a.(CaptureBreakdownResolver); ok {
+			if err := r.ResolveCaptureBreakdown(ctx, p, out); err != nil {
+				log.W(ctx, "Couldn't resolve the breakdown of %v: %v", a.Name(), err)
+			}
+		}
+	}
+	return out, nil
+}
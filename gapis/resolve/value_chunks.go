@@ -0,0 +1,113 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+const (
+	// DefaultValueChunkSize is the size of the chunks of ValueChunks if no
+	// size is requested.
+	DefaultValueChunkSize = 1 << 20
+	// MaxValueChunkSize is the largest size of the chunks of ValueChunks,
+	// which keeps the chunks below the gRPC message size limit.
+	MaxValueChunkSize = 2 << 20
+)
+
+// encodedValue is a service.Value encoded as a proto.
+type encodedValue struct {
+	data []byte
+	id   id.ID
+}
+
+// ValueChunks resolves the value at p, and calls h with the chunks of the
+// value encoded as a service.Value, in order, starting at offset. Each chunk
+// holds at most chunkSize bytes, or DefaultValueChunkSize bytes if chunkSize
+// is 0. At least one chunk is always passed to h, even if it is empty.
+func ValueChunks(
+	ctx context.Context,
+	p *path.Any,
+	offset uint64,
+	chunkSize uint32,
+	r *path.ResolveConfig,
+	h func(*service.DataChunk) error) error {
+
+	obj, err := database.Build(ctx, &EncodedValueResolvable{Path: p, Config: r})
+	if err != nil {
+		return err
+	}
+	v := obj.(*encodedValue)
+
+	size := uint64(len(v.data))
+	if offset > size {
+		return &service.ErrInvalidArgument{
+			Reason: messages.ErrMessage(fmt.Sprintf("Offset %v is beyond the size %v of the value", offset, size)),
+		}
+	}
+	switch {
+	case chunkSize == 0:
+		chunkSize = DefaultValueChunkSize
+	case chunkSize > MaxValueChunkSize:
+		chunkSize = MaxValueChunkSize
+	}
+
+	for first := true; first || offset < size; first = false {
+		if task.Stopped(ctx) {
+			return task.StopReason(ctx)
+		}
+		end := offset + uint64(chunkSize)
+		if end > size {
+			end = size
+		}
+		err := h(&service.DataChunk{
+			ID:     path.NewID(v.id),
+			Size:   size,
+			Offset: offset,
+			Data:   v.data[offset:end],
+		})
+		if err != nil {
+			return err
+		}
+		offset = end
+	}
+	return nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *EncodedValueResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	v, err := Get(ctx, r.Path, r.Config)
+	if err != nil {
+		return nil, err
+	}
+	val := service.NewValue(v)
+	if val == nil {
+		return nil, fmt.Errorf("Cannot encode value of type %T", v)
+	}
+	data, err := proto.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	return &encodedValue{data: data, id: id.OfBytes(data)}, nil
+}
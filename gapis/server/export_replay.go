@@ -18,15 +18,21 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	gopath "path"
+	"strings"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/app/layout"
 	"github.com/google/gapid/core/archive"
 	"github.com/google/gapid/core/data/id"
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
 	"github.com/google/gapid/core/os/device/bind"
+	"github.com/google/gapid/core/os/file"
+	"github.com/google/gapid/gapidapk"
 	"github.com/google/gapid/gapis/capture"
 	"github.com/google/gapid/gapis/database"
 	"github.com/google/gapid/gapis/replay"
@@ -159,5 +165,139 @@ func exportReplay(ctx context.Context, c *path.Capture, d *path.Device, out stri
 		ar.Write(ri.Id, obj.([]byte))
 	}
 
+	if opts.Bundle {
+		dev := bind.GetRegistry(ctx).Device(d.ID.ID())
+		if dev == nil {
+			return log.Errf(ctx, nil, "Unknown replay device: %v", d.ID)
+		}
+		abi := dev.Instance().GetConfiguration().PreferredABI([]*device.ABI{cap.Header.ABI})
+		if err := writeReplayBundle(ctx, out, abi); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const bundleLauncherPosix = `#!/bin/sh
+# Replays the exported replay with the bundled gapir, and the bundled virtual
+# swapchain layer. The postbacks of the replay are written to the postbacks
+# directory.
+DIR="$(cd "$(dirname "$0")" && pwd)"
+mkdir -p "$DIR/postbacks"
+export VK_LAYER_PATH="$DIR${VK_LAYER_PATH:+:$VK_LAYER_PATH}"
+exec "$DIR/%s" --replay-archive "$DIR" --postback-dir "$DIR/postbacks" "$@"
+`
+
+const bundleLauncherWindows = `@echo off
+rem Replays the exported replay with the bundled gapir, and the bundled virtual
+rem swapchain layer. The postbacks of the replay are written to the postbacks
+rem directory.
+setlocal
+if not exist "%%~dp0postbacks" mkdir "%%~dp0postbacks"
+set "VK_LAYER_PATH=%%~dp0;%%VK_LAYER_PATH%%"
+"%%~dp0%s" --replay-archive "%%~dp0." --postback-dir "%%~dp0postbacks" %%*
+`
+
+const bundleLauncherAndroid = `#!/bin/sh
+# Replays the exported replay on the Android device selected by adb, with the
+# bundled gapid.apk. The replay is pushed to the external files of the app,
+# where gapir replays it when launched. The postbacks of the replay are pulled
+# to the postbacks directory.
+DIR="$(cd "$(dirname "$0")" && pwd)"
+PKG=%s
+REPLAY="/sdcard/Android/data/$PKG/files/replay"
+adb install -r -g "$DIR/%s" || exit 1
+adb shell rm -rf "$REPLAY"
+adb shell mkdir -p "$REPLAY" || exit 1
+adb push "$DIR/payload.bin" "$DIR"/resources.* "$REPLAY/" || exit 1
+adb shell am start -S -n "$PKG/android.app.NativeActivity" || exit 1
+# gapir removes the payload once the replay is done.
+while adb shell test -e "$REPLAY/payload.bin"; do
+  sleep 1
+done
+mkdir -p "$DIR/postbacks"
+adb pull "$REPLAY/postbacks/." "$DIR/postbacks"
+`
+
+// writeReplayBundle copies the gapir binary and the virtual swapchain layer of
+// the given ABI to the exported replay directory out, along with the manifest
+// of the layer and a script launching the replay with the layer. For Android,
+// the gapid.apk holding gapir and the layer is copied instead.
+func writeReplayBundle(ctx context.Context, out string, abi *device.ABI) error {
+	if abi.OS == device.Android {
+		return writeAndroidReplayBundle(ctx, out, abi)
+	}
+	gapir, err := layout.Gapir(ctx, abi)
+	if err != nil {
+		return log.Errf(ctx, err, "Couldn't find gapir for %v", abi)
+	}
+	dir := file.Abs(out)
+	if err := file.Copy(ctx, dir.Join(gapir.Basename()), gapir); err != nil {
+		return log.Errf(ctx, err, "Failed to copy gapir")
+	}
+	if err := writeBundleLayer(ctx, dir, abi, layout.LibVirtualSwapChain); err != nil {
+		return err
+	}
+	launcher, format := "replay.sh", bundleLauncherPosix
+	if abi.OS == device.Windows {
+		launcher, format = "replay.bat", bundleLauncherWindows
+	}
+	script := fmt.Sprintf(format, gapir.Basename())
+	if err := ioutil.WriteFile(dir.Join(launcher).System(), []byte(script), 0755); err != nil {
+		return log.Errf(ctx, err, "Failed to write the replay launcher")
+	}
+	return nil
+}
+
+// writeAndroidReplayBundle copies the gapid.apk of the given ABI to the
+// exported replay directory out, along with a script installing it, and
+// replaying the exported replay on the device.
+func writeAndroidReplayBundle(ctx context.Context, out string, abi *device.ABI) error {
+	apk, err := layout.GapidApk(ctx, abi)
+	if err != nil {
+		return log.Errf(ctx, err, "Couldn't find gapid.apk for %v", abi)
+	}
+	dir := file.Abs(out)
+	if err := file.Copy(ctx, dir.Join(apk.Basename()), apk); err != nil {
+		return log.Errf(ctx, err, "Failed to copy gapid.apk")
+	}
+	script := fmt.Sprintf(bundleLauncherAndroid, gapidapk.PackageName(abi), apk.Basename())
+	if err := ioutil.WriteFile(dir.Join("replay.sh").System(), []byte(script), 0755); err != nil {
+		return log.Errf(ctx, err, "Failed to write the replay launcher")
+	}
+	return nil
+}
+
+// writeBundleLayer copies the library of the given Vulkan layer to the
+// directory dir, along with its manifest. As in loader.SetupReplay, the
+// manifest refers to the library, which is next to it, so the directory only
+// has to be added to VK_LAYER_PATH.
+func writeBundleLayer(ctx context.Context, dir file.Path, abi *device.ABI, lib layout.LibraryType) error {
+	libPath, err := layout.Library(ctx, lib, abi)
+	if err != nil {
+		return log.Errf(ctx, err, "Couldn't find the library %v for %v", layout.LibraryName(lib, abi), abi)
+	}
+	if err := file.Copy(ctx, dir.Join(libPath.Basename()), libPath); err != nil {
+		return log.Errf(ctx, err, "Failed to copy %v", libPath.Basename())
+	}
+	json, err := layout.Json(ctx, lib)
+	if err != nil {
+		return log.Errf(ctx, err, "Couldn't find the layer manifest of %v", libPath.Basename())
+	}
+	content, err := ioutil.ReadFile(json.System())
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to read %v", json.Basename())
+	}
+	// The loader looks up the library paths with a separator relative to the
+	// manifest.
+	libName := "./" + libPath.Basename()
+	if abi.OS == device.Windows {
+		libName = ".\\\\" + libPath.Basename()
+	}
+	manifest := strings.Replace(string(content), "<library>", libName, 1)
+	if err := ioutil.WriteFile(dir.Join(json.Basename()).System(), []byte(manifest), 0644); err != nil {
+		return log.Errf(ctx, err, "Failed to write %v", json.Basename())
+	}
 	return nil
 }
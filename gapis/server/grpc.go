@@ -35,6 +35,7 @@ import (
 	"github.com/google/gapid/gapis/service"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	xctx "golang.org/x/net/context"
 )
@@ -57,6 +58,13 @@ func NewWithListener(ctx context.Context, l net.Listener, cfg Config, srvChan ch
 		bindCtx:   func(c context.Context) context.Context { return keys.Clone(c, ctx) },
 		keepAlive: make(chan struct{}, 1),
 	}
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(auth.ServerInterceptor(cfg.AuthToken)),
+		grpc.StreamInterceptor(auth.StreamServerInterceptor(cfg.AuthToken)),
+	}
+	if cfg.TLS != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(cfg.TLS)))
+	}
 	return grpcutil.ServeWithListener(ctx, l, func(ctx context.Context, listener net.Listener, server *grpc.Server) error {
 		if addr, ok := listener.Addr().(*net.TCPAddr); ok {
 			// The following message is parsed by launchers to detect the selected port. DO NOT CHANGE!
@@ -70,7 +78,7 @@ func NewWithListener(ctx context.Context, l net.Listener, cfg Config, srvChan ch
 			crash.Go(func() { s.stopIfIdle(ctx, server, cfg.IdleTimeout) })
 		}
 		return nil
-	}, grpc.UnaryInterceptor(auth.ServerInterceptor(cfg.AuthToken)))
+	}, options...)
 }
 
 type grpcServer struct {
@@ -175,6 +183,18 @@ func (s *grpcServer) Get(ctx xctx.Context, req *service.GetRequest) (*service.Ge
 	return &service.GetResponse{Res: &service.GetResponse_Value{Value: val}}, nil
 }
 
+func (s *grpcServer) GetStream(req *service.GetStreamRequest, server service.Gapid_GetStreamServer) error {
+	defer s.inRPC()()
+	ctx := server.Context()
+	err := s.handler.GetStream(s.bindCtx(ctx), req, func(c *service.DataChunk) error {
+		return server.Send(&service.GetStreamResponse{Res: &service.GetStreamResponse_Chunk{Chunk: c}})
+	})
+	if err := service.NewError(err); err != nil {
+		return server.Send(&service.GetStreamResponse{Res: &service.GetStreamResponse_Error{Error: err}})
+	}
+	return nil
+}
+
 func (s *grpcServer) Set(ctx xctx.Context, req *service.SetRequest) (*service.SetResponse, error) {
 	defer s.inRPC()()
 	res, err := s.handler.Set(s.bindCtx(ctx), req.Path, req.Value.Get(), req.Config)
@@ -388,6 +408,15 @@ func (s *grpcServer) ExportReplay(ctx xctx.Context, req *service.ExportReplayReq
 	return &service.ExportReplayResponse{}, nil
 }
 
+func (s *grpcServer) ReplaceData(ctx xctx.Context, req *service.ReplaceDataRequest) (*service.ReplaceDataResponse, error) {
+	defer s.inRPC()()
+	capture, err := s.handler.ReplaceData(s.bindCtx(ctx), req.After, req.Handle, req.Offset, req.Data)
+	if err := service.NewError(err); err != nil {
+		return &service.ReplaceDataResponse{Res: &service.ReplaceDataResponse_Error{Error: err}}, nil
+	}
+	return &service.ReplaceDataResponse{Res: &service.ReplaceDataResponse_Capture{Capture: capture}}, nil
+}
+
 func (s *grpcServer) DCECapture(ctx xctx.Context, req *service.DCECaptureRequest) (*service.DCECaptureResponse, error) {
 	defer s.inRPC()()
 	capture, err := s.handler.DCECapture(s.bindCtx(ctx), req.Capture, req.Commands)
@@ -397,6 +426,240 @@ func (s *grpcServer) DCECapture(ctx xctx.Context, req *service.DCECaptureRequest
 	return &service.DCECaptureResponse{Res: &service.DCECaptureResponse_Capture{Capture: capture}}, nil
 }
 
+func (s *grpcServer) TrimCapture(ctx xctx.Context, req *service.TrimCaptureRequest) (*service.TrimCaptureResponse, error) {
+	defer s.inRPC()()
+	capture, err := s.handler.TrimCapture(s.bindCtx(ctx), req.Capture, req.From, req.To, req.Commands)
+	if err := service.NewError(err); err != nil {
+		return &service.TrimCaptureResponse{Res: &service.TrimCaptureResponse_Error{Error: err}}, nil
+	}
+	return &service.TrimCaptureResponse{Res: &service.TrimCaptureResponse_Capture{Capture: capture}}, nil
+}
+
+func (s *grpcServer) GetDependencies(ctx xctx.Context, req *service.GetDependenciesRequest) (*service.GetDependenciesResponse, error) {
+	defer s.inRPC()()
+	commands, err := s.handler.GetDependencies(s.bindCtx(ctx), req.Command)
+	if err := service.NewError(err); err != nil {
+		return &service.GetDependenciesResponse{Res: &service.GetDependenciesResponse_Error{Error: err}}, nil
+	}
+	return &service.GetDependenciesResponse{
+		Res: &service.GetDependenciesResponse_Dependencies{
+			Dependencies: &service.Dependencies{Commands: commands},
+		},
+	}, nil
+}
+
+func (s *grpcServer) GetDependents(ctx xctx.Context, req *service.GetDependentsRequest) (*service.GetDependentsResponse, error) {
+	defer s.inRPC()()
+	commands, err := s.handler.GetDependents(s.bindCtx(ctx), req.Command)
+	if err := service.NewError(err); err != nil {
+		return &service.GetDependentsResponse{Res: &service.GetDependentsResponse_Error{Error: err}}, nil
+	}
+	return &service.GetDependentsResponse{
+		Res: &service.GetDependentsResponse_Dependents{
+			Dependents: &service.Dependencies{Commands: commands},
+		},
+	}, nil
+}
+
+func (s *grpcServer) GetResourceUses(ctx xctx.Context, req *service.GetResourceUsesRequest) (*service.GetResourceUsesResponse, error) {
+	defer s.inRPC()()
+	uses, err := s.handler.GetResourceUses(s.bindCtx(ctx), req.Capture, req.Handle)
+	if err := service.NewError(err); err != nil {
+		return &service.GetResourceUsesResponse{Res: &service.GetResourceUsesResponse_Error{Error: err}}, nil
+	}
+	return &service.GetResourceUsesResponse{
+		Res: &service.GetResourceUsesResponse_Uses{
+			Uses: &service.ResourceUses{Uses: uses},
+		},
+	}, nil
+}
+
+func (s *grpcServer) GetShaderReflection(ctx xctx.Context, req *service.GetShaderReflectionRequest) (*service.GetShaderReflectionResponse, error) {
+	defer s.inRPC()()
+	reflection, err := s.handler.GetShaderReflection(s.bindCtx(ctx), req.After, req.Handle)
+	if err := service.NewError(err); err != nil {
+		return &service.GetShaderReflectionResponse{Res: &service.GetShaderReflectionResponse_Error{Error: err}}, nil
+	}
+	return &service.GetShaderReflectionResponse{
+		Res: &service.GetShaderReflectionResponse_Reflection{Reflection: reflection},
+	}, nil
+}
+
+func (s *grpcServer) FilterCommands(ctx xctx.Context, req *service.FilterCommandsRequest) (*service.FilterCommandsResponse, error) {
+	defer s.inRPC()()
+	indices, err := s.handler.FilterCommands(s.bindCtx(ctx), req.Capture, req.Expression)
+	if err := service.NewError(err); err != nil {
+		return &service.FilterCommandsResponse{Res: &service.FilterCommandsResponse_Error{Error: err}}, nil
+	}
+	return &service.FilterCommandsResponse{
+		Res: &service.FilterCommandsResponse_Commands{
+			Commands: &service.CommandIndices{Indices: indices},
+		},
+	}, nil
+}
+
+func (s *grpcServer) FilterCommandTree(conn service.Gapid_FilterCommandTreeServer) error {
+	defer s.inRPC()()
+	ctx := s.bindCtx(conn.Context())
+	req, err := conn.Recv()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	f, err := s.handler.FilterCommandTree(ctx, req.Tree)
+	if err := service.NewError(err); err != nil {
+		return conn.Send(&service.FilterCommandTreeResponse{Res: &service.FilterCommandTreeResponse_Error{Error: err}})
+	}
+	defer f.Dispose()
+
+	// Keep receiving the requests while an expression is matched, and only
+	// keep the latest one. A new request cancels the matching of the current
+	// expression, so the expressions typed in the meantime are skipped.
+	latest := make(chan *service.FilterCommandTreeRequest, 1)
+	var mutex sync.Mutex
+	cancel := task.CancelFunc(func() {})
+	var recvErr error
+	crash.Go(func() {
+		defer close(latest)
+		for {
+			req, err := conn.Recv()
+			if err != nil {
+				recvErr = err
+				return
+			}
+			mutex.Lock()
+			cancel()
+			select {
+			case <-latest:
+			default:
+			}
+			latest <- req
+			mutex.Unlock()
+		}
+	})
+
+	for {
+		filterCtx, stop := task.WithCancel(ctx)
+		mutex.Lock()
+		cancel = stop
+		mutex.Unlock()
+		delta, err := f.Filter(filterCtx, req.Expression)
+		superseded := task.Stopped(filterCtx) && !task.Stopped(ctx)
+		stop()
+		if !superseded {
+			res := &service.FilterCommandTreeResponse{}
+			if err := service.NewError(err); err != nil {
+				res.Res = &service.FilterCommandTreeResponse_Error{Error: err}
+			} else {
+				res.Res = &service.FilterCommandTreeResponse_Delta{Delta: delta}
+			}
+			if err := conn.Send(res); err != nil {
+				return err
+			}
+		}
+		next, ok := <-latest
+		if !ok {
+			break
+		}
+		req = next
+	}
+	if recvErr == io.EOF {
+		return nil
+	}
+	return recvErr
+}
+
+func (s *grpcServer) GetMemoryHeaps(ctx xctx.Context, req *service.GetMemoryHeapsRequest) (*service.GetMemoryHeapsResponse, error) {
+	defer s.inRPC()()
+	heaps, err := s.handler.GetMemoryHeaps(s.bindCtx(ctx), req.After)
+	if err := service.NewError(err); err != nil {
+		return &service.GetMemoryHeapsResponse{Res: &service.GetMemoryHeapsResponse_Error{Error: err}}, nil
+	}
+	return &service.GetMemoryHeapsResponse{
+		Res: &service.GetMemoryHeapsResponse_Heaps{Heaps: heaps},
+	}, nil
+}
+
+func (s *grpcServer) GetStateDiff(ctx xctx.Context, req *service.GetStateDiffRequest) (*service.GetStateDiffResponse, error) {
+	defer s.inRPC()()
+	diff, err := s.handler.GetStateDiff(s.bindCtx(ctx), req.From, req.To, req.Config)
+	if err := service.NewError(err); err != nil {
+		return &service.GetStateDiffResponse{Res: &service.GetStateDiffResponse_Error{Error: err}}, nil
+	}
+	return &service.GetStateDiffResponse{Res: &service.GetStateDiffResponse_Diff{Diff: diff}}, nil
+}
+
+func (s *grpcServer) SetAnnotation(ctx xctx.Context, req *service.SetAnnotationRequest) (*service.SetAnnotationResponse, error) {
+	defer s.inRPC()()
+	err := s.handler.SetAnnotation(s.bindCtx(ctx), req.Capture, req.Annotation)
+	if err := service.NewError(err); err != nil {
+		return &service.SetAnnotationResponse{Error: err}, nil
+	}
+	return &service.SetAnnotationResponse{}, nil
+}
+
+func (s *grpcServer) GetAnnotations(ctx xctx.Context, req *service.GetAnnotationsRequest) (*service.GetAnnotationsResponse, error) {
+	defer s.inRPC()()
+	annotations, err := s.handler.GetAnnotations(s.bindCtx(ctx), req.Capture)
+	if err := service.NewError(err); err != nil {
+		return &service.GetAnnotationsResponse{Res: &service.GetAnnotationsResponse_Error{Error: err}}, nil
+	}
+	return &service.GetAnnotationsResponse{
+		Res: &service.GetAnnotationsResponse_Annotations{Annotations: annotations},
+	}, nil
+}
+
+func (s *grpcServer) SetReportConfig(ctx xctx.Context, req *service.SetReportConfigRequest) (*service.SetReportConfigResponse, error) {
+	defer s.inRPC()()
+	err := s.handler.SetReportConfig(s.bindCtx(ctx), req.Capture, req.Config)
+	if err := service.NewError(err); err != nil {
+		return &service.SetReportConfigResponse{Error: err}, nil
+	}
+	return &service.SetReportConfigResponse{}, nil
+}
+
+func (s *grpcServer) GetReportConfig(ctx xctx.Context, req *service.GetReportConfigRequest) (*service.GetReportConfigResponse, error) {
+	defer s.inRPC()()
+	cfg, err := s.handler.GetReportConfig(s.bindCtx(ctx), req.Capture)
+	if err := service.NewError(err); err != nil {
+		return &service.GetReportConfigResponse{Res: &service.GetReportConfigResponse_Error{Error: err}}, nil
+	}
+	return &service.GetReportConfigResponse{Res: &service.GetReportConfigResponse_Config{Config: cfg}}, nil
+}
+
+func (s *grpcServer) GetFilmstrip(ctx xctx.Context, req *service.GetFilmstripRequest) (*service.GetFilmstripResponse, error) {
+	defer s.inRPC()()
+	filmstrip, err := s.handler.GetFilmstrip(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.GetFilmstripResponse{Res: &service.GetFilmstripResponse_Error{Error: err}}, nil
+	}
+	return &service.GetFilmstripResponse{Res: &service.GetFilmstripResponse_Filmstrip{Filmstrip: filmstrip}}, nil
+}
+
+func (s *grpcServer) CompareReplays(ctx xctx.Context, req *service.CompareReplaysRequest) (*service.CompareReplaysResponse, error) {
+	defer s.inRPC()()
+	comparison, err := s.handler.CompareReplays(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.CompareReplaysResponse{Res: &service.CompareReplaysResponse_Error{Error: err}}, nil
+	}
+	return &service.CompareReplaysResponse{Res: &service.CompareReplaysResponse_Comparison{Comparison: comparison}}, nil
+}
+
+func (s *grpcServer) GetImageLayouts(ctx xctx.Context, req *service.GetImageLayoutsRequest) (*service.GetImageLayoutsResponse, error) {
+	defer s.inRPC()()
+	layouts, err := s.handler.GetImageLayouts(s.bindCtx(ctx), req.After, req.Image)
+	if err := service.NewError(err); err != nil {
+		return &service.GetImageLayoutsResponse{Res: &service.GetImageLayoutsResponse_Error{Error: err}}, nil
+	}
+	return &service.GetImageLayoutsResponse{
+		Res: &service.GetImageLayoutsResponse_Layouts{
+			Layouts: &service.ImageLayouts{Subresources: layouts},
+		},
+	}, nil
+}
+
 func (s *grpcServer) GetDevices(ctx xctx.Context, req *service.GetDevicesRequest) (*service.GetDevicesResponse, error) {
 	defer s.inRPC()()
 	devices, err := s.handler.GetDevices(s.bindCtx(ctx))
@@ -439,6 +702,103 @@ func (s *grpcServer) GetFramebufferAttachment(ctx xctx.Context, req *service.Get
 	return &service.GetFramebufferAttachmentResponse{Res: &service.GetFramebufferAttachmentResponse_Image{Image: image}}, nil
 }
 
+func (s *grpcServer) GetFramebufferAttachments(ctx xctx.Context, req *service.GetFramebufferAttachmentsRequest) (*service.GetFramebufferAttachmentsResponse, error) {
+	defer s.inRPC()()
+	images, err := s.handler.GetFramebufferAttachments(
+		s.bindCtx(ctx),
+		req.ReplaySettings,
+		req.Attachments,
+		req.Hints,
+	)
+	if err := service.NewError(err); err != nil {
+		return &service.GetFramebufferAttachmentsResponse{Res: &service.GetFramebufferAttachmentsResponse_Error{Error: err}}, nil
+	}
+	return &service.GetFramebufferAttachmentsResponse{
+		Res: &service.GetFramebufferAttachmentsResponse_Images{
+			Images: &service.FramebufferAttachmentImages{Images: images},
+		},
+	}, nil
+}
+
+func (s *grpcServer) GetOverdraw(ctx xctx.Context, req *service.GetOverdrawRequest) (*service.GetOverdrawResponse, error) {
+	defer s.inRPC()()
+	image, err := s.handler.GetOverdraw(
+		s.bindCtx(ctx),
+		req.ReplaySettings,
+		req.First,
+		req.After,
+		req.Hints,
+	)
+	if err := service.NewError(err); err != nil {
+		return &service.GetOverdrawResponse{Res: &service.GetOverdrawResponse_Error{Error: err}}, nil
+	}
+	return &service.GetOverdrawResponse{Res: &service.GetOverdrawResponse_Image{Image: image}}, nil
+}
+
+func (s *grpcServer) GetPipelineStatistics(ctx xctx.Context, req *service.GetPipelineStatisticsRequest) (*service.GetPipelineStatisticsResponse, error) {
+	defer s.inRPC()()
+	stats, err := s.handler.GetPipelineStatistics(
+		s.bindCtx(ctx),
+		req.ReplaySettings,
+		req.Draws,
+		req.Hints,
+	)
+	if err := service.NewError(err); err != nil {
+		return &service.GetPipelineStatisticsResponse{Res: &service.GetPipelineStatisticsResponse_Error{Error: err}}, nil
+	}
+	return &service.GetPipelineStatisticsResponse{Res: &service.GetPipelineStatisticsResponse_Statistics{Statistics: stats}}, nil
+}
+
+func (s *grpcServer) GetDispatchBuffers(ctx xctx.Context, req *service.GetDispatchBuffersRequest) (*service.GetDispatchBuffersResponse, error) {
+	defer s.inRPC()()
+	buffers, err := s.handler.GetDispatchBuffers(
+		s.bindCtx(ctx),
+		req.ReplaySettings,
+		req.Dispatch,
+		req.Hints,
+	)
+	if err := service.NewError(err); err != nil {
+		return &service.GetDispatchBuffersResponse{Res: &service.GetDispatchBuffersResponse_Error{Error: err}}, nil
+	}
+	return &service.GetDispatchBuffersResponse{Res: &service.GetDispatchBuffersResponse_Buffers{Buffers: buffers}}, nil
+}
+
+func (s *grpcServer) GetCaptureEnvironment(ctx xctx.Context, req *service.GetCaptureEnvironmentRequest) (*service.GetCaptureEnvironmentResponse, error) {
+	defer s.inRPC()()
+	env, err := s.handler.GetCaptureEnvironment(s.bindCtx(ctx), req.Capture, req.Device)
+	if err := service.NewError(err); err != nil {
+		return &service.GetCaptureEnvironmentResponse{Res: &service.GetCaptureEnvironmentResponse_Error{Error: err}}, nil
+	}
+	return &service.GetCaptureEnvironmentResponse{Res: &service.GetCaptureEnvironmentResponse_Environment{Environment: env}}, nil
+}
+
+func (s *grpcServer) GetObjectLifetimes(ctx xctx.Context, req *service.GetObjectLifetimesRequest) (*service.GetObjectLifetimesResponse, error) {
+	defer s.inRPC()()
+	lifetimes, err := s.handler.GetObjectLifetimes(s.bindCtx(ctx), req.Capture)
+	if err := service.NewError(err); err != nil {
+		return &service.GetObjectLifetimesResponse{Res: &service.GetObjectLifetimesResponse_Error{Error: err}}, nil
+	}
+	return &service.GetObjectLifetimesResponse{Res: &service.GetObjectLifetimesResponse_Lifetimes{Lifetimes: lifetimes}}, nil
+}
+
+func (s *grpcServer) GetCaptureDiff(ctx xctx.Context, req *service.GetCaptureDiffRequest) (*service.GetCaptureDiffResponse, error) {
+	defer s.inRPC()()
+	diff, err := s.handler.GetCaptureDiff(s.bindCtx(ctx), req.Before, req.After, req.Config)
+	if err := service.NewError(err); err != nil {
+		return &service.GetCaptureDiffResponse{Res: &service.GetCaptureDiffResponse_Error{Error: err}}, nil
+	}
+	return &service.GetCaptureDiffResponse{Res: &service.GetCaptureDiffResponse_Diff{Diff: diff}}, nil
+}
+
+func (s *grpcServer) CallExtension(ctx xctx.Context, req *service.CallExtensionRequest) (*service.CallExtensionResponse, error) {
+	defer s.inRPC()()
+	result, err := s.handler.CallExtension(s.bindCtx(ctx), req.Capture, req.Extension, req.Endpoint, req.Arguments)
+	if err := service.NewError(err); err != nil {
+		return &service.CallExtensionResponse{Res: &service.CallExtensionResponse_Error{Error: err}}, nil
+	}
+	return &service.CallExtensionResponse{Res: &service.CallExtensionResponse_Result{Result: result}}, nil
+}
+
 func (s *grpcServer) GetLogStream(req *service.GetLogStreamRequest, server service.Gapid_GetLogStreamServer) error {
 	defer s.inRPC()()
 	ctx := server.Context()
@@ -461,6 +821,15 @@ func (s *grpcServer) UpdateSettings(ctx xctx.Context, req *service.UpdateSetting
 	return &service.UpdateSettingsResponse{}, nil
 }
 
+func (s *grpcServer) GetCacheUsage(ctx xctx.Context, req *service.GetCacheUsageRequest) (*service.GetCacheUsageResponse, error) {
+	defer s.inRPC()()
+	usage, err := s.handler.GetCacheUsage(s.bindCtx(ctx), req.Clear)
+	if err := service.NewError(err); err != nil {
+		return &service.GetCacheUsageResponse{Res: &service.GetCacheUsageResponse_Error{Error: err}}, nil
+	}
+	return &service.GetCacheUsageResponse{Res: &service.GetCacheUsageResponse_Usage{Usage: usage}}, nil
+}
+
 func (s *grpcServer) ClientEvent(ctx xctx.Context, req *service.ClientEventRequest) (*service.ClientEventResponse, error) {
 	defer s.inRPC()()
 	err := s.handler.ClientEvent(s.bindCtx(ctx), req)
@@ -539,7 +908,7 @@ func (s *grpcServer) Trace(conn service.Gapid_TraceServer) error {
 
 func (s *grpcServer) GetTimestamps(ctx xctx.Context, req *service.GetTimestampsRequest) (*service.GetTimestampsResponse, error) {
 	defer s.inRPC()()
-	data, err := s.handler.GetTimestamps(s.bindCtx(ctx), req.Capture, req.Device)
+	data, err := s.handler.GetTimestamps(s.bindCtx(ctx), req.Capture, req.Device, req.Options)
 	if err := service.NewError(err); err != nil {
 		return &service.GetTimestampsResponse{Res: &service.GetTimestampsResponse_Error{Error: err}}, nil
 	}
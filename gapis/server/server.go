@@ -19,6 +19,7 @@ package server
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"os"
@@ -43,6 +44,7 @@ import (
 	"github.com/google/gapid/core/os/file"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
 	"github.com/google/gapid/gapis/messages"
 	"github.com/google/gapid/gapis/replay"
 	"github.com/google/gapid/gapis/replay/devices"
@@ -70,6 +72,9 @@ type Config struct {
 	DeviceScanDone   task.Signal
 	LogBroadcaster   *log.Broadcaster
 	IdleTimeout      time.Duration
+	// TLS is the configuration of the TLS connections of the clients, or nil
+	// for insecure connections.
+	TLS *tls.Config
 }
 
 // Server is the server interface to GAPIS.
@@ -273,6 +278,13 @@ func (s *server) ExportReplay(ctx context.Context, c *path.Capture, d *path.Devi
 	return exportReplay(ctx, c, d, out, opts)
 }
 
+func (s *server) ReplaceData(ctx context.Context, after *path.Command, handle, offset uint64, data []byte) (*path.Capture, error) {
+	ctx = status.Start(ctx, "RPC ReplaceData")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "ReplaceData")
+	return resolve.ReplaceData(ctx, after, handle, offset, data, nil)
+}
+
 func (s *server) DCECapture(ctx context.Context, p *path.Capture, requested []*path.Command) (*path.Capture, error) {
 	ctx = log.Enter(ctx, "DCECapture")
 	c, err := capture.ResolveFromPath(ctx, p)
@@ -286,6 +298,177 @@ func (s *server) DCECapture(ctx context.Context, p *path.Capture, requested []*p
 	return trimmed, nil
 }
 
+func (s *server) TrimCapture(ctx context.Context, p *path.Capture, from, to *path.Command, commands []*path.Command) (*path.Capture, error) {
+	ctx = status.Start(ctx, "RPC TrimCapture")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "TrimCapture")
+	c, err := capture.ResolveFromPath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(from.GetIndices()) == 0 || len(to.GetIndices()) == 0 {
+		return nil, fmt.Errorf("Both ends of the command range must be given")
+	}
+	requested := make([]api.SubCmdIdx, len(commands))
+	for i, cmd := range commands {
+		if len(cmd.GetIndices()) == 0 {
+			return nil, fmt.Errorf("The commands to keep must have an index")
+		}
+		requested[i] = api.SubCmdIdx(cmd.Indices)
+	}
+	return dependencygraph.TrimCapture(ctx, c.Name+"_trimmed", p,
+		api.CmdID(from.Indices[0]), api.CmdID(to.Indices[0]), requested)
+}
+
+func (s *server) GetDependencies(ctx context.Context, p *path.Command) ([]*path.Command, error) {
+	ctx = status.Start(ctx, "RPC GetDependencies")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetDependencies")
+	return dependencygraph.GetDependencies(ctx, p)
+}
+
+func (s *server) GetDependents(ctx context.Context, p *path.Command) ([]*path.Command, error) {
+	ctx = status.Start(ctx, "RPC GetDependents")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetDependents")
+	return dependencygraph.GetDependents(ctx, p)
+}
+
+func (s *server) GetResourceUses(ctx context.Context, c *path.Capture, handle uint64) ([]*service.ResourceUse, error) {
+	ctx = status.Start(ctx, "RPC GetResourceUses")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetResourceUses")
+	return resolve.ResourceUses(ctx, c, handle)
+}
+
+func (s *server) GetShaderReflection(ctx context.Context, after *path.Command, handle uint64) (*service.ShaderReflection, error) {
+	ctx = status.Start(ctx, "RPC GetShaderReflection")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetShaderReflection")
+	return resolve.ShaderReflection(ctx, after, handle)
+}
+
+func (s *server) FilterCommands(ctx context.Context, c *path.Capture, expr string) ([]uint64, error) {
+	ctx = status.Start(ctx, "RPC FilterCommands")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "FilterCommands")
+	return resolve.FilterCommands(ctx, c, expr)
+}
+
+func (s *server) FilterCommandTree(ctx context.Context, tree *path.ID) (service.CommandTreeFilterHandler, error) {
+	ctx = status.Start(ctx, "RPC FilterCommandTree")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "FilterCommandTree")
+	f, err := resolve.NewCommandTreeFilter(ctx, tree)
+	if err != nil {
+		return nil, err
+	}
+	return commandTreeFilterHandler{f}, nil
+}
+
+// commandTreeFilterHandler implements the CommandTreeFilterHandler interface.
+type commandTreeFilterHandler struct {
+	*resolve.CommandTreeFilter
+}
+
+func (commandTreeFilterHandler) Dispose() {}
+
+func (s *server) GetMemoryHeaps(ctx context.Context, after *path.Command) (*service.MemoryHeaps, error) {
+	ctx = status.Start(ctx, "RPC GetMemoryHeaps")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetMemoryHeaps")
+	return resolve.MemoryHeaps(ctx, after)
+}
+
+func (s *server) GetImageLayouts(ctx context.Context, after *path.Command, image uint64) ([]*service.ImageSubresourceLayout, error) {
+	ctx = status.Start(ctx, "RPC GetImageLayouts")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetImageLayouts")
+	if err := after.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", after)
+	}
+	return resolve.ImageLayouts(ctx, after, image)
+}
+
+func (s *server) GetStateDiff(ctx context.Context, from, to *path.Command, c *path.ResolveConfig) (*service.StateDiff, error) {
+	ctx = status.Start(ctx, "RPC GetStateDiff")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetStateDiff")
+	if err := from.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", from)
+	}
+	if err := to.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", to)
+	}
+	return resolve.StateDiff(ctx, from, to, c)
+}
+
+func (s *server) SetAnnotation(ctx context.Context, c *path.Capture, a *service.Annotation) error {
+	ctx = status.Start(ctx, "RPC SetAnnotation")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "SetAnnotation")
+	if err := c.Validate(); err != nil {
+		return log.Errf(ctx, err, "Invalid path: %v", c)
+	}
+	return resolve.SetAnnotation(ctx, c, a)
+}
+
+func (s *server) GetAnnotations(ctx context.Context, c *path.Capture) (*service.Annotations, error) {
+	ctx = status.Start(ctx, "RPC GetAnnotations")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetAnnotations")
+	if err := c.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", c)
+	}
+	return resolve.Annotations(ctx, c)
+}
+
+func (s *server) SetReportConfig(ctx context.Context, c *path.Capture, cfg *service.ReportConfig) error {
+	ctx = status.Start(ctx, "RPC SetReportConfig")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "SetReportConfig")
+	if err := c.Validate(); err != nil {
+		return log.Errf(ctx, err, "Invalid path: %v", c)
+	}
+	return resolve.SetReportConfig(ctx, c, cfg)
+}
+
+func (s *server) GetReportConfig(ctx context.Context, c *path.Capture) (*service.ReportConfig, error) {
+	ctx = status.Start(ctx, "RPC GetReportConfig")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetReportConfig")
+	if err := c.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", c)
+	}
+	return resolve.ReportConfig(ctx, c)
+}
+
+func (s *server) GetFilmstrip(ctx context.Context, req *service.GetFilmstripRequest) (*service.Filmstrip, error) {
+	ctx = status.Start(ctx, "RPC GetFilmstrip")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetFilmstrip")
+	if err := req.Capture.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", req.Capture)
+	}
+	return resolve.Filmstrip(ctx, req.Capture, req.FrameStep, req.DesiredMaxWidth,
+		req.DesiredMaxHeight, req.DesiredFormat, req.DisableOptimization, req.Config)
+}
+
+func (s *server) CompareReplays(ctx context.Context, req *service.CompareReplaysRequest) (*service.ReplayComparison, error) {
+	ctx = status.Start(ctx, "RPC CompareReplays")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "CompareReplays")
+	if err := req.Capture.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", req.Capture)
+	}
+	for _, d := range req.Devices {
+		if err := d.Validate(); err != nil {
+			return nil, log.Errf(ctx, err, "Invalid path: %v", d)
+		}
+	}
+	return resolve.CompareReplays(ctx, req.Capture, req.Devices, req.FrameStep, req.Threshold, req.Config)
+}
+
 func (s *server) GetDevices(ctx context.Context) ([]*path.Device, error) {
 	ctx = status.Start(ctx, "RPC GetDevices")
 	defer status.Finish(ctx)
@@ -348,6 +531,151 @@ func (s *server) GetFramebufferAttachment(
 	return resolve.FramebufferAttachment(ctx, replaySettings, after, attachment, settings, hints, r)
 }
 
+func (s *server) GetFramebufferAttachments(
+	ctx context.Context,
+	replaySettings *service.ReplaySettings,
+	attachments []*service.FramebufferAttachmentQuery,
+	hints *service.UsageHints,
+) ([]*service.FramebufferAttachmentImage, error) {
+
+	ctx = status.Start(ctx, "RPC GetFramebufferAttachments")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetFramebufferAttachments")
+	if err := replaySettings.Device.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", replaySettings.Device)
+	}
+	for _, a := range attachments {
+		if err := a.After.Validate(); err != nil {
+			return nil, log.Errf(ctx, err, "Invalid path: %v", a.After)
+		}
+	}
+	r := &path.ResolveConfig{
+		ReplayDevice: replaySettings.Device,
+	}
+	return resolve.FramebufferAttachments(ctx, replaySettings, attachments, hints, r)
+}
+
+func (s *server) GetOverdraw(
+	ctx context.Context,
+	replaySettings *service.ReplaySettings,
+	first, after *path.Command,
+	hints *service.UsageHints,
+) (*path.ImageInfo, error) {
+
+	ctx = status.Start(ctx, "RPC GetOverdraw")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetOverdraw")
+	if err := replaySettings.Device.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", replaySettings.Device)
+	}
+	if err := after.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", after)
+	}
+	if first != nil {
+		if err := first.Validate(); err != nil {
+			return nil, log.Errf(ctx, err, "Invalid path: %v", first)
+		}
+	}
+	r := &path.ResolveConfig{
+		ReplayDevice: replaySettings.Device,
+	}
+	return resolve.Overdraw(ctx, replaySettings, first, after, hints, r)
+}
+
+func (s *server) GetPipelineStatistics(
+	ctx context.Context,
+	replaySettings *service.ReplaySettings,
+	draws []*path.Command,
+	hints *service.UsageHints,
+) (*service.PipelineStatistics, error) {
+
+	ctx = status.Start(ctx, "RPC GetPipelineStatistics")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetPipelineStatistics")
+	if err := replaySettings.Device.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", replaySettings.Device)
+	}
+	for _, d := range draws {
+		if err := d.Validate(); err != nil {
+			return nil, log.Errf(ctx, err, "Invalid path: %v", d)
+		}
+	}
+	r := &path.ResolveConfig{
+		ReplayDevice: replaySettings.Device,
+	}
+	return resolve.PipelineStatistics(ctx, replaySettings, draws, hints, r)
+}
+
+func (s *server) GetDispatchBuffers(
+	ctx context.Context,
+	replaySettings *service.ReplaySettings,
+	dispatch *path.Command,
+	hints *service.UsageHints,
+) (*service.DispatchBuffers, error) {
+
+	ctx = status.Start(ctx, "RPC GetDispatchBuffers")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetDispatchBuffers")
+	if err := replaySettings.Device.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", replaySettings.Device)
+	}
+	if err := dispatch.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", dispatch)
+	}
+	r := &path.ResolveConfig{
+		ReplayDevice: replaySettings.Device,
+	}
+	return resolve.DispatchBuffers(ctx, replaySettings, dispatch, hints, r)
+}
+
+func (s *server) GetCaptureEnvironment(ctx context.Context, c *path.Capture, d *path.Device) (*service.CaptureEnvironment, error) {
+	ctx = status.Start(ctx, "RPC GetCaptureEnvironment")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetCaptureEnvironment")
+	if err := c.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", c)
+	}
+	if d != nil {
+		if err := d.Validate(); err != nil {
+			return nil, log.Errf(ctx, err, "Invalid path: %v", d)
+		}
+	}
+	return resolve.CaptureEnvironment(ctx, c, d)
+}
+
+func (s *server) GetObjectLifetimes(ctx context.Context, c *path.Capture) (*service.ObjectLifetimes, error) {
+	ctx = status.Start(ctx, "RPC GetObjectLifetimes")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetObjectLifetimes")
+	if err := c.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", c)
+	}
+	return resolve.ObjectLifetimes(ctx, c)
+}
+
+func (s *server) GetCaptureDiff(ctx context.Context, before, after *path.Capture, r *path.ResolveConfig) (*service.CaptureDiff, error) {
+	ctx = status.Start(ctx, "RPC GetCaptureDiff")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetCaptureDiff")
+	if err := before.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", before)
+	}
+	if err := after.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", after)
+	}
+	return dependencygraph.DiffCaptures(ctx, before, after, r)
+}
+
+func (s *server) CallExtension(ctx context.Context, c *path.Capture, extension, endpoint string, args []byte) ([]byte, error) {
+	ctx = status.Start(ctx, "RPC CallExtension<%v.%v>", extension, endpoint)
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "CallExtension")
+	if err := c.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", c)
+	}
+	return resolve.CallExtension(ctx, c, extension, endpoint, args)
+}
+
 func (s *server) Get(ctx context.Context, p *path.Any, c *path.ResolveConfig) (interface{}, error) {
 	ctx = status.Start(ctx, "RPC Get<%v>", p)
 	defer status.Finish(ctx)
@@ -362,6 +690,16 @@ func (s *server) Get(ctx context.Context, p *path.Any, c *path.ResolveConfig) (i
 	return v, nil
 }
 
+func (s *server) GetStream(ctx context.Context, req *service.GetStreamRequest, h service.DataChunkHandler) error {
+	ctx = status.Start(ctx, "RPC GetStream<%v>", req.Path)
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetStream")
+	if err := req.Path.Validate(); err != nil {
+		return log.Errf(ctx, err, "Invalid path: %v", req.Path)
+	}
+	return resolve.ValueChunks(ctx, req.Path, req.Offset, req.ChunkSize, req.Config, h)
+}
+
 func (s *server) Set(ctx context.Context, p *path.Any, v interface{}, r *path.ResolveConfig) (*path.Any, error) {
 	ctx = status.Start(ctx, "RPC Set<%v>", p)
 	defer status.Finish(ctx)
@@ -530,6 +868,7 @@ func optionsToTraceOptions(opts *service.TraceOptions) tracer.TraceOptions {
 		ObserveFrameFrequency: opts.ObserveFrameFrequency,
 		ObserveDrawFrequency:  opts.ObserveDrawFrequency,
 		StartFrame:            opts.StartFrame,
+		StartMarker:           opts.StartMarker,
 		FramesToCapture:       opts.FramesToCapture,
 		DisablePCS:            opts.DisablePcs,
 		RecordErrorState:      opts.RecordErrorState,
@@ -682,9 +1021,40 @@ func (s *server) UpdateSettings(ctx context.Context, settings *service.UpdateSet
 	return nil
 }
 
-func (s *server) GetTimestamps(ctx context.Context, c *path.Capture, d *path.Device) (interface{}, error) {
+func (s *server) GetCacheUsage(ctx context.Context, clear bool) (*service.CacheUsage, error) {
+	ctx = status.Start(ctx, "RPC GetCacheUsage")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetCacheUsage")
+	c := database.GetCache(ctx)
+	if c == nil {
+		return nil, &service.ErrDataUnavailable{
+			Reason: messages.ErrMessage("The database does not cache resolved values"),
+		}
+	}
+	if clear {
+		c.TrimCache(ctx, 0)
+	}
+	usage := c.CacheUsage()
+	return &service.CacheUsage{
+		Entries:   usage.Entries,
+		Size:      usage.Size,
+		Limit:     usage.Limit,
+		Evictions: usage.Evictions,
+	}, nil
+}
+
+func (s *server) GetTimestamps(ctx context.Context, c *path.Capture, d *path.Device, opts *service.TimestampsOptions) (interface{}, error) {
 	ctx = status.Start(ctx, "RPC GetTimestamps")
 	defer status.Finish(ctx)
 	ctx = log.Enter(ctx, "GetTimestamps")
-	return replay.GetTimestamps(ctx, c, d)
+	res, err := replay.GetTimestamps(ctx, c, d, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.GetCpuTimes() && d != nil {
+		if err := resolve.TimestampsCPUTimes(ctx, c, d, res.GetTimestamps()); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
 }
@@ -81,9 +81,63 @@ type Service interface {
 	// ExportReplay saves replay commands and assets to file.
 	ExportReplay(ctx context.Context, c *path.Capture, d *path.Device, path string, opts *ExportReplayOptions) error
 
+	// ReplaceData returns a new capture in which the bytes at offset of the buffer or image with the given handle
+	// are replaced with data from the command after on.
+	ReplaceData(ctx context.Context, after *path.Command, handle, offset uint64, data []byte) (*path.Capture, error)
+
 	// DCECapture returns a new capture containing only the requested commands and their dependencies.
 	DCECapture(ctx context.Context, capture *path.Capture, commands []*path.Command) (*path.Capture, error)
 
+	// TrimCapture returns a new capture containing only the commands in the range [from, to] needed to reproduce
+	// the given commands, or the command to if none are given, preceded by commands restoring the state at the
+	// command from.
+	TrimCapture(ctx context.Context, capture *path.Capture, from, to *path.Command, commands []*path.Command) (*path.Capture, error)
+
+	// GetDependencies returns the commands and subcommands that the given command or subcommand directly depends on.
+	GetDependencies(ctx context.Context, command *path.Command) ([]*path.Command, error)
+
+	// GetDependents returns the commands and subcommands that directly depend on the given command or subcommand.
+	GetDependents(ctx context.Context, command *path.Command) ([]*path.Command, error)
+
+	// GetResourceUses returns the commands and subcommands that read, write or transition the layout of the given buffer or image.
+	GetResourceUses(ctx context.Context, c *path.Capture, handle uint64) ([]*ResourceUse, error)
+
+	// GetShaderReflection returns the entry points, descriptor bindings, input and output interfaces and push constant blocks of the given shader module.
+	GetShaderReflection(ctx context.Context, after *path.Command, handle uint64) (*ShaderReflection, error)
+
+	// FilterCommands returns the indices of the commands of the capture that match the given filter expression.
+	FilterCommands(ctx context.Context, c *path.Capture, expr string) ([]uint64, error)
+
+	// FilterCommandTree returns a handler filtering the commands of the command tree with a sequence of filter expressions.
+	FilterCommandTree(ctx context.Context, tree *path.ID) (CommandTreeFilterHandler, error)
+
+	// GetMemoryHeaps returns the live device memory allocations after the given command, grouped by their memory heaps and memory types, and the timeline of the allocations up to the command.
+	GetMemoryHeaps(ctx context.Context, after *path.Command) (*MemoryHeaps, error)
+
+	// GetImageLayouts returns the layouts of the subresources of the given image after the given command.
+	GetImageLayouts(ctx context.Context, after *path.Command, image uint64) ([]*ImageSubresourceLayout, error)
+
+	// GetStateDiff returns the changes to the API state and the memory writes from the state after the command from to the state after the command to.
+	GetStateDiff(ctx context.Context, from, to *path.Command, c *path.ResolveConfig) (*StateDiff, error)
+
+	// SetAnnotation attaches the annotation to its command or resource of the given capture, replacing the previous one.
+	SetAnnotation(ctx context.Context, c *path.Capture, a *Annotation) error
+
+	// GetAnnotations returns all the annotations of the given capture.
+	GetAnnotations(ctx context.Context, c *path.Capture) (*Annotations, error)
+
+	// SetReportConfig replaces the report configuration of the given capture.
+	SetReportConfig(ctx context.Context, c *path.Capture, cfg *ReportConfig) error
+
+	// GetReportConfig returns the report configuration of the given capture.
+	GetReportConfig(ctx context.Context, c *path.Capture) (*ReportConfig, error)
+
+	// GetFilmstrip returns the thumbnails of the framebuffer at the end of every frame, or every frameStep-th frame, of the given capture.
+	GetFilmstrip(ctx context.Context, req *GetFilmstripRequest) (*Filmstrip, error)
+
+	// CompareReplays replays the given capture on several devices concurrently and compares the framebuffers at the end of the frames.
+	CompareReplays(ctx context.Context, req *CompareReplaysRequest) (*ReplayComparison, error)
+
 	// GetDevices returns the full list of replay devices avaliable to the server.
 	// These include local replay devices and any connected Android devices.
 	// This list may change over time, as devices are connected and disconnected.
@@ -112,9 +166,65 @@ type Service interface {
 		settings *RenderSettings,
 		hints *UsageHints) (*path.ImageInfo, error)
 
+	// GetFramebufferAttachments returns the images of all the given framebuffer
+	// attachments, with their data, read back in as few replays as possible.
+	GetFramebufferAttachments(
+		ctx context.Context,
+		replaySettings *ReplaySettings,
+		attachments []*FramebufferAttachmentQuery,
+		hints *UsageHints) ([]*FramebufferAttachmentImage, error)
+
+	// GetOverdraw returns the ImageInfo identifier of the per-pixel overdraw
+	// counts of the draws from the command first to the command after, in the
+	// last render pass of the range. If first is nil, all the draws of the
+	// render pass up to after are counted.
+	GetOverdraw(
+		ctx context.Context,
+		replaySettings *ReplaySettings,
+		first, after *path.Command,
+		hints *UsageHints) (*path.ImageInfo, error)
+
+	// GetPipelineStatistics returns the pipeline statistics of the draws,
+	// queried around each draw while replaying the capture.
+	GetPipelineStatistics(
+		ctx context.Context,
+		replaySettings *ReplaySettings,
+		draws []*path.Command,
+		hints *UsageHints) (*PipelineStatistics, error)
+
+	// GetDispatchBuffers returns the contents of the storage buffers bound to
+	// the dispatch, read back right before and right after the dispatch while
+	// replaying the capture.
+	GetDispatchBuffers(
+		ctx context.Context,
+		replaySettings *ReplaySettings,
+		dispatch *path.Command,
+		hints *UsageHints) (*DispatchBuffers, error)
+
+	// GetCaptureEnvironment returns the device the capture was taken on, and
+	// the instances and devices created by the application. If d is not nil,
+	// the capabilities used by the capture that the device d lacks are listed.
+	GetCaptureEnvironment(ctx context.Context, c *path.Capture, d *path.Device) (*CaptureEnvironment, error)
+
+	// GetObjectLifetimes returns the commands creating and destroying the
+	// objects of the capture.
+	GetObjectLifetimes(ctx context.Context, c *path.Capture) (*ObjectLifetimes, error)
+
+	// GetCaptureDiff returns the commands and the resources that differ
+	// between the before and after captures.
+	GetCaptureDiff(ctx context.Context, before, after *path.Capture, r *path.ResolveConfig) (*CaptureDiff, error)
+
+	// CallExtension calls the endpoint of the server extension with the
+	// capture and arguments, and returns its result.
+	CallExtension(ctx context.Context, c *path.Capture, extension, endpoint string, args []byte) ([]byte, error)
+
 	// Get resolves and returns the object, value or memory at the path p.
 	Get(ctx context.Context, p *path.Any, c *path.ResolveConfig) (interface{}, error)
 
+	// GetStream resolves the object, value or memory at the path of req, and
+	// streams it to h as chunks of the encoded Value.
+	GetStream(ctx context.Context, req *GetStreamRequest, h DataChunkHandler) error
+
 	// Set creates a copy of the capture referenced by p, but with the object, value
 	// or memory at p replaced with v. The path returned is identical to p, but with
 	// the base changed to refer to the new capture.
@@ -162,7 +272,13 @@ type Service interface {
 	// Update the environment settings.
 	UpdateSettings(ctx context.Context, req *UpdateSettingsRequest) error
 
-	GetTimestamps(ctx context.Context, c *path.Capture, d *path.Device) (interface{}, error)
+	// GetCacheUsage returns the usage of the cache of resolved values, after
+	// evicting all the values not in use if clear is true.
+	GetCacheUsage(ctx context.Context, clear bool) (*CacheUsage, error)
+
+	// GetTimestamps replays the capture on the device and returns the GPU time
+	// of the command buffers, and of the render passes if requested.
+	GetTimestamps(ctx context.Context, c *path.Capture, d *path.Device, opts *TimestampsOptions) (interface{}, error)
 }
 
 type TraceHandler interface {
@@ -171,9 +287,21 @@ type TraceHandler interface {
 	Dispose()
 }
 
+// CommandTreeFilterHandler is the handler of the filter expressions of
+// Service.FilterCommandTree.
+type CommandTreeFilterHandler interface {
+	// Filter returns the tree nodes of the commands added to and removed from
+	// the filtered commands by the given filter expression.
+	Filter(ctx context.Context, expr string) (*CommandTreeDelta, error)
+	Dispose()
+}
+
 // FindHandler is the handler of found items using Service.Find.
 type FindHandler func(*FindResponse) error
 
+// DataChunkHandler is the handler of the chunks streamed by Service.GetStream.
+type DataChunkHandler func(*DataChunk) error
+
 // NewError attempts to box and return err into an Error.
 // If err cannot be boxed into an Error then nil is returned.
 func NewError(err error) *Error {
@@ -340,41 +340,192 @@ func descriptorBindingLess(a DescriptorBinding, b DescriptorBinding) bool {
 	return a.SpirvId < b.SpirvId
 }
 
-// ParseDescriptorSets determines what descriptor sets are implied by the shader
-func ParseDescriptorSets(shader []uint32, entryPoint string) (DescriptorSets, error) {
-	spvReflectErr := func(res C.SpvReflectResult) error {
-		if res == C.SPV_REFLECT_RESULT_SUCCESS {
-			return nil
-		}
-		return fmt.Errorf("SPIRV-Reflect failed with error code %v\n", res)
+// ShaderReflection describes the interface of a SPIR-V shader module.
+type ShaderReflection struct {
+	EntryPoints   []EntryPoint
+	PushConstants []PushConstantBlock
+}
+
+// EntryPoint describes the descriptor bindings and the input and output
+// interfaces of an entry point of a shader module.
+type EntryPoint struct {
+	Name string
+	// ShaderStage is the VkShaderStageFlagBits of the entry point.
+	ShaderStage    uint32
+	DescriptorSets DescriptorSets
+	Inputs         []InterfaceVariable
+	Outputs        []InterfaceVariable
+}
+
+// InterfaceVariable is an input or output variable of an entry point.
+type InterfaceVariable struct {
+	Name     string
+	Location uint32
+	// Format is the VkFormat of the variable.
+	Format  uint32
+	BuiltIn bool
+}
+
+// PushConstantBlock is a push constant block of a shader module.
+type PushConstantBlock struct {
+	Name   string
+	Offset uint32
+	Size   uint32
+}
+
+func spvReflectErr(res C.SpvReflectResult) error {
+	if res == C.SPV_REFLECT_RESULT_SUCCESS {
+		return nil
 	}
-	module := C.SpvReflectShaderModule{}
-	cEntryPoint := C.CString(entryPoint)
-	defer C.free(unsafe.Pointer(cEntryPoint))
+	return fmt.Errorf("SPIRV-Reflect failed with error code %v\n", res)
+}
 
+// createReflectModule parses the shader with SPIRV-Reflect. The module must
+// be destroyed with spvReflectDestroyShaderModule.
+func createReflectModule(shader []uint32, module *C.SpvReflectShaderModule) error {
 	shaderPtr := unsafe.Pointer(nil)
 	if len(shader) > 0 {
 		shaderPtr = unsafe.Pointer(&shader[0])
 	}
-	if err := spvReflectErr(C.spvReflectCreateShaderModule(
+	return spvReflectErr(C.spvReflectCreateShaderModule(
 		C.size_t(len(shader)*4),
 		shaderPtr,
-		&module)); err != nil {
+		module))
+}
+
+// ParseDescriptorSets determines what descriptor sets are implied by the shader
+func ParseDescriptorSets(shader []uint32, entryPoint string) (DescriptorSets, error) {
+	module := C.SpvReflectShaderModule{}
+	if err := createReflectModule(shader, &module); err != nil {
 		return nil, err
 	}
 	defer C.spvReflectDestroyShaderModule(&module)
 
+	cEntryPoint := C.CString(entryPoint)
+	defer C.free(unsafe.Pointer(cEntryPoint))
 	entryPointStruct := C.spvReflectGetEntryPoint(
 		&module,
 		cEntryPoint)
 	if entryPointStruct == nil {
-		return nil, fmt.Errorf("Entry point %v not found")
+		return nil, fmt.Errorf("Entry point %v not found", entryPoint)
+	}
+	return parseDescriptorSets(&module, cEntryPoint, uint32(entryPointStruct.shader_stage))
+}
+
+// ReflectShader returns the entry points and the push constant blocks of the
+// shader.
+func ReflectShader(shader []uint32) (*ShaderReflection, error) {
+	module := C.SpvReflectShaderModule{}
+	if err := createReflectModule(shader, &module); err != nil {
+		return nil, err
+	}
+	defer C.spvReflectDestroyShaderModule(&module)
+
+	res := &ShaderReflection{
+		EntryPoints:   make([]EntryPoint, module.entry_point_count),
+		PushConstants: []PushConstantBlock{},
 	}
+	for i := range res.EntryPoints {
+		entryPointPtr := uintptr(unsafe.Pointer(module.entry_points)) +
+			uintptr(i)*unsafe.Sizeof(*module.entry_points)
+		entryPointStruct := (*C.SpvReflectEntryPoint)(unsafe.Pointer(entryPointPtr))
+		stage := uint32(entryPointStruct.shader_stage)
+		sets, err := parseDescriptorSets(&module, entryPointStruct.name, stage)
+		if err != nil {
+			return nil, err
+		}
+		inputs, err := parseInterfaceVariables(&module, entryPointStruct.name, true)
+		if err != nil {
+			return nil, err
+		}
+		outputs, err := parseInterfaceVariables(&module, entryPointStruct.name, false)
+		if err != nil {
+			return nil, err
+		}
+		res.EntryPoints[i] = EntryPoint{
+			Name:           C.GoString(entryPointStruct.name),
+			ShaderStage:    stage,
+			DescriptorSets: sets,
+			Inputs:         inputs,
+			Outputs:        outputs,
+		}
+	}
+
+	blockCount := C.uint32_t(0)
+	if err := spvReflectErr(C.spvReflectEnumeratePushConstantBlocks(
+		&module,
+		&blockCount,
+		nil)); err != nil {
+		return nil, err
+	}
+	blocks := make([]*C.SpvReflectBlockVariable, blockCount)
+	if blockCount > 0 {
+		if err := spvReflectErr(C.spvReflectEnumeratePushConstantBlocks(
+			&module,
+			&blockCount,
+			&blocks[0])); err != nil {
+			return nil, err
+		}
+	}
+	for _, block := range blocks {
+		res.PushConstants = append(res.PushConstants, PushConstantBlock{
+			Name:   C.GoString(block.name),
+			Offset: uint32(block.offset),
+			Size:   uint32(block.size),
+		})
+	}
+	sort.Slice(res.PushConstants, func(i, j int) bool {
+		return res.PushConstants[i].Offset < res.PushConstants[j].Offset
+	})
 
+	return res, nil
+}
+
+// parseInterfaceVariables returns the input or output variables of the entry
+// point, sorted by their locations. The built-in variables come last.
+func parseInterfaceVariables(module *C.SpvReflectShaderModule, entryPoint *C.char,
+	inputs bool) ([]InterfaceVariable, error) {
+	enumerate := func(count *C.uint32_t, vars **C.SpvReflectInterfaceVariable) C.SpvReflectResult {
+		if inputs {
+			return C.spvReflectEnumerateEntryPointInputVariables(module, entryPoint, count, vars)
+		}
+		return C.spvReflectEnumerateEntryPointOutputVariables(module, entryPoint, count, vars)
+	}
+	varCount := C.uint32_t(0)
+	if err := spvReflectErr(enumerate(&varCount, nil)); err != nil {
+		return nil, err
+	}
+	vars := make([]*C.SpvReflectInterfaceVariable, varCount)
+	if varCount > 0 {
+		if err := spvReflectErr(enumerate(&varCount, &vars[0])); err != nil {
+			return nil, err
+		}
+	}
+	res := make([]InterfaceVariable, len(vars))
+	for i, v := range vars {
+		res[i] = InterfaceVariable{
+			Name:     C.GoString(v.name),
+			Location: uint32(v.location),
+			Format:   uint32(v.format),
+			BuiltIn:  v.decoration_flags&C.SPV_REFLECT_DECORATION_BUILT_IN != 0,
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].BuiltIn != res[j].BuiltIn {
+			return res[j].BuiltIn
+		}
+		return res[i].Location < res[j].Location
+	})
+	return res, nil
+}
+
+// parseDescriptorSets returns the descriptor sets used by the entry point.
+func parseDescriptorSets(module *C.SpvReflectShaderModule, entryPoint *C.char,
+	stage uint32) (DescriptorSets, error) {
 	setCount := C.uint32_t(0)
 	if err := spvReflectErr(C.spvReflectEnumerateEntryPointDescriptorSets(
-		&module,
-		cEntryPoint,
+		module,
+		entryPoint,
 		&setCount,
 		nil)); err != nil {
 		return nil, err
@@ -385,8 +536,8 @@ func ParseDescriptorSets(shader []uint32, entryPoint string) (DescriptorSets, er
 		setsPtr = unsafe.Pointer(&sets[0])
 	}
 	if err := spvReflectErr(C.spvReflectEnumerateEntryPointDescriptorSets(
-		&module,
-		cEntryPoint,
+		module,
+		entryPoint,
 		&setCount,
 		(**C.SpvReflectDescriptorSet)(setsPtr),
 	)); err != nil {
@@ -411,7 +562,7 @@ func ParseDescriptorSets(shader []uint32, entryPoint string) (DescriptorSets, er
 				SpirvId:         uint32(binding.spirv_id),
 				DescriptorType:  uint32(binding.descriptor_type),
 				DescriptorCount: uint32(descriptorCount),
-				ShaderStage:     uint32(entryPointStruct.shader_stage),
+				ShaderStage:     stage,
 			}
 		}
 		sort.Slice(bindings, func(i, j int) bool {
@@ -548,6 +548,77 @@ func TestParseDescriptorSets(t *testing.T) {
 	}
 }
 
+func TestReflectShader(t *testing.T) {
+	ctx := log.Testing(t)
+	spv := shadertools.AssembleSpirvText(multientrypoint_spv)
+	res, err := shadertools.ReflectShader(spv)
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+	// The built-in gl_PerVertex block is left out, as only the user defined
+	// variables have locations.
+	userVars := func(vars []shadertools.InterfaceVariable) []shadertools.InterfaceVariable {
+		out := []shadertools.InterfaceVariable{}
+		for _, v := range vars {
+			if !v.BuiltIn {
+				out = append(out, v)
+			}
+		}
+		return out
+	}
+	expected := []struct {
+		name    string
+		stage   uint32
+		sets    shadertools.DescriptorSets
+		inputs  []shadertools.InterfaceVariable
+		outputs []shadertools.InterfaceVariable
+	}{
+		{
+			"entry_vert",
+			1, // VK_SHADER_STAGE_VERTEX_BIT
+			shadertools.DescriptorSets{
+				0: shadertools.DescriptorSet{
+					{Set: 0, Binding: 1, SpirvId: 11, DescriptorType: 6, DescriptorCount: 1, ShaderStage: 1},
+				},
+			},
+			[]shadertools.InterfaceVariable{
+				{Name: "iUV", Location: 0, Format: 103}, // VK_FORMAT_R32G32_SFLOAT
+				{Name: "pos", Location: 1, Format: 106}, // VK_FORMAT_R32G32B32_SFLOAT
+			},
+			[]shadertools.InterfaceVariable{
+				{Name: "oUV", Location: 0, Format: 103}, // VK_FORMAT_R32G32_SFLOAT
+			},
+		},
+		{
+			"entry_frag",
+			16, // VK_SHADER_STAGE_FRAGMENT_BIT
+			shadertools.DescriptorSets{
+				0: shadertools.DescriptorSet{
+					{Set: 0, Binding: 0, SpirvId: 17, DescriptorType: 1, DescriptorCount: 1, ShaderStage: 16},
+					{Set: 0, Binding: 1, SpirvId: 11, DescriptorType: 6, DescriptorCount: 1, ShaderStage: 16},
+				},
+			},
+			[]shadertools.InterfaceVariable{
+				{Name: "iUV", Location: 0, Format: 103}, // VK_FORMAT_R32G32_SFLOAT
+			},
+			[]shadertools.InterfaceVariable{
+				{Name: "colour", Location: 0, Format: 109}, // VK_FORMAT_R32G32B32A32_SFLOAT
+			},
+		},
+	}
+	if !assert.For(ctx, "entry points").That(len(res.EntryPoints)).Equals(len(expected)) {
+		return
+	}
+	for i, e := range expected {
+		got := res.EntryPoints[i]
+		assert.For(ctx, "name").That(got.Name).Equals(e.name)
+		assert.For(ctx, "%v stage", e.name).That(got.ShaderStage).Equals(e.stage)
+		assert.For(ctx, "%v sets", e.name).ThatMap(got.DescriptorSets).DeepEquals(e.sets)
+		assert.For(ctx, "%v inputs", e.name).ThatSlice(userVars(got.Inputs)).DeepEquals(e.inputs)
+		assert.For(ctx, "%v outputs", e.name).ThatSlice(userVars(got.Outputs)).DeepEquals(e.outputs)
+	}
+}
+
 var (
 	multientrypoint_spv = `
 ; SPIR-V
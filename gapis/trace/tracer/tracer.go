@@ -62,6 +62,7 @@ type TraceOptions struct {
 	ObserveFrameFrequency uint32  // How frequently should we do frame observations
 	ObserveDrawFrequency  uint32  // How frequently should we do draw observations
 	StartFrame            uint32  // What frame should we start capturing
+	StartMarker           string  // After what debug marker should we start capturing
 	FramesToCapture       uint32  // How many frames should we capture
 	DisablePCS            bool    // Should we disable PCS
 	RecordErrorState      bool    // Should we record the driver error state after each command
@@ -149,5 +150,6 @@ func (o TraceOptions) GapiiOptions() gapii.Options {
 		flags,
 		o.AdditionalFlags,
 		o.PipeName,
+		o.StartMarker,
 	}
 }